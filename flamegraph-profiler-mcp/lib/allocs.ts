@@ -0,0 +1,219 @@
+/**
+ * Allocation hotspots of heap profiles: allocation sites ranked by bytes and
+ * by object count, split into large allocations and small-object churn, with
+ * likely reasons each site allocates on the heap, from the compiler's escape
+ * analysis and the allocating source line.
+ */
+import { execFile } from "node:child_process";
+import { readFileSync } from "node:fs";
+import path from "node:path";
+import { promisify } from "node:util";
+import { goPaths, resolveSourceFile } from "./annotate.js";
+import { percentOf } from "./flamegraph.js";
+import { sampleIndexOf, type Profile } from "./pprof.js";
+
+const execFileAsync = promisify(execFile);
+
+// Objects above 32kB skip the size-classed caches and are allocated directly
+// from the heap, each one a span of its own
+export const LARGE_OBJECT_BYTES = 32 * 1024;
+// Average object size up to which a site counts as small-object churn
+export const SMALL_OBJECT_BYTES = 1024;
+
+// Time allowed for one package's escape analysis build
+const ESCAPE_ANALYSIS_TIMEOUT_MS = 120_000;
+
+export type AllocFamily = "alloc" | "inuse";
+export type AllocKind = "large" | "small" | "medium";
+
+export interface AllocHotspot {
+  function: string;
+  file: string;
+  line: number;
+  bytes: number;
+  bytesPct: number;
+  objects: number;
+  objectsPct: number;
+  avgObjectSize?: number;
+  kind: AllocKind;
+  // The allocating line, when its source was found
+  source?: string;
+  // Likely reasons for the heap allocation, compiler diagnostics first
+  causes: string[];
+}
+
+export interface AllocReport {
+  family: AllocFamily;
+  totalBytes: number;
+  totalObjects: number;
+  // Shares of bytes and objects at large-object and small-object sites
+  largeBytesPct: number;
+  smallBytesPct: number;
+  smallObjectsPct: number;
+  bySpace: AllocHotspot[];
+  byObjects: AllocHotspot[];
+  // Packages whose escape analysis could not be run
+  escapeAnalysisFailed: string[];
+}
+
+// Patterns in an allocating line and what they suggest
+const LINE_CAUSES: Array<[RegExp, string]> = [
+  [/\bappend\(/, "append grows the slice by reallocating it; preallocate with make([]T, 0, n) when the size is known"],
+  [/\+=|"\s*\+|\+\s*"/, "string concatenation copies the whole string every time; build it with strings.Builder"],
+  [/\bfmt\.(Sprintf|Sprint|Sprintln|Errorf)\(/, "fmt allocates its result and boxes every argument into an interface; strconv or an appended-to buffer avoids both"],
+  [/\bmake\(\s*map\b|\bmap\[[^\]]*\][\w.*]+\{/, "a new map per call; size it with make(map[K]V, n), or reuse it with clear()"],
+  [/^\s*[\w.]+\[[^\]]+\]\s*=[^=]/, "assigning to a map grows its buckets as it fills; size it up front with make(map[K]V, n)"],
+  [/\bmake\(\s*\[\]/, "make of a slice whose size is unknown at compile time, or above 64kB, is heap-allocated; reuse buffers in hot paths (e.g. sync.Pool)"],
+  [/&[\w.]+\{|\bnew\(/, "the pointer to a new value outlives the function (returned, stored or captured), so the value escapes"],
+  [/\[\]byte\(|\bstring\(/, "converting between string and []byte copies the data"],
+  [/\binterface\s*\{\s*\}|\bany\b/, "values stored in interfaces are boxed on the heap unless they are pointer-sized"],
+  [/\bfunc\s*\(/, "a closure that escapes is heap-allocated along with the variables it captures"],
+];
+
+interface SiteTotals {
+  function: string;
+  file: string;
+  line: number;
+  bytes: number;
+  objects: number;
+}
+
+// Bytes and objects per allocation site (the allocating function and line)
+function allocationSites(profile: Profile, family: AllocFamily): SiteTotals[] {
+  const spaceIndex = sampleIndexOf(profile, `${family}_space`);
+  const objectsIndex = sampleIndexOf(profile, `${family}_objects`);
+  const sites = new Map<string, SiteTotals>();
+  for (const sample of profile.samples) {
+    const bytes = sample.values[spaceIndex];
+    const objects = sample.values[objectsIndex];
+    const frame = profile.locations.get(sample.locationIds[0])?.frames[0];
+    if ((bytes === 0 && objects === 0) || !frame) {
+      continue;
+    }
+    const key = `${frame.name}:${frame.file}:${frame.line}`;
+    let site = sites.get(key);
+    if (!site) {
+      site = { function: frame.name, file: frame.file, line: frame.line, bytes: 0, objects: 0 };
+      sites.set(key, site);
+    }
+    site.bytes += bytes;
+    site.objects += objects;
+  }
+  return [...sites.values()];
+}
+
+function kindOf(avgObjectSize: number | undefined): AllocKind {
+  if (avgObjectSize === undefined) return "medium";
+  if (avgObjectSize > LARGE_OBJECT_BYTES) return "large";
+  return avgObjectSize <= SMALL_OBJECT_BYTES ? "small" : "medium";
+}
+
+// Heap escape diagnostics of one package directory from `go build -gcflags=-m`,
+// keyed by absolute file and line. The go command replays cached compiler
+// output, so repeated runs are quick.
+async function escapeDiagnostics(dir: string): Promise<Map<string, string[]>> {
+  let output: string;
+  try {
+    const { stderr } = await execFileAsync("go", ["build", "-o", "/dev/null", "-gcflags=-m", "."], {
+      cwd: dir,
+      timeout: ESCAPE_ANALYSIS_TIMEOUT_MS,
+      maxBuffer: 64 * 1024 * 1024,
+    });
+    output = stderr;
+  } catch (error) {
+    // A failed build still reports what it analyzed before failing
+    output = (error as { stderr?: string }).stderr ?? "";
+    if (!/escapes to heap|moved to heap/.test(output)) {
+      throw new Error((error as Error).message);
+    }
+  }
+  const diagnostics = new Map<string, string[]>();
+  for (const line of output.split("\n")) {
+    const match = line.match(/^(.+?\.go):(\d+):\d+: (.*(?:escapes to heap|moved to heap).*)$/);
+    if (match && !match[3].includes("does not escape")) {
+      const key = `${path.resolve(dir, match[1])}:${match[2]}`;
+      diagnostics.set(key, [...(diagnostics.get(key) ?? []), match[3]]);
+    }
+  }
+  return diagnostics;
+}
+
+// Rank allocation sites of a heap profile by bytes and by objects. Escape
+// analysis runs for sites in local packages outside GOROOT and the module
+// cache, where the compiler's diagnostics apply to the code that was profiled.
+export async function allocHotspots(
+  profile: Profile,
+  options: { family: AllocFamily; limit: number; sourceRoot?: string; escapeAnalysis: boolean },
+): Promise<AllocReport> {
+  const sites = allocationSites(profile, options.family);
+  const totalBytes = sites.reduce((sum, s) => sum + s.bytes, 0);
+  const totalObjects = sites.reduce((sum, s) => sum + s.objects, 0);
+  const avgOf = (s: SiteTotals) => (s.objects > 0 ? Math.round(s.bytes / s.objects) : undefined);
+  const sumOf = (kind: AllocKind, of: (s: SiteTotals) => number) =>
+    sites.filter((s) => kindOf(avgOf(s)) === kind).reduce((sum, s) => sum + of(s), 0);
+
+  const bySpace = [...sites].sort((a, b) => b.bytes - a.bytes).slice(0, options.limit);
+  const byObjects = [...sites].sort((a, b) => b.objects - a.objects).slice(0, options.limit);
+
+  const { GOROOT, GOMODCACHE } = goPaths();
+  const sources = new Map<string, string | undefined>();
+  for (const site of new Set([...bySpace, ...byObjects])) {
+    if (!sources.has(site.file)) {
+      sources.set(site.file, resolveSourceFile(site.file, options.sourceRoot));
+    }
+  }
+  const lines = new Map<string, string[]>();
+  const diagnostics = new Map<string, string[]>();
+  const escapeAnalysisFailed: string[] = [];
+  if (options.escapeAnalysis) {
+    const local = new Set([...sources.values()]
+      .filter((file): file is string => file !== undefined)
+      .filter((file) => !(GOROOT && file.startsWith(GOROOT)) && !(GOMODCACHE && file.startsWith(GOMODCACHE)))
+      .map((file) => path.dirname(file)));
+    for (const dir of local) {
+      try {
+        for (const [key, messages] of await escapeDiagnostics(dir)) {
+          diagnostics.set(key, messages);
+        }
+      } catch {
+        escapeAnalysisFailed.push(dir);
+      }
+    }
+  }
+
+  const hotspot = (site: SiteTotals): AllocHotspot => {
+    const file = sources.get(site.file);
+    let source: string | undefined;
+    if (file) {
+      if (!lines.has(file)) {
+        lines.set(file, readFileSync(file, "utf-8").split("\n"));
+      }
+      source = lines.get(file)![site.line - 1]?.trim();
+    }
+    const avgObjectSize = avgOf(site);
+    return {
+      ...site,
+      bytesPct: percentOf(site.bytes, totalBytes),
+      objectsPct: percentOf(site.objects, totalObjects),
+      avgObjectSize,
+      kind: kindOf(avgObjectSize),
+      source,
+      causes: [
+        ...(file ? diagnostics.get(`${file}:${site.line}`) ?? [] : []).map((d) => `compiler: ${d}`),
+        ...(source ? LINE_CAUSES.filter(([pattern]) => pattern.test(source)).map(([, cause]) => cause) : []),
+      ],
+    };
+  };
+
+  return {
+    family: options.family,
+    totalBytes,
+    totalObjects,
+    largeBytesPct: percentOf(sumOf("large", (s) => s.bytes), totalBytes),
+    smallBytesPct: percentOf(sumOf("small", (s) => s.bytes), totalBytes),
+    smallObjectsPct: percentOf(sumOf("small", (s) => s.objects), totalObjects),
+    bySpace: bySpace.map(hotspot),
+    byObjects: byObjects.map(hotspot),
+    escapeAnalysisFailed,
+  };
+}
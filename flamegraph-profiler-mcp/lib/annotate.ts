@@ -0,0 +1,197 @@
+/**
+ * Source-line annotation of profiled functions, like `pprof list`.
+ */
+import { execSync } from "node:child_process";
+import { existsSync } from "node:fs";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { percentOf } from "./flamegraph.js";
+import { formatValue, totalOf, type Frame, type Profile } from "./pprof.js";
+
+export interface AnnotatedLine {
+  line: number;
+  // Source text, absent for lines outside the file or when it was not found
+  source?: string;
+  flat: number;
+  cum: number;
+}
+
+export interface AnnotatedFunction {
+  function: string;
+  // File as recorded in the profile
+  file: string;
+  // File the source was read from, if it could be located
+  resolvedFile?: string;
+  flat: number;
+  cum: number;
+  flatPct: number;
+  cumPct: number;
+  lines: AnnotatedLine[];
+}
+
+export interface SourceListing {
+  unit: string;
+  total: number;
+  functions: AnnotatedFunction[];
+}
+
+export interface ListOptions {
+  // Directory to look for sources the profile's paths do not point at
+  sourceRoot?: string;
+  // Unsampled lines shown around sampled ones
+  context?: number;
+  // Maximum functions to list, by cumulative value
+  limit?: number;
+}
+
+let goEnv: { GOROOT: string; GOMODCACHE: string } | undefined;
+
+// GOROOT and GOMODCACHE of the local toolchain, empty if Go is unavailable
+export function goPaths(): { GOROOT: string; GOMODCACHE: string } {
+  if (!goEnv) {
+    try {
+      const [goroot, modcache] = execSync("go env GOROOT GOMODCACHE", { encoding: "utf-8", stdio: "pipe" }).trim().split("\n");
+      goEnv = { GOROOT: goroot, GOMODCACHE: modcache };
+    } catch {
+      goEnv = { GOROOT: "", GOMODCACHE: "" };
+    }
+  }
+  return goEnv;
+}
+
+// Locate a source file recorded in a profile. Tries the path itself, the
+// module cache and GOROOT (for paths from other machines or -trimpath builds),
+// then progressively shorter suffixes of the path under the source root.
+export function resolveSourceFile(file: string, sourceRoot?: string): string | undefined {
+  if (!file) {
+    return undefined;
+  }
+  const { GOROOT, GOMODCACHE } = goPaths();
+  const candidates = [file];
+
+  const modIndex = file.indexOf("/pkg/mod/");
+  if (GOMODCACHE && modIndex !== -1) {
+    candidates.push(path.join(GOMODCACHE, file.slice(modIndex + "/pkg/mod/".length)));
+  } else if (GOMODCACHE && /^[^/]+\.[^/]+\/.*@v/.test(file)) {
+    // -trimpath module path, e.g. github.com/acme/lib@v1.2.3/x.go
+    candidates.push(path.join(GOMODCACHE, file));
+  }
+  const srcIndex = file.lastIndexOf("/go/src/");
+  if (GOROOT && srcIndex !== -1) {
+    candidates.push(path.join(GOROOT, "src", file.slice(srcIndex + "/go/src/".length)));
+  } else if (GOROOT && !path.isAbsolute(file)) {
+    candidates.push(path.join(GOROOT, "src", file));
+  }
+
+  if (sourceRoot) {
+    const segments = file.split("/").filter(Boolean);
+    for (let i = 0; i < segments.length; i++) {
+      candidates.push(path.join(sourceRoot, ...segments.slice(i)));
+    }
+  }
+  return candidates.find((candidate) => existsSync(candidate));
+}
+
+// Attribute sample values to the source lines of functions matching a pattern.
+// Flat counts the innermost frame only; cum counts each line once per sample.
+export async function listSource(
+  profile: Profile,
+  sampleIndex: number,
+  pattern: RegExp,
+  options: ListOptions = {},
+): Promise<SourceListing> {
+  const { sourceRoot, context = 2, limit = 5 } = options;
+  const functions = new Map<string, { file: string; flat: number; cum: number; lines: Map<number, AnnotatedLine> }>();
+
+  for (const sample of profile.samples) {
+    const value = sample.values[sampleIndex];
+    // Frames innermost first
+    const frames: Frame[] = sample.locationIds.flatMap((id) => profile.locations.get(id)?.frames ?? []);
+    const seenFunctions = new Set<string>();
+    const seenLines = new Set<string>();
+
+    frames.forEach((frame, depth) => {
+      if (!pattern.test(frame.name)) {
+        return;
+      }
+      let entry = functions.get(frame.name);
+      if (!entry) {
+        entry = { file: frame.file, flat: 0, cum: 0, lines: new Map() };
+        functions.set(frame.name, entry);
+      }
+      let line = entry.lines.get(frame.line);
+      if (!line) {
+        line = { line: frame.line, flat: 0, cum: 0 };
+        entry.lines.set(frame.line, line);
+      }
+      if (depth === 0) {
+        entry.flat += value;
+        line.flat += value;
+      }
+      if (!seenFunctions.has(frame.name)) {
+        seenFunctions.add(frame.name);
+        entry.cum += value;
+      }
+      const lineKey = `${frame.name}:${frame.line}`;
+      if (!seenLines.has(lineKey)) {
+        seenLines.add(lineKey);
+        line.cum += value;
+      }
+    });
+  }
+
+  const total = totalOf(profile, sampleIndex);
+  const ranked = [...functions.entries()].sort((a, b) => b[1].cum - a[1].cum).slice(0, limit);
+
+  const annotated: AnnotatedFunction[] = [];
+  for (const [name, entry] of ranked) {
+    const resolvedFile = resolveSourceFile(entry.file, sourceRoot);
+    const source = resolvedFile ? (await fs.readFile(resolvedFile, "utf-8")).split("\n") : [];
+    annotated.push({
+      function: name,
+      file: entry.file,
+      resolvedFile,
+      flat: entry.flat,
+      cum: entry.cum,
+      flatPct: percentOf(entry.flat, total),
+      cumPct: percentOf(entry.cum, total),
+      lines: withContext(entry.lines, context, source),
+    });
+  }
+
+  return { unit: profile.sampleTypes[sampleIndex].unit, total, functions: annotated };
+}
+
+// Sampled lines plus `context` source lines either side, in line order.
+// Without source only the sampled lines are returned.
+function withContext(sampled: Map<number, AnnotatedLine>, context: number, source: string[]): AnnotatedLine[] {
+  const shown = new Set(sampled.keys());
+  if (source.length > 0) {
+    for (const line of sampled.keys()) {
+      for (let n = Math.max(1, line - context); n <= Math.min(source.length, line + context); n++) {
+        shown.add(n);
+      }
+    }
+  }
+  return [...shown]
+    .sort((a, b) => a - b)
+    .map((n) => ({ ...(sampled.get(n) ?? { line: n, flat: 0, cum: 0 }), source: source[n - 1] }));
+}
+
+// Format a listing like `pprof list`, marking gaps between shown lines with "..."
+export function formatListing(listing: SourceListing): string {
+  const value = (v: number) => (v === 0 ? "." : formatValue(v, listing.unit));
+  return listing.functions.map((fn) => {
+    const rows: string[] = [];
+    fn.lines.forEach((line, i) => {
+      if (i > 0 && line.line > fn.lines[i - 1].line + 1) {
+        rows.push(`${"".padStart(10)} ${"".padStart(10)}    ...`);
+      }
+      rows.push(`${value(line.flat).padStart(10)} ${value(line.cum).padStart(10)} ${String(line.line).padStart(6)}: ${line.source ?? ""}`);
+    });
+    const missing = fn.resolvedFile ? "" : "\n(source not found; pass sourceRoot or set PROFILER_SOURCE_ROOT)";
+    return `ROUTINE ======================== ${fn.function} in ${fn.resolvedFile ?? fn.file}
+${value(fn.flat).padStart(10)} ${value(fn.cum).padStart(10)} (flat, cum) ${fn.cumPct}% of Total${missing}
+${rows.join("\n")}`;
+  }).join("\n\n");
+}
@@ -0,0 +1,218 @@
+/**
+ * Anomaly detection over continuous profiling snapshots: each function's flat
+ * share of a target's snapshots forms a time series, tracked with an
+ * exponentially weighted moving average and variance. A snapshot in which a
+ * share lies several standard deviations from its average is an anomaly, so
+ * alerts need no per-function thresholds: a function that always swings
+ * between 5% and 15% is quiet at 14%, while one steady at 1% is flagged at 6%.
+ *
+ * Anomalies at the newest snapshot are recorded as findings by continuous
+ * profiling and posted to PROFILER_ALERT_WEBHOOK when it is set.
+ */
+import type { ContinuousType, Snapshot } from "./continuous.js";
+import { functionStats } from "./flamegraph.js";
+import { recordFindings, REGRESSION_THRESHOLD_PTS, type Finding, type NewFinding } from "./findings.js";
+import { t } from "./i18n.js";
+import { readProfile, sampleIndexOf, totalOf } from "./pprof.js";
+
+export interface AnomalyOptions {
+  // Standard deviations from the average that make a share anomalous
+  threshold: number;
+  // Weight of each new snapshot in the average; the average spans roughly 2 / alpha snapshots
+  alpha: number;
+  // Snapshots needed before a function's average is trusted
+  warmup: number;
+  // Smallest deviation reported, in percentage points, however unusual
+  minDeltaPts: number;
+}
+
+export const DEFAULT_ANOMALY_OPTIONS: AnomalyOptions = {
+  threshold: 4,
+  alpha: 0.1,
+  warmup: 12,
+  minDeltaPts: REGRESSION_THRESHOLD_PTS,
+};
+
+// Standard deviation assumed at least, in percentage points, so a function
+// whose share has barely moved is not flagged for sampling noise
+const MIN_STD_DEV_PTS = 0.5;
+
+export interface Anomaly {
+  target: string;
+  profileType: ContinuousType;
+  function: string;
+  // Snapshot the share was anomalous in
+  at: string;
+  path: string;
+  // Flat share in the snapshot and as expected from the average, in percent
+  share: number;
+  expected: number;
+  stdDev: number;
+  zScore: number;
+  direction: "spike" | "drop";
+}
+
+export interface AnomalyReport {
+  target: string;
+  profileType: ContinuousType;
+  snapshots: number;
+  // Functions whose series was tracked
+  functions: number;
+  options: AnomalyOptions;
+  // Oldest first
+  anomalies: Anomaly[];
+}
+
+const round = (n: number, digits = 2) => Math.round(n * 10 ** digits) / 10 ** digits;
+
+// Flat shares of a snapshot's functions, in percent. Snapshots never change
+// once written, so their shares are kept while the server runs, up to a bound
+// that retention would otherwise leave to grow.
+const sharesCache = new Map<string, Map<string, number>>();
+const MAX_CACHED_SNAPSHOTS = 5000;
+
+function snapshotShares(snapshot: Snapshot): Map<string, number> {
+  let shares = sharesCache.get(snapshot.path);
+  if (!shares) {
+    const profile = readProfile(snapshot.path);
+    const sampleIndex = sampleIndexOf(profile);
+    const total = totalOf(profile, sampleIndex);
+    shares = new Map(total > 0
+      ? functionStats(profile, sampleIndex).filter((s) => s.flat > 0).map((s) => [s.name, (s.flat / total) * 100])
+      : []);
+    if (sharesCache.size >= MAX_CACHED_SNAPSHOTS) {
+      sharesCache.clear();
+    }
+    sharesCache.set(snapshot.path, shares);
+  }
+  return shares;
+}
+
+// Find the anomalies in a series of snapshots of one target and type, oldest
+// first. A function missing from a snapshot has a share of 0 there. Anomalous
+// shares still update the average, so a lasting shift becomes the new normal
+// after a few snapshots instead of alerting forever.
+export function detectAnomalies(
+  snapshots: Snapshot[],
+  options: Partial<AnomalyOptions> = {},
+): AnomalyReport {
+  const opts = { ...DEFAULT_ANOMALY_OPTIONS, ...options };
+  const series = snapshots.map(snapshotShares);
+
+  const state = new Map<string, { mean: number; variance: number }>();
+  const anomalies: Anomaly[] = [];
+  series.forEach((shares, i) => {
+    // Functions first seen now start from 0, as they were absent before
+    const names = new Set([...state.keys(), ...shares.keys()]);
+    for (const name of names) {
+      const share = shares.get(name) ?? 0;
+      const tracked = state.get(name) ?? { mean: 0, variance: 0 };
+      const deviation = share - tracked.mean;
+      const stdDev = Math.max(Math.sqrt(tracked.variance), MIN_STD_DEV_PTS);
+      const zScore = deviation / stdDev;
+      if (i >= opts.warmup && Math.abs(zScore) >= opts.threshold && Math.abs(deviation) >= opts.minDeltaPts) {
+        anomalies.push({
+          target: snapshots[i].target,
+          profileType: snapshots[i].profileType,
+          function: name,
+          at: snapshots[i].at,
+          path: snapshots[i].path,
+          share: round(share),
+          expected: round(tracked.mean),
+          stdDev: round(stdDev),
+          zScore: round(zScore, 1),
+          direction: deviation > 0 ? "spike" : "drop",
+        });
+      }
+      tracked.mean += opts.alpha * deviation;
+      tracked.variance = (1 - opts.alpha) * (tracked.variance + opts.alpha * deviation * deviation);
+      state.set(name, tracked);
+    }
+  });
+
+  return {
+    target: snapshots[0]?.target ?? "",
+    profileType: snapshots[0]?.profileType ?? "cpu",
+    snapshots: snapshots.length,
+    functions: state.size,
+    options: opts,
+    anomalies,
+  };
+}
+
+export function findingFromAnomaly(anomaly: Anomaly): NewFinding {
+  const delta = round(anomaly.share - anomaly.expected);
+  const facts = {
+    target: anomaly.target,
+    profileType: anomaly.profileType,
+    direction: anomaly.direction,
+    share: anomaly.share,
+    expected: anomaly.expected,
+    stdDev: anomaly.stdDev,
+    zScore: anomaly.zScore,
+    at: anomaly.at,
+  };
+  return {
+    kind: "anomaly",
+    // One finding per target and type, whichever way the share moved
+    pattern: `anomaly:${anomaly.target}/${anomaly.profileType}`,
+    title: t("en", `finding.anomaly.${anomaly.direction}`, { function: anomaly.function, resource: t("en", `resource.${anomaly.profileType}`), ...facts }),
+    function: anomaly.function,
+    callPath: [],
+    percentage: delta,
+    detail: t("en", "finding.anomaly.detail", facts),
+    facts,
+    severity: anomaly.direction === "drop" ? "low" : delta >= 10 ? "high" : delta >= 5 ? "medium" : "low",
+    source: anomaly.path,
+  };
+}
+
+export interface AlertConfig {
+  // Receives a JSON POST of new anomaly findings
+  webhookUrl: string;
+}
+
+// Read the alert webhook from PROFILER_ALERT_WEBHOOK
+export function alertConfig(env: NodeJS.ProcessEnv = process.env): AlertConfig | undefined {
+  return env.PROFILER_ALERT_WEBHOOK ? { webhookUrl: env.PROFILER_ALERT_WEBHOOK } : undefined;
+}
+
+// Post findings to the alert webhook. The body carries a `text` summary, which
+// Slack and most chat webhooks display as is, and the findings themselves.
+export async function postAlert(findings: Finding[], config: AlertConfig): Promise<void> {
+  const text = [
+    `🚨 ${findings.length} profiling anomal${findings.length === 1 ? "y" : "ies"}:`,
+    ...findings.map((f) => `• ${f.title} [${f.id}, ${f.severity}]`),
+  ].join("\n");
+  const response = await fetch(config.webhookUrl, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ text, findings }),
+  });
+  if (!response.ok) {
+    throw new Error(`Alert webhook returned ${response.status}: ${(await response.text()).slice(0, 200)}`);
+  }
+}
+
+// Record the anomalies of a series' newest snapshot as findings, and alert on
+// the open ones that were not already anomalous in the snapshot before (or
+// recorded from this one), so a function that stays unusual for a few
+// snapshots alerts once
+export async function recordAnomalies(
+  report: AnomalyReport,
+  snapshots: Snapshot[],
+  alert = alertConfig(),
+): Promise<{ findings: Finding[]; alerted: Finding[] }> {
+  const newest = snapshots[snapshots.length - 1];
+  const before = snapshots[snapshots.length - 2];
+  const current = report.anomalies.filter((a) => a.path === newest?.path);
+  const findings = await recordFindings(current.map(findingFromAnomaly));
+  const alerted = findings.filter((f) => {
+    const previous = f.occurrences[f.occurrences.length - 2];
+    return f.status === "open" && (!previous || ![before?.path, newest.path].includes(previous.source));
+  });
+  if (alert && alerted.length > 0) {
+    await postAlert(alerted, alert);
+  }
+  return { findings, alerted: alert ? alerted : [] };
+}
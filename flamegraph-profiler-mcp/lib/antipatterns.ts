@@ -0,0 +1,217 @@
+/**
+ * Detects common Go performance anti-patterns in a profile.
+ */
+import { dominantCallPath, functionStats, percentOf } from "./flamegraph.js";
+import { stackOf, totalOf, type Profile } from "./pprof.js";
+
+export type Severity = "low" | "medium" | "high";
+
+export interface AntiPattern {
+  pattern: string;
+  title: string;
+  // User-code function responsible for the cost
+  function: string;
+  // Pattern function the cost was observed in, e.g. regexp.MustCompile
+  observedIn: string;
+  // Heaviest call path to the responsible function, root first
+  callPath: string[];
+  // Owning teams of the responsible function, when ownership is known
+  owners?: string[];
+  percentage: number;
+  severity: Severity;
+  suggestion: string;
+}
+
+interface Rule {
+  pattern: string;
+  title: string;
+  match: RegExp;
+  // Minimum cumulative share (%) before the rule fires
+  threshold: number;
+  suggestion: string;
+}
+
+const RULES: Rule[] = [
+  {
+    pattern: "regex-compile",
+    title: "Regular expressions compiled in a hot path",
+    match: /^regexp\.(Must)?Compile/,
+    threshold: 2,
+    suggestion: "Compile the regexp once at package level and reuse it.",
+  },
+  {
+    pattern: "string-concat",
+    title: "String concatenation in a loop",
+    match: /^runtime\.concatstrings$/,
+    threshold: 2,
+    suggestion: "Build strings with strings.Builder or bytes.Buffer.",
+  },
+  {
+    pattern: "slice-growth",
+    title: "Slices grown without preallocation",
+    match: /^runtime\.growslice$/,
+    threshold: 3,
+    suggestion: "Preallocate with make([]T, 0, n) when the size is known.",
+  },
+  {
+    pattern: "allocation-pressure",
+    title: "High allocation rate",
+    match: /^runtime\.mallocgc$/,
+    threshold: 20,
+    suggestion: "Reduce short-lived allocations; reuse buffers or use sync.Pool.",
+  },
+  {
+    pattern: "json-serialization",
+    title: "Heavy JSON serialization",
+    match: /^encoding\/json\.(Marshal|Unmarshal)$/,
+    threshold: 5,
+    suggestion: "Avoid repeated round-trips; cache encoded output or use a faster codec.",
+  },
+  {
+    pattern: "hashing",
+    title: "Cryptographic hashing in a hot path",
+    match: /^crypto\/(md5|sha1|sha256|sha512)\./,
+    threshold: 5,
+    suggestion: "Hash once and cache results, or use a non-cryptographic hash where safe.",
+  },
+  {
+    pattern: "lock-contention",
+    title: "Mutex contention",
+    match: /^sync\.\(\*(RW)?Mutex\)\.(R)?Lock/,
+    threshold: 3,
+    suggestion: "Shrink critical sections, shard the lock, or use atomics.",
+  },
+  {
+    pattern: "goroutine-churn",
+    title: "Goroutines spawned for trivial work",
+    match: /^runtime\.newproc/,
+    threshold: 3,
+    suggestion: "Use a worker pool or do small units of work inline.",
+  },
+];
+
+// Minimum share for recursion and quadratic-sort findings
+const RECURSION_THRESHOLD = 5;
+const SORT_THRESHOLD = 5;
+
+// Package path of a function name, e.g. "crypto/sha256" for "crypto/sha256.(*digest).Write"
+export function packageOf(name: string): string {
+  const slash = name.lastIndexOf("/");
+  const dot = name.indexOf(".", slash + 1);
+  return dot === -1 ? name : name.slice(0, dot);
+}
+
+// Standard library packages have no dot in their first path element
+export function isStdlib(name: string): boolean {
+  const pkg = packageOf(name);
+  return pkg !== "main" && !pkg.split("/")[0].includes(".");
+}
+
+export function detectAntiPatterns(profile: Profile, sampleIndex: number): AntiPattern[] {
+  const total = totalOf(profile, sampleIndex);
+  if (total === 0) {
+    return [];
+  }
+
+  const found: AntiPattern[] = [];
+  const stacks = profile.samples.map((sample) => ({
+    stack: stackOf(profile, sample),
+    value: sample.values[sampleIndex],
+  }));
+
+  for (const rule of RULES) {
+    // Attribute each matching sample to the innermost user frame above the match
+    const culprits = new Map<string, number>();
+    let matched = 0;
+    let observedIn = "";
+    for (const { stack, value } of stacks) {
+      const hit = stack.findIndex((name) => rule.match.test(name));
+      if (hit === -1 || value === 0) {
+        continue;
+      }
+      matched += value;
+      observedIn ||= stack[hit];
+      const culprit = [...stack.slice(0, hit)].reverse().find((name) => !isStdlib(name)) ?? stack[hit];
+      culprits.set(culprit, (culprits.get(culprit) ?? 0) + value);
+    }
+    const percentage = percentOf(matched, total);
+    if (percentage < rule.threshold) {
+      continue;
+    }
+    const [culprit] = [...culprits.entries()].sort((a, b) => b[1] - a[1])[0];
+    found.push({
+      pattern: rule.pattern,
+      title: rule.title,
+      function: culprit,
+      observedIn,
+      callPath: dominantCallPath(profile, sampleIndex, culprit),
+      percentage,
+      severity: severityOf(percentage),
+      suggestion: rule.suggestion,
+    });
+  }
+
+  found.push(...detectRecursion(profile, sampleIndex, stacks, total));
+  found.push(...detectQuadraticSort(profile, sampleIndex, total));
+
+  return found.sort((a, b) => b.percentage - a.percentage);
+}
+
+// Flag user functions that appear three or more times on the same stack
+function detectRecursion(
+  profile: Profile,
+  sampleIndex: number,
+  stacks: Array<{ stack: string[]; value: number }>,
+  total: number,
+): AntiPattern[] {
+  const recursive = new Map<string, number>();
+  for (const { stack, value } of stacks) {
+    const counts = new Map<string, number>();
+    for (const name of stack) {
+      counts.set(name, (counts.get(name) ?? 0) + 1);
+    }
+    for (const [name, count] of counts) {
+      if (count >= 3 && !isStdlib(name)) {
+        recursive.set(name, (recursive.get(name) ?? 0) + value);
+      }
+    }
+  }
+
+  return [...recursive.entries()]
+    .map(([name, value]) => ({ name, percentage: percentOf(value, total) }))
+    .filter(({ percentage }) => percentage >= RECURSION_THRESHOLD)
+    .map(({ name, percentage }) => ({
+      pattern: "deep-recursion",
+      title: "Deep recursion",
+      function: name,
+      observedIn: name,
+      callPath: dominantCallPath(profile, sampleIndex, name),
+      percentage,
+      severity: severityOf(percentage),
+      suggestion: "Memoize results or rewrite iteratively.",
+    }));
+}
+
+// Flag hand-written sort functions that burn a lot of self time
+function detectQuadraticSort(profile: Profile, sampleIndex: number, total: number): AntiPattern[] {
+  return functionStats(profile, sampleIndex)
+    .filter((stat) => !isStdlib(stat.name) && /sort/i.test(stat.name))
+    .map((stat) => ({ name: stat.name, percentage: percentOf(stat.flat, total) }))
+    .filter(({ percentage }) => percentage >= SORT_THRESHOLD)
+    .map(({ name, percentage }) => ({
+      pattern: "custom-sort",
+      title: "Hand-written sort in a hot path",
+      function: name,
+      observedIn: name,
+      callPath: dominantCallPath(profile, sampleIndex, name),
+      percentage,
+      severity: severityOf(percentage),
+      suggestion: "Use sort.Slice or slices.Sort (O(n log n)) instead of a quadratic algorithm.",
+    }));
+}
+
+function severityOf(percentage: number): Severity {
+  if (percentage >= 15) return "high";
+  if (percentage >= 5) return "medium";
+  return "low";
+}
@@ -0,0 +1,170 @@
+/**
+ * Authentication and per-client capabilities for the HTTP transport. Clients
+ * are identified by a bearer token or, over mutual TLS, by the subject of
+ * their client certificate, and each is granted capabilities:
+ *
+ * - read: analyze profiles, traces and findings already on the server
+ * - write: change the server's or a repository's state, or write files
+ * - capture: run programs and attach to live processes and targets
+ * - ingest: push profiles to /ingest, for applications rather than people
+ *
+ * Tools a client lacks the capability for are not offered to it at all.
+ */
+import { createHash, timingSafeEqual } from "node:crypto";
+import fs from "node:fs";
+
+export const CAPABILITIES = ["read", "write", "capture", "ingest"] as const;
+export type Capability = (typeof CAPABILITIES)[number];
+
+export interface AuthClient {
+  name: string;
+  capabilities: Capability[];
+}
+
+interface ClientEntry extends AuthClient {
+  // SHA-256 of the bearer token
+  tokenHash?: Buffer;
+  // Common name of the client certificate, or "*" for any verified certificate
+  certSubject?: string;
+}
+
+export interface AuthConfig {
+  clients: ClientEntry[];
+}
+
+// What each tool needs. Tools missing here need capture, so a tool added
+// without a classification is never offered to a restricted client.
+const TOOL_CAPABILITIES: Record<string, Capability> = {
+  top_functions: "read",
+  analyze_heap: "read",
+  alloc_hotspots: "read",
+  function_detail: "read",
+  get_tree: "read",
+  flame_outline: "read",
+  list_profiles: "read",
+  get_profile: "read",
+  list_baselines: "read",
+  check_budgets: "read",
+  check_profile_budget: "read",
+  format_pr_comment: "read",
+  list_snapshots: "read",
+  what_changed: "read",
+  list_findings: "read",
+  get_finding: "read",
+  hotspots_by_owner: "read",
+  detect_regressions: "read",
+  check_slo: "read",
+  route_costs: "read",
+  estimate_capacity: "read",
+  analyze_gc: "read",
+  list_source: "read",
+  list_supervised: "read",
+  list_postmortems: "read",
+  get_postmortem: "read",
+  list_suppressions: "read",
+  list_triggers: "read",
+  list_watches: "read",
+  get_config: "read",
+  validate_config: "read",
+  preview_redaction: "read",
+  show_session: "read",
+  list_sessions: "read",
+  session_history: "read",
+
+  save_baseline: "write",
+  diff_flamegraph: "write",
+  export_callgraph: "write",
+  export_interactive_flamegraph: "write",
+  export_histograms: "write",
+  diff_badge: "write",
+  export_hot_lines: "write",
+  tag_profile: "write",
+  delete_profile: "write",
+  import_profile: "write",
+  merge_profiles: "write",
+  symbolize_profile: "write",
+  redact_profile: "write",
+  post_digest: "write",
+  push_to_pyroscope: "write",
+  export_otlp: "write",
+  export_bundle: "write",
+  import_bundle: "write",
+  start_session: "write",
+  refine_session: "write",
+  undo_session: "write",
+  end_session: "write",
+  detect_anomalies: "write",
+  discover_services: "write",
+  comment_on_finding: "write",
+  assign_finding: "write",
+  acknowledge_finding: "write",
+  resolve_finding: "write",
+  file_ticket: "write",
+  add_suppression: "write",
+  remove_suppression: "write",
+};
+
+export function requiredCapability(tool: string): Capability {
+  return TOOL_CAPABILITIES[tool] ?? "capture";
+}
+
+function sha256(text: string): Buffer {
+  return createHash("sha256").update(text).digest();
+}
+
+function parseCapabilities(value: unknown, client: string): Capability[] {
+  if (!Array.isArray(value) || value.some((c) => !CAPABILITIES.includes(c))) {
+    throw new Error(`Client ${client} needs capabilities from ${CAPABILITIES.join(", ")}`);
+  }
+  return value as Capability[];
+}
+
+// Clients from PROFILER_AUTH_TOKEN, a token with every capability, and the
+// JSON file in PROFILER_AUTH_FILE; undefined when neither is set, which
+// leaves the server open
+export function loadAuthConfig(env: NodeJS.ProcessEnv = process.env): AuthConfig | undefined {
+  const clients: ClientEntry[] = [];
+  if (env.PROFILER_AUTH_TOKEN) {
+    clients.push({ name: "default", capabilities: [...CAPABILITIES], tokenHash: sha256(env.PROFILER_AUTH_TOKEN) });
+  }
+  if (env.PROFILER_AUTH_FILE) {
+    const file = JSON.parse(fs.readFileSync(env.PROFILER_AUTH_FILE, "utf8")) as { clients?: Array<Record<string, unknown>> };
+    for (const [i, entry] of (file.clients ?? []).entries()) {
+      const name = typeof entry.name === "string" ? entry.name : `client ${i + 1}`;
+      const { token, tokenSha256, certSubject } = entry;
+      if (typeof token !== "string" && typeof tokenSha256 !== "string" && typeof certSubject !== "string") {
+        throw new Error(`Client ${name} in ${env.PROFILER_AUTH_FILE} needs a token, tokenSha256 or certSubject`);
+      }
+      if (typeof tokenSha256 === "string" && !/^[0-9a-f]{64}$/i.test(tokenSha256)) {
+        throw new Error(`Client ${name} in ${env.PROFILER_AUTH_FILE} has a tokenSha256 that is not 64 hex digits`);
+      }
+      clients.push({
+        name,
+        capabilities: parseCapabilities(entry.capabilities, name),
+        tokenHash: typeof token === "string" ? sha256(token) : typeof tokenSha256 === "string" ? Buffer.from(tokenSha256, "hex") : undefined,
+        certSubject: typeof certSubject === "string" ? certSubject : undefined,
+      });
+    }
+  }
+  return clients.length > 0 ? { clients } : undefined;
+}
+
+// The client presenting a bearer token or, without one, a verified client
+// certificate; undefined when neither identifies a configured client
+export function authenticate(
+  config: AuthConfig,
+  credentials: { bearer?: string; certSubject?: string },
+): AuthClient | undefined {
+  const match = (entry: ClientEntry): AuthClient => ({ name: entry.name, capabilities: entry.capabilities });
+  if (credentials.bearer) {
+    const hash = sha256(credentials.bearer);
+    const entry = config.clients.find((c) => c.tokenHash && timingSafeEqual(c.tokenHash, hash));
+    return entry && match(entry);
+  }
+  if (credentials.certSubject !== undefined) {
+    const entry = config.clients.find((c) => c.certSubject === credentials.certSubject)
+      ?? config.clients.find((c) => c.certSubject === "*");
+    return entry && match(entry);
+  }
+  return undefined;
+}
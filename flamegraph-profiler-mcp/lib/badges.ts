@@ -0,0 +1,120 @@
+/**
+ * Performance badges: a diff between a baseline and a comparison profile
+ * summed up as one shields-style SVG, e.g. "perf | -3.2% vs baseline" in
+ * green, for READMEs and pull request comments. Badges are saved by name and
+ * served as MCP resources and, in HTTP mode, at /badges/<name>.svg, so
+ * regenerating a badge in CI updates every page that embeds it.
+ */
+import { badge, type BadgeColor } from "./charts.js";
+import type { DiffResult } from "./diff.js";
+import { readJson, updateJson } from "./store.js";
+
+export interface PerfBadge {
+  name: string;
+  label: string;
+  message: string;
+  color: BadgeColor;
+  // Change of the comparison's total against the baseline's, in percent;
+  // per second of capture when both profiles record their duration
+  changePct: number;
+  perSecond: boolean;
+  sampleType: string;
+  unit: string;
+  baseline: string;
+  comparison: string;
+  // Function whose share of the profile grew the most
+  topRegression?: { name: string; flatDeltaPct: number };
+  // ISO 8601 time the badge was made
+  at: string;
+}
+
+const BADGES_FILE = "badges.json";
+
+export const BADGE_URI_TEMPLATE = "badge://{name}";
+
+// Badge names end up in URLs and file names
+const BADGE_NAME = /^[\w.-]{1,64}$/;
+
+// Base URL of the HTTP server, for badge links; PROFILER_PUBLIC_URL wins
+// over the listen address, for servers behind a proxy
+let servedAt: string | undefined;
+
+export function setServedAt(base: string): void {
+  servedAt = base;
+}
+
+export function checkBadgeName(name: string): string {
+  if (!BADGE_NAME.test(name)) {
+    throw new Error(`Invalid badge name ${JSON.stringify(name)}; use up to 64 letters, digits, '.', '-' or '_'`);
+  }
+  return name;
+}
+
+// Sum up a diff as a badge: red when the total grew by more than threshold
+// percent, green otherwise
+export function badgeOfDiff(
+  diff: DiffResult,
+  options: { name: string; label?: string; threshold?: number; baseline: string; comparison: string; baselineSeconds?: number; comparisonSeconds?: number },
+): PerfBadge {
+  const { label = "perf", threshold = 1, baselineSeconds, comparisonSeconds } = options;
+  const perSecond = Boolean(baselineSeconds && comparisonSeconds);
+  const before = perSecond ? diff.baselineTotal / baselineSeconds! : diff.baselineTotal;
+  const after = perSecond ? diff.comparisonTotal / comparisonSeconds! : diff.comparisonTotal;
+  if (before <= 0) {
+    throw new Error(`The baseline has no ${diff.sampleType} samples to compare against`);
+  }
+  const changePct = Math.round(((after - before) / before) * 1000) / 10;
+  const top = diff.regressions[0];
+  return {
+    name: checkBadgeName(options.name),
+    label,
+    message: `${changePct > 0 ? "+" : ""}${changePct}% vs baseline`,
+    color: changePct > threshold ? "red" : "green",
+    changePct,
+    perSecond,
+    sampleType: diff.sampleType,
+    unit: diff.unit,
+    baseline: options.baseline,
+    comparison: options.comparison,
+    topRegression: top && { name: top.name, flatDeltaPct: top.flatDeltaPct },
+    at: new Date().toISOString(),
+  };
+}
+
+export function renderBadge(entry: PerfBadge): string {
+  const details = [
+    `${entry.sampleType}${entry.perSecond ? " per second" : ""}: ${entry.baseline} → ${entry.comparison}`,
+    entry.topRegression && `top regression: ${entry.topRegression.name} (+${entry.topRegression.flatDeltaPct} pts)`,
+  ].filter(Boolean).join("\n");
+  return badge(entry.label, entry.message, entry.color, details);
+}
+
+// Save a badge, replacing any of the same name
+export async function saveBadge(entry: PerfBadge): Promise<void> {
+  await updateJson<PerfBadge[], void>(BADGES_FILE, [], (badges) => {
+    const i = badges.findIndex((b) => b.name === entry.name);
+    if (i >= 0) {
+      badges[i] = entry;
+    } else {
+      badges.push(entry);
+    }
+  });
+}
+
+export async function listBadges(): Promise<PerfBadge[]> {
+  return readJson<PerfBadge[]>(BADGES_FILE, []);
+}
+
+export async function getBadge(name: string): Promise<PerfBadge | undefined> {
+  return (await listBadges()).find((b) => b.name === name);
+}
+
+export function badgeUri(name: string): string {
+  return `badge://${name}`;
+}
+
+// Where the badge is served over HTTP, when the server runs in HTTP mode
+export function badgeUrl(name: string): string | undefined {
+  const base = process.env.PROFILER_PUBLIC_URL ?? servedAt;
+  return base ? `${base.replace(/\/+$/, "")}/badges/${encodeURIComponent(name)}.svg` : undefined;
+}
@@ -0,0 +1,178 @@
+/**
+ * Baseline profiles versioned in the profiled project's Git repository.
+ *
+ * Baselines live at <repo>/perf/baselines/<name>/<commit>.pb.gz, where name is
+ * the profile kind (cpu, heap, ...) and commit is the full hash the profile was
+ * captured at. The baseline for a commit is the one saved at its nearest ancestor.
+ * Profiles record the commit they were captured at as a "git.sha=<commit>" comment.
+ */
+import { execFileSync } from "node:child_process";
+import { existsSync } from "node:fs";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { isStdlib } from "./antipatterns.js";
+import type { Profile } from "./pprof.js";
+
+export interface Baseline {
+  name: string;
+  commit: string;
+  path: string;
+}
+
+export interface SelectedBaseline extends Baseline {
+  // Commits between the requested commit and the baseline's (0 = same commit)
+  distance: number;
+}
+
+// Ancestors searched when selecting a baseline
+const MAX_ANCESTORS = 5000;
+
+// Profile comment holding the commit a profile was captured at; Go's
+// vcs.revision build setting is accepted too
+const COMMIT_COMMENT = /^(?:git\.sha|vcs\.revision)=([0-9a-f]{7,40})$/;
+
+// Baseline directory relative to the repository root; override with PROFILER_BASELINE_DIR
+export function baselineDir(): string {
+  return process.env.PROFILER_BASELINE_DIR ?? path.join("perf", "baselines");
+}
+
+function git(repo: string, args: string[]): string {
+  try {
+    return execFileSync("git", args, { cwd: repo, encoding: "utf-8", stdio: "pipe", maxBuffer: 64 * 1024 * 1024 }).trim();
+  } catch (error) {
+    const stderr = (error as { stderr?: string }).stderr?.trim();
+    throw new Error(`git ${args[0]} failed in ${repo}${stderr ? `: ${stderr}` : ""}`);
+  }
+}
+
+// Root of the Git repository containing a file or directory
+export async function gitRoot(start: string): Promise<string> {
+  const resolved = path.resolve(start);
+  const dir = (await fs.stat(resolved).catch(() => undefined))?.isDirectory() ? resolved : path.dirname(resolved);
+  return git(dir, ["rev-parse", "--show-toplevel"]);
+}
+
+// Repository of the first user-code source file recorded in a profile
+export async function repoOfProfile(profile: Profile): Promise<string | undefined> {
+  for (const location of profile.locations.values()) {
+    const frame = location.frames.find((f) => f.file && !isStdlib(f.name));
+    if (frame && existsSync(frame.file)) {
+      return gitRoot(frame.file).catch(() => undefined);
+    }
+  }
+  return undefined;
+}
+
+// Full hash of HEAD in the repository containing a path, if it is in one
+export async function headCommit(start: string): Promise<string | undefined> {
+  try {
+    return git(await gitRoot(start), ["rev-parse", "HEAD"]);
+  } catch {
+    return undefined;
+  }
+}
+
+// Commit a profile was tagged with at capture time
+export function profileCommit(profile: Profile): string | undefined {
+  for (const comment of profile.comments ?? []) {
+    const match = comment.match(COMMIT_COMMENT);
+    if (match) {
+      return match[1];
+    }
+  }
+  return undefined;
+}
+
+// Tag a profile with the commit it was captured at, replacing any earlier tag
+export function tagCommit(profile: Profile, commit: string): Profile {
+  if (!/^[0-9a-f]{7,40}$/.test(commit)) {
+    throw new Error(`Not a commit hash: ${commit}`);
+  }
+  return {
+    ...profile,
+    comments: [...(profile.comments ?? []).filter((c) => !COMMIT_COMMENT.test(c)), `git.sha=${commit}`],
+  };
+}
+
+// Remove a profile's commit tag, e.g. when it mixes captures of several commits
+export function untagCommit(profile: Profile): Profile {
+  return { ...profile, comments: (profile.comments ?? []).filter((c) => !COMMIT_COMMENT.test(c)) };
+}
+
+// Baseline name for a profile, from its sample types
+export function baselineKind(profile: Profile): string {
+  const types = new Set(profile.sampleTypes.map((t) => t.type));
+  if (types.has("cpu")) return "cpu";
+  if (types.has("offcpu")) return "offcpu";
+  // fgprof-style wall-clock profiles
+  if (types.has("time") && types.has("samples")) return "wallclock";
+  if (types.has("inuse_space")) return "heap";
+  if (types.has("goroutine")) return "goroutine";
+  if (types.has("delay")) {
+    // Block and mutex profiles share sample types; mutex profiles charge delay to Unlock
+    const leafIsUnlock = profile.samples.some((sample) => {
+      const leaf = profile.locations.get(sample.locationIds[0])?.frames[0]?.name ?? "";
+      return /\.R?Unlock$|^runtime\.unlock$/.test(leaf);
+    });
+    return leafIsUnlock ? "mutex" : "block";
+  }
+  return profile.sampleTypes.map((t) => t.type).join("-") || "profile";
+}
+
+// Copy a profile into the repository as the baseline for a commit
+export async function saveBaseline(
+  profilePath: string,
+  repoPath: string,
+  options: { name: string; commit?: string },
+): Promise<Baseline> {
+  const root = await gitRoot(repoPath);
+  const commit = git(root, ["rev-parse", "--verify", `${options.commit ?? "HEAD"}^{commit}`]);
+  const file = path.join(root, baselineDir(), options.name, `${commit}.pb.gz`);
+  await fs.mkdir(path.dirname(file), { recursive: true });
+  await fs.copyFile(profilePath, file);
+  return { name: options.name, commit, path: file };
+}
+
+// Baselines present in the repository's working tree, optionally of one kind
+export async function listBaselines(repoPath: string, name?: string): Promise<Baseline[]> {
+  const root = await gitRoot(repoPath);
+  const dir = path.join(root, baselineDir());
+  const names = name ? [name] : await fs.readdir(dir).catch(() => []);
+  const baselines: Baseline[] = [];
+  for (const kind of names) {
+    for (const file of await fs.readdir(path.join(dir, kind)).catch(() => [])) {
+      const match = file.match(/^([0-9a-f]{40})\.pb\.gz$/);
+      if (match) {
+        baselines.push({ name: kind, commit: match[1], path: path.join(dir, kind, file) });
+      }
+    }
+  }
+  return baselines;
+}
+
+// The baseline saved at the nearest ancestor of a commit (the commit itself included)
+export async function selectBaseline(repoPath: string, name: string, commit = "HEAD"): Promise<SelectedBaseline | undefined> {
+  const baselines = new Map((await listBaselines(repoPath, name)).map((b) => [b.commit, b]));
+  if (baselines.size === 0) {
+    return undefined;
+  }
+  const root = await gitRoot(repoPath);
+  try {
+    git(root, ["rev-parse", "--verify", "--quiet", `${commit}^{commit}`]);
+  } catch {
+    throw new Error(`Commit ${commit} is not in ${root}; fetch it or pass another commit`);
+  }
+  const ancestors = git(root, ["rev-list", `--max-count=${MAX_ANCESTORS}`, commit]).split("\n");
+  for (const [distance, sha] of ancestors.entries()) {
+    const baseline = baselines.get(sha);
+    if (baseline) {
+      return { ...baseline, distance };
+    }
+  }
+  return undefined;
+}
+
+// How a selected baseline relates to the commit it was selected for
+export function describeSelection(selected: SelectedBaseline, commit: string): string {
+  return selected.distance === 0 ? `saved at ${commit}` : `${selected.distance} commit(s) before ${commit}`;
+}
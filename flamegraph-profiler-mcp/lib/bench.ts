@@ -0,0 +1,184 @@
+/**
+ * Go benchmarks: run `go test -bench` with CPU and memory profiles, parse the
+ * timings and keep the profiles in the catalog.
+ */
+import { existsSync } from "node:fs";
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { headCommit } from "./baselines.js";
+import { recordCapture } from "./captures.js";
+import { keepProfile } from "./catalog.js";
+import { topFunctionsOf, type TopFunction } from "./flamegraph.js";
+import { execGo } from "./goapp.js";
+import { formatValue, readProfile, sampleIndexOf, toBaseUnit, totalOf } from "./pprof.js";
+
+export type BenchProfileType = "cpu" | "heap";
+
+export interface BenchResult {
+  // Benchmark name without the GOMAXPROCS suffix, e.g. BenchmarkParse/small
+  name: string;
+  procs?: number;
+  // One entry per -count run
+  iterations: number[];
+  nsPerOp: number[];
+  bytesPerOp?: number[];
+  allocsPerOp?: number[];
+  // Custom metrics reported with b.ReportMetric, by unit
+  metrics: Record<string, number[]>;
+}
+
+export interface BenchProfile {
+  profileType: BenchProfileType;
+  profileId: string;
+  // Sample type the flamegraph is best read in: cpu, or alloc_space for memory
+  view: string;
+  topFunctions: TopFunction[];
+}
+
+export interface BenchRun {
+  package: string;
+  bench: string;
+  benchtime?: string;
+  count: number;
+  results: BenchResult[];
+  profiles: BenchProfile[];
+}
+
+// A result line: name-procs, iterations, then value/unit pairs
+const RESULT_LINE = /^(Benchmark\S*?)(?:-(\d+))?\s+(\d+)((?:\s+[\d.e+-]+ \S+)+)\s*$/;
+
+// Parse the benchmark lines of `go test -bench` output. Runs of the same
+// benchmark (from -count) are collected in order.
+export function parseBenchOutput(output: string): BenchResult[] {
+  const results = new Map<string, BenchResult>();
+  for (const line of output.split("\n")) {
+    const match = line.match(RESULT_LINE);
+    if (!match) continue;
+    const [, name, procs, iterations, pairs] = match;
+    let result = results.get(name);
+    if (!result) {
+      result = { name, procs: procs ? Number(procs) : undefined, iterations: [], nsPerOp: [], metrics: {} };
+      results.set(name, result);
+    }
+    result.iterations.push(Number(iterations));
+    for (const [, value, unit] of pairs.matchAll(/([\d.e+-]+) (\S+)/g)) {
+      const n = Number(value);
+      if (unit === "ns/op") result.nsPerOp.push(n);
+      else if (unit === "B/op") (result.bytesPerOp ??= []).push(n);
+      else if (unit === "allocs/op") (result.allocsPerOp ??= []).push(n);
+      else (result.metrics[unit] ??= []).push(n);
+    }
+  }
+  return [...results.values()];
+}
+
+function mean(values: number[]): number {
+  return values.length === 0 ? 0 : values.reduce((sum, v) => sum + v, 0) / values.length;
+}
+
+// Spread of the runs around their mean, as ±percent
+function spreadPct(values: number[]): number {
+  const m = mean(values);
+  if (values.length < 2 || m === 0) return 0;
+  const sd = Math.sqrt(mean(values.map((v) => (v - m) ** 2)));
+  return Math.round((sd / m) * 1000) / 10;
+}
+
+async function keepBenchProfile(file: string, profileType: BenchProfileType, packageDir: string, bench: string, commit?: string): Promise<BenchProfile> {
+  const profile = readProfile(file);
+  // Benchmarks rarely retain memory, so allocations are what matters
+  const view = profileType === "cpu" ? "cpu" : "alloc_space";
+  const sampleIndex = sampleIndexOf(profile, view);
+  const topFunctions = topFunctionsOf(profile, sampleIndex);
+  const capture = await recordCapture({
+    target: packageDir,
+    commit,
+    profileType,
+    duration: 0,
+    total: toBaseUnit(totalOf(profile, sampleIndex), profile.sampleTypes[sampleIndex].unit),
+    unit: profileType === "cpu" ? "seconds" : "bytes",
+    topFunctions,
+    issues: 0,
+  }).catch(() => undefined);
+  const entry = await keepProfile(file, `${path.basename(packageDir)}_bench_${profileType}`, {
+    target: packageDir,
+    profileType,
+    commit,
+    captureId: capture?.id,
+    labels: { bench },
+  });
+  return { profileType, profileId: entry.id, view, topFunctions };
+}
+
+// Run the benchmarks of a package matching a pattern, with a profile per type.
+// Tests are skipped with -run='^$'.
+export async function runBenchmarks(options: {
+  packageDir: string;
+  bench: string;
+  benchtime?: string;
+  count: number;
+  profileTypes: BenchProfileType[];
+  timeout: number;
+  signal?: AbortSignal;
+}): Promise<BenchRun> {
+  const packageDir = path.resolve(options.packageDir);
+  if (!existsSync(packageDir)) {
+    throw new Error(`${packageDir} does not exist`);
+  }
+  const workDir = await fs.mkdtemp(path.join(os.tmpdir(), "bench_"));
+  const files: Record<BenchProfileType, string> = {
+    cpu: path.join(workDir, "cpu.pb.gz"),
+    heap: path.join(workDir, "mem.pb.gz"),
+  };
+  const args = [
+    "test",
+    "-run=^$",
+    `-bench=${options.bench}`,
+    "-benchmem",
+    `-count=${options.count}`,
+    ...(options.benchtime ? [`-benchtime=${options.benchtime}`] : []),
+    ...(options.profileTypes.includes("cpu") ? [`-cpuprofile=${files.cpu}`] : []),
+    ...(options.profileTypes.includes("heap") ? [`-memprofile=${files.heap}`] : []),
+    // Profiling keeps the test binary; build it out of the package directory
+    "-o", path.join(workDir, "bench.test"),
+    `-timeout=${options.timeout}s`,
+    ".",
+  ];
+  try {
+    let stdout: string;
+    try {
+      ({ stdout } = await execGo(args, { cwd: packageDir, maxBuffer: 64 * 1024 * 1024, signal: options.signal }));
+    } catch (error) {
+      options.signal?.throwIfAborted();
+      const output = [(error as { stdout?: string }).stdout, (error as { stderr?: string }).stderr].filter(Boolean).join("\n").trim();
+      throw output ? new Error(output) : error;
+    }
+    const results = parseBenchOutput(stdout);
+    if (results.length === 0) {
+      throw new Error(`No benchmarks in ${packageDir} match '${options.bench}'`);
+    }
+
+    const commit = await headCommit(packageDir);
+    const profiles: BenchProfile[] = [];
+    for (const profileType of options.profileTypes) {
+      profiles.push(await keepBenchProfile(files[profileType], profileType, packageDir, options.bench, commit));
+    }
+    return { package: packageDir, bench: options.bench, benchtime: options.benchtime, count: options.count, results, profiles };
+  } finally {
+    await fs.rm(workDir, { recursive: true, force: true }).catch(() => undefined);
+  }
+}
+
+// One line per benchmark: mean time, memory and allocations per op, and the
+// spread of the time across runs
+export function formatBenchResult(r: BenchResult): string {
+  const parts = [`${formatValue(mean(r.nsPerOp), "nanoseconds")}/op`];
+  if (r.bytesPerOp) parts.push(`${formatValue(mean(r.bytesPerOp), "bytes")}/op`);
+  if (r.allocsPerOp) parts.push(`${Math.round(mean(r.allocsPerOp))} allocs/op`);
+  for (const [unit, values] of Object.entries(r.metrics)) {
+    parts.push(`${Math.round(mean(values) * 100) / 100} ${unit}`);
+  }
+  const runs = r.nsPerOp.length > 1 ? ` (${r.nsPerOp.length} runs, ±${spreadPct(r.nsPerOp)}%)` : ` (${r.iterations[0]} iterations)`;
+  return `${r.name}${r.procs ? `-${r.procs}` : ""}: ${parts.join(", ")}${runs}`;
+}
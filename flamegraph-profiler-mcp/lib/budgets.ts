@@ -0,0 +1,354 @@
+/**
+ * Performance budgets declared in a repository's .perfbudgets.yaml, e.g.
+ * "pkg/parser may use at most 15% of CPU in the checkout scenario":
+ *
+ *   budgets:
+ *     - package: pkg/parser
+ *       max: 15%
+ *       scenario: checkout
+ *
+ * Each budget names a package (import path or path suffix) or a function glob,
+ * a maximum share of the profile total, and optionally the sample type
+ * (default: the profile's default), whether to count cumulative or flat time
+ * (default: cum), the scenario it applies to, and owners to report.
+ */
+import fs from "node:fs/promises";
+import path from "node:path";
+import { packageOf } from "./antipatterns.js";
+import { BUDGETS_SCHEMA, checkDocument } from "./configschema.js";
+import { functionStats, percentOf } from "./flamegraph.js";
+import { ownersOf, type Ownership } from "./owners.js";
+import { fileOf, formatValue, sampleIndexOf, stackOf, toBaseUnit, totalOf, type Profile } from "./pprof.js";
+import { globToRegExp } from "./suppressions.js";
+import { parseYaml } from "./yaml.js";
+
+export const BUDGETS_FILE = ".perfbudgets.yaml";
+
+export interface Budget {
+  package?: string;
+  function?: string;
+  // Maximum share of the profile total, in percent
+  max: number;
+  sampleType?: string;
+  measure: "cum" | "flat";
+  // Only checked for this scenario; budgets without one always apply
+  scenario?: string;
+  owners?: string[];
+  description?: string;
+}
+
+export interface BudgetResult {
+  budget: Budget;
+  // Human-readable subject, e.g. "package pkg/parser"
+  subject: string;
+  sampleType: string;
+  // Measured share of the total, in percent
+  actual: number;
+  passed: boolean;
+  // Heaviest matching functions by the budget's measure
+  topFunctions: Array<{ name: string; percentage: number }>;
+  owners: string[];
+}
+
+export interface BudgetReport {
+  file: string;
+  scenario?: string;
+  results: BudgetResult[];
+  // Budgets skipped because they target another scenario
+  skipped: number;
+  passed: boolean;
+}
+
+export function parseBudgets(text: string, source = BUDGETS_FILE): Budget[] {
+  const positions = new Map<string, number>();
+  const doc = parseYaml(text, source, positions) as { budgets: Array<Record<string, any>> };
+  checkDocument(doc, BUDGETS_SCHEMA, source, positions);
+  const str = (value: unknown) => (value === undefined || value === null ? undefined : (value as string));
+  return doc.budgets.map((entry): Budget => ({
+    package: str(entry.package),
+    function: str(entry.function),
+    // A number or a percentage like "15%"
+    max: typeof entry.max === "number" ? entry.max : parseFloat(entry.max),
+    sampleType: str(entry.sampleType),
+    measure: entry.measure ?? "cum",
+    scenario: str(entry.scenario),
+    owners: entry.owners === undefined || entry.owners === null ? undefined : [entry.owners].flat(),
+    description: str(entry.description),
+  }));
+}
+
+// Read and validate a budgets file
+export async function loadBudgets(file: string): Promise<Budget[]> {
+  let text: string;
+  try {
+    text = await fs.readFile(file, "utf-8");
+  } catch (error) {
+    if ((error as NodeJS.ErrnoException).code === "ENOENT") {
+      throw new Error(`No ${path.basename(file)} found at ${path.dirname(file)}`);
+    }
+    throw error;
+  }
+  return parseBudgets(text, file);
+}
+
+// Scenario a capture was taken under, from a "scenario=<name>" profile comment
+export function profileScenario(profile: Profile): string | undefined {
+  for (const comment of profile.comments ?? []) {
+    const match = comment.match(/^scenario=(\S+)$/);
+    if (match) {
+      return match[1];
+    }
+  }
+  return undefined;
+}
+
+function matcherFor(budget: Budget): (name: string) => boolean {
+  if (budget.function) {
+    const pattern = globToRegExp(budget.function);
+    return (name) => pattern.test(name);
+  }
+  const pkg = globToRegExp(budget.package ?? "");
+  const suffix = globToRegExp(`*/${budget.package}`);
+  return (name) => {
+    const p = packageOf(name);
+    return pkg.test(p) || suffix.test(p);
+  };
+}
+
+function subjectOf(budget: Budget): string {
+  return budget.package ? `package ${budget.package}` : `function ${budget.function}`;
+}
+
+// Cumulative counts every sample with a matching frame anywhere in its stack
+// once; flat counts samples whose leaf matches
+function measureMatching(profile: Profile, sampleIndex: number, matches: (name: string) => boolean, measure: Budget["measure"]): number {
+  let value = 0;
+  for (const sample of profile.samples) {
+    const stack = stackOf(profile, sample);
+    const hit = measure === "flat" ? matches(stack[stack.length - 1] ?? "") : stack.some(matches);
+    if (hit) {
+      value += sample.values[sampleIndex];
+    }
+  }
+  return value;
+}
+
+function heaviestMatching(
+  profile: Profile,
+  sampleIndex: number,
+  matches: (name: string) => boolean,
+  measure: Budget["measure"],
+  total: number,
+): Array<{ name: string; percentage: number }> {
+  return functionStats(profile, sampleIndex)
+    .filter((stat) => matches(stat.name))
+    .sort((a, b) => (measure === "flat" ? b.flat - a.flat : b.cum - a.cum))
+    .slice(0, 3)
+    .map((stat) => ({ name: stat.name, percentage: percentOf(measure === "flat" ? stat.flat : stat.cum, total) }));
+}
+
+// Measure a budget's subject in a profile as a share of its total
+export function checkBudget(profile: Profile, budget: Budget, ownership?: Ownership): BudgetResult {
+  const sampleIndex = sampleIndexOf(profile, budget.sampleType);
+  const total = totalOf(profile, sampleIndex);
+  const matches = matcherFor(budget);
+  const value = measureMatching(profile, sampleIndex, matches, budget.measure);
+  const topFunctions = heaviestMatching(profile, sampleIndex, matches, budget.measure, total);
+
+  const actual = percentOf(value, total);
+  const heaviest = topFunctions[0]?.name;
+  return {
+    budget,
+    subject: subjectOf(budget),
+    sampleType: profile.sampleTypes[sampleIndex].type,
+    actual,
+    passed: actual <= budget.max,
+    topFunctions,
+    owners: budget.owners ?? (ownership && heaviest ? ownersOf(ownership, heaviest, fileOf(profile, heaviest)) : []),
+  };
+}
+
+// Check a profile against every budget that applies to a scenario
+export function checkBudgets(
+  profile: Profile,
+  budgets: Budget[],
+  options: { file: string; scenario?: string; ownership?: Ownership },
+): BudgetReport {
+  const applicable = budgets.filter((b) => !b.scenario || b.scenario === options.scenario);
+  const results = applicable.map((b) => checkBudget(profile, b, options.ownership));
+  return {
+    file: options.file,
+    scenario: options.scenario,
+    results,
+    skipped: budgets.length - applicable.length,
+    passed: results.every((r) => r.passed),
+  };
+}
+
+export function formatBudgetResult(result: BudgetResult): string {
+  const { budget } = result;
+  const icon = result.passed ? "✅" : "❌";
+  const owners = result.owners.length > 0 ? ` 👥 ${result.owners.join(" ")}` : "";
+  const top = !result.passed && result.topFunctions.length > 0
+    ? `\n   ↳ ${result.topFunctions.map((f) => `${f.name} (${f.percentage}%)`).join(", ")}`
+    : "";
+  return `${icon} ${result.subject}: ${result.actual}% ${budget.measure} ${result.sampleType} (budget ≤ ${budget.max}%${budget.scenario ? `, scenario ${budget.scenario}` : ""})${owners}${budget.description ? ` — ${budget.description}` : ""}${top}`;
+}
+
+// One-line budgets for CI gates, with a share or an absolute limit:
+//
+//   encoding/json <= 10% cum
+//   function main.parse* < 5% flat cpu
+//   total allocations <= 500MB
+//
+// The subject is "total" (optionally followed by a sample type), a package,
+// or a function glob; one whose last path element has a dot, like
+// main.parse*, is taken for a function unless prefixed with "package".
+// After the limit come, in any order, cum or flat (default cum) and a sample
+// type or one of its aliases (default: the profile's default).
+export interface BudgetRule {
+  rule: string;
+  // Undefined for the profile total
+  package?: string;
+  function?: string;
+  sampleType?: string;
+  measure: Budget["measure"];
+  strict: boolean;
+  // Share of the total in percent, or an amount in bytes, seconds or a count
+  max: number;
+  unit: "percent" | "bytes" | "seconds" | "count";
+}
+
+export interface BudgetRuleResult {
+  rule: BudgetRule;
+  subject: string;
+  sampleType: string;
+  // Measured amount in bytes, seconds or a count, and as a share of the total
+  actual: number;
+  actualPercent: number;
+  unit: "bytes" | "seconds" | "count";
+  passed: boolean;
+  topFunctions: Array<{ name: string; percentage: number }>;
+}
+
+const SAMPLE_TYPE_ALIASES: Record<string, string> = {
+  allocations: "alloc_space",
+  allocs: "alloc_space",
+  allocated: "alloc_space",
+  memory: "inuse_space",
+  inuse: "inuse_space",
+  "in-use": "inuse_space",
+  objects: "alloc_objects",
+  time: "cpu",
+};
+
+const LIMIT_UNITS: Record<string, [BudgetRule["unit"], number]> = {
+  "%": ["percent", 1],
+  b: ["bytes", 1],
+  kb: ["bytes", 1024],
+  kib: ["bytes", 1024],
+  mb: ["bytes", 1024 ** 2],
+  mib: ["bytes", 1024 ** 2],
+  gb: ["bytes", 1024 ** 3],
+  gib: ["bytes", 1024 ** 3],
+  tb: ["bytes", 1024 ** 4],
+  ns: ["seconds", 1e-9],
+  us: ["seconds", 1e-6],
+  µs: ["seconds", 1e-6],
+  ms: ["seconds", 1e-3],
+  s: ["seconds", 1],
+  m: ["seconds", 60],
+  min: ["seconds", 60],
+  h: ["seconds", 3600],
+  "": ["count", 1],
+  k: ["count", 1e3],
+};
+
+export function parseBudgetRule(rule: string): BudgetRule {
+  const match = rule.trim().match(/^(?:(package|function)\s+)?(.+?)\s*(<=|≤|<)\s*(\d+(?:\.\d+)?)\s*(%|[a-zA-Zµ]*)(?:\s+(.*))?$/);
+  if (!match) {
+    throw new Error(`Budget "${rule}": expected "<subject> <= <limit> [cum|flat] [sample type]", e.g. "encoding/json <= 10% cum" or "total allocations <= 500MB"`);
+  }
+  const [, kind, subjectText, op, amount, unitText, rest = ""] = match;
+  const limitUnit = LIMIT_UNITS[unitText.toLowerCase()];
+  if (!limitUnit) {
+    throw new Error(`Budget "${rule}": unknown unit "${unitText}" (use %, B to TB, ns to h, k or none for a count)`);
+  }
+  const [unit, scale] = limitUnit;
+
+  const words = subjectText.split(/\s+/);
+  const total = !kind && words[0] === "total";
+  let sampleType = total && words.length > 1 ? words.slice(1).join("_") : undefined;
+  if (!total && words.length > 1) {
+    throw new Error(`Budget "${rule}": the subject "${subjectText}" has spaces; name one package or function glob`);
+  }
+  let measure: Budget["measure"] | undefined;
+  for (const word of rest.split(/\s+/).filter(Boolean)) {
+    if (word === "cum" || word === "flat") {
+      measure = word;
+    } else if (!sampleType) {
+      sampleType = word;
+    } else {
+      throw new Error(`Budget "${rule}": unexpected "${word}" after the limit`);
+    }
+  }
+  if (total && unit === "percent") {
+    throw new Error(`Budget "${rule}": the total is always 100% of itself; give an amount such as 500MB or 30s`);
+  }
+  const last = subjectText.split("/").pop() ?? "";
+  const isFunction = kind === "function" || (!kind && last.includes("."));
+  return {
+    rule,
+    package: total || isFunction ? undefined : subjectText,
+    function: !total && isFunction ? subjectText : undefined,
+    sampleType: sampleType && (SAMPLE_TYPE_ALIASES[sampleType] ?? sampleType),
+    measure: measure ?? "cum",
+    strict: op === "<",
+    max: Number(amount) * scale,
+    unit,
+  };
+}
+
+function baseUnitOf(unit: string): BudgetRuleResult["unit"] {
+  return unit === "bytes" ? "bytes" : ["nanoseconds", "microseconds", "milliseconds", "seconds"].includes(unit) ? "seconds" : "count";
+}
+
+// Measure a rule's subject in a profile and compare it with the limit
+export function checkBudgetRule(profile: Profile, rule: BudgetRule): BudgetRuleResult {
+  const sampleIndex = sampleIndexOf(profile, rule.sampleType);
+  const sampleType = profile.sampleTypes[sampleIndex];
+  const unit = baseUnitOf(sampleType.unit);
+  if (rule.unit !== "percent" && rule.unit !== unit) {
+    throw new Error(`Budget "${rule.rule}": the limit is in ${rule.unit}, but ${sampleType.type} is measured in ${unit}`);
+  }
+  const total = totalOf(profile, sampleIndex);
+  const budget = { package: rule.package, function: rule.function, max: rule.max, measure: rule.measure };
+  const matches = rule.package || rule.function ? matcherFor(budget) : () => true;
+  const value = rule.package || rule.function ? measureMatching(profile, sampleIndex, matches, rule.measure) : total;
+  const actual = toBaseUnit(value, sampleType.unit);
+  const actualPercent = percentOf(value, total);
+  const measured = rule.unit === "percent" ? actualPercent : actual;
+  return {
+    rule,
+    subject: rule.package || rule.function ? subjectOf(budget) : "total",
+    sampleType: sampleType.type,
+    actual,
+    actualPercent,
+    unit,
+    passed: rule.strict ? measured < rule.max : measured <= rule.max,
+    topFunctions: rule.package || rule.function ? heaviestMatching(profile, sampleIndex, matches, rule.measure, total) : [],
+  };
+}
+
+export function formatBudgetRuleResult(result: BudgetRuleResult): string {
+  const { rule } = result;
+  const icon = result.passed ? "✅" : "❌";
+  const actual = rule.unit === "percent"
+    ? `${result.actualPercent}% ${rule.measure}`
+    : `${formatValue(result.actual, result.unit)}${result.subject === "total" ? "" : ` (${result.actualPercent}% ${rule.measure})`}`;
+  const limit = rule.unit === "percent" ? `${rule.max}%` : formatValue(rule.max, rule.unit);
+  const top = !result.passed && result.topFunctions.length > 0
+    ? `\n   ↳ ${result.topFunctions.map((f) => `${f.name} (${f.percentage}%)`).join(", ")}`
+    : "";
+  return `${icon} ${result.subject}: ${actual} ${result.sampleType} (budget ${rule.strict ? "<" : "≤"} ${limit}) — ${rule.rule}${top}`;
+}
@@ -0,0 +1,315 @@
+/**
+ * Profile any Go main package: build it with a profiling hook added through
+ * `go build -overlay`, run it with its own arguments and analyze each profile
+ * the hook writes. The program needs no profiling flags of its own.
+ */
+import { execFile, spawn } from "node:child_process";
+import { existsSync, statSync } from "node:fs";
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { promisify } from "node:util";
+import { detectAntiPatterns, type AntiPattern } from "./antipatterns.js";
+import { headCommit } from "./baselines.js";
+import { recordCapture } from "./captures.js";
+import { keepProfile } from "./catalog.js";
+import { findingFromAntiPattern, formatFinding, recordFindings, type Finding } from "./findings.js";
+import { topFunctionsOf, type TopFunction } from "./flamegraph.js";
+import type { ProfileType } from "./goapp.js";
+import { t, type Lang } from "./i18n.js";
+import { fileOf, formatValue, readProfile, sampleIndexOf, toBaseUnit, totalOf } from "./pprof.js";
+import { flamegraphUri } from "./render.js";
+import { applySuppressions, listSuppressions } from "./suppressions.js";
+import { symbolizeNativeFile } from "./symbolize.js";
+
+const execFileAsync = promisify(execFile);
+
+export interface RunProfile {
+  profileType: ProfileType;
+  profileId: string;
+  // CPU or delay seconds, or in-use bytes
+  total: number;
+  unit: "seconds" | "bytes";
+  topFunctions: TopFunction[];
+  antiPatterns: AntiPattern[];
+  findings: Finding[];
+  // Anti-patterns hidden by suppressions
+  suppressed: number;
+}
+
+export interface BuildRun {
+  package: string;
+  args: string[];
+  // Seconds from start until the profiles were written
+  duration: number;
+  commit?: string;
+  // Last lines the program printed
+  output: string[];
+  profiles: RunProfile[];
+}
+
+// Added to the main package at build time. It profiles from init until the
+// window ends, writes each profile to the directory it is given, then a
+// "done" marker; the server stops the program after that.
+const HOOK_SOURCE = `// Code generated by flamegraph-profiler-mcp build_and_profile. DO NOT EDIT.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	dir := os.Getenv("FLAMEGRAPH_PROFILER_DIR")
+	if dir == "" {
+		return
+	}
+	seconds, _ := strconv.ParseFloat(os.Getenv("FLAMEGRAPH_PROFILER_SECONDS"), 64)
+	types := map[string]bool{}
+	for _, t := range strings.Split(os.Getenv("FLAMEGRAPH_PROFILER_TYPES"), ",") {
+		types[t] = true
+	}
+	fail := func(err error) {
+		os.WriteFile(filepath.Join(dir, "error"), []byte(err.Error()), 0o644)
+	}
+
+	var cpu *os.File
+	if types["cpu"] {
+		f, err := os.Create(filepath.Join(dir, "cpu.pb.gz"))
+		if err == nil {
+			err = pprof.StartCPUProfile(f)
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+		cpu = f
+	}
+	if types["block"] {
+		runtime.SetBlockProfileRate(1)
+	}
+	if types["mutex"] {
+		runtime.SetMutexProfileFraction(1)
+	}
+
+	go func() {
+		time.Sleep(time.Duration(seconds * float64(time.Second)))
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			cpu.Close()
+		}
+		if types["heap"] {
+			runtime.GC()
+		}
+		for _, name := range []string{"heap", "block", "mutex"} {
+			if !types[name] {
+				continue
+			}
+			f, err := os.Create(filepath.Join(dir, name+".pb.gz"))
+			if err == nil {
+				err = pprof.Lookup(name).WriteTo(f, 0)
+				f.Close()
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+		}
+		os.WriteFile(filepath.Join(dir, "done"), nil, 0o644)
+	}()
+}
+`;
+
+const HOOK_FILE = "zz_flamegraph_profiler.go";
+
+// Time allowed beyond the profile window for the program to start
+const START_GRACE_MS = 30_000;
+
+// Time a program gets to exit after SIGTERM before it is killed
+const STOP_GRACE_MS = 5000;
+
+// Lines of program output kept for the result and error messages
+const OUTPUT_LINES = 20;
+
+// Analyze, record and catalog one profile written by a run, the way
+// profile-app does: top functions, anti-patterns and findings
+export async function analyzeRunProfile(
+  file: string,
+  profileType: ProfileType,
+  run: { name: string; source: string; duration: number; commit?: string },
+): Promise<RunProfile> {
+  // Name cgo and shared-library frames the runtime left as addresses
+  await symbolizeNativeFile(file);
+  const profile = readProfile(file);
+  // CPU shares are by sample count, like profile-app
+  const sampleIndex = sampleIndexOf(profile, profileType === "cpu" ? "samples" : undefined);
+  const totalIndex = sampleIndexOf(profile);
+  const total = toBaseUnit(totalOf(profile, totalIndex), profile.sampleTypes[totalIndex].unit);
+  const unit = profileType === "heap" ? "bytes" : "seconds";
+  const topFunctions = topFunctionsOf(profile, sampleIndex);
+  const { kept: antiPatterns, suppressed } = applySuppressions(
+    detectAntiPatterns(profile, sampleIndex),
+    await listSuppressions(),
+    (pattern) => pattern.function,
+    (name) => fileOf(profile, name),
+  );
+
+  const capture = await recordCapture({
+    target: run.source,
+    commit: run.commit,
+    profileType,
+    duration: run.duration,
+    total,
+    unit,
+    topFunctions,
+    issues: antiPatterns.length,
+  }).catch(() => undefined);
+  const entry = await keepProfile(file, `${run.name}_${profileType}`, {
+    target: run.source,
+    profileType,
+    commit: run.commit,
+    captureId: capture?.id,
+  });
+  const findings = await recordFindings(antiPatterns.map((p) => findingFromAntiPattern(p, run.source)));
+  return { profileType, profileId: entry.id, total, unit, topFunctions, antiPatterns, findings, suppressed };
+}
+
+const HEADINGS: Record<ProfileType, string> = {
+  cpu: "🔥 CPU",
+  heap: "🧠 Heap",
+  block: "⏸️ Block",
+  mutex: "🔒 Mutex",
+};
+
+// A profile of a run: its total, top functions, findings and flamegraph
+export function formatRunProfile(p: RunProfile, lang: Lang = "en"): string {
+  const lines = [
+    t(lang, "run.heading", {
+      heading: HEADINGS[p.profileType],
+      total: formatValue(p.total, p.unit),
+      inUse: p.profileType === "heap" ? t(lang, "run.inUse") : "",
+      id: p.profileId,
+    }),
+    ...(p.topFunctions.length > 0
+      ? p.topFunctions.slice(0, 5).map((f, i) => `${i + 1}. ${f.name}: ${f.percentage}%`)
+      : [t(lang, "run.noSamples")]),
+    ...p.findings.map((f) => formatFinding(f, lang)),
+    ...(p.suppressed > 0 ? [t(lang, "run.suppressed", { count: p.suppressed })] : []),
+    t(lang, "run.flamegraph", { uri: flamegraphUri(p.profileId) }),
+  ];
+  return lines.join("\n");
+}
+
+// Build a main package directory, or a single .go file, with the hook added
+async function buildWithHook(target: string, workDir: string, binary: string, signal?: AbortSignal): Promise<void> {
+  const isFile = statSync(target).isFile();
+  const dir = isFile ? path.dirname(target) : target;
+  const hook = path.join(workDir, HOOK_FILE);
+  const overlay = path.join(workDir, "overlay.json");
+  await fs.writeFile(hook, HOOK_SOURCE);
+  await fs.writeFile(overlay, JSON.stringify({ Replace: { [path.join(dir, HOOK_FILE)]: hook } }));
+  const sources = isFile ? [target, path.join(dir, HOOK_FILE)] : ["."];
+  try {
+    await execFileAsync("go", ["build", `-overlay=${overlay}`, "-o", binary, ...sources], { cwd: dir, signal });
+  } catch (error) {
+    signal?.throwIfAborted();
+    const stderr = (error as { stderr?: string }).stderr?.trim();
+    if (stderr?.includes("found packages")) {
+      throw new Error(`${target} is not a main package`);
+    }
+    throw stderr ? new Error(stderr) : error;
+  }
+}
+
+function lastLines(output: string): string[] {
+  return output.trimEnd().split("\n").filter(Boolean).slice(-OUTPUT_LINES);
+}
+
+// Build a Go main package, run it with its arguments for a profile window and
+// analyze each profile. The program is stopped with SIGTERM once the
+// profiles are written; one that exits earlier leaves no profiles.
+export async function buildAndProfile(options: {
+  packagePath: string;
+  args: string[];
+  duration: number;
+  profileTypes: ProfileType[];
+  signal?: AbortSignal;
+}): Promise<BuildRun> {
+  const target = path.resolve(options.packagePath);
+  if (!existsSync(target)) {
+    throw new Error(`${target} does not exist`);
+  }
+  const dir = statSync(target).isFile() ? path.dirname(target) : target;
+  const workDir = await fs.mkdtemp(path.join(os.tmpdir(), "build_"));
+  const profileDir = path.join(workDir, "profiles");
+  const binary = path.join(workDir, path.basename(target, ".go"));
+  try {
+    await fs.mkdir(profileDir);
+    await buildWithHook(target, workDir, binary, options.signal);
+
+    const started = Date.now();
+    const child = spawn(binary, options.args, {
+      cwd: dir,
+      env: {
+        ...process.env,
+        FLAMEGRAPH_PROFILER_DIR: profileDir,
+        FLAMEGRAPH_PROFILER_SECONDS: String(options.duration),
+        FLAMEGRAPH_PROFILER_TYPES: options.profileTypes.join(","),
+      },
+      stdio: ["ignore", "pipe", "pipe"],
+    });
+    let output = "";
+    child.stdout?.on("data", (chunk: Buffer) => (output = (output + chunk.toString()).slice(-64 * 1024)));
+    child.stderr?.on("data", (chunk: Buffer) => (output = (output + chunk.toString()).slice(-64 * 1024)));
+    const exited = new Promise<string>((resolve) => {
+      child.on("error", (error) => resolve(error.message));
+      child.on("close", (code, signal) => resolve(signal ? `signal ${signal}` : `code ${code}`));
+    });
+
+    // Wait for the done marker, the program's exit or the deadline
+    const marker = path.join(profileDir, "done");
+    const deadline = started + options.duration * 1000 + START_GRACE_MS;
+    const run: { exit?: string } = {};
+    void exited.then((status) => (run.exit = status));
+    while (!existsSync(marker) && run.exit === undefined && Date.now() < deadline && !options.signal?.aborted) {
+      await new Promise((resolve) => setTimeout(resolve, 200));
+    }
+    const duration = (Date.now() - started) / 1000;
+    const exit = run.exit;
+    if (exit === undefined) {
+      child.kill("SIGTERM");
+      const timer = setTimeout(() => child.kill("SIGKILL"), STOP_GRACE_MS);
+      await exited;
+      clearTimeout(timer);
+    }
+    options.signal?.throwIfAborted();
+
+    const hookError = await fs.readFile(path.join(profileDir, "error"), "utf8").catch(() => undefined);
+    if (hookError) {
+      throw new Error(`Profiling failed inside the program: ${hookError}`);
+    }
+    if (!existsSync(marker)) {
+      const tail = lastLines(output).join("\n");
+      const reason = exit === undefined
+        ? `did not finish profiling within ${Math.round((deadline - started) / 1000)}s`
+        : `exited with ${exit} after ${duration.toFixed(1)}s, before the ${options.duration}s profile window ended; use a shorter duration or arguments that keep it running`;
+      throw new Error(`${path.basename(target)} ${reason}${tail ? `\n${tail}` : ""}`);
+    }
+
+    const commit = await headCommit(dir);
+    const name = path.basename(target, ".go");
+    const profiles: RunProfile[] = [];
+    for (const profileType of options.profileTypes) {
+      profiles.push(await analyzeRunProfile(path.join(profileDir, `${profileType}.pb.gz`), profileType, { name, source: target, duration, commit }));
+    }
+    return { package: target, args: options.args, duration, commit, output: lastLines(output), profiles };
+  } finally {
+    await fs.rm(workDir, { recursive: true, force: true }).catch(() => undefined);
+  }
+}
@@ -0,0 +1,226 @@
+/**
+ * Bundles: a capture set — catalogued profiles with their metadata, the
+ * findings detected in them, a readable report, and a recipe for capturing
+ * each profile again — packed into one zip archive, so an investigation can
+ * move to another machine or be attached to a support ticket and be loaded
+ * back into a catalog there.
+ *
+ * A bundle holds manifest.json, profiles/<id>.pb.gz per profile, and
+ * report.md, which reads without the profiler.
+ */
+import fs from "node:fs/promises";
+import path from "node:path";
+import { listCaptures, type Capture } from "./captures.js";
+import { catalogProfile, getProfile, listProfiles, type CatalogEntry, type CatalogFilter } from "./catalog.js";
+import { importFindings, listFindings, type Finding } from "./findings.js";
+import { topFunctionsOf } from "./flamegraph.js";
+import { formatValue, readProfile, sampleIndexOf, totalOf } from "./pprof.js";
+import { dataDir, storedProfilePath } from "./store.js";
+import { readZip, writeZip, type ZipFile } from "./zip.js";
+
+export const BUNDLE_FORMAT = "flamegraph-profiler-bundle";
+export const BUNDLE_VERSION = 1;
+
+// The tool call that captures a profile like this one again
+export interface CaptureRecipe {
+  tool: string;
+  arguments: Record<string, unknown>;
+}
+
+export interface BundledProfile {
+  // Catalog entry as it was on the exporting machine, without its local path
+  entry: Omit<CatalogEntry, "path">;
+  // File in the bundle
+  file: string;
+  // Capture history record, when the profile was captured by the server
+  capture?: Capture;
+  recipe?: CaptureRecipe;
+}
+
+export interface BundleManifest {
+  format: typeof BUNDLE_FORMAT;
+  version: number;
+  name: string;
+  note?: string;
+  createdAt: string;
+  profiles: BundledProfile[];
+  findings: Finding[];
+}
+
+// Recipe for capturing a catalog entry again, from its target and type:
+// Go programs with profile-app, containers and pods with their tools, and
+// block, mutex and goroutine profiles of live addresses with the capture
+// tools. Profiles from elsewhere have none.
+export function captureRecipe(entry: Pick<CatalogEntry, "target" | "profileType">, capture?: Capture): CaptureRecipe | undefined {
+  const seconds = capture && capture.duration > 0 ? Math.round(capture.duration) : undefined;
+  const docker = entry.target.match(/^docker:(.+)$/);
+  const k8s = entry.target.match(/^k8s:([^/]+)\/([^/]+)(?:\/(.+))?$/);
+  if (docker) {
+    return { tool: "profile_docker_container", arguments: { container: docker[1], profileType: entry.profileType, ...(seconds ? { seconds } : {}) } };
+  }
+  if (k8s) {
+    return {
+      tool: "profile_k8s_pod",
+      arguments: { namespace: k8s[1], pod: k8s[2], ...(k8s[3] ? { container: k8s[3] } : {}), profileTypes: [entry.profileType], ...(seconds ? { seconds } : {}) },
+    };
+  }
+  if (entry.target.endsWith(".go") && ["cpu", "heap", "block", "mutex"].includes(entry.profileType)) {
+    return { tool: "profile-app", arguments: { appPath: entry.target, profileType: entry.profileType, ...(seconds ? { duration: seconds } : {}) } };
+  }
+  if (["block", "mutex"].includes(entry.profileType) && /^(https?:\/\/)?[\w.-]+:\d+/.test(entry.target)) {
+    return { tool: `capture_${entry.profileType}_profile`, arguments: { target: entry.target, ...(seconds ? { seconds } : {}) } };
+  }
+  if (entry.profileType === "goroutine" && /^(https?:\/\/)?[\w.-]+:\d+/.test(entry.target)) {
+    return { tool: "capture_goroutine_profile", arguments: { target: entry.target } };
+  }
+  return undefined;
+}
+
+// Findings with an occurrence in one of the profiles: detected in the
+// program they were captured from, or in a comparison that included them
+function relatedFindings(findings: Finding[], entries: CatalogEntry[]): Finding[] {
+  return findings.filter((f) => f.occurrences.some((o) =>
+    entries.some((e) => o.source === e.target || o.source.includes(e.path) || o.source.includes(e.id))));
+}
+
+// Readable summary of a bundle: what is in it and each profile's hottest functions
+function bundleReport(manifest: BundleManifest, profiles: Map<string, string>): string {
+  const sections = manifest.profiles.map(({ entry, recipe }) => {
+    const profile = readProfile(profiles.get(entry.id)!);
+    const sampleIndex = sampleIndexOf(profile);
+    const { unit } = profile.sampleTypes[sampleIndex];
+    const top = topFunctionsOf(profile, sampleIndex).slice(0, 5);
+    const labels = Object.entries(entry.labels).map(([key, value]) => `${key}=${value}`).join(", ");
+    return [
+      `## ${entry.id}: ${entry.profileType} profile of ${entry.target}`,
+      "",
+      `Captured ${entry.at}${entry.commit ? ` at commit ${entry.commit}` : ""}${labels ? `, labeled ${labels}` : ""}; ${formatValue(totalOf(profile, sampleIndex), unit)} in total.`,
+      "",
+      ...top.map((fn, i) => `${i + 1}. ${fn.name} (${fn.percentage}%)`),
+      ...(recipe ? ["", `Capture again with \`${recipe.tool}\` ${JSON.stringify(recipe.arguments)}`] : []),
+    ].join("\n");
+  });
+  const findings = manifest.findings.map((f) => `- [${f.id}] (${f.status}, ${f.severity}) ${f.title}`);
+  return [
+    `# ${manifest.name}`,
+    "",
+    ...(manifest.note ? [manifest.note, ""] : []),
+    `Bundled ${manifest.createdAt}: ${manifest.profiles.length} profile(s), ${manifest.findings.length} finding(s). Load it with the profiler's import_bundle tool, or open the files under profiles/ with \`go tool pprof\`.`,
+    "",
+    ...sections.flatMap((section) => [section, ""]),
+    ...(findings.length > 0 ? ["## Findings", "", ...findings, ""] : []),
+  ].join("\n");
+}
+
+// Pack catalogued profiles, chosen by ID or by a catalog filter, into a
+// bundle archive. The default output is bundles/<name>.zip in the data directory.
+export async function exportBundle(options: {
+  ids?: string[];
+  filter?: CatalogFilter;
+  name?: string;
+  note?: string;
+  findings?: boolean;
+  outputPath?: string;
+}): Promise<{ path: string; manifest: BundleManifest; bytes: number }> {
+  const entries = options.ids && options.ids.length > 0
+    ? await Promise.all(options.ids.map((id) => getProfile(id)))
+    : await listProfiles(options.filter ?? {});
+  if (entries.length === 0) {
+    throw new Error("No profiles to bundle; pass profile IDs or a filter that matches some");
+  }
+
+  const createdAt = new Date().toISOString();
+  const name = options.name ?? `bundle_${createdAt.replace(/[:.]/g, "-")}`;
+  const captures = new Map((await listCaptures()).map((c) => [c.id, c]));
+  const profiles = new Map<string, string>();
+  const files: ZipFile[] = [];
+  const bundled: BundledProfile[] = [];
+  for (const { path: stored, ...entry } of entries) {
+    const file = `profiles/${entry.id}.pb.gz`;
+    files.push({ name: file, content: await fs.readFile(stored) });
+    profiles.set(entry.id, stored);
+    const capture = entry.captureId ? captures.get(entry.captureId) : undefined;
+    const recipe = captureRecipe(entry, capture);
+    bundled.push({ entry, file, ...(capture ? { capture } : {}), ...(recipe ? { recipe } : {}) });
+  }
+
+  const manifest: BundleManifest = {
+    format: BUNDLE_FORMAT,
+    version: BUNDLE_VERSION,
+    name,
+    ...(options.note ? { note: options.note } : {}),
+    createdAt,
+    profiles: bundled,
+    findings: options.findings === false ? [] : relatedFindings(await listFindings(), entries),
+  };
+  files.unshift(
+    { name: "manifest.json", content: Buffer.from(JSON.stringify(manifest, null, 2)) },
+    { name: "report.md", content: Buffer.from(bundleReport(manifest, profiles)) },
+  );
+
+  const output = path.resolve(options.outputPath ?? path.join(dataDir(), "bundles", `${name.replace(/[^\w.-]+/g, "-")}.zip`));
+  await fs.mkdir(path.dirname(output), { recursive: true });
+  const archive = writeZip(files);
+  await fs.writeFile(output, archive);
+  return { path: output, manifest, bytes: archive.length };
+}
+
+// Load a bundle into the catalog. Each profile gets a new ID, keeping its
+// capture time, target, type, commit and labels, plus bundle=<name>;
+// references between the bundled profiles (merged, symbolized or redacted
+// from) follow the new IDs. Findings not already known here are added.
+export async function importBundle(
+  file: string,
+  labels: Record<string, string> = {},
+): Promise<{ manifest: BundleManifest; entries: CatalogEntry[]; ids: Record<string, string>; findings: number }> {
+  const source = path.resolve(file);
+  const archive = new Map(readZip(await fs.readFile(source)).map((f) => [f.name, f.content]));
+  const manifestFile = archive.get("manifest.json");
+  if (!manifestFile) {
+    throw new Error(`${source} is not a profiler bundle: no manifest.json`);
+  }
+  const manifest = JSON.parse(manifestFile.toString("utf-8")) as BundleManifest;
+  if (manifest.format !== BUNDLE_FORMAT) {
+    throw new Error(`${source} is not a profiler bundle: unknown format "${manifest.format}"`);
+  }
+  if (manifest.version > BUNDLE_VERSION) {
+    throw new Error(`${source} is a version ${manifest.version} bundle; this server reads up to version ${BUNDLE_VERSION}`);
+  }
+
+  const ids: Record<string, string> = {};
+  const remap = (ref: string) => ids[ref] ?? ref;
+  const entries: CatalogEntry[] = [];
+  // Oldest first, so profiles derived from others find their sources' new IDs
+  const bundled = [...manifest.profiles].sort((a, b) => a.entry.at.localeCompare(b.entry.at));
+  for (const { entry, file: member } of bundled) {
+    const content = archive.get(member);
+    if (!content) {
+      throw new Error(`Bundle ${source} lists ${member} but does not contain it`);
+    }
+    const stored = await storedProfilePath(`${path.basename(entry.target).replace(/\.go$/, "")}_${entry.profileType}`);
+    await fs.writeFile(stored, content);
+    // Fail on a damaged profile before it is catalogued, leaving nothing in
+    // the store
+    try {
+      readProfile(stored);
+    } catch (error) {
+      await fs.rm(stored, { force: true });
+      throw new Error(`Bundle ${source} has a damaged ${member}: ${error instanceof Error ? error.message : error}`);
+    }
+    // The capture history record stays on the machine that captured it
+    const { id, bytes, captureId, mergedFrom, symbolizedFrom, redactedFrom, ...details } = entry;
+    const imported = await catalogProfile(stored, {
+      ...details,
+      ...(mergedFrom ? { mergedFrom: mergedFrom.map(remap) } : {}),
+      ...(symbolizedFrom ? { symbolizedFrom: remap(symbolizedFrom) } : {}),
+      ...(redactedFrom ? { redactedFrom: remap(redactedFrom) } : {}),
+      importedFrom: `${source}#${member}`,
+      labels: { ...entry.labels, bundle: manifest.name, ...labels },
+    });
+    ids[id] = imported.id;
+    entries.push(imported);
+  }
+
+  const findings = await importFindings(manifest.findings);
+  return { manifest, entries, ids, findings: findings.length };
+}
@@ -0,0 +1,383 @@
+/**
+ * pprof-style call graphs: one node per function with its flat and
+ * cumulative cost, one edge per caller → callee pair, pruned to the nodes
+ * and edges that matter. Written as Graphviz DOT, laid out as SVG without
+ * Graphviz, or rendered to PNG by Graphviz's dot when it is installed.
+ */
+import { spawn } from "node:child_process";
+import { formatValue, stackOf, totalOf, type Profile } from "./pprof.js";
+
+export interface CallGraphNode {
+  name: string;
+  flat: number;
+  cum: number;
+  flatPct: number;
+  cumPct: number;
+}
+
+export interface CallGraphEdge {
+  from: string;
+  to: string;
+  weight: number;
+  pct: number;
+  // Only reached through pruned functions, drawn dashed like pprof's residual edges
+  indirect: boolean;
+}
+
+export interface CallGraph {
+  sampleType: string;
+  unit: string;
+  total: number;
+  nodes: CallGraphNode[];
+  edges: CallGraphEdge[];
+  // Functions and edges pruned by the thresholds
+  droppedNodes: number;
+  droppedEdges: number;
+}
+
+export interface CallGraphOptions {
+  // Drop functions with a cumulative share below this fraction, like pprof -nodefraction
+  nodeFraction: number;
+  // Drop edges with a share below this fraction, like pprof -edgefraction
+  edgeFraction: number;
+  // Keep at most this many functions, by cumulative value, like pprof -nodecount
+  nodeCount: number;
+}
+
+const round2 = (value: number) => Math.round(value * 100) / 100;
+
+// Build the call graph of one sample type. Each function and each edge is
+// counted once per sample, so recursion does not inflate cumulative values.
+export function buildCallGraph(profile: Profile, sampleIndex: number, options: CallGraphOptions): CallGraph {
+  const { type, unit } = profile.sampleTypes[sampleIndex];
+  const total = totalOf(profile, sampleIndex);
+  const percent = (value: number) => (total === 0 ? 0 : round2((value / total) * 100));
+  const stacks = profile.samples
+    .filter((sample) => sample.values[sampleIndex] !== 0)
+    .map((sample) => ({ stack: stackOf(profile, sample), value: sample.values[sampleIndex] }));
+
+  const nodes = new Map<string, CallGraphNode>();
+  for (const { stack, value } of stacks) {
+    for (const name of new Set(stack)) {
+      const node = nodes.get(name) ?? { name, flat: 0, cum: 0, flatPct: 0, cumPct: 0 };
+      node.cum += value;
+      nodes.set(name, node);
+    }
+    const leaf = nodes.get(stack[stack.length - 1]);
+    if (leaf) {
+      leaf.flat += value;
+    }
+  }
+  const kept = [...nodes.values()]
+    .filter((n) => Math.abs(n.cum) >= Math.abs(total) * options.nodeFraction)
+    .sort((a, b) => Math.abs(b.cum) - Math.abs(a.cum))
+    .slice(0, options.nodeCount)
+    .map((n) => ({ ...n, flatPct: percent(n.flat), cumPct: percent(n.cum) }));
+  const keptNames = new Set(kept.map((n) => n.name));
+
+  // Edges between kept functions, bridging pruned frames between them
+  const edges = new Map<string, CallGraphEdge & { direct: number }>();
+  const allEdges = new Set<string>();
+  for (const { stack, value } of stacks) {
+    const seen = new Set<string>();
+    let caller: string | undefined;
+    let gap = false;
+    for (let i = 0; i < stack.length; i++) {
+      if (i > 0) {
+        allEdges.add(`${stack[i - 1]}\n${stack[i]}`);
+      }
+      if (!keptNames.has(stack[i])) {
+        gap = caller !== undefined;
+        continue;
+      }
+      if (caller !== undefined) {
+        const key = `${caller}\n${stack[i]}`;
+        const edge = edges.get(key) ?? { from: caller, to: stack[i], weight: 0, pct: 0, indirect: false, direct: 0 };
+        if (!seen.has(key)) {
+          edge.weight += value;
+          if (!gap) edge.direct += value;
+          seen.add(key);
+        }
+        edges.set(key, edge);
+      }
+      caller = stack[i];
+      gap = false;
+    }
+  }
+  const keptEdges = [...edges.values()]
+    .filter((e) => Math.abs(e.weight) >= Math.abs(total) * options.edgeFraction)
+    .sort((a, b) => Math.abs(b.weight) - Math.abs(a.weight))
+    .map(({ direct, ...e }) => ({ ...e, pct: percent(e.weight), indirect: direct === 0 }));
+  const droppedEdges = allEdges.size - keptEdges.filter((e) => !e.indirect).length;
+
+  return {
+    sampleType: type,
+    unit,
+    total,
+    nodes: kept,
+    edges: keptEdges,
+    droppedNodes: nodes.size - kept.length,
+    droppedEdges: Math.max(0, droppedEdges),
+  };
+}
+
+function formatAmount(graph: CallGraph, value: number): string {
+  return graph.unit === "count" ? String(value) : formatValue(value, graph.unit);
+}
+
+// Package and function on separate lines, as pprof labels nodes:
+// github.com/org/app/pkg.(*T).Method → pkg / (*T).Method
+function nodeLines(name: string): string[] {
+  const base = name.slice(name.lastIndexOf("/") + 1);
+  const dot = base.indexOf(".");
+  return dot > 0 ? [base.slice(0, dot), base.slice(dot + 1)] : [base];
+}
+
+function hex(r: number, g: number, b: number): string {
+  return `#${[r, g, b].map((c) => Math.round(c).toString(16).padStart(2, "0")).join("")}`;
+}
+
+// Grey for cold, through to red for the hottest share, like pprof's node colors
+function heatColor(share: number, dark: boolean): string {
+  const s = Math.min(1, Math.max(0, Math.abs(share)));
+  return dark ? hex(80 + 100 * s, 80 - 20 * s, 80 - 40 * s) : hex(240 + 13 * s, 240 - 60 * s, 240 - 110 * s);
+}
+
+function nodeFontSize(node: CallGraphNode, graph: CallGraph): number {
+  return Math.round(8 + 24 * Math.sqrt(Math.min(1, Math.abs(node.flat) / (Math.abs(graph.total) || 1))));
+}
+
+function edgeWidth(edge: CallGraphEdge, graph: CallGraph): number {
+  return round2(1 + 5 * Math.min(1, Math.abs(edge.weight) / (Math.abs(graph.total) || 1)));
+}
+
+// DOT string; labels keep their \n and \l line escapes
+function quote(text: string): string {
+  return `"${text.replace(/"/g, '\\"')}"`;
+}
+
+function nodeLabel(node: CallGraphNode, graph: CallGraph): string[] {
+  return [
+    ...nodeLines(node.name),
+    ...(node.flat === 0
+      ? [`0 of ${formatAmount(graph, node.cum)} (${node.cumPct}%)`]
+      : [`${formatAmount(graph, node.flat)} (${node.flatPct}%)`, ...(node.cum !== node.flat ? [`of ${formatAmount(graph, node.cum)} (${node.cumPct}%)`] : [])]),
+  ];
+}
+
+// Graphviz DOT, styled like pprof's -dot output
+export function callGraphDot(graph: CallGraph, title: string): string {
+  const ids = new Map(graph.nodes.map((n, i) => [n.name, `N${i + 1}`]));
+  const lines = [
+    `digraph ${quote(title)} {`,
+    `node [style=filled fillcolor="#f8f8f8"]`,
+    `subgraph cluster_L { "legend" [shape=box fontsize=16 label=${quote(`${title}\\l${graph.sampleType}: ${formatAmount(graph, graph.total)} total\\lShowing ${graph.nodes.length} nodes, dropped ${graph.droppedNodes}\\l`)}] }`,
+  ];
+  for (const node of graph.nodes) {
+    const share = node.cum / (graph.total || 1);
+    lines.push(`${ids.get(node.name)} [label=${quote(nodeLabel(node, graph).join("\\n"))} shape=box fontsize=${nodeFontSize(node, graph)} tooltip=${quote(`${node.name} (${formatAmount(graph, node.cum)})`)} color="${heatColor(share, true)}" fillcolor="${heatColor(share, false)}"]`);
+  }
+  for (const edge of graph.edges) {
+    const share = edge.weight / (graph.total || 1);
+    lines.push(`${ids.get(edge.from)} -> ${ids.get(edge.to)} [label=${quote(` ${formatAmount(graph, edge.weight)}`)} weight=${Math.max(1, Math.round(Math.abs(edge.pct)))} penwidth=${edgeWidth(edge, graph)} color="${heatColor(share, true)}"${edge.indirect ? " style=dotted" : ""} tooltip=${quote(`${edge.from} -> ${edge.to} (${formatAmount(graph, edge.weight)})`)}]`);
+  }
+  lines.push("}");
+  return `${lines.join("\n")}\n`;
+}
+
+function escapeXml(text: string): string {
+  return text.replace(/[&<>"']/g, (c) => `&#${c.charCodeAt(0)};`);
+}
+
+interface Box {
+  node: CallGraphNode;
+  x: number;
+  y: number;
+  width: number;
+  height: number;
+  lines: string[];
+  // Leading lines naming the function, drawn at fontSize; the values follow smaller
+  nameLines: number;
+  fontSize: number;
+}
+
+const VALUE_FONT_SIZE = 10;
+
+// Layered layout without Graphviz: back edges are found by depth-first search
+// from the hottest roots, nodes are layered by longest path from a root, and
+// each layer is ordered by the mean position of its callers over a few sweeps.
+export function callGraphSvg(graph: CallGraph, title: string): string {
+  const names = graph.nodes.map((n) => n.name);
+  const forward = graph.edges.filter((e) => e.from !== e.to);
+  const callees = new Map(names.map((n) => [n, forward.filter((e) => e.from === n).map((e) => e.to)]));
+
+  const back = new Set<string>();
+  const state = new Map<string, "open" | "done">();
+  const dfs = (name: string) => {
+    state.set(name, "open");
+    for (const callee of callees.get(name) ?? []) {
+      if (state.get(callee) === "open") {
+        back.add(`${name}\n${callee}`);
+      } else if (!state.has(callee)) {
+        dfs(callee);
+      }
+    }
+    state.set(name, "done");
+  };
+  const called = new Set(forward.map((e) => e.to));
+  for (const name of [...names.filter((n) => !called.has(n)), ...names]) {
+    if (!state.has(name)) dfs(name);
+  }
+  const dag = forward.filter((e) => !back.has(`${e.from}\n${e.to}`));
+
+  const layer = new Map(names.map((n) => [n, 0]));
+  for (let changed = true, rounds = 0; changed && rounds < names.length; rounds++) {
+    changed = false;
+    for (const e of dag) {
+      if ((layer.get(e.to) ?? 0) < (layer.get(e.from) ?? 0) + 1) {
+        layer.set(e.to, (layer.get(e.from) ?? 0) + 1);
+        changed = true;
+      }
+    }
+  }
+  const layers: string[][] = [];
+  for (const name of names) {
+    (layers[layer.get(name) ?? 0] ??= []).push(name);
+  }
+  const position = new Map<string, number>();
+  layers.forEach((l) => l.forEach((n, i) => position.set(n, i)));
+  for (let sweep = 0; sweep < 4; sweep++) {
+    for (const l of layers.slice(1)) {
+      const mean = (n: string) => {
+        const callers = dag.filter((e) => e.to === n).map((e) => position.get(e.from) ?? 0);
+        return callers.length > 0 ? callers.reduce((a, b) => a + b, 0) / callers.length : position.get(n) ?? 0;
+      };
+      l.sort((a, b) => mean(a) - mean(b));
+      l.forEach((n, i) => position.set(n, i));
+    }
+  }
+
+  const gapX = 24;
+  const gapY = 56;
+  const top = 44;
+  const boxes = new Map<string, Box>();
+  let y = top;
+  let width = 0;
+  for (const l of layers) {
+    const row = l.map((name) => {
+      const node = graph.nodes.find((n) => n.name === name) as CallGraphNode;
+      const fontSize = Math.min(16, nodeFontSize(node, graph));
+      const lines = nodeLabel(node, graph);
+      const nameLines = nodeLines(node.name).length;
+      const sizeOf = (i: number) => (i < nameLines ? fontSize : VALUE_FONT_SIZE);
+      return {
+        node,
+        x: 0,
+        y,
+        width: Math.max(...lines.map((t, i) => t.length * sizeOf(i) * 0.62)) + 16,
+        height: lines.reduce((sum, _, i) => sum + sizeOf(i) + 3, 0) + 10,
+        lines,
+        nameLines,
+        fontSize,
+      };
+    });
+    const rowWidth = row.reduce((sum, b) => sum + b.width, 0) + gapX * Math.max(0, row.length - 1);
+    width = Math.max(width, rowWidth);
+    row.forEach((b) => boxes.set(b.node.name, b));
+    y += Math.max(0, ...row.map((b) => b.height)) + gapY;
+  }
+  width += 80;
+  for (const l of layers) {
+    const row = l.map((n) => boxes.get(n) as Box);
+    const rowWidth = row.reduce((sum, b) => sum + b.width, 0) + gapX * Math.max(0, row.length - 1);
+    let x = (width - rowWidth) / 2;
+    for (const b of row) {
+      b.x = x;
+      x += b.width + gapX;
+    }
+  }
+  const height = y - gapY + 16;
+
+  const parts: string[] = [
+    `<defs><marker id="arrow" viewBox="0 0 10 10" refX="9" refY="5" markerWidth="6" markerHeight="6" orient="auto-start-reverse"><path d="M0,0L10,5L0,10z" fill="#666"/></marker></defs>`,
+    `<text x="8" y="18" font-family="system-ui, sans-serif" font-size="13" font-weight="600" fill="#222">${escapeXml(title)}</text>`,
+    `<text x="8" y="34" font-family="system-ui, sans-serif" font-size="11" fill="#555">${escapeXml(`${graph.sampleType}: ${formatAmount(graph, graph.total)} total · ${graph.nodes.length} nodes shown, ${graph.droppedNodes} dropped`)}</text>`,
+  ];
+  for (const edge of graph.edges) {
+    const from = boxes.get(edge.from);
+    const to = boxes.get(edge.to);
+    if (!from || !to) continue;
+    const stroke = heatColor(edge.weight / (graph.total || 1), true);
+    const dash = edge.indirect ? ` stroke-dasharray="4 3"` : "";
+    const tooltip = `<title>${escapeXml(`${edge.from} → ${edge.to} (${formatAmount(graph, edge.weight)})`)}</title>`;
+    let d: string;
+    let lx: number;
+    let ly: number;
+    if (from === to) {
+      // Recursion: a loop on the right side of the box
+      const x = from.x + from.width;
+      const cy = from.y + from.height / 2;
+      d = `M${x},${cy - 6} C${x + 40},${cy - 30} ${x + 40},${cy + 30} ${x},${cy + 6}`;
+      lx = x + 34;
+      ly = cy + 4;
+    } else if (to.y > from.y) {
+      const x1 = from.x + from.width / 2;
+      const y1 = from.y + from.height;
+      const x2 = to.x + to.width / 2;
+      const y2 = to.y;
+      d = `M${x1},${y1} C${x1},${(y1 + y2) / 2} ${x2},${(y1 + y2) / 2} ${x2},${y2}`;
+      lx = (x1 + x2) / 2 + 4;
+      ly = (y1 + y2) / 2;
+    } else {
+      // Back edge to a caller: around the left side
+      const x1 = from.x;
+      const y1 = from.y + from.height / 2;
+      const x2 = to.x;
+      const y2 = to.y + to.height / 2;
+      const out = Math.min(x1, x2) - 40;
+      d = `M${x1},${y1} C${out},${y1} ${out},${y2} ${x2},${y2}`;
+      lx = out - 4;
+      ly = (y1 + y2) / 2;
+    }
+    parts.push(`<g>${tooltip}<path d="${d}" fill="none" stroke="${stroke}" stroke-width="${edgeWidth(edge, graph)}"${dash} marker-end="url(#arrow)"/>` +
+      `<text x="${lx.toFixed(1)}" y="${ly.toFixed(1)}" font-family="system-ui, sans-serif" font-size="10" fill="#555">${escapeXml(formatAmount(graph, edge.weight))}</text></g>`);
+  }
+  for (const box of boxes.values()) {
+    const share = box.node.cum / (graph.total || 1);
+    let baseline = box.y + 5;
+    const text = box.lines.map((line, i) => {
+      const size = i < box.nameLines ? box.fontSize : VALUE_FONT_SIZE;
+      baseline += size + 3;
+      return `<text x="${(box.x + box.width / 2).toFixed(1)}" y="${(baseline - 3).toFixed(1)}" text-anchor="middle" font-family="system-ui, sans-serif" font-size="${size}" fill="#222">${escapeXml(line)}</text>`;
+    }).join("");
+    parts.push(`<g><title>${escapeXml(`${box.node.name} (${formatAmount(graph, box.node.cum)})`)}</title>` +
+      `<rect x="${box.x.toFixed(1)}" y="${box.y}" width="${box.width.toFixed(1)}" height="${box.height}" rx="3" fill="${heatColor(share, false)}" stroke="${heatColor(share, true)}"/>${text}</g>`);
+  }
+  return `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 ${Math.ceil(width)} ${height}" width="${Math.ceil(width)}" height="${height}" role="img" aria-label="${escapeXml(title)}"><desc>${escapeXml(describeCallGraph(graph).join("\n"))}</desc>${parts.join("")}</svg>`;
+}
+
+// Text equivalent of a call graph, for screen readers and clients that show no
+// images: every function with its flat and cumulative values, then every edge
+export function describeCallGraph(graph: CallGraph): string[] {
+  return [
+    "Functions (flat, cumulative):",
+    ...graph.nodes.map((n) => `  ${n.name}: ${formatAmount(graph, n.flat)} (${n.flatPct}%), ${formatAmount(graph, n.cum)} (${n.cumPct}%)`),
+    "Calls:",
+    ...graph.edges.map((e) => `  ${e.from} → ${e.to}: ${formatAmount(graph, e.weight)} (${e.pct}%)${e.from === e.to ? ", recursive" : ""}${e.indirect ? ", through pruned functions" : ""}`),
+  ];
+}
+
+// Render DOT to PNG with Graphviz's dot; the embedded layout only draws SVG
+export function renderDotPng(dot: string): Promise<Buffer> {
+  return new Promise((resolve, reject) => {
+    const child = spawn("dot", ["-Tpng"], { stdio: ["pipe", "pipe", "pipe"] });
+    const chunks: Buffer[] = [];
+    let stderr = "";
+    child.stdout.on("data", (chunk: Buffer) => chunks.push(chunk));
+    child.stderr.on("data", (chunk: Buffer) => (stderr += chunk.toString()));
+    child.on("error", (error: NodeJS.ErrnoException) =>
+      reject(error.code === "ENOENT" ? new Error("Graphviz's dot is not on PATH; it is needed for png output (install graphviz), or use format 'svg' for the built-in layout") : error));
+    child.on("close", (code) => (code === 0 ? resolve(Buffer.concat(chunks)) : reject(new Error(stderr.trim() || `dot exited with code ${code}`))));
+    child.stdin.end(dot);
+  });
+}
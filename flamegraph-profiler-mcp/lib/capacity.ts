@@ -0,0 +1,141 @@
+/**
+ * Capacity estimates from the CPU one request costs: the most requests per
+ * second an instance sustains within a latency SLO and a utilization cap, and
+ * the replicas a peak rate needs. Each instance is modelled as an M/M/c queue
+ * with one server per core: requests arrive at random, run on one core at a
+ * time for their CPU cost, and wait for a free core when all are busy. The
+ * waiting time's tail comes from Erlang C. Exponential service times make it
+ * a cautious model for the fairly uniform requests of most services.
+ */
+import type { SloPercentile } from "./slo.js";
+
+const QUANTILES: Record<SloPercentile, number> = { p50: 0.5, p90: 0.9, p99: 0.99 };
+
+// Steps of the search for the highest rate within the SLO
+const SEARCH_STEPS = 60;
+
+export interface CapacityInput {
+  // CPU seconds one request costs
+  cpuSecondsPerRequest: number;
+  cores: number;
+  // Highest share of the cores to plan for, 0-1
+  maxUtilization: number;
+  // Latency target at a percentile, and the time a request spends off CPU
+  // (I/O, downstream calls), seconds
+  slo?: { targetSeconds: number; percentile: SloPercentile; offCpuSeconds: number };
+  peakRps?: number;
+}
+
+export interface LatencyEstimate {
+  percentile: SloPercentile;
+  // Seconds: on CPU, off CPU, waiting for a core, and their sum
+  cpu: number;
+  offCpu: number;
+  queueing: number;
+  total: number;
+}
+
+export interface CapacityEstimate {
+  cpuSecondsPerRequest: number;
+  cores: number;
+  // Requests per second that keep every core busy
+  cpuCeilingRps: number;
+  // Requests per second an instance sustains within the SLO and the cap
+  maxRps: number;
+  boundBy: "slo" | "utilization";
+  utilizationPct: number;
+  // Latency at maxRps, with an SLO
+  latency?: LatencyEstimate;
+  peakRps?: number;
+  replicas?: number;
+  // Replicas to keep the peak within limits with one instance down
+  replicasWithSpare?: number;
+}
+
+// Probability that a request waits for a core, in an M/M/c queue with c
+// cores and an offered load of a cores' worth of work (a < c). Erlang B's
+// recurrence keeps large core counts from overflowing.
+export function erlangC(c: number, a: number): number {
+  let b = 1;
+  for (let k = 1; k <= c; k++) {
+    b = (a * b) / (k + a * b);
+  }
+  return (c * b) / (c - a * (1 - b));
+}
+
+// Latency at a percentile with requests arriving at rps: CPU and off-CPU
+// time plus the wait for a core that all but 1 - quantile of requests stay under
+export function latencyAt(rps: number, input: CapacityInput & { slo: NonNullable<CapacityInput["slo"]> }): LatencyEstimate {
+  const { cpuSecondsPerRequest: service, cores, slo } = input;
+  const load = rps * service;
+  const tail = 1 - QUANTILES[slo.percentile];
+  let queueing = load >= cores ? Infinity : 0;
+  if (load > 0 && load < cores) {
+    const waits = erlangC(cores, load);
+    // P(wait > t) = C·e^(-(c/S - λ)t)
+    queueing = waits > tail ? Math.log(waits / tail) / (cores / service - rps) : 0;
+  }
+  return { percentile: slo.percentile, cpu: service, offCpu: slo.offCpuSeconds, queueing, total: service + slo.offCpuSeconds + queueing };
+}
+
+export function estimateCapacity(input: CapacityInput): CapacityEstimate {
+  const { cpuSecondsPerRequest, cores, maxUtilization, slo, peakRps } = input;
+  if (!(cpuSecondsPerRequest > 0)) {
+    throw new Error("The CPU cost per request must be above zero");
+  }
+  const cpuCeilingRps = cores / cpuSecondsPerRequest;
+  let maxRps = cpuCeilingRps * maxUtilization;
+  let boundBy: CapacityEstimate["boundBy"] = "utilization";
+  if (slo) {
+    const within = (rps: number) => latencyAt(rps, { ...input, slo }).total <= slo.targetSeconds;
+    if (!within(0)) {
+      throw new Error(
+        `The SLO cannot be met at any load: a request takes ${Math.round((cpuSecondsPerRequest + slo.offCpuSeconds) * 1e5) / 100}ms ` +
+        `(CPU and off-CPU time) before it waits at all, against a ${slo.percentile} target of ${Math.round(slo.targetSeconds * 1e5) / 100}ms`,
+      );
+    }
+    if (!within(maxRps)) {
+      let low = 0;
+      let high = maxRps;
+      for (let i = 0; i < SEARCH_STEPS; i++) {
+        const mid = (low + high) / 2;
+        if (within(mid)) {
+          low = mid;
+        } else {
+          high = mid;
+        }
+      }
+      maxRps = low;
+      boundBy = "slo";
+    }
+  }
+  maxRps = Math.floor(maxRps * 10) / 10;
+  const estimate: CapacityEstimate = {
+    cpuSecondsPerRequest,
+    cores,
+    cpuCeilingRps: Math.round(cpuCeilingRps * 10) / 10,
+    maxRps,
+    boundBy,
+    utilizationPct: Math.round(((maxRps * cpuSecondsPerRequest) / cores) * 1000) / 10,
+    latency: slo ? latencyAt(maxRps, { ...input, slo }) : undefined,
+  };
+  if (peakRps !== undefined && maxRps > 0) {
+    const replicas = Math.max(1, Math.ceil(peakRps / maxRps));
+    Object.assign(estimate, { peakRps, replicas, replicasWithSpare: replicas + 1 });
+  }
+  return estimate;
+}
+
+// What an estimate takes for granted, for its readers to check against their
+// service
+export function capacityAssumptions(input: CapacityInput, source: string): string[] {
+  return [
+    `A request costs ${Math.round(input.cpuSecondsPerRequest * 1e5) / 100}ms of CPU (${source}), the same at any load; GC work grows with the heap, so re-measure at the load you plan for.`,
+    `Each instance gets all ${input.cores} core(s) (GOMAXPROCS ${input.cores}, no CPU throttling from a container limit) and CPU is its bottleneck; memory, connection pools, locks and downstream services are not modelled.`,
+    "A request runs on one core at a time; requests that spread their work across goroutines finish sooner than estimated.",
+    "Requests arrive independently (Poisson) and their CPU time varies exponentially around the mean (M/M/c), which overstates queueing for uniform requests and understates it for bursty traffic.",
+    `Planning stops at ${Math.round(input.maxUtilization * 100)}% CPU, leaving the rest as headroom for bursts and failover.`,
+    ...(input.slo ? [`Requests also spend ${Math.round(input.slo.offCpuSeconds * 1e5) / 100}ms off CPU (I/O, downstream calls), which adds to latency but holds no core.`] : []),
+    ...(input.peakRps !== undefined ? ["Load balancing spreads the peak evenly across replicas."] : []),
+  ];
+}
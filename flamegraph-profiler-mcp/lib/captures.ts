@@ -0,0 +1,72 @@
+/**
+ * Capture history: a summary of every profile captured, for trends and the dashboard.
+ */
+import { randomBytes } from "node:crypto";
+import type { Series } from "./charts.js";
+import { readJson, updateJson } from "./store.js";
+
+export interface Capture {
+  id: string;
+  at: string;
+  // Go source file or live pprof address the capture came from
+  target: string;
+  // Git commit of the profiled code, when known
+  commit?: string;
+  // cpu, heap, block, mutex, goroutine or trace
+  profileType: string;
+  // Capture window in seconds
+  duration: number;
+  // Total in the base unit: CPU or delay seconds, in-use bytes, or goroutines
+  // (peak live goroutines for traces)
+  total: number;
+  unit: "seconds" | "bytes" | "count";
+  topFunctions: Array<{ name: string; percentage: number }>;
+  // Anti-patterns or suspicious goroutine groups detected
+  issues: number;
+  // GC metrics from execution traces, times in seconds
+  gc?: { cycles: number; markTime: number; stopTheWorld: number; maxPause: number };
+}
+
+const CAPTURES_FILE = "captures.json";
+
+// Oldest captures beyond this are dropped
+const MAX_CAPTURES = 1000;
+
+export async function recordCapture(capture: Omit<Capture, "id" | "at">): Promise<Capture> {
+  const recorded: Capture = {
+    id: `c_${randomBytes(4).toString("hex")}`,
+    at: new Date().toISOString(),
+    ...capture,
+    topFunctions: capture.topFunctions.slice(0, 5),
+  };
+  await updateJson<Capture[], void>(CAPTURES_FILE, [], (all) => {
+    all.push(recorded);
+    all.splice(0, Math.max(0, all.length - MAX_CAPTURES));
+  });
+  return recorded;
+}
+
+// Captures oldest first, optionally for one target
+export async function listCaptures(target?: string): Promise<Capture[]> {
+  const all = await readJson<Capture[]>(CAPTURES_FILE, []);
+  return target ? all.filter((c) => c.target === target) : all;
+}
+
+// Comparable value for trend lines: a rate per second of capture for time
+// totals (e.g. CPU cores in use), and the total itself for bytes and counts
+export function trendValue(capture: Capture): number {
+  return capture.unit === "seconds" && capture.duration > 0 ? capture.total / capture.duration : capture.total;
+}
+
+// Share of the latest capture's top functions across a run of captures of one
+// target and profile type, oldest first
+export function functionTrend(captures: Capture[], limit = 5): Series[] {
+  const latest = captures[captures.length - 1];
+  return (latest?.topFunctions ?? []).slice(0, limit).map((fn) => ({
+    name: fn.name,
+    points: captures.map((c) => ({
+      x: Date.parse(c.at),
+      y: c.topFunctions.find((f) => f.name === fn.name)?.percentage ?? 0,
+    })),
+  }));
+}
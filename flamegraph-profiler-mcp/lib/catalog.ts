@@ -0,0 +1,195 @@
+/**
+ * Profile catalog: every profile captured or imported is stored in the data
+ * directory's profiles/ folder under an ID, with its target, type and
+ * user-supplied labels, so later tools can refer to it by ID.
+ */
+import { randomBytes } from "node:crypto";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { baselineKind, profileCommit, untagCommit } from "./baselines.js";
+import { readProfile, writeProfile, type Profile } from "./pprof.js";
+import { dataDir, readJson, storedProfilePath, updateJson } from "./store.js";
+import { mergeProfiles } from "./transform.js";
+
+export interface CatalogEntry {
+  id: string;
+  at: string;
+  // Go source file, live pprof address, container or pod the profile came from
+  target: string;
+  // cpu, heap, block, mutex or goroutine
+  profileType: string;
+  // Stored pprof file
+  path: string;
+  bytes: number;
+  labels: Record<string, string>;
+  // Git commit of the profiled code, when known
+  commit?: string;
+  // Capture history record, for profiles captured by this server
+  captureId?: string;
+  // Original path, for imported profiles
+  importedFrom?: string;
+  // Client that pushed the profile to /ingest
+  pushedBy?: string;
+  // Catalog IDs or paths of the profiles a merged profile was built from
+  mergedFrom?: string[];
+  // Catalog ID or path of the profile a symbolized profile was resolved from
+  symbolizedFrom?: string;
+  // Catalog ID or path of the profile a redacted copy was made from
+  redactedFrom?: string;
+}
+
+export interface CatalogFilter {
+  target?: string;
+  profileType?: string;
+  // Labels every entry must carry, with these values
+  labels?: Record<string, string>;
+  since?: Date;
+}
+
+const CATALOG_FILE = "catalog.json";
+
+const ID_PATTERN = /^p_[0-9a-f]{8}$/;
+
+export function isProfileId(ref: string): boolean {
+  return ID_PATTERN.test(ref);
+}
+
+// Add a stored profile file to the catalog, captured now unless given an
+// earlier time (as for profiles loaded from a bundle)
+export async function catalogProfile(
+  file: string,
+  details: Omit<CatalogEntry, "id" | "at" | "path" | "bytes" | "labels"> & { labels?: Record<string, string>; at?: string },
+): Promise<CatalogEntry> {
+  const { at, labels, ...rest } = details;
+  const entry: CatalogEntry = {
+    id: `p_${randomBytes(4).toString("hex")}`,
+    at: at ?? new Date().toISOString(),
+    ...rest,
+    path: file,
+    bytes: (await fs.stat(file)).size,
+    labels: labels ?? {},
+  };
+  await updateJson<CatalogEntry[], void>(CATALOG_FILE, [], (all) => {
+    all.push(entry);
+  });
+  return entry;
+}
+
+// Copy a temporary profile file into the store and catalog it
+export async function keepProfile(
+  file: string,
+  name: string,
+  details: Omit<CatalogEntry, "id" | "at" | "path" | "bytes" | "labels"> & { labels?: Record<string, string> },
+): Promise<CatalogEntry> {
+  const stored = await storedProfilePath(name);
+  await fs.copyFile(file, stored);
+  return catalogProfile(stored, details);
+}
+
+// Copy a pprof file from elsewhere into the store and catalog it. The type and
+// commit are read from the profile unless given.
+export async function importProfile(
+  file: string,
+  details: { target?: string; profileType?: string; labels?: Record<string, string> } = {},
+): Promise<CatalogEntry> {
+  const source = path.resolve(file);
+  const profile = readProfile(source);
+  const name = path.basename(source).replace(/\.pb(\.gz)?$|\.pprof$|\.prof$/, "");
+  const stored = await storedProfilePath(name);
+  await fs.copyFile(source, stored);
+  return catalogProfile(stored, {
+    target: details.target ?? source,
+    profileType: details.profileType ?? baselineKind(profile),
+    commit: profileCommit(profile),
+    importedFrom: source,
+    labels: details.labels,
+  });
+}
+
+// Merge profiles of one type, given as catalog IDs or paths, into a new
+// catalogued profile. The target defaults to the inputs' common target; the
+// commit tag is kept only when all inputs were captured at the same commit.
+export async function mergeIntoCatalog(
+  refs: string[],
+  details: { target?: string; labels?: Record<string, string> } = {},
+): Promise<{ entry: CatalogEntry; profile: Profile }> {
+  const all = await readJson<CatalogEntry[]>(CATALOG_FILE, []);
+  const inputs = await Promise.all(refs.map(async (ref) => {
+    const file = await resolveProfilePath(ref);
+    return { ref, entry: all.find((e) => e.path === file), profile: readProfile(file) };
+  }));
+  let merged = mergeProfiles(inputs.map((i) => i.profile));
+  const commits = new Set(inputs.map((i) => profileCommit(i.profile)));
+  if (commits.size > 1) {
+    merged = untagCommit(merged);
+  }
+  const targets = new Set(inputs.map((i) => i.entry?.target));
+  const target = details.target ?? (targets.size === 1 ? [...targets][0] : undefined) ?? "merged";
+  const profileType = baselineKind(merged);
+
+  const stored = await storedProfilePath(target === "merged" ? `merged_${profileType}` : `${path.basename(target, ".go")}_${profileType}_merged`);
+  writeProfile(stored, merged);
+  const entry = await catalogProfile(stored, {
+    target,
+    profileType,
+    commit: profileCommit(merged),
+    mergedFrom: inputs.map((i) => i.entry?.id ?? path.resolve(i.ref)),
+    labels: details.labels,
+  });
+  return { entry, profile: merged };
+}
+
+// Catalog entries, newest first
+export async function listProfiles(filter: CatalogFilter = {}): Promise<CatalogEntry[]> {
+  const all = await readJson<CatalogEntry[]>(CATALOG_FILE, []);
+  return all
+    .filter((e) => !filter.target || e.target === filter.target || e.target.includes(filter.target))
+    .filter((e) => !filter.profileType || e.profileType === filter.profileType)
+    .filter((e) => Object.entries(filter.labels ?? {}).every(([key, value]) => e.labels[key] === value))
+    .filter((e) => !filter.since || new Date(e.at) >= filter.since)
+    .reverse();
+}
+
+export async function getProfile(id: string): Promise<CatalogEntry> {
+  const entry = (await readJson<CatalogEntry[]>(CATALOG_FILE, [])).find((e) => e.id === id);
+  if (!entry) {
+    throw new Error(`No profile ${id} in the catalog; see list_profiles`);
+  }
+  return entry;
+}
+
+// Set and remove labels on a catalog entry
+export async function tagProfile(id: string, set: Record<string, string>, remove: string[] = []): Promise<CatalogEntry> {
+  return updateJson<CatalogEntry[], CatalogEntry>(CATALOG_FILE, [], (all) => {
+    const entry = all.find((e) => e.id === id);
+    if (!entry) {
+      throw new Error(`No profile ${id} in the catalog; see list_profiles`);
+    }
+    for (const key of remove) {
+      delete entry.labels[key];
+    }
+    Object.assign(entry.labels, set);
+    return entry;
+  });
+}
+
+// Remove a catalog entry and its stored file
+export async function deleteProfile(id: string): Promise<CatalogEntry> {
+  const entry = await updateJson<CatalogEntry[], CatalogEntry>(CATALOG_FILE, [], (all) => {
+    const index = all.findIndex((e) => e.id === id);
+    if (index === -1) {
+      throw new Error(`No profile ${id} in the catalog; see list_profiles`);
+    }
+    return all.splice(index, 1)[0];
+  });
+  // Only files the store owns are deleted
+  if (!path.relative(dataDir(), entry.path).startsWith("..")) {
+    await fs.unlink(entry.path).catch(() => undefined);
+  }
+  return entry;
+}
+
+// Resolve a tool's profile argument, a catalog ID or a file path, to a path
+export async function resolveProfilePath(ref: string): Promise<string> {
+  return isProfileId(ref) ? (await getProfile(ref)).path : path.resolve(ref);
+}
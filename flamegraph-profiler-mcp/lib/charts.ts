@@ -0,0 +1,264 @@
+/**
+ * Server-side SVG charts (line, sparkline, bar, flamegraph) for the dashboard,
+ * digest, reports and MCP resources, so no client-side charting library is needed.
+ */
+import { defaultColorScheme, frameColorer, labelColor, type ColorScheme } from "./colors.js";
+
+export interface Point {
+  // Milliseconds since the epoch for time series
+  x: number;
+  y: number;
+}
+
+export interface Series {
+  name: string;
+  points: Point[];
+}
+
+export interface Bar {
+  label: string;
+  value: number;
+}
+
+export interface ChartOptions {
+  width?: number;
+  height?: number;
+  title?: string;
+  formatY?: (value: number) => string;
+  formatX?: (value: number) => string;
+}
+
+const PALETTE = ["#e8590c", "#1971c2", "#2f9e44", "#ae3ec9", "#f08c00", "#0c8599", "#c2255c", "#5c940d"];
+
+const FONT = `font-family="system-ui, sans-serif" font-size="11" fill="#555"`;
+const TITLE_FONT = `font-family="system-ui, sans-serif" font-size="12" font-weight="600" fill="#222"`;
+
+function escapeXml(text: string): string {
+  return text.replace(/[&<>"']/g, (c) => `&#${c.charCodeAt(0)};`);
+}
+
+// Short date label, e.g. "10-17 09:30"
+export function formatTime(ms: number): string {
+  return new Date(ms).toISOString().slice(5, 16).replace("T", " ");
+}
+
+function extent(values: number[]): [number, number] {
+  const min = Math.min(...values);
+  const max = Math.max(...values);
+  return min === max ? [min - 1, max + 1] : [min, max];
+}
+
+// An SVG image, labelled with its title and, for screen readers, described
+// by the text equivalent of what it draws
+function svg(width: number, height: number, title: string | undefined, body: string, description?: string): string {
+  const label = title ? ` aria-label="${escapeXml(title)}"` : "";
+  const heading = title ? `<text x="0" y="12" ${TITLE_FONT}>${escapeXml(title)}</text>` : "";
+  const desc = description ? `<desc>${escapeXml(description)}</desc>` : "";
+  return `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 ${width} ${height}" width="${width}" height="${height}" role="img"${label}>${desc}${heading}${body}</svg>`;
+}
+
+// Line chart with axes, gridlines and a legend for one or more series
+export function lineChart(series: Series[], options: ChartOptions = {}): string {
+  const { width = 480, height = 220, title, formatY = (v) => String(Math.round(v * 100) / 100), formatX = formatTime } = options;
+  const points = series.flatMap((s) => s.points);
+  if (points.length === 0) {
+    return svg(width, height, title, `<text x="${width / 2}" y="${height / 2}" text-anchor="middle" ${FONT}>No data</text>`);
+  }
+
+  const top = title ? 24 : 8;
+  const legendHeight = series.length > 1 ? 16 * Math.ceil(series.length / 2) : 0;
+  const left = 56;
+  const right = width - 12;
+  const bottom = height - 22 - legendHeight;
+  const [minX, maxX] = extent(points.map((p) => p.x));
+  const [, maxY] = extent(points.map((p) => p.y));
+  const minY = Math.min(0, ...points.map((p) => p.y));
+  const scaleX = (x: number) => left + ((x - minX) / (maxX - minX)) * (right - left);
+  const scaleY = (y: number) => bottom - ((y - minY) / (maxY - minY || 1)) * (bottom - top);
+
+  const parts: string[] = [];
+  for (let i = 0; i <= 4; i++) {
+    const value = minY + ((maxY - minY) * i) / 4;
+    const y = scaleY(value).toFixed(1);
+    parts.push(`<line x1="${left}" x2="${right}" y1="${y}" y2="${y}" stroke="#eee"/>`);
+    parts.push(`<text x="${left - 6}" y="${y}" dy="4" text-anchor="end" ${FONT}>${escapeXml(formatY(value))}</text>`);
+  }
+  parts.push(`<line x1="${left}" x2="${right}" y1="${bottom}" y2="${bottom}" stroke="#999"/>`);
+  parts.push(`<text x="${left}" y="${bottom + 14}" ${FONT}>${escapeXml(formatX(minX))}</text>`);
+  parts.push(`<text x="${right}" y="${bottom + 14}" text-anchor="end" ${FONT}>${escapeXml(formatX(maxX))}</text>`);
+
+  series.forEach((s, i) => {
+    const color = PALETTE[i % PALETTE.length];
+    const coords = s.points.map((p) => `${scaleX(p.x).toFixed(1)},${scaleY(p.y).toFixed(1)}`);
+    if (coords.length === 1) {
+      const [x, y] = coords[0].split(",");
+      parts.push(`<circle cx="${x}" cy="${y}" r="3" fill="${color}"/>`);
+    } else {
+      parts.push(`<polyline fill="none" stroke="${color}" stroke-width="2" points="${coords.join(" ")}"/>`);
+    }
+    if (series.length > 1) {
+      const lx = left + (i % 2) * ((right - left) / 2);
+      const ly = bottom + 30 + Math.floor(i / 2) * 16;
+      parts.push(`<rect x="${lx}" y="${ly - 8}" width="10" height="10" fill="${color}"/>`);
+      parts.push(`<text x="${lx + 14}" y="${ly}" ${FONT}>${escapeXml(s.name)}</text>`);
+    }
+  });
+
+  const description = series.filter((s) => s.points.length > 0).map((s) => {
+    const first = s.points[0];
+    const last = s.points[s.points.length - 1];
+    const peak = s.points.reduce((a, b) => (b.y > a.y ? b : a));
+    return `${s.name}: ${formatY(first.y)} at ${formatX(first.x)}, ${formatY(last.y)} at ${formatX(last.x)}, peak ${formatY(peak.y)} at ${formatX(peak.x)}`;
+  }).join("; ");
+  return svg(width, height, title, parts.join(""), description);
+}
+
+// Axis-free trend line for inline use
+export function sparkline(values: number[], options: { width?: number; height?: number; color?: string } = {}): string {
+  const { width = 120, height = 24, color = PALETTE[0] } = options;
+  if (values.length < 2) {
+    return svg(width, height, undefined, "");
+  }
+  const [min, max] = extent(values);
+  const coords = values.map((v, i) => {
+    const x = (i / (values.length - 1)) * width;
+    const y = height - 2 - ((v - min) / (max - min)) * (height - 4);
+    return `${x.toFixed(1)},${y.toFixed(1)}`;
+  });
+  return svg(width, height, undefined, `<polyline fill="none" stroke="${color}" stroke-width="1.5" points="${coords.join(" ")}"/>`);
+}
+
+// Horizontal bar chart, largest first as given
+export function barChart(bars: Bar[], options: ChartOptions = {}): string {
+  const { width = 480, title, formatY = (v) => String(v) } = options;
+  const rowHeight = 20;
+  const top = title ? 24 : 4;
+  const height = options.height ?? top + Math.max(1, bars.length) * rowHeight + 4;
+  const labelWidth = Math.min(220, Math.max(60, ...bars.map((b) => b.label.length * 6.2)));
+  const valueWidth = 70;
+  const max = Math.max(0, ...bars.map((b) => b.value)) || 1;
+  const barSpace = width - labelWidth - valueWidth - 12;
+
+  const parts = bars.map((bar, i) => {
+    const y = top + i * rowHeight;
+    const barWidth = Math.max(1, (Math.max(0, bar.value) / max) * barSpace);
+    const label = bar.label.length > labelWidth / 6.2 ? `…${bar.label.slice(-Math.floor(labelWidth / 6.2) + 1)}` : bar.label;
+    return `<text x="${labelWidth}" y="${y + 13}" text-anchor="end" ${FONT}>${escapeXml(label)}</text>` +
+      `<rect x="${labelWidth + 6}" y="${y + 3}" width="${barWidth.toFixed(1)}" height="${rowHeight - 6}" fill="${PALETTE[0]}"/>` +
+      `<text x="${labelWidth + 10 + barWidth}" y="${y + 13}" ${FONT}>${escapeXml(formatY(bar.value))}</text>`;
+  });
+  if (bars.length === 0) {
+    parts.push(`<text x="${width / 2}" y="${top + 14}" text-anchor="middle" ${FONT}>No data</text>`);
+  }
+  return svg(width, height, title, parts.join(""), bars.map((b) => `${b.label}: ${formatY(b.value)}`).join("; "));
+}
+
+export const BADGE_COLORS = { green: "#4c1", red: "#e05d44", grey: "#9f9f9f" } as const;
+export type BadgeColor = keyof typeof BADGE_COLORS;
+
+// Approximate width of text in 11px Verdana, the font badges are drawn in
+function badgeTextWidth(text: string): number {
+  let width = 0;
+  for (const c of text) {
+    width += /[ilIj.,:;|!'()\[\] ]/.test(c) ? 3.8 : /[mwMW%]/.test(c) ? 10 : /[A-Z0-9+\-]/.test(c) ? 7.4 : 6.6;
+  }
+  return Math.ceil(width);
+}
+
+// Shields-style badge: a grey label and a colored message, e.g. "perf | -3.2% vs baseline",
+// with a tooltip holding the details
+export function badge(label: string, message: string, color: BadgeColor, tooltip?: string): string {
+  const left = badgeTextWidth(label) + 10;
+  const right = badgeTextWidth(message) + 10;
+  const width = left + right;
+  const title = `${label}: ${message}`;
+  const text = (x: number, value: string) =>
+    `<text x="${x}" y="15" fill="#010101" fill-opacity=".3">${escapeXml(value)}</text><text x="${x}" y="14">${escapeXml(value)}</text>`;
+  return `<svg xmlns="http://www.w3.org/2000/svg" width="${width}" height="20" role="img" aria-label="${escapeXml(title)}">` +
+    `<title>${escapeXml(tooltip ? `${title}\n${tooltip}` : title)}</title>` +
+    `<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` +
+    `<clipPath id="r"><rect width="${width}" height="20" rx="3" fill="#fff"/></clipPath>` +
+    `<g clip-path="url(#r)"><rect width="${left}" height="20" fill="#555"/><rect x="${left}" width="${right}" height="20" fill="${BADGE_COLORS[color]}"/><rect width="${width}" height="20" fill="url(#s)"/></g>` +
+    `<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">${text(left / 2, label)}${text(left + right / 2, message)}</g>` +
+    `</svg>`;
+}
+
+export interface FlameFrame {
+  name: string;
+  value: number;
+  // Change against a baseline; colors the frame red (grew) or blue (shrank)
+  delta?: number;
+  children?: FlameFrame[];
+}
+
+// flame draws the root at the bottom and callees above it; icicle draws the root at the top
+export const ORIENTATIONS = ["flame", "icicle"] as const;
+export type Orientation = (typeof ORIENTATIONS)[number];
+
+// Flamegraph, with the root at the bottom or, as an icicle, at the top. Frames
+// narrower than half a pixel are left out; hovering a frame shows its name and
+// share in a tooltip. Schemes other than classic get a legend row under the title.
+// With accessibility, colors come from the scheme's color-blind-safe variant,
+// labels are drawn in whichever of dark or white text contrasts more with their
+// frame, and the description (the tree as text) is embedded for screen readers.
+// Frames that link gives a URL for open it in a new tab when clicked.
+export function flameChart(
+  root: FlameFrame,
+  options: ChartOptions & {
+    formatValue?: (value: number) => string;
+    colorScheme?: ColorScheme;
+    orientation?: Orientation;
+    accessibility?: boolean;
+    description?: string;
+    link?: (frame: FlameFrame) => string | undefined;
+  } = {},
+): string {
+  const { width = 1200, title, formatValue = (v) => String(v), colorScheme = defaultColorScheme(root), orientation = "flame", accessibility = false } = options;
+  const colorer = frameColorer(colorScheme, root, accessibility);
+  const rowHeight = 16;
+  const legendTop = title ? 24 : 4;
+  const top = legendTop + (colorer.legend.length > 0 ? 18 : 0);
+  const total = root.value || 1;
+  const scale = width / total;
+
+  const rows: Array<{ frame: FlameFrame; x: number; depth: number }> = [];
+  let maxDepth = 0;
+  const visit = (frame: FlameFrame, x: number, depth: number) => {
+    if (frame.value * scale < 0.5) return;
+    rows.push({ frame, x, depth });
+    maxDepth = Math.max(maxDepth, depth);
+    let childX = x;
+    for (const child of frame.children ?? []) {
+      visit(child, childX, depth + 1);
+      childX += child.value * scale;
+    }
+  };
+  visit(root, 0, 0);
+
+  const height = options.height ?? top + (maxDepth + 1) * rowHeight + 4;
+  const parts = rows.map(({ frame, x, depth }) => {
+    const y = orientation === "icicle" ? top + depth * rowHeight : height - 4 - (depth + 1) * rowHeight;
+    const w = frame.value * scale;
+    const fill = colorer.color(frame);
+    const share = `${Math.round((frame.value / total) * 10000) / 100}%`;
+    const tooltip = `${frame.name} (${formatValue(frame.value)}, ${share}${frame.delta !== undefined ? `, ${frame.delta >= 0 ? "+" : ""}${formatValue(frame.delta)}` : ""})`;
+    const maxChars = Math.floor((w - 6) / 6.5);
+    const name = `${colorer.marker?.(frame) ?? ""}${frame.name}`;
+    const label = maxChars < 3 ? "" : name.length > maxChars ? `${name.slice(0, maxChars - 1)}…` : name;
+    const ink = accessibility ? labelColor(fill) : "#222";
+    const href = options.link?.(frame);
+    const cell = `<g><title>${escapeXml(tooltip)}</title>` +
+      `<rect x="${x.toFixed(1)}" y="${y}" width="${w.toFixed(1)}" height="${rowHeight - 1}" rx="2" fill="${fill}"/>` +
+      (label ? `<text x="${(x + 3).toFixed(1)}" y="${y + 11}" font-family="monospace" font-size="11" fill="${ink}">${escapeXml(label)}</text>` : "") +
+      "</g>";
+    return href ? `<a href="${escapeXml(href)}" target="_blank">${cell}</a>` : cell;
+  });
+  let legendX = 0;
+  for (const entry of colorer.legend) {
+    if (legendX + 14 + entry.label.length * 6.2 > width) break;
+    parts.push(`<rect x="${legendX}" y="${legendTop + 2}" width="10" height="10" fill="${entry.color}"/>` +
+      `<text x="${legendX + 14}" y="${legendTop + 11}" ${FONT}>${escapeXml(entry.label)}</text>`);
+    legendX += 24 + entry.label.length * 6.2;
+  }
+  return svg(width, height, title, parts.join(""), options.description);
+}
@@ -0,0 +1,101 @@
+/**
+ * Readable names for closures. The Go compiler names function literals after
+ * the function enclosing them and a counter, e.g. main.worker.func1,
+ * main.worker.func1.2 for a nested one, main.worker.gowrap1 for the wrapper
+ * of a `go` statement and main.worker.deferwrap1 for a deferred call. In
+ * callback-heavy code a flamegraph full of func1 and func2 frames says little,
+ * so they are shown as the enclosing function and the line the literal starts
+ * on instead: main.worker (closure at main.go:73).
+ */
+import path from "node:path";
+import type { Frame, Location, Profile } from "./pprof.js";
+
+const CLOSURE_PATTERN = /^(.+?)\.(func|gowrap|deferwrap)\d+((?:\.\d+|\.func\d+)*)$/;
+
+const KINDS: Record<string, string> = {
+  func: "closure",
+  gowrap: "go statement",
+  deferwrap: "defer",
+};
+
+export interface Closure {
+  // Enclosing named function, e.g. main.worker
+  enclosing: string;
+  kind: string;
+}
+
+// Enclosing function and kind of a compiler-generated closure name, or
+// undefined for named functions
+export function closureOf(symbol: string): Closure | undefined {
+  const match = symbol.match(CLOSURE_PATTERN);
+  return match ? { enclosing: match[1], kind: KINDS[match[2]] } : undefined;
+}
+
+// Display name of a frame: closures with a known start line are named by
+// their enclosing function and where they are defined; others keep their name.
+// Profiles from before Go 1.20 record no start lines.
+export function closureName(frame: Frame): string | undefined {
+  const closure = closureOf(frame.symbol ?? frame.name);
+  if (!closure || !frame.startLine) {
+    return undefined;
+  }
+  const where = frame.file ? `${path.basename(frame.file)}:${frame.startLine}` : `line ${frame.startLine}`;
+  return `${closure.enclosing} (${closure.kind} at ${where})`;
+}
+
+function renameFrames(profile: Profile, rename: (frame: Frame) => string | undefined): Profile {
+  const locations = new Map<number, Location>();
+  for (const [id, location] of profile.locations) {
+    const names = location.frames.map(rename);
+    locations.set(id, names.some((n) => n !== undefined)
+      ? { ...location, frames: location.frames.map((f, i) => (names[i] !== undefined ? { ...f, name: names[i], symbol: f.symbol ?? f.name } : f)) }
+      : location);
+  }
+  return { ...profile, locations };
+}
+
+// Rename every closure frame to its display name, keeping the compiler's name
+// as the frame's symbol
+export function nameClosures(profile: Profile): Profile {
+  return renameFrames(profile, closureName);
+}
+
+// Start line of each closure symbol in a profile
+function closureLines(profile: Profile): Map<string, string> {
+  const lines = new Map<string, string>();
+  for (const location of profile.locations.values()) {
+    for (const frame of location.frames) {
+      const symbol = frame.symbol ?? frame.name;
+      if (closureOf(symbol)) {
+        lines.set(symbol, `${frame.file}:${frame.startLine ?? 0}`);
+      }
+    }
+  }
+  return lines;
+}
+
+// Closure names for comparing two profiles. Lines move and func1 becomes func2
+// as the code around a closure changes, so a closure named by line in one
+// build may have no match in the other. Where any closure of a function was
+// defined elsewhere in the two profiles, all closures of that function are
+// grouped as "main.worker (closures)" in both, so their cost is compared as a
+// whole instead of showing one closure vanishing and another appearing.
+export function alignClosures(baseline: Profile, comparison: Profile): [Profile, Profile] {
+  const before = closureLines(baseline);
+  const after = closureLines(comparison);
+  const moved = new Set<string>();
+  for (const [symbol, line] of after) {
+    const previous = before.get(symbol);
+    if (previous !== undefined && previous !== line) {
+      moved.add(closureOf(symbol)!.enclosing);
+    }
+  }
+  if (moved.size === 0) {
+    return [baseline, comparison];
+  }
+  const group = (frame: Frame) => {
+    const closure = closureOf(frame.symbol ?? frame.name);
+    return closure && moved.has(closure.enclosing) ? `${closure.enclosing} (closures)` : undefined;
+  };
+  return [renameFrames(baseline, group), renameFrames(comparison, group)];
+}
@@ -0,0 +1,305 @@
+/**
+ * Flamegraph color schemes: how a frame's fill is chosen in rendered
+ * flamegraphs. Schemes are picked per tool call or per resource URI.
+ */
+import { isStdlib, packageOf } from "./antipatterns.js";
+import type { FlameFrame } from "./charts.js";
+import { isKernelFrame } from "./perf.js";
+
+// classic: warm colors hashed from the function name, native and kernel code apart
+// package: one hue per Go package, so time in crypto/md5 stands out from your code
+// stdlib: your code, the standard library, the runtime, native code, the
+// kernel and unsymbolized frames
+// hot: by self time, from pale yellow (cold) to deep red (hot)
+// diff: red where a frame grew against the baseline, blue where it shrank; only
+// differential flamegraphs carry the deltas it needs
+//
+// Every scheme has an accessible variant for color vision deficiencies: the
+// Okabe-Ito palette for categories, viridis for self time, and orange against
+// blue for diffs, with grown and shrunk frames also marked in their labels.
+export const PROFILE_COLOR_SCHEMES = ["classic", "package", "stdlib", "hot"] as const;
+export const COLOR_SCHEMES = [...PROFILE_COLOR_SCHEMES, "diff"] as const;
+export type ColorScheme = (typeof COLOR_SCHEMES)[number];
+
+export interface LegendEntry {
+  label: string;
+  color: string;
+}
+
+export interface FrameColorer {
+  color(frame: FlameFrame): string;
+  legend: LegendEntry[];
+  // Prefix of a frame's label that says what its color does, e.g. ▲ for a frame that grew
+  marker?(frame: FlameFrame): string;
+}
+
+const NEUTRAL = "hsl(0, 0%, 78%)";
+const USER = "hsl(25, 85%, 58%)";
+const STDLIB = "hsl(150, 45%, 52%)";
+const RUNTIME = "hsl(200, 60%, 55%)";
+const NATIVE = "hsl(320, 55%, 62%)";
+const KERNEL = "hsl(275, 45%, 62%)";
+const UNKNOWN = NEUTRAL;
+
+// Okabe-Ito, distinguishable with every common color vision deficiency
+const SAFE = {
+  orange: "#e69f00",
+  skyBlue: "#56b4e9",
+  green: "#009e73",
+  yellow: "#f0e442",
+  blue: "#0072b2",
+  vermillion: "#d55e00",
+  purple: "#cc79a7",
+  grey: "#bbbbbb",
+};
+const SAFE_CATEGORIES = [SAFE.orange, SAFE.skyBlue, SAFE.green, SAFE.yellow, SAFE.blue, SAFE.vermillion, SAFE.purple];
+
+// Viridis, pale to dark, for self time
+const VIRIDIS = ["#fde725", "#5ec962", "#21918c", "#3b528b", "#440154"];
+
+// Colors of frame kinds in the stdlib scheme, and of native and kernel frames in the others
+interface CodePalette {
+  user: string;
+  stdlib: string;
+  runtime: string;
+  native: string;
+  kernel: string;
+  unknown: string;
+}
+
+const CODE_COLORS: CodePalette = { user: USER, stdlib: STDLIB, runtime: RUNTIME, native: NATIVE, kernel: KERNEL, unknown: UNKNOWN };
+const SAFE_CODE_COLORS: CodePalette = {
+  user: SAFE.orange,
+  stdlib: SAFE.green,
+  runtime: SAFE.skyBlue,
+  native: SAFE.purple,
+  kernel: SAFE.blue,
+  unknown: SAFE.grey,
+};
+
+// Packages named in the package scheme's legend
+const LEGEND_PACKAGES = 8;
+
+function hash(text: string): number {
+  let h = 0;
+  for (const c of text) {
+    h = (h * 31 + c.charCodeAt(0)) >>> 0;
+  }
+  return h;
+}
+
+// Classic warm flamegraph color, stable per function name
+function flameColor(name: string): string {
+  const h = hash(name);
+  return `hsl(${10 + (h % 40)}, ${70 + (h % 20)}%, ${50 + ((h >> 8) % 15)}%)`;
+}
+
+function deltaColor(delta: number, value: number): string {
+  const strength = value === 0 ? 1 : Math.min(1, Math.abs(delta) / value);
+  const lightness = Math.round(92 - strength * 40);
+  return delta >= 0 ? `hsl(0, 75%, ${lightness}%)` : `hsl(215, 75%, ${lightness}%)`;
+}
+
+// Stable, well-spread hue per package
+function packageColor(pkg: string): string {
+  const h = hash(pkg);
+  return `hsl(${(h * 137) % 360}, ${55 + (h % 20)}%, ${55 + ((h >> 8) % 12)}%)`;
+}
+
+// Frames that are bare addresses, as in unsymbolized profiles
+function isUnknown(name: string): boolean {
+  return /^(0x[0-9a-f]+|\?\?|unknown)$/i.test(name);
+}
+
+// C and C++ frames, from cgo or shared libraries: they have no Go package
+// qualifier (GCC's .part.0 and .cold clone suffixes aside), or are C++
+// scoped names. runtime._ExternalCode stands for native code the profiler
+// could not unwind.
+function isNative(name: string): boolean {
+  if (isUnknown(name)) return false;
+  if (name === "runtime._ExternalCode" || name.includes("::")) return true;
+  const base = name.slice(name.lastIndexOf("/") + 1).replace(/(\.(part|cold|constprop|isra|lto_priv)(\.\d+)?)+$/, "");
+  return !base.includes(".");
+}
+
+// Kernel frames of mixed-mode perf profiles, then native code, apart from Go code
+function systemColor(name: string, palette: CodePalette = CODE_COLORS): string | undefined {
+  if (isKernelFrame(name)) return palette.kernel;
+  return isNative(name) ? palette.native : undefined;
+}
+
+function codeColor(name: string, palette: CodePalette): string {
+  if (isUnknown(name)) return palette.unknown;
+  const system = systemColor(name, palette);
+  if (system) return system;
+  if (name.startsWith("runtime.") || name.startsWith("runtime/internal/")) return palette.runtime;
+  return isStdlib(name) ? palette.stdlib : palette.user;
+}
+
+function hexOf(rgb: number[]): string {
+  return `#${rgb.map((c) => Math.round(c).toString(16).padStart(2, "0")).join("")}`;
+}
+
+function rgbOf(hex: string): number[] {
+  return [1, 3, 5].map((i) => parseInt(hex.slice(i, i + 2), 16));
+}
+
+// Viridis at a share between 0 (pale) and 1 (dark)
+function viridis(share: number): string {
+  const at = Math.min(1, Math.max(0, share)) * (VIRIDIS.length - 1);
+  const i = Math.min(Math.floor(at), VIRIDIS.length - 2);
+  const [from, to] = [rgbOf(VIRIDIS[i]), rgbOf(VIRIDIS[i + 1])];
+  return hexOf(from.map((c, k) => c + (to[k] - c) * (at - i)));
+}
+
+// Orange where a frame grew, blue where it shrank, deeper with the change
+function safeDeltaColor(delta: number, value: number): string {
+  const strength = value === 0 ? 1 : Math.min(1, Math.abs(delta) / value);
+  const lightness = Math.round(92 - strength * 50);
+  return delta >= 0 ? `hsl(30, 100%, ${lightness}%)` : `hsl(202, 100%, ${lightness}%)`;
+}
+
+function hotColor(share: number): string {
+  return `hsl(${Math.round(55 * (1 - share))}, ${Math.round(70 + share * 15)}%, ${Math.round(86 - share * 36)}%)`;
+}
+
+function selfOf(frame: FlameFrame): number {
+  return Math.max(0, frame.value - (frame.children ?? []).reduce((sum, c) => sum + c.value, 0));
+}
+
+// Self time per Go package over the tree, below the root
+function packageSelf(root: FlameFrame): Map<string, number> {
+  const totals = new Map<string, number>();
+  const visit = (frame: FlameFrame) => {
+    if (!systemColor(frame.name)) {
+      const pkg = packageOf(frame.name);
+      totals.set(pkg, (totals.get(pkg) ?? 0) + selfOf(frame));
+    }
+    (frame.children ?? []).forEach(visit);
+  };
+  (root.children ?? []).forEach(visit);
+  return totals;
+}
+
+function maxSelf(root: FlameFrame): number {
+  let max = 0;
+  const visit = (frame: FlameFrame) => {
+    max = Math.max(max, selfOf(frame));
+    (frame.children ?? []).forEach(visit);
+  };
+  visit(root);
+  return max;
+}
+
+function hasFrame(root: FlameFrame, test: (name: string) => boolean): boolean {
+  const visit = (frame: FlameFrame): boolean => test(frame.name) || (frame.children ?? []).some(visit);
+  return (root.children ?? []).some(visit);
+}
+
+// Legend entries for the native and kernel frames a tree has
+function systemLegend(root: FlameFrame, palette: CodePalette): LegendEntry[] {
+  return [
+    ...(hasFrame(root, (name) => !isKernelFrame(name) && isNative(name)) ? [{ label: "native code", color: palette.native }] : []),
+    ...(hasFrame(root, isKernelFrame) ? [{ label: "kernel", color: palette.kernel }] : []),
+  ];
+}
+
+// Default scheme for a tree: diff when it carries deltas, else classic
+export function defaultColorScheme(root: FlameFrame): ColorScheme {
+  return root.delta !== undefined ? "diff" : "classic";
+}
+
+// Relative luminance (WCAG) of a #rrggbb or hsl() color
+function luminance(color: string): number {
+  let rgb: number[];
+  const hsl = /^hsl\((\d+(?:\.\d+)?),\s*(\d+(?:\.\d+)?)%,\s*(\d+(?:\.\d+)?)%\)$/.exec(color);
+  if (hsl) {
+    const [h, s, l] = [Number(hsl[1]), Number(hsl[2]) / 100, Number(hsl[3]) / 100];
+    const a = s * Math.min(l, 1 - l);
+    const f = (n: number) => {
+      const k = (n + h / 30) % 12;
+      return 255 * (l - a * Math.max(-1, Math.min(k - 3, 9 - k, 1)));
+    };
+    rgb = [f(0), f(8), f(4)];
+  } else {
+    rgb = rgbOf(color);
+  }
+  const [r, g, b] = rgb.map((c) => {
+    const v = c / 255;
+    return v <= 0.03928 ? v / 12.92 : ((v + 0.055) / 1.055) ** 2.4;
+  });
+  return 0.2126 * r + 0.7152 * g + 0.0722 * b;
+}
+
+// Label color with the better contrast on a fill: near-black, or white on dark fills
+export function labelColor(fill: string): string {
+  const l = luminance(fill);
+  // Contrast against #222 (luminance 0.016) and against white
+  return (l + 0.05) / 0.066 >= 1.05 / (l + 0.05) ? "#222" : "#fff";
+}
+
+// Colorer for a tree in a scheme. The root frame (the whole profile) is drawn
+// neutral in the package and code schemes, since it belongs to no package.
+// The accessible variant gives the top packages distinct Okabe-Ito colors and
+// the rest grey, rather than hashing every package to a hue.
+export function frameColorer(scheme: ColorScheme, root: FlameFrame, accessible = false): FrameColorer {
+  const palette = accessible ? SAFE_CODE_COLORS : CODE_COLORS;
+  const neutral = accessible ? SAFE.grey : NEUTRAL;
+  switch (scheme) {
+    case "package": {
+      const top = [...packageSelf(root).entries()].sort((a, b) => b[1] - a[1])
+        .slice(0, accessible ? SAFE_CATEGORIES.length : LEGEND_PACKAGES);
+      const safe = new Map(top.map(([pkg], i) => [pkg, SAFE_CATEGORIES[i]]));
+      const colorOf = (pkg: string) => (accessible ? safe.get(pkg) ?? neutral : packageColor(pkg));
+      return {
+        color: (frame) => (frame === root || isUnknown(frame.name) ? neutral : systemColor(frame.name, palette) ?? colorOf(packageOf(frame.name))),
+        legend: [
+          ...top.map(([pkg]) => ({ label: pkg, color: colorOf(pkg) })),
+          ...(accessible ? [{ label: "other packages", color: neutral }] : []),
+          ...systemLegend(root, palette),
+        ],
+      };
+    }
+    case "stdlib":
+      return {
+        color: (frame) => (frame === root ? neutral : codeColor(frame.name, palette)),
+        legend: [
+          { label: "your code", color: palette.user },
+          { label: "standard library", color: palette.stdlib },
+          { label: "runtime", color: palette.runtime },
+          { label: "native code", color: palette.native },
+          ...(hasFrame(root, isKernelFrame) ? [{ label: "kernel", color: palette.kernel }] : []),
+          { label: "unsymbolized", color: palette.unknown },
+        ],
+      };
+    case "hot": {
+      const max = maxSelf(root) || 1;
+      const heat = accessible ? viridis : hotColor;
+      return {
+        color: (frame) => heat(selfOf(frame) / max),
+        legend: [
+          { label: "no self time", color: heat(0) },
+          { label: "half the hottest", color: heat(0.5) },
+          { label: "hottest self time", color: heat(1) },
+        ],
+      };
+    }
+    case "diff": {
+      const change = accessible ? safeDeltaColor : deltaColor;
+      return {
+        color: (frame) => (frame.delta !== undefined ? change(frame.delta, frame.value) : neutral),
+        legend: [
+          { label: accessible ? "▲ grew" : "grew", color: change(1, 1) },
+          { label: accessible ? "▼ shrank" : "shrank", color: change(-1, 1) },
+          { label: "unchanged", color: change(0, 1) },
+        ],
+        ...(accessible ? { marker: (frame: FlameFrame) => (frame.delta ? (frame.delta > 0 ? "▲ " : "▼ ") : "") } : {}),
+      };
+    }
+    default:
+      return {
+        color: (frame) => (frame !== root ? systemColor(frame.name, palette) : undefined) ?? flameColor(frame.name),
+        legend: systemLegend(root, palette),
+      };
+  }
+}
@@ -0,0 +1,207 @@
+/**
+ * Server configuration file, loaded once at startup: the live targets the
+ * server may capture from, where captured profiles are kept, limits on
+ * captures and profile sizes, how flamegraphs are drawn by default, and
+ * where findings are exported to.
+ *
+ *   targets:               # pprof addresses live captures may use; * is a wildcard
+ *     - localhost:*
+ *     - "*.internal:6060"
+ *   profileDir: /var/lib/profiler/profiles
+ *   limits:
+ *     maxCaptureSeconds: 60
+ *     maxProfileBytes: 67108864
+ *     maxConcurrentCaptures: 4
+ *     maxCapturesPerTarget: 1
+ *     maxCapturesPerMinute: 6
+ *     captureQueueSeconds: 60
+ *   render:
+ *     colorScheme: package
+ *     orientation: icicle
+ *     inverted: false
+ *     accessibility: false # color-blind-safe colors, flamegraphs also given as text
+ *   sources:               # where flamegraph frames link to
+ *     editor: vscode
+ *     repos:
+ *       - module: github.com/acme/shop
+ *         url: https://github.com/acme/shop
+ *   exporters:             # where findings are sent as they are recorded
+ *     - type: sarif
+ *       file: findings.sarif
+ *
+ * Every key is optional; a server without a config file runs on the defaults.
+ */
+import fs from "node:fs";
+import path from "node:path";
+import type { Severity } from "./antipatterns.js";
+import type { Orientation } from "./charts.js";
+import type { ColorScheme } from "./colors.js";
+import { checkDocument, SERVER_CONFIG_SCHEMA } from "./configschema.js";
+import type { ExporterConfig, ExportWhen } from "./exporters.js";
+import type { FindingKind } from "./findings.js";
+import type { FlamegraphLayout } from "./render.js";
+import type { SourceLinkConfig } from "./sourcelinks.js";
+import { pprofAddress } from "./target.js";
+import { parseYaml } from "./yaml.js";
+
+export const CONFIG_FILE = "config.yaml";
+
+export interface ServerConfig {
+  // File the config was loaded from; undefined when running on the defaults
+  source?: string;
+  // pprof addresses (host:port patterns) live captures may target; empty allows any
+  targets: string[];
+  // Directory captured and pushed profiles are kept in; profiles/ in the data directory when unset
+  profileDir?: string;
+  limits: {
+    // Longest capture window or program run a tool may ask for
+    maxCaptureSeconds: number;
+    // Largest profile file read or accepted at /ingest
+    maxProfileBytes: number;
+    // Captures running at once, across all targets
+    maxConcurrentCaptures: number;
+    // Captures running at once against one target
+    maxCapturesPerTarget: number;
+    // Captures started against one target in any minute; 0 for no limit
+    maxCapturesPerMinute: number;
+    // How long a capture waits for its turn before failing; 0 fails at once
+    captureQueueSeconds: number;
+  };
+  // Flamegraph layout when a call does not choose one; checked by checkLayout in render.ts
+  render: FlamegraphLayout;
+  // Editor and repositories flamegraph frames link to; checked by checkSourceLinkConfig in sourcelinks.ts
+  sources: SourceLinkConfig;
+  // Destinations findings are sent to; checked by checkExporterConfig in exporters.ts
+  exporters: ExporterConfig[];
+}
+
+export const DEFAULT_CONFIG: ServerConfig = {
+  targets: [],
+  limits: {
+    maxCaptureSeconds: 300,
+    maxProfileBytes: 64 * 1024 * 1024,
+    maxConcurrentCaptures: 4,
+    maxCapturesPerTarget: 1,
+    maxCapturesPerMinute: 0,
+    captureQueueSeconds: 60,
+  },
+  render: {},
+  sources: { repos: [] },
+  exporters: [],
+};
+
+let active: ServerConfig = DEFAULT_CONFIG;
+
+// The configuration in effect
+export function serverConfig(): ServerConfig {
+  return active;
+}
+
+export function parseServerConfig(text: string, source = CONFIG_FILE): ServerConfig {
+  const positions = new Map<string, number>();
+  const doc = (parseYaml(text, source, positions) ?? {}) as Record<string, any>;
+  checkDocument(doc, SERVER_CONFIG_SCHEMA, source, positions);
+  // Keys left out or left empty take their defaults
+  const limits = doc.limits ?? {};
+  const limit = (name: keyof ServerConfig["limits"]): number => limits[name] ?? DEFAULT_CONFIG.limits[name];
+  const render = doc.render ?? {};
+  const sources = doc.sources ?? {};
+  const optional = (value: unknown) => (value === null ? undefined : (value as string | undefined));
+  const profileDir = optional(doc.profileDir);
+  return {
+    source,
+    targets: [doc.targets ?? []].flat(),
+    profileDir: profileDir && path.resolve(path.dirname(source), profileDir),
+    limits: {
+      maxCaptureSeconds: limit("maxCaptureSeconds"),
+      maxProfileBytes: limit("maxProfileBytes"),
+      maxConcurrentCaptures: limit("maxConcurrentCaptures"),
+      maxCapturesPerTarget: limit("maxCapturesPerTarget"),
+      maxCapturesPerMinute: limit("maxCapturesPerMinute"),
+      captureQueueSeconds: limit("captureQueueSeconds"),
+    },
+    render: {
+      color: optional(render.colorScheme) as ColorScheme | undefined,
+      orientation: optional(render.orientation) as Orientation | undefined,
+      inverted: render.inverted ?? undefined,
+      accessibility: render.accessibility ?? undefined,
+    },
+    sources: {
+      editor: optional(sources.editor),
+      repos: (sources.repos ?? []).map((repo: Record<string, string | null>) => ({
+        module: optional(repo.module),
+        path: optional(repo.path),
+        url: repo.url!,
+        ref: optional(repo.ref),
+        dir: optional(repo.dir),
+      })),
+    },
+    exporters: (doc.exporters ?? []).map(exporterConfigOf),
+  };
+}
+
+// An exporters entry of the config file: its filters, and the rest as the
+// settings of its type
+export function exporterConfigOf({ type, kinds, minSeverity, when, ...settings }: Record<string, unknown>): ExporterConfig {
+  return {
+    type: type as string,
+    kinds: (kinds ?? undefined) as FindingKind[] | undefined,
+    minSeverity: (minSeverity ?? undefined) as Severity | undefined,
+    when: (when ?? undefined) as ExportWhen | undefined,
+    settings,
+  };
+}
+
+// Load and activate the config file. A missing file leaves the defaults in
+// effect unless it was asked for explicitly.
+export function loadServerConfig(file: string, required = false): ServerConfig {
+  let text: string;
+  try {
+    text = fs.readFileSync(file, "utf-8");
+  } catch (error) {
+    if (!required && (error as NodeJS.ErrnoException).code === "ENOENT") {
+      return active;
+    }
+    throw error;
+  }
+  active = parseServerConfig(text, path.resolve(file));
+  return active;
+}
+
+// Fail unless the config allows live captures from this pprof address
+export function checkTarget(target: string): void {
+  const { targets } = active;
+  if (targets.length === 0) {
+    return;
+  }
+  const address = pprofAddress(target);
+  const allowed = targets.some((pattern) => {
+    // A URL counts as its host:port, and a host without a port allows any port
+    const glob = pattern.replace(/^https?:\/\//, "").replace(/\/.*$/, "");
+    const withPort = /:[\d*]+$/.test(glob) ? glob : `${glob}:*`;
+    return new RegExp(`^${withPort.replace(/[.+?^${}()|[\]\\]/g, "\\$&").replace(/\*/g, ".*")}$`).test(address);
+  });
+  if (!allowed) {
+    throw new Error(`Target ${address} is not in the configured targets (${targets.join(", ")})`);
+  }
+}
+
+// Fail if a capture window or run is longer than the config allows
+export function checkCaptureSeconds(seconds: number): void {
+  const { maxCaptureSeconds } = active.limits;
+  if (seconds > maxCaptureSeconds) {
+    throw new Error(`${seconds}s is longer than the configured maximum capture of ${maxCaptureSeconds}s`);
+  }
+}
+
+// A profile over the configured maximum size
+export class ProfileTooLargeError extends Error {}
+
+// Fail if a profile file is larger than the config allows
+export function checkProfileSize(bytes: number, what = "Profile"): void {
+  const { maxProfileBytes } = active.limits;
+  if (bytes > maxProfileBytes) {
+    throw new ProfileTooLargeError(`${what} is ${bytes} bytes, over the configured maximum of ${maxProfileBytes}`);
+  }
+}
+
@@ -0,0 +1,387 @@
+/**
+ * Schemas of the files the server and its tools read: the server config,
+ * .perfbudgets.yaml, targets.yaml with its scenarios, and suppressions.json.
+ * Validation is strict, so a misspelled key is an error rather than ignored,
+ * and reports every problem with its path and the line it is on.
+ */
+import { parseYaml, pathOf } from "./yaml.js";
+
+export type Schema =
+  | { type: "string"; enum?: readonly string[]; pattern?: RegExp; expected?: string; date?: boolean }
+  // min is inclusive, above exclusive
+  | { type: "number"; min?: number; above?: number; max?: number; integer?: boolean }
+  | { type: "boolean" }
+  // unique names a key of the items no two items may share a value of
+  | { type: "list"; items: Schema; unique?: string }
+  // open mappings take keys beyond their fields, checked elsewhere
+  | { type: "map"; fields: Record<string, Schema>; required?: string[]; exactlyOne?: string[]; anyOf?: string[]; open?: boolean }
+  | { type: "either"; of: Schema[]; expected: string };
+
+export interface ValidationIssue {
+  // Path of the offending value, e.g. budgets[0].max; empty for the document
+  path: string;
+  // 1-based line, when known
+  line?: number;
+  message: string;
+}
+
+function describe(schema: Schema): string {
+  switch (schema.type) {
+    case "string":
+      return schema.expected ?? "a string";
+    case "number":
+      return schema.integer ? "a whole number" : "a number";
+    case "boolean":
+      return "true or false";
+    case "list":
+      return "a list";
+    case "map":
+      return "a mapping";
+    case "either":
+      return schema.expected;
+  }
+}
+
+function typeOf(value: unknown): string {
+  return value === null ? "null" : Array.isArray(value) ? "a list" : typeof value === "object" ? "a mapping" : `a ${typeof value}`;
+}
+
+const present = (value: unknown) => value !== undefined && value !== null;
+
+function check(value: unknown, schema: Schema, path: string, issues: ValidationIssue[]): void {
+  const issue = (message: string, at = path) => issues.push({ path: at, message });
+  switch (schema.type) {
+    case "string":
+      if (typeof value !== "string") {
+        issue(`expected ${describe(schema)}, got ${typeOf(value)}`);
+      } else if (schema.enum && !schema.enum.includes(value)) {
+        issue(`must be one of ${schema.enum.join(", ")} (got ${JSON.stringify(value)})`);
+      } else if (schema.pattern && !schema.pattern.test(value)) {
+        issue(`must be ${schema.expected} (got ${JSON.stringify(value)})`);
+      } else if (schema.date && Number.isNaN(new Date(value).getTime())) {
+        issue(`must be a date, e.g. 2026-12-31 (got ${JSON.stringify(value)})`);
+      }
+      return;
+    case "number":
+      if (typeof value !== "number" || !Number.isFinite(value)) {
+        issue(`expected ${describe(schema)}, got ${typeOf(value)}`);
+      } else if (schema.integer && !Number.isInteger(value)) {
+        issue(`must be a whole number (got ${value})`);
+      } else if (schema.min !== undefined && value < schema.min) {
+        issue(`must be at least ${schema.min} (got ${value})`);
+      } else if (schema.above !== undefined && value <= schema.above) {
+        issue(`must be greater than ${schema.above} (got ${value})`);
+      } else if (schema.max !== undefined && value > schema.max) {
+        issue(`must be at most ${schema.max} (got ${value})`);
+      }
+      return;
+    case "boolean":
+      if (typeof value !== "boolean") {
+        issue(`expected true or false, got ${typeOf(value)}`);
+      }
+      return;
+    case "list": {
+      if (!Array.isArray(value)) {
+        issue(`expected a list, got ${typeOf(value)}`);
+        return;
+      }
+      const seen = new Map<unknown, number>();
+      value.forEach((item, i) => {
+        check(item, schema.items, pathOf(path, i), issues);
+        const key = schema.unique && item && typeof item === "object" ? (item as Record<string, unknown>)[schema.unique] : undefined;
+        if (present(key)) {
+          if (seen.has(key)) {
+            issue(`duplicate ${schema.unique} ${JSON.stringify(key)} (also at ${pathOf(path, seen.get(key)!)})`, pathOf(pathOf(path, i), schema.unique!));
+          } else {
+            seen.set(key, i);
+          }
+        }
+      });
+      return;
+    }
+    case "map": {
+      if (!value || typeof value !== "object" || Array.isArray(value)) {
+        issue(`expected a mapping, got ${typeOf(value)}`);
+        return;
+      }
+      const map = value as Record<string, unknown>;
+      const known = Object.keys(schema.fields);
+      for (const [key, field] of Object.entries(map)) {
+        if (key in schema.fields) {
+          // An empty value ("key:") counts as leaving the key out
+          if (present(field)) check(field, schema.fields[key], pathOf(path, key), issues);
+        } else if (!schema.open) {
+          issue(`unknown key (expected ${known.join(", ")})`, pathOf(path, key));
+        }
+      }
+      for (const key of schema.required ?? []) {
+        if (!present(map[key])) issue(`missing ${key}`);
+      }
+      if (schema.exactlyOne && schema.exactlyOne.filter((key) => present(map[key])).length !== 1) {
+        issue(`set exactly one of ${schema.exactlyOne.join(", ")}`);
+      }
+      if (schema.anyOf && !schema.anyOf.some((key) => present(map[key]))) {
+        issue(`needs at least one of ${schema.anyOf.join(", ")}`);
+      }
+      return;
+    }
+    case "either":
+      if (!schema.of.some((option) => {
+        const attempt: ValidationIssue[] = [];
+        check(value, option, path, attempt);
+        return attempt.length === 0;
+      })) {
+        issue(`must be ${schema.expected}`);
+      }
+      return;
+  }
+}
+
+// Line of a path, or of its nearest ancestor with a known line
+export function lineOf(path: string, positions: Map<string, number>): number | undefined {
+  for (let at = path; ; at = at.replace(/(?:\.[\w-]+|\[[^\]]*\])$/, "")) {
+    if (positions.has(at)) return positions.get(at);
+    if (at === "") return undefined;
+  }
+}
+
+// Every way a document departs from its schema, with lines from the
+// positions its parser recorded
+export function validateDocument(value: unknown, schema: Schema, positions: Map<string, number> = new Map()): ValidationIssue[] {
+  const issues: ValidationIssue[] = [];
+  // An empty document is an empty mapping
+  check(value ?? (schema.type === "map" ? {} : value), schema, "", issues);
+  return issues
+    .map((issue) => ({ ...issue, line: lineOf(issue.path, positions) }))
+    .sort((a, b) => (a.line ?? 0) - (b.line ?? 0));
+}
+
+export function formatIssue(source: string, issue: ValidationIssue): string {
+  return `${source}${issue.line ? `:${issue.line}` : ""}: ${issue.path ? `${issue.path}: ` : ""}${issue.message}`;
+}
+
+// Fail with every issue of a document, one per line
+export function checkDocument(value: unknown, schema: Schema, source: string, positions?: Map<string, number>): void {
+  const issues = validateDocument(value, schema, positions);
+  if (issues.length > 0) {
+    throw new Error(issues.map((issue) => formatIssue(source, issue)).join("\n"));
+  }
+}
+
+// Parse JSON, recording the line of every key and array item by its path as
+// parseYaml does. Errors name the line, which JSON.parse does not.
+export function parseJson(text: string, source = "JSON", positions?: Map<string, number>): unknown {
+  let i = 0;
+  let line = 1;
+  const fail = (message: string) => new Error(`${source}:${line}: ${message}`);
+  const space = () => {
+    for (; i < text.length && /\s/.test(text[i]); i++) {
+      if (text[i] === "\n") line++;
+    }
+  };
+  const string = (): string => {
+    const start = i++;
+    for (; i < text.length && text[i] !== '"'; i++) {
+      if (text[i] === "\n") throw fail("unterminated string");
+      if (text[i] === "\\") i++;
+    }
+    if (i++ >= text.length) throw fail("unterminated string");
+    try {
+      return JSON.parse(text.slice(start, i)) as string;
+    } catch {
+      throw fail(`invalid string ${text.slice(start, i)}`);
+    }
+  };
+  const LITERAL = /true|false|null|-?(?:0|[1-9]\d*)(?:\.\d+)?(?:[eE][-+]?\d+)?/y;
+  const value = (path: string): unknown => {
+    space();
+    positions?.set(path, positions.get(path) ?? line);
+    if (text[i] === "{" || text[i] === "[") {
+      const isMap = text[i++] === "{";
+      const close = isMap ? "}" : "]";
+      const result: Record<string, unknown> | unknown[] = isMap ? {} : [];
+      space();
+      if (text[i] === close) {
+        i++;
+        return result;
+      }
+      for (;;) {
+        space();
+        if (isMap) {
+          if (text[i] !== '"') throw fail("expected a key in double quotes");
+          const key = string();
+          if (Object.hasOwn(result, key)) throw fail(`duplicate key ${JSON.stringify(key)}`);
+          positions?.set(pathOf(path, key), line);
+          space();
+          if (text[i++] !== ":") throw fail(`expected ":" after ${JSON.stringify(key)}`);
+          (result as Record<string, unknown>)[key] = value(pathOf(path, key));
+        } else {
+          const items = result as unknown[];
+          items.push(value(pathOf(path, items.length)));
+        }
+        space();
+        const c = text[i++];
+        if (c === close) return result;
+        if (c !== ",") throw fail(`expected "," or "${close}"`);
+      }
+    }
+    if (text[i] === '"') return string();
+    LITERAL.lastIndex = i;
+    const match = LITERAL.exec(text);
+    if (!match) throw fail(i >= text.length ? "unexpected end of file" : `unexpected ${JSON.stringify(text[i])}`);
+    i += match[0].length;
+    return JSON.parse(match[0]);
+  };
+  const result = value("");
+  space();
+  if (i < text.length) throw fail("unexpected content after the document");
+  return result;
+}
+
+// Parse a YAML or JSON config file by its extension
+export function parseConfigText(text: string, source: string, positions?: Map<string, number>): unknown {
+  return source.endsWith(".json") ? parseJson(text, source, positions) : parseYaml(text, source, positions);
+}
+
+const NAME: Schema = { type: "string" };
+const FLAG: Schema = { type: "boolean" };
+const STRINGS: Schema = { type: "either", of: [NAME, { type: "list", items: NAME }], expected: "a name or a list of names" };
+
+// config.yaml; names a registry or another module checks (color schemes,
+// editors, exporter types and settings) are plain strings here
+export const SERVER_CONFIG_SCHEMA: Schema = {
+  type: "map",
+  fields: {
+    targets: { type: "either", of: [NAME, { type: "list", items: NAME }], expected: "an address pattern or a list of them" },
+    profileDir: NAME,
+    limits: {
+      type: "map",
+      fields: {
+        maxCaptureSeconds: { type: "number", above: 0 },
+        maxProfileBytes: { type: "number", above: 0 },
+        maxConcurrentCaptures: { type: "number", above: 0, integer: true },
+        maxCapturesPerTarget: { type: "number", above: 0, integer: true },
+        maxCapturesPerMinute: { type: "number", min: 0, integer: true },
+        captureQueueSeconds: { type: "number", min: 0 },
+      },
+    },
+    render: {
+      type: "map",
+      fields: { colorScheme: NAME, orientation: NAME, inverted: FLAG, accessibility: FLAG },
+    },
+    sources: {
+      type: "map",
+      fields: {
+        editor: NAME,
+        repos: {
+          type: "list",
+          items: {
+            type: "map",
+            fields: { module: NAME, path: NAME, url: NAME, ref: NAME, dir: NAME },
+            required: ["url"],
+            exactlyOne: ["module", "path"],
+          },
+        },
+      },
+    },
+    exporters: {
+      type: "list",
+      items: {
+        type: "map",
+        fields: { type: NAME, kinds: { type: "list", items: NAME }, minSeverity: NAME, when: NAME },
+        required: ["type"],
+        open: true,
+      },
+    },
+  },
+};
+
+// .perfbudgets.yaml
+export const BUDGETS_SCHEMA: Schema = {
+  type: "map",
+  fields: {
+    budgets: {
+      type: "list",
+      items: {
+        type: "map",
+        fields: {
+          package: NAME,
+          function: NAME,
+          max: {
+            type: "either",
+            of: [{ type: "number", min: 0, max: 100 }, { type: "string", pattern: /^(?:100(?:\.0*)?|\d{1,2}(?:\.\d*)?)%$/ }],
+            expected: "a percentage from 0 to 100 (e.g. 15%)",
+          },
+          sampleType: NAME,
+          measure: { type: "string", enum: ["cum", "flat"] },
+          scenario: NAME,
+          owners: STRINGS,
+          description: NAME,
+        },
+        required: ["max"],
+        exactlyOne: ["package", "function"],
+      },
+    },
+  },
+  required: ["budgets"],
+};
+
+export const SCENARIO_PROFILE_TYPES = ["cpu", "heap", "block", "mutex", "goroutine"] as const;
+
+// A profile to capture from a target, as discover_services writes them
+export const SCENARIO_SCHEMA: Schema = {
+  type: "map",
+  fields: {
+    name: NAME,
+    profileType: { type: "string", enum: SCENARIO_PROFILE_TYPES },
+    // Seconds to capture CPU for
+    duration: { type: "number", above: 0 },
+  },
+  required: ["name", "profileType"],
+};
+
+// targets.yaml
+export const TARGETS_SCHEMA: Schema = {
+  type: "map",
+  fields: {
+    targets: {
+      type: "list",
+      unique: "name",
+      items: {
+        type: "map",
+        fields: {
+          name: NAME,
+          package: NAME,
+          importPath: NAME,
+          dockerfile: NAME,
+          container: NAME,
+          pprof: { type: "string", pattern: /^(?:https?:\/\/)?[^\s/]*:\d+(?:\/\S*)?$/, expected: "a host:port address, e.g. localhost:6060" },
+          scenarios: { type: "list", items: SCENARIO_SCHEMA, unique: "name" },
+        },
+        required: ["name"],
+        anyOf: ["package", "container", "pprof"],
+      },
+    },
+  },
+  required: ["targets"],
+};
+
+// suppressions.json in the data directory, as add_suppression writes it
+export const SUPPRESSIONS_SCHEMA: Schema = {
+  type: "list",
+  unique: "id",
+  items: {
+    type: "map",
+    fields: {
+      id: NAME,
+      function: NAME,
+      file: NAME,
+      justification: NAME,
+      expires: { type: "string", date: true },
+      author: NAME,
+      createdAt: { type: "string", date: true },
+    },
+    required: ["id", "justification", "author", "createdAt"],
+    anyOf: ["function", "file"],
+  },
+};
@@ -0,0 +1,92 @@
+/**
+ * Contention analysis for block and mutex profiles.
+ */
+import path from "node:path";
+import { isStdlib } from "./antipatterns.js";
+import { percentOf } from "./flamegraph.js";
+import { formatValue, sampleIndexOf, totalOf, type Frame, type Profile } from "./pprof.js";
+import { filterSamples } from "./transform.js";
+
+export interface ContentionSite {
+  // Innermost user-code frame waiting on (or holding) the primitive
+  function: string;
+  file: string;
+  line: number;
+  // Synchronization primitive at the leaf, e.g. runtime.chanrecv1 or sync.(*Mutex).Lock
+  primitive: string;
+  contentions: number;
+  // Delay in the profile's delay unit (nanoseconds for Go)
+  delay: number;
+  percentage: number;
+}
+
+export interface ContentionReport {
+  unit: string;
+  totalDelay: number;
+  totalContentions: number;
+  sites: ContentionSite[];
+}
+
+// Check that a profile carries contention sample types
+export function isContentionProfile(profile: Profile): boolean {
+  return ["contentions", "delay"].every((type) => profile.sampleTypes.some((t) => t.type === type));
+}
+
+// Drop samples recorded inside the net/http/pprof handlers themselves, such as
+// the handler waiting out the capture window of a delta profile
+export function withoutProfilerSamples(profile: Profile): Profile {
+  return filterSamples(profile, (_, frames) => !frames.some((frame) => frame.name.startsWith("net/http/pprof.")));
+}
+
+// Rank the code sites that waited longest, grouped by function, line and primitive
+export function contentionSites(profile: Profile, limit = 10): ContentionReport {
+  const delayIndex = sampleIndexOf(profile, "delay");
+  const countIndex = sampleIndexOf(profile, "contentions");
+
+  const sites = new Map<string, ContentionSite>();
+  for (const sample of profile.samples) {
+    // Frames innermost first
+    const frames: Frame[] = sample.locationIds.flatMap((id) => profile.locations.get(id)?.frames ?? []);
+    if (frames.length === 0) {
+      continue;
+    }
+    const site = frames.find((frame) => !isStdlib(frame.name)) ?? frames[0];
+    const key = `${site.name}:${site.file}:${site.line}:${frames[0].name}`;
+    let entry = sites.get(key);
+    if (!entry) {
+      entry = {
+        function: site.name,
+        file: site.file,
+        line: site.line,
+        primitive: frames[0].name,
+        contentions: 0,
+        delay: 0,
+        percentage: 0,
+      };
+      sites.set(key, entry);
+    }
+    entry.contentions += sample.values[countIndex];
+    entry.delay += sample.values[delayIndex];
+  }
+
+  const totalDelay = totalOf(profile, delayIndex);
+  return {
+    unit: profile.sampleTypes[delayIndex].unit,
+    totalDelay,
+    totalContentions: totalOf(profile, countIndex),
+    sites: [...sites.values()]
+      .sort((a, b) => b.delay - a.delay)
+      .slice(0, limit)
+      .map((site) => ({ ...site, percentage: percentOf(site.delay, totalDelay) })),
+  };
+}
+
+// Format the top contention sites for tool output
+export function formatContention(report: ContentionReport): string {
+  const lines = report.sites.map((site, i) =>
+    `${i + 1}. ${site.function} (${path.basename(site.file)}:${site.line}) on ${site.primitive}: ` +
+    `${formatValue(site.delay, report.unit)} (${site.percentage}%), ${site.contentions} events`,
+  );
+  return `⏳ Contention Sites (total ${formatValue(report.totalDelay, report.unit)} over ${report.totalContentions} events):
+${lines.length > 0 ? lines.join("\n") : "No contention recorded"}`;
+}
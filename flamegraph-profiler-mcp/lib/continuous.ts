@@ -0,0 +1,364 @@
+/**
+ * Continuous profiling: periodic CPU and heap snapshots of configured live
+ * targets, kept for a retention period and compared window against window.
+ *
+ * Snapshots are stored as <data dir>/continuous/<target>/<type>_<epoch ms>.pb.gz.
+ */
+import fs from "node:fs/promises";
+import path from "node:path";
+import { detectAnomalies, recordAnomalies, type AnomalyReport } from "./anomalies.js";
+import { recordCapture } from "./captures.js";
+import { diffProfiles, type DiffResult } from "./diff.js";
+import { topFunctionsOf } from "./flamegraph.js";
+import { withCaptureSlot } from "./limits.js";
+import { exportToOtlp, otlpConfig } from "./otlp.js";
+import { readProfile, sampleIndexOf, toBaseUnit, totalOf } from "./pprof.js";
+import { pushToPyroscope, pyroscopeConfig } from "./pyroscope.js";
+import { dataDir } from "./store.js";
+import { downloadProfile, pprofAddress } from "./target.js";
+import { mergeProfiles } from "./transform.js";
+
+export const CONTINUOUS_TYPES = ["cpu", "heap"] as const;
+export type ContinuousType = (typeof CONTINUOUS_TYPES)[number];
+
+export interface ContinuousTarget {
+  name: string;
+  // host:port or URL serving net/http/pprof
+  address: string;
+}
+
+export interface ContinuousConfig {
+  targets: ContinuousTarget[];
+  intervalMinutes: number;
+  cpuSeconds: number;
+  retentionHours: number;
+  // Share of the targets captured each round, between 0 and 1
+  sampleFraction: number;
+  // Largest random delay of a target's capture within a round, as a share of the interval
+  jitter: number;
+  // Push every snapshot to the Pyroscope server (see pyroscope.ts), under the target's name
+  pyroscope: boolean;
+  // Export every snapshot to the OTLP endpoint (see otlp.ts), as the target's resource
+  otlp: boolean;
+  // Standard deviations from a function's average share that raise an anomaly
+  // finding after each snapshot (see anomalies.ts); 0 turns detection off
+  anomalyThreshold: number;
+}
+
+export interface Snapshot {
+  target: string;
+  profileType: ContinuousType;
+  at: string;
+  path: string;
+}
+
+export interface WindowSummary {
+  from: string;
+  to: string;
+  snapshots: number;
+}
+
+export interface ChangeReport {
+  target: string;
+  profileType: ContinuousType;
+  current: WindowSummary;
+  previous: WindowSummary;
+  diff: Omit<DiffResult, "flamegraph">;
+}
+
+// pprof endpoint for each snapshot type
+const ENDPOINTS: Record<ContinuousType, string> = { cpu: "profile", heap: "heap" };
+
+function snapshotRoot(): string {
+  return path.join(dataDir(), "continuous");
+}
+
+function slug(name: string): string {
+  return name.replace(/[^\w.-]+/g, "_");
+}
+
+// Snapshots an anomaly check reads back; enough for the average to settle
+export const ANOMALY_LOOKBACK_HOURS = 24;
+
+// Read continuous profiling settings: PROFILER_CONTINUOUS_TARGETS (comma-separated
+// addresses, optionally named as name=address), PROFILER_CONTINUOUS_INTERVAL
+// (minutes, default 10), PROFILER_CONTINUOUS_CPU_SECONDS (default 10),
+// PROFILER_CONTINUOUS_RETENTION (hours, default 168), and for large fleets
+// PROFILER_CONTINUOUS_SAMPLE_FRACTION (default 1) and PROFILER_CONTINUOUS_JITTER
+// (share of the interval, default 0), PROFILER_CONTINUOUS_PYROSCOPE=true and
+// PROFILER_CONTINUOUS_OTLP=true to push snapshots to Pyroscope and an OTLP
+// endpoint, and PROFILER_ANOMALY_THRESHOLD (standard
+// deviations, default 4; 0 for no anomaly detection)
+export function continuousConfig(env: NodeJS.ProcessEnv = process.env): ContinuousConfig | undefined {
+  const targets = (env.PROFILER_CONTINUOUS_TARGETS ?? "")
+    .split(",")
+    .map((entry) => entry.trim())
+    .filter(Boolean)
+    .map((entry) => {
+      const [name, address] = entry.includes("=") ? entry.split("=", 2) : [entry, entry];
+      return { name: name.trim(), address: address.trim() };
+    });
+  if (targets.length === 0) {
+    return undefined;
+  }
+
+  const intervalMinutes = Number(env.PROFILER_CONTINUOUS_INTERVAL ?? 10);
+  const cpuSeconds = Number(env.PROFILER_CONTINUOUS_CPU_SECONDS ?? 10);
+  const retentionHours = Number(env.PROFILER_CONTINUOUS_RETENTION ?? 168);
+  if (!(intervalMinutes >= 1) || !(cpuSeconds >= 1) || cpuSeconds >= intervalMinutes * 60 || !(retentionHours > 0)) {
+    throw new Error(
+      "PROFILER_CONTINUOUS_INTERVAL must be at least 1 minute, PROFILER_CONTINUOUS_CPU_SECONDS at least 1 and shorter than the interval, and PROFILER_CONTINUOUS_RETENTION positive",
+    );
+  }
+  const sampleFraction = Number(env.PROFILER_CONTINUOUS_SAMPLE_FRACTION ?? 1);
+  const jitter = Number(env.PROFILER_CONTINUOUS_JITTER ?? 0);
+  if (!(sampleFraction > 0 && sampleFraction <= 1) || !(jitter >= 0) || jitter * intervalMinutes * 60 + cpuSeconds >= intervalMinutes * 60) {
+    throw new Error(
+      "PROFILER_CONTINUOUS_SAMPLE_FRACTION must be above 0 and at most 1, and PROFILER_CONTINUOUS_JITTER at least 0 and small enough that a delayed CPU profile ends within the interval",
+    );
+  }
+  const pyroscope = ["true", "1"].includes((env.PROFILER_CONTINUOUS_PYROSCOPE ?? "").toLowerCase());
+  if (pyroscope) {
+    // Fail at startup rather than on every round
+    pyroscopeConfig(env);
+  }
+  const otlp = ["true", "1"].includes((env.PROFILER_CONTINUOUS_OTLP ?? "").toLowerCase());
+  if (otlp) {
+    otlpConfig(env);
+  }
+  const anomalyThreshold = Number(env.PROFILER_ANOMALY_THRESHOLD ?? 4);
+  if (!(anomalyThreshold >= 0)) {
+    throw new Error("PROFILER_ANOMALY_THRESHOLD must be a number of standard deviations, or 0 to turn anomaly detection off");
+  }
+  return { targets, intervalMinutes, cpuSeconds, retentionHours, sampleFraction, jitter, pyroscope, otlp, anomalyThreshold };
+}
+
+// Targets captured per round when sampling a fleet; at least one
+export function targetsPerRound(config: ContinuousConfig): number {
+  return Math.max(1, Math.ceil(config.targets.length * config.sampleFraction));
+}
+
+// Rounds until every target has been captured at least once
+export function roundsPerRotation(config: ContinuousConfig): number {
+  return Math.ceil(config.targets.length / targetsPerRound(config));
+}
+
+// Random sample of targets for one round. Targets are drawn from a shuffled
+// rotation rather than independently, so each round is still a random subset
+// but every target is captured once per rotation, keeping its trend populated.
+export function targetSampler(config: ContinuousConfig): () => ContinuousTarget[] {
+  let queue: ContinuousTarget[] = [];
+  const shuffled = () => {
+    const targets = [...config.targets];
+    for (let i = targets.length - 1; i > 0; i--) {
+      const j = Math.floor(Math.random() * (i + 1));
+      [targets[i], targets[j]] = [targets[j], targets[i]];
+    }
+    return targets;
+  };
+  return () => {
+    const count = targetsPerRound(config);
+    const picked: ContinuousTarget[] = [];
+    while (picked.length < count) {
+      if (queue.length === 0) {
+        // Targets already in this round go last in the next rotation
+        const next = shuffled();
+        queue = [...next.filter((t) => !picked.includes(t)), ...next.filter((t) => picked.includes(t))];
+      }
+      picked.push(queue.shift()!);
+    }
+    return picked;
+  };
+}
+
+// Capture and store one CPU and one heap snapshot of a target. A type that
+// fails is logged and left out, so the other is still stored and returned
+// for pushing and anomaly checks; only when both fail does this throw.
+export async function captureSnapshots(target: ContinuousTarget, cpuSeconds: number): Promise<Snapshot[]> {
+  const dir = path.join(snapshotRoot(), slug(target.name));
+  await fs.mkdir(dir, { recursive: true });
+
+  const snapshots: Snapshot[] = [];
+  let failure: unknown;
+  for (const profileType of CONTINUOUS_TYPES) {
+    const seconds = profileType === "cpu" ? cpuSeconds : 0;
+    let file: string | undefined;
+    let profile;
+    let at: Date;
+    try {
+      const downloaded = await downloadProfile(target.address, ENDPOINTS[profileType], seconds);
+      at = new Date();
+      file = path.join(dir, `${profileType}_${at.getTime()}.pb.gz`);
+      await fs.copyFile(downloaded, file);
+      await fs.unlink(downloaded).catch(() => undefined);
+      profile = readProfile(file);
+    } catch (error) {
+      if (file) {
+        await fs.unlink(file).catch(() => undefined);
+      }
+      console.error(`Capturing the ${profileType} snapshot of ${target.name} failed:`, error);
+      failure = error;
+      continue;
+    }
+    snapshots.push({ target: target.name, profileType, at: at.toISOString(), path: file });
+
+    const sampleIndex = sampleIndexOf(profile);
+    await recordCapture({
+      target: target.name,
+      profileType,
+      duration: seconds,
+      total: toBaseUnit(totalOf(profile, sampleIndex), profile.sampleTypes[sampleIndex].unit),
+      unit: profileType === "cpu" ? "seconds" : "bytes",
+      topFunctions: topFunctionsOf(profile, sampleIndex),
+      issues: 0,
+    }).catch(() => undefined);
+  }
+  if (snapshots.length === 0) {
+    throw failure;
+  }
+  return snapshots;
+}
+
+// Stored snapshots oldest first, optionally for one target, type and time range
+export async function listSnapshots(filter: {
+  target?: string;
+  profileType?: ContinuousType;
+  since?: Date;
+  until?: Date;
+} = {}): Promise<Snapshot[]> {
+  const root = snapshotRoot();
+  const dirs = filter.target ? [slug(filter.target)] : await fs.readdir(root).catch(() => []);
+  const snapshots: Snapshot[] = [];
+  for (const dir of dirs) {
+    for (const file of await fs.readdir(path.join(root, dir)).catch(() => [])) {
+      const match = file.match(/^(cpu|heap)_(\d+)\.pb\.gz$/);
+      if (!match) continue;
+      const profileType = match[1] as ContinuousType;
+      const at = Number(match[2]);
+      if (filter.profileType && profileType !== filter.profileType) continue;
+      if (filter.since && at < filter.since.getTime()) continue;
+      if (filter.until && at >= filter.until.getTime()) continue;
+      snapshots.push({ target: filter.target ?? dir, profileType, at: new Date(at).toISOString(), path: path.join(root, dir, file) });
+    }
+  }
+  return snapshots.sort((a, b) => a.at.localeCompare(b.at));
+}
+
+// Delete snapshots older than the retention period
+export async function pruneSnapshots(retentionHours: number, now = new Date()): Promise<number> {
+  const expired = await listSnapshots({ until: new Date(now.getTime() - retentionHours * 60 * 60 * 1000) });
+  await Promise.all(expired.map((s) => fs.unlink(s.path).catch(() => undefined)));
+  return expired.length;
+}
+
+// Compare the snapshots of the last `minutes` with those of the window before.
+// Each window's snapshots are merged, so one noisy capture does not dominate.
+export async function whatChanged(
+  target: string,
+  profileType: ContinuousType,
+  minutes = 60,
+  limit = 10,
+  now = new Date(),
+): Promise<ChangeReport> {
+  const windowMs = minutes * 60 * 1000;
+  const boundary = new Date(now.getTime() - windowMs);
+  const start = new Date(boundary.getTime() - windowMs);
+  const current = await listSnapshots({ target, profileType, since: boundary, until: now });
+  const previous = await listSnapshots({ target, profileType, since: start, until: boundary });
+  const describe = (from: Date, to: Date) => `${from.toISOString()} and ${to.toISOString()}`;
+  if (current.length === 0) {
+    throw new Error(`No ${profileType} snapshots of ${target} between ${describe(boundary, now)}`);
+  }
+  if (previous.length === 0) {
+    throw new Error(`No ${profileType} snapshots of ${target} between ${describe(start, boundary)} to compare with`);
+  }
+
+  const merge = (snapshots: Snapshot[]) => mergeProfiles(snapshots.map((s) => readProfile(s.path)));
+  const { flamegraph, ...diff } = diffProfiles(merge(previous), merge(current), undefined, limit);
+  return {
+    target,
+    profileType,
+    current: { from: boundary.toISOString(), to: now.toISOString(), snapshots: current.length },
+    previous: { from: start.toISOString(), to: boundary.toISOString(), snapshots: previous.length },
+    diff,
+  };
+}
+
+// Anomalies in a target's snapshots of the last `hours`
+export async function snapshotAnomalies(
+  target: string,
+  profileType: ContinuousType,
+  hours = ANOMALY_LOOKBACK_HOURS,
+  threshold?: number,
+  now = new Date(),
+): Promise<{ report: AnomalyReport; snapshots: Snapshot[] }> {
+  const snapshots = await listSnapshots({ target, profileType, since: new Date(now.getTime() - hours * 60 * 60 * 1000) });
+  if (snapshots.length === 0) {
+    throw new Error(`No ${profileType} snapshots of ${target} in the last ${hours}h`);
+  }
+  return { report: detectAnomalies(snapshots, threshold !== undefined ? { threshold } : {}), snapshots };
+}
+
+// Capture snapshots of the configured targets (or a sample of them) every
+// interval while the server runs, each after a random delay up to the jitter,
+// push them to Pyroscope and OTLP when configured, record anomalies in the new
+// snapshots as findings, and prune expired ones. A round
+// still running when the next is due is not overlapped.
+export function startContinuousProfiling(env: NodeJS.ProcessEnv = process.env): NodeJS.Timeout | undefined {
+  const config = continuousConfig(env);
+  if (!config) {
+    return undefined;
+  }
+
+  const sample = targetSampler(config);
+  const pyroscope = config.pyroscope ? pyroscopeConfig(env) : undefined;
+  const otlp = config.otlp ? otlpConfig(env) : undefined;
+  const maxDelayMs = config.jitter * config.intervalMinutes * 60 * 1000;
+  let running = false;
+  const round = async () => {
+    if (running) {
+      return;
+    }
+    running = true;
+    try {
+      const targets = sample();
+      const results = await Promise.allSettled(targets.map(async (t) => {
+        await new Promise((resolve) => setTimeout(resolve, Math.random() * maxDelayMs).unref());
+        // Counted against the capture limits, so a round does not collide with a capture by hand
+        const snapshots = await withCaptureSlot(pprofAddress(t.address), () => captureSnapshots(t, config.cpuSeconds));
+        // A failed push keeps the snapshot; it is still stored locally
+        for (const snapshot of pyroscope ? snapshots : []) {
+          await pushToPyroscope(snapshot.path, t.name, {}, pyroscope).catch((error) => {
+            console.error(`Pushing the ${snapshot.profileType} snapshot of ${t.name} to Pyroscope failed:`, error);
+          });
+        }
+        for (const snapshot of otlp ? snapshots : []) {
+          await exportToOtlp(snapshot.path, t.name, { "server.address": t.address }, { config: otlp }).catch((error) => {
+            console.error(`Exporting the ${snapshot.profileType} snapshot of ${t.name} to OTLP failed:`, error);
+          });
+        }
+        for (const snapshot of config.anomalyThreshold > 0 ? snapshots : []) {
+          await snapshotAnomalies(t.name, snapshot.profileType, ANOMALY_LOOKBACK_HOURS, config.anomalyThreshold)
+            .then(({ report, snapshots: series }) => recordAnomalies(report, series))
+            .catch((error) => {
+              console.error(`Checking the ${snapshot.profileType} snapshots of ${t.name} for anomalies failed:`, error);
+            });
+        }
+        return snapshots;
+      }));
+      results.forEach((result, i) => {
+        if (result.status === "rejected") {
+          console.error(`Continuous profiling of ${targets[i].name} failed:`, result.reason);
+        }
+      });
+      await pruneSnapshots(config.retentionHours);
+    } finally {
+      running = false;
+    }
+  };
+
+  void round();
+  const timer = setInterval(round, config.intervalMinutes * 60 * 1000);
+  timer.unref();
+  return timer;
+}
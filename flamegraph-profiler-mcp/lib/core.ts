@@ -0,0 +1,232 @@
+/**
+ * Core dump analysis: the goroutines of a crashed Go process at the moment it
+ * died, and its live heap objects by size class, read through Delve. The
+ * stacks become a goroutine profile, so the final moment renders as a
+ * flamegraph like any sampled profile.
+ */
+import { existsSync } from "node:fs";
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { keepProfile } from "./catalog.js";
+import { openCore, type DelveClient, type DelveGoroutine, type DelveLocation, type DelveVariable, type LoadConfig } from "./delve.js";
+import { analyzeGoroutines, type Goroutine, type GoroutineFrame, type GoroutineReport } from "./goroutines.js";
+import { writeProfile, type Location, type Profile } from "./pprof.js";
+
+export interface SizeClassObjects {
+  // Object size in bytes
+  size: number;
+  objects: number;
+  bytes: number;
+}
+
+export interface CoreHeap {
+  // Live small objects per size class, largest total first
+  classes: SizeClassObjects[];
+  // Live objects too large for a size class (> 32 KiB), whose sizes are not tracked per object
+  largeObjects: number;
+  totalObjects: number;
+  // Bytes in small objects; large objects are not included
+  smallBytes: number;
+}
+
+export interface CoreReport {
+  core: string;
+  binary: string;
+  goroutines: GoroutineReport;
+  // Goroutine whose thread was executing when the process died
+  crashing?: { id: number; stack: string[] };
+  heap?: CoreHeap;
+  // Why heap counts could not be read, e.g. an unsupported Go version
+  heapError?: string;
+  // Stacks deeper than this were cut off
+  depth: number;
+  // Goroutines beyond the limit were not read
+  truncated: boolean;
+  profileId: string;
+}
+
+// Goroutines read from a core; each one costs a Delve call
+const MAX_GOROUTINES = 10_000;
+
+const PAGE_SIZE = 1000;
+
+// runtime.g status values (runtime2.go), as Delve reports them
+const STATUSES = ["idle", "runnable", "running", "syscall", "waiting", "moribund", "dead", "enqueue", "copystack", "preempted"];
+
+const ARRAY_LOAD: LoadConfig = {
+  FollowPointers: false,
+  MaxVariableRecurse: 3,
+  MaxStringLen: 64,
+  MaxArrayValues: 256,
+  MaxStructFields: -1,
+};
+
+// Size class table names across Go versions
+const SIZE_TABLES = ["runtime.class_to_size", "\"internal/runtime/gc\".SizeClassToSize"];
+
+function frameOf(loc: DelveLocation): GoroutineFrame {
+  return { name: loc.function?.name ?? `0x${loc.pc.toString(16)}`, file: loc.file, line: loc.line };
+}
+
+async function readGoroutines(client: DelveClient, depth: number): Promise<{ goroutines: Goroutine[]; truncated: boolean }> {
+  const listed: DelveGoroutine[] = [];
+  let start = 0;
+  while (listed.length < MAX_GOROUTINES) {
+    const page = await client.call<{ Goroutines: DelveGoroutine[]; Nextg: number }>("ListGoroutines", { Start: start, Count: PAGE_SIZE });
+    listed.push(...page.Goroutines);
+    if (page.Nextg < 0 || page.Goroutines.length === 0) break;
+    start = page.Nextg;
+  }
+
+  const goroutines: Goroutine[] = [];
+  for (const g of listed.slice(0, MAX_GOROUTINES)) {
+    const { Locations } = await client.call<{ Locations: DelveLocation[] }>("Stacktrace", { Id: g.id, Depth: depth });
+    goroutines.push({
+      id: g.id,
+      state: STATUSES[g.status ?? -1] ?? "unknown",
+      waitMinutes: 0,
+      frames: Locations.map(frameOf),
+      createdBy: g.goStatementLoc?.pc ? frameOf(g.goStatementLoc) : undefined,
+    });
+  }
+  return { goroutines, truncated: listed.length > MAX_GOROUTINES };
+}
+
+function numbers(v: DelveVariable | undefined): number[] {
+  return (v?.children ?? []).map((c) => Number(c.value) || 0);
+}
+
+function field(v: DelveVariable, name: string): DelveVariable | undefined {
+  return v.children.find((c) => c.name === name);
+}
+
+async function evaluate(client: DelveClient, expr: string): Promise<DelveVariable> {
+  const { Variable } = await client.call<{ Variable: DelveVariable }>("Eval", {
+    Scope: { GoroutineID: -1, Frame: 0, DeferredCall: 0 },
+    Expr: expr,
+    Cfg: ARRAY_LOAD,
+  });
+  if (Variable.unreadable) {
+    throw new Error(`${expr}: ${Variable.unreadable}`);
+  }
+  return Variable;
+}
+
+// Live objects per size class from the runtime's heap statistics
+// (runtime.memstats.heapStats, Go 1.17+): allocations minus frees, summed
+// over the three generations the runtime keeps.
+async function readHeap(client: DelveClient): Promise<CoreHeap> {
+  const stats = await evaluate(client, "runtime.memstats.heapStats.stats");
+  let sizes: number[] | undefined;
+  for (const expr of SIZE_TABLES) {
+    sizes = await evaluate(client, expr).then(numbers).catch(() => undefined);
+    if (sizes) break;
+  }
+  if (!sizes) {
+    throw new Error("No size class table found in the binary");
+  }
+
+  const live = new Array<number>(sizes.length).fill(0);
+  let largeObjects = 0;
+  for (const generation of stats.children) {
+    const allocs = numbers(field(generation, "smallAllocCount"));
+    const frees = numbers(field(generation, "smallFreeCount"));
+    if (allocs.length === 0) {
+      throw new Error(`Unsupported heap statistics layout (${generation.type})`);
+    }
+    allocs.forEach((n, i) => (live[i] += n - (frees[i] ?? 0)));
+    largeObjects += Number(field(generation, "largeAllocCount")?.value ?? 0) - Number(field(generation, "largeFreeCount")?.value ?? 0);
+  }
+
+  // Size class 0 stands for large objects
+  const classes = live
+    .map((objects, i) => ({ size: sizes[i], objects, bytes: objects * sizes[i] }))
+    .filter((c, i) => i > 0 && c.objects > 0)
+    .sort((a, b) => b.bytes - a.bytes);
+  return {
+    classes,
+    largeObjects,
+    totalObjects: classes.reduce((sum, c) => sum + c.objects, 0) + largeObjects,
+    smallBytes: classes.reduce((sum, c) => sum + c.bytes, 0),
+  };
+}
+
+// A goroutine profile with one sample per goroutine, like /debug/pprof/goroutine
+export function goroutineProfile(goroutines: Goroutine[], comments: string[]): Profile {
+  const locations = new Map<number, Location>();
+  const ids = new Map<string, number>();
+  const locationOf = (frame: GoroutineFrame): number => {
+    const key = `${frame.name}\n${frame.file}:${frame.line}`;
+    let id = ids.get(key);
+    if (id === undefined) {
+      id = ids.size + 1;
+      ids.set(key, id);
+      locations.set(id, { id, address: "0", mappingId: 0, frames: [frame] });
+    }
+    return id;
+  };
+  return {
+    sampleTypes: [{ type: "goroutine", unit: "count" }],
+    samples: goroutines.map((g) => ({
+      values: [1],
+      locationIds: g.frames.map(locationOf),
+      labels: { state: g.state },
+    })),
+    locations,
+    mappings: [],
+    periodType: { type: "goroutine", unit: "count" },
+    period: 1,
+    comments,
+  };
+}
+
+export async function analyzeCore(options: { binary: string; core: string; depth: number }): Promise<CoreReport> {
+  const binary = path.resolve(options.binary);
+  const core = path.resolve(options.core);
+  for (const file of [binary, core]) {
+    if (!existsSync(file)) {
+      throw new Error(`${file} does not exist`);
+    }
+  }
+
+  const client = await openCore(binary, core);
+  let goroutines: Goroutine[];
+  let truncated: boolean;
+  let crashingId: number | undefined;
+  let heap: CoreHeap | undefined;
+  let heapError: string | undefined;
+  try {
+    ({ goroutines, truncated } = await readGoroutines(client, options.depth));
+    const { State } = await client.call<{ State: { currentGoroutine?: { id: number } } }>("State", { NonBlocking: true });
+    crashingId = State.currentGoroutine?.id;
+    try {
+      heap = await readHeap(client);
+    } catch (error) {
+      heapError = error instanceof Error ? error.message : String(error);
+    }
+  } finally {
+    await client.close();
+  }
+
+  const file = path.join(os.tmpdir(), `core_goroutines_${Date.now()}.pb.gz`);
+  writeProfile(file, goroutineProfile(goroutines, [`core=${core}`, `binary=${binary}`]));
+  const entry = await keepProfile(file, `${path.basename(binary)}_core_goroutine`, {
+    target: core,
+    profileType: "goroutine",
+    labels: { core: path.basename(core) },
+  }).finally(() => fs.unlink(file).catch(() => undefined));
+
+  const crashing = goroutines.find((g) => g.id === crashingId);
+  return {
+    core,
+    binary,
+    goroutines: analyzeGoroutines(goroutines, undefined, { minGroupSize: 100, minGrowth: Number.POSITIVE_INFINITY }),
+    crashing: crashing ? { id: crashing.id, stack: crashing.frames.map((f) => `${f.name} ${f.file}:${f.line}`) } : undefined,
+    heap,
+    heapError,
+    depth: options.depth,
+    truncated,
+    profileId: entry.id,
+  };
+}
@@ -0,0 +1,89 @@
+/**
+ * Cost model - translates profile shares into an estimated monthly spend.
+ */
+
+export interface CostModel {
+  centsPerVcpuHour: number;
+  centsPerGbHour?: number;
+  replicas: number;
+}
+
+export interface FunctionCost {
+  name: string;
+  percentage: number;
+  monthlyDollars: number;
+}
+
+export interface CostEstimate {
+  resource: "cpu" | "memory";
+  replicas: number;
+  // vCPUs (cpu) or GB (memory) used by a single replica
+  usagePerReplica: number;
+  monthlyTotalDollars: number;
+  functions: FunctionCost[];
+  assumptions: string[];
+}
+
+interface CostInput {
+  profileType: "cpu" | "heap";
+  duration: number;
+  // CPU seconds for cpu profiles, bytes for heap profiles
+  total: number;
+  topFunctions: Array<{ name: string; percentage: number }>;
+}
+
+const HOURS_PER_MONTH = 730;
+const BYTES_PER_GB = 1024 ** 3;
+
+// Estimate the monthly cost of a profiled workload and its top functions.
+// Returns null when the model has no price for the profiled resource.
+export function estimateCost(input: CostInput, model: CostModel): CostEstimate | null {
+  const isCpu = input.profileType === "cpu";
+  const centsPerHour = isCpu ? model.centsPerVcpuHour : model.centsPerGbHour;
+  if (centsPerHour === undefined || input.duration <= 0) {
+    return null;
+  }
+
+  // A CPU profile's total is CPU time, so dividing by wall time gives the
+  // average number of vCPUs kept busy. Heap totals are already a level.
+  const usagePerReplica = isCpu ? input.total / input.duration : input.total / BYTES_PER_GB;
+  const monthlyTotalDollars = (usagePerReplica * model.replicas * HOURS_PER_MONTH * centsPerHour) / 100;
+
+  const functions = input.topFunctions.map((f) => ({
+    name: f.name,
+    percentage: f.percentage,
+    monthlyDollars: roundCents((f.percentage / 100) * monthlyTotalDollars),
+  }));
+
+  const unit = isCpu ? "vCPU" : "GB";
+  return {
+    resource: isCpu ? "cpu" : "memory",
+    replicas: model.replicas,
+    usagePerReplica,
+    monthlyTotalDollars: roundCents(monthlyTotalDollars),
+    functions,
+    assumptions: [
+      `${usagePerReplica.toFixed(3)} ${unit} per replica, measured over a ${input.duration.toFixed(1)}s capture`,
+      `${model.replicas} replica(s) running the same workload ${HOURS_PER_MONTH} hours per month`,
+      `${centsPerHour}¢ per ${unit}-hour`,
+      isCpu
+        ? "Function shares are flat (self) CPU time"
+        : "Function shares are flat in-use bytes at capture time",
+    ],
+  };
+}
+
+function roundCents(dollars: number): number {
+  return Math.round(dollars * 100) / 100;
+}
+
+// Format a cost estimate as lines for a tool's text summary
+export function formatCostEstimate(estimate: CostEstimate, limit = 5): string {
+  const lines = [
+    `💰 Estimated Monthly Cost: $${estimate.monthlyTotalDollars.toFixed(2)} across ${estimate.replicas} replica(s)`,
+    ...estimate.functions
+      .slice(0, limit)
+      .map((f) => `   ${f.name}: $${f.monthlyDollars.toFixed(2)}/month (${f.percentage}%)`),
+  ];
+  return lines.join("\n");
+}
@@ -0,0 +1,241 @@
+/**
+ * Read-only HTML dashboard of targets, captures, trends and open findings,
+ * served in HTTP mode for people without an MCP client.
+ */
+import { timingSafeEqual } from "node:crypto";
+import { functionTrend, listCaptures, trendValue, type Capture } from "./captures.js";
+import { barChart, lineChart, sparkline, type Series } from "./charts.js";
+import { listFindings, type Finding } from "./findings.js";
+import { formatValue } from "./pprof.js";
+
+export interface DashboardData {
+  targets: Array<{ target: string; profileTypes: string[]; captures: number; lastCaptureAt: string }>;
+  recentCaptures: Capture[];
+  trends: Array<{ target: string; profileType: string; unit: Capture["unit"]; points: Array<{ at: string; value: number }> }>;
+  // Share of the top functions of the latest capture across captures, per target and profile type
+  functionTrends: Array<{ target: string; profileType: string; series: Series[] }>;
+  // GC metrics from execution traces, per target
+  gcTrends: Array<{ target: string; stopTheWorldMs: Series; cyclesPerSecond: Series }>;
+  openFindings: Finding[];
+}
+
+// Captures listed in the recent captures table
+const RECENT_CAPTURES = 25;
+
+// Points per trend chart
+const TREND_POINTS = 50;
+
+// Functions per function trend chart
+const TREND_FUNCTIONS = 5;
+
+// Dashboard access token; the dashboard is disabled when unset
+export function dashboardToken(env: NodeJS.ProcessEnv = process.env): string | undefined {
+  return env.PROFILER_DASHBOARD_TOKEN || undefined;
+}
+
+// Check a bearer token or ?token= value against the configured token
+export function isAuthorized(provided: string | undefined, token: string): boolean {
+  if (!provided) {
+    return false;
+  }
+  const a = Buffer.from(provided);
+  const b = Buffer.from(token);
+  return a.length === b.length && timingSafeEqual(a, b);
+}
+
+export async function dashboardData(): Promise<DashboardData> {
+  const captures = await listCaptures();
+
+  const targets = new Map<string, DashboardData["targets"][number]>();
+  const series = new Map<string, DashboardData["trends"][number]>();
+  for (const capture of captures) {
+    let target = targets.get(capture.target);
+    if (!target) {
+      target = { target: capture.target, profileTypes: [], captures: 0, lastCaptureAt: capture.at };
+      targets.set(capture.target, target);
+    }
+    target.captures++;
+    target.lastCaptureAt = capture.at;
+    if (!target.profileTypes.includes(capture.profileType)) {
+      target.profileTypes.push(capture.profileType);
+    }
+
+    const key = `${capture.target}|${capture.profileType}`;
+    let trend = series.get(key);
+    if (!trend) {
+      trend = { target: capture.target, profileType: capture.profileType, unit: capture.unit, points: [] };
+      series.set(key, trend);
+    }
+    trend.points.push({ at: capture.at, value: trendValue(capture) });
+  }
+
+  const groups = new Map<string, Capture[]>();
+  for (const capture of captures) {
+    const key = `${capture.target}|${capture.profileType}`;
+    groups.set(key, [...(groups.get(key) ?? []), capture]);
+  }
+
+  const functionTrends: DashboardData["functionTrends"] = [];
+  const gcTrends: DashboardData["gcTrends"] = [];
+  for (const group of groups.values()) {
+    const recent = group.slice(-TREND_POINTS);
+    const latest = recent[recent.length - 1];
+    if (recent.length > 1 && latest.profileType !== "trace") {
+      functionTrends.push({
+        target: latest.target,
+        profileType: latest.profileType,
+        series: functionTrend(recent, TREND_FUNCTIONS),
+      });
+    }
+    const traced = recent.filter((c) => c.gc);
+    if (traced.length > 0) {
+      gcTrends.push({
+        target: latest.target,
+        stopTheWorldMs: { name: "stop-the-world ms", points: traced.map((c) => ({ x: Date.parse(c.at), y: (c.gc?.stopTheWorld ?? 0) * 1000 })) },
+        cyclesPerSecond: { name: "GC cycles/s", points: traced.map((c) => ({ x: Date.parse(c.at), y: (c.gc?.cycles ?? 0) / (c.duration || 1) })) },
+      });
+    }
+  }
+
+  return {
+    targets: [...targets.values()].sort((a, b) => b.lastCaptureAt.localeCompare(a.lastCaptureAt)),
+    recentCaptures: captures.slice(-RECENT_CAPTURES).reverse(),
+    trends: [...series.values()]
+      .filter((t) => t.points.length > 1)
+      .map((t) => ({ ...t, points: t.points.slice(-TREND_POINTS) })),
+    functionTrends,
+    gcTrends,
+    openFindings: await listFindings({ status: "open" }),
+  };
+}
+
+function escape(text: string): string {
+  return text.replace(/[&<>"']/g, (c) => `&#${c.charCodeAt(0)};`);
+}
+
+function formatTrendValue(value: number, unit: Capture["unit"]): string {
+  if (unit === "seconds") return `${value.toFixed(2)} s/s`;
+  if (unit === "bytes") return formatValue(value, "bytes");
+  return String(Math.round(value));
+}
+
+function figure(chart: string, caption?: string): string {
+  return `<figure>${chart}${caption ? `<figcaption>${escape(caption)}</figcaption>` : ""}</figure>`;
+}
+
+function ticketLink(id: string, url: string): string {
+  return /^https?:\/\//.test(url) ? `<a href="${escape(url)}">${escape(id)}</a>` : escape(id);
+}
+
+function table(headers: string[], rows: string[][], empty: string): string {
+  if (rows.length === 0) {
+    return `<p class="empty">${empty}</p>`;
+  }
+  return `<table><thead><tr>${headers.map((h) => `<th>${h}</th>`).join("")}</tr></thead><tbody>${rows
+    .map((row) => `<tr>${row.map((cell) => `<td>${cell}</td>`).join("")}</tr>`)
+    .join("")}</tbody></table>`;
+}
+
+export function renderDashboard(data: DashboardData): string {
+  const targets = table(
+    ["Target", "Profiles", "Captures", "Last capture", "Trend"],
+    data.targets.map((t) => {
+      const trend = data.trends.find((tr) => tr.target === t.target);
+      return [
+        escape(t.target),
+        escape(t.profileTypes.join(", ")),
+        String(t.captures),
+        escape(t.lastCaptureAt),
+        trend ? `${sparkline(trend.points.map((p) => p.value))} ${escape(trend.profileType)}` : "",
+      ];
+    }),
+    "No captures yet.",
+  );
+
+  const trends = data.trends.length === 0
+    ? `<p class="empty">Trends appear after two captures of the same target and profile type.</p>`
+    : data.trends.map((t) => {
+      const last = t.points[t.points.length - 1];
+      return figure(lineChart(
+        [{ name: t.profileType, points: t.points.map((p) => ({ x: Date.parse(p.at), y: p.value })) }],
+        { title: `${t.target} · ${t.profileType}`, formatY: (v) => formatTrendValue(v, t.unit) },
+      ), `Latest ${formatTrendValue(last.value, t.unit)}`);
+    }).join("");
+
+  const functionTrends = data.functionTrends.map((t) =>
+    figure(lineChart(t.series, { title: `${t.target} · ${t.profileType} · top functions`, formatY: (v) => `${Math.round(v)}%`, height: 260 })),
+  ).join("");
+
+  const gcTrends = data.gcTrends.map((t) =>
+    figure(lineChart([t.stopTheWorldMs], { title: `${t.target} · stop-the-world pauses (ms)` })) +
+    figure(lineChart([t.cyclesPerSecond], { title: `${t.target} · GC cycles per second` })),
+  ).join("");
+
+  const severities = ["high", "medium", "low"] as const;
+  const findingsBySeverity = barChart(
+    severities.map((severity) => ({ label: severity, value: data.openFindings.filter((f) => f.severity === severity).length })),
+    { title: "Open findings by severity", width: 360 },
+  );
+
+  const captures = table(
+    ["When", "Target", "Type", "Total", "Top function", "Issues"],
+    data.recentCaptures.map((c) => [
+      escape(c.at),
+      escape(c.target),
+      escape(c.profileType),
+      escape(c.unit === "count" ? String(c.total) : formatValue(c.total, c.unit)),
+      c.topFunctions[0] ? `${escape(c.topFunctions[0].name)} (${c.topFunctions[0].percentage}%)` : "",
+      String(c.issues),
+    ]),
+    "No captures yet.",
+  );
+
+  const findings = table(
+    ["ID", "Severity", "Finding", "Seen", "Owners", "Assignee", "Ticket"],
+    data.openFindings.map((f) => [
+      escape(f.id),
+      escape(f.severity),
+      escape(f.title),
+      String(f.occurrenceCount ?? 1),
+      escape((f.owners ?? []).join(" ")),
+      escape(f.assignee ?? ""),
+      f.ticket ? ticketLink(f.ticket.id, f.ticket.url) : "",
+    ]),
+    "No open findings.",
+  );
+
+  return `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Flamegraph Profiler Dashboard</title>
+<style>
+  body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+  h1 { font-size: 1.4rem; }
+  h2 { font-size: 1.1rem; margin-top: 2rem; }
+  table { border-collapse: collapse; width: 100%; font-size: 0.9rem; }
+  th, td { text-align: left; padding: 0.35rem 0.6rem; border-bottom: 1px solid #ddd; }
+  th { background: #f6f6f6; }
+  figure { display: inline-block; margin: 0 1.5rem 1rem 0; }
+  figcaption { font-size: 0.85rem; color: #555; }
+  .empty { color: #777; }
+</style>
+</head>
+<body>
+<h1>🔥 Flamegraph Profiler</h1>
+<h2>Targets</h2>
+${targets}
+<h2>Trends</h2>
+${trends}
+${functionTrends ? `<h2>Function Trends</h2>\n${functionTrends}` : ""}
+${gcTrends ? `<h2>Garbage Collection</h2>\n${gcTrends}` : ""}
+<h2>Recent Captures</h2>
+${captures}
+<h2>Open Findings (${data.openFindings.length})</h2>
+${data.openFindings.length > 0 ? figure(findingsBySeverity) : ""}
+${findings}
+</body>
+</html>
+`;
+}
@@ -0,0 +1,198 @@
+/**
+ * A minimal client for Delve's JSON-RPC API (v2), enough to open a core file
+ * or attach to a running process headless, read goroutines, stacks and
+ * variables, and set tracepoints.
+ */
+import { spawn } from "node:child_process";
+import net from "node:net";
+
+// Time allowed for dlv to load the core or attach, and start listening
+const START_TIMEOUT_MS = 60_000;
+
+// Time allowed for a single call; stacks of many goroutines take a while.
+// Continue is exempt, as it runs until the target stops.
+const CALL_TIMEOUT_MS = 120_000;
+
+export interface DelveLocation {
+  pc: number;
+  file: string;
+  line: number;
+  function?: { name: string };
+}
+
+export interface DelveGoroutine {
+  id: number;
+  currentLoc: DelveLocation;
+  userCurrentLoc: DelveLocation;
+  goStatementLoc: DelveLocation;
+  startLoc: DelveLocation;
+  threadID: number;
+  status?: number;
+  waitSince?: number;
+  waitReason?: number;
+  labels?: Record<string, string>;
+}
+
+export interface DelveVariable {
+  name: string;
+  type: string;
+  kind: number;
+  value: string;
+  len: number;
+  children: DelveVariable[];
+  unreadable?: string;
+}
+
+export interface DelveBreakpoint {
+  id: number;
+  functionName?: string;
+  file: string;
+  line: number;
+  totalHitCount?: number;
+}
+
+export interface DelveThread {
+  id: number;
+  goroutineID: number;
+  breakPoint?: DelveBreakpoint;
+  // Arguments and the stack, loaded at tracepoints that ask for them
+  breakPointInfo?: { arguments?: DelveVariable[]; stacktrace?: DelveLocation[] };
+}
+
+export interface DelveState {
+  Running: boolean;
+  exited?: boolean;
+  exitStatus?: number;
+  Threads?: DelveThread[];
+}
+
+// How much of a variable Delve loads
+export interface LoadConfig {
+  FollowPointers: boolean;
+  MaxVariableRecurse: number;
+  MaxStringLen: number;
+  MaxArrayValues: number;
+  MaxStructFields: number;
+}
+
+function dlvError(error: unknown): Error {
+  if ((error as NodeJS.ErrnoException).code === "ENOENT") {
+    return new Error("dlv not found on PATH; install it with `go install github.com/go-delve/delve/cmd/dlv@latest`");
+  }
+  return error instanceof Error ? error : new Error(String(error));
+}
+
+export interface DelveClient {
+  // Call an RPCServer method, e.g. call("Stacktrace", { Id: 1, Depth: 50 })
+  call<T>(method: string, params?: Record<string, unknown>): Promise<T>;
+  // Detach, which ends dlv; a core is released, an attached process keeps running
+  close(): Promise<void>;
+}
+
+// Start dlv headless on a free port and connect to it. kill decides whether
+// detaching ends the target.
+async function startDelve(args: string[], kill: boolean): Promise<DelveClient> {
+  const dlv = spawn("dlv", [...args, "--headless", "--api-version=2", "--listen=127.0.0.1:0", "--log-dest=2"], {
+    stdio: ["ignore", "pipe", "pipe"],
+  });
+  let output = "";
+  const address = await new Promise<string>((resolve, reject) => {
+    const timer = setTimeout(() => reject(new Error(`dlv did not start within ${START_TIMEOUT_MS / 1000}s`)), START_TIMEOUT_MS);
+    const onData = (chunk: Buffer) => {
+      output += chunk.toString();
+      const match = output.match(/API server listening at: (\S+)/);
+      if (match) {
+        clearTimeout(timer);
+        resolve(match[1]);
+      }
+    };
+    dlv.stdout?.on("data", onData);
+    dlv.stderr?.on("data", onData);
+    dlv.on("error", (error) => {
+      clearTimeout(timer);
+      reject(dlvError(error));
+    });
+    dlv.on("exit", (code) => {
+      clearTimeout(timer);
+      reject(new Error(output.trim() || `dlv exited with code ${code}`));
+    });
+  });
+  const colon = address.lastIndexOf(":");
+  const socket = await new Promise<net.Socket>((resolve, reject) => {
+    const s = net.connect({ host: address.slice(0, colon), port: Number(address.slice(colon + 1)) }, () => resolve(s));
+    s.on("error", reject);
+  }).catch((error) => {
+    dlv.kill();
+    throw error;
+  });
+
+  let nextId = 1;
+  let buffer = "";
+  const pending = new Map<number, { resolve: (value: unknown) => void; reject: (error: Error) => void }>();
+  socket.setEncoding("utf8");
+  // Responses are JSON values, one per line
+  socket.on("data", (chunk: string) => {
+    buffer += chunk;
+    let newline: number;
+    while ((newline = buffer.indexOf("\n")) !== -1) {
+      const line = buffer.slice(0, newline).trim();
+      buffer = buffer.slice(newline + 1);
+      if (!line) continue;
+      const response = JSON.parse(line) as { id: number; result: unknown; error: string | null };
+      const waiter = pending.get(response.id);
+      pending.delete(response.id);
+      if (response.error) {
+        waiter?.reject(new Error(response.error));
+      } else {
+        waiter?.resolve(response.result);
+      }
+    }
+  });
+  socket.on("close", () => {
+    for (const waiter of pending.values()) {
+      waiter.reject(new Error("Delve closed the connection"));
+    }
+    pending.clear();
+  });
+
+  const call = <T>(method: string, params: Record<string, unknown> = {}): Promise<T> => {
+    const id = nextId++;
+    return new Promise<T>((resolve, reject) => {
+      const timer = method === "Command" && params.name === "continue" ? undefined : setTimeout(() => {
+        pending.delete(id);
+        reject(new Error(`Delve call ${method} timed out`));
+      }, CALL_TIMEOUT_MS);
+      pending.set(id, {
+        resolve: (value) => {
+          clearTimeout(timer);
+          resolve(value as T);
+        },
+        reject: (error) => {
+          clearTimeout(timer);
+          reject(error);
+        },
+      });
+      socket.write(`${JSON.stringify({ method: `RPCServer.${method}`, params: [params], id })}\n`);
+    });
+  };
+
+  return {
+    call,
+    close: async () => {
+      await call("Detach", { Kill: kill }).catch(() => undefined);
+      socket.destroy();
+      dlv.kill();
+    },
+  };
+}
+
+// Open a core file of the given executable
+export function openCore(binary: string, core: string): Promise<DelveClient> {
+  return startDelve(["core", binary, core], true);
+}
+
+// Attach to a running process, which is stopped until the first continue
+// and keeps running after close
+export function attachProcess(pid: number): Promise<DelveClient> {
+  return startDelve(["attach", String(pid)], false);
+}
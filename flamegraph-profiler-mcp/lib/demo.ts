@@ -0,0 +1,197 @@
+/**
+ * A guided tour on the bundled sample app: start it serving net/http/pprof,
+ * capture and analyze CPU, heap and goroutine profiles, switch it to its
+ * optimized scenario, capture again and diff the two CPU profiles. Each step
+ * is narrated with what it found and the tools that do the same for other
+ * programs.
+ */
+import { spawn } from "node:child_process";
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { headCommit } from "./baselines.js";
+import { analyzeRunProfile, type RunProfile } from "./build.js";
+import { resolveProfilePath } from "./catalog.js";
+import { diffProfiles, type FunctionDelta } from "./diff.js";
+import { buildGoAppAsync, type ProfileType } from "./goapp.js";
+import { analyzeGoroutines, captureGoroutines } from "./goroutines.js";
+import { formatValue, readProfile } from "./pprof.js";
+import { noProgress, type ProgressReporter } from "./progress.js";
+import { SAMPLE_APP_DIR } from "./sampleapp.js";
+import { downloadProfile, fetchPprof, freePort, pprofUrl } from "./target.js";
+
+export interface DemoStep {
+  title: string;
+  // What the step did and found, for someone new to profiling
+  narration: string;
+  // Tools that do the same for other programs
+  tools: string[];
+}
+
+export interface DemoReport {
+  source: string;
+  // pprof address the sample app served on
+  target: string;
+  commit?: string;
+  cpuSeconds: number;
+  // CPU and heap profiles of the inefficient scenario
+  before: RunProfile[];
+  // CPU profile of the optimized scenario
+  after: RunProfile;
+  goroutines: { total: number; suspicious: string[] };
+  diff: { improvements: FunctionDelta[]; regressions: FunctionDelta[] };
+  steps: DemoStep[];
+}
+
+const STEPS = 6;
+
+// Time the sample app gets to start serving pprof
+const START_TIMEOUT_MS = 30_000;
+
+// Time the optimized loop runs before the second capture, so the capture
+// does not start inside an iteration of the old one
+const SWITCH_SETTLE_MS = 1000;
+
+async function waitForPprof(target: string, signal?: AbortSignal): Promise<void> {
+  const deadline = Date.now() + START_TIMEOUT_MS;
+  for (;;) {
+    signal?.throwIfAborted();
+    try {
+      await fetchPprof(target, "", {}, 0, signal);
+      return;
+    } catch (error) {
+      if (Date.now() > deadline) {
+        throw new Error(`The sample app did not serve pprof on ${target} within ${START_TIMEOUT_MS / 1000}s: ${error instanceof Error ? error.message : error}`);
+      }
+    }
+    await new Promise((resolve) => setTimeout(resolve, 200));
+  }
+}
+
+// Switch the running sample app's workload with its /debug/scenario endpoint
+async function switchScenario(target: string, name: string): Promise<void> {
+  const url = pprofUrl(target, "");
+  url.pathname = "/debug/scenario";
+  url.searchParams.set("name", name);
+  const response = await fetch(url, { signal: AbortSignal.timeout(10_000) });
+  if (!response.ok) {
+    throw new Error(`${url} returned ${response.status}: ${(await response.text()).trim()}`);
+  }
+}
+
+function share(f: { name: string; percentage: number } | undefined): string {
+  return f ? `${f.name} (${f.percentage}%)` : "nothing in particular";
+}
+
+function delta(d: FunctionDelta): string {
+  return `${d.name} ${d.baselineFlatPct}% → ${d.comparisonFlatPct}%`;
+}
+
+// Run the tour. The sample app is stopped and its binary removed however it ends.
+export async function runDemo(options: { cpuSeconds: number; progress?: ProgressReporter; signal?: AbortSignal }): Promise<DemoReport> {
+  const { cpuSeconds, signal } = options;
+  const progress = options.progress ?? noProgress;
+  const source = path.join(SAMPLE_APP_DIR, "main.go");
+  const binary = path.join(os.tmpdir(), `sample-app_demo_${Date.now()}`);
+  const run = { name: "demo", source, duration: cpuSeconds, commit: await headCommit(SAMPLE_APP_DIR) };
+  const steps: DemoStep[] = [];
+  let step = 0;
+  const begin = (message: string) => progress(step++, STEPS, message);
+  const capture = async (profileType: ProfileType, seconds: number): Promise<RunProfile> => {
+    const file = await downloadProfile(target, profileType === "cpu" ? "profile" : profileType, seconds, signal);
+    try {
+      return await analyzeRunProfile(file, profileType, run);
+    } finally {
+      await fs.unlink(file).catch(() => undefined);
+    }
+  };
+
+  begin("building and starting the sample app");
+  await buildGoAppAsync(source, binary, signal);
+  const target = `127.0.0.1:${await freePort()}`;
+  // Runs for an hour at most should the server die before stopping it
+  const app = spawn(binary, [`-http=${target}`, "-duration=3600", "-scenario=inefficient", "-leak"], { stdio: "ignore", signal });
+  app.on("error", () => undefined);
+  try {
+    await waitForPprof(target, signal);
+    steps.push({
+      title: "🚀 Start the sample app",
+      narration: `Built ${source} and started it serving net/http/pprof on ${target}. It runs the inefficient scenario: bubble sort, recursive fibonacci, string concatenation in a loop, wasted allocations and leaking goroutines, over and over.`,
+      tools: ["run_sample_app", "build_and_profile", "profile_docker_container"],
+    });
+
+    begin(`capturing ${cpuSeconds}s of CPU`);
+    const cpu = await capture("cpu", cpuSeconds);
+    const topFindings = cpu.findings.slice(0, 3).map((f) => f.title);
+    steps.push({
+      title: "🔥 Capture a CPU profile",
+      narration: `Captured ${formatValue(cpu.total, cpu.unit)} of CPU over ${cpuSeconds}s and saved it as ${cpu.profileId}. The hottest function is ${share(cpu.topFunctions[0])}. ${cpu.findings.length} anti-pattern finding(s) were recorded${topFindings.length > 0 ? `, led by: ${topFindings.join("; ")}` : ""}.`,
+      tools: ["top_functions", "function_detail", "list_source", "list_findings"],
+    });
+
+    begin("capturing the heap");
+    const heap = await capture("heap", 0);
+    steps.push({
+      title: "🧠 Capture a heap profile",
+      narration: `${formatValue(heap.total, heap.unit)} was in use at the capture, saved as ${heap.profileId}. The largest share belongs to ${share(heap.topFunctions[0])}. Heap profiles also record every allocation since the start, which finds the code that keeps the garbage collector busy.`,
+      tools: ["analyze_heap", "alloc_hotspots"],
+    });
+
+    begin("looking for goroutine leaks");
+    const goroutineReport = analyzeGoroutines(await captureGoroutines(target, signal), undefined, { minGroupSize: 100, minGrowth: 10 });
+    const suspicious = goroutineReport.suspicious.map((s) => s.message);
+    steps.push({
+      title: "🧵 Look for goroutine leaks",
+      narration: `${goroutineReport.total} goroutines are alive in ${goroutineReport.groups.length} group(s) of identical stacks. ${suspicious.length > 0 ? `Suspicious: ${suspicious.slice(0, 2).join("; ")}.` : "No group is large enough to flag yet."} Capturing twice, some time apart, shows whether a group keeps growing.`,
+      tools: ["capture_goroutine_profile"],
+    });
+
+    begin(`switching to the optimized scenario and capturing ${cpuSeconds}s of CPU`);
+    await switchScenario(target, "optimized");
+    await new Promise((resolve) => setTimeout(resolve, SWITCH_SETTLE_MS));
+    const after = await capture("cpu", cpuSeconds);
+    steps.push({
+      title: "🛠️ Fix the hotspots and profile again",
+      narration: `Switched the running app to its optimized scenario (sort.Ints, an iterative fibonacci and a strings.Builder) through /debug/scenario, then captured ${cpuSeconds}s of CPU again as ${after.profileId}. The hottest function is now ${share(after.topFunctions[0])}.`,
+      tools: ["save_baseline", "check_budgets"],
+    });
+
+    begin("diffing the two CPU profiles");
+    const diff = diffProfiles(
+      readProfile(await resolveProfilePath(cpu.profileId)),
+      readProfile(await resolveProfilePath(after.profileId)),
+      "samples",
+      5,
+    );
+    steps.push({
+      title: "📊 Diff before and after",
+      narration: `${diff.improvements.length > 0 ? `CPU shares that fell, led by the fixed code: ${diff.improvements.slice(0, 3).map(delta).join(", ")}.` : "No function's share of CPU fell."} ${diff.regressions.length > 0 ? `Shares are percentages of each profile, so the rest of the loop grew into the freed time (${diff.regressions.slice(0, 2).map(delta).join(", ")}) without doing more work.` : ""}`.trim(),
+      tools: ["diff_flamegraph", "detect_regressions", "what_changed"],
+    });
+
+    return {
+      source,
+      target,
+      commit: run.commit,
+      cpuSeconds,
+      before: [cpu, heap],
+      after,
+      goroutines: { total: goroutineReport.total, suspicious },
+      diff: { improvements: diff.improvements, regressions: diff.regressions },
+      steps,
+    };
+  } finally {
+    app.kill("SIGKILL");
+    await fs.unlink(binary).catch(() => undefined);
+  }
+}
+
+// The narrated report, one numbered section per step
+export function formatDemo(report: DemoReport): string {
+  const sections = report.steps.map((s, i) => `${i + 1}. ${s.title}\n${s.narration}\n🔧 Try: ${s.tools.join(", ")}`);
+  return `🎬 Profiler tour on the bundled sample app${report.commit ? ` at commit ${report.commit.slice(0, 12)}` : ""}
+
+${sections.join("\n\n")}
+
+💡 Tip: The saved profiles stay in the catalog; open their flamegraphs, or pass ${report.before[0].profileId} and ${report.after.profileId} to diff_flamegraph to see the change drawn.`;
+}
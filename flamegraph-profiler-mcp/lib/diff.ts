@@ -0,0 +1,156 @@
+/**
+ * Differential analysis between a baseline and a comparison profile.
+ */
+import { alignClosures } from "./closures.js";
+import { buildFlameTree, functionStats, percentOf, type ProfileFrame } from "./flamegraph.js";
+import { sampleIndexOf, totalOf, type Profile } from "./pprof.js";
+import type { RateBasis } from "./rates.js";
+
+export interface FunctionDelta {
+  name: string;
+  baselineFlatPct: number;
+  comparisonFlatPct: number;
+  flatDeltaPct: number;
+  baselineCumPct: number;
+  comparisonCumPct: number;
+  cumDeltaPct: number;
+  // Flat value per second or per request, and the change of both values,
+  // when the diff compares rates
+  baselineFlatRate?: number;
+  comparisonFlatRate?: number;
+  flatRateDelta?: number;
+  cumRateDelta?: number;
+}
+
+export interface DiffResult {
+  sampleType: string;
+  unit: string;
+  baselineTotal: number;
+  comparisonTotal: number;
+  // Comparison tree with each frame's delta against the scaled baseline
+  flamegraph: ProfileFrame;
+  regressions: FunctionDelta[];
+  improvements: FunctionDelta[];
+  // Totals per second or per request, when compared as rates
+  rates?: RateBasis & { baselineRate: number; comparisonRate: number; changePct: number };
+}
+
+// Compare two profiles of the same type. Shares are compared as percentages of
+// each profile's total so captures of different lengths line up, and closures
+// that moved between the builds are compared per enclosing function. With a
+// rate basis, functions are ranked by how much their value per second or per
+// request changed instead, which also catches growth spread evenly.
+export function diffProfiles(
+  baselineProfile: Profile,
+  comparisonProfile: Profile,
+  sampleType?: string,
+  limit = 10,
+  rates?: RateBasis,
+): DiffResult {
+  const [baseline, comparison] = alignClosures(baselineProfile, comparisonProfile);
+  const comparisonIndex = sampleIndexOf(comparison, sampleType);
+  const type = comparison.sampleTypes[comparisonIndex];
+  const baselineIndex = sampleIndexOf(baseline, type.type);
+
+  const baselineTotal = totalOf(baseline, baselineIndex);
+  const comparisonTotal = totalOf(comparison, comparisonIndex);
+
+  const flamegraph = buildFlameTree(comparison, comparisonIndex);
+  const baselineTree = buildFlameTree(baseline, baselineIndex);
+  // Baseline values scaled to the comparison's total, or to its window or
+  // request count when comparing rates
+  const scale = rates
+    ? rates.comparison / rates.baseline
+    : baselineTotal === 0 ? 0 : comparisonTotal / baselineTotal;
+  annotateDeltas(flamegraph, baselineTree, scale);
+
+  const deltas = functionDeltas(baseline, baselineIndex, baselineTotal, comparison, comparisonIndex, comparisonTotal, rates);
+  const change = (d: FunctionDelta) => (rates ? d.flatRateDelta! : d.flatDeltaPct);
+  const regressions = deltas
+    .filter((d) => change(d) > 0)
+    .sort((a, b) => change(b) - change(a))
+    .slice(0, limit);
+  const improvements = deltas
+    .filter((d) => change(d) < 0)
+    .sort((a, b) => change(a) - change(b))
+    .slice(0, limit);
+
+  return {
+    sampleType: type.type,
+    unit: type.unit,
+    baselineTotal,
+    comparisonTotal,
+    flamegraph,
+    regressions,
+    improvements,
+    ...(rates ? { rates: totalRates(rates, baselineTotal, comparisonTotal) } : {}),
+  };
+}
+
+function totalRates(rates: RateBasis, baselineTotal: number, comparisonTotal: number): NonNullable<DiffResult["rates"]> {
+  const baselineRate = baselineTotal / rates.baseline;
+  const comparisonRate = comparisonTotal / rates.comparison;
+  return {
+    ...rates,
+    baselineRate: significant(baselineRate),
+    comparisonRate: significant(comparisonRate),
+    changePct: baselineRate === 0 ? 0 : Math.round(((comparisonRate - baselineRate) / baselineRate) * 1000) / 10,
+  };
+}
+
+// Set delta on every frame of the comparison tree from the matching baseline
+// path, its value multiplied by scale
+export function annotateDeltas(frame: ProfileFrame, baseline: ProfileFrame | undefined, scale: number) {
+  frame.delta = frame.value - (baseline ? baseline.value * scale : 0);
+  for (const child of frame.children ?? []) {
+    annotateDeltas(child, baseline?.children?.find((c) => c.name === child.name), scale);
+  }
+}
+
+// Flat and cumulative shares of every function in either profile
+export function functionDeltas(
+  baseline: Profile,
+  baselineIndex: number,
+  baselineTotal: number,
+  comparison: Profile,
+  comparisonIndex: number,
+  comparisonTotal: number,
+  rates?: RateBasis,
+): FunctionDelta[] {
+  const before = new Map(functionStats(baseline, baselineIndex).map((s) => [s.name, s]));
+  const after = new Map(functionStats(comparison, comparisonIndex).map((s) => [s.name, s]));
+  const names = new Set([...before.keys(), ...after.keys()]);
+
+  return [...names].map((name) => {
+    const b = before.get(name);
+    const a = after.get(name);
+    const baselineFlatPct = percentOf(b?.flat ?? 0, baselineTotal);
+    const comparisonFlatPct = percentOf(a?.flat ?? 0, comparisonTotal);
+    const baselineCumPct = percentOf(b?.cum ?? 0, baselineTotal);
+    const comparisonCumPct = percentOf(a?.cum ?? 0, comparisonTotal);
+    return {
+      name,
+      baselineFlatPct,
+      comparisonFlatPct,
+      flatDeltaPct: round2(comparisonFlatPct - baselineFlatPct),
+      baselineCumPct,
+      comparisonCumPct,
+      cumDeltaPct: round2(comparisonCumPct - baselineCumPct),
+      ...(rates ? {
+        baselineFlatRate: significant((b?.flat ?? 0) / rates.baseline),
+        comparisonFlatRate: significant((a?.flat ?? 0) / rates.comparison),
+        flatRateDelta: significant((a?.flat ?? 0) / rates.comparison - (b?.flat ?? 0) / rates.baseline),
+        cumRateDelta: significant((a?.cum ?? 0) / rates.comparison - (b?.cum ?? 0) / rates.baseline),
+      } : {}),
+    };
+  });
+}
+
+function round2(value: number): number {
+  return Math.round(value * 100) / 100;
+}
+
+// Rates span many magnitudes, from nanoseconds per second to objects per request
+function significant(value: number): number {
+  return Number(value.toPrecision(4));
+}
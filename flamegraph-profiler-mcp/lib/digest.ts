@@ -0,0 +1,244 @@
+/**
+ * Weekly digest of profiling trends posted to a Slack incoming webhook.
+ *
+ * The digest is built from the persisted store: findings first seen in the
+ * period, regressions resolved in the period, and data directory usage.
+ */
+import fs from "node:fs/promises";
+import path from "node:path";
+import type { Severity } from "./antipatterns.js";
+import { functionTrend, listCaptures, type Capture } from "./captures.js";
+import { lineChart, type Series } from "./charts.js";
+import { formatFinding, listFindings, type Finding } from "./findings.js";
+import { LANGS, t, type Lang } from "./i18n.js";
+import { dataDir, readJson, writeJson } from "./store.js";
+import { listSuppressions } from "./suppressions.js";
+
+export interface StorageStats {
+  dataDir: string;
+  files: Array<{ name: string; bytes: number }>;
+  totalBytes: number;
+  findings: Record<Finding["status"], number>;
+  activeSuppressions: number;
+}
+
+export interface Digest {
+  from: string;
+  to: string;
+  newHotspots: Finding[];
+  resolvedRegressions: Finding[];
+  // Findings seen again in the period that were already known before it
+  recurring: Finding[];
+  // Top function shares across the period's captures, for the busiest targets
+  functionTrends: Array<{ target: string; profileType: string; series: Series[] }>;
+  storage: StorageStats;
+}
+
+interface DigestState {
+  lastSentAt?: string;
+}
+
+const DIGEST_STATE_FILE = "digest.json";
+
+// Findings listed per digest section
+const SECTION_LIMIT = 10;
+
+// Targets with function trends in a digest
+const TREND_TARGETS = 3;
+
+const SEVERITY_ORDER: Record<Severity, number> = { high: 0, medium: 1, low: 2 };
+
+const DAYS = ["sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"];
+
+function bySeverity(a: Finding, b: Finding): number {
+  return SEVERITY_ORDER[a.severity] - SEVERITY_ORDER[b.severity] || b.occurrenceCount - a.occurrenceCount;
+}
+
+// When a finding was last resolved, from its comment thread
+function resolvedAt(finding: Finding): string | undefined {
+  return [...finding.comments].reverse().find((c) => c.text.startsWith("Resolved"))?.at;
+}
+
+async function directorySize(dir: string): Promise<number> {
+  let bytes = 0;
+  for (const entry of await fs.readdir(dir, { withFileTypes: true, recursive: true }).catch(() => [])) {
+    if (entry.isFile()) {
+      bytes += (await fs.stat(path.join(entry.parentPath, entry.name))).size;
+    }
+  }
+  return bytes;
+}
+
+async function storageStats(findings: Finding[]): Promise<StorageStats> {
+  const dir = dataDir();
+  const entries = await fs.readdir(dir, { withFileTypes: true }).catch(() => []);
+  const files: StorageStats["files"] = [];
+  for (const entry of entries) {
+    if (entry.isFile()) {
+      files.push({ name: entry.name, bytes: (await fs.stat(path.join(dir, entry.name))).size });
+    } else if (entry.isDirectory()) {
+      // Stored profiles and continuous snapshots
+      files.push({ name: `${entry.name}/`, bytes: await directorySize(path.join(dir, entry.name)) });
+    }
+  }
+  const counts = { open: 0, acknowledged: 0, resolved: 0 };
+  for (const finding of findings) {
+    counts[finding.status]++;
+  }
+  return {
+    dataDir: dir,
+    files: files.sort((a, b) => b.bytes - a.bytes),
+    totalBytes: files.reduce((sum, f) => sum + f.bytes, 0),
+    findings: counts,
+    activeSuppressions: (await listSuppressions()).length,
+  };
+}
+
+// Summarize the store for the days leading up to `to`
+export async function buildDigest(days = 7, to = new Date()): Promise<Digest> {
+  const from = new Date(to.getTime() - days * 24 * 60 * 60 * 1000);
+  const inPeriod = (at: string | undefined) => at !== undefined && at >= from.toISOString() && at <= to.toISOString();
+  const findings = await listFindings();
+
+  return {
+    from: from.toISOString(),
+    to: to.toISOString(),
+    newHotspots: findings.filter((f) => inPeriod(f.createdAt) && f.status !== "resolved").sort(bySeverity),
+    resolvedRegressions: findings.filter((f) => f.kind === "regression" && f.status === "resolved" && inPeriod(resolvedAt(f))),
+    recurring: findings
+      .filter((f) => !inPeriod(f.createdAt) && f.status !== "resolved" && inPeriod(f.lastSeenAt))
+      .sort(bySeverity),
+    functionTrends: await functionTrends(inPeriod),
+    storage: await storageStats(findings),
+  };
+}
+
+async function functionTrends(inPeriod: (at: string) => boolean): Promise<Digest["functionTrends"]> {
+  const groups = new Map<string, Capture[]>();
+  for (const capture of await listCaptures()) {
+    if (inPeriod(capture.at) && capture.profileType !== "trace") {
+      const key = `${capture.target}|${capture.profileType}`;
+      groups.set(key, [...(groups.get(key) ?? []), capture]);
+    }
+  }
+  return [...groups.values()]
+    .filter((captures) => captures.length > 1)
+    .sort((a, b) => b.length - a.length)
+    .slice(0, TREND_TARGETS)
+    .map((captures) => ({
+      target: captures[0].target,
+      profileType: captures[0].profileType,
+      series: functionTrend(captures, 3),
+    }));
+}
+
+// SVG line charts of the digest's function trends, for clients that show images
+export function digestCharts(digest: Digest): string[] {
+  return digest.functionTrends.map((trend) =>
+    lineChart(trend.series, { title: `${trend.target} · ${trend.profileType} · top functions`, formatY: (v) => `${Math.round(v)}%`, height: 240 }),
+  );
+}
+
+function formatBytes(bytes: number): string {
+  if (bytes >= 1024 * 1024) return `${(bytes / 1024 / 1024).toFixed(1)} MB`;
+  if (bytes >= 1024) return `${(bytes / 1024).toFixed(1)} KB`;
+  return `${bytes} B`;
+}
+
+function section(title: string, findings: Finding[], lang: Lang): string {
+  const lines = findings.slice(0, SECTION_LIMIT).map((f) => `• ${formatFinding(f, lang)}`);
+  if (findings.length > SECTION_LIMIT) {
+    lines.push(`• ${t(lang, "digest.more", { count: findings.length - SECTION_LIMIT })}`);
+  }
+  return `*${title} (${findings.length})*\n${lines.length > 0 ? lines.join("\n") : `• ${t(lang, "digest.none")}`}`;
+}
+
+function trendSection(trends: Digest["functionTrends"], lang: Lang): string {
+  const lines = trends.flatMap((trend) => [
+    `• ${trend.target} (${trend.profileType})`,
+    ...trend.series.map((s) => {
+      const first = s.points[0].y;
+      const last = s.points[s.points.length - 1].y;
+      return `    ${s.name}: ${first}% → ${last}%`;
+    }),
+  ]);
+  return `*${t(lang, "digest.trends")}*\n${lines.length > 0 ? lines.join("\n") : `• ${t(lang, "digest.noTrends")}`}`;
+}
+
+// Format a digest as Slack mrkdwn (also readable as plain text)
+export function formatDigest(digest: Digest, lang: Lang = "en"): string {
+  const { storage } = digest;
+  return [
+    t(lang, "digest.title", { from: digest.from.slice(0, 10), to: digest.to.slice(0, 10) }),
+    section(t(lang, "digest.newHotspots"), digest.newHotspots, lang),
+    section(t(lang, "digest.resolvedRegressions"), digest.resolvedRegressions, lang),
+    section(t(lang, "digest.recurring"), digest.recurring, lang),
+    trendSection(digest.functionTrends, lang),
+    `*${t(lang, "digest.storage")}*\n• ${t(lang, "digest.files", { size: formatBytes(storage.totalBytes), count: storage.files.length, dir: storage.dataDir })}\n` +
+      `• ${t(lang, "digest.findings", storage.findings)}\n` +
+      `• ${t(lang, "digest.suppressions", { count: storage.activeSuppressions })}`,
+  ].join("\n\n");
+}
+
+// Post a digest to a Slack incoming webhook
+export async function postDigest(digest: Digest, webhookUrl: string, lang: Lang = "en"): Promise<void> {
+  const response = await fetch(webhookUrl, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ text: formatDigest(digest, lang) }),
+  });
+  if (!response.ok) {
+    throw new Error(`Slack webhook returned ${response.status}: ${(await response.text()).slice(0, 200)}`);
+  }
+}
+
+// Most recent scheduled send time at or before `now`
+export function lastScheduledAt(now: Date, day: number, hour: number): Date {
+  const scheduled = new Date(now);
+  scheduled.setHours(hour, 0, 0, 0);
+  scheduled.setDate(scheduled.getDate() - ((scheduled.getDay() - day + 7) % 7));
+  if (scheduled > now) {
+    scheduled.setDate(scheduled.getDate() - 7);
+  }
+  return scheduled;
+}
+
+// Post the digest weekly while the server runs. Configured with
+// PROFILER_SLACK_WEBHOOK, PROFILER_DIGEST_DAY (default monday),
+// PROFILER_DIGEST_HOUR (default 9, local time) and PROFILER_DIGEST_LANG
+// (default en). A digest missed while the server was down is sent on the
+// next check; on-demand posts do not count.
+export function startDigestSchedule(env: NodeJS.ProcessEnv = process.env): NodeJS.Timeout | undefined {
+  const webhookUrl = env.PROFILER_SLACK_WEBHOOK;
+  if (!webhookUrl) {
+    return undefined;
+  }
+  const day = DAYS.indexOf((env.PROFILER_DIGEST_DAY ?? "monday").toLowerCase());
+  const hour = parseInt(env.PROFILER_DIGEST_HOUR ?? "9", 10);
+  if (day < 0 || !(hour >= 0 && hour < 24)) {
+    throw new Error("PROFILER_DIGEST_DAY must be a weekday name and PROFILER_DIGEST_HOUR an hour from 0 to 23");
+  }
+  const lang = (env.PROFILER_DIGEST_LANG ?? "en") as Lang;
+  if (!LANGS.includes(lang)) {
+    throw new Error(`PROFILER_DIGEST_LANG must be one of ${LANGS.join(", ")}`);
+  }
+
+  const check = async () => {
+    try {
+      const due = lastScheduledAt(new Date(), day, hour);
+      const { lastSentAt } = await readJson<DigestState>(DIGEST_STATE_FILE, {});
+      if (!lastSentAt || new Date(lastSentAt) < due) {
+        const digest = await buildDigest();
+        await postDigest(digest, webhookUrl, lang);
+        await writeJson(DIGEST_STATE_FILE, { lastSentAt: digest.to } satisfies DigestState);
+      }
+    } catch (error) {
+      console.error("Weekly digest failed:", error);
+    }
+  };
+
+  void check();
+  const timer = setInterval(check, 60 * 60 * 1000);
+  timer.unref();
+  return timer;
+}
@@ -0,0 +1,224 @@
+/**
+ * Service discovery in (mono)repositories: Go main packages and Dockerfiles,
+ * turned into target and scenario templates for targets.yaml.
+ */
+import fs from "node:fs/promises";
+import path from "node:path";
+
+export interface DiscoveredService {
+  name: string;
+  // Directory of the main package relative to the root, "." for the root itself
+  packageDir?: string;
+  // Import path of the main package, from the nearest go.mod
+  importPath?: string;
+  // Whether the package imports net/http/pprof
+  servesPprof: boolean;
+  // Address the package appears to listen on, from a host:port literal
+  pprofAddress?: string;
+  dockerfile?: string;
+  // Ports the Dockerfile EXPOSEs
+  exposedPorts: number[];
+}
+
+export interface DiscoveryResult {
+  root: string;
+  services: DiscoveredService[];
+  // Directories skipped because they hold vendored or generated code
+  skipped: number;
+}
+
+// Directories never scanned
+const SKIP_DIRS = new Set(["vendor", "node_modules", "testdata", "third_party", "dist", "build"]);
+
+// Files scanned per repository before giving up
+const MAX_FILES = 50_000;
+
+const DEFAULT_PPROF_PORT = 6060;
+
+interface GoPackage {
+  dir: string;
+  servesPprof: boolean;
+  address?: string;
+}
+
+// Walk a repository for main packages, Dockerfiles and go.mod files
+async function walk(root: string): Promise<{ packages: GoPackage[]; dockerfiles: string[]; modules: Map<string, string>; skipped: number }> {
+  const packages: GoPackage[] = [];
+  const dockerfiles: string[] = [];
+  const modules = new Map<string, string>();
+  let skipped = 0;
+  let files = 0;
+
+  const visit = async (dir: string): Promise<void> => {
+    const entries = await fs.readdir(dir, { withFileTypes: true }).catch(() => []);
+    let isMain = false;
+    let servesPprof = false;
+    let address: string | undefined;
+    for (const entry of entries) {
+      if (++files > MAX_FILES) {
+        throw new Error(`More than ${MAX_FILES} files under ${root}; point the scan at a subdirectory`);
+      }
+      const full = path.join(dir, entry.name);
+      if (entry.isDirectory()) {
+        if (entry.name.startsWith(".") || entry.name.startsWith("_")) continue;
+        if (SKIP_DIRS.has(entry.name)) {
+          skipped++;
+          continue;
+        }
+        await visit(full);
+      } else if (entry.name === "go.mod") {
+        const module = (await fs.readFile(full, "utf-8")).match(/^module\s+(\S+)/m)?.[1];
+        if (module) modules.set(dir, module);
+      } else if (entry.name === "Dockerfile" || /^Dockerfile\.|\.Dockerfile$/.test(entry.name)) {
+        dockerfiles.push(full);
+      } else if (entry.name.endsWith(".go") && !entry.name.endsWith("_test.go")) {
+        const source = await fs.readFile(full, "utf-8");
+        if (/^package main\b/m.test(source)) {
+          isMain ||= /^func main\(\)/m.test(source);
+          servesPprof ||= /"net\/http\/pprof"/.test(source);
+          address ??= source.match(/"((?:localhost|127\.0\.0\.1|0\.0\.0\.0)?:\d{2,5})"/)?.[1];
+        }
+      }
+    }
+    if (isMain) {
+      packages.push({ dir, servesPprof, address });
+    }
+  };
+
+  await visit(root);
+  return { packages, dockerfiles, modules, skipped };
+}
+
+function importPathOf(dir: string, modules: Map<string, string>): string | undefined {
+  for (let current = dir; ; current = path.dirname(current)) {
+    const module = modules.get(current);
+    if (module) {
+      const rel = path.relative(current, dir).split(path.sep).join("/");
+      return rel ? `${module}/${rel}` : module;
+    }
+    if (path.dirname(current) === current) return undefined;
+  }
+}
+
+// The main package a Dockerfile builds: one in the same directory, else one
+// whose path the Dockerfile mentions (e.g. `go build ./cmd/api`)
+function packageForDockerfile(dockerfile: string, text: string, root: string, packages: GoPackage[]): GoPackage | undefined {
+  const dir = path.dirname(dockerfile);
+  const sameDir = packages.find((p) => p.dir === dir);
+  if (sameDir) return sameDir;
+  const mentioned = packages
+    .filter((p) => p.dir !== root)
+    .filter((p) => {
+      const rel = path.relative(root, p.dir).split(path.sep).join("/");
+      const relToDockerfile = path.relative(dir, p.dir).split(path.sep).join("/");
+      return [rel, relToDockerfile].some((candidate) => new RegExp(`(^|[\\s./])${candidate.replace(/[.*+?^${}()|[\]\\]/g, "\\$&")}(\\s|/|$)`, "m").test(text));
+    });
+  // Prefer the deepest mention, e.g. cmd/api/server over cmd/api
+  return mentioned.sort((a, b) => b.dir.length - a.dir.length)[0];
+}
+
+// Find the services in a repository
+export async function discoverServices(root: string): Promise<DiscoveryResult> {
+  const resolved = path.resolve(root);
+  if (!(await fs.stat(resolved).catch(() => undefined))?.isDirectory()) {
+    throw new Error(`${resolved} is not a directory`);
+  }
+  const { packages, dockerfiles, modules, skipped } = await walk(resolved);
+
+  const services = new Map<GoPackage | string, DiscoveredService>();
+  const rel = (p: string) => path.relative(resolved, p).split(path.sep).join("/") || ".";
+  for (const pkg of packages) {
+    services.set(pkg, {
+      name: path.basename(pkg.dir === resolved ? (importPathOf(pkg.dir, modules) ?? resolved) : pkg.dir),
+      packageDir: rel(pkg.dir),
+      importPath: importPathOf(pkg.dir, modules),
+      servesPprof: pkg.servesPprof,
+      pprofAddress: pkg.address,
+      exposedPorts: [],
+    });
+  }
+
+  for (const dockerfile of dockerfiles) {
+    const text = await fs.readFile(dockerfile, "utf-8");
+    const exposedPorts = [...text.matchAll(/^\s*EXPOSE\s+(.+)$/gim)]
+      .flatMap((m) => m[1].split(/\s+/))
+      .map((port) => parseInt(port, 10))
+      .filter((port) => port > 0);
+    const pkg = packageForDockerfile(dockerfile, text, resolved, packages);
+    const existing = pkg && services.get(pkg);
+    if (existing && !existing.dockerfile) {
+      existing.dockerfile = rel(dockerfile);
+      existing.exposedPorts = exposedPorts;
+    } else {
+      // A container built from something other than a Go main package here
+      const base = path.basename(dockerfile).replace(/^Dockerfile\.?|\.?Dockerfile$/g, "");
+      services.set(dockerfile, {
+        name: base || path.basename(path.dirname(dockerfile) === resolved ? resolved : path.dirname(dockerfile)),
+        servesPprof: false,
+        dockerfile: rel(dockerfile),
+        exposedPorts,
+      });
+    }
+  }
+
+  // Disambiguate repeated names (e.g. several cmd/server) with the nearest
+  // parent directory other than cmd, e.g. billing-server
+  const all = [...services.values()];
+  const repeated = new Set(all.map((s) => s.name).filter((name, i, names) => names.indexOf(name) !== i));
+  for (const service of all.filter((s) => repeated.has(s.name))) {
+    const where = service.packageDir ?? path.posix.dirname(service.dockerfile ?? "");
+    const parent = where.split("/").slice(0, -1).reverse().find((segment) => segment !== "cmd" && segment !== ".");
+    if (parent) service.name = `${parent}-${service.name}`;
+  }
+
+  return {
+    root: resolved,
+    services: all.sort((a, b) => a.name.localeCompare(b.name)),
+    skipped,
+  };
+}
+
+// Port a service's pprof endpoint is expected on
+function pprofPort(service: DiscoveredService): number {
+  const fromAddress = service.pprofAddress ? parseInt(service.pprofAddress.split(":").pop() ?? "", 10) : NaN;
+  if (fromAddress > 0) return fromAddress;
+  return service.exposedPorts.includes(DEFAULT_PPROF_PORT) || service.exposedPorts.length === 0
+    ? DEFAULT_PPROF_PORT
+    : service.exposedPorts[0];
+}
+
+function yamlString(value: string): string {
+  return /^[\w./@:-]+$/.test(value) && !/^(true|false|null|yes|no|~)$/i.test(value) ? value : JSON.stringify(value);
+}
+
+// targets.yaml template with one target and a CPU and heap scenario per
+// service; values to check are marked with TODO comments
+export function targetsTemplate(result: DiscoveryResult): string {
+  const lines = [
+    "# Profiling targets generated by discover_services. Review the TODOs before use.",
+    "targets:",
+  ];
+  if (result.services.length === 0) {
+    lines.push("  []");
+  }
+  for (const service of result.services) {
+    const port = pprofPort(service);
+    lines.push(`  - name: ${yamlString(service.name)}`);
+    if (service.packageDir) {
+      lines.push(`    package: ${yamlString(service.packageDir)}`);
+      if (service.importPath) lines.push(`    importPath: ${yamlString(service.importPath)}`);
+    }
+    if (service.dockerfile) {
+      lines.push(`    dockerfile: ${yamlString(service.dockerfile)}`);
+      lines.push(`    container: ${yamlString(service.name)}`);
+    }
+    lines.push(`    pprof: localhost:${port}${service.servesPprof ? "" : "  # TODO: import net/http/pprof and serve it on this port"}`);
+    lines.push("    scenarios:");
+    lines.push("      - name: cpu");
+    lines.push("        profileType: cpu");
+    lines.push("        duration: 30");
+    lines.push("      - name: heap");
+    lines.push("        profileType: heap");
+  }
+  return `${lines.join("\n")}\n`;
+}
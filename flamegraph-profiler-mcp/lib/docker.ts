@@ -0,0 +1,152 @@
+/**
+ * Docker containers: finding a container's pprof endpoint, capturing
+ * profiles through a published port or from inside the container, and
+ * reading its resource use.
+ */
+import { execFile } from "node:child_process";
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { promisify } from "node:util";
+import type { Profile } from "./pprof.js";
+import { pprofUrl } from "./target.js";
+
+const execFileAsync = promisify(execFile);
+
+export interface ContainerInfo {
+  id: string;
+  name: string;
+  image: string;
+  // Published ports: container port (e.g. 6060) to a host address (e.g. "127.0.0.1:16060")
+  ports: Record<number, string>;
+  labels: Record<string, string>;
+}
+
+// Capture helper run inside the container: curl, falling back to BusyBox wget
+const EXEC_HELPER = `curl -sfS "$0" 2>/dev/null || wget -qO- "$0"`;
+
+// OCI image label recording the source commit an image was built from
+export const REVISION_LABEL = "org.opencontainers.image.revision";
+
+interface InspectJson {
+  Id: string;
+  Name: string;
+  Config: { Image: string; Labels?: Record<string, string> | null };
+  State: { Running: boolean; Status: string };
+  NetworkSettings: { Ports?: Record<string, Array<{ HostIp: string; HostPort: string }> | null> | null };
+}
+
+function dockerError(error: unknown): Error {
+  if ((error as NodeJS.ErrnoException).code === "ENOENT") {
+    return new Error("docker not found on PATH");
+  }
+  const stderr = (error as { stderr?: string | Buffer }).stderr?.toString().trim();
+  return new Error(stderr || (error instanceof Error ? error.message : String(error)));
+}
+
+// Look up a running container by name or ID
+export async function inspectContainer(container: string): Promise<ContainerInfo> {
+  let inspected: InspectJson;
+  try {
+    const { stdout } = await execFileAsync("docker", ["inspect", "--type", "container", container]);
+    [inspected] = JSON.parse(stdout) as InspectJson[];
+  } catch (error) {
+    throw dockerError(error);
+  }
+  if (!inspected.State.Running) {
+    throw new Error(`Container ${container} is ${inspected.State.Status}, not running`);
+  }
+
+  const ports: Record<number, string> = {};
+  for (const [spec, bindings] of Object.entries(inspected.NetworkSettings.Ports ?? {})) {
+    const [port, protocol] = spec.split("/");
+    const binding = bindings?.[0];
+    if (protocol === "tcp" && binding) {
+      // Ports published on all interfaces are reachable on loopback
+      const host = ["", "0.0.0.0", "::"].includes(binding.HostIp) ? "127.0.0.1" : binding.HostIp;
+      ports[Number(port)] = host.includes(":") ? `[${host}]:${binding.HostPort}` : `${host}:${binding.HostPort}`;
+    }
+  }
+
+  return {
+    id: inspected.Id.slice(0, 12),
+    name: inspected.Name.replace(/^\//, ""),
+    image: inspected.Config.Image,
+    ports,
+    labels: inspected.Config.Labels ?? {},
+  };
+}
+
+// Fetch a pprof endpoint from inside a container with `docker exec`, for ports
+// that are not published. Needs a shell and curl or wget in the image.
+export async function execDownloadProfile(
+  container: string,
+  port: number,
+  profile: string,
+  seconds = 0,
+  signal?: AbortSignal,
+): Promise<string> {
+  const url = pprofUrl(`localhost:${port}`, profile, seconds > 0 ? { seconds } : {}).toString();
+  let stdout: Buffer;
+  try {
+    ({ stdout } = await execFileAsync("docker", ["exec", container, "sh", "-c", EXEC_HELPER, url], {
+      encoding: "buffer",
+      maxBuffer: 512 * 1024 * 1024,
+      timeout: (seconds + 30) * 1000,
+      signal,
+    }));
+  } catch (error) {
+    signal?.throwIfAborted();
+    const reason = dockerError(error).message;
+    throw new Error(`Could not fetch ${url} inside ${container}${reason ? `: ${reason}` : ""}. The image needs sh and curl or wget`);
+  }
+  if (stdout.length === 0) {
+    throw new Error(`${url} returned nothing inside ${container}`);
+  }
+  const file = path.join(os.tmpdir(), `${path.basename(profile)}_${Date.now()}.out`);
+  await fs.writeFile(file, stdout);
+  return file;
+}
+
+// Record container metadata in a profile's comments, shown by `pprof -comments`
+export function annotateWithContainer(profile: Profile, info: ContainerInfo): Profile {
+  return {
+    ...profile,
+    comments: [
+      ...(profile.comments ?? []),
+      `docker.container=${info.name}`,
+      `docker.id=${info.id}`,
+      `docker.image=${info.image}`,
+    ],
+  };
+}
+
+const SIZE_UNITS: Record<string, number> = {
+  b: 1, kb: 1e3, mb: 1e6, gb: 1e9, tb: 1e12, kib: 1024, mib: 1024 ** 2, gib: 1024 ** 3, tib: 1024 ** 4,
+};
+
+// Parse a size as docker prints it, e.g. "12.5MiB" or "1.2GB"
+function parseSize(size: string): number {
+  const match = size.trim().match(/^([\d.]+)\s*([a-z]*)$/i);
+  const factor = match ? SIZE_UNITS[(match[2] || "b").toLowerCase()] : undefined;
+  if (!match || factor === undefined) {
+    throw new Error(`Unexpected size '${size}' from docker stats`);
+  }
+  return Number(match[1]) * factor;
+}
+
+// Current CPU use (percent of one core) and memory use (bytes) of a running
+// container, from `docker stats`
+export async function containerStats(container: string): Promise<{ cpuPct: number; rssBytes: number }> {
+  let stats: { CPUPerc: string; MemUsage: string };
+  try {
+    const { stdout } = await execFileAsync("docker", ["stats", "--no-stream", "--format", "{{json .}}", container]);
+    stats = JSON.parse(stdout.trim().split("\n")[0]) as { CPUPerc: string; MemUsage: string };
+  } catch (error) {
+    throw error instanceof SyntaxError ? new Error(`Unexpected output from docker stats ${container}`) : dockerError(error);
+  }
+  return {
+    cpuPct: Number.parseFloat(stats.CPUPerc),
+    rssBytes: parseSize(stats.MemUsage.split("/")[0]),
+  };
+}
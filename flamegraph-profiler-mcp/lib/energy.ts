@@ -0,0 +1,142 @@
+/**
+ * Energy model - converts CPU time into estimated energy use and emissions.
+ */
+
+export interface EnergyModel {
+  // Deployment region used to look up grid carbon intensity
+  region?: string;
+  // Overrides the region's grid carbon intensity
+  gramsCo2ePerKwh?: number;
+  wattsPerVcpu?: number;
+  // Data centre power usage effectiveness
+  pue?: number;
+  replicas: number;
+}
+
+export interface FunctionEnergy {
+  name: string;
+  percentage: number;
+  monthlyKgCo2e: number;
+}
+
+export interface EnergyEstimate {
+  region: string;
+  gramsCo2ePerKwh: number;
+  cpuSeconds: number;
+  captureWattHours: number;
+  captureGramsCo2e: number;
+  replicas: number;
+  monthlyKwh: number;
+  monthlyKgCo2e: number;
+  functions: FunctionEnergy[];
+  assumptions: string[];
+}
+
+interface EnergyInput {
+  duration: number;
+  cpuSeconds: number;
+  topFunctions: Array<{ name: string; percentage: number }>;
+}
+
+// Approximate grid carbon intensity (gCO2e/kWh) by cloud region, based on
+// published emission factors. Pass gramsCo2ePerKwh for anything else.
+export const REGION_CARBON_INTENSITY: Record<string, number> = {
+  "us-east-1": 379,
+  "us-east-2": 411,
+  "us-west-1": 322,
+  "us-west-2": 322,
+  "ca-central-1": 130,
+  "eu-west-1": 279,
+  "eu-west-2": 225,
+  "eu-central-1": 338,
+  "eu-north-1": 9,
+  "ap-south-1": 708,
+  "ap-southeast-1": 408,
+  "ap-southeast-2": 790,
+  "ap-northeast-1": 506,
+  "sa-east-1": 74,
+};
+
+// Used when no region is given, close to the global grid average
+const DEFAULT_CARBON_INTENSITY = 475;
+const GLOBAL_AVERAGE = "global average";
+
+// Average of the minimum and maximum per-vCPU draw used by common
+// cloud carbon methodologies
+const DEFAULT_WATTS_PER_VCPU = 2.1;
+const DEFAULT_PUE = 1.135;
+const HOURS_PER_MONTH = 730;
+
+// Fail on a region with no known carbon intensity, rather than estimate
+// with a made-up one
+export function checkEnergyModel(model: Pick<EnergyModel, "region" | "gramsCo2ePerKwh">): void {
+  if (model.gramsCo2ePerKwh === undefined && model.region !== undefined && !(model.region in REGION_CARBON_INTENSITY)) {
+    throw new Error(`Unknown region '${model.region}' (known: ${Object.keys(REGION_CARBON_INTENSITY).join(", ")}); pass gramsCo2ePerKwh for other regions`);
+  }
+}
+
+// Estimate energy use and emissions for a CPU capture and project it monthly
+export function estimateEnergy(input: EnergyInput, model: EnergyModel): EnergyEstimate | null {
+  checkEnergyModel(model);
+  if (input.duration <= 0) {
+    return null;
+  }
+
+  const region = model.region ?? (model.gramsCo2ePerKwh === undefined ? GLOBAL_AVERAGE : "unknown");
+  const gramsCo2ePerKwh = model.gramsCo2ePerKwh
+    ?? REGION_CARBON_INTENSITY[region]
+    ?? DEFAULT_CARBON_INTENSITY;
+  const watts = model.wattsPerVcpu ?? DEFAULT_WATTS_PER_VCPU;
+  const pue = model.pue ?? DEFAULT_PUE;
+
+  const captureWattHours = (input.cpuSeconds * watts * pue) / 3600;
+  const captureGramsCo2e = (captureWattHours / 1000) * gramsCo2ePerKwh;
+
+  // Scale the capture's average vCPU use to a month of every replica
+  const vcpus = input.cpuSeconds / input.duration;
+  const monthlyKwh = (vcpus * watts * pue * HOURS_PER_MONTH * model.replicas) / 1000;
+  const monthlyKgCo2e = (monthlyKwh * gramsCo2ePerKwh) / 1000;
+
+  return {
+    region,
+    gramsCo2ePerKwh,
+    cpuSeconds: input.cpuSeconds,
+    captureWattHours: round(captureWattHours, 4),
+    captureGramsCo2e: round(captureGramsCo2e, 4),
+    replicas: model.replicas,
+    monthlyKwh: round(monthlyKwh, 2),
+    monthlyKgCo2e: round(monthlyKgCo2e, 2),
+    functions: input.topFunctions.map((f) => ({
+      name: f.name,
+      percentage: f.percentage,
+      monthlyKgCo2e: round((f.percentage / 100) * monthlyKgCo2e, 3),
+    })),
+    assumptions: [
+      `${watts}W per busy vCPU with a PUE of ${pue}`,
+      model.gramsCo2ePerKwh !== undefined
+        ? `${gramsCo2ePerKwh} gCO2e/kWh grid intensity (supplied)`
+        : region === GLOBAL_AVERAGE
+          ? `${gramsCo2ePerKwh} gCO2e/kWh grid intensity, the global average, as no region was given`
+          : `${gramsCo2ePerKwh} gCO2e/kWh grid intensity for region "${region}"`,
+      `${model.replicas} replica(s) running the same workload ${HOURS_PER_MONTH} hours per month`,
+      "Only CPU energy is counted; memory, storage, and networking are excluded",
+    ],
+  };
+}
+
+function round(value: number, places: number): number {
+  const scale = 10 ** places;
+  return Math.round(value * scale) / scale;
+}
+
+// Format an energy estimate as lines for a tool's text summary
+export function formatEnergyEstimate(estimate: EnergyEstimate, limit = 5): string {
+  const lines = [
+    `🌱 Estimated Energy: ${estimate.captureWattHours} Wh (${estimate.captureGramsCo2e} gCO2e) for this capture`,
+    `   Monthly projection: ${estimate.monthlyKwh} kWh, ${estimate.monthlyKgCo2e} kgCO2e across ${estimate.replicas} replica(s) ${estimate.region === GLOBAL_AVERAGE ? "at the global average grid intensity" : `in ${estimate.region}`}`,
+    ...estimate.functions
+      .slice(0, limit)
+      .map((f) => `   ${f.name}: ${f.monthlyKgCo2e} kgCO2e/month (${f.percentage}%)`),
+  ];
+  return lines.join("\n");
+}
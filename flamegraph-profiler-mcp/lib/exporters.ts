@@ -0,0 +1,289 @@
+/**
+ * Finding exporters: destinations findings are sent to as they are recorded,
+ * whatever detected them. Each exporter type is registered with
+ * registerFindingExporter; the server config lists the exporters to fan out
+ * to, each with its type's settings and its own filters:
+ *
+ *   exporters:
+ *     - type: webhook
+ *       url: https://hooks.slack.com/services/...
+ *       minSeverity: medium
+ *     - type: sarif
+ *       file: findings.sarif
+ *     - type: ticket
+ *       kinds: [regression]
+ *       minSeverity: high
+ *     - type: jsonl
+ *
+ * Exports run in the background after findings are stored; a failing
+ * exporter is logged and does not hold up the others or the tool call.
+ */
+import fs from "node:fs/promises";
+import path from "node:path";
+import type { Severity } from "./antipatterns.js";
+import { serverConfig } from "./config.js";
+import { listFindings, onFindingsRecorded, updateFinding, type Finding, type FindingKind } from "./findings.js";
+import { versioned } from "./schema.js";
+import { dataDir } from "./store.js";
+import { fileTicket, ticketConfig } from "./tickets.js";
+
+// opened: findings as they are first detected or reopen; seen: every
+// detection, recurring findings included
+export const EXPORT_WHEN = ["opened", "seen"] as const;
+export type ExportWhen = (typeof EXPORT_WHEN)[number];
+
+const FINDING_KINDS: readonly FindingKind[] = ["anti-pattern", "regression", "anomaly"];
+const SEVERITIES: readonly Severity[] = ["low", "medium", "high"];
+
+export interface ExporterConfig {
+  type: string;
+  // Only findings of these kinds; all by default
+  kinds?: FindingKind[];
+  // Only findings of at least this severity
+  minSeverity?: Severity;
+  // Default: the type's own, opened for most
+  when?: ExportWhen;
+  // Settings of the type, e.g. a webhook's url
+  settings: Record<string, unknown>;
+}
+
+export interface FindingExporter {
+  // Send findings that passed the exporter's filters
+  export(findings: Finding[]): Promise<void>;
+}
+
+export interface ExporterType {
+  // Settings the type takes, so unknown keys in the config are caught
+  settings: string[];
+  when: ExportWhen;
+  // Build an exporter from its settings, failing on ones it cannot work
+  // with; matches applies the exporter's filters, for types that export
+  // more than the findings handed to them
+  create(settings: Record<string, unknown>, matches: (finding: Finding) => boolean): FindingExporter;
+}
+
+const TYPES = new Map<string, ExporterType>();
+
+// Make an exporter type available to the server config. Register before
+// startFindingExports runs, e.g. from a module main.ts imports.
+export function registerFindingExporter(name: string, type: ExporterType): void {
+  if (TYPES.has(name)) {
+    throw new Error(`Finding exporter ${name} is already registered`);
+  }
+  TYPES.set(name, type);
+}
+
+export function exporterTypes(): string[] {
+  return [...TYPES.keys()];
+}
+
+function stringSetting(settings: Record<string, unknown>, name: string, required: boolean): string | undefined {
+  const value = settings[name];
+  if (value === undefined || value === null) {
+    if (required) {
+      throw new Error(`needs ${name}`);
+    }
+    return undefined;
+  }
+  if (typeof value !== "string" || value === "") {
+    throw new Error(`${name} must be a string`);
+  }
+  return value;
+}
+
+// Files are relative to the data directory
+function exportPath(file: string): string {
+  return path.resolve(dataDir(), file);
+}
+
+// POST { text, findings } to a URL; the text summary is what Slack and most
+// chat webhooks display
+registerFindingExporter("webhook", {
+  settings: ["url", "headers"],
+  when: "opened",
+  create(settings) {
+    const url = stringSetting(settings, "url", true)!;
+    const headers = settings.headers ?? {};
+    if (typeof headers !== "object" || Array.isArray(headers) || Object.values(headers).some((v) => typeof v !== "string")) {
+      throw new Error("headers must be a mapping of header names to values");
+    }
+    return {
+      async export(findings) {
+        const text = [
+          `🔎 ${findings.length} profiling finding(s):`,
+          ...findings.map((f) => `• ${f.title} [${f.id}, ${f.severity}]`),
+        ].join("\n");
+        const response = await fetch(url, {
+          method: "POST",
+          headers: { "Content-Type": "application/json", ...(headers as Record<string, string>) },
+          body: JSON.stringify({ text, findings }),
+        });
+        if (!response.ok) {
+          throw new Error(`Webhook returned ${response.status}: ${(await response.text()).slice(0, 200)}`);
+        }
+      },
+    };
+  },
+});
+
+const SARIF_LEVELS: Record<Severity, string> = { high: "error", medium: "warning", low: "note" };
+
+// SARIF 2.1.0 log of the findings that are not resolved, rewritten on each
+// export for code scanning and other static-analysis dashboards. Findings
+// name a function rather than a file, so results carry logical locations.
+export function sarifLog(findings: Finding[]): object {
+  const rules = [...new Map(findings.map((f) => [f.pattern, f])).values()];
+  return {
+    $schema: "https://json.schemastore.org/sarif-2.1.0.json",
+    version: "2.1.0",
+    runs: [{
+      tool: {
+        driver: {
+          name: "flamegraph-profiler",
+          rules: rules.map((f) => ({ id: f.pattern, name: f.pattern, properties: { kind: f.kind } })),
+        },
+      },
+      results: findings.map((f) => ({
+        ruleId: f.pattern,
+        level: SARIF_LEVELS[f.severity],
+        message: { text: `${f.title}. ${f.detail}` },
+        locations: [{ logicalLocations: [{ fullyQualifiedName: f.function, kind: "function" }] }],
+        partialFingerprints: { "profilerFinding/v1": f.fingerprint },
+        properties: {
+          id: f.id,
+          status: f.status,
+          callPath: f.callPath,
+          owners: f.owners ?? [],
+          occurrenceCount: f.occurrenceCount ?? 1,
+          source: f.source,
+          ...(f.ticket ? { ticket: f.ticket.url } : {}),
+        },
+      })),
+    }],
+  };
+}
+
+registerFindingExporter("sarif", {
+  settings: ["file"],
+  when: "seen",
+  create(settings, matches) {
+    const file = exportPath(stringSetting(settings, "file", false) ?? "findings.sarif");
+    return {
+      async export() {
+        const findings = (await listFindings()).filter((f) => f.status !== "resolved" && matches(f));
+        await fs.mkdir(path.dirname(file), { recursive: true });
+        const tmp = `${file}.${process.pid}.tmp`;
+        await fs.writeFile(tmp, JSON.stringify(sarifLog(findings), null, 2));
+        await fs.rename(tmp, file);
+      },
+    };
+  },
+});
+
+// File a ticket with the provider file_ticket uses for each finding that has
+// none yet, and record it on the finding
+registerFindingExporter("ticket", {
+  settings: [],
+  when: "opened",
+  create() {
+    ticketConfig();
+    return {
+      async export(findings) {
+        for (const finding of findings.filter((f) => !f.ticket)) {
+          const ticket = await fileTicket(finding);
+          await updateFinding(finding.id, (f) => {
+            f.ticket = ticket;
+            f.comments.push({ author: "profiler", text: `Filed ${ticket.provider} ticket ${ticket.id}: ${ticket.url}`, at: new Date().toISOString() });
+          });
+        }
+      },
+    };
+  },
+});
+
+// One versioned finding report per line, appended to a file or written to
+// standard output
+registerFindingExporter("jsonl", {
+  settings: ["file"],
+  when: "opened",
+  create(settings) {
+    const file = stringSetting(settings, "file", false);
+    const target = file === undefined || file === "-" ? undefined : exportPath(file);
+    return {
+      async export(findings) {
+        const lines = findings.map((f) => `${JSON.stringify(versioned("finding", f))}\n`).join("");
+        if (!target) {
+          process.stdout.write(lines);
+          return;
+        }
+        await fs.mkdir(path.dirname(target), { recursive: true });
+        await fs.appendFile(target, lines);
+      },
+    };
+  },
+});
+
+interface ActiveExporter {
+  name: string;
+  when: ExportWhen;
+  matches: (finding: Finding) => boolean;
+  exporter: FindingExporter;
+}
+
+function createExporters(configs: ExporterConfig[]): ActiveExporter[] {
+  return configs.map((config, i) => {
+    const name = `exporters[${i}] (${config.type})`;
+    const type = TYPES.get(config.type);
+    if (!type) {
+      throw new Error(`exporters[${i}]: unknown type '${config.type}' (available: ${exporterTypes().join(", ")})`);
+    }
+    const unknown = Object.keys(config.settings).filter((key) => !type.settings.includes(key));
+    if (unknown.length > 0) {
+      throw new Error(`${name}: unknown setting ${unknown.join(", ")}${type.settings.length > 0 ? ` (expected ${type.settings.join(", ")})` : ""}`);
+    }
+    const badKind = config.kinds?.find((kind) => !FINDING_KINDS.includes(kind));
+    if (badKind !== undefined) {
+      throw new Error(`${name}: unknown kind '${badKind}' (available: ${FINDING_KINDS.join(", ")})`);
+    }
+    if (config.minSeverity !== undefined && !SEVERITIES.includes(config.minSeverity)) {
+      throw new Error(`${name}: unknown minSeverity '${config.minSeverity}' (available: ${SEVERITIES.join(", ")})`);
+    }
+    if (config.when !== undefined && !EXPORT_WHEN.includes(config.when)) {
+      throw new Error(`${name}: unknown when '${config.when}' (available: ${EXPORT_WHEN.join(", ")})`);
+    }
+    const minRank = SEVERITIES.indexOf(config.minSeverity ?? "low");
+    const matches = (finding: Finding) =>
+      (!config.kinds || config.kinds.includes(finding.kind)) && SEVERITIES.indexOf(finding.severity) >= minRank;
+    try {
+      return { name, when: config.when ?? type.when, matches, exporter: type.create(config.settings, matches) };
+    } catch (error) {
+      throw new Error(`${name}: ${error instanceof Error ? error.message : error}`);
+    }
+  });
+}
+
+// Fail on an exporter the server could not send findings to
+export function checkExporterConfig(configs: ExporterConfig[]): void {
+  createExporters(configs);
+}
+
+// Send findings to the configured exporters as they are recorded
+export function startFindingExports(configs: ExporterConfig[] = serverConfig().exporters): void {
+  const exporters = createExporters(configs);
+  if (exporters.length === 0) {
+    return;
+  }
+  onFindingsRecorded(async (recorded, opened) => {
+    await Promise.all(exporters.map(async ({ name, when, matches, exporter }) => {
+      const findings = (when === "opened" ? opened : recorded).filter(matches);
+      if (findings.length === 0) {
+        return;
+      }
+      try {
+        await exporter.export(findings);
+      } catch (error) {
+        console.error(`Exporting ${findings.length} finding(s) to ${name} failed:`, error);
+      }
+    }));
+  });
+}
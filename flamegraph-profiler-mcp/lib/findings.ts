@@ -0,0 +1,282 @@
+/**
+ * Findings - persisted anti-patterns, regressions and anomalies with a review workflow.
+ */
+import { createHash, randomBytes } from "node:crypto";
+import type { AntiPattern, Severity } from "./antipatterns.js";
+import type { FunctionDelta } from "./diff.js";
+import { patternText, t, type Lang } from "./i18n.js";
+import { ownerMatches } from "./owners.js";
+import { readJson, updateJson } from "./store.js";
+import type { Ticket } from "./tickets.js";
+
+export type FindingKind = "anti-pattern" | "regression" | "anomaly";
+export type FindingStatus = "open" | "acknowledged" | "resolved";
+
+export interface FindingComment {
+  author: string;
+  text: string;
+  at: string;
+}
+
+export interface FindingOccurrence {
+  at: string;
+  source: string;
+  percentage: number;
+}
+
+export interface Finding {
+  id: string;
+  // Stable identity of the issue across captures
+  fingerprint: string;
+  kind: FindingKind;
+  // Anti-pattern rule, "regression", or "anomaly:<target>/<type>" for anomalies
+  pattern: string;
+  title: string;
+  function: string;
+  callPath: string[];
+  detail: string;
+  // Values the title and detail are written from, for rendering them in other languages
+  facts?: Record<string, string | number>;
+  severity: Severity;
+  status: FindingStatus;
+  assignee?: string;
+  // Owning teams from CODEOWNERS or the ownership mapping
+  owners?: string[];
+  // Tracker ticket filed for this finding
+  ticket?: Ticket;
+  // Profile or comparison the finding was detected in
+  source: string;
+  comments: FindingComment[];
+  // Most recent occurrences; occurrenceCount keeps the full tally
+  occurrences: FindingOccurrence[];
+  occurrenceCount: number;
+  createdAt: string;
+  updatedAt: string;
+  lastSeenAt: string;
+}
+
+export type NewFinding = Pick<
+  Finding,
+  "kind" | "pattern" | "title" | "function" | "callPath" | "detail" | "facts" | "severity" | "source" | "owners"
+> & { percentage: number };
+
+export interface FindingFilter {
+  status?: FindingStatus;
+  kind?: FindingKind;
+  assignee?: string;
+  owner?: string;
+  function?: string;
+}
+
+const FINDINGS_FILE = "findings.json";
+
+// Regressions smaller than this many percentage points are not recorded
+export const REGRESSION_THRESHOLD_PTS = 2;
+
+// Occurrence history kept per finding
+const MAX_OCCURRENCES = 50;
+
+// Called after each recordFindings with the findings it recorded and those
+// of them that opened: new ones, and resolved ones that recurred
+export type FindingsListener = (recorded: Finding[], opened: Finding[]) => Promise<void>;
+
+const listeners: FindingsListener[] = [];
+
+// Run a listener, e.g. the finding exporters, on every recording without
+// holding up the caller; its failures are logged
+export function onFindingsRecorded(listener: FindingsListener): void {
+  listeners.push(listener);
+}
+
+// Fingerprint a finding by what it is and where it happens, ignoring how big
+// it was, so repeated captures of the same issue map to one finding.
+export function fingerprintOf(finding: Pick<NewFinding, "kind" | "pattern" | "function" | "callPath">): string {
+  return createHash("sha256")
+    .update([finding.kind, finding.pattern, finding.function, finding.callPath.join(">")].join("|"))
+    .digest("hex")
+    .slice(0, 16);
+}
+
+export function findingFromAntiPattern(pattern: AntiPattern, source: string): NewFinding {
+  return {
+    kind: "anti-pattern",
+    pattern: pattern.pattern,
+    title: `${pattern.title} in ${pattern.function}`,
+    function: pattern.function,
+    callPath: pattern.callPath,
+    owners: pattern.owners,
+    percentage: pattern.percentage,
+    detail: `${pattern.percentage}% observed in ${pattern.observedIn}. ${pattern.suggestion}`,
+    facts: { observedIn: pattern.observedIn, percentage: pattern.percentage },
+    severity: pattern.severity,
+    source,
+  };
+}
+
+export function findingFromRegression(delta: FunctionDelta, callPath: string[], source: string): NewFinding {
+  return {
+    kind: "regression",
+    pattern: "regression",
+    title: `${delta.name} grew from ${delta.baselineFlatPct}% to ${delta.comparisonFlatPct}%`,
+    function: delta.name,
+    callPath,
+    percentage: delta.flatDeltaPct,
+    detail: `Flat share +${delta.flatDeltaPct} pts, cumulative ${delta.cumDeltaPct > 0 ? "+" : ""}${delta.cumDeltaPct} pts.`,
+    facts: {
+      baseline: delta.baselineFlatPct,
+      comparison: delta.comparisonFlatPct,
+      flat: delta.flatDeltaPct,
+      cum: `${delta.cumDeltaPct > 0 ? "+" : ""}${delta.cumDeltaPct}`,
+    },
+    severity: delta.flatDeltaPct >= 10 ? "high" : delta.flatDeltaPct >= 5 ? "medium" : "low",
+    source,
+  };
+}
+
+// Record detected findings. A finding whose fingerprint is already known gets
+// a new occurrence instead of a duplicate; resolved findings that recur reopen.
+export async function recordFindings(findings: NewFinding[]): Promise<Finding[]> {
+  if (findings.length === 0) {
+    return [];
+  }
+  const opened = new Set<string>();
+  const stored = await updateJson<Finding[], Finding[]>(FINDINGS_FILE, [], (all) => {
+    const now = new Date().toISOString();
+    const recorded = new Map<string, Finding>();
+
+    for (const { percentage, ...detected } of findings) {
+      const fingerprint = fingerprintOf(detected);
+      const occurrence = { at: now, source: detected.source, percentage };
+      let finding = all.find((f) => f.fingerprint === fingerprint);
+
+      if (finding) {
+        finding.occurrences = [...(finding.occurrences ?? []), occurrence].slice(-MAX_OCCURRENCES);
+        finding.occurrenceCount = (finding.occurrenceCount ?? 1) + 1;
+        finding.title = detected.title;
+        finding.detail = detected.detail;
+        finding.facts = detected.facts;
+        finding.severity = detected.severity;
+        finding.source = detected.source;
+        finding.owners = detected.owners ?? finding.owners;
+        finding.lastSeenAt = now;
+        finding.updatedAt = now;
+        if (finding.status === "resolved") {
+          finding.status = "open";
+          opened.add(finding.id);
+          finding.comments.push({ author: "profiler", text: "Reopened: detected again", at: now });
+        }
+      } else {
+        finding = {
+          ...detected,
+          id: `f_${randomBytes(4).toString("hex")}`,
+          fingerprint,
+          status: "open",
+          comments: [],
+          occurrences: [occurrence],
+          occurrenceCount: 1,
+          createdAt: now,
+          updatedAt: now,
+          lastSeenAt: now,
+        };
+        all.push(finding);
+        opened.add(finding.id);
+      }
+      recorded.set(finding.id, finding);
+    }
+
+    return [...recorded.values()];
+  });
+  for (const listener of listeners) {
+    listener(stored, stored.filter((f) => opened.has(f.id))).catch((error) => console.error("Finding listener failed:", error));
+  }
+  return stored;
+}
+
+// Add findings recorded elsewhere, such as in a bundle, that are not known
+// here by fingerprint; known ones keep their local history and status
+export async function importFindings(findings: Finding[]): Promise<Finding[]> {
+  if (findings.length === 0) {
+    return [];
+  }
+  return updateJson<Finding[], Finding[]>(FINDINGS_FILE, [], (all) => {
+    const added = findings.filter((f) => !all.some((known) => known.fingerprint === f.fingerprint));
+    for (const finding of added) {
+      all.push({ ...finding, id: all.some((known) => known.id === finding.id) ? `f_${randomBytes(4).toString("hex")}` : finding.id });
+    }
+    return added;
+  });
+}
+
+export async function listFindings(filter: FindingFilter = {}): Promise<Finding[]> {
+  const all = await readJson<Finding[]>(FINDINGS_FILE, []);
+  const { owner } = filter;
+  return all.filter((f) =>
+    (!filter.status || f.status === filter.status) &&
+    (!filter.kind || f.kind === filter.kind) &&
+    (!filter.assignee || f.assignee === filter.assignee) &&
+    (!owner || (f.owners ?? []).some((o) => ownerMatches(o, owner))) &&
+    (!filter.function || f.function.includes(filter.function)),
+  );
+}
+
+export async function getFinding(id: string): Promise<Finding> {
+  const finding = (await readJson<Finding[]>(FINDINGS_FILE, [])).find((f) => f.id === id);
+  if (!finding) {
+    throw new Error(`Finding ${id} not found`);
+  }
+  return finding;
+}
+
+// Apply a change to one finding and persist it
+export async function updateFinding(id: string, change: (finding: Finding) => void): Promise<Finding> {
+  return updateJson<Finding[], Finding>(FINDINGS_FILE, [], (all) => {
+    const finding = all.find((f) => f.id === id);
+    if (!finding) {
+      throw new Error(`Finding ${id} not found`);
+    }
+    change(finding);
+    finding.updatedAt = new Date().toISOString();
+    return finding;
+  });
+}
+
+// A finding's title and detail in the given language. Findings recorded
+// before facts were kept, and rules without a translation, stay in English.
+export function localizeFinding(finding: Pick<Finding, "kind" | "pattern" | "function" | "title" | "detail" | "facts">, lang: Lang): { title: string; detail: string } {
+  const facts = finding.facts;
+  if (lang === "en" || !facts) {
+    return { title: finding.title, detail: finding.detail };
+  }
+  if (finding.kind === "regression") {
+    return {
+      title: t(lang, "finding.regression.title", { function: finding.function, ...facts }),
+      detail: t(lang, "finding.regression.detail", facts),
+    };
+  }
+  if (finding.kind === "anomaly") {
+    return {
+      title: t(lang, `finding.anomaly.${facts.direction === "drop" ? "drop" : "spike"}`, { function: finding.function, ...facts, resource: t(lang, facts.profileType === "heap" ? "resource.heap" : "resource.cpu") }),
+      detail: t(lang, "finding.anomaly.detail", facts),
+    };
+  }
+  const text = patternText(lang, finding.pattern);
+  if (!text) {
+    return { title: finding.title, detail: finding.detail };
+  }
+  return {
+    title: t(lang, "finding.antiPattern.title", { title: text.title, function: finding.function }),
+    detail: t(lang, "finding.antiPattern.detail", { ...facts, suggestion: text.suggestion }),
+  };
+}
+
+// Format a finding as a single line for tool output
+export function formatFinding(finding: Finding, lang: Lang = "en"): string {
+  const assignee = finding.assignee ? ` → ${finding.assignee}` : "";
+  const owners = finding.owners && finding.owners.length > 0 ? ` [${finding.owners.join(" ")}]` : "";
+  const seen = finding.occurrenceCount ?? 1;
+  const times = seen > 1 ? ` (${t(lang, "finding.seen", { count: seen })})` : "";
+  const ticket = finding.ticket ? ` 🎫 ${finding.ticket.id}` : "";
+  const status = t(lang, `status.${finding.status}`);
+  const severity = t(lang, `severity.${finding.severity}`);
+  return `[${finding.id}] (${status}, ${severity}) ${localizeFinding(finding, lang).title}${times}${owners}${assignee}${ticket}`;
+}
@@ -0,0 +1,228 @@
+/**
+ * Test flakiness against runtime activity: run a package's tests several
+ * times with an execution trace each, and check whether the tests whose
+ * durations vary do so in step with GC or scheduler activity of the run
+ * (a noisy environment) or on their own (the test itself).
+ */
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { execGo } from "./goapp.js";
+import { duringWindow, noProgress, type ProgressReporter } from "./progress.js";
+import { updateJson } from "./store.js";
+import { readTrace } from "./trace.js";
+
+export interface Repetition {
+  run: number;
+  // Test name → duration in seconds, for tests that passed or failed
+  durations: Record<string, number>;
+  failed: string[];
+  // Share of the run's trace spent in GC mark and stop-the-world, in percent
+  gcPct: number;
+  // p90 time from runnable to running, in nanoseconds
+  schedulerP90: number;
+}
+
+export type TestVerdict = "stable" | "noisy-environment" | "variable-test";
+
+export interface TestVariance {
+  name: string;
+  durations: number[];
+  // Mean duration in seconds
+  mean: number;
+  // Coefficient of variation of the durations, in percent
+  cvPct: number;
+  // Pearson correlation of the durations with the runs' GC share and scheduler latency
+  gcCorrelation: number;
+  schedulerCorrelation: number;
+  failures: number;
+  verdict: TestVerdict;
+}
+
+export interface FlakinessReport {
+  package: string;
+  run?: string;
+  repetitions: Repetition[];
+  tests: TestVariance[];
+  cvThresholdPct: number;
+  minCorrelation: number;
+}
+
+const TEST_RUNS_FILE = "test-runs.json";
+
+// Oldest recorded reports beyond this are dropped
+const MAX_TEST_RUNS = 200;
+
+interface TestEvent {
+  Action: string;
+  Test?: string;
+  Elapsed?: number;
+}
+
+// Durations and failures from `go test -json` output. Package-level events
+// (without a Test) and subtests' parents are kept alike.
+export function parseTestEvents(output: string): { durations: Record<string, number>; failed: string[] } {
+  const durations: Record<string, number> = {};
+  const failed: string[] = [];
+  for (const line of output.split("\n")) {
+    if (!line.startsWith("{")) {
+      continue;
+    }
+    let event: TestEvent;
+    try {
+      event = JSON.parse(line) as TestEvent;
+    } catch {
+      continue;
+    }
+    if (!event.Test || (event.Action !== "pass" && event.Action !== "fail")) {
+      continue;
+    }
+    durations[event.Test] = event.Elapsed ?? 0;
+    if (event.Action === "fail") {
+      failed.push(event.Test);
+    }
+  }
+  return { durations, failed };
+}
+
+function mean(values: number[]): number {
+  return values.length === 0 ? 0 : values.reduce((sum, v) => sum + v, 0) / values.length;
+}
+
+function stddev(values: number[]): number {
+  const m = mean(values);
+  return Math.sqrt(mean(values.map((v) => (v - m) ** 2)));
+}
+
+// Pearson correlation coefficient; 0 when either side does not vary
+export function correlation(xs: number[], ys: number[]): number {
+  const mx = mean(xs);
+  const my = mean(ys);
+  let cov = 0;
+  let vx = 0;
+  let vy = 0;
+  for (let i = 0; i < xs.length; i++) {
+    cov += (xs[i] - mx) * (ys[i] - my);
+    vx += (xs[i] - mx) ** 2;
+    vy += (ys[i] - my) ** 2;
+  }
+  return vx === 0 || vy === 0 ? 0 : cov / Math.sqrt(vx * vy);
+}
+
+const round = (value: number, digits = 2) => Math.round(value * 10 ** digits) / 10 ** digits;
+
+// Classify each test that ran in every repetition by how much its duration
+// varies and whether that variance follows the runs' GC or scheduler activity
+export function analyzeRepetitions(
+  repetitions: Repetition[],
+  options: { cvThresholdPct: number; minCorrelation: number },
+): TestVariance[] {
+  const names = Object.keys(repetitions[0]?.durations ?? {}).filter((name) =>
+    repetitions.every((r) => name in r.durations));
+  const gc = repetitions.map((r) => r.gcPct);
+  const scheduler = repetitions.map((r) => r.schedulerP90);
+
+  return names
+    .map((name): TestVariance => {
+      const durations = repetitions.map((r) => r.durations[name]);
+      const m = mean(durations);
+      const cvPct = m === 0 ? 0 : (stddev(durations) / m) * 100;
+      const gcCorrelation = correlation(durations, gc);
+      const schedulerCorrelation = correlation(durations, scheduler);
+      const verdict: TestVerdict = cvPct < options.cvThresholdPct
+        ? "stable"
+        : Math.max(gcCorrelation, schedulerCorrelation) >= options.minCorrelation ? "noisy-environment" : "variable-test";
+      return {
+        name,
+        durations,
+        mean: round(m, 4),
+        cvPct: round(cvPct, 1),
+        gcCorrelation: round(gcCorrelation),
+        schedulerCorrelation: round(schedulerCorrelation),
+        failures: repetitions.filter((r) => r.failed.includes(name)).length,
+        verdict,
+      };
+    })
+    .sort((a, b) => b.cvPct - a.cvPct);
+}
+
+// Run the tests of a package once with an execution trace. go test exits
+// non-zero when a test fails; its JSON output is still used. Cancelling
+// terminates go test and the test binary.
+async function runOnce(packageDir: string, run: string | undefined, traceFile: string, timeout: number, signal?: AbortSignal): Promise<string> {
+  const args = ["test", "-json", "-count=1", `-trace=${traceFile}`, ...(run ? [`-run=${run}`] : []), "."];
+  try {
+    return (await execGo(args, { cwd: packageDir, timeout: timeout * 1000, maxBuffer: 64 * 1024 * 1024, signal })).stdout;
+  } catch (error) {
+    signal?.throwIfAborted();
+    const stdout = (error as { stdout?: string }).stdout ?? "";
+    if (!stdout.includes('"Action"')) {
+      const stderr = (error as { stderr?: string }).stderr?.trim();
+      throw stderr ? new Error(stderr) : error;
+    }
+    return stdout;
+  }
+}
+
+export async function measureFlakiness(options: {
+  packageDir: string;
+  run?: string;
+  repetitions: number;
+  cvThresholdPct: number;
+  minCorrelation: number;
+  timeout: number;
+  progress?: ProgressReporter;
+  signal?: AbortSignal;
+}): Promise<FlakinessReport> {
+  const packageDir = path.resolve(options.packageDir);
+  const repetitions: Repetition[] = [];
+  const started = Date.now();
+  for (let run = 1; run <= options.repetitions; run++) {
+    const traceFile = path.join(os.tmpdir(), `test_trace_${process.pid}_${Date.now()}.out`);
+    try {
+      // Each run's progress starts past the last one's, however long it took
+      const output = await duringWindow(options.progress ?? noProgress, `test run ${run}/${options.repetitions}`, undefined,
+        runOnce(packageDir, options.run, traceFile, options.timeout, options.signal), Math.floor((Date.now() - started) / 1000) + run);
+      const { durations, failed } = parseTestEvents(output);
+      if (Object.keys(durations).length === 0) {
+        throw new Error(`No tests ran in ${packageDir}${options.run ? ` matching '${options.run}'` : ""}`);
+      }
+      const trace = readTrace(traceFile);
+      const gcTime = trace.gc.markTime + trace.gc.stopTheWorld.total;
+      repetitions.push({
+        run,
+        durations,
+        failed,
+        gcPct: trace.duration === 0 ? 0 : round((gcTime / trace.duration) * 100),
+        schedulerP90: trace.schedulerLatency.p90,
+      });
+    } finally {
+      await fs.unlink(traceFile).catch(() => undefined);
+    }
+  }
+
+  const report: FlakinessReport = {
+    package: packageDir,
+    run: options.run,
+    repetitions,
+    tests: analyzeRepetitions(repetitions, options),
+    cvThresholdPct: options.cvThresholdPct,
+    minCorrelation: options.minCorrelation,
+  };
+  await updateJson<Array<FlakinessReport & { at: string }>, void>(TEST_RUNS_FILE, [], (all) => {
+    all.push({ at: new Date().toISOString(), ...report });
+    all.splice(0, Math.max(0, all.length - MAX_TEST_RUNS));
+  });
+  return report;
+}
+
+const VERDICTS: Record<TestVerdict, string> = {
+  "stable": "stable",
+  "noisy-environment": "noisy environment: varies with runtime activity",
+  "variable-test": "the test itself varies",
+};
+
+export function formatTestVariance(t: TestVariance): string {
+  const durations = t.durations.map((d) => `${round(d, 3)}s`).join(", ");
+  return `${t.name}: ${VERDICTS[t.verdict]} (±${t.cvPct}% around ${round(t.mean, 3)}s; r=${t.gcCorrelation} with GC, r=${t.schedulerCorrelation} with scheduler latency; ${durations})${t.failures > 0 ? ` ❌ failed ${t.failures}×` : ""}`;
+}
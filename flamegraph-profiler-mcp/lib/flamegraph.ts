@@ -0,0 +1,305 @@
+/**
+ * Flamegraph trees and per-function statistics built from parsed profiles.
+ */
+import { stackOf, totalOf, type Profile } from "./pprof.js";
+
+export interface ProfileFrame {
+  name: string;
+  value: number;
+  // Change in value against a baseline, set on differential flamegraphs
+  delta?: number;
+  children?: ProfileFrame[];
+}
+
+export interface TopFunction {
+  name: string;
+  percentage: number;
+  samples: number;
+  // Owning teams, when ownership is known
+  owners?: string[];
+}
+
+export interface FunctionStat {
+  name: string;
+  flat: number;
+  cum: number;
+}
+
+// Build a flamegraph tree weighted by one sample type
+export function buildFlameTree(profile: Profile, sampleIndex: number): ProfileFrame {
+  const root: ProfileFrame = { name: "root", value: 0, children: [] };
+  for (const sample of profile.samples) {
+    const value = sample.values[sampleIndex];
+    if (value !== 0) {
+      addStackToTree(root, stackOf(profile, sample), value);
+    }
+  }
+  return root;
+}
+
+// Add a stack trace (root first) to the flamegraph tree
+export function addStackToTree(root: ProfileFrame, stack: string[], value: number) {
+  root.value += value;
+  let current = root;
+
+  for (const frame of stack) {
+    let child = current.children?.find(c => c.name === frame);
+    if (!child) {
+      child = { name: frame, value: 0, children: [] };
+      current.children = current.children || [];
+      current.children.push(child);
+    }
+    child.value += value;
+    current = child;
+  }
+}
+
+// Invert a tree so each root child is a function samples end in, weighted by
+// its self value, and its children are the callers that reach it, like
+// pprof's -inverted views: "who calls md5.New?". Deltas of differential trees
+// are inverted the same way.
+export function invertFlameTree(root: ProfileFrame): ProfileFrame {
+  const inverted: ProfileFrame = { name: root.name, value: root.value, delta: root.delta, children: [] };
+  const withDelta = root.delta !== undefined;
+  const sum = (frames: ProfileFrame[], of: (f: ProfileFrame) => number) => frames.reduce((total, f) => total + of(f), 0);
+  const visit = (frame: ProfileFrame, callers: string[]) => {
+    const children = frame.children ?? [];
+    const self = frame.value - sum(children, (c) => c.value);
+    const selfDelta = withDelta ? (frame.delta ?? 0) - sum(children, (c) => c.delta ?? 0) : 0;
+    if (self !== 0 || selfDelta !== 0) {
+      let current = inverted;
+      for (const name of [frame.name, ...callers]) {
+        let child = current.children?.find((c) => c.name === name);
+        if (!child) {
+          child = { name, value: 0, ...(withDelta ? { delta: 0 } : {}), children: [] };
+          current.children = current.children || [];
+          current.children.push(child);
+        }
+        child.value += self;
+        if (withDelta) {
+          child.delta = (child.delta ?? 0) + selfDelta;
+        }
+        current = child;
+      }
+    }
+    for (const child of children) {
+      visit(child, [frame.name, ...callers]);
+    }
+  };
+  for (const child of root.children ?? []) {
+    visit(child, []);
+  }
+  return inverted;
+}
+
+// A frame of a tree read through get_tree, with its self value alongside
+export interface TreeNode {
+  name: string;
+  value: number;
+  self: number;
+  delta?: number;
+  children?: TreeNode[];
+}
+
+// Copy of a tree cut to maxDepth levels below the root and to frames of at
+// least minFraction of the root's value. Cut frames stay counted in their
+// parent's value, so a parent's value minus its self and children's values
+// is what was cut below it.
+export function pruneFlameTree(
+  root: ProfileFrame,
+  options: { maxDepth: number; minFraction: number },
+): { root: TreeNode; nodes: number; pruned: number } {
+  const threshold = root.value * options.minFraction;
+  let nodes = 0;
+  let pruned = 0;
+  const copy = (frame: ProfileFrame, depth: number): TreeNode => {
+    nodes++;
+    const children = frame.children ?? [];
+    const node: TreeNode = {
+      name: frame.name,
+      value: frame.value,
+      self: frame.value - children.reduce((total, c) => total + c.value, 0),
+      ...(frame.delta !== undefined ? { delta: frame.delta } : {}),
+    };
+    const kept = depth < options.maxDepth ? children.filter((c) => Math.abs(c.value) >= threshold && c.value !== 0) : [];
+    pruned += children.length - kept.length;
+    if (kept.length > 0) {
+      node.children = kept.sort((a, b) => b.value - a.value).map((c) => copy(c, depth + 1));
+    }
+    return node;
+  };
+  return { root: copy(root, 0), nodes, pruned };
+}
+
+// Text equivalent of a flamegraph, for screen readers and clients that show
+// no images: one indented line per frame with its share of the root (and its
+// value, given a formatter), hottest callees first, down to frames of
+// minFraction of the root and at most maxLines lines. Differential trees say
+// by how many points of the total each frame grew or shrank.
+export function describeFlameTree(
+  root: ProfileFrame,
+  options: { formatValue?: (value: number) => string; minFraction?: number; maxLines?: number } = {},
+): string[] {
+  const { formatValue, minFraction = 0.01, maxLines = 40 } = options;
+  const threshold = Math.abs(root.value) * minFraction;
+  const lines: string[] = [];
+  let truncated = false;
+  const visit = (frame: ProfileFrame, depth: number) => {
+    const children = (frame.children ?? []).filter((c) => c.value !== 0 && Math.abs(c.value) >= threshold);
+    for (const child of children.sort((a, b) => b.value - a.value)) {
+      if (lines.length >= maxLines) {
+        truncated = true;
+        return;
+      }
+      const value = formatValue ? ` (${formatValue(child.value)})` : "";
+      const change = child.delta ? `, ${child.delta > 0 ? "grew" : "shrank"} ${Math.abs(percentOf(child.delta, root.value))} pts` : "";
+      lines.push(`${"  ".repeat(depth)}${child.name}: ${percentOf(child.value, root.value)}%${value}${change}`);
+      visit(child, depth + 1);
+    }
+  };
+  visit(root, 0);
+  if (truncated) {
+    lines.push(`… cut at ${maxLines} lines; frames under ${minFraction * 100}% are left out`);
+  } else if (lines.length === 0) {
+    lines.push("No frames");
+  }
+  return lines;
+}
+
+// Eighths of a character cell, for the ends of outline bars
+const PARTIAL_BLOCKS = ["", "▏", "▎", "▍", "▌", "▋", "▊", "▉"];
+
+// Longest frame name, with its indent, before it is cut short in an outline
+const OUTLINE_NAME_WIDTH = 50;
+
+// Flamegraph drawn with text, for terminals and chat clients that show no
+// images: one line per frame, indented by depth, with a bar of block
+// characters over the frame's span of the graph, which is width columns
+// wide. Callees' bars start where their caller's does, hottest first, so the
+// outline keeps the picture's proportions and nesting. Frames below
+// minFraction of the root and lines past maxLines are left out, as in
+// describeFlameTree.
+export function flameOutline(
+  root: ProfileFrame,
+  options: { width?: number; formatValue?: (value: number) => string; minFraction?: number; maxLines?: number } = {},
+): string[] {
+  const { width = 60, formatValue, minFraction = 0.01, maxLines = 40 } = options;
+  if (root.value <= 0) {
+    return ["No frames"];
+  }
+  const threshold = root.value * minFraction;
+  const rows: Array<{ label: string; start: number; frame: ProfileFrame }> = [{ label: "total", start: 0, frame: root }];
+  let truncated = false;
+  const visit = (frame: ProfileFrame, depth: number, start: number) => {
+    let at = start;
+    const children = (frame.children ?? []).filter((c) => c.value > 0).sort((a, b) => b.value - a.value);
+    for (const child of children) {
+      if (child.value < threshold) {
+        return;
+      }
+      if (rows.length > maxLines) {
+        truncated = true;
+        return;
+      }
+      rows.push({ label: `${"  ".repeat(depth)}${child.name}`, start: at, frame: child });
+      visit(child, depth + 1, at);
+      at += child.value;
+    }
+  };
+  visit(root, 0, 0);
+
+  const nameWidth = Math.min(OUTLINE_NAME_WIDTH, Math.max(...rows.map((r) => r.label.length)));
+  const lines = rows.map(({ label, start, frame }) => {
+    const lead = Math.round((start / root.value) * width);
+    const eighths = Math.max(1, Math.round((frame.value / root.value) * width * 8));
+    const bar = `${" ".repeat(lead)}${"█".repeat(Math.floor(eighths / 8))}${PARTIAL_BLOCKS[eighths % 8]}`.slice(0, width);
+    const name = label.length > nameWidth ? `${label.slice(0, nameWidth - 1)}…` : label;
+    const value = formatValue ? ` (${formatValue(frame.value)})` : "";
+    const change = frame.delta ? `, ${frame.delta > 0 ? "grew" : "shrank"} ${Math.abs(percentOf(frame.delta, root.value))} pts` : "";
+    return `${name.padEnd(nameWidth)} │${bar.padEnd(width)}│ ${percentOf(frame.value, root.value)}%${value}${change}`;
+  });
+  if (truncated) {
+    lines.push(`… cut at ${maxLines} lines; frames under ${minFraction * 100}% are left out`);
+  }
+  return lines;
+}
+
+// Get maximum depth of the flamegraph tree
+export function getMaxDepth(frame: ProfileFrame, currentDepth = 0): number {
+  if (!frame.children || frame.children.length === 0) {
+    return currentDepth;
+  }
+  return Math.max(...frame.children.map(child => getMaxDepth(child, currentDepth + 1)));
+}
+
+// Compute flat (self) and cumulative values per function, sorted by flat value
+export function functionStats(profile: Profile, sampleIndex: number): FunctionStat[] {
+  const stats = new Map<string, FunctionStat>();
+  const statFor = (name: string) => {
+    let stat = stats.get(name);
+    if (!stat) {
+      stat = { name, flat: 0, cum: 0 };
+      stats.set(name, stat);
+    }
+    return stat;
+  };
+
+  for (const sample of profile.samples) {
+    const value = sample.values[sampleIndex];
+    if (value === 0) {
+      continue;
+    }
+    const stack = stackOf(profile, sample);
+    if (stack.length === 0) {
+      continue;
+    }
+    statFor(stack[stack.length - 1]).flat += value;
+    // Count recursive functions once per sample
+    for (const name of new Set(stack)) {
+      statFor(name).cum += value;
+    }
+  }
+
+  return [...stats.values()].sort((a, b) => b.flat - a.flat || b.cum - a.cum);
+}
+
+// Top functions by flat value, as shown in the UI
+export function topFunctionsOf(profile: Profile, sampleIndex: number, limit = 10): TopFunction[] {
+  const total = totalOf(profile, sampleIndex) || 1;
+  return functionStats(profile, sampleIndex)
+    .slice(0, limit)
+    .map((stat) => ({
+      name: stat.name,
+      percentage: percentOf(stat.flat, total),
+      samples: stat.flat,
+    }));
+}
+
+// Percentage rounded to two decimals
+export function percentOf(value: number, total: number): number {
+  return total === 0 ? 0 : Math.round((value / total) * 10000) / 100;
+}
+
+// Heaviest call path leading to a function, root first, ending at the function.
+// Recursive frames are collapsed and only the last `depth` frames are kept so
+// the path stays stable between captures.
+export function dominantCallPath(profile: Profile, sampleIndex: number, name: string, depth = 5): string[] {
+  const weights = new Map<string, { path: string[]; value: number }>();
+  for (const sample of profile.samples) {
+    const stack = stackOf(profile, sample);
+    const index = stack.indexOf(name);
+    if (index === -1) {
+      continue;
+    }
+    const path = stack
+      .slice(0, index + 1)
+      .filter((frame, i, frames) => i === 0 || frame !== frames[i - 1])
+      .slice(-depth);
+    const key = path.join(">");
+    const entry = weights.get(key) ?? { path, value: 0 };
+    entry.value += sample.values[sampleIndex];
+    weights.set(key, entry);
+  }
+  const heaviest = [...weights.values()].sort((a, b) => b.value - a.value)[0];
+  return heaviest?.path ?? [name];
+}
@@ -0,0 +1,395 @@
+/**
+ * Garbage collector analysis from an execution trace (`go tool trace
+ * -d=parsed` output) or from the GODEBUG=gctrace=1 lines a run printed to
+ * stderr. Allocation profiles say where memory is allocated; this says what
+ * collecting it costs: stop-the-world pauses, the share of the CPU the
+ * collector takes, how the heap tracks its goal, and how much marking the
+ * allocating goroutines are made to do themselves (mark assists).
+ */
+import { formatValue } from "./pprof.js";
+import { EVENT_LINE, percentiles, type LatencyStats } from "./trace.js";
+import { formatNanos } from "./uprobes.js";
+
+export type GcSource = "trace" | "gctrace";
+
+export interface GcCycle {
+  // Start of the cycle, in nanoseconds from the start of the trace or process
+  at: number;
+  // Stop-the-world time of the cycle, nanoseconds
+  pause: number;
+  // Concurrent mark phase, nanoseconds
+  mark: number;
+  // Heap bytes when marking started, at its end, and still live after it
+  heapStart: number;
+  heapPeak: number;
+  heapLive: number;
+  // Heap size the cycle aimed to finish under
+  heapGoal: number;
+  // Set for cycles started by runtime.GC or debug.FreeOSMemory (gctrace only)
+  forced: boolean;
+}
+
+export interface GcReport {
+  source: GcSource;
+  // Nanoseconds covered
+  duration: number;
+  gomaxprocs: number;
+  cycles: number;
+  forced: number;
+  perSecond: number;
+  pauses: LatencyStats & { total: number };
+  cpu: {
+    // Share of the CPU available to Go (GOMAXPROCS) spent on GC, 0 to 1
+    fraction: number;
+    // CPU nanoseconds in each part of the collector; idle workers only
+    // run on Ps with nothing else to do and are not counted in the fraction
+    pause: number;
+    assist: number;
+    background: number;
+    idle: number;
+  };
+  assists: {
+    // Share of GC CPU spent in mark assists, 0 to 1
+    share: number;
+    // Assists and the goroutines made to do them (traces only)
+    count?: number;
+    goroutines?: number;
+  };
+  heap: {
+    // Live heap after the first and last cycles, and its largest
+    liveFirst: number;
+    liveLast: number;
+    liveMax: number;
+    // Largest heap reached during marking
+    peak: number;
+    goalLast: number;
+    // Cycles whose heap went past their goal
+    overGoal: number;
+  };
+  // Plain-language reading of the numbers, most important first
+  notes: string[];
+  // The last cycles, oldest first
+  history: GcCycle[];
+}
+
+// Cycles kept in a report's history
+const HISTORY = 50;
+
+// Thresholds behind the notes
+const HEAVY_CPU = 0.25;
+const NOTABLE_CPU = 0.1;
+const HEAVY_ASSISTS = 0.2;
+const FREQUENT_CYCLES = 10;
+const LONG_PAUSE_P99 = 1_000_000;
+const SMALL_HEAP = 64 * 1024 * 1024;
+
+const MB = 1024 * 1024;
+
+function round(value: number, digits = 3): number {
+  const scale = 10 ** digits;
+  return Math.round(value * scale) / scale;
+}
+
+// GC report from the text dump of a parsed trace. Pauses are the trace's
+// stop-the-world ranges; each cycle is a concurrent mark phase. GC CPU is the
+// pauses on every P, plus mark assists, plus the time mark workers ran in
+// dedicated or fractional mode (the runtime labels a worker's goroutine with
+// its mode each time it is scheduled). Heap sizes come from the heap metrics
+// the runtime emits as it allocates and when a cycle sets the next goal.
+export function analyzeTraceGc(parsed: string): GcReport {
+  let start: number | undefined;
+  let end = 0;
+  let gomaxprocs = 1;
+  let heap = 0;
+  let goal = 0;
+
+  const cycles: GcCycle[] = [];
+  let marking: GcCycle | undefined;
+  // A cycle whose live heap is taken from the next heap metric after its new goal
+  let settling: GcCycle | undefined;
+  let awaitingGoal = false;
+  let sweepTermination = 0;
+  const pauses: number[] = [];
+  const stwSince = new Map<string, number>();
+
+  const assistSince = new Map<string, number>();
+  const assisted = new Set<string>();
+  let assistCount = 0;
+  let assistTime = 0;
+
+  const workerMode = new Map<number, string>();
+  const runningSince = new Map<number, number>();
+  const workerTime = { background: 0, idle: 0 };
+  const chargeWorker = (id: number, until: number) => {
+    const since = runningSince.get(id);
+    const mode = workerMode.get(id);
+    if (since !== undefined && mode) {
+      workerTime[mode === "idle" ? "idle" : "background"] += until - since;
+    }
+    runningSince.delete(id);
+    workerMode.delete(id);
+  };
+
+  for (const line of parsed.split("\n")) {
+    const event = line.match(EVENT_LINE);
+    if (!event) {
+      continue;
+    }
+    const [, kind, timeText, rest] = event;
+    const time = Number(timeText);
+    start ??= time;
+    end = Math.max(end, time);
+
+    if (kind === "Metric") {
+      const metric = rest.match(/Name="([^"]*)" Value=Value\{Uint64\((\d+)\)\}/);
+      if (!metric) {
+        continue;
+      }
+      const value = Number(metric[2]);
+      if (metric[1] === "/memory/classes/heap/objects:bytes") {
+        heap = value;
+        if (marking) {
+          marking.heapPeak = Math.max(marking.heapPeak, value);
+        }
+        if (settling && !awaitingGoal) {
+          settling.heapLive = value;
+          settling = undefined;
+        }
+      } else if (metric[1] === "/gc/heap/goal:bytes") {
+        goal = value;
+        awaitingGoal = false;
+      } else if (metric[1] === "/sched/gomaxprocs:threads") {
+        gomaxprocs = value;
+      }
+    } else if (kind === "Label") {
+      const label = rest.match(/Label="GC \((\w+)\)" Resource=Goroutine\((\d+)\)/);
+      if (label) {
+        workerMode.set(Number(label[2]), label[1]);
+      }
+    } else if (kind === "StateTransition") {
+      const transition = rest.match(/GoID=(\d+) (\w+)->(\w+)/);
+      if (!transition) {
+        continue;
+      }
+      const id = Number(transition[1]);
+      if (transition[3] === "Running") {
+        runningSince.set(id, time);
+      } else if (transition[2] === "Running") {
+        chargeWorker(id, time);
+      }
+    } else if (kind === "RangeBegin" || kind === "RangeEnd") {
+      const range = rest.match(/Name="([^"]*)" Scope=(\S+)/);
+      if (!range) {
+        continue;
+      }
+      const [, name, scope] = range;
+      if (name === "GC concurrent mark phase") {
+        if (kind === "RangeBegin") {
+          marking = { at: time, pause: sweepTermination, mark: 0, heapStart: heap, heapPeak: heap, heapLive: heap, heapGoal: goal, forced: false };
+          sweepTermination = 0;
+          cycles.push(marking);
+        } else if (marking) {
+          marking.mark = time - marking.at;
+          marking.heapPeak = Math.max(marking.heapPeak, heap);
+          marking.heapLive = heap;
+          settling = marking;
+          awaitingGoal = true;
+          marking = undefined;
+        }
+      } else if (name === "GC mark assist") {
+        if (kind === "RangeBegin") {
+          assistSince.set(scope, time);
+          assisted.add(scope);
+          assistCount++;
+        } else {
+          const since = assistSince.get(scope);
+          if (since !== undefined) {
+            assistTime += time - since;
+            assistSince.delete(scope);
+          }
+        }
+      } else if (name.startsWith("stop-the-world (GC")) {
+        const key = `${name}|${scope}`;
+        const since = stwSince.get(key);
+        if (kind === "RangeBegin") {
+          stwSince.set(key, time);
+        } else if (since !== undefined) {
+          const pause = time - since;
+          stwSince.delete(key);
+          pauses.push(pause);
+          // Sweep termination opens the next cycle; mark termination closes the last one
+          if (name.includes("sweep termination")) {
+            sweepTermination += pause;
+          } else {
+            const cycle = cycles[cycles.length - 1];
+            if (cycle) {
+              cycle.pause += pause;
+            }
+          }
+        }
+      }
+    }
+  }
+  for (const id of [...runningSince.keys()]) {
+    chargeWorker(id, end);
+  }
+
+  const origin = start ?? 0;
+  for (const cycle of cycles) {
+    cycle.at -= origin;
+  }
+  const duration = end - origin;
+  const pauseTotal = pauses.reduce((sum, p) => sum + p, 0);
+  const cpu = {
+    pause: pauseTotal * gomaxprocs,
+    assist: assistTime,
+    background: workerTime.background,
+    idle: workerTime.idle,
+  };
+  const gcCpu = cpu.pause + cpu.assist + cpu.background;
+  return buildReport("trace", {
+    duration,
+    gomaxprocs,
+    cycles,
+    pauses,
+    cpu,
+    fraction: duration > 0 ? gcCpu / (duration * gomaxprocs) : 0,
+    assists: { share: gcCpu > 0 ? cpu.assist / gcCpu : 0, count: assistCount, goroutines: assisted.size },
+  });
+}
+
+// One gctrace line, e.g.
+// gc 4 @0.086s 7%: 0.028+7.7+0.006 ms clock, 0.028+1.7/0.46/0+0.006 ms cpu, 24->26->8 MB, 28 MB goal, 0 MB stacks, 0 MB globals, 1 P
+const GCTRACE_LINE = /\bgc \d+ @([\d.]+)s (\d+)%: ([\d.]+)\+([\d.]+)\+([\d.]+) ms clock, ([\d.]+)\+([\d.]+)\/([\d.]+)\/([\d.]+)\+([\d.]+) ms cpu, (\d+)->(\d+)->(\d+) MB, (\d+) MB goal(?:.*?(\d+) P)?( \(forced\))?/;
+
+// GC report from GODEBUG=gctrace=1 output; other lines are skipped. Heap
+// sizes are whole megabytes, as the runtime prints them, and the GC CPU
+// share is the runtime's own, since the process started.
+export function analyzeGcTrace(text: string): GcReport {
+  const cycles: GcCycle[] = [];
+  const pauses: number[] = [];
+  const cpu = { pause: 0, assist: 0, background: 0, idle: 0 };
+  let percent = 0;
+  let gomaxprocs = 1;
+  let end = 0;
+  const ms = (value: string) => Number(value) * 1e6;
+
+  for (const line of text.split("\n")) {
+    const m = line.match(GCTRACE_LINE);
+    if (!m) {
+      continue;
+    }
+    const at = Number(m[1]) * 1e9;
+    const pause = ms(m[3]) + ms(m[5]);
+    pauses.push(ms(m[3]), ms(m[5]));
+    cpu.pause += ms(m[6]) + ms(m[10]);
+    cpu.assist += ms(m[7]);
+    cpu.background += ms(m[8]);
+    cpu.idle += ms(m[9]);
+    percent = Number(m[2]);
+    gomaxprocs = m[15] ? Number(m[15]) : gomaxprocs;
+    cycles.push({
+      at,
+      pause,
+      mark: ms(m[4]),
+      heapStart: Number(m[11]) * MB,
+      heapPeak: Number(m[12]) * MB,
+      heapLive: Number(m[13]) * MB,
+      heapGoal: Number(m[14]) * MB,
+      forced: Boolean(m[16]),
+    });
+    end = Math.max(end, at + ms(m[3]) + ms(m[4]) + ms(m[5]));
+  }
+  if (cycles.length === 0) {
+    throw new Error("No gctrace lines found; run the program with GODEBUG=gctrace=1 and capture its stderr");
+  }
+
+  const gcCpu = cpu.pause + cpu.assist + cpu.background;
+  return buildReport("gctrace", {
+    duration: end - cycles[0].at,
+    gomaxprocs,
+    cycles,
+    pauses,
+    cpu,
+    fraction: percent / 100,
+    assists: { share: gcCpu > 0 ? cpu.assist / gcCpu : 0 },
+  });
+}
+
+function buildReport(
+  source: GcSource,
+  parts: {
+    duration: number;
+    gomaxprocs: number;
+    cycles: GcCycle[];
+    pauses: number[];
+    cpu: Omit<GcReport["cpu"], "fraction">;
+    fraction: number;
+    assists: GcReport["assists"];
+  },
+): GcReport {
+  const { cycles, duration } = parts;
+  const live = cycles.map((c) => c.heapLive);
+  const report: GcReport = {
+    source,
+    duration,
+    gomaxprocs: parts.gomaxprocs,
+    cycles: cycles.length,
+    forced: cycles.filter((c) => c.forced).length,
+    perSecond: duration > 0 ? round(cycles.length / (duration / 1e9), 1) : 0,
+    pauses: { ...percentiles(parts.pauses), total: parts.pauses.reduce((sum, p) => sum + p, 0) },
+    cpu: { fraction: round(parts.fraction), ...parts.cpu },
+    assists: { ...parts.assists, share: round(parts.assists.share) },
+    heap: {
+      liveFirst: live[0] ?? 0,
+      liveLast: live[live.length - 1] ?? 0,
+      liveMax: Math.max(0, ...live),
+      peak: Math.max(0, ...cycles.map((c) => c.heapPeak)),
+      goalLast: cycles[cycles.length - 1]?.heapGoal ?? 0,
+      overGoal: cycles.filter((c) => c.heapGoal > 0 && c.heapPeak > c.heapGoal).length,
+    },
+    notes: [],
+    history: cycles.slice(-HISTORY),
+  };
+  report.notes = interpretGc(report);
+  return report;
+}
+
+const bytes = (value: number) => formatValue(value, "bytes");
+const pct = (fraction: number) => `${round(fraction * 100, 1)}%`;
+
+// Plain-language reading of a report, most pressing first
+export function interpretGc(report: GcReport): string[] {
+  const { cpu, assists, heap, pauses } = report;
+  if (report.cycles === 0) {
+    return ["No GC cycle ran in this window, so the collector cost nothing here; allocation-heavy work outside it may still pay for GC."];
+  }
+  const notes: string[] = [];
+  if (cpu.fraction >= HEAVY_CPU) {
+    notes.push(`GC takes ${pct(cpu.fraction)} of the CPU available to Go, which is heavy: every allocation avoided is collector work saved. Cut allocations on the hot paths (alloc_hotspots shows them), or give the heap more room with a higher GOGC or a GOMEMLIMIT.`);
+  } else if (cpu.fraction >= NOTABLE_CPU) {
+    notes.push(`GC takes ${pct(cpu.fraction)} of the CPU available to Go: noticeable, but not yet the bottleneck. Allocation hotspots are the cheapest place to win it back.`);
+  }
+  if (assists.share >= HEAVY_ASSISTS) {
+    notes.push(`Goroutines are paying for GC themselves: ${pct(assists.share)} of GC CPU is mark assists${assists.goroutines ? ` across ${assists.goroutines} goroutine(s)` : ""}, time they spend marking instead of running their own code. The runtime makes a goroutine assist when it allocates faster than the background workers mark, so this shows up as latency in whatever allocates most, often request handlers.`);
+  }
+  if (heap.overGoal > 0 && heap.overGoal >= report.cycles / 4) {
+    notes.push(`The heap went past its goal in ${heap.overGoal} of ${report.cycles} cycles (peak ${bytes(heap.peak)}): allocation during marking outran the collector, which is what drives assists up.`);
+  }
+  if (report.perSecond >= FREQUENT_CYCLES && heap.liveMax < SMALL_HEAP) {
+    notes.push(`GC runs ${report.perSecond} times a second over a live heap of at most ${bytes(heap.liveMax)}. With a small live heap each cycle's goal is small too, so the collector restarts after only a few megabytes of allocation; a higher GOGC, or a GOMEMLIMIT with GOGC raised, trades memory for fewer cycles.`);
+  }
+  if (pauses.p99 >= LONG_PAUSE_P99) {
+    notes.push(`Stop-the-world pauses reach ${formatNanos(pauses.p99)} at p99 (max ${formatNanos(pauses.max)}); Go's are usually well under a millisecond. Long ones point to a process starved of CPU, such as a container CPU limit below GOMAXPROCS (${report.gomaxprocs}), or to goroutines slow to reach a safe point.`);
+  }
+  if (report.cycles >= 3 && heap.liveLast > heap.liveFirst * 1.5 && heap.liveLast - heap.liveFirst >= MB) {
+    notes.push(`The live heap grew from ${bytes(heap.liveFirst)} to ${bytes(heap.liveLast)} over the window. A warming cache does this too; if it keeps growing, detect_leak finds the allocation sites behind it.`);
+  }
+  if (report.forced > 0) {
+    notes.push(`${report.forced} cycle(s) were forced by runtime.GC or debug.FreeOSMemory; in production code those calls spend CPU the pacer would not have.`);
+  }
+  if (notes.length === 0) {
+    notes.push(`GC looks healthy: ${pct(cpu.fraction)} of the CPU, pauses up to ${formatNanos(pauses.max)} and few assists. Memory-related slowness is more likely allocation cost itself than collection.`);
+  }
+  return notes;
+}
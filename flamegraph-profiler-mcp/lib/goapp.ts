@@ -0,0 +1,98 @@
+/**
+ * Build and run Go programs that accept the sample app's profiling flags.
+ */
+import { execFile, spawn } from "node:child_process";
+import path from "node:path";
+import { promisify } from "node:util";
+
+const execFileAsync = promisify(execFile);
+
+export type ProfileType = "cpu" | "heap" | "block" | "mutex";
+
+// Flag the target app uses to write each profile type
+export const PROFILE_FLAGS: Record<ProfileType, string> = {
+  cpu: "-cpuprofile",
+  heap: "-memprofile",
+  block: "-blockprofile",
+  mutex: "-mutexprofile",
+};
+
+// Compiler or program output of a failed exec, for error messages
+function execFailure(error: unknown): Error {
+  const stderr = (error as { stderr?: string }).stderr?.trim();
+  return stderr ? new Error(stderr) : (error as Error);
+}
+
+// Compile a Go source file to a binary, without blocking the server
+export async function buildGoAppAsync(appPath: string, binary: string, signal?: AbortSignal): Promise<void> {
+  const resolvedPath = path.resolve(appPath);
+  await execFileAsync("go", ["build", "-o", binary, resolvedPath], { cwd: path.dirname(resolvedPath), signal }).catch((error) => {
+    signal?.throwIfAborted();
+    throw execFailure(error);
+  });
+}
+
+// Run a built app for a number of seconds with extra flags, e.g. "-trace=/tmp/t.out",
+// without blocking the server. It runs without a shell, so cancelling kills
+// the app itself.
+export async function runGoAppAsync(binary: string, flags: string, duration: number, signal?: AbortSignal): Promise<void> {
+  const args = [...flags.split(" ").filter(Boolean), `-duration=${duration}`];
+  await execFileAsync(binary, args, { timeout: (duration + 10) * 1000, signal }).catch((error) => {
+    signal?.throwIfAborted();
+    throw execFailure(error);
+  });
+}
+
+// Run the go command in its own process group, so that cancelling or timing
+// out terminates the programs it starts, such as test binaries, and not only
+// go itself. Resolves with its output like execFile, and fails like execFile
+// with the output on the error.
+export function execGo(
+  args: string[],
+  options: { cwd: string; timeout?: number; maxBuffer?: number; signal?: AbortSignal },
+): Promise<{ stdout: string; stderr: string }> {
+  return new Promise((resolve, reject) => {
+    if (options.signal?.aborted) {
+      reject(options.signal.reason);
+      return;
+    }
+    const child = spawn("go", args, { cwd: options.cwd, detached: true, stdio: ["ignore", "pipe", "pipe"] });
+    const maxBuffer = options.maxBuffer ?? 1024 * 1024;
+    let stdout = "";
+    let stderr = "";
+    const stop = () => {
+      try {
+        process.kill(-child.pid!, "SIGTERM");
+      } catch {
+        // Already exited
+      }
+    };
+    child.stdout.on("data", (chunk: Buffer) => {
+      stdout += chunk.toString();
+      if (stdout.length > maxBuffer) {
+        stop();
+      }
+    });
+    child.stderr.on("data", (chunk: Buffer) => (stderr += chunk.toString()));
+    const timer = options.timeout ? setTimeout(stop, options.timeout) : undefined;
+    options.signal?.addEventListener("abort", stop, { once: true });
+    const done = () => {
+      clearTimeout(timer);
+      options.signal?.removeEventListener("abort", stop);
+    };
+    child.on("error", (error) => {
+      done();
+      reject(error);
+    });
+    child.on("close", (code, signal) => {
+      done();
+      if (options.signal?.aborted) {
+        reject(options.signal.reason);
+      } else if (code === 0) {
+        resolve({ stdout, stderr });
+      } else {
+        reject(Object.assign(new Error(`go ${args[0]} failed with ${signal ?? `exit code ${code}`}`), { code, signal, stdout, stderr }));
+      }
+    });
+  });
+}
@@ -0,0 +1,294 @@
+/**
+ * Goroutine dumps: parsing, grouping by stack, and leak heuristics.
+ */
+import { createHash } from "node:crypto";
+import { fetchPprof } from "./target.js";
+
+export interface GoroutineFrame {
+  name: string;
+  file: string;
+  line: number;
+}
+
+export interface Goroutine {
+  id: number;
+  // Wait reason or scheduler state, e.g. "chan receive" or "running"
+  state: string;
+  waitMinutes: number;
+  // Innermost frame first
+  frames: GoroutineFrame[];
+  createdBy?: GoroutineFrame;
+}
+
+export interface GoroutineGroup {
+  key: string;
+  state: string;
+  category: WaitCategory;
+  count: number;
+  // Whole minutes waited, as the runtime prints them once a wait passes a minute
+  minWaitMinutes: number;
+  maxWaitMinutes: number;
+  // IDs of the first goroutines in the group
+  ids: number[];
+  // Innermost frame first, as "function file:line"
+  stack: string[];
+  createdBy?: string;
+  // Count in the earlier capture, when two captures were compared
+  previousCount?: number;
+}
+
+export interface SuspiciousGroup {
+  key: string;
+  reason: "parked" | "growing" | "nil-channel" | "long-wait";
+  message: string;
+}
+
+export interface GoroutineReport {
+  total: number;
+  previousTotal?: number;
+  groups: GoroutineGroup[];
+  suspicious: SuspiciousGroup[];
+  diagnosis: string;
+}
+
+export interface LeakThresholds {
+  // Goroutines parked at the same site before the group is suspicious
+  minGroupSize: number;
+  // Growth between captures before the group is suspicious
+  minGrowth: number;
+}
+
+// What a goroutine's state says it is doing, from its wait reason
+export const WAIT_CATEGORIES = ["running", "channel", "select", "io", "mutex", "sync", "sleep", "syscall", "runtime", "other"] as const;
+export type WaitCategory = (typeof WAIT_CATEGORIES)[number];
+
+const CATEGORY_PATTERNS: Array<[WaitCategory, RegExp]> = [
+  ["running", /^(running|runnable)/],
+  ["channel", /^chan (receive|send)/],
+  ["select", /^select/],
+  ["io", /^IO wait/],
+  ["mutex", /^(sync\.Mutex\.Lock|sync\.RWMutex\.R?Lock|semacquire)/],
+  ["sync", /^(sync\.WaitGroup\.Wait|sync\.Cond\.Wait)/],
+  ["sleep", /^sleep/],
+  ["syscall", /^syscall/],
+  // The runtime's own goroutines waiting for work
+  ["runtime", /^(GC |force gc|finalizer wait|timer goroutine|trace reader|debug call|cleanup wait|wait for GC cycle|synctest|idle)/],
+];
+
+export function categoryOf(state: string): WaitCategory {
+  return CATEGORY_PATTERNS.find(([, pattern]) => pattern.test(state))?.[0] ?? "other";
+}
+
+// States in which a goroutine waits on another goroutine to make progress
+const PARKED_STATES = /^(chan receive|chan send|select|sync\.Cond\.Wait|sync\.Mutex\.Lock|sync\.RWMutex\.R?Lock|sync\.WaitGroup\.Wait|semacquire)/;
+
+// Waits longer than this many minutes are reported even for small groups
+const LONG_WAIT_MINUTES = 10;
+
+// Goroutine IDs kept per group
+const GROUP_IDS = 5;
+
+// Capture a goroutine dump (debug=2) from a live target
+export async function captureGoroutines(target: string, signal?: AbortSignal): Promise<Goroutine[]> {
+  const response = await fetchPprof(target, "goroutine", { debug: 2 }, 0, signal);
+  return parseGoroutineDump(await response.text());
+}
+
+// Parse the text written by /debug/pprof/goroutine?debug=2 or runtime.Stack(all)
+export function parseGoroutineDump(text: string): Goroutine[] {
+  const goroutines: Goroutine[] = [];
+
+  for (const block of text.split(/\n\s*\n/)) {
+    const lines = block.split("\n").filter((line) => line.trim() !== "");
+    const header = lines[0]?.match(/^goroutine (\d+)(?: gp=\S+ m=\S+(?: mp=\S+)?)? \[([^\]]+)\]:$/);
+    if (!header) {
+      continue;
+    }
+    const [state, ...flags] = header[2].split(", ");
+    const minutes = flags.find((flag) => /^\d+ minutes?$/.test(flag));
+    const goroutine: Goroutine = {
+      id: Number(header[1]),
+      state,
+      waitMinutes: minutes ? parseInt(minutes, 10) : 0,
+      frames: [],
+    };
+
+    for (let i = 1; i < lines.length; i += 2) {
+      const location = parseLocation(lines[i + 1] ?? "");
+      const createdBy = lines[i].match(/^created by (\S+)/);
+      if (createdBy) {
+        goroutine.createdBy = { name: createdBy[1], ...location };
+        break;
+      }
+      goroutine.frames.push({ name: functionName(lines[i]), ...location });
+    }
+    goroutines.push(goroutine);
+  }
+
+  return goroutines;
+}
+
+// Strip the argument list from a frame line, e.g. "main.(*T).run(0xc000010000)"
+function functionName(line: string): string {
+  const paren = line.lastIndexOf("(");
+  return paren > 0 ? line.slice(0, paren) : line;
+}
+
+// Parse "\t/path/file.go:42 +0x1d"
+function parseLocation(line: string): { file: string; line: number } {
+  const match = line.trim().match(/^(.*):(\d+)(?: \+0x[0-9a-f]+)?$/);
+  return match ? { file: match[1], line: Number(match[2]) } : { file: "", line: 0 };
+}
+
+function formatFrame(frame: GoroutineFrame): string {
+  return frame.file ? `${frame.name} ${frame.file}:${frame.line}` : frame.name;
+}
+
+// Group goroutines that share a state and stack, largest groups first
+export function groupGoroutines(goroutines: Goroutine[]): GoroutineGroup[] {
+  const groups = new Map<string, GoroutineGroup>();
+  for (const goroutine of goroutines) {
+    const stack = goroutine.frames.map(formatFrame);
+    const createdBy = goroutine.createdBy ? formatFrame(goroutine.createdBy) : undefined;
+    const key = [goroutine.state, ...stack, createdBy ?? ""].join("\n");
+    let group = groups.get(key);
+    if (!group) {
+      group = {
+        key: "",
+        state: goroutine.state,
+        category: categoryOf(goroutine.state),
+        count: 0,
+        minWaitMinutes: goroutine.waitMinutes,
+        maxWaitMinutes: 0,
+        ids: [],
+        stack,
+        createdBy,
+      };
+      groups.set(key, group);
+    }
+    group.count++;
+    group.minWaitMinutes = Math.min(group.minWaitMinutes, goroutine.waitMinutes);
+    group.maxWaitMinutes = Math.max(group.maxWaitMinutes, goroutine.waitMinutes);
+    if (group.ids.length < GROUP_IDS) {
+      group.ids.push(goroutine.id);
+    }
+  }
+
+  // Short, stable keys so groups can be matched across captures and referenced
+  return [...groups.entries()]
+    .map(([key, group]) => ({ ...group, key: groupKey(key) }))
+    .sort((a, b) => b.count - a.count);
+}
+
+export interface CategorySummary {
+  category: WaitCategory;
+  goroutines: number;
+  groups: number;
+  // Goroutines in each wait reason of the category, largest first
+  states: Array<{ state: string; count: number }>;
+  maxWaitMinutes: number;
+}
+
+// Goroutines and groups per wait category, largest first
+export function summarizeWaits(groups: GoroutineGroup[]): CategorySummary[] {
+  const summaries = new Map<WaitCategory, CategorySummary & { byState: Map<string, number> }>();
+  for (const group of groups) {
+    let summary = summaries.get(group.category);
+    if (!summary) {
+      summary = { category: group.category, goroutines: 0, groups: 0, states: [], maxWaitMinutes: 0, byState: new Map() };
+      summaries.set(group.category, summary);
+    }
+    summary.goroutines += group.count;
+    summary.groups++;
+    summary.maxWaitMinutes = Math.max(summary.maxWaitMinutes, group.maxWaitMinutes);
+    summary.byState.set(group.state, (summary.byState.get(group.state) ?? 0) + group.count);
+  }
+  return [...summaries.values()]
+    .map(({ byState, ...summary }) => ({
+      ...summary,
+      states: [...byState].map(([state, count]) => ({ state, count })).sort((a, b) => b.count - a.count),
+    }))
+    .sort((a, b) => b.goroutines - a.goroutines);
+}
+
+function groupKey(text: string): string {
+  return `g_${createHash("sha256").update(text).digest("hex").slice(0, 8)}`;
+}
+
+// Where a group is blocked: its innermost non-runtime frame
+function siteOf(group: GoroutineGroup): string {
+  const frame = group.stack.find((f) => !f.startsWith("runtime.")) ?? group.stack[0] ?? "unknown";
+  return frame.split(" ")[0];
+}
+
+// Group a capture, compare it with an optional earlier one, and flag likely leaks
+export function analyzeGoroutines(
+  current: Goroutine[],
+  previous: Goroutine[] | undefined,
+  thresholds: LeakThresholds,
+): GoroutineReport {
+  const groups = groupGoroutines(current);
+  const earlier = previous ? new Map(groupGoroutines(previous).map((g) => [g.key, g.count])) : undefined;
+  const suspicious: SuspiciousGroup[] = [];
+
+  for (const group of groups) {
+    const site = siteOf(group);
+    if (earlier) {
+      group.previousCount = earlier.get(group.key) ?? 0;
+    }
+
+    if (group.state.includes("nil chan")) {
+      suspicious.push({
+        key: group.key,
+        reason: "nil-channel",
+        message: `${group.count} goroutine(s) blocked forever on a nil channel (${group.state}) in ${site}`,
+      });
+    } else if (PARKED_STATES.test(group.state) && group.count >= thresholds.minGroupSize) {
+      suspicious.push({
+        key: group.key,
+        reason: "parked",
+        message: `${group.count} goroutines parked on ${group.state} in ${site}`,
+      });
+    }
+
+    const growth = group.count - (group.previousCount ?? group.count);
+    if (PARKED_STATES.test(group.state) && growth >= thresholds.minGrowth) {
+      suspicious.push({
+        key: group.key,
+        reason: "growing",
+        message: `${site} (${group.state}) grew from ${group.previousCount} to ${group.count} goroutines between captures`,
+      });
+    }
+
+    if (PARKED_STATES.test(group.state) && group.maxWaitMinutes >= LONG_WAIT_MINUTES) {
+      suspicious.push({
+        key: group.key,
+        reason: "long-wait",
+        message: `${group.count} goroutine(s) in ${site} have waited on ${group.state} for ${group.maxWaitMinutes} minutes`,
+      });
+    }
+  }
+
+  const report: GoroutineReport = {
+    total: current.length,
+    previousTotal: previous?.length,
+    groups,
+    suspicious,
+    diagnosis: "",
+  };
+  report.diagnosis = diagnose(report);
+  return report;
+}
+
+function diagnose(report: GoroutineReport): string {
+  const trend = report.previousTotal !== undefined
+    ? ` (${report.previousTotal} in the earlier capture)`
+    : "";
+  const summary = `${report.total} goroutines in ${report.groups.length} distinct stacks${trend}.`;
+  if (report.suspicious.length === 0) {
+    return `${summary} No leak indicators found.`;
+  }
+  const leaking = new Set(report.suspicious.map((s) => s.key)).size;
+  return `${summary} ${leaking} group(s) look like leaks: goroutines are blocked waiting on a peer that may never arrive. ` +
+    "Check that every channel has a sender/closer and that blocked goroutines can observe cancellation (context or done channel).";
+}
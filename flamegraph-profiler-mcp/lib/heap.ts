@@ -0,0 +1,73 @@
+/**
+ * Heap profile analysis across the four heap sample types.
+ */
+import { percentOf } from "./flamegraph.js";
+import { sampleIndexOf, totalOf, type Profile } from "./pprof.js";
+
+export const HEAP_MODES = ["inuse_space", "inuse_objects", "alloc_space", "alloc_objects"] as const;
+export type HeapMode = (typeof HEAP_MODES)[number];
+
+export interface AllocationSite {
+  function: string;
+  file: string;
+  line: number;
+  value: number;
+  percentage: number;
+  // Average object size at this site, in bytes
+  avgObjectSize?: number;
+}
+
+export interface HeapModeReport {
+  mode: HeapMode;
+  unit: string;
+  total: number;
+  sites: AllocationSite[];
+}
+
+// Check that a profile carries heap sample types
+export function isHeapProfile(profile: Profile): boolean {
+  return HEAP_MODES.every((mode) => profile.sampleTypes.some((t) => t.type === mode));
+}
+
+// Rank allocation sites (the allocating function and line) for one heap mode
+export function heapSites(profile: Profile, mode: HeapMode, limit = 10): HeapModeReport {
+  const index = sampleIndexOf(profile, mode);
+  // Pair bytes with objects from the same family to estimate object sizes
+  const family = mode.startsWith("inuse") ? "inuse" : "alloc";
+  const spaceIndex = sampleIndexOf(profile, `${family}_space`);
+  const objectsIndex = sampleIndexOf(profile, `${family}_objects`);
+
+  const sites = new Map<string, AllocationSite & { space: number; objects: number }>();
+  for (const sample of profile.samples) {
+    const value = sample.values[index];
+    if (value === 0) {
+      continue;
+    }
+    const location = profile.locations.get(sample.locationIds[0]);
+    const frame = location?.frames[0];
+    if (!frame) {
+      continue;
+    }
+    const key = `${frame.name}:${frame.file}:${frame.line}`;
+    let site = sites.get(key);
+    if (!site) {
+      site = { function: frame.name, file: frame.file, line: frame.line, value: 0, percentage: 0, space: 0, objects: 0 };
+      sites.set(key, site);
+    }
+    site.value += value;
+    site.space += sample.values[spaceIndex];
+    site.objects += sample.values[objectsIndex];
+  }
+
+  const total = totalOf(profile, index);
+  const ranked = [...sites.values()]
+    .sort((a, b) => b.value - a.value)
+    .slice(0, limit)
+    .map(({ space, objects, ...site }) => ({
+      ...site,
+      percentage: percentOf(site.value, total),
+      avgObjectSize: objects > 0 ? Math.round(space / objects) : undefined,
+    }));
+
+  return { mode, unit: profile.sampleTypes[index].unit, total, sites: ranked };
+}
@@ -0,0 +1,174 @@
+/**
+ * Heap deltas between two snapshots of one process. A heap profile shows what
+ * is live at one moment; what changed between two shows which sites retain
+ * more and which let go, and, from the cumulative alloc_* counts, how much
+ * each site allocated in between. Sites that allocated a lot but retain
+ * about as much as before churn: their garbage costs GC time without showing
+ * in either snapshot's in-use view.
+ */
+import { annotateDeltas } from "./diff.js";
+import { buildFlameTree, type ProfileFrame } from "./flamegraph.js";
+import { isHeapProfile, type HeapMode } from "./heap.js";
+import { allocationSite, STACK_DEPTH } from "./leaks.js";
+import { sampleIndexOf, totalOf, type Profile } from "./pprof.js";
+
+export const HEAP_DELTA_MODES = ["inuse_space", "inuse_objects"] as const satisfies readonly HeapMode[];
+export type HeapDeltaMode = (typeof HEAP_DELTA_MODES)[number];
+
+// A site churns when the in-use bytes it gained or lost are under this share
+// of what it allocated between the snapshots
+const CHURN_RETAINED = 0.1;
+
+export interface HeapTotals {
+  inuseBytes: number;
+  inuseObjects: number;
+  allocBytes: number;
+  allocObjects: number;
+}
+
+export interface HeapSiteDelta {
+  function: string;
+  file: string;
+  line: number;
+  baselineBytes: number;
+  comparisonBytes: number;
+  bytesDelta: number;
+  baselineObjects: number;
+  comparisonObjects: number;
+  objectsDelta: number;
+  // Allocated between the snapshots, when they come from one run
+  allocatedBytes?: number;
+  allocatedObjects?: number;
+  // Heaviest stack allocating at the site in the comparison, or else the
+  // baseline, from the site
+  stack: string[];
+}
+
+export interface HeapDeltaReport {
+  mode: HeapDeltaMode;
+  baseline: HeapTotals;
+  comparison: HeapTotals;
+  bytesDelta: number;
+  objectsDelta: number;
+  // Allocated between the snapshots; undefined when the comparison counts
+  // fewer allocations than the baseline, as after a restart
+  allocatedBytes?: number;
+  allocatedObjects?: number;
+  // Sites whose in-use value in the mode grew or shrank most, up to the limit
+  grew: HeapSiteDelta[];
+  shrank: HeapSiteDelta[];
+  grewCount: number;
+  shrankCount: number;
+  // Sites that allocated most between the snapshots while their in-use
+  // bytes moved by under a tenth of it
+  churn: HeapSiteDelta[];
+  // Comparison tree in the mode, each frame's delta its change in absolute terms
+  flamegraph: ProfileFrame;
+}
+
+function totalsOf(profile: Profile): HeapTotals {
+  return {
+    inuseBytes: totalOf(profile, sampleIndexOf(profile, "inuse_space")),
+    inuseObjects: totalOf(profile, sampleIndexOf(profile, "inuse_objects")),
+    allocBytes: totalOf(profile, sampleIndexOf(profile, "alloc_space")),
+    allocObjects: totalOf(profile, sampleIndexOf(profile, "alloc_objects")),
+  };
+}
+
+// Compare two heap profiles of one process, the baseline taken first
+export function heapDelta(baseline: Profile, comparison: Profile, mode: HeapDeltaMode = "inuse_space", limit = 10): HeapDeltaReport {
+  for (const [name, profile] of [["baseline", baseline], ["comparison", comparison]] as const) {
+    if (!isHeapProfile(profile)) {
+      throw new Error(`The ${name} is not a heap profile (sample types: ${profile.sampleTypes.map((t) => t.type).join(", ")})`);
+    }
+  }
+  const before = totalsOf(baseline);
+  const after = totalsOf(comparison);
+  // Allocation counts only grow within a run
+  const sameRun = after.allocBytes >= before.allocBytes && after.allocObjects >= before.allocObjects;
+
+  const sites = new Map<string, HeapSiteDelta>();
+  const heaviest = new Map<string, { side: string; bytes: number }>();
+  ([[baseline, "baseline"], [comparison, "comparison"]] as const).forEach(([profile, side]) => {
+    const indexes = ["inuse_space", "inuse_objects", "alloc_space", "alloc_objects"].map((type) => sampleIndexOf(profile, type));
+    for (const sample of profile.samples) {
+      const [bytes, objects, allocBytes, allocObjects] = indexes.map((i) => sample.values[i]);
+      if (bytes === 0 && allocBytes === 0) {
+        continue;
+      }
+      const at = allocationSite(profile, sample);
+      if (!at) {
+        continue;
+      }
+      const leaf = at.frames[at.start];
+      let site = sites.get(at.key);
+      if (!site) {
+        site = {
+          function: leaf.name,
+          file: leaf.file,
+          line: leaf.line,
+          baselineBytes: 0,
+          comparisonBytes: 0,
+          bytesDelta: 0,
+          baselineObjects: 0,
+          comparisonObjects: 0,
+          objectsDelta: 0,
+          ...(sameRun ? { allocatedBytes: 0, allocatedObjects: 0 } : {}),
+          stack: [],
+        };
+        sites.set(at.key, site);
+      }
+      // Allocations between the snapshots are the comparison's cumulative
+      // counts less the baseline's
+      const sign = side === "baseline" ? -1 : 1;
+      if (side === "baseline") {
+        site.baselineBytes += bytes;
+        site.baselineObjects += objects;
+      } else {
+        site.comparisonBytes += bytes;
+        site.comparisonObjects += objects;
+      }
+      if (sameRun) {
+        site.allocatedBytes! += sign * allocBytes;
+        site.allocatedObjects! += sign * allocObjects;
+      }
+      // The comparison's stacks win over the baseline's
+      const best = heaviest.get(at.key);
+      if (bytes > 0 && (!best || best.side !== side || bytes > best.bytes)) {
+        heaviest.set(at.key, { side, bytes });
+        site.stack = at.frames.slice(at.start, at.start + STACK_DEPTH).map((f) => f.name);
+      }
+    }
+  });
+
+  const all = [...sites.values()];
+  for (const site of all) {
+    site.bytesDelta = site.comparisonBytes - site.baselineBytes;
+    site.objectsDelta = site.comparisonObjects - site.baselineObjects;
+  }
+  const change = (site: HeapSiteDelta) => (mode === "inuse_space" ? site.bytesDelta : site.objectsDelta);
+  const grew = all.filter((s) => change(s) > 0).sort((a, b) => change(b) - change(a));
+  const shrank = all.filter((s) => change(s) < 0).sort((a, b) => change(a) - change(b));
+  const churn = sameRun
+    ? all
+      .filter((s) => s.allocatedBytes! > 0 && Math.abs(s.bytesDelta) < s.allocatedBytes! * CHURN_RETAINED)
+      .sort((a, b) => b.allocatedBytes! - a.allocatedBytes!)
+    : [];
+
+  const flamegraph = buildFlameTree(comparison, sampleIndexOf(comparison, mode));
+  annotateDeltas(flamegraph, buildFlameTree(baseline, sampleIndexOf(baseline, mode)), 1);
+  return {
+    mode,
+    baseline: before,
+    comparison: after,
+    bytesDelta: after.inuseBytes - before.inuseBytes,
+    objectsDelta: after.inuseObjects - before.inuseObjects,
+    ...(sameRun ? { allocatedBytes: after.allocBytes - before.allocBytes, allocatedObjects: after.allocObjects - before.allocObjects } : {}),
+    grew: grew.slice(0, limit),
+    shrank: shrank.slice(0, limit),
+    grewCount: grew.length,
+    shrankCount: shrank.length,
+    churn: churn.slice(0, limit),
+    flamegraph,
+  };
+}
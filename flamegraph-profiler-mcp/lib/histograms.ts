@@ -0,0 +1,195 @@
+/**
+ * Per-call duration distributions, where the data records calls rather than
+ * samples: trace regions and tasks, and uprobe latency histograms. They are
+ * written in HdrHistogram's percentile distribution format (.hgrm), which
+ * HdrHistogram's plotter and the tools built on it read, so tails can be
+ * compared across runs instead of averages.
+ */
+import { EVENT_LINE } from "./trace.js";
+import type { HistogramBucket } from "./uprobes.js";
+
+export type DistributionKind = "region" | "task" | "function";
+
+export interface Distribution {
+  name: string;
+  kind: DistributionKind;
+  // Exact when every call was timed; bucketed when only a histogram exists,
+  // in which case each value stands for the top of its bucket
+  exact: boolean;
+  count: number;
+  // Nanoseconds
+  min: number;
+  max: number;
+  mean: number;
+  stdDev: number;
+  p50: number;
+  p90: number;
+  p99: number;
+  p999: number;
+  // Distinct values and how many calls took each, ascending
+  values: Array<[number, number]>;
+}
+
+// Percentile steps per halving of the distance to 100%, as HdrHistogram's
+// outputPercentileDistribution defaults to
+const TICKS_PER_HALF_DISTANCE = 5;
+// Significant digits HdrHistogram would keep; only reported in the footer
+const SUB_BUCKETS = 2048;
+
+// Units .hgrm values can be written in, as nanoseconds per unit
+export const HGRM_UNITS = { ns: 1, us: 1e3, ms: 1e6, s: 1e9 } as const;
+export const HGRM_UNIT_NAMES = ["ns", "us", "ms", "s"] as const;
+export type HgrmUnit = (typeof HGRM_UNIT_NAMES)[number];
+
+function distribution(name: string, kind: DistributionKind, exact: boolean, counts: Map<number, number>): Distribution {
+  const values = [...counts.entries()].filter(([, n]) => n > 0).sort((a, b) => a[0] - b[0]);
+  const count = values.reduce((sum, [, n]) => sum + n, 0);
+  const mean = count > 0 ? values.reduce((sum, [v, n]) => sum + v * n, 0) / count : 0;
+  const variance = count > 0 ? values.reduce((sum, [v, n]) => sum + n * (v - mean) ** 2, 0) / count : 0;
+  const at = (p: number) => valueAtPercentile(values, count, p);
+  return {
+    name,
+    kind,
+    exact,
+    count,
+    min: values[0]?.[0] ?? 0,
+    max: values[values.length - 1]?.[0] ?? 0,
+    mean: Math.round(mean),
+    stdDev: Math.round(Math.sqrt(variance)),
+    p50: at(50),
+    p90: at(90),
+    p99: at(99),
+    p999: at(99.9),
+    values,
+  };
+}
+
+// Smallest recorded value with at least p percent of calls at or below it
+function valueAtPercentile(values: Array<[number, number]>, count: number, p: number): number {
+  const wanted = Math.max(1, Math.ceil((p / 100) * count));
+  let seen = 0;
+  for (const [value, n] of values) {
+    seen += n;
+    if (seen >= wanted) {
+      return value;
+    }
+  }
+  return values[values.length - 1]?.[0] ?? 0;
+}
+
+export function distributionOfValues(name: string, kind: DistributionKind, durations: number[]): Distribution {
+  const counts = new Map<number, number>();
+  for (const duration of durations) {
+    counts.set(duration, (counts.get(duration) ?? 0) + 1);
+  }
+  return distribution(name, kind, true, counts);
+}
+
+// Distribution of a power-of-two latency histogram, each call counted at the
+// top of its bucket like HdrHistogram's highest equivalent value
+export function distributionOfBuckets(name: string, kind: DistributionKind, buckets: HistogramBucket[]): Distribution {
+  const counts = new Map<number, number>();
+  for (const bucket of buckets) {
+    if (bucket.min !== undefined && bucket.count > 0) {
+      counts.set(bucket.max, (counts.get(bucket.max) ?? 0) + bucket.count);
+    }
+  }
+  return distribution(name, kind, false, counts);
+}
+
+// Durations of every completed region and task in a parsed trace dump, by
+// region and task type. Regions nest, so they are matched per goroutine.
+export function traceDistributions(parsed: string): Distribution[] {
+  const regions = new Map<string, number[]>();
+  const tasks = new Map<string, number[]>();
+  const openRegions = new Map<string, number[]>();
+  const openTasks = new Map<string, { type: string; start: number }>();
+  const add = (into: Map<string, number[]>, type: string, duration: number) => {
+    if (!into.has(type)) {
+      into.set(type, []);
+    }
+    into.get(type)!.push(duration);
+  };
+
+  for (const line of parsed.split("\n")) {
+    const event = line.match(EVENT_LINE);
+    if (!event) {
+      continue;
+    }
+    const [, kind, timeText, rest] = event;
+    const time = Number(timeText);
+    if (kind === "RegionBegin" || kind === "RegionEnd") {
+      const type = rest.match(/Type="([^"]*)"/)?.[1];
+      if (type === undefined) {
+        continue;
+      }
+      const key = `${line.match(/ G=(-?\d+) /)?.[1]}|${type}`;
+      if (kind === "RegionBegin") {
+        openRegions.set(key, [...(openRegions.get(key) ?? []), time]);
+      } else {
+        const start = openRegions.get(key)?.pop();
+        if (start !== undefined) {
+          add(regions, type, time - start);
+        }
+      }
+    } else if (kind === "TaskBegin" || kind === "TaskEnd") {
+      const task = rest.match(/ID=(\d+) .*Type="([^"]*)"/);
+      if (!task) {
+        continue;
+      }
+      if (kind === "TaskBegin") {
+        openTasks.set(task[1], { type: task[2], start: time });
+      } else {
+        const open = openTasks.get(task[1]);
+        if (open) {
+          add(tasks, open.type, time - open.start);
+          openTasks.delete(task[1]);
+        }
+      }
+    }
+  }
+  return [
+    ...[...tasks.entries()].map(([type, durations]) => distributionOfValues(type, "task", durations)),
+    ...[...regions.entries()].map(([type, durations]) => distributionOfValues(type, "region", durations)),
+  ].sort((a, b) => b.p99 - a.p99);
+}
+
+const fixed = (value: number, digits: number, width: number) => value.toFixed(digits).padStart(width);
+
+// HdrHistogram percentile distribution (.hgrm) of a distribution, values
+// divided by scale (1e6 for milliseconds), like outputPercentileDistribution
+export function formatHgrm(dist: Distribution, scale: number): string {
+  const lines = [`${"Value".padStart(12)} ${"Percentile".padStart(14)} ${"TotalCount".padStart(10)} ${"1/(1-Percentile)".padStart(14)}`, ""];
+  const row = (value: number, percentile: number, total: number) => {
+    const inverse = percentile < 100 ? ` ${fixed(1 / (1 - percentile / 100), 2, 14)}` : "";
+    lines.push(`${fixed(value / scale, 3, 12)} ${(percentile / 100).toFixed(12).padStart(14)} ${String(total).padStart(10)}${inverse}`);
+  };
+  const countAtOrBelow = (value: number) => dist.values.filter(([v]) => v <= value).reduce((sum, [, n]) => sum + n, 0);
+
+  if (dist.count > 0) {
+    let percentile = 0;
+    while (percentile < 100) {
+      const value = valueAtPercentile(dist.values, dist.count, percentile);
+      const total = countAtOrBelow(value);
+      row(value, percentile, total);
+      if (total === dist.count) {
+        break;
+      }
+      const halvings = Math.floor(Math.log2(100 / (100 - percentile))) + 1;
+      percentile += 100 / (TICKS_PER_HALF_DISTANCE * 2 ** halvings);
+    }
+    row(dist.max, 100, dist.count);
+  }
+  const buckets = dist.max > 0 ? Math.max(1, Math.ceil(Math.log2(dist.max / Math.max(1, dist.min || 1))) + 1) : 1;
+  lines.push(
+    `#[Mean    = ${fixed(dist.mean / scale, 3, 12)}, StdDeviation   = ${fixed(dist.stdDev / scale, 3, 12)}]`,
+    `#[Max     = ${fixed(dist.max / scale, 3, 12)}, Total count    = ${String(dist.count).padStart(12)}]`,
+    `#[Buckets = ${String(buckets).padStart(12)}, SubBuckets     = ${String(SUB_BUCKETS).padStart(12)}]`,
+  );
+  return `${lines.join("\n")}\n`;
+}
+
+// File name for a distribution's .hgrm, e.g. region_parse.hgrm
+export function hgrmFileName(dist: Distribution): string {
+  return `${dist.kind}_${dist.name.replace(/[^\w.-]+/g, "_").replace(/^_+|_+$/g, "") || "unnamed"}.hgrm`;
+}
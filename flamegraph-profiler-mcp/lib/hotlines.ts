@@ -0,0 +1,111 @@
+/**
+ * Hot lines export: per-line shares of a profile as a small, versioned JSON
+ * document for editor extensions to render heat gutters. This format is a
+ * public API (see "Hot Lines Format" in the README): fields may be added
+ * within a version, but renaming or removing one requires a new version.
+ */
+import { resolveSourceFile } from "./annotate.js";
+import { percentOf } from "./flamegraph.js";
+import { totalOf, type Frame, type Profile } from "./pprof.js";
+
+export const HOT_LINES_FORMAT = "flamegraph-profiler.hot-lines";
+export const HOT_LINES_VERSION = 1;
+
+export interface HotLine {
+  // Percent of the profile total spent on this line itself
+  flat: number;
+  // Percent of the profile total with this line on the stack
+  cum: number;
+}
+
+export interface HotLines {
+  format: typeof HOT_LINES_FORMAT;
+  version: typeof HOT_LINES_VERSION;
+  generatedAt: string;
+  // Profile the lines were computed from, as passed to the export
+  profile: string;
+  sampleType: string;
+  unit: string;
+  total: number;
+  // File → line number (as a string key) → shares. Files are keyed by their
+  // local path when found, else by the path recorded in the profile.
+  files: Record<string, Record<string, HotLine>>;
+  // Recorded paths that could not be found locally
+  unresolved: string[];
+}
+
+export function hotLines(
+  profile: Profile,
+  sampleIndex: number,
+  options: { profile: string; sourceRoot?: string; minPct?: number },
+): HotLines {
+  const { minPct = 0 } = options;
+  const lines = new Map<string, Map<number, { flat: number; cum: number }>>();
+  const lineFor = (frame: Frame) => {
+    let byLine = lines.get(frame.file);
+    if (!byLine) {
+      byLine = new Map();
+      lines.set(frame.file, byLine);
+    }
+    let line = byLine.get(frame.line);
+    if (!line) {
+      line = { flat: 0, cum: 0 };
+      byLine.set(frame.line, line);
+    }
+    return line;
+  };
+
+  for (const sample of profile.samples) {
+    const value = sample.values[sampleIndex];
+    if (value === 0) {
+      continue;
+    }
+    // Frames innermost first; recursion counts each line once per sample
+    const frames = sample.locationIds
+      .flatMap((id) => profile.locations.get(id)?.frames ?? [])
+      .filter((frame) => frame.file && frame.line > 0);
+    const seen = new Set<string>();
+    frames.forEach((frame, depth) => {
+      const line = lineFor(frame);
+      if (depth === 0) {
+        line.flat += value;
+      }
+      const key = `${frame.file}:${frame.line}`;
+      if (!seen.has(key)) {
+        seen.add(key);
+        line.cum += value;
+      }
+    });
+  }
+
+  const total = totalOf(profile, sampleIndex);
+  const files: HotLines["files"] = {};
+  const unresolved: string[] = [];
+  for (const [file, byLine] of [...lines.entries()].sort((a, b) => a[0].localeCompare(b[0]))) {
+    const hot = [...byLine.entries()]
+      .map(([line, v]) => [line, { flat: percentOf(v.flat, total), cum: percentOf(v.cum, total) }] as const)
+      .filter(([, v]) => v.cum > 0 && v.cum >= minPct)
+      .sort((a, b) => a[0] - b[0]);
+    if (hot.length === 0) {
+      continue;
+    }
+    const resolved = resolveSourceFile(file, options.sourceRoot);
+    if (!resolved) {
+      unresolved.push(file);
+    }
+    // Recorded paths that resolve to the same local file are merged
+    Object.assign((files[resolved ?? file] ??= {}), Object.fromEntries(hot.map(([line, v]) => [String(line), v])));
+  }
+
+  return {
+    format: HOT_LINES_FORMAT,
+    version: HOT_LINES_VERSION,
+    generatedAt: new Date().toISOString(),
+    profile: options.profile,
+    sampleType: profile.sampleTypes[sampleIndex].type,
+    unit: profile.sampleTypes[sampleIndex].unit,
+    total,
+    files,
+    unresolved,
+  };
+}
@@ -0,0 +1,179 @@
+/**
+ * Translations of report and finding text. Stored findings and structured
+ * output stay in English and language-neutral; only the prose written for
+ * readers is rendered in the language a call asks for. Messages missing from
+ * a catalog fall back to English.
+ */
+
+export const LANGS = ["en", "es"] as const;
+export type Lang = (typeof LANGS)[number];
+
+const EN = {
+  "finding.antiPattern.title": "{title} in {function}",
+  "finding.antiPattern.detail": "{percentage}% observed in {observedIn}. {suggestion}",
+  "finding.regression.title": "{function} grew from {baseline}% to {comparison}%",
+  "finding.regression.detail": "Flat share +{flat} pts, cumulative {cum} pts.",
+  "finding.anomaly.spike": "{function} jumped to {share}% of {resource} on {target}",
+  "finding.anomaly.drop": "{function} dropped to {share}% of {resource} on {target}",
+  "finding.anomaly.detail": "Expected {expected}% ± {stdDev} pts from recent snapshots; {zScore}σ away in the snapshot at {at}.",
+  "resource.cpu": "CPU time",
+  "resource.heap": "in-use memory",
+  "finding.seen": "seen {count}×",
+  "finding.callPath": "Call path: {path}",
+  "finding.history": "Seen {count} time(s), first {first}, last {last}",
+  "finding.ticket": "Ticket: {id} {url}",
+  "finding.occurrences": "Recent occurrences:",
+  "finding.occurrence": "{percentage}% in {source}",
+  "finding.comments": "Comments:",
+  "findings.count": "{count} finding(s):",
+  "findings.none": "No findings match.",
+  "report.findings": "🔎 Findings:",
+  "report.recordedFindings": "🔎 Recorded Findings:",
+  "status.open": "open",
+  "status.acknowledged": "acknowledged",
+  "status.resolved": "resolved",
+  "severity.low": "low",
+  "severity.medium": "medium",
+  "severity.high": "high",
+  "run.heading": "{heading} ({total}{inUse}), saved as {id}:",
+  "run.inUse": " in use",
+  "run.noSamples": "No samples recorded",
+  "run.suppressed": "🔕 {count} anti-pattern(s) hidden by suppressions",
+  "run.flamegraph": "🖼️ Flamegraph: {uri}",
+  "run.atCommit": " at commit {commit}",
+  "run.output": "📜 Last output:",
+  "sampleApp.summary": "🧪 Sample app ran for {seconds}s{commit} with {profiles} profile(s) and {findings} finding(s)",
+  "sampleApp.chaos": "💥 Injected anomalies (ground truth, times since the run started):",
+  "sampleApp.tip": "💡 Tip: Pass the saved IDs to top_functions, list_source or analyze_heap, or edit {source} and run again to compare with diff_flamegraph.",
+  "build.summary": "🏗️ Profiled `{command}` for {seconds}s{commit} with {profiles} profile(s) and {findings} finding(s)",
+  "build.tip": "💡 Tip: Profiles cover the program's startup too; for a server, send it load during the run or use a longer duration so steady state dominates.",
+  "digest.title": "📊 *Weekly profiling digest* {from} → {to}",
+  "digest.newHotspots": "🆕 New hotspots",
+  "digest.resolvedRegressions": "✅ Resolved regressions",
+  "digest.recurring": "🔁 Still recurring",
+  "digest.more": "…and {count} more",
+  "digest.none": "None",
+  "digest.trends": "📈 Hotspot trends",
+  "digest.noTrends": "Not enough captures this period",
+  "digest.storage": "🗄️ Storage",
+  "digest.files": "{size} in {count} file(s) under {dir}",
+  "digest.findings": "Findings: {open} open, {acknowledged} acknowledged, {resolved} resolved",
+  "digest.suppressions": "Active suppressions: {count}",
+};
+
+export type MessageKey = keyof typeof EN;
+
+const MESSAGES: Record<Lang, Partial<Record<MessageKey, string>>> = {
+  en: EN,
+  es: {
+    "finding.antiPattern.title": "{title} en {function}",
+    "finding.antiPattern.detail": "{percentage}% observado en {observedIn}. {suggestion}",
+    "finding.regression.title": "{function} creció del {baseline}% al {comparison}%",
+    "finding.regression.detail": "Parte propia +{flat} pts, acumulada {cum} pts.",
+    "finding.anomaly.spike": "{function} subió al {share}% de {resource} en {target}",
+    "finding.anomaly.drop": "{function} bajó al {share}% de {resource} en {target}",
+    "finding.anomaly.detail": "Se esperaba {expected}% ± {stdDev} pts según las capturas recientes; {zScore}σ de diferencia en la captura de {at}.",
+    "resource.cpu": "tiempo de CPU",
+    "resource.heap": "memoria en uso",
+    "finding.seen": "visto {count}×",
+    "finding.callPath": "Ruta de llamadas: {path}",
+    "finding.history": "Visto {count} vez/veces, primera {first}, última {last}",
+    "finding.ticket": "Ticket: {id} {url}",
+    "finding.occurrences": "Apariciones recientes:",
+    "finding.occurrence": "{percentage}% en {source}",
+    "finding.comments": "Comentarios:",
+    "findings.count": "{count} hallazgo(s):",
+    "findings.none": "Ningún hallazgo coincide.",
+    "report.findings": "🔎 Hallazgos:",
+    "report.recordedFindings": "🔎 Hallazgos registrados:",
+    "status.open": "abierto",
+    "status.acknowledged": "reconocido",
+    "status.resolved": "resuelto",
+    "severity.low": "baja",
+    "severity.medium": "media",
+    "severity.high": "alta",
+    "run.heading": "{heading} ({total}{inUse}), guardado como {id}:",
+    "run.inUse": " en uso",
+    "run.noSamples": "No se registraron muestras",
+    "run.suppressed": "🔕 {count} antipatrón(es) ocultos por supresiones",
+    "run.flamegraph": "🖼️ Flamegraph: {uri}",
+    "run.atCommit": " en el commit {commit}",
+    "run.output": "📜 Última salida:",
+    "sampleApp.summary": "🧪 La app de ejemplo se ejecutó durante {seconds}s{commit} con {profiles} perfil(es) y {findings} hallazgo(s)",
+    "sampleApp.chaos": "💥 Anomalías inyectadas (referencia real, tiempos desde el inicio de la ejecución):",
+    "sampleApp.tip": "💡 Consejo: Pasa los IDs guardados a top_functions, list_source o analyze_heap, o edita {source} y vuelve a ejecutarla para comparar con diff_flamegraph.",
+    "build.summary": "🏗️ Se perfiló `{command}` durante {seconds}s{commit} con {profiles} perfil(es) y {findings} hallazgo(s)",
+    "build.tip": "💡 Consejo: Los perfiles también cubren el arranque del programa; para un servidor, envíale carga durante la ejecución o usa una duración mayor para que domine el estado estable.",
+    "digest.title": "📊 *Resumen semanal de perfilado* {from} → {to}",
+    "digest.newHotspots": "🆕 Nuevos puntos calientes",
+    "digest.resolvedRegressions": "✅ Regresiones resueltas",
+    "digest.recurring": "🔁 Siguen apareciendo",
+    "digest.more": "…y {count} más",
+    "digest.none": "Ninguno",
+    "digest.trends": "📈 Tendencias de puntos calientes",
+    "digest.noTrends": "No hay suficientes capturas en este periodo",
+    "digest.storage": "🗄️ Almacenamiento",
+    "digest.files": "{size} en {count} archivo(s) en {dir}",
+    "digest.findings": "Hallazgos: {open} abiertos, {acknowledged} reconocidos, {resolved} resueltos",
+    "digest.suppressions": "Supresiones activas: {count}",
+  },
+};
+
+// Anti-pattern titles and suggestions by rule, in languages other than
+// English; the English text lives with the rules in antipatterns.ts
+const PATTERNS: Partial<Record<Lang, Record<string, { title: string; suggestion: string }>>> = {
+  es: {
+    "regex-compile": {
+      title: "Expresiones regulares compiladas en una ruta caliente",
+      suggestion: "Compila la expresión regular una vez a nivel de paquete y reutilízala.",
+    },
+    "string-concat": {
+      title: "Concatenación de cadenas en un bucle",
+      suggestion: "Construye las cadenas con strings.Builder o bytes.Buffer.",
+    },
+    "slice-growth": {
+      title: "Slices que crecen sin reservar capacidad",
+      suggestion: "Reserva capacidad con make([]T, 0, n) cuando se conoce el tamaño.",
+    },
+    "allocation-pressure": {
+      title: "Tasa de asignación alta",
+      suggestion: "Reduce las asignaciones de vida corta; reutiliza búferes o usa sync.Pool.",
+    },
+    "json-serialization": {
+      title: "Serialización JSON intensiva",
+      suggestion: "Evita codificar y decodificar repetidamente; guarda en caché la salida codificada o usa un códec más rápido.",
+    },
+    "hashing": {
+      title: "Hash criptográfico en una ruta caliente",
+      suggestion: "Calcula el hash una vez y guárdalo en caché, o usa un hash no criptográfico donde sea seguro.",
+    },
+    "lock-contention": {
+      title: "Contención de mutex",
+      suggestion: "Reduce las secciones críticas, divide el lock o usa operaciones atómicas.",
+    },
+    "goroutine-churn": {
+      title: "Goroutines lanzadas para trabajo trivial",
+      suggestion: "Usa un pool de workers o haz las unidades pequeñas de trabajo en línea.",
+    },
+    "deep-recursion": {
+      title: "Recursión profunda",
+      suggestion: "Memoiza los resultados o reescribe la función de forma iterativa.",
+    },
+    "custom-sort": {
+      title: "Ordenación escrita a mano en una ruta caliente",
+      suggestion: "Usa sort.Slice o slices.Sort (O(n log n)) en lugar de un algoritmo cuadrático.",
+    },
+  },
+};
+
+// A message in the given language with {name} placeholders filled in
+export function t(lang: Lang, key: MessageKey, params: Record<string, string | number> = {}): string {
+  const template = MESSAGES[lang][key] ?? EN[key];
+  return template.replace(/\{(\w+)\}/g, (match, name: string) => (name in params ? String(params[name]) : match));
+}
+
+// An anti-pattern rule's title and suggestion in the given language, or
+// undefined where only the English text exists
+export function patternText(lang: Lang, pattern: string): { title: string; suggestion: string } | undefined {
+  return PATTERNS[lang]?.[pattern];
+}
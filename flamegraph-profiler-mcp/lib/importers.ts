@@ -0,0 +1,260 @@
+/**
+ * Imports of profiles exported by other continuous-profiling products, so the
+ * catalog's diff and flamegraph tools work on them too:
+ *
+ * - pprof, as Parca, Pyroscope and Datadog all download single profiles
+ * - zip archives of pprof files, as Datadog's "Download profile" and Parca
+ *   bundles of several profile types; files that are not profiles, such as
+ *   Datadog's metrics.json, are skipped
+ * - Pyroscope's flamebearer JSON, the format of its UI's JSON export and of
+ *   its render API, converted back into a profile with one sample per frame
+ *   with self time
+ * - Linux `perf script` output and collapsed stacks ("a;b;c 42" lines, as
+ *   written by flamegraph.pl's stackcollapse scripts, py-spy, rbspy and
+ *   async-profiler), so programs in any language, and whole systems, can be
+ *   rendered and diffed like Go profiles
+ */
+import fs from "node:fs/promises";
+import path from "node:path";
+import { baselineKind, profileCommit } from "./baselines.js";
+import { catalogProfile, importProfile, type CatalogEntry } from "./catalog.js";
+import { nameClosures } from "./closures.js";
+import { checkProfileSize } from "./config.js";
+import { perfScriptToProfile } from "./perf.js";
+import { writeProfile, type Location, type Profile, type SampleType } from "./pprof.js";
+import { decodeProfile } from "./profileproto.js";
+import { storedProfilePath } from "./store.js";
+import { readZip } from "./zip.js";
+
+export const IMPORT_FORMATS = ["auto", "pprof", "archive", "flamebearer", "perf", "collapsed"] as const;
+export type ImportFormat = (typeof IMPORT_FORMATS)[number];
+
+interface Flamebearer {
+  names: string[];
+  levels: number[][];
+  numTicks: number;
+}
+
+interface FlamebearerExport {
+  version?: number;
+  flamebearer?: Flamebearer;
+  metadata?: { format?: string; units?: string; name?: string; sampleRate?: number; spyName?: string };
+  timeline?: { startTime?: number; durationDelta?: number; samples?: number[] };
+}
+
+// Sample types of a flamebearer's units, as the pprof profile Pyroscope made it from
+function flamebearerSampleTypes(units: string, name: string, sampleRate: number): { types: SampleType[]; scale: number[] } {
+  const alloc = /alloc/.test(name);
+  switch (units) {
+    case "samples":
+      // Ticks of a CPU profile, each 1/sampleRate seconds
+      return { types: [{ type: "samples", unit: "count" }, { type: "cpu", unit: "nanoseconds" }], scale: [1, 1e9 / sampleRate] };
+    case "bytes":
+      return { types: [{ type: alloc ? "alloc_space" : "inuse_space", unit: "bytes" }], scale: [1] };
+    case "objects":
+      return { types: [{ type: alloc ? "alloc_objects" : "inuse_objects", unit: "count" }], scale: [1] };
+    case "goroutines":
+      return { types: [{ type: "goroutine", unit: "count" }], scale: [1] };
+    case "lock_nanoseconds":
+      return { types: [{ type: "delay", unit: "nanoseconds" }], scale: [1] };
+    case "lock_samples":
+      return { types: [{ type: "contentions", unit: "count" }], scale: [1] };
+    default:
+      return { types: [{ type: units || "value", unit: "count" }], scale: [1] };
+  }
+}
+
+// Locations of exports that name frames only, one per function name
+function namedLocations() {
+  const locations = new Map<number, Location>();
+  const locationIds = new Map<string, number>();
+  const locationOf = (name: string) => {
+    let id = locationIds.get(name);
+    if (id === undefined) {
+      id = locationIds.size + 1;
+      locationIds.set(name, id);
+      locations.set(id, { id, address: "0x0", mappingId: 0, frames: [{ name, file: "", line: 0 }] });
+    }
+    return id;
+  };
+  return { locations, locationOf };
+}
+
+// Convert Pyroscope's flamebearer JSON to a profile. Each level lists its
+// bars as [x offset, total, self, name index] quadruples, with each x offset
+// relative to the end of the bar before it; a bar's parent is the bar one
+// level up whose span holds it.
+export function flamebearerToProfile(text: string): Profile {
+  const doc = JSON.parse(text) as FlamebearerExport & Partial<Flamebearer>;
+  const flamebearer = doc.flamebearer ?? (doc.levels ? (doc as Flamebearer) : undefined);
+  if (!flamebearer?.names || !flamebearer.levels) {
+    throw new Error("Not a flamebearer export: expected names and levels");
+  }
+  const metadata = doc.metadata ?? {};
+  if (metadata.format && metadata.format !== "single") {
+    throw new Error(`Flamebearer exports of format "${metadata.format}" are not supported; export each side of a comparison on its own`);
+  }
+  const { types, scale } = flamebearerSampleTypes(metadata.units ?? "samples", metadata.name ?? "", metadata.sampleRate || 100);
+
+  type Bar = { x: number; total: number; self: number; name: string; stack: string[] };
+  const { locations, locationOf } = namedLocations();
+
+  const samples: Profile["samples"] = [];
+  let parents: Bar[] = [];
+  flamebearer.levels.forEach((level, depth) => {
+    const bars: Bar[] = [];
+    let x = 0;
+    for (let i = 0; i + 3 < level.length; i += 4) {
+      x += level[i];
+      const name = flamebearer.names[level[i + 3]] ?? `unknown_${level[i + 3]}`;
+      const parent = parents.find((p) => x >= p.x && x < p.x + p.total);
+      // The first level is the "total" root, which is no frame of its own
+      const stack = depth === 0 ? [] : [...(parent?.stack ?? []), name];
+      bars.push({ x, total: level[i + 1], self: level[i + 2], name, stack });
+      if (level[i + 2] > 0 && stack.length > 0) {
+        samples.push({
+          values: scale.map((factor) => Math.round(level[i + 2] * factor)),
+          locationIds: stack.map(locationOf).reverse(),
+          labels: {},
+        });
+      }
+      x += level[i + 1];
+    }
+    parents = bars;
+  });
+
+  const { timeline } = doc;
+  const duration = timeline?.durationDelta && timeline.samples ? timeline.durationDelta * timeline.samples.length : undefined;
+  return nameClosures({
+    sampleTypes: types,
+    samples,
+    locations,
+    mappings: [],
+    ...(types[0].type === "samples" ? { periodType: { type: "cpu", unit: "nanoseconds" }, period: Math.round(1e9 / (metadata.sampleRate || 100)) } : { period: 1 }),
+    ...(timeline?.startTime ? { timeNanos: timeline.startTime * 1e9 } : {}),
+    ...(duration ? { durationSeconds: duration } : {}),
+  });
+}
+
+// Convert collapsed stacks to a profile. Each line is a stack, root first
+// with frames separated by semicolons, and its sample count after the last
+// space; frames keep flamegraph.pl's annotations, e.g. "_[k]" for the kernel.
+export function collapsedToProfile(text: string): Profile {
+  const { locations, locationOf } = namedLocations();
+  const stacks = new Map<string, Profile["samples"][number]>();
+  for (const line of text.split("\n")) {
+    const match = line.match(/^(.*\S)\s+(\d+)\s*$/);
+    if (!match) {
+      continue;
+    }
+    const frames = match[1].split(";").filter((frame) => frame !== "");
+    const key = frames.join(";");
+    const sample = stacks.get(key);
+    if (sample) {
+      sample.values[0] += Number(match[2]);
+    } else if (frames.length > 0) {
+      stacks.set(key, { values: [Number(match[2])], locationIds: frames.map(locationOf).reverse(), labels: {} });
+    }
+  }
+  if (stacks.size === 0) {
+    throw new Error("No stacks found; expected collapsed stacks, one \"root;...;leaf count\" per line");
+  }
+  return nameClosures({
+    sampleTypes: [{ type: "samples", unit: "count" }],
+    samples: [...stacks.values()],
+    locations,
+    mappings: [],
+    period: 1,
+  });
+}
+
+// Add CPU time to a profile of samples taken at a frequency in Hz, for text
+// exports that only count them
+function withCpuTime(profile: Profile, frequency: number): Profile {
+  if (profile.sampleTypes.some((t) => t.type === "cpu")) {
+    return profile;
+  }
+  const nanosPerSample = Math.round(1e9 / frequency);
+  return {
+    ...profile,
+    sampleTypes: [...profile.sampleTypes, { type: "cpu", unit: "nanoseconds" }],
+    samples: profile.samples.map((sample) => ({ ...sample, values: [...sample.values, sample.values[0] * nanosPerSample] })),
+    periodType: { type: "cpu", unit: "nanoseconds" },
+    period: nanosPerSample,
+    defaultSampleType: "cpu",
+  };
+}
+
+// Format of an export, from its first bytes
+export function detectFormat(data: Buffer): Exclude<ImportFormat, "auto"> {
+  if (data.readUInt32LE(0) === 0x04034b50) return "archive";
+  const head = data.subarray(0, 64 * 1024).toString("utf-8");
+  if (head.trimStart().startsWith("{")) return "flamebearer";
+  // Text, unlike the gzipped or raw protobuf of pprof
+  if (!(data[0] === 0x1f && data[1] === 0x8b) && !data.subarray(0, 1024).includes(0)) {
+    if (/^\s+[0-9a-f]+\s+\S.*\(.*\)\s*$/m.test(head)) return "perf";
+    const first = head.split("\n").find((line) => line.trim() !== "" && !line.startsWith("#"));
+    if (first && /^\S.*\s\d+\s*$/.test(first)) return "collapsed";
+  }
+  return "pprof";
+}
+
+// Import an export of another profiler into the catalog: one entry for a
+// pprof file, flamebearer JSON or perf text, and one per profile in an
+// archive. Samples of perf or collapsed text taken at a frequency in Hz
+// also count as CPU time.
+export async function importExport(
+  file: string,
+  details: { format?: ImportFormat; target?: string; profileType?: string; labels?: Record<string, string>; frequency?: number } = {},
+): Promise<{ format: Exclude<ImportFormat, "auto">; entries: CatalogEntry[]; skipped: string[] }> {
+  const source = path.resolve(file);
+  const data = await fs.readFile(source);
+  checkProfileSize(data.length, source);
+  const format = !details.format || details.format === "auto" ? detectFormat(data) : details.format;
+  if (format === "pprof") {
+    return { format, entries: [await importProfile(source, details)], skipped: [] };
+  }
+
+  const name = path.basename(source).replace(/\.(json|zip|txt|folded|collapsed|perf)$/, "");
+  const store = async (profile: Profile, from: string, member?: string) => {
+    const profileType = details.profileType ?? baselineKind(profile);
+    const stored = await storedProfilePath(`${name}${member ? `_${path.basename(member).replace(/\.[^.]*$/, "")}` : ""}_${profileType}`);
+    writeProfile(stored, profile);
+    return catalogProfile(stored, {
+      target: details.target ?? source,
+      profileType,
+      commit: profileCommit(profile),
+      importedFrom: from,
+      labels: { format, ...details.labels },
+    });
+  };
+
+  if (format === "flamebearer") {
+    return { format, entries: [await store(flamebearerToProfile(data.toString("utf-8")), source)], skipped: [] };
+  }
+  if (format === "perf" || format === "collapsed") {
+    const text = data.toString("utf-8");
+    const profile = format === "perf" ? perfScriptToProfile(text) : collapsedToProfile(text);
+    return { format, entries: [await store(details.frequency ? withCpuTime(profile, details.frequency) : profile, source)], skipped: [] };
+  }
+  const entries: CatalogEntry[] = [];
+  const skipped: string[] = [];
+  for (const member of readZip(data)) {
+    let profile: Profile;
+    try {
+      profile = nameClosures(decodeProfile(member.content));
+    } catch {
+      skipped.push(member.name);
+      continue;
+    }
+    if (profile.sampleTypes.length === 0) {
+      skipped.push(member.name);
+      continue;
+    }
+    entries.push(await store(profile, `${source}#${member.name}`, member.name));
+  }
+  if (entries.length === 0) {
+    throw new Error(`No pprof profiles in ${source}${skipped.length > 0 ? ` (only ${skipped.join(", ")})` : ""}`);
+  }
+  return { format, entries, skipped };
+}
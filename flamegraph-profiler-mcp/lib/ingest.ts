@@ -0,0 +1,112 @@
+/**
+ * Profiles pushed by applications to the HTTP server's /ingest endpoint, for
+ * targets the server cannot pull from, such as processes behind NAT. Each
+ * upload is stored, catalogued and added to the capture history like the
+ * server's own captures, so trends, regressions and the digest include it.
+ */
+import fs from "node:fs/promises";
+import { baselineKind, profileCommit } from "./baselines.js";
+import { recordCapture } from "./captures.js";
+import { catalogProfile, type CatalogEntry } from "./catalog.js";
+import { ProfileTooLargeError } from "./config.js";
+import { topFunctionsOf } from "./flamegraph.js";
+import { readProfile, sampleIndexOf, toBaseUnit, totalOf } from "./pprof.js";
+import { storedProfilePath } from "./store.js";
+
+// Labels accepted per upload
+const MAX_LABELS = 20;
+
+export interface IngestRequest {
+  // Service or process the profile is of
+  target: string;
+  profileType?: string;
+  // Capture window in seconds
+  duration?: number;
+  commit?: string;
+  labels: Record<string, string>;
+  // Authenticated client that pushed it
+  client: string;
+}
+
+// A rejected upload, answered with its HTTP status
+export class IngestError extends Error {
+  readonly status: number;
+
+  constructor(message: string, status = 400) {
+    super(message);
+    this.status = status;
+  }
+}
+
+// Parse the query of an upload: target, type, seconds, commit, and labels as
+// "key=value,key=value"
+export function ingestRequestOf(query: Record<string, unknown>, client: string): IngestRequest {
+  const text = (name: string) => (typeof query[name] === "string" && query[name] !== "" ? (query[name] as string) : undefined);
+  const target = text("target");
+  if (!target || !/^[\w.:/@-]{1,200}$/.test(target)) {
+    throw new IngestError("target is required: letters, digits and . : / @ - _ only");
+  }
+  const seconds = text("seconds");
+  const duration = seconds === undefined ? undefined : Number(seconds);
+  if (duration !== undefined && !(duration >= 0)) {
+    throw new IngestError("seconds must be a non-negative number");
+  }
+  const commit = text("commit");
+  if (commit !== undefined && !/^[0-9a-f]{7,40}$/.test(commit)) {
+    throw new IngestError("commit must be a hex commit hash");
+  }
+  const labels: Record<string, string> = {};
+  for (const pair of (text("labels") ?? "").split(",").filter(Boolean)) {
+    const [key, ...value] = pair.split("=");
+    if (!key || value.length === 0) {
+      throw new IngestError(`label ${pair} is not key=value`);
+    }
+    labels[key.trim()] = value.join("=").trim();
+  }
+  if (Object.keys(labels).length > MAX_LABELS) {
+    throw new IngestError(`at most ${MAX_LABELS} labels`);
+  }
+  return { target, profileType: text("type"), duration, commit, labels, client };
+}
+
+// Store, catalog and record a pushed pprof file
+export async function ingestProfile(body: Buffer, request: IngestRequest): Promise<CatalogEntry> {
+  if (body.length === 0) {
+    throw new IngestError("Empty body; send the pprof file as the request body");
+  }
+  const stored = await storedProfilePath(`${request.target}_${request.profileType ?? "pushed"}`);
+  await fs.writeFile(stored, body);
+  let profile;
+  try {
+    profile = readProfile(stored);
+  } catch (error) {
+    await fs.rm(stored, { force: true });
+    if (error instanceof ProfileTooLargeError) {
+      throw new IngestError(error.message, 413);
+    }
+    throw new IngestError(`Not a pprof profile: ${error instanceof Error ? error.message : error}`);
+  }
+
+  const profileType = request.profileType ?? baselineKind(profile);
+  const commit = request.commit ?? profileCommit(profile);
+  const sampleIndex = sampleIndexOf(profile);
+  const { unit } = profile.sampleTypes[sampleIndex];
+  const capture = await recordCapture({
+    target: request.target,
+    commit,
+    profileType,
+    duration: request.duration ?? profile.durationSeconds ?? 0,
+    total: toBaseUnit(totalOf(profile, sampleIndex), unit),
+    unit: unit === "bytes" ? "bytes" : unit.endsWith("seconds") ? "seconds" : "count",
+    topFunctions: topFunctionsOf(profile, sampleIndex),
+    issues: 0,
+  }).catch(() => undefined);
+  return catalogProfile(stored, {
+    target: request.target,
+    profileType,
+    commit,
+    captureId: capture?.id,
+    pushedBy: request.client,
+    labels: request.labels,
+  });
+}
@@ -0,0 +1,208 @@
+/**
+ * Interactive flamegraphs: a self-contained HTML page drawing the frame tree
+ * with d3-flame-graph, whose scripts and styles are inlined from node_modules
+ * so the page opens offline and in sandboxes without network access. Frames
+ * zoom on click, searches highlight matching frames, and tooltips give each
+ * frame's value and share, which keeps deep stacks readable where a static
+ * SVG's labels run out of room. Frames with a source link show it when clicked.
+ */
+import fs from "node:fs";
+import path from "node:path";
+import type { FlameFrame, Orientation } from "./charts.js";
+import { defaultColorScheme, frameColorer, type ColorScheme } from "./colors.js";
+import type { SourceLink } from "./sourcelinks.js";
+
+// Frames narrower than this fraction of the total stay out of the page, which
+// would otherwise grow with every rare stack of a long capture
+const MIN_FRACTION = 0.00001;
+
+const ASSETS = {
+  d3: ["d3", "dist/d3.min.js"],
+  flamegraph: ["d3-flame-graph", "dist/d3-flamegraph.min.js"],
+  tooltip: ["d3-flame-graph", "dist/d3-flamegraph-tooltip.min.js"],
+  css: ["d3-flame-graph", "dist/d3-flamegraph.css"],
+} as const;
+
+let assets: Record<keyof typeof ASSETS, string> | undefined;
+
+// A file of an installed package, looked up through the node_modules
+// directories above this module like Node's own resolution; d3 exports no
+// subpaths, so require.resolve cannot find its dist files
+function packageFile(name: string, file: string): string {
+  for (let dir = import.meta.dirname; ; dir = path.dirname(dir)) {
+    const candidate = path.join(dir, "node_modules", name, file);
+    if (fs.existsSync(candidate)) {
+      return candidate;
+    }
+    if (path.dirname(dir) === dir) {
+      throw new Error(`${name} is not installed; run npm install in the server's directory to draw interactive flamegraphs`);
+    }
+  }
+}
+
+function loadAssets(): Record<keyof typeof ASSETS, string> {
+  assets ??= Object.fromEntries(
+    Object.entries(ASSETS).map(([key, [name, file]]) => [key, fs.readFileSync(packageFile(name, file), "utf-8")]),
+  ) as Record<keyof typeof ASSETS, string>;
+  return assets;
+}
+
+function escape(text: string): string {
+  return text.replace(/[&<>"']/g, (c) => `&#${c.charCodeAt(0)};`);
+}
+
+// Text that can sit inside a <script> or <style> element without ending it
+function inline(text: string): string {
+  return text.replace(/<\/(script|style)/gi, "<\\/$1");
+}
+
+interface PageFrame {
+  name: string;
+  value: number;
+  // Fill of the frame in the chosen color scheme
+  color: string;
+  // Tooltip: name, value, share of the total and self value
+  detail: string;
+  // Source of the frame's function and where in it the link points
+  url?: string;
+  where?: string;
+  children?: PageFrame[];
+}
+
+// The frame tree as d3-flame-graph draws it, with colors and tooltips worked
+// out here so the page needs no copy of the color schemes
+function pageTree(
+  root: FlameFrame,
+  formatValue: (value: number) => string,
+  color: (frame: FlameFrame) => string,
+  link?: (frame: FlameFrame) => SourceLink | undefined,
+): { root: PageFrame; frames: number; dropped: number; linked: number } {
+  const total = root.value || 1;
+  const threshold = Math.abs(root.value) * MIN_FRACTION;
+  let frames = 0;
+  let dropped = 0;
+  let linked = 0;
+  const copy = (frame: FlameFrame): PageFrame => {
+    frames++;
+    const children = frame.children ?? [];
+    const self = frame.value - children.reduce((sum, c) => sum + c.value, 0);
+    const kept = children.filter((c) => c.value !== 0 && Math.abs(c.value) >= threshold);
+    dropped += children.length - kept.length;
+    const node: PageFrame = {
+      name: frame.name,
+      value: frame.value,
+      color: color(frame),
+      detail: `${frame.name}: ${formatValue(frame.value)} (${Math.round((frame.value / total) * 10000) / 100}%), self ${formatValue(self)}`,
+    };
+    const source = link?.(frame);
+    if (source) {
+      linked++;
+      Object.assign(node, { url: source.url, where: source.where, detail: `${node.detail} · ${source.where}` });
+    }
+    if (kept.length > 0) {
+      node.children = kept.map(copy);
+    }
+    return node;
+  };
+  return { root: copy(root), frames, dropped, linked };
+}
+
+// Self-contained HTML page of an interactive flamegraph. meta is a line of
+// context under the title (target, time, labels); description, the tree as
+// text, is added for screen readers when given; link gives frames their source.
+export function interactiveFlamegraph(
+  root: FlameFrame,
+  options: {
+    title: string;
+    meta?: string;
+    formatValue?: (value: number) => string;
+    colorScheme?: ColorScheme;
+    orientation?: Orientation;
+    accessibility?: boolean;
+    description?: string;
+    link?: (frame: FlameFrame) => SourceLink | undefined;
+  },
+): string {
+  const { title, meta, formatValue = (v) => String(v), colorScheme = defaultColorScheme(root), orientation = "flame", accessibility = false } = options;
+  const { d3, flamegraph, tooltip, css } = loadAssets();
+  const colorer = frameColorer(colorScheme, root, accessibility);
+  const tree = pageTree(root, formatValue, (frame) => colorer.color(frame), options.link);
+  const legend = colorer.legend
+    .map((entry) => `<span class="key"><i style="background:${escape(entry.color)}"></i>${escape(entry.label)}</span>`)
+    .join("");
+  const data = JSON.stringify(tree.root).replace(/</g, "\\u003c");
+  return `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>${escape(title)}</title>
+<style>
+${inline(css)}
+body { font-family: system-ui, sans-serif; margin: 16px; color: #222; }
+h1 { font-size: 1.3em; margin: 0 0 4px; }
+form { display: flex; gap: 8px; align-items: center; margin: 12px 0; }
+input[type=search] { flex: 0 1 360px; padding: 4px 6px; font-family: monospace; }
+.meta { color: #555; margin: 4px 0; }
+.key { margin-right: 14px; white-space: nowrap; }
+.key i { display: inline-block; width: 10px; height: 10px; margin-right: 4px; vertical-align: middle; }
+#chart { width: 100%; }
+</style>
+</head>
+<body>
+<h1>${escape(title)}</h1>
+${meta ? `<p class="meta">${escape(meta)}</p>\n` : ""}${legend ? `<p class="meta">${legend}</p>\n` : ""}<form id="search" role="search" onsubmit="return false">
+<input type="search" placeholder="Search functions (regex), e.g. dataProcessingPipeline" aria-label="Search functions">
+<button type="button" id="reset">Reset zoom</button>
+<span id="matches" class="meta" aria-live="polite"></span>
+</form>
+<div id="chart"></div>
+${tree.linked > 0 ? `<p id="source" class="meta" hidden>Source of <b></b>: <a target="_blank" rel="noopener"></a></p>\n` : ""}<p class="meta">Click a frame to zoom into it${tree.linked > 0 ? " and link to its source" : ""}, and a frame below it to zoom back out; hover for values. ${tree.frames} frame(s)${tree.dropped > 0 ? `, ${tree.dropped} under ${MIN_FRACTION * 100}% of the total left out` : ""}.</p>
+${options.description ? `<details><summary>Flamegraph as text</summary>\n<pre>${escape(options.description)}</pre>\n</details>\n` : ""}<script>${inline(d3)}</script>
+<script>${inline(flamegraph)}</script>
+<script>${inline(tooltip)}</script>
+<script>
+const data = ${data};
+const chart = flamegraph()
+  .width(document.getElementById("chart").clientWidth || 1200)
+  .cellHeight(18)
+  .minFrameSize(1)
+  .transitionDuration(300)
+  .inverted(${orientation === "icicle"})
+  .setColorMapper((d) => (d.highlight ? "#e600e6" : d.data.color))
+  .tooltip(flamegraph.tooltip.defaultFlamegraphTooltip().text((d) => d.data.detail))
+  .onClick((d) => {
+    const source = document.getElementById("source");
+    if (source) {
+      source.hidden = !d.data.url;
+      source.querySelector("b").textContent = d.data.name;
+      source.querySelector("a").textContent = d.data.where || "";
+      source.querySelector("a").href = d.data.url || "";
+    }
+  });
+d3.select("#chart").datum(data).call(chart);
+
+const input = document.querySelector("#search input");
+const matches = document.getElementById("matches");
+input.addEventListener("input", () => {
+  const term = input.value.trim();
+  if (!term) {
+    chart.clear();
+    matches.textContent = "";
+    return;
+  }
+  chart.search(term);
+  let pattern = null;
+  try {
+    pattern = new RegExp(term);
+  } catch {}
+  const hit = (name) => (pattern ? pattern.test(name) : name.includes(term));
+  // Matching frames inside matching frames are counted once
+  const sum = (frame) => (hit(frame.name) ? frame.value : (frame.children || []).reduce((total, c) => total + sum(c), 0));
+  matches.textContent = (Math.round((sum(data) / (data.value || 1)) * 10000) / 100) + "% of the total matches";
+});
+document.getElementById("reset").addEventListener("click", () => chart.resetZoom());
+</script>
+</body>
+</html>
+`;
+}
@@ -0,0 +1,164 @@
+/**
+ * Kubernetes pods: pod metadata and port-forwards to a container's pprof port, via kubectl.
+ */
+import { execFile, spawn } from "node:child_process";
+import { promisify } from "node:util";
+import type { Profile } from "./pprof.js";
+
+const execFileAsync = promisify(execFile);
+
+export interface PodRef {
+  namespace: string;
+  pod: string;
+  // Default: the pod's default-container annotation, else its first container
+  container?: string;
+  // kubeconfig context (default: the current context)
+  context?: string;
+}
+
+export interface PodMetadata {
+  namespace: string;
+  pod: string;
+  container: string;
+  image?: string;
+  node?: string;
+  podIP?: string;
+  // Controlling workload, e.g. "ReplicaSet/checkout-7f9c"
+  owner?: string;
+  startedAt?: string;
+  labels: Record<string, string>;
+  // Port the container declares for pprof, if any
+  pprofPort?: number;
+}
+
+export interface PortForward {
+  // Local host:port forwarded to the pod
+  address: string;
+  close(): void;
+}
+
+// Port used when neither the caller nor the container names a pprof port
+export const DEFAULT_PPROF_PORT = 6060;
+
+// Container port names taken to serve net/http/pprof
+const PPROF_PORT_NAMES = ["pprof", "debug", "http-debug"];
+
+// Time allowed for kubectl to establish a port-forward
+const PORT_FORWARD_TIMEOUT_MS = 15_000;
+
+interface PodJson {
+  metadata: {
+    labels?: Record<string, string>;
+    annotations?: Record<string, string>;
+    ownerReferences?: Array<{ kind: string; name: string; controller?: boolean }>;
+  };
+  spec: {
+    nodeName?: string;
+    containers: Array<{ name: string; image?: string; ports?: Array<{ name?: string; containerPort: number }> }>;
+  };
+  status: { podIP?: string; startTime?: string; phase?: string };
+}
+
+function kubectlArgs(ref: PodRef, args: string[]): string[] {
+  return [...(ref.context ? ["--context", ref.context] : []), "--namespace", ref.namespace, ...args];
+}
+
+function kubectlError(error: unknown): Error {
+  if ((error as NodeJS.ErrnoException).code === "ENOENT") {
+    return new Error("kubectl not found on PATH");
+  }
+  const stderr = (error as { stderr?: string }).stderr?.trim();
+  return new Error(stderr || (error instanceof Error ? error.message : String(error)));
+}
+
+// Look up a running pod and the container to profile
+export async function podMetadata(ref: PodRef): Promise<PodMetadata> {
+  let pod: PodJson;
+  try {
+    const { stdout } = await execFileAsync("kubectl", kubectlArgs(ref, ["get", "pod", ref.pod, "--output", "json"]), {
+      maxBuffer: 16 * 1024 * 1024,
+    });
+    pod = JSON.parse(stdout) as PodJson;
+  } catch (error) {
+    throw kubectlError(error);
+  }
+  if (pod.status.phase && pod.status.phase !== "Running") {
+    throw new Error(`Pod ${ref.namespace}/${ref.pod} is ${pod.status.phase}, not Running`);
+  }
+
+  const name = ref.container ??
+    pod.metadata.annotations?.["kubectl.kubernetes.io/default-container"] ??
+    pod.spec.containers[0]?.name;
+  const container = pod.spec.containers.find((c) => c.name === name);
+  if (!container) {
+    const names = pod.spec.containers.map((c) => c.name).join(", ");
+    throw new Error(`Pod ${ref.namespace}/${ref.pod} has no container '${name}' (containers: ${names})`);
+  }
+
+  const owner = pod.metadata.ownerReferences?.find((o) => o.controller) ?? pod.metadata.ownerReferences?.[0];
+  return {
+    namespace: ref.namespace,
+    pod: ref.pod,
+    container: container.name,
+    image: container.image,
+    node: pod.spec.nodeName,
+    podIP: pod.status.podIP,
+    owner: owner && `${owner.kind}/${owner.name}`,
+    startedAt: pod.status.startTime,
+    labels: pod.metadata.labels ?? {},
+    pprofPort: container.ports?.find((p) => p.name && PPROF_PORT_NAMES.includes(p.name))?.containerPort,
+  };
+}
+
+// Forward a free local port to a pod port with `kubectl port-forward`
+export function portForward(ref: PodRef, port: number): Promise<PortForward> {
+  return new Promise((resolve, reject) => {
+    const child = spawn("kubectl", kubectlArgs(ref, ["port-forward", `pod/${ref.pod}`, `:${port}`]), {
+      stdio: ["ignore", "pipe", "pipe"],
+    });
+    let stdout = "";
+    let stderr = "";
+    const fail = (error: Error) => {
+      clearTimeout(timer);
+      child.kill();
+      reject(error);
+    };
+    const timer = setTimeout(
+      () => fail(new Error(`Timed out waiting for kubectl port-forward to ${ref.namespace}/${ref.pod}:${port}${stderr ? `: ${stderr.trim()}` : ""}`)),
+      PORT_FORWARD_TIMEOUT_MS,
+    );
+
+    child.stdout.on("data", (chunk: Buffer) => {
+      stdout += chunk.toString();
+      // e.g. "Forwarding from 127.0.0.1:41235 -> 6060"
+      const match = stdout.match(/Forwarding from 127\.0\.0\.1:(\d+) ->/);
+      if (match) {
+        clearTimeout(timer);
+        resolve({ address: `127.0.0.1:${match[1]}`, close: () => child.kill() });
+      }
+    });
+    child.stderr.on("data", (chunk: Buffer) => (stderr += chunk.toString()));
+    child.on("error", (error) => fail(kubectlError(error)));
+    child.on("exit", (code) => fail(new Error(`kubectl port-forward exited with code ${code}${stderr ? `: ${stderr.trim()}` : ""}`)));
+  });
+}
+
+// Record pod metadata in a profile's comments, shown by `pprof -comments`
+export function annotateWithPod(profile: Profile, pod: PodMetadata): Profile {
+  const fields: Array<[string, string | undefined]> = [
+    ["namespace", pod.namespace],
+    ["pod", pod.pod],
+    ["container", pod.container],
+    ["image", pod.image],
+    ["node", pod.node],
+    ["owner", pod.owner],
+    ...Object.entries(pod.labels).map(([key, value]): [string, string] => [`label.${key}`, value]),
+  ];
+  return {
+    ...profile,
+    comments: [
+      ...(profile.comments ?? []),
+      ...fields.filter(([, value]) => value).map(([key, value]) => `k8s.${key}=${value}`),
+    ],
+  };
+}
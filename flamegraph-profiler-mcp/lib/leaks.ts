@@ -0,0 +1,207 @@
+/**
+ * Heap leak detection from a series of heap snapshots of a live target. A
+ * single heap profile shows what is live, not what keeps growing: a large
+ * cache looks the same as a leak. Taken over minutes, a leaking allocation
+ * site's in-use bytes only go up, so each site's series is fitted with a
+ * least-squares line and the sites that grew at every snapshot are reported,
+ * fastest first.
+ */
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { setTimeout as sleep } from "node:timers/promises";
+import { readProfile, sampleIndexOf, type Frame, type Profile, type Sample } from "./pprof.js";
+import { duringWindow, noProgress, type ProgressReporter } from "./progress.js";
+import { fetchPprof } from "./target.js";
+
+export interface HeapSnapshot {
+  // Capture time, in milliseconds since the epoch
+  at: number;
+  file: string;
+  profile: Profile;
+}
+
+export interface Trend {
+  // Growth per minute, in the unit of the values
+  perMinute: number;
+  // How well a line fits the values, from 0 to 1
+  r2: number;
+}
+
+export interface SiteTrend extends Trend {
+  function: string;
+  file: string;
+  line: number;
+  // In-use bytes and objects at each snapshot, oldest first
+  bytes: number[];
+  objects: number[];
+  // Bytes gained from the first snapshot to the last
+  growth: number;
+  // Heaviest stack allocating at the site in the last snapshot, from the site
+  stack: string[];
+}
+
+export interface LeakReport {
+  snapshots: number;
+  // Capture times, ISO 8601, oldest first
+  at: string[];
+  // Total in-use bytes at each snapshot, and their trend
+  totalBytes: number[];
+  total: Trend;
+  // Sites that grew at every snapshot by at least the minimum, fastest
+  // first, up to the limit of the count found
+  leaks: SiteTrend[];
+  leakCount: number;
+  // Sites that grew overall but fell at some snapshot, e.g. caches that evict
+  growing: number;
+}
+
+// Frames shown for each site's stack
+export const STACK_DEPTH = 6;
+
+// Frames of the runtime's own allocation paths, e.g. runtime.makeslice or
+// internal/bytealg.MakeNoZero, which name no site of their own
+const RUNTIME_FRAME = /^(runtime|internal\/[\w/]+)\./;
+
+// Least-squares line through values taken at times (in milliseconds)
+export function fitTrend(times: number[], values: number[]): Trend {
+  const n = values.length;
+  const minutes = times.map((t) => (t - times[0]) / 60_000);
+  const meanX = minutes.reduce((a, b) => a + b, 0) / n;
+  const meanY = values.reduce((a, b) => a + b, 0) / n;
+  let sxx = 0;
+  let sxy = 0;
+  let syy = 0;
+  for (let i = 0; i < n; i++) {
+    sxx += (minutes[i] - meanX) ** 2;
+    sxy += (minutes[i] - meanX) * (values[i] - meanY);
+    syy += (values[i] - meanY) ** 2;
+  }
+  if (sxx === 0) {
+    return { perMinute: 0, r2: 0 };
+  }
+  return {
+    perMinute: sxy / sxx,
+    r2: syy === 0 ? 1 : Math.round(((sxy * sxy) / (sxx * syy)) * 1000) / 1000,
+  };
+}
+
+// Capture count heap snapshots of a target, interval seconds apart. Each is
+// taken after a garbage collection (gc=1), so in-use bytes are what is still
+// reachable rather than what the last cycle happened to leave.
+export async function captureHeapSeries(
+  target: string,
+  count: number,
+  interval: number,
+  progress: ProgressReporter = noProgress,
+  signal?: AbortSignal,
+): Promise<HeapSnapshot[]> {
+  const snapshots: HeapSnapshot[] = [];
+  const started = Date.now();
+  try {
+    for (let i = 0; i < count; i++) {
+      if (i > 0) {
+        await duringWindow(progress, `waiting for heap snapshot ${i + 1}/${count}`, interval,
+          sleep(interval * 1000, undefined, { signal }), Math.floor((Date.now() - started) / 1000));
+      }
+      const response = await fetchPprof(target, "heap", { gc: 1 }, 0, signal);
+      const file = path.join(os.tmpdir(), `heap_${Date.now()}_${i}.out`);
+      await fs.writeFile(file, Buffer.from(await response.arrayBuffer()));
+      snapshots.push({ at: Date.now(), file, profile: readProfile(file) });
+    }
+  } catch (error) {
+    await Promise.all(snapshots.map((s) => fs.unlink(s.file).catch(() => undefined)));
+    throw error;
+  }
+  return snapshots;
+}
+
+// Where a heap sample was allocated: its frames, leaf first, and the index of
+// the first past the runtime's, whose function and line name the site
+export function allocationSite(profile: Profile, sample: Sample): { key: string; frames: Frame[]; start: number } | undefined {
+  const frames = sample.locationIds.flatMap((id) => profile.locations.get(id)?.frames ?? []);
+  const start = Math.max(0, frames.findIndex((f) => !RUNTIME_FRAME.test(f.name)));
+  const leaf = frames[start];
+  return leaf && { key: `${leaf.name}:${leaf.file}:${leaf.line}`, frames, start };
+}
+
+// In-use bytes and objects of each allocation site across snapshots
+function siteSeries(snapshots: HeapSnapshot[]): Map<string, Omit<SiteTrend, keyof Trend | "growth">> {
+  const sites = new Map<string, Omit<SiteTrend, keyof Trend | "growth">>();
+  // Bytes of the stack each site shows
+  const heaviest = new Map<string, number>();
+  snapshots.forEach(({ profile }, i) => {
+    const spaceIndex = sampleIndexOf(profile, "inuse_space");
+    const objectsIndex = sampleIndexOf(profile, "inuse_objects");
+    for (const sample of profile.samples) {
+      const bytes = sample.values[spaceIndex];
+      if (bytes === 0) {
+        continue;
+      }
+      const at = allocationSite(profile, sample);
+      if (!at) {
+        continue;
+      }
+      const { key, frames, start } = at;
+      const leaf = frames[start];
+      let site = sites.get(key);
+      if (!site) {
+        site = {
+          function: leaf.name,
+          file: leaf.file,
+          line: leaf.line,
+          bytes: new Array(snapshots.length).fill(0),
+          objects: new Array(snapshots.length).fill(0),
+          stack: [],
+        };
+        sites.set(key, site);
+      }
+      site.bytes[i] += bytes;
+      site.objects[i] += sample.values[objectsIndex];
+      // Sites are reported by where they stand now, so their stack is the last snapshot's
+      if (i === snapshots.length - 1 && bytes > (heaviest.get(key) ?? 0)) {
+        heaviest.set(key, bytes);
+        site.stack = frames.slice(start, start + STACK_DEPTH).map((f) => f.name);
+      }
+    }
+  });
+  return sites;
+}
+
+// Find the sites whose in-use bytes rose at every snapshot by at least
+// minGrowth bytes in all, fastest growing first
+export function detectLeaks(snapshots: HeapSnapshot[], minGrowth: number, limit = 10): LeakReport {
+  if (snapshots.length < 3) {
+    throw new Error("Leak detection needs at least 3 heap snapshots");
+  }
+  const times = snapshots.map((s) => s.at);
+  const leaks: SiteTrend[] = [];
+  let growing = 0;
+  for (const site of siteSeries(snapshots).values()) {
+    const growth = site.bytes[site.bytes.length - 1] - site.bytes[0];
+    if (growth <= 0) {
+      continue;
+    }
+    const monotonic = site.bytes.every((b, i) => i === 0 || b >= site.bytes[i - 1]);
+    if (!monotonic || growth < minGrowth) {
+      growing += monotonic ? 0 : 1;
+      continue;
+    }
+    leaks.push({ ...site, ...fitTrend(times, site.bytes), growth });
+  }
+  leaks.sort((a, b) => b.perMinute - a.perMinute);
+
+  const totalBytes = snapshots.map(({ profile }) => {
+    const index = sampleIndexOf(profile, "inuse_space");
+    return profile.samples.reduce((sum, s) => sum + s.values[index], 0);
+  });
+  return {
+    snapshots: snapshots.length,
+    at: times.map((t) => new Date(t).toISOString()),
+    totalBytes,
+    total: fitTrend(times, totalBytes),
+    leaks: leaks.slice(0, limit),
+    leakCount: leaks.length,
+    growing,
+  };
+}
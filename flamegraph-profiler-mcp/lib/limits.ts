@@ -0,0 +1,274 @@
+/**
+ * Concurrency and rate limits on captures, so a burst of tool calls cannot
+ * profile one production process five times at once. Every capture first
+ * takes a slot, under the server config's limits on captures per target, in
+ * all, and started per target per minute. Calls wait in line for a slot,
+ * reporting progress, and fail with a structured error once they have waited
+ * limits.captureQueueSeconds.
+ */
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { serverConfig } from "./config.js";
+import { nextProgressStep, noProgress, progressReporter, type ProgressReporter, type ToolExtra } from "./progress.js";
+import { pprofAddress } from "./target.js";
+
+type Args = Record<string, unknown>;
+
+// The limit that held a capture back
+export type CaptureLimitKind = "per_target" | "global" | "per_minute";
+
+// Structured content of a call that did not get a slot
+export interface CaptureLimit {
+  error: "capture_limit";
+  limit: CaptureLimitKind;
+  target: string;
+  // Captures running against the target, and in all
+  running: { target: number; total: number };
+  // The configured value of the limit
+  max: number;
+  waitedSeconds: number;
+  // When the per-minute limit next lets a capture of the target start
+  retryAfterSeconds?: number;
+}
+
+export class CaptureLimitError extends Error {
+  readonly limit: CaptureLimit;
+
+  constructor(limit: CaptureLimit, message: string) {
+    super(message);
+    this.limit = limit;
+  }
+}
+
+function addressOf(target: unknown): string {
+  try {
+    return pprofAddress(String(target));
+  } catch {
+    return String(target);
+  }
+}
+
+// What each capture tool captures from, as the key its limits are counted
+// by, or undefined for calls that only read files. Tools missing here only
+// start or stop background work, or read what was captured, and are not limited.
+const CAPTURE_TARGETS: Record<string, (args: Args) => string | undefined> = {
+  "profile-app": (a) => `app:${a.appPath}`,
+  capture_block_profile: (a) => addressOf(a.target),
+  capture_mutex_profile: (a) => addressOf(a.target),
+  capture_goroutine_profile: (a) => addressOf(a.target),
+  group_goroutines: (a) => (a.target ? addressOf(a.target) : `file:${a.dumpPath}`),
+  detect_leak: (a) => addressOf(a.target),
+  heap_delta: (a) => (a.target ? addressOf(a.target) : undefined),
+  capture_route_costs: (a) => addressOf(a.target),
+  capture_trace: (a) => (a.target ? addressOf(a.target) : `app:${a.appPath}`),
+  profile_docker_container: (a) => `docker:${a.container}`,
+  profile_k8s_pod: (a) => `k8s:${a.namespace ?? "default"}/${a.pod}`,
+  profile_process_perf: (a) => `pid:${a.pid}`,
+  profile_process_offcpu: (a) => `pid:${a.pid}`,
+  trace_function: (a) => `pid:${a.pid}`,
+  probe_function_latency: (a) => `pid:${a.pid}`,
+  run_sample_app: () => "app:sample-app",
+  run_demo: () => "app:sample-app",
+  build_and_profile: (a) => `app:${a.packagePath}`,
+  profile_go_test: (a) => `test:${a.packagePath}`,
+  analyze_test_flakiness: (a) => `test:${a.packagePath}`,
+};
+
+const MINUTE_MS = 60_000;
+
+const running = new Map<string, number>();
+let total = 0;
+// Start times of each target's captures in the last minute
+const starts = new Map<string, number[]>();
+
+interface Waiter {
+  target: string;
+  start: () => void;
+}
+
+// Calls waiting for a slot, first come first served
+const queue: Waiter[] = [];
+
+function recentStarts(target: string, now: number): number[] {
+  const recent = (starts.get(target) ?? []).filter((at) => now - at < MINUTE_MS);
+  starts.set(target, recent);
+  return recent;
+}
+
+function blockedBy(target: string, now: number): CaptureLimitKind | undefined {
+  const { maxConcurrentCaptures, maxCapturesPerTarget, maxCapturesPerMinute } = serverConfig().limits;
+  if ((running.get(target) ?? 0) >= maxCapturesPerTarget) return "per_target";
+  if (total >= maxConcurrentCaptures) return "global";
+  if (maxCapturesPerMinute > 0 && recentStarts(target, now).length >= maxCapturesPerMinute) return "per_minute";
+  return undefined;
+}
+
+// Start every waiting call that a slot is free for, in the order they came
+function pump(): void {
+  const now = Date.now();
+  for (const waiter of [...queue]) {
+    if (!blockedBy(waiter.target, now)) {
+      queue.splice(queue.indexOf(waiter), 1);
+      running.set(waiter.target, (running.get(waiter.target) ?? 0) + 1);
+      total++;
+      recentStarts(waiter.target, now).push(now);
+      waiter.start();
+    }
+  }
+}
+
+function describe(target: string, limit: CaptureLimitKind): { max: number; reason: string; retryAfterSeconds?: number } {
+  const limits = serverConfig().limits;
+  const count = running.get(target) ?? 0;
+  switch (limit) {
+    case "per_target":
+      return {
+        max: limits.maxCapturesPerTarget,
+        reason: `${count} capture${count === 1 ? "" : "s"} of ${target} running (limits.maxCapturesPerTarget is ${limits.maxCapturesPerTarget})`,
+      };
+    case "global":
+      return {
+        max: limits.maxConcurrentCaptures,
+        reason: `${total} captures running (limits.maxConcurrentCaptures is ${limits.maxConcurrentCaptures})`,
+      };
+    case "per_minute": {
+      const now = Date.now();
+      const recent = recentStarts(target, now);
+      const retryAfterSeconds = Math.max(1, Math.ceil((recent[0] + MINUTE_MS - now) / 1000));
+      return {
+        max: limits.maxCapturesPerMinute,
+        reason: `${recent.length} captures of ${target} started in the last minute (limits.maxCapturesPerMinute is ${limits.maxCapturesPerMinute})`,
+        retryAfterSeconds,
+      };
+    }
+  }
+}
+
+// Wait for a slot to capture from target, and return the function that
+// frees it. Fails with a CaptureLimitError after limits.captureQueueSeconds,
+// or at once when that is 0.
+export function acquireCaptureSlot(target: string, progress: ProgressReporter = noProgress, signal?: AbortSignal): Promise<() => void> {
+  const queuedAt = Date.now();
+  return new Promise((resolve, reject) => {
+    let timer: NodeJS.Timeout | undefined;
+    const finish = () => {
+      clearInterval(timer);
+      signal?.removeEventListener("abort", abort);
+      const index = queue.indexOf(waiter);
+      if (index >= 0) queue.splice(index, 1);
+    };
+    let released = false;
+    const release = () => {
+      if (released) return;
+      released = true;
+      const count = (running.get(target) ?? 1) - 1;
+      if (count > 0) running.set(target, count);
+      else running.delete(target);
+      total--;
+      pump();
+    };
+    const waiter: Waiter = {
+      target,
+      start: () => {
+        finish();
+        resolve(release);
+      },
+    };
+    const fail = (queued: boolean) => {
+      const limit = blockedBy(target, Date.now()) ?? "global";
+      const { max, reason, retryAfterSeconds } = describe(target, limit);
+      const waitedSeconds = Math.round((Date.now() - queuedAt) / 1000);
+      finish();
+      reject(new CaptureLimitError(
+        { error: "capture_limit", limit, target, running: { target: running.get(target) ?? 0, total }, max, waitedSeconds, retryAfterSeconds },
+        `Capture limit reached: ${reason}; ${queued ? `gave up after waiting ${waitedSeconds}s` : "not queued, as limits.captureQueueSeconds is 0"}`
+          + `${retryAfterSeconds ? `. Try again in ${retryAfterSeconds}s` : ". Try again when the running captures finish"}`,
+      ));
+    };
+    const abort = () => {
+      finish();
+      reject(signal?.reason);
+    };
+    if (signal?.aborted) {
+      abort();
+      return;
+    }
+
+    queue.push(waiter);
+    pump();
+    if (!queue.includes(waiter)) {
+      return;
+    }
+    const { captureQueueSeconds } = serverConfig().limits;
+    if (captureQueueSeconds === 0) {
+      fail(false);
+      return;
+    }
+    signal?.addEventListener("abort", abort, { once: true });
+    const tick = () => {
+      // The per-minute limit lets captures start as time passes, without any finishing
+      pump();
+      if (!queue.includes(waiter)) return;
+      const waited = Math.floor((Date.now() - queuedAt) / 1000);
+      if (waited >= captureQueueSeconds) {
+        fail(true);
+        return;
+      }
+      const ahead = queue.indexOf(waiter);
+      const { reason } = describe(target, blockedBy(target, Date.now()) ?? "global");
+      progress(waited, undefined, `waiting for a capture slot: ${reason}${ahead > 0 ? `, ${ahead} ahead in line` : ""}, ${waited}s`);
+    };
+    tick();
+    timer = setInterval(tick, 1000);
+  });
+}
+
+// Run a capture in a slot of its target, freeing the slot when it is done
+export async function withCaptureSlot<T>(target: string, capture: () => Promise<T>, progress?: ProgressReporter, signal?: AbortSignal): Promise<T> {
+  const release = await acquireCaptureSlot(target, progress, signal);
+  try {
+    return await capture();
+  } finally {
+    release();
+  }
+}
+
+// Captures running now, per target
+export function runningCaptures(): Record<string, number> {
+  return Object.fromEntries(running);
+}
+
+type ToolHandler = (args: Args, extra: ToolExtra) => CallToolResult | Promise<CallToolResult>;
+
+// A tool's handler that, for the tools that capture, first waits for a
+// slot and answers with the CaptureLimit when it gets none
+export function withCaptureLimits(tool: string, handler: ToolHandler): ToolHandler {
+  const targetOf = CAPTURE_TARGETS[tool];
+  if (!targetOf) {
+    return handler;
+  }
+  return async (args, extra) => {
+    const target = targetOf(args);
+    if (target === undefined) {
+      return handler(args, extra);
+    }
+    let release: () => void;
+    try {
+      release = await acquireCaptureSlot(target, progressReporter(extra), extra.signal);
+    } catch (error) {
+      if (!(error instanceof CaptureLimitError)) {
+        throw error;
+      }
+      return {
+        content: [{ type: "text", text: `Error: ${error.message}` }],
+        structuredContent: error.limit as unknown as Record<string, unknown>,
+        isError: true,
+      };
+    }
+    try {
+      nextProgressStep(extra);
+      return await handler(args, extra);
+    } finally {
+      release();
+    }
+  };
+}
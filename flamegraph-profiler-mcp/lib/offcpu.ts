@@ -0,0 +1,187 @@
+/**
+ * Off-CPU profiles of a running process on Linux: where time goes while
+ * nothing runs, which CPU profiles cannot see. Blocked stacks are weighted by
+ * how long they stayed blocked, measured with eBPF through bpftrace (root or
+ * CAP_BPF and CAP_PERFMON), in one of two modes:
+ *
+ * - goroutine: Go parks goroutines in its own scheduler, so a goroutine
+ *   waiting on a channel, mutex, WaitGroup or the network leaves its thread
+ *   free to run others and the kernel never sees it wait. A uprobe on
+ *   runtime.gopark records the parking goroutine's stack, and one on
+ *   runtime.casgstatus its move from waiting back to runnable, so each wait
+ *   is charged to the code that waited. amd64 Go binaries only.
+ * - thread: the scheduler tracepoint stamps every thread of the process as it
+ *   switches out, and the switch back in charges the time to the thread's
+ *   kernel and user stacks, for blocking syscalls, page faults and futexes of
+ *   programs in any language.
+ *
+ * Waits still going when the capture ends are not counted, and waits of the
+ * Go runtime's own idle workers and threads are dropped unless asked for.
+ */
+import fs from "node:fs/promises";
+import { FRAME_LINE, perfLocations } from "./perf.js";
+import type { Profile, Sample } from "./pprof.js";
+import { runBpftrace } from "./uprobes.js";
+
+export const OFFCPU_MODES = ["goroutine", "thread"] as const;
+export type OffCpuMode = (typeof OFFCPU_MODES)[number];
+
+// Goroutine statuses of runtime/runtime2.go
+const G_RUNNABLE = 1;
+const G_WAITING = 4;
+
+// Frames of waits that are the Go runtime idling rather than the program
+// blocking: background GC and finalizer goroutines, and scheduler threads
+// with nothing to run
+const IDLE_FRAME = /^runtime\.(gcBgMarkWorker|bgsweep|bgscavenge|forcegchelper|runfinq|findRunnable|stopm|sysmon|templateThread)$/;
+
+// Frames every goroutine wait starts in, left out so the wait's own leaf is
+// how it waited, e.g. sync.(*Mutex).lockSlow or runtime.chanrecv
+const PARK_FRAME = /^runtime\.(gopark|goparkunlock)$/;
+
+export interface OffCpuCapture {
+  profile: Profile;
+  mode: OffCpuMode;
+  // Blocked time of the Go runtime's idle waits, dropped from the profile
+  idleNs: number;
+}
+
+// Stacks are stored at park time and charged at wake-up, keyed by the g
+// pointer, which is in R14 while a goroutine runs and the first argument
+// register (AX) of casgstatus
+function goroutineScript(binary: string, seconds: number, minNs: number): string {
+  const at = (fn: string) => `uprobe:${binary}:"${fn}"`;
+  return `${at("runtime.gopark")} {
+  @parked[reg("r14")] = nsecs;
+  @stack[reg("r14")] = ustack(perf, 127);
+}
+${at("runtime.casgstatus")} /reg("bx") == ${G_WAITING} && reg("cx") == ${G_RUNNABLE} && @parked[reg("ax")]/ {
+  $ns = nsecs - @parked[reg("ax")];
+  if ($ns >= ${minNs}) {
+    @offcpu[@stack[reg("ax")]] = sum($ns);
+    @waits[@stack[reg("ax")]] = count();
+  }
+  delete(@parked[reg("ax")]);
+  delete(@stack[reg("ax")]);
+}
+interval:s:${seconds} { exit(); }
+END { clear(@parked); clear(@stack); }
+`;
+}
+
+// finish_task_switch runs as the next thread, so its stacks there are the
+// ones it blocked in; the kernel may have renamed it, e.g. finish_task_switch.isra.0
+function threadScript(pid: number, seconds: number, minNs: number): string {
+  return `tracepoint:sched:sched_switch /pid == ${pid}/ {
+  @start[tid] = nsecs;
+}
+kprobe:finish_task_switch* /@start[tid]/ {
+  $ns = nsecs - @start[tid];
+  delete(@start[tid]);
+  if ($ns >= ${minNs}) {
+    @offcpu[kstack(perf), ustack(perf, 127)] = sum($ns);
+    @waits[kstack(perf), ustack(perf, 127)] = count();
+  }
+}
+interval:s:${seconds} { exit(); }
+END { clear(@start); }
+`;
+}
+
+// Profile of the blocked stacks in bpftrace's maps, whose keys are
+// perf-mode stacks (kernel before user in thread mode, so leaf first)
+function offCpuProfile(
+  offcpu: Record<string, number>,
+  waits: Record<string, number>,
+  includeIdle: boolean,
+): { profile: Profile; idleNs: number } {
+  const { mappings, locations, locationOf } = perfLocations();
+  const stacks = new Map<string, Sample>();
+  let idleNs = 0;
+  for (const [key, ns] of Object.entries(offcpu)) {
+    // bpftrace writes offsets in decimal, perf in hex
+    const frames = key.split("\n")
+      .map((line) => line.match(FRAME_LINE))
+      .filter((m): m is RegExpMatchArray => m !== null)
+      .map((m) => ({ address: BigInt(`0x${m[1]}`), symbol: m[2].replace(/\+(0x[0-9a-f]+|\d+)$/, ""), dso: m[3] }));
+    while (frames.length > 1 && PARK_FRAME.test(frames[0].symbol)) {
+      frames.shift();
+    }
+    if (frames.length === 0) {
+      continue;
+    }
+    const symbols = frames.map((f) => f.symbol);
+    if (!includeIdle && symbols.some((s) => IDLE_FRAME.test(s))) {
+      idleNs += ns;
+      continue;
+    }
+    const ids = frames.map((f) => locationOf(f.address, f.symbol, f.dso));
+    const id = ids.join(",");
+    const sample = stacks.get(id);
+    if (sample) {
+      sample.values[0] += ns;
+      sample.values[1] += waits[key] ?? 0;
+    } else {
+      stacks.set(id, { values: [ns, waits[key] ?? 0], locationIds: ids, labels: {} });
+    }
+  }
+  return {
+    profile: {
+      sampleTypes: [{ type: "offcpu", unit: "nanoseconds" }, { type: "waits", unit: "count" }],
+      samples: [...stacks.values()],
+      locations,
+      mappings: [...mappings.values()],
+      periodType: { type: "offcpu", unit: "nanoseconds" },
+      period: 1,
+      defaultSampleType: "offcpu",
+    },
+    idleNs,
+  };
+}
+
+// Measure a running process's off-CPU time for a number of seconds. Waits
+// shorter than minMicros are left out, which keeps the probes cheap on busy
+// processes. Cancelling interrupts bpftrace, which removes its probes.
+export async function captureOffCpuProfile(options: {
+  pid: number;
+  seconds: number;
+  mode: OffCpuMode;
+  minMicros: number;
+  includeIdle?: boolean;
+  signal?: AbortSignal;
+}): Promise<OffCpuCapture> {
+  if (process.platform !== "linux") {
+    throw new Error("Off-CPU profiles need Linux");
+  }
+  if (options.mode === "goroutine" && process.arch !== "x64") {
+    throw new Error(`Goroutine off-CPU profiles support amd64 Go binaries only, not ${process.arch}; use mode 'thread'`);
+  }
+  let binary: string;
+  try {
+    binary = await fs.realpath(`/proc/${options.pid}/exe`);
+  } catch {
+    throw new Error(`No process ${options.pid}, or its executable is not readable (run as the same user or root)`);
+  }
+  const minNs = Math.round(options.minMicros * 1000);
+  const script = options.mode === "goroutine"
+    ? goroutineScript(binary, options.seconds, minNs)
+    : threadScript(options.pid, options.seconds, minNs);
+
+  const started = Date.now();
+  const maps = await runBpftrace(options.pid, script, options.seconds, options.signal);
+  const { profile, idleNs } = offCpuProfile(
+    (maps.get("@offcpu") ?? {}) as Record<string, number>,
+    (maps.get("@waits") ?? {}) as Record<string, number>,
+    options.includeIdle ?? false,
+  );
+  return {
+    profile: {
+      ...profile,
+      durationSeconds: Math.min(options.seconds, (Date.now() - started) / 1000),
+      timeNanos: started * 1e6,
+      comments: [`off-CPU (${options.mode}) of pid ${options.pid}, waits of at least ${options.minMicros}µs`],
+    },
+    mode: options.mode,
+    idleNs,
+  };
+}
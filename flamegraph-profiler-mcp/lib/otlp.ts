@@ -0,0 +1,257 @@
+/**
+ * Export of profiles as the OpenTelemetry profiles signal (OTLP profiles), so
+ * captures feed the same collectors and backends as a team's traces and
+ * metrics. The signal is still in development; this follows the v1development
+ * protocol of opentelemetry-proto 1.7, sent as OTLP/HTTP JSON, with the
+ * lookup tables shared through the request's dictionary and the first entry of
+ * each table its zero value.
+ *
+ * Configured with PROFILER_OTLP_ENDPOINT, the collector's base URL (e.g.
+ * http://collector:4318) or the full profiles URL, and PROFILER_OTLP_HEADERS
+ * (key=value pairs, comma-separated) for authentication. The standard
+ * OTEL_EXPORTER_OTLP_PROFILES_ENDPOINT, OTEL_EXPORTER_OTLP_ENDPOINT and
+ * OTEL_EXPORTER_OTLP_HEADERS are read when those are not set, and
+ * PROFILER_OTLP_RESOURCE_ATTRIBUTES or OTEL_RESOURCE_ATTRIBUTES add resource
+ * attributes to every export.
+ */
+import { randomBytes } from "node:crypto";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { readProfile, type Profile } from "./pprof.js";
+
+// Path of the profiles signal below a collector's base URL
+const PROFILES_PATH = "/v1development/profiles";
+
+export interface OtlpConfig {
+  url: string;
+  headers: Record<string, string>;
+  // Resource attributes added to every export, e.g. deployment.environment.name=prod
+  attributes: Record<string, string>;
+}
+
+export interface OtlpExport {
+  url: string;
+  // Resource attributes the profile was exported with
+  attributes: Record<string, string>;
+  samples: number;
+  bytes: number;
+}
+
+// OTLP JSON encodings of the protobuf messages sent
+type AnyValue = { stringValue: string } | { intValue: string };
+interface KeyValue {
+  key: string;
+  value: AnyValue | Record<string, never>;
+}
+
+export interface OtlpRequest {
+  resourceProfiles: Array<{
+    resource: { attributes: KeyValue[] };
+    scopeProfiles: Array<{ scope: { name: string }; profiles: unknown[] }>;
+  }>;
+  dictionary: {
+    mappingTable: unknown[];
+    locationTable: unknown[];
+    functionTable: unknown[];
+    linkTable: unknown[];
+    stringTable: string[];
+    attributeTable: KeyValue[];
+  };
+}
+
+// key=value pairs, comma-separated, with values percent-decoded as in the
+// OTEL_* variables
+function parsePairs(value: string | undefined, variable: string): Record<string, string> {
+  return Object.fromEntries((value ?? "")
+    .split(",")
+    .map((pair) => pair.trim())
+    .filter(Boolean)
+    .map((pair) => {
+      const at = pair.indexOf("=");
+      if (at <= 0) {
+        throw new Error(`${variable}: expected key=value, got "${pair}"`);
+      }
+      return [pair.slice(0, at).trim(), decodeURIComponent(pair.slice(at + 1).trim())];
+    }));
+}
+
+// Read the OTLP endpoint settings from the environment
+export function otlpConfig(env: NodeJS.ProcessEnv = process.env): OtlpConfig {
+  const base = env.PROFILER_OTLP_ENDPOINT ?? env.OTEL_EXPORTER_OTLP_PROFILES_ENDPOINT ?? env.OTEL_EXPORTER_OTLP_ENDPOINT;
+  if (!base) {
+    throw new Error("No OTLP endpoint configured; set PROFILER_OTLP_ENDPOINT (or OTEL_EXPORTER_OTLP_ENDPOINT)");
+  }
+  // A signal-specific endpoint is used as is, like the OpenTelemetry SDKs do
+  const full = (!env.PROFILER_OTLP_ENDPOINT && env.OTEL_EXPORTER_OTLP_PROFILES_ENDPOINT !== undefined) || /\/profiles\/?$/.test(base);
+  const url = full ? base : `${base.replace(/\/$/, "")}${PROFILES_PATH}`;
+  const headerVariable = env.PROFILER_OTLP_HEADERS !== undefined ? "PROFILER_OTLP_HEADERS" : "OTEL_EXPORTER_OTLP_HEADERS";
+  const attributeVariable = env.PROFILER_OTLP_RESOURCE_ATTRIBUTES !== undefined ? "PROFILER_OTLP_RESOURCE_ATTRIBUTES" : "OTEL_RESOURCE_ATTRIBUTES";
+  return {
+    url,
+    headers: parsePairs(env[headerVariable], headerVariable),
+    attributes: parsePairs(env[attributeVariable], attributeVariable),
+  };
+}
+
+// Resource attributes describing a capture target in OpenTelemetry semantic
+// conventions: docker:<container> and k8s:<namespace>/<pod>[/<container>]
+// targets name their container and pod, and every target gets a service.name
+// (the container, pod, or program) and its profiler.target
+export function targetAttributes(target: string): Record<string, string> {
+  const attributes: Record<string, string> = {};
+  const docker = target.match(/^docker:(.+)$/);
+  const k8s = target.match(/^k8s:([^/]+)\/([^/]+)(?:\/(.+))?$/);
+  if (docker) {
+    attributes["service.name"] = docker[1];
+    attributes["container.name"] = docker[1];
+  } else if (k8s) {
+    attributes["service.name"] = k8s[3] ?? k8s[2];
+    attributes["k8s.namespace.name"] = k8s[1];
+    attributes["k8s.pod.name"] = k8s[2];
+    if (k8s[3]) attributes["k8s.container.name"] = k8s[3];
+  } else {
+    attributes["service.name"] = path.basename(target).replace(/\.pb(\.gz)?$|\.pprof$|\.prof$|\.go$/, "");
+  }
+  attributes["profiler.target"] = target;
+  return attributes;
+}
+
+// uint64 values are JSON strings in OTLP, and addresses are hex in the model
+const uint64 = (value: string | number) => BigInt(value).toString();
+
+// Convert a profile to an OTLP export request for one resource
+export function profileToOtlp(profile: Profile, attributes: Record<string, string>): OtlpRequest {
+  const stringTable = [""];
+  const strings = new Map([["", 0]]);
+  const str = (s: string) => {
+    let index = strings.get(s);
+    if (index === undefined) {
+      index = stringTable.push(s) - 1;
+      strings.set(s, index);
+    }
+    return index;
+  };
+  const attributeTable: KeyValue[] = [{ key: "", value: {} }];
+  const attributeIndices = new Map<string, number>();
+  const attribute = (key: string, value: AnyValue) => {
+    const id = `${key}\u0000${JSON.stringify(value)}`;
+    let index = attributeIndices.get(id);
+    if (index === undefined) {
+      index = attributeTable.push({ key, value }) - 1;
+      attributeIndices.set(id, index);
+    }
+    return index;
+  };
+
+  const mappingTable: unknown[] = [{}];
+  const mappingIndices = new Map<number, number>();
+  for (const mapping of profile.mappings) {
+    // Go build IDs are slash-separated action and content hashes; others are GNU notes
+    const buildIdKey = mapping.buildId.includes("/") ? "process.executable.build_id.go" : "process.executable.build_id.gnu";
+    mappingIndices.set(mapping.id, mappingTable.push({
+      memoryStart: uint64(mapping.start),
+      memoryLimit: uint64(mapping.limit),
+      fileOffset: uint64(mapping.offset),
+      filenameStrindex: str(mapping.file),
+      attributeIndices: mapping.buildId ? [attribute(buildIdKey, { stringValue: mapping.buildId })] : [],
+    }) - 1);
+  }
+
+  const functionTable: unknown[] = [{}];
+  const functionIndices = new Map<string, number>();
+  const functionOf = (name: string, symbol: string, file: string, startLine: number) => {
+    const id = [name, symbol, file, startLine].join("\u0000");
+    let index = functionIndices.get(id);
+    if (index === undefined) {
+      index = functionTable.push({
+        nameStrindex: str(name),
+        systemNameStrindex: str(symbol),
+        filenameStrindex: str(file),
+        startLine: String(startLine),
+      }) - 1;
+      functionIndices.set(id, index);
+    }
+    return index;
+  };
+
+  const locationTable: unknown[] = [{}];
+  const locationIndices = new Map<number, number>();
+  for (const [id, location] of profile.locations) {
+    locationIndices.set(id, locationTable.push({
+      mappingIndex: mappingIndices.get(location.mappingId) ?? 0,
+      address: uint64(location.address),
+      // Innermost first, each frame inlined into the next, as in pprof
+      line: location.frames.map((frame) => ({
+        functionIndex: functionOf(frame.name, frame.symbol ?? frame.name, frame.file, frame.startLine ?? 0),
+        line: String(frame.line),
+      })),
+    }) - 1);
+  }
+
+  // Stacks are runs of the profile's location indices, leaf first
+  const stacks: number[] = [];
+  const samples = profile.samples.map((sample) => {
+    const start = stacks.length;
+    stacks.push(...sample.locationIds.map((id) => locationIndices.get(id) ?? 0));
+    return {
+      locationsStartIndex: start,
+      locationsLength: sample.locationIds.length,
+      value: sample.values.map(String),
+      attributeIndices: [
+        ...Object.entries(sample.labels).map(([key, value]) => attribute(key, { stringValue: value })),
+        ...Object.entries(sample.numLabels ?? {}).map(([key, value]) => attribute(key, { intValue: String(Math.round(value)) })),
+      ],
+    };
+  });
+
+  const valueType = (type: { type: string; unit: string }) => ({ typeStrindex: str(type.type), unitStrindex: str(type.unit) });
+  const otlpProfile = {
+    sampleType: profile.sampleTypes.map(valueType),
+    sample: samples,
+    locationIndices: stacks,
+    timeNanos: String(profile.timeNanos ?? Date.now() * 1e6),
+    durationNanos: String(Math.round((profile.durationSeconds ?? 0) * 1e9)),
+    ...(profile.periodType ? { periodType: valueType(profile.periodType) } : {}),
+    period: String(profile.period),
+    commentStrindices: (profile.comments ?? []).map(str),
+    profileId: randomBytes(16).toString("base64"),
+  };
+
+  return {
+    resourceProfiles: [{
+      resource: { attributes: Object.entries(attributes).map(([key, value]) => ({ key, value: { stringValue: value } })) },
+      scopeProfiles: [{ scope: { name: "flamegraph-profiler-mcp" }, profiles: [otlpProfile] }],
+    }],
+    dictionary: { mappingTable, locationTable, functionTable, linkTable: [{}], stringTable, attributeTable },
+  };
+}
+
+// Export a pprof file to the OTLP endpoint, as the resource of a capture
+// target with the configured and given attributes. With outputPath, the
+// request is written there instead of being sent.
+export async function exportToOtlp(
+  file: string,
+  target: string,
+  attributes: Record<string, string> = {},
+  options: { config?: OtlpConfig; outputPath?: string } = {},
+): Promise<OtlpExport> {
+  const config = options.outputPath ? undefined : options.config ?? otlpConfig();
+  const profile = readProfile(file);
+  const resource = { ...targetAttributes(target), ...config?.attributes, ...attributes };
+  const body = JSON.stringify(profileToOtlp(profile, resource));
+  if (options.outputPath) {
+    const output = path.resolve(options.outputPath);
+    await fs.writeFile(output, body);
+    return { url: output, attributes: resource, samples: profile.samples.length, bytes: Buffer.byteLength(body) };
+  }
+
+  const response = await fetch(config!.url, {
+    method: "POST",
+    headers: { ...config!.headers, "Content-Type": "application/json" },
+    body,
+  });
+  if (!response.ok) {
+    throw new Error(`OTLP endpoint returned ${response.status}: ${(await response.text()).slice(0, 200)}`);
+  }
+  return { url: config!.url, attributes: resource, samples: profile.samples.length, bytes: Buffer.byteLength(body) };
+}
@@ -0,0 +1,248 @@
+/**
+ * Ownership mapping from CODEOWNERS or a custom mapping file, used to
+ * attribute hotspots and findings to owning teams.
+ */
+import fs from "node:fs/promises";
+import path from "node:path";
+import { isStdlib } from "./antipatterns.js";
+import { percentOf } from "./flamegraph.js";
+import { totalOf, type Frame, type Profile } from "./pprof.js";
+import { globToRegExp } from "./suppressions.js";
+
+export interface OwnershipRule {
+  source: string;
+  pattern: string;
+  // Rules match a source file path (relative to the root) or a function name
+  on: "file" | "function";
+  match: RegExp;
+  owners: string[];
+}
+
+export interface Ownership {
+  root: string;
+  rules: OwnershipRule[];
+}
+
+export interface OwnedHotspot {
+  function: string;
+  file: string;
+  owners: string[];
+  value: number;
+  percentage: number;
+}
+
+export interface OwnerTotal {
+  owner: string;
+  value: number;
+  percentage: number;
+}
+
+export interface OwnershipReport {
+  root: string;
+  unit: string;
+  total: number;
+  owners: OwnerTotal[];
+  hotspots: OwnedHotspot[];
+}
+
+// Custom mapping: [{ "function": "github.com/acme/payments/*", "owners": ["@acme/team-payments"] }]
+export const OWNERS_MAPPING_FILE = ".profiler-owners.json";
+
+const CODEOWNERS_LOCATIONS = [".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"];
+
+const UNOWNED = "(unowned)";
+
+async function exists(file: string): Promise<boolean> {
+  return fs.access(file).then(() => true, () => false);
+}
+
+// Walk up from a file or directory to the repository root: the nearest
+// directory with a CODEOWNERS file, a mapping file, or a .git entry.
+export async function findRepoRoot(start: string): Promise<string> {
+  const resolved = path.resolve(start);
+  const first = (await fs.stat(resolved).catch(() => undefined))?.isDirectory() ? resolved : path.dirname(resolved);
+  for (let dir = first; ; dir = path.dirname(dir)) {
+    const markers = [...CODEOWNERS_LOCATIONS, OWNERS_MAPPING_FILE, ".git"];
+    for (const marker of markers) {
+      if (await exists(path.join(dir, marker))) {
+        return dir;
+      }
+    }
+    if (path.dirname(dir) === dir) {
+      return first;
+    }
+  }
+}
+
+// Convert a CODEOWNERS (gitignore-style) pattern to a regexp over relative paths
+function codeownersRegExp(pattern: string): RegExp {
+  // A slash anywhere but the end anchors the pattern to the root
+  const anchored = pattern.replace(/\/$/, "").includes("/");
+  let glob = pattern.replace(/^\//, "");
+  if (glob.endsWith("/")) {
+    glob += "**";
+  }
+  const body = glob
+    .replace(/[.+^${}()|[\]\\]/g, "\\$&")
+    .replace(/\*\*/g, "\u0000")
+    .replace(/\*/g, "[^/]*")
+    .replace(/\?/g, "[^/]")
+    .replace(/\u0000/g, ".*");
+  // A pattern naming a directory also owns everything below it
+  return new RegExp(`${anchored ? "^" : "^(?:.*/)?"}${body}(?:/.*)?$`);
+}
+
+export function parseCodeowners(text: string, source = "CODEOWNERS"): OwnershipRule[] {
+  const rules: OwnershipRule[] = [];
+  for (const raw of text.split("\n")) {
+    const line = raw.replace(/(^|\s)#.*$/, "").trim();
+    if (!line) {
+      continue;
+    }
+    const [pattern, ...owners] = line.split(/\s+/);
+    rules.push({ source, pattern, on: "file", match: codeownersRegExp(pattern), owners });
+  }
+  return rules;
+}
+
+export function parseOwnersMapping(text: string, source = OWNERS_MAPPING_FILE): OwnershipRule[] {
+  const entries = JSON.parse(text) as Array<{ function?: string; file?: string; owners: string[] }>;
+  if (!Array.isArray(entries)) {
+    throw new Error(`${source} must contain an array of { function | file, owners } entries`);
+  }
+  return entries.map((entry) => {
+    if (entry.function) {
+      return { source, pattern: entry.function, on: "function" as const, match: globToRegExp(entry.function), owners: entry.owners };
+    }
+    if (entry.file) {
+      return { source, pattern: entry.file, on: "file" as const, match: codeownersRegExp(entry.file), owners: entry.owners };
+    }
+    throw new Error(`${source}: each entry needs a "function" or "file" pattern`);
+  });
+}
+
+// Load ownership rules for the repository containing a path. The custom mapping
+// is applied after CODEOWNERS, so its rules win where both match.
+export async function loadOwnership(start: string): Promise<Ownership> {
+  const root = await findRepoRoot(start);
+  const rules: OwnershipRule[] = [];
+  for (const location of CODEOWNERS_LOCATIONS) {
+    const file = path.join(root, location);
+    if (await exists(file)) {
+      rules.push(...parseCodeowners(await fs.readFile(file, "utf-8"), location));
+      // GitHub uses the first CODEOWNERS file it finds
+      break;
+    }
+  }
+  const mapping = path.join(root, OWNERS_MAPPING_FILE);
+  if (await exists(mapping)) {
+    rules.push(...parseOwnersMapping(await fs.readFile(mapping, "utf-8")));
+  }
+  return { root, rules };
+}
+
+// Ownership for the code in a profile, found from an explicit repo path or
+// from the source path of the profile's first non-standard-library function
+export async function ownershipForProfile(profile: Profile, repoPath?: string): Promise<Ownership | undefined> {
+  if (repoPath) {
+    return loadOwnership(repoPath);
+  }
+  for (const location of profile.locations.values()) {
+    const frame = location.frames.find((f) => f.file && !isStdlib(f.name));
+    if (frame && (await exists(frame.file))) {
+      return loadOwnership(frame.file);
+    }
+  }
+  return undefined;
+}
+
+// Owners of a function, last matching rule wins as in CODEOWNERS
+export function ownersOf(ownership: Ownership, name: string, file?: string): string[] {
+  const relative = file && path.isAbsolute(file) ? path.relative(ownership.root, file) : file;
+  const inRepo = relative !== undefined && relative !== "" && !relative.startsWith("..");
+  let owners: string[] = [];
+  for (const rule of ownership.rules) {
+    const subject = rule.on === "function" ? name : inRepo ? relative : undefined;
+    if (subject !== undefined && rule.match.test(subject)) {
+      owners = rule.owners;
+    }
+  }
+  return owners;
+}
+
+// Match an owner query against an owner handle: "team-payments" matches "@acme/team-payments"
+export function ownerMatches(owner: string, query: string): boolean {
+  const normalize = (s: string) => s.replace(/^@/, "").toLowerCase();
+  const handle = normalize(owner);
+  const wanted = normalize(query);
+  return handle === wanted || handle.endsWith(`/${wanted}`);
+}
+
+// Attribute each sample to the innermost frame with an owner, so runtime and
+// library costs count against the team whose code called them.
+export function hotspotsByOwner(
+  profile: Profile,
+  sampleIndex: number,
+  ownership: Ownership,
+  owner?: string,
+  limit = 5,
+): OwnershipReport {
+  const cache = new Map<string, string[]>();
+  const ownersOfFrame = (frame: Frame) => {
+    const key = `${frame.name}\n${frame.file}`;
+    let owners = cache.get(key);
+    if (!owners) {
+      owners = ownersOf(ownership, frame.name, frame.file);
+      cache.set(key, owners);
+    }
+    return owners;
+  };
+
+  const hotspots = new Map<string, OwnedHotspot>();
+  const totals = new Map<string, number>();
+  for (const sample of profile.samples) {
+    const value = sample.values[sampleIndex];
+    if (value === 0) {
+      continue;
+    }
+    const frames = sample.locationIds.flatMap((id) => profile.locations.get(id)?.frames ?? []);
+    const owned = frames.find((frame) => ownersOfFrame(frame).length > 0);
+    const frame = owned ?? frames[0];
+    if (!frame) {
+      continue;
+    }
+    const owners = owned ? ownersOfFrame(owned) : [];
+    for (const name of owners.length > 0 ? owners : [UNOWNED]) {
+      totals.set(name, (totals.get(name) ?? 0) + value);
+    }
+    let hotspot = hotspots.get(frame.name);
+    if (!hotspot) {
+      hotspot = { function: frame.name, file: frame.file, owners, value: 0, percentage: 0 };
+      hotspots.set(frame.name, hotspot);
+    }
+    hotspot.value += value;
+  }
+
+  const total = totalOf(profile, sampleIndex);
+  return {
+    root: ownership.root,
+    unit: profile.sampleTypes[sampleIndex].unit,
+    total,
+    owners: [...totals.entries()]
+      .map(([name, value]) => ({ owner: name, value, percentage: percentOf(value, total) }))
+      .sort((a, b) => b.value - a.value),
+    hotspots: [...hotspots.values()]
+      .filter((h) => !owner || h.owners.some((o) => ownerMatches(o, owner)))
+      .sort((a, b) => b.value - a.value)
+      .slice(0, limit)
+      .map((h) => ({ ...h, percentage: percentOf(h.value, total) })),
+  };
+}
+
+// Format per-owner totals for tool output
+export function formatOwnerTotals(report: OwnershipReport, limit = 5): string {
+  const lines = report.owners
+    .slice(0, limit)
+    .map((o, i) => `${i + 1}. ${o.owner}: ${o.percentage}%`);
+  return `👥 Cost by Owner:\n${lines.join("\n")}`;
+}
@@ -0,0 +1,288 @@
+/**
+ * Mixed-mode CPU profiles of a running process from Linux perf: each sample
+ * holds the kernel stack beneath the Go user stack that entered the kernel,
+ * as perf and flamegraph.pl show them, so time in syscalls, page faults and
+ * scheduler paths is attributed to the Go code that caused it. Go's pprof
+ * CPU profiles stop at the syscall.
+ *
+ * Kernel frames are named with a "_[k]" suffix, the convention of
+ * flamegraph.pl, so they stay recognizable in any tool the profile is
+ * passed to; the hideKernel filter drops them again. User stacks are walked
+ * by frame pointer, which Go keeps on amd64 and arm64.
+ */
+import { execFile } from "node:child_process";
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { promisify } from "node:util";
+import type { Location, Mapping, Profile, Sample } from "./pprof.js";
+
+const execFileAsync = promisify(execFile);
+
+// Suffix marking kernel frames
+export const KERNEL_SUFFIX = "_[k]";
+
+// Time allowed past the window for perf to start, and to write out the samples
+const PERF_SLACK_MS = 60_000;
+
+// Lowest kernel address on 64-bit Linux
+const KERNEL_ADDRESS = 0xffff800000000000n;
+
+export function isKernelFrame(name: string): boolean {
+  return name.endsWith(KERNEL_SUFFIX);
+}
+
+function isKernel(address: bigint, dso: string): boolean {
+  return address >= KERNEL_ADDRESS || dso === "[kernel.kallsyms]";
+}
+
+// Locations of perf frames, one per dso and address, with a mapping per dso
+export function perfLocations() {
+  const mappings = new Map<string, Mapping>();
+  const locations = new Map<number, Location>();
+  const locationIds = new Map<string, number>();
+
+  const locationOf = (address: bigint, symbol: string, dso: string): number => {
+    const key = `${dso}:${address}`;
+    let id = locationIds.get(key);
+    if (id === undefined) {
+      let mapping = mappings.get(dso);
+      if (!mapping) {
+        mapping = { id: mappings.size + 1, start: "0x0", limit: "0x0", offset: "0x0", file: dso, buildId: "" };
+        mappings.set(dso, mapping);
+      }
+      const hex = `0x${address.toString(16)}`;
+      // Unresolved frames keep their address, like unsymbolized pprof locations
+      const name = symbol !== "" && symbol !== "[unknown]" ? symbol : hex;
+      id = locations.size + 1;
+      locations.set(id, {
+        id,
+        address: hex,
+        mappingId: mapping.id,
+        frames: [{ name: isKernel(address, dso) ? `${name}${KERNEL_SUFFIX}` : name, file: "", line: 0 }],
+      });
+      locationIds.set(key, id);
+    }
+    return id;
+  };
+  return { mappings, locations, locationOf };
+}
+
+// A frame line of perf script, and of bpftrace's perf-mode stacks: "address symbol+offset (dso)"
+export const FRAME_LINE = /^\s+([0-9a-f]+)\s+(.*?)\s+\((.*)\)\s*$/;
+
+// Parse `perf script -F tid,period,ip,sym,dso` output into a profile with
+// samples and CPU time like a Go CPU profile. Each sample is a "tid period"
+// line followed by its frames, leaf first, one "address symbol (dso)" line each.
+export function parsePerfScript(text: string, frequency: number): Profile {
+  const { mappings, locations, locationOf } = perfLocations();
+  const stacks = new Map<string, Sample>();
+  const nanosPerSample = Math.round(1e9 / frequency);
+
+  let stack: number[] | undefined;
+  const flush = () => {
+    if (stack && stack.length > 0) {
+      const key = stack.join(",");
+      const sample = stacks.get(key);
+      if (sample) {
+        sample.values[0] += 1;
+        sample.values[1] += nanosPerSample;
+      } else {
+        stacks.set(key, { values: [1, nanosPerSample], locationIds: stack, labels: {} });
+      }
+    }
+    stack = undefined;
+  };
+
+  for (const line of text.split("\n")) {
+    const frame = line.match(FRAME_LINE);
+    if (frame && stack) {
+      stack.push(locationOf(BigInt(`0x${frame[1]}`), frame[2].replace(/\+0x[0-9a-f]+$/, ""), frame[3]));
+      continue;
+    }
+    // At a fixed frequency every sample stands for one tick, whatever its period
+    if (/^\s*\d+(?:\/\d+)?\s+\d+\s*$/.test(line)) {
+      flush();
+      stack = [];
+    } else if (line.trim() === "") {
+      flush();
+    }
+  }
+  flush();
+
+  return {
+    sampleTypes: [{ type: "samples", unit: "count" }, { type: "cpu", unit: "nanoseconds" }],
+    samples: [...stacks.values()],
+    locations,
+    mappings: [...mappings.values()],
+    periodType: { type: "cpu", unit: "nanoseconds" },
+    period: nanosPerSample,
+    defaultSampleType: "cpu",
+  };
+}
+
+// Sample type of a perf event: cpu-clock and task-clock periods are
+// nanoseconds of CPU time, other events count occurrences, e.g. cycles
+function perfEventType(event: string): { type: string; unit: string } {
+  return /^(cpu|task)-clock$/.test(event) ? { type: "cpu", unit: "nanoseconds" } : { type: event, unit: "count" };
+}
+
+// Parse `perf script` output in its default format, as recorded on any
+// system with `perf record -g`, into a profile: samples, plus the periods of
+// each recorded event, with the command that ran as a comm label. A sample is
+// a "comm pid/tid [cpu] time: period event:" line followed by its frames,
+// leaf first; without -g the line ends with the sampled frame instead.
+export function perfScriptToProfile(text: string): Profile {
+  const { mappings, locations, locationOf } = perfLocations();
+  const events: string[] = [];
+  const stacks = new Map<string, Sample & { event: number }>();
+
+  let current: { comm: string; event: number; period: number; stack: number[] } | undefined;
+  const flush = () => {
+    if (current && current.stack.length > 0) {
+      const key = `${current.comm}\u0000${current.event}\u0000${current.stack.join(",")}`;
+      const sample = stacks.get(key);
+      if (sample) {
+        sample.values[0] += 1;
+        sample.values[1] += current.period;
+      } else {
+        stacks.set(key, { values: [1, current.period], locationIds: current.stack, labels: { comm: current.comm }, event: current.event });
+      }
+    }
+    current = undefined;
+  };
+
+  for (const line of text.split("\n")) {
+    const frame = line.match(FRAME_LINE);
+    if (frame && current) {
+      current.stack.push(locationOf(BigInt(`0x${frame[1]}`), frame[2].replace(/\+0x[0-9a-f]+$/, ""), frame[3]));
+      continue;
+    }
+    if (line.trim() === "" || line.startsWith("#")) {
+      flush();
+      continue;
+    }
+    if (/^\s/.test(line)) {
+      continue;
+    }
+    flush();
+    // The sampled frame of a sample without a call graph follows the event
+    const inline = line.match(/^(.*\S:)\s+([0-9a-f]+)\s+(.*?)\s+\((.*)\)\s*$/);
+    const header = (inline ? inline[1] : line).trim();
+    const tokens = header.split(/\s+/);
+    const pid = tokens.findIndex((token, i) => i > 0 && /^-?\d+(?:\/\d+)?$/.test(token));
+    const eventToken = tokens[tokens.length - 1];
+    if (pid < 0 || !eventToken.endsWith(":")) {
+      continue;
+    }
+    // Events carry their modifiers, e.g. cycles:ppp: or cpu-clock:u:
+    const event = eventToken.slice(0, -1).replace(/:[ukhHGpPSDIW]+$/, "");
+    const periodToken = tokens[tokens.length - 2];
+    const period = tokens.length - 2 > pid && /^\d+$/.test(periodToken) ? Number(periodToken) : 1;
+    let index = events.indexOf(event);
+    if (index < 0) {
+      index = events.push(event) - 1;
+    }
+    current = { comm: tokens.slice(0, pid).join(" "), event: index, period, stack: [] };
+    if (inline) {
+      current.stack.push(locationOf(BigInt(`0x${inline[2]}`), inline[3].replace(/\+0x[0-9a-f]+$/, ""), inline[4]));
+    }
+  }
+  flush();
+
+  if (stacks.size === 0) {
+    throw new Error("No samples found; expected `perf script` output with \"comm pid time: period event:\" lines followed by frames");
+  }
+  const sampleTypes = [{ type: "samples", unit: "count" }, ...events.map(perfEventType)];
+  // Every sample holds a value for each event, 0 for all but its own
+  const samples = [...stacks.values()].map(({ event, values, ...sample }) => {
+    const all = new Array(sampleTypes.length).fill(0);
+    all[0] = values[0];
+    all[1 + event] = values[1];
+    return { ...sample, values: all };
+  });
+  const cpu = sampleTypes.find((t) => t.type === "cpu");
+  return {
+    sampleTypes,
+    samples,
+    locations,
+    mappings: [...mappings.values()],
+    ...(cpu ? { periodType: cpu } : {}),
+    period: 1,
+    defaultSampleType: cpu ? "cpu" : sampleTypes[1].type,
+  };
+}
+
+function perfError(error: unknown): Error {
+  const err = error as NodeJS.ErrnoException & { stderr?: string };
+  if (err.code === "ENOENT") {
+    return new Error("perf not found on PATH; install linux-tools (Debian/Ubuntu) or perf (Fedora/RHEL)");
+  }
+  const message = (err.stderr ?? "").trim().split("\n").filter((l) => l.trim() !== "").slice(-3).join("; ");
+  return new Error(/paranoid|permission|not permitted|EACCES|EPERM/i.test(message)
+    ? `perf needs root, CAP_PERFMON, or kernel.perf_event_paranoid <= 1 (and kernel.kptr_restrict = 0 for kernel symbol names): ${message}`
+    : message || err.message);
+}
+
+// Sample a running process's user and kernel stacks with perf for a number
+// of seconds, at a frequency in Hz. Cancelling interrupts perf, which detaches
+// from the process.
+export async function capturePerfProfile(options: { pid: number; seconds: number; frequency: number; signal?: AbortSignal }): Promise<Profile> {
+  if (process.platform !== "linux") {
+    throw new Error("perf profiles need Linux");
+  }
+  try {
+    await fs.access(`/proc/${options.pid}`);
+  } catch {
+    throw new Error(`No process ${options.pid}`);
+  }
+  const dir = await fs.mkdtemp(path.join(os.tmpdir(), "perf-"));
+  const data = path.join(dir, "perf.data");
+  try {
+    const started = Date.now();
+    try {
+      await execFileAsync("perf", [
+        "record", "-F", String(options.frequency), "--call-graph", "fp", "-p", String(options.pid), "-o", data,
+        "--", "sleep", String(options.seconds),
+      ], { timeout: options.seconds * 1000 + PERF_SLACK_MS, maxBuffer: 16 * 1024 * 1024, signal: options.signal, killSignal: "SIGINT" });
+    } catch (error) {
+      options.signal?.throwIfAborted();
+      throw perfError(error);
+    }
+    let stdout: string;
+    try {
+      ({ stdout } = await execFileAsync("perf", ["script", "-i", data, "--no-inline", "-F", "tid,period,ip,sym,dso"], {
+        timeout: PERF_SLACK_MS,
+        maxBuffer: 512 * 1024 * 1024,
+        signal: options.signal,
+      }));
+    } catch (error) {
+      options.signal?.throwIfAborted();
+      throw perfError(error);
+    }
+    const profile = parsePerfScript(stdout, options.frequency);
+    return {
+      ...profile,
+      durationSeconds: Math.min(options.seconds, (Date.now() - started) / 1000),
+      timeNanos: started * 1e6,
+      comments: [`perf record -F ${options.frequency} --call-graph fp -p ${options.pid}`],
+    };
+  } finally {
+    await fs.rm(dir, { recursive: true, force: true });
+  }
+}
+
+// Share of samples that were in the kernel, by their leaf frame
+export function kernelShare(profile: Profile, sampleIndex: number): number {
+  let total = 0;
+  let kernel = 0;
+  for (const sample of profile.samples) {
+    const value = sample.values[sampleIndex];
+    total += value;
+    const leaf = profile.locations.get(sample.locationIds[0])?.frames[0]?.name ?? "";
+    if (isKernelFrame(leaf)) {
+      kernel += value;
+    }
+  }
+  return total > 0 ? Math.round((kernel / total) * 1000) / 10 : 0;
+}
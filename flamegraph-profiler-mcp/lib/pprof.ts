@@ -0,0 +1,171 @@
+/**
+ * Reads pprof profiles into a structured form that the analysis tools share.
+ */
+import { readFileSync, statSync, writeFileSync } from "node:fs";
+import { nameClosures } from "./closures.js";
+import { checkProfileSize } from "./config.js";
+import { decodeProfile, encodeProfile } from "./profileproto.js";
+
+export interface SampleType {
+  type: string;
+  unit: string;
+}
+
+export interface Frame {
+  name: string;
+  file: string;
+  line: number;
+  // Line the function starts on, when the profile records it
+  startLine?: number;
+  // Name in the binary, when name was changed for display (see closures.ts)
+  symbol?: string;
+}
+
+export interface Location {
+  id: number;
+  address: string;
+  mappingId: number;
+  // Innermost (inlined) frame first
+  frames: Frame[];
+}
+
+export interface Mapping {
+  id: number;
+  start: string;
+  limit: string;
+  offset: string;
+  file: string;
+  buildId: string;
+}
+
+export interface Sample {
+  values: number[];
+  // Leaf location first
+  locationIds: number[];
+  labels: Record<string, string>;
+  // Numeric labels, e.g. "bytes" on heap samples
+  numLabels?: Record<string, number>;
+}
+
+export interface Profile {
+  sampleTypes: SampleType[];
+  samples: Sample[];
+  locations: Map<number, Location>;
+  mappings: Mapping[];
+  periodType?: SampleType;
+  period: number;
+  durationSeconds?: number;
+  // Collection start time, nanoseconds since the epoch
+  timeNanos?: number;
+  defaultSampleType?: string;
+  comments?: string[];
+}
+
+// Read a pprof file (gzipped or plain profile.proto), with closures named
+// after the function and line they are defined at
+export function readProfile(profilePath: string): Profile {
+  checkProfileSize(statSync(profilePath).size, profilePath);
+  return nameClosures(decodeProfile(readFileSync(profilePath)));
+}
+
+// Write a profile as a gzipped pprof file that other pprof tools can read
+export function writeProfile(profilePath: string, profile: Profile): void {
+  writeFileSync(profilePath, encodeProfile(profile));
+}
+
+// Resolve a sample type name (e.g. "alloc_space") to its index.
+// Defaults to the profile's default sample type, or else the last one,
+// matching pprof.
+export function sampleIndexOf(profile: Profile, sampleType?: string): number {
+  if (sampleType) {
+    const index = profile.sampleTypes.findIndex((t) => t.type === sampleType);
+    if (index === -1) {
+      const available = profile.sampleTypes.map((t) => t.type).join(", ");
+      throw new Error(`Sample type "${sampleType}" not found (available: ${available})`);
+    }
+    return index;
+  }
+  const defaultIndex = profile.sampleTypes.findIndex((t) => t.type === profile.defaultSampleType);
+  return defaultIndex !== -1 ? defaultIndex : profile.sampleTypes.length - 1;
+}
+
+// Return the call stack of a sample as function names, root first
+export function stackOf(profile: Profile, sample: Sample): string[] {
+  const stack: string[] = [];
+  for (const id of sample.locationIds) {
+    const location = profile.locations.get(id);
+    if (location) {
+      for (const frame of location.frames) {
+        stack.push(frame.name);
+      }
+    }
+  }
+  return stack.reverse();
+}
+
+// Source file of a function, from the first frame that names it
+export function fileOf(profile: Profile, name: string): string | undefined {
+  for (const location of profile.locations.values()) {
+    const frame = location.frames.find((f) => f.name === name);
+    if (frame?.file) {
+      return frame.file;
+    }
+  }
+  return undefined;
+}
+
+// Sum a sample type over all samples
+export function totalOf(profile: Profile, sampleIndex: number): number {
+  return profile.samples.reduce((sum, s) => sum + s.values[sampleIndex], 0);
+}
+
+const TIME_UNITS: Record<string, number> = {
+  nanoseconds: 1e-9, microseconds: 1e-6, milliseconds: 1e-3, seconds: 1,
+};
+
+// Convert a value to seconds (time units) or bytes (size units)
+export function toBaseUnit(value: number, unit: string): number {
+  return value * (TIME_UNITS[unit] ?? 1);
+}
+
+// Format a value in its sample unit for display, e.g. "1.25s" or "3.4MB"
+export function formatValue(value: number, unit: string): string {
+  if (unit === "bytes") {
+    const units = ["B", "kB", "MB", "GB", "TB"];
+    let scaled = value;
+    let i = 0;
+    while (Math.abs(scaled) >= 1024 && i < units.length - 1) {
+      scaled /= 1024;
+      i++;
+    }
+    return `${trimFixed(scaled)}${units[i]}`;
+  }
+  if (unit in TIME_UNITS) {
+    const seconds = toBaseUnit(value, unit);
+    if (Math.abs(seconds) >= 1) return `${trimFixed(seconds)}s`;
+    if (Math.abs(seconds) >= 1e-3) return `${trimFixed(seconds * 1e3)}ms`;
+    if (Math.abs(seconds) >= 1e-6) return `${trimFixed(seconds * 1e6)}µs`;
+    return `${trimFixed(seconds * 1e9)}ns`;
+  }
+  return `${trimFixed(value)}`;
+}
+
+function trimFixed(value: number): string {
+  return String(Math.round(value * 100) / 100);
+}
+
+// Human-readable name for what a sample type measures
+export function describeSampleType(type: string): string {
+  const descriptions: Record<string, string> = {
+    samples: "CPU samples",
+    cpu: "CPU time",
+    inuse_space: "in-use memory",
+    inuse_objects: "in-use objects",
+    alloc_space: "allocated memory",
+    alloc_objects: "allocated objects",
+    contentions: "contention events",
+    delay: "blocking delay",
+    goroutine: "goroutines",
+  };
+  return descriptions[type] ?? type;
+}
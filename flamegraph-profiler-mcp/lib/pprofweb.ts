@@ -0,0 +1,160 @@
+/**
+ * pprof's own web UI for a stored profile, for exploring interactively
+ * outside the conversation: `go tool pprof -http` on a free local port,
+ * stopped on request, after a time limit, or when the server exits.
+ */
+import { execFile, spawn, type ChildProcess } from "node:child_process";
+import { randomBytes } from "node:crypto";
+import { promisify } from "node:util";
+import { resolveProfilePath } from "./catalog.js";
+import { freePort } from "./target.js";
+
+const execFileAsync = promisify(execFile);
+
+export interface PprofWebSession {
+  id: string;
+  // Catalog ID or path the profile was given as, and the baseline it is compared with
+  profile: string;
+  baseline?: string;
+  sampleType?: string;
+  url: string;
+  pid?: number;
+  startedAt: string;
+  // When the UI is shut down unless stopped earlier
+  expiresAt: string;
+}
+
+interface SessionState extends PprofWebSession {
+  child: ChildProcess;
+  timer: NodeJS.Timeout;
+}
+
+// pprof UIs running at once; each holds its profile in memory
+const MAX_SESSIONS = 5;
+
+// Time pprof gets to load the profile and start serving
+const START_TIMEOUT_MS = 30_000;
+
+// Lines of pprof's output kept for the error when it fails to start
+const OUTPUT_LINES = 10;
+
+const sessions = new Map<string, SessionState>();
+let stopOnExit = false;
+
+function publicView(state: SessionState): PprofWebSession {
+  const { child: _child, timer: _timer, ...session } = state;
+  return session;
+}
+
+// The pprof executable itself rather than `go tool pprof`, which runs it as
+// a child that signals to the go command would leave behind
+async function pprofBinary(): Promise<string> {
+  try {
+    return (await execFileAsync("go", ["tool", "-n", "pprof"])).stdout.trim();
+  } catch (error) {
+    const stderr = (error as { stderr?: string }).stderr?.trim();
+    throw new Error(`Could not find go tool pprof: ${stderr || (error instanceof Error ? error.message : error)}`);
+  }
+}
+
+function stopAll(): void {
+  for (const state of sessions.values()) {
+    state.child.kill("SIGTERM");
+  }
+}
+
+// Start pprof's web UI for a profile, optionally as a diff against a
+// baseline, and resolve with its URL once it serves. The UI listens on
+// 127.0.0.1 only, so it is reachable from the server's machine.
+export async function launchPprofWeb(options: { profile: string; baseline?: string; sampleType?: string; minutes: number }): Promise<PprofWebSession> {
+  if (sessions.size >= MAX_SESSIONS) {
+    throw new Error(`${MAX_SESSIONS} pprof web UIs are already running; stop one with stop_pprof_web`);
+  }
+  const file = await resolveProfilePath(options.profile);
+  const baselineFile = options.baseline ? await resolveProfilePath(options.baseline) : undefined;
+  const port = await freePort();
+  const args = [
+    `-http=127.0.0.1:${port}`, "-no_browser",
+    ...(options.sampleType ? [`-sample_index=${options.sampleType}`] : []),
+    ...(baselineFile ? [`-diff_base=${baselineFile}`] : []),
+    file,
+  ];
+  const child = spawn(await pprofBinary(), args, { stdio: ["ignore", "pipe", "pipe"] });
+  const output: string[] = [];
+  const collect = (chunk: Buffer) => output.push(...chunk.toString().split("\n").filter(Boolean));
+  child.stdout?.on("data", collect);
+  child.stderr?.on("data", collect);
+
+  const url = `http://127.0.0.1:${port}/ui/`;
+  const exited = new Promise<never>((_, reject) => {
+    child.on("error", (error) => reject(new Error(`Could not run pprof: ${error.message}`)));
+    child.on("exit", (code, signal) => reject(new Error(
+      `pprof exited (${signal ?? `code ${code}`}) before serving: ${output.slice(-OUTPUT_LINES).join("\n") || "no output"}`,
+    )));
+  });
+  exited.catch(() => undefined);
+  const serving = (async () => {
+    const deadline = Date.now() + START_TIMEOUT_MS;
+    while (Date.now() < deadline) {
+      const response = await fetch(url, { signal: AbortSignal.timeout(2000) }).catch(() => undefined);
+      if (response?.ok) {
+        return;
+      }
+      // Serving, but unable to show the profile, e.g. for an unknown sample type
+      if (response) {
+        throw new Error(`pprof could not show the profile: ${(await response.text()).trim()}`);
+      }
+      await new Promise((resolve) => setTimeout(resolve, 200));
+    }
+    throw new Error(`pprof did not serve ${url} within ${START_TIMEOUT_MS / 1000}s`);
+  })();
+  try {
+    await Promise.race([serving, exited]);
+  } catch (error) {
+    child.kill("SIGKILL");
+    throw error;
+  }
+
+  if (!stopOnExit) {
+    process.once("exit", stopAll);
+    stopOnExit = true;
+  }
+  const id = `w_${randomBytes(3).toString("hex")}`;
+  const startedAt = new Date();
+  const timer = setTimeout(() => void stopPprofWeb(id), options.minutes * 60_000);
+  timer.unref();
+  const state: SessionState = {
+    id,
+    profile: options.profile,
+    baseline: options.baseline,
+    sampleType: options.sampleType,
+    url,
+    pid: child.pid,
+    startedAt: startedAt.toISOString(),
+    expiresAt: new Date(startedAt.getTime() + options.minutes * 60_000).toISOString(),
+    child,
+    timer,
+  };
+  sessions.set(id, state);
+  child.on("exit", () => {
+    clearTimeout(timer);
+    sessions.delete(id);
+  });
+  return publicView(state);
+}
+
+// Shut down one pprof web UI
+export function stopPprofWeb(id: string): PprofWebSession {
+  const state = sessions.get(id);
+  if (!state) {
+    throw new Error(`No pprof web UI ${id} is running${sessions.size > 0 ? `; running: ${[...sessions.keys()].join(", ")}` : ""}`);
+  }
+  clearTimeout(state.timer);
+  state.child.kill("SIGTERM");
+  sessions.delete(id);
+  return publicView(state);
+}
+
+export function listPprofWeb(): PprofWebSession[] {
+  return [...sessions.values()].map(publicView);
+}
@@ -0,0 +1,276 @@
+/**
+ * Markdown pull request comments from the structured results of the diff and
+ * check tools, so CI can post them as they are. The headline and the rows
+ * that matter most go in a compact table; the rest folds into <details>
+ * sections. Comments stay under GitHub's 65,536-character limit by dropping
+ * folded rows first, and start with a hidden marker naming the kind of
+ * result, so a CI job can find and update its earlier comment.
+ */
+import type { BudgetReport, BudgetResult, BudgetRuleResult } from "./budgets.js";
+import type { DiffResult, FunctionDelta } from "./diff.js";
+import { formatValue } from "./pprof.js";
+import { formatRate } from "./rates.js";
+import type { Regression } from "./regressions.js";
+import type { RouteSlo, SloReport } from "./slo.js";
+import { formatNanos } from "./uprobes.js";
+
+export const PR_COMMENT_KINDS = ["diff", "regressions", "budgets", "profile-budget", "slo"] as const;
+export type PrCommentKind = (typeof PR_COMMENT_KINDS)[number];
+
+export interface PrComment {
+  kind: PrCommentKind;
+  // Whether the result passes, for CI to fail the build on
+  passed: boolean;
+  markdown: string;
+  // Rows left out to fit GitHub's limit
+  truncated: number;
+}
+
+export interface PrCommentOptions {
+  title?: string;
+  // Rows in each table before the rest is folded away
+  maxRows?: number;
+  // Image shown next to the title, e.g. a diff_badge URL
+  badgeUrl?: string;
+}
+
+// GitHub rejects comments longer than 65,536 characters
+export const GITHUB_COMMENT_LIMIT = 65_536;
+
+const MARKER = "flamegraph-profiler";
+
+type Row = string[];
+
+interface Section {
+  // Shown above the table; the table folds away under it when collapsed
+  summary: string;
+  header: Row;
+  // Right-aligned columns
+  numeric: number[];
+  rows: Row[];
+  collapsed: boolean;
+}
+
+interface Draft {
+  kind: PrCommentKind;
+  title: string;
+  passed: boolean;
+  headline: string;
+  sections: Section[];
+}
+
+// Code span for a table cell; pipes would end the cell
+function code(text: string): string {
+  return `\`${text.replace(/\|/g, "\\|").replace(/`/g, "'")}\``;
+}
+
+function cell(text: string): string {
+  return text.replace(/\|/g, "\\|").replace(/\n/g, " ");
+}
+
+function pts(value: number): string {
+  return `${value > 0 ? "+" : ""}${value} pts`;
+}
+
+function table(section: Section, rows: Row[]): string {
+  const align = section.header.map((_, i) => (section.numeric.includes(i) ? "---:" : "---"));
+  return [section.header, align, ...rows].map((row) => `| ${row.join(" | ")} |`).join("\n");
+}
+
+// Which tool's structured content a result is
+export function prCommentKind(result: Record<string, unknown>): PrCommentKind {
+  if (result.schema === "diff" || (result.diff && typeof result.diff === "object")) {
+    return "diff";
+  }
+  if (result.schema === "regressions") {
+    return "regressions";
+  }
+  if (Array.isArray(result.routes) && typeof result.targetNs === "number") {
+    return "slo";
+  }
+  if (Array.isArray(result.results) && Array.isArray(result.violations)) {
+    return "profile-budget";
+  }
+  if (Array.isArray(result.results) && typeof result.file === "string") {
+    return "budgets";
+  }
+  throw new Error("Unrecognized result; pass the structured content of diff_flamegraph, detect_regressions, check_budgets, check_profile_budget or check_slo");
+}
+
+
+function diffDraft(result: Record<string, unknown>, maxRows: number): Draft {
+  const diff = result.diff as Omit<DiffResult, "flamegraph">;
+  const findings = Array.isArray(result.findings) ? result.findings.length : 0;
+  const header = ["Function", "Before", "After", "Δ flat", "Δ cum"];
+  const regressions = diff.regressions ?? [];
+  const improvements = diff.improvements ?? [];
+  const change = diff.rates?.changePct
+    ?? (diff.baselineTotal > 0 ? Math.round(((diff.comparisonTotal - diff.baselineTotal) / diff.baselineTotal) * 1000) / 10 : 0);
+  // Rates per second or request when the diff compared them, else shares
+  const rate = (value: number) => `${value > 0 ? "+" : ""}${formatRate(value, diff.unit, diff.rates!.per)}`;
+  const deltaRow = (d: FunctionDelta): Row => (diff.rates
+    ? [code(d.name), formatRate(d.baselineFlatRate!, diff.unit, diff.rates.per), formatRate(d.comparisonFlatRate!, diff.unit, diff.rates.per), `**${rate(d.flatRateDelta!)}**`, rate(d.cumRateDelta!)]
+    : [code(d.name), `${d.baselineFlatPct}%`, `${d.comparisonFlatPct}%`, `**${pts(d.flatDeltaPct)}**`, pts(d.cumDeltaPct)]);
+  const totals = diff.rates
+    ? `per ${diff.rates.per} ${formatRate(diff.rates.baselineRate, diff.unit, diff.rates.per)} → ${formatRate(diff.rates.comparisonRate, diff.unit, diff.rates.per)}`
+    : `total ${formatValue(diff.baselineTotal, diff.unit)} → ${formatValue(diff.comparisonTotal, diff.unit)}`;
+  return {
+    kind: "diff",
+    title: "Profile diff",
+    passed: findings === 0,
+    headline: `${findings > 0 ? `❌ **${findings} regression finding(s)**` : "✅ **No regression findings**"} · \`${diff.sampleType}\` · ${typeof result.name === "string" ? cell(result.name) : "baseline → comparison"} · ${totals} (${change > 0 ? "+" : ""}${change}%)`,
+    sections: [
+      { summary: `📈 Largest regressions (${regressions.length})`, header, numeric: [1, 2, 3, 4], rows: regressions.slice(0, maxRows).map(deltaRow), collapsed: false },
+      { summary: `More regressions (${Math.max(0, regressions.length - maxRows)})`, header, numeric: [1, 2, 3, 4], rows: regressions.slice(maxRows).map(deltaRow), collapsed: true },
+      { summary: `📉 Improvements (${improvements.length})`, header, numeric: [1, 2, 3, 4], rows: improvements.map(deltaRow), collapsed: true },
+    ],
+  };
+}
+
+function regressionsDraft(result: Record<string, unknown>, maxRows: number): Draft {
+  const regressions = (result.regressions ?? []) as Array<Regression & { owners?: string[] }>;
+  const header = ["Function", "Measure", "Before", "After", "Δ", "Confidence", "Owners"];
+  const row = (r: Regression & { owners?: string[] }): Row => {
+    const [before, after, delta] = r.measure === "flat"
+      ? [r.baselineFlatPct, r.comparisonFlatPct, r.flatDeltaPct]
+      : [r.baselineCumPct, r.comparisonCumPct, r.cumDeltaPct];
+    return [code(r.name), r.measure, `${before}%`, `${after}%`, `**${pts(delta)}**`, r.confidence, cell((r.owners ?? []).join(" "))];
+  };
+  return {
+    kind: "regressions",
+    title: "Regression check",
+    passed: regressions.length === 0,
+    headline: `${regressions.length > 0 ? `❌ **${regressions.length} regression(s)**` : "✅ **No regressions**"} · \`${String(result.sampleType)}\` · threshold ${String(result.thresholdPts)} pts`,
+    sections: [
+      { summary: "📈 Regressions", header, numeric: [2, 3, 4], rows: regressions.slice(0, maxRows).map(row), collapsed: false },
+      { summary: `More regressions (${Math.max(0, regressions.length - maxRows)})`, header, numeric: [2, 3, 4], rows: regressions.slice(maxRows).map(row), collapsed: true },
+    ],
+  };
+}
+
+function budgetsDraft(result: Record<string, unknown>, maxRows: number): Draft {
+  const report = result as unknown as BudgetReport;
+  const header = ["", "Budget", "Actual", "Limit", "Top functions", "Owners"];
+  const row = (r: BudgetResult): Row => [
+    r.passed ? "✅" : "❌",
+    cell(r.subject),
+    `${r.actual}% ${r.budget.measure}`,
+    `≤ ${r.budget.max}%`,
+    cell(r.topFunctions.slice(0, 3).map((f) => `${f.name} (${f.percentage}%)`).join(", ")),
+    cell(r.owners.join(" ")),
+  ];
+  const failed = report.results.filter((r) => !r.passed);
+  const passed = report.results.filter((r) => r.passed);
+  return {
+    kind: "budgets",
+    title: "Performance budgets",
+    passed: report.passed,
+    headline: `${report.passed ? `✅ **All ${report.results.length} budget(s) met**` : `❌ **${failed.length} of ${report.results.length} budget(s) exceeded**`}${report.scenario ? ` · scenario \`${cell(report.scenario)}\`` : ""}`,
+    sections: [
+      { summary: "❌ Exceeded", header, numeric: [2, 3], rows: failed.slice(0, maxRows).map(row), collapsed: false },
+      { summary: `✅ Met (${passed.length})${failed.length > maxRows ? ` and ${failed.length - maxRows} more exceeded` : ""}`, header, numeric: [2, 3], rows: [...failed.slice(maxRows), ...passed].map(row), collapsed: true },
+    ],
+  };
+}
+
+function profileBudgetDraft(result: Record<string, unknown>, maxRows: number): Draft {
+  const results = result.results as BudgetRuleResult[];
+  const header = ["", "Rule", "Actual", "Top functions"];
+  const row = (r: BudgetRuleResult): Row => [
+    r.passed ? "✅" : "❌",
+    code(r.rule.rule),
+    r.rule.unit === "percent" ? `${r.actualPercent}%` : formatValue(r.actual, r.unit),
+    cell(r.topFunctions.slice(0, 3).map((f) => `${f.name} (${f.percentage}%)`).join(", ")),
+  ];
+  const failed = results.filter((r) => !r.passed);
+  const passed = results.filter((r) => r.passed);
+  return {
+    kind: "profile-budget",
+    title: "Profile budget",
+    passed: failed.length === 0,
+    headline: failed.length === 0 ? `✅ **PASS: all ${results.length} budget(s) met**` : `❌ **FAIL: ${failed.length} of ${results.length} budget(s) violated**`,
+    sections: [
+      { summary: "❌ Violated", header, numeric: [2], rows: failed.slice(0, maxRows).map(row), collapsed: false },
+      { summary: `✅ Met (${passed.length})${failed.length > maxRows ? ` and ${failed.length - maxRows} more violated` : ""}`, header, numeric: [2], rows: [...failed.slice(maxRows), ...passed].map(row), collapsed: true },
+    ],
+  };
+}
+
+function sloDraft(result: Record<string, unknown>, maxRows: number): Draft {
+  const report = result as unknown as SloReport;
+  const header = ["", "Route", "Requests", "p50", "p90", "p99", "Over target"];
+  const row = (r: RouteSlo): Row => [
+    r.violated ? "❌" : "✅",
+    code(r.route),
+    String(r.requests),
+    formatNanos(r.latency.p50),
+    formatNanos(r.latency.p90),
+    formatNanos(r.latency.p99),
+    r.slow > 0 ? `${r.slow} (${r.slowPct}%)` : "0",
+  ];
+  const violated = report.routes.filter((r) => r.violated);
+  const met = report.routes.filter((r) => !r.violated);
+  return {
+    kind: "slo",
+    title: "Latency SLO",
+    passed: violated.length === 0,
+    headline: `${violated.length === 0 ? `✅ **All ${report.routes.length} route(s) within target**` : `❌ **${violated.length} of ${report.routes.length} route(s) over target**`} · ${report.percentile} ≤ ${formatNanos(report.targetNs)}\n\n${cell(report.verdict)}`,
+    sections: [
+      { summary: "❌ Over target", header, numeric: [2, 3, 4, 5, 6], rows: violated.slice(0, maxRows).map(row), collapsed: false },
+      { summary: `✅ Within target (${met.length})${violated.length > maxRows ? ` and ${violated.length - maxRows} more over` : ""}`, header, numeric: [2, 3, 4, 5, 6], rows: [...violated.slice(maxRows), ...met].map(row), collapsed: true },
+    ],
+  };
+}
+
+const DRAFTS: Record<PrCommentKind, (result: Record<string, unknown>, maxRows: number) => Draft> = {
+  diff: diffDraft,
+  regressions: regressionsDraft,
+  budgets: budgetsDraft,
+  "profile-budget": profileBudgetDraft,
+  slo: sloDraft,
+};
+
+function render(draft: Draft, options: PrCommentOptions, rowsOf: (section: Section) => Row[]): string {
+  const title = options.title ?? draft.title;
+  const parts = [
+    `<!-- ${MARKER}:${draft.kind} -->`,
+    `### ${draft.passed ? "✅" : "❌"} ${cell(title)}${options.badgeUrl ? ` ![${cell(title)}](${options.badgeUrl})` : ""}`,
+    draft.headline,
+  ];
+  for (const section of draft.sections) {
+    const rows = rowsOf(section);
+    if (rows.length === 0) {
+      continue;
+    }
+    const left = section.rows.length - rows.length;
+    const body = `${table(section, rows)}${left > 0 ? `\n\n_${left} more row(s) left out to fit a GitHub comment._` : ""}`;
+    parts.push(section.collapsed
+      ? `<details>\n<summary>${section.summary}</summary>\n\n${body}\n\n</details>`
+      : `**${section.summary}**\n\n${body}`);
+  }
+  parts.push(`<sub>Posted by the flamegraph profiler</sub>`);
+  return parts.join("\n\n");
+}
+
+// Markdown comment for a diff or check result, fitted to GitHub's limit by
+// dropping the rows of folded sections, then of open ones, from the end
+export function formatPrComment(result: Record<string, unknown>, options: PrCommentOptions = {}): PrComment {
+  const kind = prCommentKind(result);
+  const draft = DRAFTS[kind](result, options.maxRows ?? 10);
+  const keep = new Map(draft.sections.map((s) => [s, s.rows.length]));
+  let markdown = render(draft, options, (s) => s.rows.slice(0, keep.get(s)));
+  const order = [...draft.sections.filter((s) => s.collapsed).reverse(), ...draft.sections.filter((s) => !s.collapsed).reverse()];
+  while (markdown.length > GITHUB_COMMENT_LIMIT) {
+    const section = order.find((s) => (keep.get(s) ?? 0) > 0);
+    if (!section) {
+      break;
+    }
+    // Drop about as many rows as the excess needs, at least one
+    const rowLength = Math.max(1, Math.ceil(section.rows.reduce((n, r) => n + r.join(" | ").length + 4, 0) / section.rows.length));
+    const excess = Math.ceil((markdown.length - GITHUB_COMMENT_LIMIT) / rowLength);
+    keep.set(section, Math.max(0, (keep.get(section) ?? 0) - Math.max(1, excess)));
+    markdown = render(draft, options, (s) => s.rows.slice(0, keep.get(s)));
+  }
+  const truncated = draft.sections.reduce((n, s) => n + s.rows.length - (keep.get(s) ?? 0), 0);
+  return { kind, passed: draft.passed, markdown, truncated };
+}
@@ -0,0 +1,350 @@
+/**
+ * Decoding and encoding of profile.proto, the pprof file format.
+ * See https://github.com/google/pprof/blob/main/proto/profile.proto
+ */
+import { gunzipSync, gzipSync } from "node:zlib";
+import { ProfileTooLargeError, serverConfig } from "./config.js";
+import type { Frame, Location, Mapping, Profile, Sample, SampleType } from "./pprof.js";
+import { ProtoReader, ProtoWriter } from "./protobuf.js";
+
+interface RawFunction {
+  name: number;
+  filename: number;
+  startLine: number;
+}
+
+interface RawLine {
+  functionId: number;
+  line: number;
+}
+
+interface RawLocation {
+  id: number;
+  mappingId: number;
+  address: bigint;
+  lines: RawLine[];
+}
+
+interface RawLabel {
+  key: number;
+  str: number;
+  num: number;
+}
+
+interface RawSample {
+  locationIds: number[];
+  values: number[];
+  labels: RawLabel[];
+}
+
+interface RawMapping {
+  id: number;
+  start: bigint;
+  limit: bigint;
+  offset: bigint;
+  filename: number;
+  buildId: number;
+}
+
+const hex = (value: bigint | number) => `0x${value.toString(16)}`;
+
+function readValueType(bytes: Uint8Array): [type: number, unit: number] {
+  const reader = new ProtoReader(bytes);
+  let type = 0;
+  let unit = 0;
+  while (!reader.done()) {
+    const [field, wire] = reader.key();
+    if (field === 1) type = reader.varint();
+    else if (field === 2) unit = reader.varint();
+    else reader.skip(wire);
+  }
+  return [type, unit];
+}
+
+function readSample(bytes: Uint8Array): RawSample {
+  const reader = new ProtoReader(bytes);
+  const sample: RawSample = { locationIds: [], values: [], labels: [] };
+  while (!reader.done()) {
+    const [field, wire] = reader.key();
+    if (field === 1) reader.repeated(wire, sample.locationIds);
+    else if (field === 2) reader.repeated(wire, sample.values);
+    else if (field === 3) {
+      const label = new ProtoReader(reader.bytes());
+      const raw: RawLabel = { key: 0, str: 0, num: 0 };
+      while (!label.done()) {
+        const [labelField, labelWire] = label.key();
+        if (labelField === 1) raw.key = label.varint();
+        else if (labelField === 2) raw.str = label.varint();
+        else if (labelField === 3) raw.num = label.varint();
+        else label.skip(labelWire);
+      }
+      sample.labels.push(raw);
+    } else reader.skip(wire);
+  }
+  return sample;
+}
+
+function readMapping(bytes: Uint8Array): RawMapping {
+  const reader = new ProtoReader(bytes);
+  const mapping: RawMapping = { id: 0, start: 0n, limit: 0n, offset: 0n, filename: 0, buildId: 0 };
+  while (!reader.done()) {
+    const [field, wire] = reader.key();
+    if (field === 1) mapping.id = reader.varint();
+    else if (field === 2) mapping.start = reader.varintBig();
+    else if (field === 3) mapping.limit = reader.varintBig();
+    else if (field === 4) mapping.offset = reader.varintBig();
+    else if (field === 5) mapping.filename = reader.varint();
+    else if (field === 6) mapping.buildId = reader.varint();
+    else reader.skip(wire);
+  }
+  return mapping;
+}
+
+function readLocation(bytes: Uint8Array): RawLocation {
+  const reader = new ProtoReader(bytes);
+  const location: RawLocation = { id: 0, mappingId: 0, address: 0n, lines: [] };
+  while (!reader.done()) {
+    const [field, wire] = reader.key();
+    if (field === 1) location.id = reader.varint();
+    else if (field === 2) location.mappingId = reader.varint();
+    else if (field === 3) location.address = reader.varintBig();
+    else if (field === 4) {
+      const line = new ProtoReader(reader.bytes());
+      const raw: RawLine = { functionId: 0, line: 0 };
+      while (!line.done()) {
+        const [lineField, lineWire] = line.key();
+        if (lineField === 1) raw.functionId = line.varint();
+        else if (lineField === 2) raw.line = line.varint();
+        else line.skip(lineWire);
+      }
+      location.lines.push(raw);
+    } else reader.skip(wire);
+  }
+  return location;
+}
+
+function readFunction(bytes: Uint8Array): [id: number, fn: RawFunction] {
+  const reader = new ProtoReader(bytes);
+  let id = 0;
+  const fn: RawFunction = { name: 0, filename: 0, startLine: 0 };
+  while (!reader.done()) {
+    const [field, wire] = reader.key();
+    if (field === 1) id = reader.varint();
+    else if (field === 2) fn.name = reader.varint();
+    else if (field === 4) fn.filename = reader.varint();
+    else if (field === 5) fn.startLine = reader.varint();
+    else reader.skip(wire);
+  }
+  return [id, fn];
+}
+
+// Decompress a gzipped profile up to the configured maximum size, so a small
+// upload cannot expand to fill memory
+function gunzip(data: Uint8Array): Uint8Array {
+  const { maxProfileBytes } = serverConfig().limits;
+  try {
+    return gunzipSync(data, { maxOutputLength: maxProfileBytes });
+  } catch (error) {
+    if ((error as NodeJS.ErrnoException).code === "ERR_BUFFER_TOO_LARGE") {
+      throw new ProfileTooLargeError(`Profile decompresses to more than the configured maximum of ${maxProfileBytes} bytes`);
+    }
+    throw error;
+  }
+}
+
+// Decode a pprof file's contents, gzipped or not
+export function decodeProfile(data: Uint8Array): Profile {
+  const buf = data[0] === 0x1f && data[1] === 0x8b ? gunzip(data) : data;
+  const reader = new ProtoReader(buf);
+
+  const strings: string[] = [];
+  const sampleTypes: Array<[number, number]> = [];
+  const samples: RawSample[] = [];
+  const mappings: RawMapping[] = [];
+  const locations: RawLocation[] = [];
+  const functions = new Map<number, RawFunction>();
+  const comments: number[] = [];
+  let periodType: [number, number] | undefined;
+  let period = 0;
+  let timeNanos = 0;
+  let durationNanos = 0;
+  let defaultSampleType = 0;
+
+  const decoder = new TextDecoder();
+  while (!reader.done()) {
+    const [field, wire] = reader.key();
+    switch (field) {
+      case 1: sampleTypes.push(readValueType(reader.bytes())); break;
+      case 2: samples.push(readSample(reader.bytes())); break;
+      case 3: mappings.push(readMapping(reader.bytes())); break;
+      case 4: locations.push(readLocation(reader.bytes())); break;
+      case 5: { const [id, fn] = readFunction(reader.bytes()); functions.set(id, fn); break; }
+      case 6: strings.push(decoder.decode(reader.bytes())); break;
+      case 9: timeNanos = reader.varint(); break;
+      case 10: durationNanos = reader.varint(); break;
+      case 11: periodType = readValueType(reader.bytes()); break;
+      case 12: period = reader.varint(); break;
+      case 13: reader.repeated(wire, comments); break;
+      case 14: defaultSampleType = reader.varint(); break;
+      default: reader.skip(wire);
+    }
+  }
+
+  const str = (index: number) => strings[index] ?? "";
+  const valueType = ([type, unit]: [number, number]): SampleType => ({ type: str(type), unit: str(unit) });
+
+  const profile: Profile = {
+    sampleTypes: sampleTypes.map(valueType),
+    samples: samples.map((raw): Sample => {
+      const labels: Record<string, string> = {};
+      const numLabels: Record<string, number> = {};
+      for (const label of raw.labels) {
+        const key = str(label.key);
+        if (label.str) {
+          labels[key] = key in labels ? `${labels[key]} ${str(label.str)}` : str(label.str);
+        } else {
+          numLabels[key] = label.num;
+        }
+      }
+      return {
+        values: raw.values,
+        locationIds: raw.locationIds,
+        labels,
+        ...(Object.keys(numLabels).length > 0 ? { numLabels } : {}),
+      };
+    }),
+    locations: new Map(),
+    mappings: mappings.map((raw): Mapping => ({
+      id: raw.id,
+      start: hex(raw.start),
+      limit: hex(raw.limit),
+      offset: hex(raw.offset),
+      file: str(raw.filename),
+      buildId: str(raw.buildId),
+    })),
+    period,
+  };
+  if (periodType) profile.periodType = valueType(periodType);
+  if (durationNanos) profile.durationSeconds = durationNanos / 1e9;
+  if (timeNanos) profile.timeNanos = timeNanos;
+  if (defaultSampleType) profile.defaultSampleType = str(defaultSampleType);
+  if (comments.length > 0) profile.comments = comments.map(str);
+
+  for (const raw of locations) {
+    // The Go runtime writes native (cgo) PCs it cannot symbolize as lines of
+    // a nameless function; those are address-only too
+    const frames = raw.lines.flatMap((line): Frame[] => {
+      const fn = functions.get(line.functionId);
+      if (fn && !str(fn.name)) {
+        return [];
+      }
+      const frame: Frame = { name: fn ? str(fn.name) : hex(raw.address), file: fn ? str(fn.filename) : "", line: line.line };
+      if (fn?.startLine) frame.startLine = fn.startLine;
+      return [frame];
+    });
+    const location: Location = { id: raw.id, address: hex(raw.address), mappingId: raw.mappingId, frames };
+    // Locations without symbols fall back to their address
+    if (frames.length === 0) {
+      frames.push({ name: location.address, file: "", line: 0 });
+    }
+    profile.locations.set(raw.id, location);
+  }
+
+  return profile;
+}
+
+// Encode a profile as a gzipped pprof file
+export function encodeProfile(profile: Profile): Buffer {
+  const strings = new Map<string, number>([["", 0]]);
+  const str = (value: string) => {
+    let index = strings.get(value);
+    if (index === undefined) {
+      index = strings.size;
+      strings.set(value, index);
+    }
+    return index;
+  };
+  const valueType = (t: SampleType) => new ProtoWriter().varintField(1, str(t.type)).varintField(2, str(t.unit));
+
+  const out = new ProtoWriter();
+  for (const type of profile.sampleTypes) {
+    out.messageField(1, valueType(type));
+  }
+  for (const sample of profile.samples) {
+    const message = new ProtoWriter().packedField(1, sample.locationIds).packedField(2, sample.values);
+    for (const [key, value] of Object.entries(sample.labels)) {
+      message.messageField(3, new ProtoWriter().varintField(1, str(key)).varintField(2, str(value)));
+    }
+    for (const [key, value] of Object.entries(sample.numLabels ?? {})) {
+      message.messageField(3, new ProtoWriter().varintField(1, str(key)).varintField(3, value));
+    }
+    out.messageField(2, message);
+  }
+  for (const mapping of profile.mappings) {
+    out.messageField(3, new ProtoWriter()
+      .varintField(1, mapping.id)
+      .varintField(2, BigInt(mapping.start))
+      .varintField(3, BigInt(mapping.limit))
+      .varintField(4, BigInt(mapping.offset))
+      .varintField(5, str(mapping.file))
+      .varintField(6, str(mapping.buildId))
+      .varintField(7, 1)
+      .varintField(8, 1)
+      .varintField(9, 1)
+      .varintField(10, 1));
+  }
+
+  const functions = new Map<string, number>();
+  const functionMessages: ProtoWriter[] = [];
+  // Frames renamed for display are written under their name in the binary
+  const functionId = (frame: Frame) => {
+    const name = frame.symbol ?? frame.name;
+    const key = `${name}\u0000${frame.file}\u0000${frame.startLine ?? 0}`;
+    let id = functions.get(key);
+    if (id === undefined) {
+      id = functions.size + 1;
+      functions.set(key, id);
+      const message = new ProtoWriter()
+        .varintField(1, id)
+        .varintField(2, str(name))
+        .varintField(3, str(name))
+        .varintField(4, str(frame.file));
+      functionMessages.push(frame.startLine ? message.varintField(5, frame.startLine) : message);
+    }
+    return id;
+  };
+  for (const location of profile.locations.values()) {
+    const message = new ProtoWriter()
+      .varintField(1, location.id)
+      .varintField(2, location.mappingId)
+      .varintField(3, BigInt(location.address));
+    // Address-only locations carry no line information
+    const symbolized = !(location.frames.length === 1 && location.frames[0].name === location.address);
+    if (symbolized) {
+      for (const frame of location.frames) {
+        message.messageField(4, new ProtoWriter().varintField(1, functionId(frame)).varintField(2, frame.line));
+      }
+    }
+    out.messageField(4, message);
+  }
+  for (const message of functionMessages) {
+    out.messageField(5, message);
+  }
+
+  if (profile.timeNanos) out.varintField(9, profile.timeNanos);
+  if (profile.durationSeconds) out.varintField(10, Math.round(profile.durationSeconds * 1e9));
+  if (profile.periodType) out.messageField(11, valueType(profile.periodType));
+  out.varintField(12, profile.period);
+  const comments = (profile.comments ?? []).map(str);
+  const defaultSampleType = profile.defaultSampleType ? str(profile.defaultSampleType) : 0;
+  // The string table goes last so that every string above is interned
+  for (const value of strings.keys()) {
+    out.stringField(6, value);
+  }
+  for (const comment of comments) {
+    out.varintField(13, comment);
+  }
+  out.varintField(14, defaultSampleType);
+
+  return gzipSync(out.finish());
+}
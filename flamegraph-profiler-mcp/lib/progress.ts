@@ -0,0 +1,85 @@
+/**
+ * MCP progress notifications for tools that wait out a capture window, so a
+ * client shows "capturing CPU profile: 12/30s" instead of a silent call, and
+ * clients that reset their request timeout on progress do not give up on a
+ * long capture.
+ */
+import type { RequestHandlerExtra } from "@modelcontextprotocol/sdk/shared/protocol.js";
+import type { ServerNotification, ServerRequest } from "@modelcontextprotocol/sdk/types.js";
+
+export type ToolExtra = RequestHandlerExtra<ServerRequest, ServerNotification>;
+
+// Reports how far a tool call is; total is left out when the end is unknown
+export type ProgressReporter = (progress: number, total: number | undefined, message: string) => void;
+
+export const noProgress: ProgressReporter = () => undefined;
+
+// What a tool call has reported, shared by every reporter of the call: the
+// last progress sent, and where the current step's progress starts
+const reported = new WeakMap<ToolExtra, { last: number; base: number }>();
+
+// Reporter for a tool call, or noProgress when the client did not ask for
+// progress by sending a progressToken with the request
+export function progressReporter(extra?: ToolExtra): ProgressReporter {
+  const progressToken = extra?._meta?.progressToken;
+  if (!extra || progressToken === undefined) {
+    return noProgress;
+  }
+  let state = reported.get(extra);
+  if (!state) {
+    state = { last: -Infinity, base: 0 };
+    reported.set(extra, state);
+  }
+  const call = state;
+  return (progress, total, message) => {
+    progress += call.base;
+    // The spec requires progress to increase with every notification
+    if (progress <= call.last) {
+      return;
+    }
+    call.last = progress;
+    extra.sendNotification({
+      method: "notifications/progress",
+      params: { progressToken, progress, total: total === undefined ? undefined : call.base + total, message },
+    }).catch(() => undefined);
+  };
+}
+
+// Start the call's next step after what it has reported so far, so a step
+// counting from zero, like a capture window after waiting in a queue, still
+// reports increasing progress
+export function nextProgressStep(extra?: ToolExtra): void {
+  const state = extra && reported.get(extra);
+  if (state && state.last >= 0) {
+    state.base = state.last + 1;
+  }
+}
+
+// Report once a second while work runs: elapsed seconds out of a capture
+// window, then, past the window or without one, elapsed seconds alone while
+// the result is fetched and processed. Progress starts at `from`, so steps
+// reported before the window stay in order.
+export async function duringWindow<T>(
+  report: ProgressReporter,
+  label: string,
+  seconds: number | undefined,
+  work: Promise<T>,
+  from = 0,
+): Promise<T> {
+  const started = Date.now();
+  const tick = () => {
+    const elapsed = Math.floor((Date.now() - started) / 1000);
+    if (seconds !== undefined && elapsed <= seconds) {
+      report(from + elapsed, from + seconds, `${label}: ${elapsed}/${seconds}s`);
+    } else {
+      report(from + elapsed, undefined, seconds !== undefined ? `${label}: window done, processing (${elapsed}s)` : `${label}: ${elapsed}s`);
+    }
+  };
+  tick();
+  const timer = setInterval(tick, 1000);
+  try {
+    return await work;
+  } finally {
+    clearInterval(timer);
+  }
+}
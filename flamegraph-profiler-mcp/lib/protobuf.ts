@@ -0,0 +1,172 @@
+/**
+ * Minimal protobuf wire-format reader and writer, enough for profile.proto.
+ */
+
+export const WIRE_VARINT = 0;
+export const WIRE_FIXED64 = 1;
+export const WIRE_BYTES = 2;
+export const WIRE_FIXED32 = 5;
+
+export class ProtoReader {
+  pos = 0;
+  private readonly buf: Uint8Array;
+  private readonly end: number;
+
+  constructor(buf: Uint8Array) {
+    this.buf = buf;
+    this.end = buf.length;
+  }
+
+  done(): boolean {
+    return this.pos >= this.end;
+  }
+
+  // Read a varint as a signed 64-bit number. Values beyond 2^53 lose precision;
+  // use varintBig for fields that need all 64 bits, such as addresses.
+  varint(): number {
+    let result = 0;
+    let multiplier = 1;
+    for (let i = 0; i < 7; i++) {
+      const byte = this.byte();
+      result += (byte & 0x7f) * multiplier;
+      if (byte < 0x80) {
+        return result;
+      }
+      multiplier *= 128;
+    }
+    // Long varints are negative int64s or very large values
+    this.pos -= 7;
+    return Number(BigInt.asIntN(64, this.varintBig()));
+  }
+
+  varintBig(): bigint {
+    let result = 0n;
+    let shift = 0n;
+    for (;;) {
+      const byte = this.byte();
+      result |= BigInt(byte & 0x7f) << shift;
+      if (byte < 0x80) {
+        return result;
+      }
+      shift += 7n;
+    }
+  }
+
+  // Read a field key, returning its number and wire type
+  key(): [field: number, wire: number] {
+    const key = this.varint();
+    return [Math.floor(key / 8), key & 7];
+  }
+
+  bytes(): Uint8Array {
+    const length = this.varint();
+    const start = this.pos;
+    this.pos += length;
+    if (this.pos > this.end) {
+      throw new Error("Truncated protobuf message");
+    }
+    return this.buf.subarray(start, this.pos);
+  }
+
+  // Read a repeated varint field, which may be packed or a single value
+  repeated(wire: number, into: number[]): void {
+    if (wire !== WIRE_BYTES) {
+      into.push(this.varint());
+      return;
+    }
+    const packed = this.bytes();
+    const reader = new ProtoReader(packed);
+    while (!reader.done()) {
+      into.push(reader.varint());
+    }
+  }
+
+  skip(wire: number): void {
+    switch (wire) {
+      case WIRE_VARINT:
+        this.varintBig();
+        break;
+      case WIRE_FIXED64:
+        this.pos += 8;
+        break;
+      case WIRE_BYTES:
+        this.bytes();
+        break;
+      case WIRE_FIXED32:
+        this.pos += 4;
+        break;
+      default:
+        throw new Error(`Unsupported protobuf wire type ${wire}`);
+    }
+  }
+
+  private byte(): number {
+    if (this.pos >= this.end) {
+      throw new Error("Truncated protobuf message");
+    }
+    return this.buf[this.pos++];
+  }
+}
+
+export class ProtoWriter {
+  private chunks: number[] = [];
+
+  varintField(field: number, value: number | bigint): this {
+    if (value === 0 || value === 0n) {
+      return this;
+    }
+    this.writeVarint(field * 8 + WIRE_VARINT);
+    this.writeVarint(value);
+    return this;
+  }
+
+  bytesField(field: number, bytes: Uint8Array): this {
+    this.writeVarint(field * 8 + WIRE_BYTES);
+    this.writeVarint(bytes.length);
+    for (const byte of bytes) {
+      this.chunks.push(byte);
+    }
+    return this;
+  }
+
+  stringField(field: number, value: string): this {
+    return this.bytesField(field, new TextEncoder().encode(value));
+  }
+
+  messageField(field: number, message: ProtoWriter): this {
+    return this.bytesField(field, message.finish());
+  }
+
+  packedField(field: number, values: number[]): this {
+    if (values.length === 0) {
+      return this;
+    }
+    const packed = new ProtoWriter();
+    for (const value of values) {
+      packed.writeVarint(value);
+    }
+    return this.bytesField(field, packed.finish());
+  }
+
+  finish(): Uint8Array {
+    return Uint8Array.from(this.chunks);
+  }
+
+  private writeVarint(value: number | bigint): void {
+    if (typeof value === "number" && value >= 0 && value <= Number.MAX_SAFE_INTEGER) {
+      while (value >= 0x80) {
+        this.chunks.push((value % 128) | 0x80);
+        value = Math.floor(value / 128);
+      }
+      this.chunks.push(value);
+      return;
+    }
+    // Negative numbers are encoded as 64-bit two's complement
+    let big = BigInt.asUintN(64, BigInt(value));
+    while (big >= 0x80n) {
+      this.chunks.push(Number(big & 0x7fn) | 0x80);
+      big >>= 7n;
+    }
+    this.chunks.push(Number(big));
+  }
+}
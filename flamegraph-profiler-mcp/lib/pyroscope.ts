@@ -0,0 +1,98 @@
+/**
+ * Pushing profiles to a Grafana Pyroscope server, so captures made through
+ * this server land next to the continuous profiles a team already keeps.
+ *
+ * Configured with PROFILER_PYROSCOPE_URL and, depending on the server,
+ * PROFILER_PYROSCOPE_USER and PROFILER_PYROSCOPE_PASSWORD (basic auth, as on
+ * Grafana Cloud) or PROFILER_PYROSCOPE_TOKEN (bearer), and
+ * PROFILER_PYROSCOPE_TENANT for multi-tenant servers. PROFILER_PYROSCOPE_LABELS
+ * (key=value pairs, comma-separated) are added to every push.
+ */
+import fs from "node:fs/promises";
+import { readProfile } from "./pprof.js";
+
+export interface PyroscopeConfig {
+  url: string;
+  headers: Record<string, string>;
+  // Labels added to every push, e.g. env=prod
+  labels: Record<string, string>;
+}
+
+export interface PyroscopePush {
+  // Application name with labels, as Pyroscope files the profile under
+  name: string;
+  // Time range of the profile, seconds since the epoch
+  from: number;
+  until: number;
+  bytes: number;
+  url: string;
+}
+
+// Read the Pyroscope server settings from the environment
+export function pyroscopeConfig(env: NodeJS.ProcessEnv = process.env): PyroscopeConfig {
+  const url = env.PROFILER_PYROSCOPE_URL;
+  if (!url) {
+    throw new Error("No Pyroscope server configured; set PROFILER_PYROSCOPE_URL");
+  }
+  const headers: Record<string, string> = {};
+  if (env.PROFILER_PYROSCOPE_USER || env.PROFILER_PYROSCOPE_PASSWORD) {
+    if (!env.PROFILER_PYROSCOPE_USER || !env.PROFILER_PYROSCOPE_PASSWORD) {
+      throw new Error("PROFILER_PYROSCOPE_USER and PROFILER_PYROSCOPE_PASSWORD must be set together");
+    }
+    headers.Authorization = `Basic ${Buffer.from(`${env.PROFILER_PYROSCOPE_USER}:${env.PROFILER_PYROSCOPE_PASSWORD}`).toString("base64")}`;
+  } else if (env.PROFILER_PYROSCOPE_TOKEN) {
+    headers.Authorization = `Bearer ${env.PROFILER_PYROSCOPE_TOKEN}`;
+  }
+  if (env.PROFILER_PYROSCOPE_TENANT) {
+    headers["X-Scope-OrgID"] = env.PROFILER_PYROSCOPE_TENANT;
+  }
+  const labels = Object.fromEntries((env.PROFILER_PYROSCOPE_LABELS ?? "")
+    .split(",")
+    .map((pair) => pair.trim())
+    .filter(Boolean)
+    .map((pair) => {
+      const [key, value] = pair.split("=", 2);
+      if (!value) {
+        throw new Error(`PROFILER_PYROSCOPE_LABELS: expected key=value, got "${pair}"`);
+      }
+      return [key.trim(), value.trim()];
+    }));
+  return { url: url.replace(/\/$/, ""), headers, labels };
+}
+
+// Pyroscope's name for an application with labels, e.g. api{env=prod,region=eu}.
+// Label names may only hold letters, digits, _ and ., and values none of the
+// characters that delimit them, so others are replaced by _.
+export function pyroscopeName(app: string, labels: Record<string, string> = {}): string {
+  const pairs = Object.entries(labels)
+    .map(([key, value]) => `${key.replace(/[^\w.]/g, "_").replace(/^(?=\d)/, "_")}=${value.replace(/[,{}=\s]/g, "_")}`)
+    .sort();
+  return `${app.replace(/[{},=\s]/g, "_")}{${pairs.join(",")}}`;
+}
+
+// Upload a pprof file to Pyroscope's ingest endpoint under an application
+// name with labels. The time range is the profile's own, or ends now when it
+// records no start.
+export async function pushToPyroscope(
+  file: string,
+  app: string,
+  labels: Record<string, string> = {},
+  config: PyroscopeConfig = pyroscopeConfig(),
+): Promise<PyroscopePush> {
+  const profile = readProfile(file);
+  const content = await fs.readFile(file);
+  // Heap and goroutine profiles are instants; Pyroscope wants a range
+  const duration = Math.max(Math.round(profile.durationSeconds ?? 0), 1);
+  const from = profile.timeNanos ? Math.floor(profile.timeNanos / 1e9) : Math.floor(Date.now() / 1000) - duration;
+  const until = from + duration;
+  const name = pyroscopeName(app, { ...config.labels, ...labels });
+  const url = `${config.url}/ingest?${new URLSearchParams({ name, from: String(from), until: String(until), format: "pprof" })}`;
+
+  const form = new FormData();
+  form.append("profile", new Blob([new Uint8Array(content)]), "profile.pb.gz");
+  const response = await fetch(url, { method: "POST", headers: config.headers, body: form });
+  if (!response.ok) {
+    throw new Error(`Pyroscope ingest returned ${response.status}: ${(await response.text()).slice(0, 200)}`);
+  }
+  return { name, from, until, bytes: content.length, url: config.url };
+}
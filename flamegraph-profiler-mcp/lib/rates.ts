@@ -0,0 +1,91 @@
+/**
+ * Rates for comparing profiles captured over different windows or under
+ * different load: totals per second of capture, or per request served, where
+ * the target counts its requests (pkg/requests) and the capture recorded the
+ * count in the profile's "requests" label. Shares of the total hide growth
+ * that is spread evenly, and raw totals grow with the window and the load;
+ * rates show both what changed and by how much.
+ */
+import path from "node:path";
+import { getProfile, isProfileId, listProfiles } from "./catalog.js";
+import { formatValue, type Profile } from "./pprof.js";
+import { REQUESTS_LABEL, ROUTE_REQUESTS_PREFIX } from "./target.js";
+
+export const NORMALIZATIONS = ["share", "second", "request"] as const;
+export type Normalization = (typeof NORMALIZATIONS)[number];
+
+// Sample types that hold a moment rather than a total over the capture
+const SNAPSHOT_TYPES = new Set(["inuse_space", "inuse_objects", "goroutine"]);
+
+export interface RateBasis {
+  per: "second" | "request";
+  // Seconds or requests each profile covers
+  baseline: number;
+  comparison: number;
+}
+
+// Catalog labels of a profile. Paths find the entry of the stored file they
+// name; other files have none.
+async function labelsOf(ref: string): Promise<Record<string, string>> {
+  const entry = isProfileId(ref)
+    ? await getProfile(ref)
+    : (await listProfiles()).find((e) => e.path === path.resolve(ref));
+  return entry?.labels ?? {};
+}
+
+// Requests a profile covers, from its catalog entry's label
+export async function requestsOf(ref: string): Promise<number | undefined> {
+  const count = Number((await labelsOf(ref))[REQUESTS_LABEL]);
+  return Number.isFinite(count) && count > 0 ? count : undefined;
+}
+
+// Requests a profile covers on each route, from its catalog entry's
+// requests:<route> labels
+export async function routeRequestsOf(ref: string): Promise<Record<string, number>> {
+  const routes: Record<string, number> = {};
+  for (const [key, value] of Object.entries(await labelsOf(ref))) {
+    const count = Number(value);
+    if (key.startsWith(ROUTE_REQUESTS_PREFIX) && Number.isFinite(count) && count > 0) {
+      routes[key.slice(ROUTE_REQUESTS_PREFIX.length)] = count;
+    }
+  }
+  return routes;
+}
+
+// Seconds or requests each profile covers, for comparing rates of sampleType;
+// explicit request counts win over labels
+export async function rateBasis(
+  per: RateBasis["per"],
+  sampleType: string,
+  baseline: { ref: string; profile: Profile; requests?: number },
+  comparison: { ref: string; profile: Profile; requests?: number },
+): Promise<RateBasis> {
+  if (SNAPSHOT_TYPES.has(sampleType)) {
+    throw new Error(`${sampleType} is a snapshot, not a total over the capture, so it has no rate; compare shares, or a total such as alloc_space`);
+  }
+  const coverage = async (side: typeof baseline, name: string): Promise<number> => {
+    if (per === "second") {
+      if (!side.profile.durationSeconds) {
+        throw new Error(`The ${name} profile records no capture duration; CPU profiles and delta profiles (?seconds=) do, heap snapshots do not`);
+      }
+      return side.profile.durationSeconds;
+    }
+    const requests = side.requests ?? (await requestsOf(side.ref));
+    if (!requests) {
+      throw new Error(`No request count for the ${name} profile; pass ${name}Requests, label it ${REQUESTS_LABEL}=<count> with tag_profile, or capture from a target that serves pkg/requests' count`);
+    }
+    return requests;
+  };
+  return { per, baseline: await coverage(baseline, "baseline"), comparison: await coverage(comparison, "comparison") };
+}
+
+export function perLabel(per: RateBasis["per"]): string {
+  return per === "second" ? "/s" : "/req";
+}
+
+// A rate in the profile's unit per second or request; small counts keep
+// their significant digits
+export function formatRate(value: number, unit: string, per: RateBasis["per"]): string {
+  const text = formatValue(value, unit);
+  return `${text === "0" && value !== 0 ? Number(value.toPrecision(3)) : text}${perLabel(per)}`;
+}
@@ -0,0 +1,199 @@
+/**
+ * Redaction of profiles before they are shared: absolute source and binary
+ * paths, usernames embedded in paths, build IDs and chosen label values are
+ * stripped from a copy, so a production profile can go to a vendor, a public
+ * issue or an LLM without the machine layout it was captured on. Function
+ * names (bar home directories in native frame names), line numbers and sample
+ * values are kept, so the redacted profile renders and compares like the
+ * original.
+ */
+import { createHash, randomBytes } from "node:crypto";
+import path from "node:path";
+import { baselineKind, profileCommit } from "./baselines.js";
+import { catalogProfile, getProfile, isProfileId, resolveProfilePath, type CatalogEntry } from "./catalog.js";
+import { readProfile, writeProfile, type Location, type Profile } from "./pprof.js";
+import { storedProfilePath } from "./store.js";
+
+export interface RedactOptions {
+  // Trim absolute source paths and reduce binary paths to their file name
+  paths?: boolean;
+  // Replace home directories left in frame names, paths, comments and label values with ~
+  usernames?: boolean;
+  // Clear the build IDs of mappings
+  buildIds?: boolean;
+  // Label keys whose values are replaced by a salted hash; "*" for every label
+  labels?: string[];
+}
+
+export interface RedactReport {
+  // Distinct source files whose paths were trimmed
+  files: number;
+  // Mappings whose binary path was reduced to its file name
+  mappings: number;
+  buildIds: number;
+  // Distinct frame names, paths, comments and label values a username was removed from
+  usernames: number;
+  // Redacted label values by key
+  labels: Record<string, number>;
+}
+
+// Home directories on Linux, macOS and Windows, also at the start of a
+// trimmed path ("home/alice/...")
+const HOME_DIR = /(?:^|\/)(?:home|Users)\/[^/\s]+|[A-Za-z]:\\Users\\[^\\\s]+/g;
+
+// Where the Go toolchain and module cache keep sources, with what follows
+// them being the import path
+const GO_ROOTS = [/\/pkg\/mod\/(.+)$/, /\/go\/src\/(.+)$/, /\/libexec\/src\/(.+)$/];
+
+const isAbsolute = (file: string) => file.startsWith("/") || /^[A-Za-z]:[\\/]/.test(file);
+
+// Trim absolute source paths to what identifies the file without the machine:
+// module cache and GOROOT files to their import path, and the remaining files
+// to their path below the directory they all share, like `go build -trimpath`.
+// Relative paths are left as they are.
+function trimSourcePaths(files: string[]): Map<string, string> {
+  const trimmed = new Map<string, string>();
+  const local: string[] = [];
+  for (const file of new Set(files)) {
+    if (!isAbsolute(file)) {
+      continue;
+    }
+    const normalized = file.replace(/\\/g, "/");
+    const root = GO_ROOTS.map((pattern) => normalized.match(pattern)).find((match) => match);
+    if (root) {
+      trimmed.set(file, root[1]);
+    } else {
+      local.push(file);
+    }
+  }
+  let common: string[] | undefined;
+  for (const file of local) {
+    const dir = path.posix.dirname(file.replace(/\\/g, "/")).split("/");
+    const differs = common ? common.findIndex((part, i) => part !== dir[i]) : -1;
+    common = !common ? dir : differs === -1 ? common : common.slice(0, differs);
+  }
+  for (const file of local) {
+    const parts = file.replace(/\\/g, "/").split("/");
+    // Keep at least the file's directory, so the main.go files of different
+    // commands stay apart, and never the leading / or drive
+    const keep = Math.min(common?.length ?? 0, parts.length - 2);
+    trimmed.set(file, parts.slice(Math.max(keep, 1)).join("/"));
+  }
+  return trimmed;
+}
+
+export type RedactChangeKind = "frame" | "file" | "mapping" | "buildId" | "comment" | "label";
+
+// One distinct value redaction changed, with how often it occurs: in how
+// many locations for frames and files, and in how many samples for labels
+export interface RedactChange {
+  kind: RedactChangeKind;
+  // Label key, for label changes
+  key?: string;
+  before: string;
+  after: string;
+  count: number;
+}
+
+// A redacted copy of a profile, with what was removed and every distinct
+// value that changed
+export function redactProfile(
+  profile: Profile,
+  options: RedactOptions = {},
+): { profile: Profile; report: RedactReport; changes: RedactChange[] } {
+  const { paths = true, usernames = true, buildIds = true, labels = [] } = options;
+  const report: RedactReport = { files: 0, mappings: 0, buildIds: 0, usernames: 0, labels: {} };
+  const changes = new Map<string, RedactChange>();
+  const record = (kind: RedactChangeKind, before: string, after: string, key?: string) => {
+    if (before === after) return after;
+    const id = `${kind}\u0000${key ?? ""}\u0000${before}`;
+    const change = changes.get(id) ?? { kind, ...(key !== undefined ? { key } : {}), before, after, count: 0 };
+    change.count++;
+    changes.set(id, change);
+    return after;
+  };
+
+  const scrubbed = new Map<string, string>();
+  const scrub = (text: string) => {
+    if (!usernames) return text;
+    let result = scrubbed.get(text);
+    if (result === undefined) {
+      result = text.replace(HOME_DIR, "~");
+      scrubbed.set(text, result);
+      if (result !== text) report.usernames++;
+    }
+    return result;
+  };
+
+  const files = [...profile.locations.values()].flatMap((location) => location.frames.map((frame) => frame.file).filter(Boolean));
+  const trimmed = paths ? trimSourcePaths(files) : new Map<string, string>();
+  report.files = trimmed.size;
+  const locations = new Map<number, Location>();
+  for (const [id, location] of profile.locations) {
+    locations.set(id, {
+      ...location,
+      frames: location.frames.map((frame) => ({
+        ...frame,
+        // Native and perf frames can be named after the file they are in
+        name: record("frame", frame.name, scrub(frame.name)),
+        file: record("file", frame.file, scrub(trimmed.get(frame.file) ?? frame.file)),
+      })),
+    });
+  }
+
+  const mappings = profile.mappings.map((mapping) => {
+    const trim = paths && isAbsolute(mapping.file);
+    const file = trim ? path.basename(mapping.file.replace(/\\/g, "/")) : scrub(mapping.file);
+    if (trim) report.mappings++;
+    if (buildIds && mapping.buildId) report.buildIds++;
+    return {
+      ...mapping,
+      file: record("mapping", mapping.file, file),
+      buildId: record("buildId", mapping.buildId, buildIds ? "" : mapping.buildId, mapping.file),
+    };
+  });
+
+  // Salted per redaction, so equal values stay equal within the profile but
+  // cannot be recovered by hashing guesses
+  const salt = randomBytes(16);
+  const redactValue = (key: string, value: string) => {
+    report.labels[key] = (report.labels[key] ?? 0) + 1;
+    return `redacted-${createHash("sha256").update(salt).update(value).digest("hex").slice(0, 8)}`;
+  };
+  const redactAll = labels.includes("*");
+  const samples = profile.samples.map((sample) => ({
+    ...sample,
+    labels: Object.fromEntries(Object.entries(sample.labels).map(([key, value]) =>
+      [key, record("label", value, redactAll || labels.includes(key) ? redactValue(key, value) : scrub(value), key)])),
+  }));
+  const comments = profile.comments?.map((comment) => record("comment", comment, scrub(comment)));
+
+  return {
+    profile: { ...profile, samples, locations, mappings, comments },
+    report,
+    changes: [...changes.values()],
+  };
+}
+
+// Redact a catalogued profile or file into a new catalog entry labeled
+// redacted=true; the original is left as it was
+export async function redactIntoCatalog(
+  ref: string,
+  options: RedactOptions = {},
+): Promise<{ entry: CatalogEntry; profile: Profile; report: RedactReport }> {
+  const source = isProfileId(ref) ? await getProfile(ref) : undefined;
+  const { profile, report } = redactProfile(readProfile(await resolveProfilePath(ref)), options);
+  const target = source?.target ?? path.resolve(ref);
+  const profileType = source?.profileType ?? baselineKind(profile);
+  const name = path.basename(target).replace(/\.pb(\.gz)?$|\.pprof$|\.prof$|\.go$/, "");
+  const stored = await storedProfilePath(`${name}_${profileType}_redacted`);
+  writeProfile(stored, profile);
+  const entry = await catalogProfile(stored, {
+    target,
+    profileType,
+    commit: profileCommit(profile),
+    redactedFrom: source?.id ?? path.resolve(ref),
+    labels: { ...source?.labels, redacted: "true" },
+  });
+  return { entry, profile, report };
+}
@@ -0,0 +1,119 @@
+/**
+ * Regression detection between two profiles of a target: functions whose flat
+ * or cumulative share grew beyond a threshold, with a confidence level from a
+ * two-proportion z-test on their sample counts, so growth that is within
+ * sampling noise of a short capture is not reported as a regression.
+ */
+import { alignClosures } from "./closures.js";
+import { functionDeltas, type FunctionDelta } from "./diff.js";
+import { functionStats } from "./flamegraph.js";
+import { sampleIndexOf, totalOf, type Profile } from "./pprof.js";
+
+export type Confidence = "low" | "medium" | "high";
+
+export const CONFIDENCE_LEVELS: readonly Confidence[] = ["low", "medium", "high"];
+
+export interface Regression extends FunctionDelta {
+  // The share that grew beyond the threshold; flat wins when both did
+  measure: "flat" | "cum";
+  // Sample counts of the function by that measure
+  baselineCount: number;
+  comparisonCount: number;
+  zScore: number;
+  confidence: Confidence;
+}
+
+export interface RegressionReport {
+  sampleType: string;
+  unit: string;
+  // Sample counts of the whole profiles
+  baselineCount: number;
+  comparisonCount: number;
+  thresholdPts: number;
+  regressions: Regression[];
+}
+
+// Index of the sample type counting events behind a value type: samples for
+// CPU time, objects for bytes, contentions for delay. Falls back to the value
+// type itself, which makes the test approximate for non-count types.
+function countIndexOf(profile: Profile, sampleIndex: number): number {
+  const type = profile.sampleTypes[sampleIndex];
+  if (type.unit === "count") {
+    return sampleIndex;
+  }
+  const prefix = type.type.split("_")[0];
+  const sibling = profile.sampleTypes.findIndex((t) => t.unit === "count" && t.type.startsWith(`${prefix}_`));
+  if (sibling !== -1) {
+    return sibling;
+  }
+  const anyCount = profile.sampleTypes.findIndex((t) => t.unit === "count");
+  return anyCount !== -1 ? anyCount : sampleIndex;
+}
+
+// z-score of the growth from x1 of n1 to x2 of n2 events
+function twoProportionZ(x1: number, n1: number, x2: number, n2: number): number {
+  if (n1 === 0 || n2 === 0) {
+    return 0;
+  }
+  const pooled = (x1 + x2) / (n1 + n2);
+  const se = Math.sqrt(pooled * (1 - pooled) * (1 / n1 + 1 / n2));
+  return se === 0 ? 0 : (x2 / n2 - x1 / n1) / se;
+}
+
+function confidenceOf(z: number): Confidence {
+  return z >= 3 ? "high" : z >= 2 ? "medium" : "low";
+}
+
+export function detectRegressions(
+  baselineProfile: Profile,
+  comparisonProfile: Profile,
+  options: { thresholdPts: number; sampleType?: string; measure?: "flat" | "cum" | "both" },
+): RegressionReport {
+  const [baseline, comparison] = alignClosures(baselineProfile, comparisonProfile);
+  const measure = options.measure ?? "both";
+  const comparisonIndex = sampleIndexOf(comparison, options.sampleType);
+  const type = comparison.sampleTypes[comparisonIndex];
+  const baselineIndex = sampleIndexOf(baseline, type.type);
+
+  const deltas = functionDeltas(
+    baseline, baselineIndex, totalOf(baseline, baselineIndex),
+    comparison, comparisonIndex, totalOf(comparison, comparisonIndex),
+  );
+
+  const baselineCountIndex = countIndexOf(baseline, baselineIndex);
+  const comparisonCountIndex = countIndexOf(comparison, comparisonIndex);
+  const baselineCount = totalOf(baseline, baselineCountIndex);
+  const comparisonCount = totalOf(comparison, comparisonCountIndex);
+  const before = new Map(functionStats(baseline, baselineCountIndex).map((s) => [s.name, s]));
+  const after = new Map(functionStats(comparison, comparisonCountIndex).map((s) => [s.name, s]));
+
+  const regressions = deltas.flatMap((delta): Regression[] => {
+    const grew = (m: "flat" | "cum") =>
+      (measure === "both" || measure === m) && (m === "flat" ? delta.flatDeltaPct : delta.cumDeltaPct) >= options.thresholdPts;
+    const by = grew("flat") ? "flat" : grew("cum") ? "cum" : undefined;
+    if (!by) {
+      return [];
+    }
+    const x1 = before.get(delta.name)?.[by] ?? 0;
+    const x2 = after.get(delta.name)?.[by] ?? 0;
+    const zScore = Math.round(twoProportionZ(x1, baselineCount, x2, comparisonCount) * 100) / 100;
+    return [{ ...delta, measure: by, baselineCount: x1, comparisonCount: x2, zScore, confidence: confidenceOf(zScore) }];
+  });
+
+  return {
+    sampleType: type.type,
+    unit: type.unit,
+    baselineCount,
+    comparisonCount,
+    thresholdPts: options.thresholdPts,
+    regressions: regressions.sort((a, b) =>
+      (b.measure === "flat" ? b.flatDeltaPct : b.cumDeltaPct) - (a.measure === "flat" ? a.flatDeltaPct : a.cumDeltaPct)),
+  };
+}
+
+export function formatRegression(r: Regression): string {
+  const [before, after, delta] = r.measure === "flat"
+    ? [r.baselineFlatPct, r.comparisonFlatPct, r.flatDeltaPct]
+    : [r.baselineCumPct, r.comparisonCumPct, r.cumDeltaPct];
+  return `${r.name} grew from ${before}% to ${after}% ${r.measure} (+${delta} pts; ${r.confidence} confidence, ${r.baselineCount} → ${r.comparisonCount} samples)`;
+}
@@ -0,0 +1,192 @@
+/**
+ * Rendering catalogued profiles as standalone SVG or HTML flamegraphs,
+ * interactive d3-flame-graph pages, or text outlines for clients without
+ * images, served as MCP resources so clients can display them inline. Frames
+ * link to their source when the server config maps it (see sourcelinks.ts).
+ */
+import type { ResourceLink } from "@modelcontextprotocol/sdk/types.js";
+import type { CatalogEntry } from "./catalog.js";
+import { flameChart, ORIENTATIONS, type Orientation } from "./charts.js";
+import { PROFILE_COLOR_SCHEMES, type ColorScheme } from "./colors.js";
+import { serverConfig } from "./config.js";
+import { buildFlameTree, describeFlameTree, flameOutline, invertFlameTree, topFunctionsOf } from "./flamegraph.js";
+import { interactiveFlamegraph } from "./interactive.js";
+import { formatValue, readProfile, sampleIndexOf } from "./pprof.js";
+import { frameLinker } from "./sourcelinks.js";
+import { applyFrameFilters, describeFrameFilters, type FrameFilters } from "./transform.js";
+
+// RFC 6570 template of flamegraph resources, e.g. flamegraph://p_3fa9c21e?view=alloc_space&format=html&color=package.
+// focus, ignore, show and hide take pprof-style regexes; mergeGenerics=true folds generic instantiations;
+// hideKernel=true drops the kernel frames of perf profiles; accessibility=true draws color-blind-safe colors
+// and embeds the tree as text.
+export const FLAMEGRAPH_URI_TEMPLATE = "flamegraph://{profileId}{?view,format,color,orientation,inverted,accessibility,focus,ignore,show,hide,mergeGenerics,hideKernel}";
+
+// How a flamegraph is drawn, as opposed to which samples it shows
+export interface FlamegraphLayout {
+  color?: ColorScheme;
+  orientation?: Orientation;
+  // Roots are the functions samples end in, with their callers above (or below) them
+  inverted?: boolean;
+  // Color-blind-safe colors, with the flamegraph also given as text
+  accessibility?: boolean;
+}
+
+export const FLAMEGRAPH_FORMATS = ["svg", "html", "interactive", "outline"] as const;
+export type FlamegraphFormat = (typeof FLAMEGRAPH_FORMATS)[number];
+
+const MIME_TYPES: Record<FlamegraphFormat, string> = {
+  svg: "image/svg+xml",
+  html: "text/html",
+  interactive: "text/html",
+  outline: "text/plain",
+};
+
+export function flamegraphUri(id: string, options: { view?: string; format?: FlamegraphFormat } & FlamegraphLayout & FrameFilters = {}): string {
+  const query = new URLSearchParams();
+  if (options.view) query.set("view", options.view);
+  if (options.format && options.format !== "svg") query.set("format", options.format);
+  if (options.color && options.color !== "classic" && options.color !== "diff") query.set("color", options.color);
+  if (options.orientation && options.orientation !== "flame") query.set("orientation", options.orientation);
+  if (options.inverted) query.set("inverted", "true");
+  if (options.accessibility) query.set("accessibility", "true");
+  for (const name of ["focus", "ignore", "show", "hide"] as const) {
+    if (options[name]) query.set(name, options[name]);
+  }
+  if (options.mergeGenerics) query.set("mergeGenerics", "true");
+  if (options.hideKernel) query.set("hideKernel", "true");
+  const search = query.toString();
+  return `flamegraph://${id}${search ? `?${search}` : ""}`;
+}
+
+export function flamegraphMimeType(format: FlamegraphFormat = "svg"): string {
+  return MIME_TYPES[format];
+}
+
+// Tool result content linking to the flamegraph of a catalogued profile
+export function flamegraphLink(id: string, options: { view?: string } & FlamegraphLayout & FrameFilters = {}): ResourceLink {
+  return {
+    type: "resource_link",
+    uri: flamegraphUri(id, options),
+    name: `${id} flamegraph`,
+    mimeType: MIME_TYPES.svg,
+  };
+}
+
+function escape(text: string): string {
+  return text.replace(/[&<>"']/g, (c) => `&#${c.charCodeAt(0)};`);
+}
+
+// Fail on a color scheme or orientation a single profile's flamegraph cannot be drawn with
+export function checkLayout(layout: FlamegraphLayout): void {
+  const { color, orientation } = layout;
+  if (color !== undefined && !(PROFILE_COLOR_SCHEMES as readonly string[]).includes(color)) {
+    throw new Error(`Unknown color scheme '${color}' (available: ${PROFILE_COLOR_SCHEMES.join(", ")}; diff coloring needs diff_flamegraph)`);
+  }
+  if (orientation !== undefined && !ORIENTATIONS.includes(orientation)) {
+    throw new Error(`Unknown orientation '${orientation}' (available: ${ORIENTATIONS.join(", ")})`);
+  }
+}
+
+// A layout with what the call left unset taken from the server config.
+// Differential flamegraphs keep their diff coloring unless one is asked for.
+export function withRenderDefaults(layout: FlamegraphLayout, diff = false): FlamegraphLayout {
+  const defaults = serverConfig().render;
+  return {
+    color: layout.color ?? (diff ? undefined : defaults.color),
+    orientation: layout.orientation ?? defaults.orientation,
+    inverted: layout.inverted ?? defaults.inverted,
+    accessibility: layout.accessibility ?? defaults.accessibility,
+  };
+}
+
+// Render a catalogued profile. The view is a sample type of the profile (e.g.
+// cpu, samples, inuse_space, alloc_space); the default is the profile's own.
+export function renderFlamegraph(
+  entry: CatalogEntry,
+  view?: string,
+  format: FlamegraphFormat = "svg",
+  filters: FrameFilters = {},
+  layout: FlamegraphLayout = {},
+): { mimeType: string; text: string } {
+  const { color = "classic", orientation = "flame", inverted = false, accessibility = false } = withRenderDefaults(layout);
+  if (!FLAMEGRAPH_FORMATS.includes(format)) {
+    throw new Error(`Unknown format '${format}' (available: ${FLAMEGRAPH_FORMATS.join(", ")})`);
+  }
+  checkLayout({ color, orientation });
+  const profile = applyFrameFilters(readProfile(entry.path), filters);
+  const sampleIndex = sampleIndexOf(profile, view);
+  const { type, unit } = profile.sampleTypes[sampleIndex];
+  const filtered = describeFrameFilters(filters);
+  const title = `${entry.target} · ${entry.profileType} · ${type}${inverted ? " · inverted" : ""}${filtered ? ` · ${filtered}` : ""}`;
+  const built = buildFlameTree(profile, sampleIndex);
+  const tree = inverted ? invertFlameTree(built) : built;
+  const formatFrameValue = (v: number) => (unit === "count" ? String(v) : formatValue(v, unit));
+  if (format === "outline") {
+    return { mimeType: MIME_TYPES.outline, text: `${title}\n\n${flameOutline(tree, { formatValue: formatFrameValue }).join("\n")}\n` };
+  }
+  const outline = accessibility ? describeFlameTree(tree, { formatValue: formatFrameValue }) : [];
+  const labels = Object.entries(entry.labels).map(([key, value]) => `${key}=${value}`).join(", ");
+  const linker = frameLinker(profile, sampleIndex, serverConfig().sources, { commit: entry.commit, sourceRoot: process.env.PROFILER_SOURCE_ROOT });
+  if (format === "interactive") {
+    return {
+      mimeType: MIME_TYPES.interactive,
+      text: interactiveFlamegraph(tree, {
+        title,
+        meta: `${entry.id} · ${entry.at}${entry.commit ? ` · commit ${entry.commit.slice(0, 12)}` : ""}${labels ? ` · ${labels}` : ""}`,
+        formatValue: formatFrameValue,
+        colorScheme: color,
+        orientation,
+        accessibility,
+        description: accessibility ? outline.join("\n") : undefined,
+        link: linker && ((frame) => linker(frame.name)),
+      }),
+    };
+  }
+  const svg = flameChart(tree, {
+    title,
+    formatValue: formatFrameValue,
+    colorScheme: color,
+    orientation,
+    accessibility,
+    description: accessibility ? outline.join("\n") : undefined,
+    link: linker && ((frame) => linker(frame.name)?.url),
+  });
+  if (format === "svg") {
+    return { mimeType: MIME_TYPES.svg, text: svg };
+  }
+
+  const rows = topFunctionsOf(profile, sampleIndex, 10)
+    .map((f) => {
+      const source = linker?.(f.name);
+      const name = source ? `<a href="${escape(source.url)}" target="_blank" title="${escape(source.where)}">${escape(f.name)}</a>` : escape(f.name);
+      return `<tr><td>${name}</td><td>${f.percentage}%</td></tr>`;
+    })
+    .join("");
+  const views = profile.sampleTypes
+    .map((t) => (t.type === type ? `<b>${escape(t.type)}</b>` : `<a href="${escape(flamegraphUri(entry.id, { ...filters, ...layout, view: t.type, format: "html" }))}">${escape(t.type)}</a>`))
+    .join(" · ");
+  const html = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>${escape(title)}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 16px; color: #222; }
+svg { max-width: 100%; height: auto; }
+table { border-collapse: collapse; margin-top: 12px; }
+th, td { padding: 2px 12px 2px 0; text-align: left; }
+td { font-family: monospace; }
+.meta { color: #555; }
+</style>
+</head>
+<body>
+<h1>${escape(entry.id)}: ${escape(entry.profileType)} profile of ${escape(entry.target)}</h1>
+<p class="meta">${escape(entry.at)}${entry.commit ? ` · commit ${escape(entry.commit.slice(0, 12))}` : ""}${labels ? ` · ${escape(labels)}` : ""}</p>
+<p class="meta">Views: ${views}</p>
+${svg}
+<table><thead><tr><th scope="col">Function</th><th scope="col">Self</th></tr></thead><tbody>${rows}</tbody></table>
+${accessibility ? `<h2>Flamegraph as text</h2>\n<pre>${escape(outline.join("\n"))}</pre>\n` : ""}</body>
+</html>
+`;
+  return { mimeType: MIME_TYPES.html, text: html };
+}
@@ -0,0 +1,251 @@
+/**
+ * Costs per request by route: the CPU time and allocated bytes each route
+ * spends on one request, from a CPU profile whose samples carry a route label
+ * (pprof.Do, or pkg/requests' Route and Do), an allocation profile, and the
+ * requests each route served while they were captured. Go labels no heap
+ * samples, so allocations are charged to a route through its entry frame:
+ * of the functions on its labelled CPU samples and on no other route's, the
+ * one on most of them, preferring those called under pprof.Do, which set the
+ * label: typically its handler. Allocations of goroutines a
+ * route starts, which inherit its label but not its stack, go uncharged. Profiles from other
+ * profilers that label allocation samples are split by the label itself.
+ */
+import { percentOf } from "./flamegraph.js";
+import { sampleIndexOf, stackOf, toBaseUnit, type Profile } from "./pprof.js";
+
+// Share of a route's labelled CPU its entry frame must be on at least; the
+// rest is mostly goroutines the route started
+const ENTRY_COVERAGE = 0.25;
+
+// Function that sets labels for the calls under it
+const PPROF_DO = "runtime/pprof.Do";
+
+export interface RouteCost {
+  route: string;
+  // From the CPU profile: requests served in its window, CPU time per
+  // request and the route's share of the profiled CPU
+  cpuRequests?: number;
+  cpuNsPerRequest?: number;
+  cpuPct?: number;
+  // From the allocation profile, likewise
+  allocRequests?: number;
+  allocBytesPerRequest?: number;
+  allocObjectsPerRequest?: number;
+  allocPct?: number;
+  // Frame allocations were charged to the route through
+  entry?: string;
+}
+
+export interface RouteCostReport {
+  routeLabel: string;
+  routes: RouteCost[];
+  // CPU samples without the route label, as a share of the profile's total
+  unlabeledCpuPct?: number;
+  // Allocations charged to no route, as a share of the profile's total
+  unattributedAllocPct?: number;
+  allocAttribution?: "labels" | "entry frames";
+  // Routes in the CPU profile without an entry frame, whose allocations stay
+  // unattributed
+  noEntry?: string[];
+  // Routes with samples but no request count, so no cost per request
+  uncounted: string[];
+}
+
+export interface RouteCostChange {
+  route: string;
+  baseline?: RouteCost;
+  comparison?: RouteCost;
+  // Change of the cost per request, percent
+  cpuChangePct?: number;
+  allocChangePct?: number;
+}
+
+// A profile with the requests each route served while it was captured
+export interface RouteCostInput {
+  profile: Profile;
+  requests: Record<string, number>;
+}
+
+function round(value: number, digits = 1): number {
+  const scale = 10 ** digits;
+  return Math.round(value * scale) / scale;
+}
+
+// Each route's entry frame, learned from a route-labelled CPU profile: of the
+// functions on at least ENTRY_COVERAGE of the route's CPU and on none of
+// another route's, one called under pprof.Do over one in a goroutine the
+// route started, then the one on most of it, then the closest to the root
+export function routeEntryFrames(profile: Profile, sampleIndex: number, routeLabel: string): Map<string, string> {
+  const totals = new Map<string, number>();
+  const onStack = new Map<string, Map<string, { value: number; depth: number; underDo: boolean }>>();
+  const owners = new Map<string, Set<string>>();
+  for (const sample of profile.samples) {
+    const route = sample.labels[routeLabel];
+    const value = sample.values[sampleIndex];
+    if (route === undefined || value === 0) {
+      continue;
+    }
+    totals.set(route, (totals.get(route) ?? 0) + value);
+    if (!onStack.has(route)) {
+      onStack.set(route, new Map());
+    }
+    const functions = onStack.get(route)!;
+    const seen = new Set<string>();
+    const stack = stackOf(profile, sample);
+    const labelledAt = stack.lastIndexOf(PPROF_DO);
+    stack.forEach((name, depth) => {
+      if (seen.has(name)) {
+        return;
+      }
+      seen.add(name);
+      const stat = functions.get(name) ?? { value: 0, depth, underDo: false };
+      functions.set(name, { value: stat.value + value, depth: Math.min(stat.depth, depth), underDo: stat.underDo || (labelledAt !== -1 && depth > labelledAt) });
+      if (!owners.has(name)) {
+        owners.set(name, new Set());
+      }
+      owners.get(name)!.add(route);
+    });
+  }
+  const entries = new Map<string, string>();
+  for (const [route, functions] of onStack) {
+    const total = totals.get(route)!;
+    const [entry] = [...functions.entries()]
+      .filter(([name, stat]) => owners.get(name)!.size === 1 && stat.value >= total * ENTRY_COVERAGE)
+      .sort((a, b) => Number(b[1].underDo) - Number(a[1].underDo) || b[1].value - a[1].value || a[1].depth - b[1].depth);
+    if (entry) {
+      entries.set(route, entry[0]);
+    }
+  }
+  return entries;
+}
+
+// Costs per request by route of a CPU profile, an allocation profile or both,
+// taken over the same window or not. Allocations need the CPU profile to find
+// the routes' entry frames unless their own samples carry the route label.
+export function routeCosts(options: { cpu?: RouteCostInput; alloc?: RouteCostInput; routeLabel: string }): RouteCostReport {
+  const { cpu, alloc, routeLabel } = options;
+  const costs = new Map<string, RouteCost>();
+  const costOf = (route: string): RouteCost => {
+    if (!costs.has(route)) {
+      costs.set(route, { route });
+    }
+    return costs.get(route)!;
+  };
+  const report: RouteCostReport = { routeLabel, routes: [], uncounted: [] };
+
+  let entries = new Map<string, string>();
+  if (cpu) {
+    const index = sampleIndexOf(cpu.profile, "cpu");
+    const { unit } = cpu.profile.sampleTypes[index];
+    const byRoute = new Map<string, number>();
+    let total = 0;
+    let unlabeled = 0;
+    for (const sample of cpu.profile.samples) {
+      const value = sample.values[index];
+      const route = sample.labels[routeLabel];
+      total += value;
+      if (route === undefined) {
+        unlabeled += value;
+      } else {
+        byRoute.set(route, (byRoute.get(route) ?? 0) + value);
+      }
+    }
+    if (total > 0 && unlabeled === total) {
+      throw new Error(`No samples in the CPU profile carry a '${routeLabel}' label; serve routes through requests.Route, or wrap handlers in pprof.Do(ctx, pprof.Labels("${routeLabel}", route), ...)`);
+    }
+    report.unlabeledCpuPct = percentOf(unlabeled, total);
+    for (const [route, value] of byRoute) {
+      const cost = costOf(route);
+      cost.cpuPct = percentOf(value, total);
+      const requests = cpu.requests[route];
+      if (requests) {
+        cost.cpuRequests = requests;
+        cost.cpuNsPerRequest = Math.round((toBaseUnit(value, unit) * 1e9) / requests);
+      }
+    }
+    entries = routeEntryFrames(cpu.profile, index, routeLabel);
+  }
+
+  if (alloc) {
+    const bytesIndex = sampleIndexOf(alloc.profile, "alloc_space");
+    const objectsIndex = alloc.profile.sampleTypes.findIndex((t) => t.type === "alloc_objects");
+    const labelled = alloc.profile.samples.some((s) => s.labels[routeLabel] !== undefined);
+    if (!labelled && entries.size === 0) {
+      throw new Error(cpu
+        ? "Found no route's entry frame in the CPU profile (a function on a good part of one route's samples and on no other's), so allocations cannot be charged to routes"
+        : `The allocation profile's samples carry no '${routeLabel}' label, as Go's never do; add a route-labelled CPU profile (profilePath) to charge allocations to routes through their entry frames`);
+    }
+    report.allocAttribution = labelled ? "labels" : "entry frames";
+    if (!labelled) {
+      report.noEntry = [...costs.keys()].filter((route) => !entries.has(route));
+    }
+    const routeOfEntry = new Map([...entries].map(([route, name]) => [name, route]));
+    const bytes = new Map<string, number>();
+    const objects = new Map<string, number>();
+    let total = 0;
+    let unattributed = 0;
+    for (const sample of alloc.profile.samples) {
+      const value = sample.values[bytesIndex];
+      total += value;
+      const route = labelled
+        ? sample.labels[routeLabel]
+        : routeOfEntry.get(stackOf(alloc.profile, sample).find((name) => routeOfEntry.has(name)) ?? "");
+      if (route === undefined) {
+        unattributed += value;
+        continue;
+      }
+      bytes.set(route, (bytes.get(route) ?? 0) + value);
+      objects.set(route, (objects.get(route) ?? 0) + (objectsIndex === -1 ? 0 : sample.values[objectsIndex]));
+    }
+    report.unattributedAllocPct = percentOf(unattributed, total);
+    for (const [route, value] of bytes) {
+      const cost = costOf(route);
+      cost.allocPct = percentOf(value, total);
+      if (!labelled) {
+        cost.entry = entries.get(route);
+      }
+      const requests = alloc.requests[route];
+      if (requests) {
+        cost.allocRequests = requests;
+        cost.allocBytesPerRequest = Math.round(value / requests);
+        if (objectsIndex !== -1) {
+          const perRequest = objects.get(route)! / requests;
+          cost.allocObjectsPerRequest = perRequest < 10 ? round(perRequest) : Math.round(perRequest);
+        }
+      }
+    }
+  }
+
+  report.routes = [...costs.values()].sort((a, b) => (b.cpuPct ?? 0) - (a.cpuPct ?? 0) || (b.allocPct ?? 0) - (a.allocPct ?? 0));
+  report.uncounted = report.routes
+    .filter((r) => (r.cpuPct !== undefined && r.cpuRequests === undefined) || (r.allocPct !== undefined && r.allocRequests === undefined))
+    .map((r) => r.route);
+  return report;
+}
+
+function changePct(baseline: number | undefined, comparison: number | undefined): number | undefined {
+  return baseline && comparison !== undefined ? round(((comparison - baseline) / baseline) * 100) : undefined;
+}
+
+// How each route's costs per request moved between two reports, the largest
+// CPU increases first, then routes only one side has
+export function diffRouteCosts(baseline: RouteCostReport, comparison: RouteCostReport): RouteCostChange[] {
+  const before = new Map(baseline.routes.map((r) => [r.route, r]));
+  const after = new Map(comparison.routes.map((r) => [r.route, r]));
+  const routes = [...new Set([...before.keys(), ...after.keys()])];
+  return routes
+    .map((route): RouteCostChange => {
+      const b = before.get(route);
+      const c = after.get(route);
+      return {
+        route,
+        baseline: b,
+        comparison: c,
+        cpuChangePct: changePct(b?.cpuNsPerRequest, c?.cpuNsPerRequest),
+        allocChangePct: changePct(b?.allocBytesPerRequest, c?.allocBytesPerRequest),
+      };
+    })
+    .sort((a, b) =>
+      (b.cpuChangePct ?? b.allocChangePct ?? -Infinity) - (a.cpuChangePct ?? a.allocChangePct ?? -Infinity) ||
+      a.route.localeCompare(b.route));
+}
@@ -0,0 +1,96 @@
+/**
+ * The bundled sample app: build it, run it with several profiles at once and
+ * feed each profile through the same analysis as profile-app.
+ */
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { headCommit } from "./baselines.js";
+import { analyzeRunProfile, type RunProfile } from "./build.js";
+import { buildGoAppAsync, PROFILE_FLAGS, runGoAppAsync, type ProfileType } from "./goapp.js";
+
+// sample-app/ next to the server sources, whether run from TypeScript or from dist/
+export const SAMPLE_APP_DIR = path.resolve(
+  import.meta.dirname,
+  import.meta.filename.endsWith(".ts") ? ".." : "../..",
+  "sample-app",
+);
+
+// A line of the sample app's ground-truth log of injected anomalies; start
+// and end lines of one anomaly share an ID
+export interface ChaosRecord {
+  id: number;
+  time: string;
+  kind: "cpu" | "latency";
+  phase: "start" | "end";
+  // Time since the anomalies were scheduled, as a Go duration
+  offset: string;
+  length?: string;
+  delay?: string;
+  goroutines?: number;
+}
+
+// Anomalies to inject during a run: -chaos and -chaos-random of the sample app
+export interface ChaosOptions {
+  // e.g. "cpu@10s+5s,latency@30s+3s"
+  spec?: string;
+  random?: number;
+  seed?: number;
+}
+
+export interface SampleAppRun {
+  source: string;
+  duration: number;
+  commit?: string;
+  profiles: RunProfile[];
+  // Ground truth of the anomalies injected, when any were asked for
+  chaos?: ChaosRecord[];
+}
+
+// Build the sample app and run it once with a flag per requested profile,
+// and the anomalies asked for
+export async function runSampleApp(options: {
+  duration: number;
+  profileTypes: ProfileType[];
+  chaos?: ChaosOptions;
+  signal?: AbortSignal;
+}): Promise<SampleAppRun> {
+  const source = path.join(SAMPLE_APP_DIR, "main.go");
+  const binary = path.join(os.tmpdir(), `sample-app_${Date.now()}`);
+  const files = Object.fromEntries(options.profileTypes.map((t) => [t, path.join(os.tmpdir(), `sample-app_${t}_${Date.now()}.pb.gz`)]));
+  const { spec, random = 0, seed } = options.chaos ?? {};
+  const chaosLog = spec || random > 0 ? path.join(os.tmpdir(), `sample-app_chaos_${Date.now()}.jsonl`) : undefined;
+  const flags = [
+    ...options.profileTypes.map((t) => `${PROFILE_FLAGS[t]}=${files[t]}`),
+    ...(chaosLog ? [`-chaos-log=${chaosLog}`, spec ? `-chaos=${spec.replace(/\s+/g, "")}` : "", random > 0 ? `-chaos-random=${random}` : "", seed !== undefined ? `-chaos-seed=${seed}` : ""] : []),
+  ];
+  try {
+    await buildGoAppAsync(source, binary, options.signal);
+    const started = Date.now();
+    await runGoAppAsync(binary, flags.filter(Boolean).join(" "), options.duration, options.signal);
+    const duration = (Date.now() - started) / 1000;
+    const chaos = chaosLog
+      ? (await fs.readFile(chaosLog, "utf-8")).split("\n").filter(Boolean).map((line) => JSON.parse(line) as ChaosRecord)
+      : undefined;
+
+    const commit = await headCommit(SAMPLE_APP_DIR);
+    const profiles: RunProfile[] = [];
+    for (const profileType of options.profileTypes) {
+      profiles.push(await analyzeRunProfile(files[profileType], profileType, { name: "sample-app", source, duration, commit }));
+    }
+    return { source, duration, commit, profiles, ...(chaos ? { chaos } : {}) };
+  } finally {
+    await Promise.all([binary, ...Object.values(files), ...(chaosLog ? [chaosLog] : [])].map((f) => fs.unlink(f).catch(() => undefined)));
+  }
+}
+
+// One line per injected anomaly, in the order they started, from the start
+// and end lines of the ground-truth log. The end of an anomaly cut off by
+// the end of the run may be missing.
+export function formatChaos(records: ChaosRecord[]): string[] {
+  return records.filter((r) => r.phase === "start").map((start) => {
+    const end = records.find((r) => r.id === start.id && r.phase === "end");
+    const detail = start.kind === "cpu" ? `CPU burst on ${start.goroutines} goroutine(s)` : `latency spike of +${start.delay} per iteration`;
+    return `• #${start.id} ${detail}: ${start.offset} → ${end?.offset ?? "end of run"}`;
+  });
+}
@@ -0,0 +1,95 @@
+/**
+ * Sandwich view of one function: its flat and cumulative values between the
+ * callers that reach it and the callees it spends its time in, merged across
+ * every stack it appears on.
+ */
+import { addStackToTree, percentOf, type ProfileFrame } from "./flamegraph.js";
+import { stackOf, totalOf, type Profile } from "./pprof.js";
+
+export interface FunctionDetail {
+  name: string;
+  sampleType: string;
+  unit: string;
+  total: number;
+  flat: number;
+  flatPct: number;
+  cum: number;
+  cumPct: number;
+  // Callers merged by call path, immediate callers as the root's children
+  callers: ProfileFrame;
+  // Callees merged by call path, immediate callees as the root's children;
+  // what the root's value exceeds its children by is the function's own time
+  callees: ProfileFrame;
+}
+
+// Functions to suggest when a name matches nothing exactly
+export function closestFunctions(profile: Profile, sampleIndex: number, name: string, limit = 5): string[] {
+  const cum = new Map<string, number>();
+  const needle = name.toLowerCase();
+  for (const sample of profile.samples) {
+    for (const frame of new Set(stackOf(profile, sample))) {
+      if (frame.toLowerCase().includes(needle)) {
+        cum.set(frame, (cum.get(frame) ?? 0) + sample.values[sampleIndex]);
+      }
+    }
+  }
+  return [...cum.entries()].sort((a, b) => b[1] - a[1]).slice(0, limit).map(([frame]) => frame);
+}
+
+// Fold directly recursive calls into one frame
+function collapseRecursion(path: string[]): string[] {
+  return path.filter((frame, i) => i === 0 || frame !== path[i - 1]);
+}
+
+// Drop subtrees deeper than depth or lighter than minValue, heaviest first
+function prune(frame: ProfileFrame, depth: number, minValue: number): ProfileFrame {
+  const children = depth > 0
+    ? (frame.children ?? []).filter((c) => c.value >= minValue).sort((a, b) => b.value - a.value).map((c) => prune(c, depth - 1, minValue))
+    : [];
+  return { name: frame.name, value: frame.value, ...(children.length > 0 ? { children } : {}) };
+}
+
+// Sandwich of a function. Each sample counts once, split at the function's
+// outermost frame, so both trees add up to the cumulative value. Direct
+// recursion is folded away; indirect recursion shows up among the callees.
+export function functionDetail(
+  profile: Profile,
+  sampleIndex: number,
+  name: string,
+  options: { depth: number; minFraction: number },
+): FunctionDetail | undefined {
+  const callers: ProfileFrame = { name, value: 0, children: [] };
+  const callees: ProfileFrame = { name, value: 0, children: [] };
+  let flat = 0;
+  for (const sample of profile.samples) {
+    const value = sample.values[sampleIndex];
+    const stack = stackOf(profile, sample);
+    const index = stack.indexOf(name);
+    if (value === 0 || index === -1) {
+      continue;
+    }
+    addStackToTree(callers, collapseRecursion(stack.slice(0, index).reverse()), value);
+    addStackToTree(callees, collapseRecursion(stack.slice(index + 1)).filter((frame, i) => i > 0 || frame !== name), value);
+    if (stack[stack.length - 1] === name) {
+      flat += value;
+    }
+  }
+  if (callers.value === 0) {
+    return undefined;
+  }
+  const { type, unit } = profile.sampleTypes[sampleIndex];
+  const total = totalOf(profile, sampleIndex);
+  const minValue = callers.value * options.minFraction;
+  return {
+    name,
+    sampleType: type,
+    unit,
+    total,
+    flat,
+    flatPct: percentOf(flat, total),
+    cum: callers.value,
+    cumPct: percentOf(callers.value, total),
+    callers: prune(callers, options.depth, minValue),
+    callees: prune(callees, options.depth, minValue),
+  };
+}
@@ -0,0 +1,31 @@
+/**
+ * Versioned machine-readable reports. Analysis tools tag their structured
+ * content with the report it is and the schema version it follows; the
+ * schema is published in schemas/reports.v1.schema.json.
+ *
+ * Within a major version reports only gain fields: existing fields keep
+ * their names, types and meaning, and the minor version goes up with each
+ * addition. Removing, renaming or retyping a field bumps the major version
+ * and publishes a new schema file alongside the old one.
+ */
+
+export const REPORT_SCHEMA_VERSION = "1.2";
+
+export const REPORT_KINDS = [
+  "hotspots",
+  "ownership",
+  "diff",
+  "regressions",
+  "findings",
+  "finding",
+  "trends",
+  "digest",
+] as const;
+export type ReportKind = (typeof REPORT_KINDS)[number];
+
+export type Versioned<T> = { schema: ReportKind; schemaVersion: string } & T;
+
+// Tag a report with its kind and the schema version it follows
+export function versioned<T extends object>(schema: ReportKind, report: T): Versioned<T> {
+  return { schema, schemaVersion: REPORT_SCHEMA_VERSION, ...report };
+}
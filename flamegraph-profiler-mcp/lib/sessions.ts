@@ -0,0 +1,232 @@
+/**
+ * Drill-down sessions: a named working view of a profile — the sample type,
+ * the frame filters and the baseline it is compared with — that successive
+ * tool calls refine, like options set in pprof's interactive shell, instead
+ * of repeating every filter on each call. Each step is kept in the session's
+ * history, so a wrong filter can be undone without rebuilding the chain.
+ * Sessions are kept in the data directory, so they outlive the server process.
+ */
+import { resolveProfilePath } from "./catalog.js";
+import { diffProfiles, type DiffResult } from "./diff.js";
+import { buildFlameTree, describeFlameTree } from "./flamegraph.js";
+import { formatValue, readProfile, sampleIndexOf } from "./pprof.js";
+import { readJson, updateJson } from "./store.js";
+import { topReport, type TopReport } from "./top.js";
+import { applyFrameFilters, describeFrameFilters, type FrameFilters } from "./transform.js";
+
+export interface SessionState {
+  // Catalog ID or path of the profile under analysis
+  profile: string;
+  // Catalog ID or path of the profile it is compared with, if any
+  baseline?: string;
+  sampleType?: string;
+  filters: FrameFilters;
+}
+
+// One step of a session, oldest first in its history
+export interface SessionStep {
+  at: string;
+  // What the step changed, e.g. "focus=handleCheckout, hide cleared"
+  change: string;
+  // The session's state after the step
+  state: SessionState;
+}
+
+export interface Session extends SessionState {
+  name: string;
+  createdAt: string;
+  updatedAt: string;
+  // Starts with the session's start; undo steps back through it
+  history: SessionStep[];
+}
+
+// Changes to a session's state. Values replace the session's; an empty
+// string or false clears one, like `focus=` in pprof's shell, and reset
+// clears every filter before the others apply.
+export type SessionChanges = Partial<Omit<SessionState, "filters">> & FrameFilters & { reset?: boolean };
+
+export const SESSION_VIEWS = ["top", "diff", "tree"] as const;
+export type SessionView = (typeof SESSION_VIEWS)[number];
+
+export type SessionViewResult =
+  | { view: "top"; report: TopReport }
+  | { view: "diff"; diff: Omit<DiffResult, "flamegraph"> }
+  | { view: "tree"; sampleType: string; unit: string; lines: string[] };
+
+const SESSIONS_FILE = "sessions.json";
+
+// Least recently refined sessions beyond this are dropped
+const MAX_SESSIONS = 100;
+
+// Oldest steps beyond this are dropped, and can no longer be undone to
+const MAX_STEPS = 50;
+
+const FILTER_KEYS = ["focus", "ignore", "show", "hide", "mergeGenerics", "hideKernel"] as const;
+
+export async function listSessions(): Promise<Session[]> {
+  return readJson<Session[]>(SESSIONS_FILE, []);
+}
+
+export async function getSession(name: string): Promise<Session> {
+  const session = (await listSessions()).find((s) => s.name === name);
+  if (!session) {
+    throw new Error(`Session "${name}" not found; start one with start_session`);
+  }
+  return session;
+}
+
+// A session's state with changes applied
+export function applySessionChanges(state: SessionState, changes: SessionChanges): SessionState {
+  const next: SessionState = { ...state, filters: changes.reset ? {} : { ...state.filters } };
+  if (changes.profile) next.profile = changes.profile;
+  for (const key of ["baseline", "sampleType"] as const) {
+    if (changes[key] === "") delete next[key];
+    else if (changes[key] !== undefined) next[key] = changes[key];
+  }
+  for (const key of FILTER_KEYS) {
+    const value = changes[key];
+    if (value === "" || value === false) delete next.filters[key];
+    else if (value !== undefined) (next.filters as Record<string, unknown>)[key] = value;
+  }
+  return next;
+}
+
+// Short description of changes, e.g. "filters reset, focus=pipeline, baseline cleared"
+export function describeSessionChanges(changes: SessionChanges): string {
+  const parts = changes.reset ? ["filters reset"] : [];
+  for (const key of ["profile", "baseline", "sampleType", ...FILTER_KEYS] as const) {
+    const value = changes[key];
+    if (value === "" || value === false) parts.push(`${key} cleared`);
+    else if (value === true) parts.push(key);
+    else if (value !== undefined) parts.push(`${key}=${value}`);
+  }
+  return parts.join(", ") || "no change";
+}
+
+// A session's current state, without its name and history
+function stateOf(session: SessionState): SessionState {
+  return {
+    profile: session.profile,
+    ...(session.baseline ? { baseline: session.baseline } : {}),
+    ...(session.sampleType ? { sampleType: session.sampleType } : {}),
+    filters: { ...session.filters },
+  };
+}
+
+// Steps of a session; sessions saved before histories were kept start with their current state
+export function sessionHistory(session: Session): SessionStep[] {
+  return session.history ?? [{ at: session.updatedAt, change: `start on ${session.profile}`, state: stateOf(session) }];
+}
+
+// Short description of a session's state, e.g. "p_3fa9c21e vs p_1c2d3e4f · cpu · focus=pipeline"
+export function describeSession(state: SessionState): string {
+  const filters = describeFrameFilters(state.filters);
+  return [
+    `${state.profile}${state.baseline ? ` vs ${state.baseline}` : ""}`,
+    ...(state.sampleType ? [state.sampleType] : []),
+    ...(filters ? [filters] : []),
+  ].join(" · ");
+}
+
+// Render a session's working view: top functions, the diff against its
+// baseline, or the call tree (with each frame's change when there is a
+// baseline). The default is the diff with a baseline and top without.
+export async function sessionView(state: SessionState, view?: SessionView, limit = 10): Promise<SessionViewResult> {
+  const chosen = view ?? (state.baseline ? "diff" : "top");
+  const profile = applyFrameFilters(readProfile(await resolveProfilePath(state.profile)), state.filters);
+  if (chosen === "diff" && !state.baseline) {
+    throw new Error("The session has no baseline to diff against; set one with refine_session");
+  }
+  if (state.baseline && chosen !== "top") {
+    const baseline = applyFrameFilters(readProfile(await resolveProfilePath(state.baseline)), state.filters);
+    const { flamegraph, ...diff } = diffProfiles(baseline, profile, state.sampleType, limit);
+    if (chosen === "tree") {
+      return { view: "tree", sampleType: diff.sampleType, unit: diff.unit, lines: describeFlameTree(flamegraph) };
+    }
+    if (chosen === "diff") {
+      return { view: "diff", diff };
+    }
+  }
+  const sampleIndex = sampleIndexOf(profile, state.sampleType);
+  if (chosen === "tree") {
+    const { type, unit } = profile.sampleTypes[sampleIndex];
+    const formatFrameValue = (v: number) => (unit === "count" ? String(v) : formatValue(v, unit));
+    return { view: "tree", sampleType: type, unit, lines: describeFlameTree(buildFlameTree(profile, sampleIndex), { formatValue: formatFrameValue }) };
+  }
+  return { view: "top", report: topReport(profile, sampleIndex, limit) };
+}
+
+async function saveSession(session: Session): Promise<Session> {
+  return updateJson<Session[], Session>(SESSIONS_FILE, [], (all) => {
+    const index = all.findIndex((s) => s.name === session.name);
+    if (index !== -1) {
+      all.splice(index, 1);
+    }
+    all.push(session);
+    all.sort((a, b) => a.updatedAt.localeCompare(b.updatedAt));
+    all.splice(0, Math.max(0, all.length - MAX_SESSIONS));
+    return session;
+  });
+}
+
+// Start a session, replacing any of the same name, and render its view. The
+// view is rendered first, so a bad path or regex fails before it is saved.
+export async function startSession(
+  name: string,
+  state: SessionState,
+  view?: SessionView,
+  limit?: number,
+): Promise<{ session: Session; result: SessionViewResult }> {
+  const result = await sessionView(state, view, limit);
+  const now = new Date().toISOString();
+  const step: SessionStep = { at: now, change: `start on ${state.profile}`, state: stateOf(state) };
+  return { session: await saveSession({ name, ...stateOf(state), createdAt: now, updatedAt: now, history: [step] }), result };
+}
+
+// Apply changes to a session and render its new view, checked like a new one
+export async function refineSession(
+  name: string,
+  changes: SessionChanges,
+  view?: SessionView,
+  limit?: number,
+): Promise<{ session: Session; result: SessionViewResult }> {
+  const session = await getSession(name);
+  const state = stateOf(applySessionChanges(session, changes));
+  const result = await sessionView(state, view, limit);
+  const now = new Date().toISOString();
+  const history = [...sessionHistory(session), { at: now, change: describeSessionChanges(changes), state }].slice(-MAX_STEPS);
+  return { session: await saveSession({ ...session, ...state, baseline: state.baseline, sampleType: state.sampleType, updatedAt: now, history }), result };
+}
+
+// Step a session back, dropping its last steps from the history, and render
+// the view it returns to. The start cannot be undone.
+export async function undoSession(
+  name: string,
+  steps = 1,
+  view?: SessionView,
+  limit?: number,
+): Promise<{ session: Session; result: SessionViewResult; undone: SessionStep[] }> {
+  const session = await getSession(name);
+  const history = sessionHistory(session);
+  if (history.length <= 1) {
+    throw new Error(`Session "${name}" has nothing to undo`);
+  }
+  if (steps >= history.length) {
+    throw new Error(`Session "${name}" has only ${history.length - 1} step(s) to undo`);
+  }
+  const kept = history.slice(0, -steps);
+  const { state } = kept[kept.length - 1];
+  const result = await sessionView(state, view, limit);
+  const refined = { ...session, ...state, baseline: state.baseline, sampleType: state.sampleType, updatedAt: new Date().toISOString(), history: kept };
+  return { session: await saveSession(refined), result, undone: history.slice(-steps) };
+}
+
+export async function endSession(name: string): Promise<Session> {
+  return updateJson<Session[], Session>(SESSIONS_FILE, [], (all) => {
+    const index = all.findIndex((s) => s.name === name);
+    if (index === -1) {
+      throw new Error(`Session "${name}" not found`);
+    }
+    return all.splice(index, 1)[0];
+  });
+}
@@ -0,0 +1,374 @@
+/**
+ * Latency SLO checks from an execution trace, optionally with a CPU profile
+ * of the same window. Requests are runtime/trace tasks named by route
+ * (trace.NewTask(ctx, "GET /users")); their durations give each route's
+ * latency distribution. The requests over the target are the tail: where
+ * their goroutines spent that time (running, waiting for a CPU, blocked or in
+ * syscalls), and the CPU samples the trace took inside them, compared with
+ * those of requests that met the target, explain what makes them slow. A CPU
+ * profile whose samples carry a route label (pprof.Do with
+ * pprof.Labels("route", ...)) adds each route's share of the process's CPU.
+ */
+import { addStackToTree, percentOf, type ProfileFrame } from "./flamegraph.js";
+import { sampleIndexOf, totalOf, type Profile } from "./pprof.js";
+import { topReport } from "./top.js";
+import { EVENT_LINE, percentiles, type LatencyStats } from "./trace.js";
+import { filterSamples } from "./transform.js";
+import { formatNanos } from "./uprobes.js";
+
+export const SLO_PERCENTILES = ["p50", "p90", "p99"] as const;
+export type SloPercentile = (typeof SLO_PERCENTILES)[number];
+
+// Tail flamegraph depth kept in structured output
+const TAIL_DEPTH = 12;
+// Within-target samples needed to compare the tail against them
+const MIN_BASELINE_SAMPLES = 10;
+
+export type GoroutineState = "running" | "runnable" | "blocked" | "syscall";
+
+export interface TimeBreakdown {
+  // Nanoseconds in each state, summed over the requests
+  running: number;
+  runnable: number;
+  blocked: number;
+  syscall: number;
+  // Blocked time by the runtime's wait reason, largest first
+  blockedBy: Array<{ reason: string; ns: number }>;
+}
+
+export interface TailSlice {
+  function: string;
+  // Shares of stack samples with the function on the stack (cum) or at the
+  // leaf (flat), in the tail and in requests within the target
+  tailCumPct: number;
+  tailFlatPct: number;
+  withinCumPct?: number;
+  withinFlatPct?: number;
+}
+
+export interface RouteSlo {
+  route: string;
+  requests: number;
+  latency: LatencyStats;
+  // Latency at the checked percentile, nanoseconds
+  observed: number;
+  violated: boolean;
+  // Requests over the target
+  slow: number;
+  slowPct: number;
+  tail?: {
+    breakdown: TimeBreakdown;
+    // State that took most of the slow requests' time
+    dominant: GoroutineState;
+    dominantPct: number;
+    samples: number;
+    slices: TailSlice[];
+    flamegraph: ProfileFrame;
+  };
+  // From a route-labelled CPU profile
+  cpu?: { pct: number; top: Array<{ name: string; flatPct: number }> };
+}
+
+export interface SloReport {
+  targetNs: number;
+  percentile: SloPercentile;
+  routes: RouteSlo[];
+  violated: string[];
+  verdict: string;
+  // Profile samples without the route label, as a share of its total
+  unlabeledCpuPct?: number;
+}
+
+interface Request {
+  route: string;
+  goroutine: number;
+  goroutines: Set<number>;
+  start: number;
+  end?: number;
+}
+
+interface Transition {
+  time: number;
+  state: GoroutineState | "gone";
+  reason: string;
+}
+
+interface StackSample {
+  time: number;
+  goroutine: number;
+  // Leaf first
+  stack: string[];
+}
+
+interface ParsedTrace {
+  requests: Request[];
+  transitions: Map<number, Transition[]>;
+  samples: StackSample[];
+}
+
+const STATES: Record<string, GoroutineState | "gone"> = {
+  Running: "running",
+  Runnable: "runnable",
+  Waiting: "blocked",
+  Syscall: "syscall",
+  NotExist: "gone",
+};
+
+// Requests, goroutine state changes and CPU samples of a parsed trace dump
+export function parseTrace(parsed: string): ParsedTrace {
+  const lines = parsed.split("\n");
+  const tasks = new Map<string, Request>();
+  const transitions = new Map<number, Transition[]>();
+  const samples: StackSample[] = [];
+
+  for (let i = 0; i < lines.length; i++) {
+    const event = lines[i].match(EVENT_LINE);
+    if (!event) {
+      continue;
+    }
+    const [, kind, timeText, rest] = event;
+    const time = Number(timeText);
+    const goroutine = Number(lines[i].match(/ G=(-?\d+) /)?.[1] ?? -1);
+
+    if (kind === "TaskBegin") {
+      const task = rest.match(/ID=(\d+) .*Type="([^"]*)"/);
+      if (task) {
+        tasks.set(task[1], { route: task[2], goroutine, goroutines: new Set([goroutine]), start: time });
+      }
+    } else if (kind === "TaskEnd") {
+      const request = tasks.get(rest.match(/ID=(\d+)/)?.[1] ?? "");
+      if (request) {
+        request.end = time;
+      }
+    } else if (kind === "RegionBegin") {
+      // Goroutines working for a request mark their regions with its task
+      tasks.get(rest.match(/Task=(\d+)/)?.[1] ?? "")?.goroutines.add(goroutine);
+    } else if (kind === "StateTransition") {
+      const transition = rest.match(/GoID=(\d+) \w+->(\w+) Reason="([^"]*)"/);
+      const state = transition && STATES[transition[2]];
+      if (state) {
+        const id = Number(transition[1]);
+        if (!transitions.has(id)) {
+          transitions.set(id, []);
+        }
+        transitions.get(id)!.push({ time, state, reason: transition[3] });
+      }
+    } else if (kind === "StackSample" && goroutine >= 0) {
+      const stack: string[] = [];
+      for (let j = i + 2; j < lines.length && lines[j].startsWith("\t"); j++) {
+        if (!lines[j].startsWith("\t\t")) {
+          stack.push(lines[j].trim().split(" @ ")[0]);
+        }
+      }
+      samples.push({ time, goroutine, stack });
+    }
+  }
+  return { requests: [...tasks.values()].filter((r) => r.end !== undefined), transitions, samples };
+}
+
+// Time a goroutine spent in each state between two instants
+function addBreakdown(breakdown: TimeBreakdown, reasons: Map<string, number>, transitions: Transition[], start: number, end: number) {
+  let state: Transition | undefined;
+  let since = start;
+  const add = (until: number) => {
+    if (state && state.state !== "gone" && until > since) {
+      breakdown[state.state] += until - since;
+      if (state.state === "blocked") {
+        const reason = state.reason || "other";
+        reasons.set(reason, (reasons.get(reason) ?? 0) + until - since);
+      }
+    }
+  };
+  for (const transition of transitions) {
+    if (transition.time >= end) {
+      break;
+    }
+    if (transition.time > start) {
+      add(transition.time);
+      since = transition.time;
+    }
+    state = transition;
+  }
+  // A goroutine seen only running inside the window started out running
+  state ??= { time: start, state: "running", reason: "" };
+  add(end);
+}
+
+function emptyBreakdown(): TimeBreakdown {
+  return { running: 0, runnable: 0, blocked: 0, syscall: 0, blockedBy: [] };
+}
+
+// Stack samples taken on a request's goroutines while it ran
+function samplesIn(samples: StackSample[], requests: Request[]): StackSample[] {
+  const byGoroutine = new Map<number, Request[]>();
+  for (const request of requests) {
+    for (const goroutine of request.goroutines) {
+      if (!byGoroutine.has(goroutine)) {
+        byGoroutine.set(goroutine, []);
+      }
+      byGoroutine.get(goroutine)!.push(request);
+    }
+  }
+  return samples.filter((sample) =>
+    (byGoroutine.get(sample.goroutine) ?? []).some((r) => sample.time >= r.start && sample.time <= r.end!));
+}
+
+function functionShares(samples: StackSample[]): { cum: Map<string, number>; flat: Map<string, number> } {
+  const cum = new Map<string, number>();
+  const flat = new Map<string, number>();
+  for (const sample of samples) {
+    for (const name of new Set(sample.stack)) {
+      cum.set(name, (cum.get(name) ?? 0) + 1);
+    }
+    if (sample.stack[0]) {
+      flat.set(sample.stack[0], (flat.get(sample.stack[0]) ?? 0) + 1);
+    }
+  }
+  return { cum, flat };
+}
+
+// Functions that set the tail apart. With enough samples from requests
+// within the target, functions are ranked by how much more of the tail's
+// samples they are on than of those; otherwise by the tail's self time.
+function tailSlices(tail: StackSample[], within: StackSample[], limit: number): TailSlice[] {
+  const inTail = functionShares(tail);
+  const compare = within.length >= MIN_BASELINE_SAMPLES;
+  const inWithin = functionShares(within);
+  const slices = [...inTail.cum.keys()].map((name): TailSlice => ({
+    function: name,
+    tailCumPct: percentOf(inTail.cum.get(name) ?? 0, tail.length),
+    tailFlatPct: percentOf(inTail.flat.get(name) ?? 0, tail.length),
+    ...(compare
+      ? {
+        withinCumPct: percentOf(inWithin.cum.get(name) ?? 0, within.length),
+        withinFlatPct: percentOf(inWithin.flat.get(name) ?? 0, within.length),
+      }
+      : {}),
+  }));
+  const rank = (s: TailSlice) => (compare ? s.tailCumPct - (s.withinCumPct ?? 0) + s.tailFlatPct / 100 : s.tailFlatPct);
+  return slices.filter((s) => rank(s) > 0).sort((a, b) => rank(b) - rank(a)).slice(0, limit);
+}
+
+function prune(frame: ProfileFrame, depth: number): ProfileFrame {
+  const children = depth > 0 ? (frame.children ?? []).sort((a, b) => b.value - a.value).map((c) => prune(c, depth - 1)) : [];
+  return { name: frame.name, value: frame.value, ...(children.length > 0 ? { children } : {}) };
+}
+
+const STATE_ADVICE: Record<GoroutineState, string> = {
+  running: "on CPU",
+  runnable: "waiting for a CPU (the process is CPU-starved or GOMAXPROCS is too low)",
+  blocked: "blocked",
+  syscall: "in syscalls",
+};
+
+function verdictOf(routes: RouteSlo[], target: string, percentile: SloPercentile): string {
+  const violated = routes.filter((r) => r.violated);
+  if (violated.length === 0) {
+    return `✅ All ${routes.length} route(s) meet ${percentile} ≤ ${target}.`;
+  }
+  const worst = violated.reduce((a, b) => (b.observed > a.observed ? b : a));
+  const others = violated.length > 1 ? ` (${violated.length - 1} more route(s) over target)` : "";
+  const head = `❌ ${worst.route} misses the SLO: ${percentile} is ${formatNanos(worst.observed)} against ${target}, with ${worst.slowPct}% of its requests over${others}.`;
+  const tail = worst.tail;
+  if (!tail) {
+    return head;
+  }
+  let cause = `Its slow requests spend ${tail.dominantPct}% of their time ${STATE_ADVICE[tail.dominant]}`;
+  const slice = tail.slices[0];
+  if (tail.dominant === "running" && slice) {
+    const share = slice.withinCumPct !== undefined
+      ? `on ${slice.tailCumPct}% of tail samples against ${slice.withinCumPct}% within target`
+      : `${slice.tailFlatPct}% of tail samples`;
+    cause += `, most in ${slice.function} (${share}): make that path cheaper first.`;
+  } else if (tail.dominant === "blocked") {
+    const reason = tail.breakdown.blockedBy[0]?.reason ?? "other";
+    cause += ` on ${reason}: capture a block or mutex profile to find the contended channel, lock or I/O.`;
+  } else if (tail.dominant === "syscall") {
+    cause += ": profile_process_perf shows what the kernel does with that time.";
+  } else {
+    cause += ": add CPU or reduce work across the process rather than in this route.";
+  }
+  return `${head} ${cause}`;
+}
+
+// Check every route's latency at a percentile against a target
+export function checkSlo(
+  trace: ParsedTrace,
+  options: { targetNs: number; percentile: SloPercentile; profile?: Profile; routeLabel: string; limit: number },
+): SloReport {
+  const byRoute = new Map<string, Request[]>();
+  for (const request of trace.requests) {
+    if (!byRoute.has(request.route)) {
+      byRoute.set(request.route, []);
+    }
+    byRoute.get(request.route)!.push(request);
+  }
+
+  const profile = options.profile;
+  const cpuIndex = profile ? sampleIndexOf(profile) : 0;
+  const cpuTotal = profile ? totalOf(profile, cpuIndex) : 0;
+
+  const routes = [...byRoute.entries()].map(([route, requests]): RouteSlo => {
+    const latency = percentiles(requests.map((r) => r.end! - r.start));
+    const observed = latency[options.percentile];
+    const slow = requests.filter((r) => r.end! - r.start > options.targetNs);
+    const result: RouteSlo = {
+      route,
+      requests: requests.length,
+      latency,
+      observed,
+      violated: observed > options.targetNs,
+      slow: slow.length,
+      slowPct: percentOf(slow.length, requests.length),
+    };
+
+    if (result.violated) {
+      const breakdown = emptyBreakdown();
+      const reasons = new Map<string, number>();
+      for (const request of slow) {
+        addBreakdown(breakdown, reasons, trace.transitions.get(request.goroutine) ?? [], request.start, request.end!);
+      }
+      breakdown.blockedBy = [...reasons.entries()].sort((a, b) => b[1] - a[1]).map(([reason, ns]) => ({ reason, ns }));
+      const states: GoroutineState[] = ["running", "runnable", "blocked", "syscall"];
+      const spent = states.reduce((sum, s) => sum + breakdown[s], 0);
+      const dominant = states.reduce((a, b) => (breakdown[b] > breakdown[a] ? b : a));
+
+      const tail = samplesIn(trace.samples, slow);
+      const within = samplesIn(trace.samples, requests.filter((r) => r.end! - r.start <= options.targetNs));
+      const flamegraph: ProfileFrame = { name: route, value: 0, children: [] };
+      for (const sample of tail) {
+        addStackToTree(flamegraph, [...sample.stack].reverse(), 1);
+      }
+      result.tail = {
+        breakdown,
+        dominant,
+        dominantPct: percentOf(breakdown[dominant], spent),
+        samples: tail.length,
+        slices: tailSlices(tail, within, options.limit),
+        flamegraph: prune(flamegraph, TAIL_DEPTH),
+      };
+    }
+
+    if (profile && cpuTotal > 0) {
+      const slice = filterSamples(profile, (sample) => sample.labels[options.routeLabel] === route);
+      const report = topReport(slice, cpuIndex, 3);
+      result.cpu = {
+        pct: percentOf(totalOf(slice, cpuIndex), cpuTotal),
+        top: report.functions.map((f) => ({ name: f.name, flatPct: f.flatPct })),
+      };
+    }
+    return result;
+  }).sort((a, b) => Number(b.violated) - Number(a.violated) || b.observed / options.targetNs - a.observed / options.targetNs);
+
+  const labeled = profile
+    ? totalOf(filterSamples(profile, (sample) => options.routeLabel in sample.labels), cpuIndex)
+    : 0;
+  return {
+    targetNs: options.targetNs,
+    percentile: options.percentile,
+    routes,
+    violated: routes.filter((r) => r.violated).map((r) => r.route),
+    verdict: verdictOf(routes, formatNanos(options.targetNs), options.percentile),
+    unlabeledCpuPct: profile && cpuTotal > 0 ? percentOf(cpuTotal - labeled, cpuTotal) : undefined,
+  };
+}
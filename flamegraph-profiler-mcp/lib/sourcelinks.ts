@@ -0,0 +1,203 @@
+/**
+ * Links from flamegraph frames to the source of their function, at the line
+ * most of its samples are on: in a local editor through its URL scheme, or in
+ * the function's repository. Repositories are mapped in the server config by
+ * Go module path, matched against the package in a function's name so any
+ * checkout resolves, or by the directory files were built in. Dependencies
+ * built from the module cache link to their GitHub repository at the version
+ * built without any mapping.
+ */
+import path from "node:path";
+import { resolveSourceFile } from "./annotate.js";
+import type { Profile } from "./pprof.js";
+
+export interface SourceRepo {
+  // Go module path whose packages the repository holds, e.g. github.com/acme/shop
+  module?: string;
+  // Directory files were built in, e.g. /home/runner/work/shop/shop
+  path?: string;
+  // Repository URL, linked to like GitHub's /blob/<ref>/<path>#L<line>, or a
+  // template with {ref}, {path} and {line} for other forges
+  url: string;
+  // Branch, tag or commit; the profile's commit by default, else HEAD
+  ref?: string;
+  // Directory of the module or path within the repository
+  dir?: string;
+}
+
+export interface SourceLinkConfig {
+  // Editor to open files found on this machine in: a name from EDITORS, or a
+  // URL template with {file} and {line}
+  editor?: string;
+  repos: SourceRepo[];
+}
+
+export const EDITORS: Record<string, string> = {
+  vscode: "vscode://file{file}:{line}",
+  cursor: "cursor://file{file}:{line}",
+  zed: "zed://file{file}:{line}",
+  idea: "idea://open?file={file}&line={line}",
+};
+
+export interface SourceLink {
+  url: string;
+  // Where the link points, as file:line relative to its repository or module
+  // when it has one
+  where: string;
+}
+
+// Modules that live on GitHub under another path
+const GITHUB_MIRRORS: Array<[RegExp, string]> = [
+  [/^golang\.org\/x\/([^/]+)/, "github.com/golang/$1"],
+  [/^google\.golang\.org\/protobuf/, "github.com/protocolbuffers/protobuf-go"],
+  [/^google\.golang\.org\/grpc/, "github.com/grpc/grpc-go"],
+];
+
+// Fail on an editor or repository mapping links cannot be made with
+export function checkSourceLinkConfig(config: SourceLinkConfig): void {
+  const { editor, repos } = config;
+  if (editor !== undefined && !(editor in EDITORS) && !editor.includes("{file}")) {
+    throw new Error(`Unknown editor '${editor}' (available: ${Object.keys(EDITORS).join(", ")}, or a URL template with {file} and {line})`);
+  }
+  repos.forEach((repo, i) => {
+    if (!repo.url) {
+      throw new Error(`repos[${i}] needs a url`);
+    }
+    if ((repo.module === undefined) === (repo.path === undefined)) {
+      throw new Error(`repos[${i}] needs either a module or a path`);
+    }
+  });
+}
+
+// Package of a Go function name, e.g. github.com/acme/shop/internal/db for
+// github.com/acme/shop/internal/db.(*Store).Get
+function packageOf(name: string): string {
+  const plain = name.replace(/\[.*$/, "");
+  const dot = plain.indexOf(".", plain.lastIndexOf("/") + 1);
+  return dot === -1 ? plain : plain.slice(0, dot);
+}
+
+function fill(template: string, values: Record<string, string | number>): string {
+  return template.replace(/\{(\w+)\}/g, (match, key: string) => (key in values ? String(values[key]) : match));
+}
+
+function repoLink(url: string, ref: string, file: string, line: number): string {
+  return url.includes("{")
+    ? fill(url, { ref, path: file, line })
+    : `${url.replace(/\/+$/, "")}/blob/${ref}/${file}#L${line}`;
+}
+
+// GitHub link of a file in the module cache (or a -trimpath module path),
+// at the tag or commit of the version built
+function moduleCacheLink(file: string, line: number): SourceLink | undefined {
+  const match = /(?:^|\/pkg\/mod\/)((?:[^/@]+\/)*[^/@]+)@([^/]+)\/(.+)$/.exec(file);
+  if (!match) {
+    return undefined;
+  }
+  // The module cache escapes capitals as !x
+  const module = match[1].replace(/!([a-z])/g, (_, c: string) => c.toUpperCase());
+  const [, , version, rest] = match;
+  let repo = module;
+  for (const [pattern, replacement] of GITHUB_MIRRORS) {
+    repo = repo.replace(pattern, replacement);
+  }
+  if (!repo.startsWith("github.com/")) {
+    return undefined;
+  }
+  const parts = repo.split("/");
+  // Major version suffixes name a branch of the module, not a directory
+  const sub = parts.slice(3).filter((part, i, all) => !(i === all.length - 1 && /^v\d+$/.test(part))).join("/");
+  const pseudo = /-\d{14}-([0-9a-f]{12})$/.exec(version);
+  const tag = version.replace(/\+incompatible$/, "");
+  const ref = pseudo ? pseudo[1] : sub ? `${sub}/${tag}` : tag;
+  return {
+    url: `https://${parts.slice(0, 3).join("/")}/blob/${ref}/${sub ? `${sub}/` : ""}${rest}#L${line}`,
+    where: `${module}@${version}/${rest}:${line}`,
+  };
+}
+
+// Link to one function's source, or undefined when neither the editor nor a
+// repository can show it
+export function sourceLink(
+  name: string,
+  file: string,
+  line: number,
+  config: SourceLinkConfig,
+  options: { commit?: string; sourceRoot?: string } = {},
+): SourceLink | undefined {
+  if (!file) {
+    return undefined;
+  }
+  if (config.editor) {
+    const local = resolveSourceFile(file, options.sourceRoot);
+    if (local) {
+      return { url: fill(EDITORS[config.editor] ?? config.editor, { file: encodeURI(local), line }), where: `${local}:${line}` };
+    }
+  }
+  const pkg = packageOf(name);
+  for (const repo of config.repos) {
+    let relative: string | undefined;
+    if (repo.module && (pkg === repo.module || pkg.startsWith(`${repo.module}/`))) {
+      relative = path.posix.join(pkg.slice(repo.module.length), path.posix.basename(file));
+    } else if (repo.path && file.startsWith(`${repo.path.replace(/\/+$/, "")}/`)) {
+      relative = file.slice(repo.path.replace(/\/+$/, "").length + 1);
+    }
+    if (relative !== undefined) {
+      relative = path.posix.join(repo.dir ?? "", relative).replace(/^\/+/, "");
+      return { url: repoLink(repo.url, repo.ref ?? options.commit ?? "HEAD", relative, line), where: `${relative}:${line}` };
+    }
+  }
+  return moduleCacheLink(file, line);
+}
+
+// Each function's file and the line most of its samples are on, counting a
+// line once per sample
+export function hottestLines(profile: Profile, sampleIndex: number): Map<string, { file: string; line: number }> {
+  const byLine = new Map<string, Map<number, number>>();
+  const files = new Map<string, string>();
+  for (const sample of profile.samples) {
+    const value = Math.abs(sample.values[sampleIndex]);
+    if (value === 0) {
+      continue;
+    }
+    const seen = new Set<string>();
+    for (const id of sample.locationIds) {
+      for (const frame of profile.locations.get(id)?.frames ?? []) {
+        const key = `${frame.name}:${frame.line}`;
+        if (!frame.file || seen.has(key)) {
+          continue;
+        }
+        seen.add(key);
+        files.set(frame.name, frame.file);
+        const lines = byLine.get(frame.name) ?? new Map<number, number>();
+        lines.set(frame.line, (lines.get(frame.line) ?? 0) + value);
+        byLine.set(frame.name, lines);
+      }
+    }
+  }
+  const hottest = new Map<string, { file: string; line: number }>();
+  for (const [name, lines] of byLine) {
+    const [line] = [...lines.entries()].reduce((best, entry) => (entry[1] > best[1] ? entry : best));
+    hottest.set(name, { file: files.get(name)!, line });
+  }
+  return hottest;
+}
+
+// Link lookup for the frames of a profile's flamegraph, or undefined when no
+// editor or repository is configured and no frame's file is in the module cache
+export function frameLinker(
+  profile: Profile,
+  sampleIndex: number,
+  config: SourceLinkConfig,
+  options: { commit?: string; sourceRoot?: string } = {},
+): ((name: string) => SourceLink | undefined) | undefined {
+  const lines = hottestLines(profile, sampleIndex);
+  const links = new Map<string, SourceLink | undefined>();
+  for (const [name, { file, line }] of lines) {
+    links.set(name, sourceLink(name, file, line, config, options));
+  }
+  if (![...links.values()].some(Boolean)) {
+    return undefined;
+  }
+  return (name) => links.get(name);
+}
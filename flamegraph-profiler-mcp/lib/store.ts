@@ -0,0 +1,65 @@
+/**
+ * Persistent server state stored as JSON files in a data directory.
+ */
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { serverConfig } from "./config.js";
+
+// Directory for persisted state; override with PROFILER_DATA_DIR
+export function dataDir(): string {
+  return process.env.PROFILER_DATA_DIR ?? path.join(os.homedir(), ".flamegraph-profiler");
+}
+
+// Directory captured and pushed profiles are kept in
+export function profileDir(): string {
+  return serverConfig().profileDir ?? path.join(dataDir(), "profiles");
+}
+
+// Read a JSON file from the data directory, returning a fallback if missing
+export async function readJson<T>(name: string, fallback: T): Promise<T> {
+  try {
+    return JSON.parse(await fs.readFile(path.join(dataDir(), name), "utf-8")) as T;
+  } catch (error) {
+    if ((error as NodeJS.ErrnoException).code === "ENOENT") {
+      return fallback;
+    }
+    throw error;
+  }
+}
+
+// Write a JSON file to the data directory atomically
+export async function writeJson(name: string, value: unknown): Promise<void> {
+  const file = path.join(dataDir(), name);
+  await fs.mkdir(path.dirname(file), { recursive: true });
+  const tmp = `${file}.${process.pid}.tmp`;
+  await fs.writeFile(tmp, JSON.stringify(value, null, 2));
+  await fs.rename(tmp, file);
+}
+
+const locks = new Map<string, Promise<unknown>>();
+
+// Read, modify, and write a JSON file, serializing updates within the process
+export async function updateJson<T, R>(
+  name: string,
+  fallback: T,
+  update: (value: T) => R | Promise<R>,
+): Promise<R> {
+  const previous = locks.get(name) ?? Promise.resolve();
+  const next = previous.catch(() => {}).then(async () => {
+    const value = await readJson(name, fallback);
+    const result = await update(value);
+    await writeJson(name, value);
+    return result;
+  });
+  locks.set(name, next);
+  return next;
+}
+
+// Path for a captured profile kept in the configured profile directory, or
+// else the data directory's profiles/ folder, named after what was captured and when
+export async function storedProfilePath(name: string): Promise<string> {
+  const dir = profileDir();
+  await fs.mkdir(dir, { recursive: true });
+  return path.join(dir, `${name.replace(/[^\w.-]+/g, "-")}_${new Date().toISOString().replace(/[:.]/g, "-")}.pb.gz`);
+}
@@ -0,0 +1,402 @@
+/**
+ * Supervised targets and crash postmortems: run a Go program under the
+ * server, keep its recent logs, MemStats and heap profile, and when it exits
+ * abnormally bundle them, with a core dump when enabled, for later analysis.
+ */
+import { execFile, spawn, type ChildProcess } from "node:child_process";
+import { randomBytes } from "node:crypto";
+import { existsSync } from "node:fs";
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { promisify } from "node:util";
+import { keepProfile } from "./catalog.js";
+import { buildGoAppAsync } from "./goapp.js";
+import { dataDir, readJson, updateJson } from "./store.js";
+import { downloadProfile, fetchPprof } from "./target.js";
+
+const execFileAsync = promisify(execFile);
+
+export type SupervisedStatus = "running" | "exited" | "crashed" | "stopped";
+
+export interface Supervised {
+  id: string;
+  // Go source file or executable
+  appPath: string;
+  args: string[];
+  // pprof address the heap profile and MemStats are polled from
+  address?: string;
+  pid?: number;
+  startedAt: string;
+  status: SupervisedStatus;
+  heapIntervalSeconds: number;
+  coreDumps: boolean;
+  exitCode?: number | null;
+  signal?: string | null;
+  exitedAt?: string;
+  // Latest heap profile and MemStats snapshot times
+  heapAt?: string;
+  memStatsAt?: string;
+  postmortemId?: string;
+}
+
+export type CrashReason = "oom" | "killed" | "panic" | "fatal" | "signal" | "exit";
+
+export interface Postmortem {
+  id: string;
+  at: string;
+  supervisedId: string;
+  appPath: string;
+  pid?: number;
+  exitCode?: number | null;
+  signal?: string | null;
+  reason: CrashReason;
+  // Bundle directory, holding logs.txt, memstats.json, heap.pb.gz, core and the binary when present
+  dir: string;
+  // Last log lines, for a quick look without opening the bundle
+  logTail: string[];
+  memStats?: Record<string, number>;
+  memStatsAt?: string;
+  heapProfileId?: string;
+  heapAt?: string;
+  core?: string;
+  // What could not be collected, and why
+  notes: string[];
+}
+
+interface SupervisedState extends Supervised {
+  child: ChildProcess;
+  binary: string;
+  workDir: string;
+  logs: string[];
+  partial: { stdout: string; stderr: string };
+  heapFile?: string;
+  memStats?: Record<string, number>;
+  timer?: NodeJS.Timeout;
+}
+
+const POSTMORTEMS_FILE = "postmortems.json";
+
+// Oldest postmortems beyond this are dropped from the index, and their bundles deleted
+const MAX_POSTMORTEMS = 100;
+
+// Log lines kept per target, and shown in a postmortem summary
+const MAX_LOG_LINES = 1000;
+const LOG_TAIL_LINES = 30;
+
+// Targets supervised at once
+const MAX_SUPERVISED = 8;
+
+const supervised = new Map<string, SupervisedState>();
+
+function postmortemRoot(): string {
+  return path.join(dataDir(), "postmortems");
+}
+
+function publicView(state: SupervisedState): Supervised {
+  const { child: _child, binary: _binary, workDir: _workDir, logs: _logs, partial: _partial, heapFile: _heapFile, memStats: _memStats, timer: _timer, ...view } = state;
+  return view;
+}
+
+function appendLogs(state: SupervisedState, stream: "stdout" | "stderr", chunk: Buffer): void {
+  const lines = (state.partial[stream] + chunk.toString()).split("\n");
+  state.partial[stream] = lines.pop() ?? "";
+  state.logs.push(...lines.map((line) => (stream === "stderr" ? `[stderr] ${line}` : line)));
+  state.logs.splice(0, Math.max(0, state.logs.length - MAX_LOG_LINES));
+}
+
+// runtime.MemStats from the comment block at the end of /debug/pprof/heap?debug=1.
+// Array fields such as PauseNs are skipped.
+export function parseMemStats(text: string): Record<string, number> {
+  const stats: Record<string, number> = {};
+  for (const match of text.matchAll(/^# (\w+) = (\d+)$/gm)) {
+    stats[match[1]] = Number(match[2]);
+  }
+  return stats;
+}
+
+// Replace the kept heap profile and MemStats with fresh ones; failures keep
+// the previous snapshot, which is what a postmortem wants
+async function snapshot(state: SupervisedState): Promise<void> {
+  if (!state.address) return;
+  try {
+    const downloaded = await downloadProfile(state.address, "heap");
+    const file = path.join(state.workDir, "heap.pb.gz");
+    await fs.rename(downloaded, file).catch(async () => {
+      await fs.copyFile(downloaded, file);
+      await fs.unlink(downloaded);
+    });
+    state.heapFile = file;
+    state.heapAt = new Date().toISOString();
+  } catch {
+    // The target may not be listening yet, or be on its way down
+  }
+  try {
+    const stats = parseMemStats(await (await fetchPprof(state.address, "heap", { debug: 1 })).text());
+    if (Object.keys(stats).length > 0) {
+      state.memStats = stats;
+      state.memStatsAt = new Date().toISOString();
+    }
+  } catch {
+    // Same as above
+  }
+}
+
+export function crashReason(logs: string[], signal: string | null): CrashReason {
+  const text = logs.join("\n");
+  if (/fatal error: (runtime: )?out of memory|runtime: out of memory/.test(text)) return "oom";
+  if (signal === "SIGKILL") return "killed";
+  if (/^(\[stderr\] )?panic: /m.test(text)) return "panic";
+  if (/^(\[stderr\] )?fatal error: /m.test(text)) return "fatal";
+  return signal ? "signal" : "exit";
+}
+
+// Find the core dump of a crashed process, per the kernel's core_pattern
+async function collectCore(state: SupervisedState, dir: string, notes: string[]): Promise<string | undefined> {
+  const pid = state.pid;
+  const pattern = (await fs.readFile("/proc/sys/kernel/core_pattern", "utf8").catch(() => "core")).trim();
+  if (pattern.startsWith("|")) {
+    if (!pattern.includes("systemd-coredump")) {
+      notes.push(`core_pattern pipes cores to ${pattern.slice(1).split(" ")[0]}; collect the core there`);
+      return undefined;
+    }
+    const file = path.join(dir, "core");
+    try {
+      await execFileAsync("coredumpctl", ["dump", String(pid), "--output", file]);
+      return file;
+    } catch (error) {
+      notes.push(`coredumpctl dump ${pid} failed: ${error instanceof Error ? error.message.split("\n")[0] : String(error)}`);
+      return undefined;
+    }
+  }
+  const name = pattern
+    .replace(/%p/g, String(pid))
+    .replace(/%e/g, path.basename(state.binary).slice(0, 15))
+    .replace(/%%/g, "%");
+  const candidates = path.isAbsolute(name)
+    ? [name]
+    : [path.join(state.workDir, name), path.join(state.workDir, `${name}.${pid}`)];
+  const source = candidates.find((c) => existsSync(c));
+  if (!source) {
+    notes.push(name.includes("%")
+      ? `No core found: core_pattern '${pattern}' uses placeholders other than %p and %e`
+      : `No core found at ${candidates.join(" or ")}; check core_pattern and the core size limit`);
+    return undefined;
+  }
+  const file = path.join(dir, "core");
+  await fs.copyFile(source, file);
+  await fs.unlink(source).catch(() => undefined);
+  return file;
+}
+
+async function writePostmortem(state: SupervisedState): Promise<Postmortem> {
+  const id = `pm_${randomBytes(4).toString("hex")}`;
+  const dir = path.join(postmortemRoot(), id);
+  await fs.mkdir(dir, { recursive: true });
+  // Output after the last newline, which a crash often leaves behind
+  for (const stream of ["stdout", "stderr"] as const) {
+    if (state.partial[stream]) appendLogs(state, stream, Buffer.from("\n"));
+  }
+  const logs = state.logs;
+  const notes: string[] = [];
+
+  await fs.writeFile(path.join(dir, "logs.txt"), `${logs.join("\n")}\n`);
+  if (state.memStats) {
+    await fs.writeFile(path.join(dir, "memstats.json"), `${JSON.stringify({ at: state.memStatsAt, ...state.memStats }, null, 2)}\n`);
+  } else {
+    notes.push(state.address ? `No MemStats snapshot was taken from ${state.address} before the exit` : "No pprof address was given, so no MemStats were collected");
+  }
+  let heapProfileId: string | undefined;
+  if (state.heapFile) {
+    await fs.copyFile(state.heapFile, path.join(dir, "heap.pb.gz"));
+    const entry = await keepProfile(state.heapFile, `${path.basename(state.appPath, ".go")}_heap`, {
+      target: state.appPath,
+      profileType: "heap",
+      labels: { postmortem: id },
+    }).catch(() => undefined);
+    heapProfileId = entry?.id;
+  } else if (state.address) {
+    notes.push(`No heap profile was captured from ${state.address} before the exit`);
+  }
+  let core: string | undefined;
+  if (state.coreDumps) {
+    core = await collectCore(state, dir, notes);
+    if (core) {
+      // A core is only readable with the binary that produced it
+      await fs.copyFile(state.binary, path.join(dir, "binary"));
+    }
+  }
+
+  const postmortem: Postmortem = {
+    id,
+    at: state.exitedAt ?? new Date().toISOString(),
+    supervisedId: state.id,
+    appPath: state.appPath,
+    pid: state.pid,
+    exitCode: state.exitCode,
+    signal: state.signal,
+    reason: crashReason(logs, state.signal ?? null),
+    dir,
+    logTail: logs.slice(-LOG_TAIL_LINES),
+    memStats: state.memStats,
+    memStatsAt: state.memStatsAt,
+    heapProfileId,
+    heapAt: state.heapAt,
+    core,
+    notes,
+  };
+  const dropped = await updateJson<Postmortem[], Postmortem[]>(POSTMORTEMS_FILE, [], (all) => {
+    all.push(postmortem);
+    return all.splice(0, Math.max(0, all.length - MAX_POSTMORTEMS));
+  });
+  for (const old of dropped) {
+    await fs.rm(old.dir, { recursive: true, force: true }).catch(() => undefined);
+  }
+  return postmortem;
+}
+
+// Start a Go program (built from source when appPath is a .go file) under
+// supervision. Resolves once it has run for a second, so immediate failures show.
+export async function superviseTarget(
+  options: { appPath: string; args: string[]; address?: string; heapIntervalSeconds: number; coreDumps: boolean },
+  onCrash: (target: Supervised, postmortem: Postmortem) => void,
+): Promise<Supervised> {
+  const appPath = path.resolve(options.appPath);
+  if (!existsSync(appPath)) {
+    throw new Error(`${appPath} does not exist`);
+  }
+  if ([...supervised.values()].filter((s) => s.status === "running").length >= MAX_SUPERVISED) {
+    throw new Error(`${MAX_SUPERVISED} targets are already supervised; stop one with stop_supervised`);
+  }
+  const id = `s_${randomBytes(3).toString("hex")}`;
+  const workDir = path.join(os.tmpdir(), `supervise_${id}`);
+  await fs.mkdir(workDir, { recursive: true });
+  const binary = appPath.endsWith(".go") ? path.join(workDir, path.basename(appPath, ".go")) : appPath;
+  if (binary !== appPath) {
+    await buildGoAppAsync(appPath, binary);
+  }
+
+  // With core dumps on, the Go runtime aborts with a core on fatal errors,
+  // and the shell lifts the core size limit before exec'ing the program
+  const child = options.coreDumps
+    ? spawn("sh", ["-c", 'ulimit -c unlimited 2>/dev/null; exec "$0" "$@"', binary, ...options.args], {
+      cwd: workDir,
+      env: { ...process.env, GOTRACEBACK: "crash" },
+      stdio: ["ignore", "pipe", "pipe"],
+    })
+    : spawn(binary, options.args, { cwd: workDir, stdio: ["ignore", "pipe", "pipe"] });
+
+  const state: SupervisedState = {
+    id,
+    appPath,
+    args: options.args,
+    address: options.address,
+    pid: child.pid,
+    startedAt: new Date().toISOString(),
+    status: "running",
+    heapIntervalSeconds: options.heapIntervalSeconds,
+    coreDumps: options.coreDumps,
+    child,
+    binary,
+    workDir,
+    logs: [],
+    partial: { stdout: "", stderr: "" },
+  };
+  supervised.set(id, state);
+
+  child.stdout?.on("data", (chunk: Buffer) => appendLogs(state, "stdout", chunk));
+  child.stderr?.on("data", (chunk: Buffer) => appendLogs(state, "stderr", chunk));
+  child.on("error", (error) => {
+    state.logs.push(`[supervisor] ${error.message}`);
+  });
+  child.on("close", (code, signal) => {
+    clearInterval(state.timer);
+    state.exitCode = code;
+    state.signal = signal;
+    state.exitedAt = new Date().toISOString();
+    if (state.status === "stopped") {
+      void cleanup(state);
+      return;
+    }
+    if (code === 0 && !signal) {
+      state.status = "exited";
+      void cleanup(state);
+      return;
+    }
+    state.status = "crashed";
+    void writePostmortem(state)
+      .then((postmortem) => {
+        state.postmortemId = postmortem.id;
+        onCrash(publicView(state), postmortem);
+      })
+      .finally(() => cleanup(state));
+  });
+
+  if (state.address) {
+    state.timer = setInterval(() => void snapshot(state), options.heapIntervalSeconds * 1000);
+    state.timer.unref();
+  }
+  await new Promise((resolve) => setTimeout(resolve, 1000));
+  if (state.status === "running") {
+    await snapshot(state);
+  }
+  return publicView(state);
+}
+
+async function cleanup(state: SupervisedState): Promise<void> {
+  await fs.rm(state.workDir, { recursive: true, force: true }).catch(() => undefined);
+}
+
+// Stop a supervised target without a postmortem
+export function stopSupervised(id: string): Supervised {
+  const state = supervised.get(id);
+  if (!state) {
+    throw new Error(`No supervised target ${id}; see list_supervised`);
+  }
+  if (state.status === "running") {
+    state.status = "stopped";
+    state.child.kill("SIGTERM");
+  }
+  supervised.delete(id);
+  return publicView(state);
+}
+
+export function listSupervised(): Supervised[] {
+  return [...supervised.values()].map(publicView);
+}
+
+// Postmortems newest first
+export async function listPostmortems(): Promise<Postmortem[]> {
+  return (await readJson<Postmortem[]>(POSTMORTEMS_FILE, [])).reverse();
+}
+
+export async function getPostmortem(id: string): Promise<Postmortem> {
+  const postmortem = (await readJson<Postmortem[]>(POSTMORTEMS_FILE, [])).find((p) => p.id === id);
+  if (!postmortem) {
+    throw new Error(`No postmortem ${id}; see list_postmortems`);
+  }
+  return postmortem;
+}
+
+const REASONS: Record<CrashReason, string> = {
+  oom: "out of memory",
+  killed: "killed (SIGKILL, often the kernel OOM killer)",
+  panic: "panic",
+  fatal: "fatal runtime error",
+  signal: "killed by a signal",
+  exit: "non-zero exit",
+};
+
+export function describeExit(p: { exitCode?: number | null; signal?: string | null }): string {
+  return p.signal ? `signal ${p.signal}` : `exit code ${p.exitCode}`;
+}
+
+export function formatPostmortemSummary(p: Postmortem): string {
+  const collected = [
+    "logs",
+    ...(p.memStats ? ["MemStats"] : []),
+    ...(p.heapProfileId ? [`heap profile ${p.heapProfileId}`] : []),
+    ...(p.core ? ["core dump"] : []),
+  ];
+  return `${p.id}: ${path.basename(p.appPath)} ${REASONS[p.reason]} (${describeExit(p)}) at ${p.at}; collected ${collected.join(", ")}`;
+}
@@ -0,0 +1,99 @@
+/**
+ * Suppressions - accepted hotspots that are left out of findings and diffs.
+ */
+import { randomBytes } from "node:crypto";
+import { readJson, updateJson } from "./store.js";
+
+export interface Suppression {
+  id: string;
+  // Glob on the function name including its package path, e.g. "crypto/*" or "main.hashChain"
+  function?: string;
+  // Glob on the function's source file path, e.g. "*/vendor/*"
+  file?: string;
+  justification: string;
+  // ISO date after which the suppression no longer applies
+  expires?: string;
+  author: string;
+  createdAt: string;
+}
+
+export type NewSuppression = Pick<Suppression, "function" | "file" | "justification" | "expires" | "author">;
+
+const SUPPRESSIONS_FILE = "suppressions.json";
+
+// Convert a glob ("*" matches anything, "?" one character) to an anchored regexp
+export function globToRegExp(glob: string): RegExp {
+  const escaped = glob.replace(/[.+^${}()|[\]\\]/g, "\\$&").replace(/\*/g, ".*").replace(/\?/g, ".");
+  return new RegExp(`^${escaped}$`);
+}
+
+export function isActive(suppression: Suppression, now = new Date()): boolean {
+  return !suppression.expires || new Date(suppression.expires) > now;
+}
+
+export async function listSuppressions(includeExpired = false): Promise<Suppression[]> {
+  const all = await readJson<Suppression[]>(SUPPRESSIONS_FILE, []);
+  return includeExpired ? all : all.filter((s) => isActive(s));
+}
+
+export async function addSuppression(suppression: NewSuppression): Promise<Suppression> {
+  if (!suppression.function && !suppression.file) {
+    throw new Error("A suppression needs a function or file pattern");
+  }
+  if (suppression.expires && Number.isNaN(new Date(suppression.expires).getTime())) {
+    throw new Error(`Invalid expiry date "${suppression.expires}"`);
+  }
+  return updateJson<Suppression[], Suppression>(SUPPRESSIONS_FILE, [], (all) => {
+    const created: Suppression = {
+      ...suppression,
+      id: `s_${randomBytes(4).toString("hex")}`,
+      createdAt: new Date().toISOString(),
+    };
+    all.push(created);
+    return created;
+  });
+}
+
+export async function removeSuppression(id: string): Promise<Suppression> {
+  return updateJson<Suppression[], Suppression>(SUPPRESSIONS_FILE, [], (all) => {
+    const index = all.findIndex((s) => s.id === id);
+    if (index === -1) {
+      throw new Error(`Suppression ${id} not found`);
+    }
+    return all.splice(index, 1)[0];
+  });
+}
+
+// Find the suppression covering a function, if any. Both patterns must match when both are set.
+export function suppressionFor(
+  suppressions: Suppression[],
+  name: string,
+  file: string | undefined,
+): Suppression | undefined {
+  return suppressions.find((s) =>
+    (!s.function || globToRegExp(s.function).test(name)) &&
+    (!s.file || (file !== undefined && globToRegExp(s.file).test(file))),
+  );
+}
+
+// Split items into those still reported and the number suppressed
+export function applySuppressions<T>(
+  items: T[],
+  suppressions: Suppression[],
+  nameOf: (item: T) => string,
+  fileOf: (name: string) => string | undefined,
+): { kept: T[]; suppressed: number } {
+  const kept = items.filter((item) => {
+    const name = nameOf(item);
+    return !suppressionFor(suppressions, name, fileOf(name));
+  });
+  return { kept, suppressed: items.length - kept.length };
+}
+
+// Format a suppression as a single line for tool output
+export function formatSuppression(suppression: Suppression): string {
+  const target = [suppression.function, suppression.file && `file ${suppression.file}`].filter(Boolean).join(", ");
+  const expiry = suppression.expires ? `until ${suppression.expires}` : "no expiry";
+  const expired = isActive(suppression) ? "" : " [expired]";
+  return `[${suppression.id}] ${target} (${expiry})${expired}: ${suppression.justification}`;
+}
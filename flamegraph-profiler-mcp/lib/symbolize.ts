@@ -0,0 +1,378 @@
+/**
+ * Symbolization of profiles whose locations are bare addresses, as captured
+ * from stripped release builds or by tools that do not symbolize: addresses
+ * in one mapping are resolved to functions, files and lines from the
+ * unstripped binary or its separate debug-info file. Native frames of cgo
+ * code and shared libraries, which the Go runtime leaves as addresses, are
+ * resolved from the mapped files themselves.
+ */
+import { spawn } from "node:child_process";
+import { existsSync, readFileSync } from "node:fs";
+import path from "node:path";
+import { baselineKind, profileCommit } from "./baselines.js";
+import { catalogProfile, getProfile, isProfileId, resolveProfilePath, type CatalogEntry } from "./catalog.js";
+import { readProfile, writeProfile, type Frame, type Location, type Mapping, type Profile } from "./pprof.js";
+import { storedProfilePath } from "./store.js";
+
+export interface SymbolizeReport {
+  // File the symbols came from; the mapped files, comma-separated, for native symbolization
+  binary: string;
+  // Mapping the addresses belong to, when the profile has mappings
+  mapping?: string;
+  // Address-only locations in that mapping
+  locations: number;
+  resolved: number;
+  // Resolved by `go tool addr2line` from the Go symbol table, after addr2line found no debug info
+  resolvedFromGo: number;
+  // Resolved from an ELF symbol table by nearest symbol, without file and line
+  resolvedFromSymbols?: number;
+}
+
+interface Elf {
+  type: number;
+  loads: Array<{ offset: bigint; vaddr: bigint; filesz: bigint }>;
+  // GNU build ID (hex) and Go build ID, when present
+  buildIds: string[];
+}
+
+const ET_EXEC = 2;
+const PT_LOAD = 1;
+const PT_NOTE = 4;
+const SHT_NOTE = 7;
+const NT_GNU_BUILD_ID = 3;
+const NT_GO_BUILD_ID = 4;
+
+// Object type, loadable segments and build IDs of an ELF file
+function readElf(file: string): Elf {
+  const buf = readFileSync(file);
+  if (buf.length < 64 || buf.toString("latin1", 0, 4) !== "\x7fELF") {
+    throw new Error(`${file} is not an ELF binary`);
+  }
+  const is64 = buf[4] === 2;
+  const le = buf[5] === 1;
+  const u16 = (o: number) => (le ? buf.readUInt16LE(o) : buf.readUInt16BE(o));
+  const u32 = (o: number) => (le ? buf.readUInt32LE(o) : buf.readUInt32BE(o));
+  const word = (o: number) => (is64 ? (le ? buf.readBigUInt64LE(o) : buf.readBigUInt64BE(o)) : BigInt(u32(o)));
+
+  const elf: Elf = { type: u16(16), loads: [], buildIds: [] };
+  // Note ranges, from note sections, else from note segments (sections may be stripped)
+  const sectionNotes: Array<[number, number]> = [];
+  const segmentNotes: Array<[number, number]> = [];
+
+  const phoff = Number(word(is64 ? 32 : 28));
+  const phentsize = u16(is64 ? 54 : 42);
+  const phnum = u16(is64 ? 56 : 44);
+  for (let i = 0; i < phnum; i++) {
+    const base = phoff + i * phentsize;
+    const offset = word(base + (is64 ? 8 : 4));
+    const filesz = word(base + (is64 ? 32 : 16));
+    if (u32(base) === PT_LOAD) {
+      elf.loads.push({ offset, vaddr: word(base + (is64 ? 16 : 8)), filesz });
+    } else if (u32(base) === PT_NOTE) {
+      segmentNotes.push([Number(offset), Number(filesz)]);
+    }
+  }
+  const shoff = Number(word(is64 ? 40 : 32));
+  const shentsize = u16(is64 ? 58 : 46);
+  const shnum = shoff > 0 ? u16(is64 ? 60 : 48) : 0;
+  for (let i = 0; i < shnum; i++) {
+    const base = shoff + i * shentsize;
+    if (u32(base + 4) === SHT_NOTE) {
+      sectionNotes.push([Number(word(base + (is64 ? 24 : 16))), Number(word(base + (is64 ? 32 : 20)))]);
+    }
+  }
+
+  // Notes: namesz, descsz, type, then name and desc padded to 4 bytes
+  for (const [offset, size] of sectionNotes.length > 0 ? sectionNotes : segmentNotes) {
+    const end = Math.min(offset + size, buf.length);
+    for (let o = offset; o + 12 <= end;) {
+      const namesz = u32(o);
+      const descsz = u32(o + 4);
+      const name = buf.toString("latin1", o + 12, o + 12 + namesz).replace(/\0+$/, "");
+      const desc = o + 12 + Math.ceil(namesz / 4) * 4;
+      if (name === "GNU" && u32(o + 8) === NT_GNU_BUILD_ID) {
+        elf.buildIds.push(buf.toString("hex", desc, desc + descsz));
+      } else if (name === "Go" && u32(o + 8) === NT_GO_BUILD_ID) {
+        elf.buildIds.push(buf.toString("latin1", desc, desc + descsz).replace(/\0+$/, ""));
+      }
+      o = desc + Math.ceil(descsz / 4) * 4;
+    }
+  }
+  return elf;
+}
+
+// Link-time address of a runtime address. Executables load where they were
+// linked; position-independent ones are found through the mapping's file
+// offset and the segment holding it. Debug-info files keep segment addresses
+// but not their contents, so there the first segment stands in.
+function linkAddress(elf: Elf, mapping: Mapping | undefined, address: bigint): bigint {
+  if (elf.type === ET_EXEC || !mapping) {
+    return address;
+  }
+  const offset = address - BigInt(mapping.start) + BigInt(mapping.offset);
+  const segment = elf.loads.find((l) => offset >= l.offset && offset < l.offset + l.filesz) ?? elf.loads[0];
+  return segment ? offset - segment.offset + segment.vaddr : offset;
+}
+
+// Run a command with input on stdin and return its stdout
+function runWithInput(command: string, args: string[], input: string): Promise<string> {
+  return new Promise((resolve, reject) => {
+    const child = spawn(command, args, { stdio: ["pipe", "pipe", "pipe"] });
+    let stdout = "";
+    let stderr = "";
+    child.stdout.on("data", (chunk: Buffer) => (stdout += chunk.toString()));
+    child.stderr.on("data", (chunk: Buffer) => (stderr += chunk.toString()));
+    child.on("error", reject);
+    child.on("close", (code) => (code === 0 ? resolve(stdout) : reject(new Error(stderr.trim() || `${command} exited with code ${code}`))));
+    child.stdin.end(input);
+  });
+}
+
+function frameOf(name: string, fileLine: string): Frame | undefined {
+  if (!name || name.startsWith("?")) {
+    return undefined;
+  }
+  // file:line, with an optional " (discriminator N)"
+  const match = fileLine.match(/^(.*):(\d+|\?)/);
+  return { name, file: match && match[1] !== "??" ? match[1] : "", line: match ? Number(match[2]) || 0 : 0 };
+}
+
+// Frames per address from binutils addr2line, innermost inlined frame first.
+// With -a every address is echoed before its frames, which delimits them.
+async function addr2line(file: string, addresses: bigint[]): Promise<Array<Frame[] | undefined>> {
+  const output = await runWithInput("addr2line", ["-a", "-f", "-i", "-C", "-e", file], addresses.map((a) => `0x${a.toString(16)}`).join("\n") + "\n");
+  const results: Array<Frame[] | undefined> = [];
+  let current: Frame[] | undefined;
+  const lines = output.split("\n");
+  for (let i = 0; i < lines.length; i++) {
+    if (/^0x[0-9a-f]+$/.test(lines[i])) {
+      current = [];
+      results.push(undefined);
+      continue;
+    }
+    if (!current || lines[i] === "") continue;
+    const frame = frameOf(lines[i], lines[++i] ?? "");
+    if (frame) {
+      current.push(frame);
+      results[results.length - 1] = current;
+    }
+  }
+  return results;
+}
+
+// Frames per address from the Go symbol table, which stripping with -s -w
+// leaves in place; no inlining information
+async function goAddr2line(file: string, addresses: bigint[]): Promise<Array<Frame[] | undefined>> {
+  const output = await runWithInput("go", ["tool", "addr2line", file], addresses.map((a) => `0x${a.toString(16)}`).join("\n") + "\n");
+  const lines = output.split("\n");
+  return addresses.map((_, i) => {
+    const frame = frameOf(lines[i * 2] ?? "", lines[i * 2 + 1] ?? "");
+    return frame ? [frame] : undefined;
+  });
+}
+
+// Function symbols of a file sorted by address, from its symbol table or,
+// for stripped shared libraries, its dynamic symbol table
+async function symbolTable(file: string): Promise<Array<{ address: bigint; size: bigint; name: string }>> {
+  const parse = (output: string) => output.split("\n").flatMap((line) => {
+    const match = line.match(/^([0-9a-f]+) ([0-9a-f]+) [TtWw] (.+)$/);
+    return match ? [{ address: BigInt(`0x${match[1]}`), size: BigInt(`0x${match[2]}`), name: match[3] }] : [];
+  });
+  let symbols = parse(await runWithInput("nm", ["-n", "-S", "-C", "--defined-only", file], "").catch(() => ""));
+  if (symbols.length === 0) {
+    symbols = parse(await runWithInput("nm", ["-D", "-n", "-S", "-C", "--defined-only", file], "").catch(() => ""));
+  }
+  return symbols;
+}
+
+// Function symbol containing each address. Addresses past the end of the
+// nearest symbol stay unresolved: they belong to local functions missing
+// from a dynamic symbol table, and naming them after a neighbor would mislead.
+function containingSymbols(symbols: Array<{ address: bigint; size: bigint; name: string }>, addresses: bigint[]): Array<Frame[] | undefined> {
+  return addresses.map((address) => {
+    let low = 0;
+    let high = symbols.length - 1;
+    let found = -1;
+    while (low <= high) {
+      const mid = (low + high) >> 1;
+      if (symbols[mid].address <= address) {
+        found = mid;
+        low = mid + 1;
+      } else {
+        high = mid - 1;
+      }
+    }
+    const symbol = symbols[found];
+    return symbol && address < symbol.address + symbol.size ? [{ name: symbol.name, file: "", line: 0 }] : undefined;
+  });
+}
+
+function isAddressOnly(location: Location): boolean {
+  return location.frames.length === 1 && location.frames[0].name === location.address;
+}
+
+// Pick the mapping to symbolize: by file name when given, else the one whose
+// build ID matches the binary, else the main binary (the first mapping)
+function chooseMapping(profile: Profile, elf: Elf, name?: string): Mapping | undefined {
+  if (name) {
+    const mapping = profile.mappings.find((m) => m.file === name || path.basename(m.file) === name || m.file.includes(name));
+    if (!mapping) {
+      throw new Error(`No mapping matches '${name}'; the profile maps ${profile.mappings.map((m) => m.file || "(unnamed)").join(", ") || "nothing"}`);
+    }
+    return mapping;
+  }
+  return profile.mappings.find((m) => m.buildId && elf.buildIds.includes(m.buildId)) ?? profile.mappings[0];
+}
+
+// Resolve the address-only locations of one mapping with symbols from a
+// binary or debug-info file. A build ID mismatch is an error unless forced,
+// since symbols from another build resolve to the wrong functions.
+export async function symbolizeProfile(
+  profile: Profile,
+  binary: string,
+  options: { mapping?: string; force?: boolean } = {},
+): Promise<{ profile: Profile; report: SymbolizeReport }> {
+  const file = path.resolve(binary);
+  const elf = readElf(file);
+  const mapping = chooseMapping(profile, elf, options.mapping);
+  if (mapping?.buildId && elf.buildIds.length > 0 && !elf.buildIds.includes(mapping.buildId) && !options.force) {
+    throw new Error(`Build ID mismatch: the profile's ${mapping.file || "main binary"} has ${mapping.buildId}, ${file} has ${elf.buildIds.join(" / ")}; pass force to symbolize anyway`);
+  }
+
+  const pending = [...profile.locations.values()]
+    .filter((l) => isAddressOnly(l) && (!mapping || l.mappingId === mapping.id));
+  const report: SymbolizeReport = { binary: file, mapping: mapping?.file, locations: pending.length, resolved: 0, resolvedFromGo: 0 };
+  if (pending.length === 0) {
+    return { profile, report };
+  }
+
+  const addresses = pending.map((l) => linkAddress(elf, mapping, BigInt(l.address)));
+  const frames = await addr2line(file, addresses).catch(() => addresses.map(() => undefined));
+  const missing = frames.flatMap((f, i) => (f ? [] : [i]));
+  if (missing.length > 0) {
+    const fromGo = await goAddr2line(file, missing.map((i) => addresses[i])).catch(() => []);
+    fromGo.forEach((f, j) => {
+      if (f) {
+        frames[missing[j]] = f;
+        report.resolvedFromGo++;
+      }
+    });
+  }
+
+  const locations = new Map(profile.locations);
+  pending.forEach((location, i) => {
+    const resolved = frames[i];
+    if (resolved) {
+      locations.set(location.id, { ...location, frames: resolved });
+      report.resolved++;
+    }
+  });
+  return { profile: { ...profile, locations }, report };
+}
+
+// Resolve address-only locations from the files they were mapped from, as
+// recorded in the profile, where those files exist here with the same build
+// ID: DWARF through addr2line first, then the symbol tables. This names the
+// C frames of cgo code and shared libraries like libc or libsqlite3, which
+// the Go runtime cannot symbolize.
+export async function symbolizeNative(profile: Profile): Promise<{ profile: Profile; report: SymbolizeReport }> {
+  const report: SymbolizeReport = { binary: "", locations: 0, resolved: 0, resolvedFromGo: 0 };
+  const files: string[] = [];
+  let resolvedFromSymbols = 0;
+  const locations = new Map(profile.locations);
+  for (const mapping of profile.mappings) {
+    const pending = [...profile.locations.values()].filter((l) => isAddressOnly(l) && l.mappingId === mapping.id);
+    // Pseudo-files like [vdso] have no symbols to read
+    if (pending.length === 0 || !path.isAbsolute(mapping.file) || !existsSync(mapping.file)) {
+      continue;
+    }
+    let elf: Elf;
+    try {
+      elf = readElf(mapping.file);
+    } catch {
+      continue;
+    }
+    if (mapping.buildId && elf.buildIds.length > 0 && !elf.buildIds.includes(mapping.buildId)) {
+      continue;
+    }
+    report.locations += pending.length;
+    const addresses = pending.map((l) => linkAddress(elf, mapping, BigInt(l.address)));
+    // Without debug info addr2line guesses the nearest symbol, so its answers
+    // without a file are checked against the symbol table's sizes instead
+    const frames = (await addr2line(mapping.file, addresses).catch(() => addresses.map(() => undefined)))
+      .map((f) => (f?.some((frame) => frame.file) ? f : undefined));
+    const missing = frames.flatMap((f, i) => (f ? [] : [i]));
+    if (missing.length > 0) {
+      const fromSymbols = containingSymbols(await symbolTable(mapping.file), missing.map((i) => addresses[i]));
+      fromSymbols.forEach((f, j) => {
+        if (f) {
+          frames[missing[j]] = f;
+          resolvedFromSymbols++;
+        }
+      });
+    }
+    pending.forEach((location, i) => {
+      const resolved = frames[i];
+      if (resolved) {
+        locations.set(location.id, { ...location, frames: resolved });
+        report.resolved++;
+      }
+    });
+    if (frames.some((f) => f)) {
+      files.push(mapping.file);
+    }
+  }
+  report.binary = files.join(", ");
+  report.resolvedFromSymbols = resolvedFromSymbols;
+  return { profile: report.resolved > 0 ? { ...profile, locations } : profile, report };
+}
+
+// Symbolize native frames of a freshly captured pprof file in place, so
+// cgo and shared-library time is named before the profile is analyzed and
+// catalogued. Failures leave the file as it was.
+export async function symbolizeNativeFile(file: string): Promise<SymbolizeReport | undefined> {
+  try {
+    const { profile, report } = await symbolizeNative(readProfile(file));
+    if (report.resolved > 0) {
+      writeProfile(file, profile);
+    }
+    return report;
+  } catch {
+    return undefined;
+  }
+}
+
+// Symbolize a catalogued profile or file into a new catalog entry, with a
+// binary or, without one, natively from the mapped files on this machine
+export async function symbolizeIntoCatalog(
+  ref: string,
+  binary: string | undefined,
+  options: { mapping?: string; force?: boolean } = {},
+): Promise<{ entry: CatalogEntry; profile: Profile; report: SymbolizeReport }> {
+  const source = isProfileId(ref) ? await getProfile(ref) : undefined;
+  const input = readProfile(await resolveProfilePath(ref));
+  const { profile, report } = binary ? await symbolizeProfile(input, binary, options) : await symbolizeNative(input);
+  if (report.resolved === 0) {
+    if (!binary) {
+      throw new Error(report.locations === 0
+        ? `${ref} has no address-only locations in mappings of files present on this machine; pass binaryPath for stripped or remote builds`
+        : `None of the ${report.locations} native addresses resolved; their files have no debug info or symbols, or changed since the capture`);
+    }
+    throw new Error(report.locations === 0
+      ? `${ref} has no address-only locations${report.mapping ? ` in ${report.mapping}` : ""}`
+      : `None of the ${report.locations} addresses resolved in ${report.binary}; is it the right binary?`);
+  }
+  const target = source?.target ?? path.resolve(ref);
+  const profileType = source?.profileType ?? baselineKind(profile);
+  const name = path.basename(target).replace(/\.pb(\.gz)?$|\.pprof$|\.prof$|\.go$/, "");
+  const stored = await storedProfilePath(`${name}_${profileType}_symbolized`);
+  writeProfile(stored, profile);
+  const entry = await catalogProfile(stored, {
+    target,
+    profileType,
+    commit: profileCommit(profile),
+    symbolizedFrom: source?.id ?? path.resolve(ref),
+    labels: { ...source?.labels, symbolized: binary ? path.basename(report.binary) : "native" },
+  });
+  return { entry, profile, report };
+}
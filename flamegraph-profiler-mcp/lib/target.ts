@@ -0,0 +1,161 @@
+/**
+ * Live targets: Go processes serving net/http/pprof.
+ */
+import fs from "node:fs/promises";
+import net from "node:net";
+import os from "node:os";
+import path from "node:path";
+
+// Time allowed for a single request to a target, on top of any profile duration
+const REQUEST_TIMEOUT_MS = 10_000;
+
+// Where targets serve wall-clock profiles, as fgprof's handler and the
+// sample app's wallclock.Handler do; net/http/pprof has none
+export const WALLCLOCK_ENDPOINT = "/debug/fgprof";
+
+// Where targets report the requests they have served, as this repository's
+// pkg/requests does
+export const REQUESTS_ENDPOINT = "/debug/requests";
+
+// Catalog label holding the requests a profile covers
+export const REQUESTS_LABEL = "requests";
+
+// Prefix of the catalog labels holding the requests a profile covers on each
+// route, e.g. "requests:GET /users"
+export const ROUTE_REQUESTS_PREFIX = `${REQUESTS_LABEL}:`;
+
+export interface RequestCounts {
+  total: number;
+  // By route, for targets that count them (pkg/requests' Route and Do)
+  routes: Record<string, number>;
+}
+
+// Build the URL of a pprof endpoint. The target may be a host:port, a base URL,
+// or a URL that already points at /debug/pprof. A profile starting with "/"
+// is a path of its own next to /debug/pprof, e.g. "/debug/fgprof".
+export function pprofUrl(target: string, profile: string, params: Record<string, string | number> = {}): URL {
+  const base = /^https?:\/\//.test(target) ? target : `http://${target}`;
+  const url = new URL(base);
+  const prefix = url.pathname.includes("/debug/pprof")
+    ? url.pathname.slice(0, url.pathname.indexOf("/debug/pprof"))
+    : url.pathname.replace(/\/$/, "");
+  url.pathname = profile.startsWith("/") ? `${prefix}${profile}` : `${prefix}/debug/pprof/${profile}`;
+  for (const [key, value] of Object.entries(params)) {
+    url.searchParams.set(key, String(value));
+  }
+  return url;
+}
+
+// host:port of a pprof address, with the scheme's default port filled in,
+// so differently written addresses of one process compare equal
+export function pprofAddress(target: string): string {
+  const url = pprofUrl(target, "");
+  return `${url.hostname}:${url.port || (url.protocol === "https:" ? "443" : "80")}`;
+}
+
+// Fetch a pprof endpoint, failing with a readable message on HTTP errors
+export async function fetchPprof(
+  target: string,
+  profile: string,
+  params: Record<string, string | number> = {},
+  durationSeconds = 0,
+  signal?: AbortSignal,
+): Promise<Response> {
+  const url = pprofUrl(target, profile, params);
+  const timeout = AbortSignal.timeout(REQUEST_TIMEOUT_MS + durationSeconds * 1000);
+  let response: Response;
+  try {
+    // Cancelling closes the connection, which ends the target's capture
+    response = await fetch(url, { signal: signal ? AbortSignal.any([timeout, signal]) : timeout });
+  } catch (error) {
+    signal?.throwIfAborted();
+    // fetch reports connection failures as "fetch failed" with the reason in cause
+    const cause = error instanceof Error && error.cause instanceof Error ? error.cause : error;
+    throw new Error(`Could not reach ${url}: ${cause instanceof Error ? cause.message : String(cause)}`);
+  }
+  if (response.status === 404 && profile === WALLCLOCK_ENDPOINT) {
+    throw new Error(
+      `${url} returned 404; serve wall-clock profiles there, e.g. http.Handle("${WALLCLOCK_ENDPOINT}", wallclock.Handler()) ` +
+      "with this repository's pkg/wallclock, or fgprof.Handler()",
+    );
+  }
+  if (!response.ok) {
+    const body = (await response.text()).trim();
+    throw new Error(`${url} returned ${response.status}${body ? `: ${body}` : ""}`);
+  }
+  return response;
+}
+
+// Download a binary profile (or execution trace) to a temporary file.
+// With seconds > 0 the target records or returns a delta over that window.
+export async function downloadProfile(target: string, profile: string, seconds = 0, signal?: AbortSignal): Promise<string> {
+  const response = await fetchPprof(target, profile, seconds > 0 ? { seconds } : {}, seconds, signal);
+  const file = path.join(os.tmpdir(), `${path.basename(profile)}_${Date.now()}.out`);
+  await fs.writeFile(file, Buffer.from(await response.arrayBuffer()));
+  return file;
+}
+
+// Requests the target has served since it started, or undefined when it
+// does not count them. Targets that count by route answer the routes query
+// with JSON; the others ignore it and send the plain total.
+export async function requestCounts(target: string): Promise<RequestCounts | undefined> {
+  try {
+    const response = await fetch(pprofUrl(target, REQUESTS_ENDPOINT, { routes: 1 }), { signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS) });
+    const body: unknown = response.ok ? JSON.parse(await response.text()) : undefined;
+    const counts = typeof body === "number" ? { total: body, routes: {} } : (body as RequestCounts | undefined);
+    return Number.isSafeInteger(counts?.total) && counts!.total >= 0 ? { total: counts!.total, routes: counts!.routes ?? {} } : undefined;
+  } catch {
+    return undefined;
+  }
+}
+
+// Run a capture and count the requests it covers, in total and by route, as
+// catalog labels: those served during the window for a windowed capture
+// (seconds > 0), else those served since the target started. No labels when
+// the target does not count.
+export async function countingRequests<T>(target: string, seconds: number, capture: () => Promise<T>): Promise<[T, Record<string, string>]> {
+  const before = seconds > 0 ? await requestCounts(target) : { total: 0, routes: {} };
+  const result = await capture();
+  const after = before === undefined ? undefined : await requestCounts(target);
+  if (!after || after.total - before!.total <= 0) {
+    return [result, {}];
+  }
+  const labels: Record<string, string> = { [REQUESTS_LABEL]: String(after.total - before!.total) };
+  for (const [route, count] of Object.entries(after.routes)) {
+    const served = count - (before!.routes[route] ?? 0);
+    if (served > 0) {
+      labels[`${ROUTE_REQUESTS_PREFIX}${route}`] = String(served);
+    }
+  }
+  return [result, labels];
+}
+
+// Change sampled profile rates on a target that exposes /debug/profile-rates,
+// as the sample app does. Go has no standard endpoint for this.
+export async function setProfileRates(target: string, rates: Record<string, number | undefined>): Promise<void> {
+  const url = pprofUrl(target, "", {});
+  url.pathname = url.pathname.replace(/\/debug\/pprof\/$/, "/debug/profile-rates");
+  for (const [key, value] of Object.entries(rates)) {
+    if (value !== undefined) {
+      url.searchParams.set(key, String(value));
+    }
+  }
+  const response = await fetch(url, { signal: AbortSignal.timeout(REQUEST_TIMEOUT_MS) }).catch(() => undefined);
+  if (!response?.ok) {
+    throw new Error(
+      `${url.origin} does not accept profile rate changes at /debug/profile-rates; ` +
+      "enable profiling in the target itself (runtime.SetBlockProfileRate or runtime.SetMutexProfileFraction) and capture without a rate",
+    );
+  }
+}
+
+// A port on 127.0.0.1 that was free a moment ago, for a server the profiler starts
+export async function freePort(): Promise<number> {
+  return new Promise((resolve, reject) => {
+    const server = net.createServer().listen(0, "127.0.0.1", () => {
+      const { port } = server.address() as net.AddressInfo;
+      server.close(() => resolve(port));
+    });
+    server.on("error", reject);
+  });
+}
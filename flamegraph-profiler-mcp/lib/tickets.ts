@@ -0,0 +1,215 @@
+/**
+ * Ticket filing for findings via Jira, Linear, or a generic webhook.
+ *
+ * The provider is chosen with PROFILER_TICKET_PROVIDER and configured with
+ * provider-specific environment variables (see ticketConfig).
+ */
+import fs from "node:fs/promises";
+import path from "node:path";
+import type { Finding } from "./findings.js";
+
+export type TicketProvider = "jira" | "linear" | "webhook";
+
+export interface Ticket {
+  provider: TicketProvider;
+  id: string;
+  url: string;
+  createdAt: string;
+}
+
+export interface TicketConfig {
+  provider: TicketProvider;
+  settings: Record<string, string>;
+}
+
+// Artifact files larger than this are not uploaded
+const MAX_ARTIFACT_BYTES = 10 * 1024 * 1024;
+
+const REQUIRED_SETTINGS: Record<TicketProvider, Record<string, string>> = {
+  jira: {
+    url: "PROFILER_JIRA_URL",
+    email: "PROFILER_JIRA_EMAIL",
+    token: "PROFILER_JIRA_TOKEN",
+    project: "PROFILER_JIRA_PROJECT",
+  },
+  linear: {
+    token: "PROFILER_LINEAR_TOKEN",
+    team: "PROFILER_LINEAR_TEAM",
+  },
+  webhook: {
+    url: "PROFILER_TICKET_WEBHOOK",
+  },
+};
+
+// Read the ticket provider configuration from the environment
+export function ticketConfig(env: NodeJS.ProcessEnv = process.env): TicketConfig {
+  const provider = env.PROFILER_TICKET_PROVIDER as TicketProvider | undefined;
+  if (!provider) {
+    throw new Error("No ticket provider configured; set PROFILER_TICKET_PROVIDER to jira, linear, or webhook");
+  }
+  const required = REQUIRED_SETTINGS[provider];
+  if (!required) {
+    throw new Error(`Unknown ticket provider "${provider}" (expected jira, linear, or webhook)`);
+  }
+  const missing = Object.values(required).filter((name) => !env[name]);
+  if (missing.length > 0) {
+    throw new Error(`Ticket provider ${provider} needs ${missing.join(", ")}`);
+  }
+  const settings = Object.fromEntries(Object.entries(required).map(([key, name]) => [key, env[name] as string]));
+  return { provider, settings };
+}
+
+interface Artifact {
+  name: string;
+  content: Buffer;
+}
+
+// The finding itself is always attached; extra files (profiles, traces) are optional
+async function collectArtifacts(finding: Finding, files: string[]): Promise<Artifact[]> {
+  const artifacts: Artifact[] = [
+    { name: `${finding.id}.json`, content: Buffer.from(JSON.stringify(finding, null, 2)) },
+  ];
+  for (const file of files) {
+    const stat = await fs.stat(file);
+    if (stat.size > MAX_ARTIFACT_BYTES) {
+      throw new Error(`Artifact ${file} is larger than ${MAX_ARTIFACT_BYTES / 1024 / 1024}MB`);
+    }
+    artifacts.push({ name: path.basename(file), content: await fs.readFile(file) });
+  }
+  return artifacts;
+}
+
+// Plain-text ticket description shared by all providers
+export function ticketDescription(finding: Finding): string {
+  const occurrences = (finding.occurrences ?? [])
+    .slice(-5)
+    .map((o) => `- ${o.at}: ${o.percentage}% in ${o.source}`)
+    .join("\n");
+  return [
+    finding.detail,
+    "",
+    `Severity: ${finding.severity}`,
+    `Kind: ${finding.kind} (${finding.pattern})`,
+    `Function: ${finding.function}`,
+    finding.callPath?.length ? `Call path: ${finding.callPath.join(" → ")}` : "",
+    finding.owners?.length ? `Owners: ${finding.owners.join(", ")}` : "",
+    `Seen ${finding.occurrenceCount ?? 1} time(s); recent occurrences:`,
+    occurrences,
+    "",
+    `Profiler finding ${finding.id} (fingerprint ${finding.fingerprint}).`,
+  ].filter((line, i, lines) => line !== "" || lines[i - 1] !== "").join("\n");
+}
+
+async function checkedJson(response: Response, action: string): Promise<any> {
+  const body = await response.text();
+  if (!response.ok) {
+    throw new Error(`${action} failed with ${response.status}: ${body.slice(0, 500)}`);
+  }
+  return body ? JSON.parse(body) : {};
+}
+
+async function fileJiraTicket(finding: Finding, artifacts: Artifact[], settings: Record<string, string>): Promise<Ticket> {
+  const base = settings.url.replace(/\/$/, "");
+  const auth = `Basic ${Buffer.from(`${settings.email}:${settings.token}`).toString("base64")}`;
+  const created = await checkedJson(
+    await fetch(`${base}/rest/api/2/issue`, {
+      method: "POST",
+      headers: { Authorization: auth, "Content-Type": "application/json" },
+      body: JSON.stringify({
+        fields: {
+          project: { key: settings.project },
+          issuetype: { name: "Task" },
+          summary: finding.title,
+          description: ticketDescription(finding),
+          labels: ["performance", finding.pattern],
+        },
+      }),
+    }),
+    "Creating Jira issue",
+  );
+
+  const form = new FormData();
+  for (const artifact of artifacts) {
+    form.append("file", new Blob([new Uint8Array(artifact.content)]), artifact.name);
+  }
+  await checkedJson(
+    await fetch(`${base}/rest/api/2/issue/${created.key}/attachments`, {
+      method: "POST",
+      headers: { Authorization: auth, "X-Atlassian-Token": "no-check" },
+      body: form,
+    }),
+    "Attaching artifacts to Jira issue",
+  );
+
+  return { provider: "jira", id: created.key, url: `${base}/browse/${created.key}`, createdAt: new Date().toISOString() };
+}
+
+async function fileLinearTicket(finding: Finding, artifacts: Artifact[], settings: Record<string, string>): Promise<Ticket> {
+  // Linear uploads need a signed-URL round trip per file; text artifacts are
+  // inlined in the description and binary ones are listed by name instead.
+  const inlined = artifacts.map((artifact) => {
+    const text = artifact.content.toString("utf-8");
+    return artifact.name.endsWith(".json") || !text.includes("\u0000")
+      ? `**${artifact.name}**\n\`\`\`\n${text.slice(0, 20_000)}\n\`\`\``
+      : `**${artifact.name}** (${artifact.content.length} bytes, binary; not uploaded)`;
+  });
+  const result = await checkedJson(
+    await fetch("https://api.linear.app/graphql", {
+      method: "POST",
+      headers: { Authorization: settings.token, "Content-Type": "application/json" },
+      body: JSON.stringify({
+        query: "mutation($input: IssueCreateInput!) { issueCreate(input: $input) { success issue { identifier url } } }",
+        variables: {
+          input: {
+            teamId: settings.team,
+            title: finding.title,
+            description: `${ticketDescription(finding)}\n\n${inlined.join("\n\n")}`,
+          },
+        },
+      }),
+    }),
+    "Creating Linear issue",
+  );
+  const issue = result.data?.issueCreate?.issue;
+  if (!issue) {
+    throw new Error(`Creating Linear issue failed: ${JSON.stringify(result.errors ?? result).slice(0, 500)}`);
+  }
+  return { provider: "linear", id: issue.identifier, url: issue.url, createdAt: new Date().toISOString() };
+}
+
+// POST the finding and base64 artifacts; the webhook answers with { id, url }
+async function fileWebhookTicket(finding: Finding, artifacts: Artifact[], settings: Record<string, string>): Promise<Ticket> {
+  const result = await checkedJson(
+    await fetch(settings.url, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        title: finding.title,
+        description: ticketDescription(finding),
+        finding,
+        artifacts: artifacts.map((a) => ({ name: a.name, contentBase64: a.content.toString("base64") })),
+      }),
+    }),
+    "Calling ticket webhook",
+  );
+  return {
+    provider: "webhook",
+    id: String(result.id ?? finding.id),
+    url: String(result.url ?? settings.url),
+    createdAt: new Date().toISOString(),
+  };
+}
+
+// File a ticket for a finding with the configured provider
+export async function fileTicket(finding: Finding, artifactFiles: string[] = []): Promise<Ticket> {
+  const { provider, settings } = ticketConfig();
+  const artifacts = await collectArtifacts(finding, artifactFiles);
+  switch (provider) {
+    case "jira":
+      return fileJiraTicket(finding, artifacts, settings);
+    case "linear":
+      return fileLinearTicket(finding, artifacts, settings);
+    case "webhook":
+      return fileWebhookTicket(finding, artifacts, settings);
+  }
+}
@@ -0,0 +1,108 @@
+/**
+ * pprof -top equivalent with a short natural-language summary.
+ */
+import { functionStats, percentOf } from "./flamegraph.js";
+import { describeSampleType, formatValue, stackOf, totalOf, type Profile } from "./pprof.js";
+
+export interface TopEntry {
+  name: string;
+  flat: number;
+  flatPct: number;
+  cum: number;
+  cumPct: number;
+  // Running total of flatPct down the list, like pprof's sum% column
+  sumPct: number;
+  // Caller contributing most of this function's time, if any
+  topCaller?: string;
+}
+
+export interface TopReport {
+  sampleType: string;
+  unit: string;
+  total: number;
+  functions: TopEntry[];
+  summary: string;
+}
+
+export function topReport(profile: Profile, sampleIndex: number, limit = 10): TopReport {
+  const { type, unit } = profile.sampleTypes[sampleIndex];
+  const total = totalOf(profile, sampleIndex);
+  const callers = topCallers(profile, sampleIndex);
+
+  let sumPct = 0;
+  const functions = functionStats(profile, sampleIndex)
+    .slice(0, limit)
+    .map((stat) => {
+      const flatPct = percentOf(stat.flat, total);
+      sumPct += flatPct;
+      return {
+        name: stat.name,
+        flat: stat.flat,
+        flatPct,
+        cum: stat.cum,
+        cumPct: percentOf(stat.cum, total),
+        sumPct: Math.round(sumPct * 100) / 100,
+        topCaller: callers.get(stat.name),
+      };
+    });
+
+  return {
+    sampleType: type,
+    unit,
+    total,
+    functions,
+    summary: summarize(functions, type, unit, total),
+  };
+}
+
+// Find the caller that contributes the most self time to each leaf function
+function topCallers(profile: Profile, sampleIndex: number): Map<string, string> {
+  const weights = new Map<string, Map<string, number>>();
+  for (const sample of profile.samples) {
+    const stack = stackOf(profile, sample);
+    if (stack.length < 2) {
+      continue;
+    }
+    const leaf = stack[stack.length - 1];
+    // Skip recursive frames so fibonacci is attributed to its real caller
+    let i = stack.length - 2;
+    while (i > 0 && stack[i] === leaf) {
+      i--;
+    }
+    if (stack[i] === leaf) {
+      continue;
+    }
+    const byCaller = weights.get(leaf) ?? new Map<string, number>();
+    byCaller.set(stack[i], (byCaller.get(stack[i]) ?? 0) + sample.values[sampleIndex]);
+    weights.set(leaf, byCaller);
+  }
+
+  const result = new Map<string, string>();
+  for (const [leaf, byCaller] of weights) {
+    const [caller] = [...byCaller.entries()].sort((a, b) => b[1] - a[1])[0];
+    result.set(leaf, caller);
+  }
+  return result;
+}
+
+function summarize(functions: TopEntry[], type: string, unit: string, total: number): string {
+  const what = describeSampleType(type);
+  if (functions.length === 0 || total === 0) {
+    return `The profile has no ${what} recorded.`;
+  }
+
+  const [first, second] = functions;
+  const sentences = [
+    `${first.flatPct}% of ${what} (${formatValue(first.flat, unit)} of ${formatValue(total, unit)}) is in ${first.name}` +
+      (first.topCaller ? ` called from ${first.topCaller}.` : "."),
+  ];
+  if (second) {
+    sentences.push(
+      `Next is ${second.name} at ${second.flatPct}%` +
+        (second.topCaller ? ` (called from ${second.topCaller}).` : "."),
+    );
+  }
+  const last = functions[functions.length - 1];
+  sentences.push(`The top ${functions.length} functions account for ${last.sumPct}% of ${what}.`);
+  return sentences.join(" ");
+}
@@ -0,0 +1,219 @@
+/**
+ * Execution trace summaries built from `go tool trace -d=parsed` output.
+ */
+import { execFileSync } from "node:child_process";
+import path from "node:path";
+
+export interface LatencyStats {
+  count: number;
+  // Nanoseconds
+  p50: number;
+  p90: number;
+  p99: number;
+  max: number;
+}
+
+export interface GoroutineActivity {
+  id: number;
+  // Function the goroutine was started with
+  startFunction: string;
+  // Nanoseconds spent running
+  running: number;
+  // Times the goroutine was scheduled onto a P
+  schedules: number;
+}
+
+export interface TraceSummary {
+  // Nanoseconds from the first to the last event
+  duration: number;
+  goroutines: {
+    created: number;
+    ended: number;
+    peak: number;
+    // Live goroutines at the end of each slice of the trace, offsets in nanoseconds
+    timeline: Array<{ at: number; count: number }>;
+  };
+  // Time from becoming runnable to running
+  schedulerLatency: LatencyStats;
+  gc: {
+    cycles: number;
+    // Nanoseconds spent in the concurrent mark phase
+    markTime: number;
+    stopTheWorld: LatencyStats & { total: number };
+  };
+  busiest: GoroutineActivity[];
+}
+
+// Number of points in the goroutine count timeline
+const TIMELINE_POINTS = 20;
+
+// Text dump of a runtime/trace file from the Go toolchain's trace parser; the
+// path is made absolute so one starting with "-" is not read as a flag
+export function dumpTrace(tracePath: string): string {
+  return execFileSync("go", ["tool", "trace", "-d=parsed", path.resolve(tracePath)], {
+    encoding: "utf-8",
+    stdio: ["ignore", "pipe", "ignore"],
+    maxBuffer: 1024 * 1024 * 1024,
+  });
+}
+
+// Summarize a runtime/trace file
+export function readTrace(tracePath: string): TraceSummary {
+  return summarizeTrace(dumpTrace(tracePath));
+}
+
+export function percentiles(values: number[]): LatencyStats {
+  const sorted = [...values].sort((a, b) => a - b);
+  const at = (p: number) => (sorted.length === 0 ? 0 : sorted[Math.min(sorted.length - 1, Math.floor(p * sorted.length))]);
+  return { count: sorted.length, p50: at(0.5), p90: at(0.9), p99: at(0.99), max: sorted[sorted.length - 1] ?? 0 };
+}
+
+export const EVENT_LINE = /^M=\S+ P=\S+ G=\S+ (\w+) Time=(\d+)(.*)$/;
+
+// Summarize the text dump of a parsed trace (one event per "M=..." line,
+// followed by indented stacks)
+export function summarizeTrace(parsed: string): TraceSummary {
+  const lines = parsed.split("\n");
+  let start: number | undefined;
+  let end = 0;
+
+  const live = new Set<number>();
+  const counts: Array<{ time: number; count: number }> = [];
+  let created = 0;
+  let ended = 0;
+  let peak = 0;
+
+  const runnableSince = new Map<number, number>();
+  const runningSince = new Map<number, number>();
+  const latencies: number[] = [];
+  const activity = new Map<number, GoroutineActivity>();
+  const activityOf = (id: number) => {
+    let entry = activity.get(id);
+    if (!entry) {
+      entry = { id, startFunction: "(started before trace)", running: 0, schedules: 0 };
+      activity.set(id, entry);
+    }
+    return entry;
+  };
+
+  let gcCycles = 0;
+  let markTime = 0;
+  const markSince = new Map<string, number>();
+  const stwSince = new Map<string, number>();
+  const pauses: number[] = [];
+
+  for (let i = 0; i < lines.length; i++) {
+    const event = lines[i].match(EVENT_LINE);
+    if (!event) {
+      continue;
+    }
+    const [, kind, timeText, rest] = event;
+    const time = Number(timeText);
+    start ??= time;
+    end = Math.max(end, time);
+
+    if (kind === "StateTransition") {
+      const transition = rest.match(/GoID=(\d+) (\w+)->(\w+)/);
+      if (!transition) {
+        continue;
+      }
+      const id = Number(transition[1]);
+      const [, , from, to] = transition;
+
+      if (from === "NotExist" || from === "Undetermined") {
+        if (!live.has(id)) {
+          live.add(id);
+          if (from === "NotExist") {
+            created++;
+            // The transition stack of a creation is the goroutine's start function
+            if (lines[i + 1]?.startsWith("TransitionStack=") && lines[i + 2]) {
+              activityOf(id).startFunction = lines[i + 2].trim().split(" @ ")[0];
+            }
+          }
+        }
+      }
+      if (to === "NotExist") {
+        live.delete(id);
+        ended++;
+      }
+      peak = Math.max(peak, live.size);
+      counts.push({ time, count: live.size });
+
+      if (from === "Running") {
+        const since = runningSince.get(id);
+        if (since !== undefined) {
+          activityOf(id).running += time - since;
+          runningSince.delete(id);
+        }
+      }
+      if (to === "Runnable" && from !== "Undetermined") {
+        runnableSince.set(id, time);
+      }
+      if (to === "Running") {
+        runningSince.set(id, time);
+        activityOf(id).schedules++;
+        const since = runnableSince.get(id);
+        if (from === "Runnable" && since !== undefined) {
+          latencies.push(time - since);
+        }
+        runnableSince.delete(id);
+      }
+    } else if (kind === "RangeBegin" || kind === "RangeEnd") {
+      const range = rest.match(/Name="([^"]*)" Scope=(\S+)/);
+      if (!range) {
+        continue;
+      }
+      const [, name, scope] = range;
+      if (name === "GC concurrent mark phase") {
+        const since = markSince.get(scope);
+        if (kind === "RangeBegin") {
+          gcCycles++;
+          markSince.set(scope, time);
+        } else if (since !== undefined) {
+          markTime += time - since;
+          markSince.delete(scope);
+        }
+      } else if (name.startsWith("stop-the-world")) {
+        const key = `${name}|${scope}`;
+        const since = stwSince.get(key);
+        if (kind === "RangeBegin") {
+          stwSince.set(key, time);
+        } else if (since !== undefined) {
+          pauses.push(time - since);
+          stwSince.delete(key);
+        }
+      }
+    }
+  }
+
+  // Goroutines still running when the trace ended
+  for (const [id, since] of runningSince) {
+    activityOf(id).running += end - since;
+  }
+
+  const origin = start ?? 0;
+  const duration = end - origin;
+  const timeline: Array<{ at: number; count: number }> = [];
+  let cursor = 0;
+  let current = 0;
+  for (let point = 1; point <= TIMELINE_POINTS; point++) {
+    const at = Math.round((duration * point) / TIMELINE_POINTS);
+    while (cursor < counts.length && counts[cursor].time - origin <= at) {
+      current = counts[cursor].count;
+      cursor++;
+    }
+    timeline.push({ at, count: current });
+  }
+
+  return {
+    duration,
+    goroutines: { created, ended, peak, timeline },
+    schedulerLatency: percentiles(latencies),
+    gc: {
+      cycles: gcCycles,
+      markTime,
+      stopTheWorld: { ...percentiles(pauses), total: pauses.reduce((sum, p) => sum + p, 0) },
+    },
+    busiest: [...activity.values()].sort((a, b) => b.running - a.running).slice(0, 10),
+  };
+}
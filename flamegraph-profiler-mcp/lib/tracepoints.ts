@@ -0,0 +1,258 @@
+/**
+ * Targeted function tracing: attach Delve to a running Go process, set a
+ * tracepoint on one function and count its calls, callers and argument
+ * values over a time window. Nothing is recompiled; the process keeps
+ * running after the window.
+ */
+import { resolveProfilePath } from "./catalog.js";
+import { attachProcess, type DelveBreakpoint, type DelveState, type DelveThread, type DelveVariable, type LoadConfig } from "./delve.js";
+import { functionStats } from "./flamegraph.js";
+import { formatValue, readProfile, sampleIndexOf, totalOf } from "./pprof.js";
+
+export interface ArgumentValue {
+  value: string;
+  count: number;
+}
+
+export interface ArgumentSummary {
+  name: string;
+  type: string;
+  // Most frequent values first
+  values: ArgumentValue[];
+  // Distinct values seen, up to MAX_DISTINCT
+  distinct: number;
+  // Range of numeric values, or of lengths for strings, slices and maps
+  measure?: "value" | "len";
+  min?: number;
+  max?: number;
+  mean?: number;
+}
+
+export interface CallerCount {
+  name: string;
+  count: number;
+}
+
+// The traced function's share of a profile, and its cost per call when the
+// profile's duration is known and its call rate matches the traced one
+export interface ProfileShare {
+  profileId: string;
+  sampleType: string;
+  unit: string;
+  flatPct: number;
+  cumPct: number;
+  // Cumulative value per call, in the sample unit
+  perCall?: number;
+}
+
+export interface FunctionTrace {
+  pid: number;
+  function: string;
+  seconds: number;
+  calls: number;
+  callsPerSecond: number;
+  // Tracing stopped at MAX_CALLS
+  truncated: boolean;
+  // The process exited during the window
+  exited: boolean;
+  callers: CallerCount[];
+  arguments: ArgumentSummary[];
+  profile?: ProfileShare;
+}
+
+// Calls recorded before tracing stops; each one stops the process briefly
+const MAX_CALLS = 100_000;
+
+// Distinct values tracked per argument; later new values count as "other"
+const MAX_DISTINCT = 1000;
+
+// Arguments are summarized, so only scalars and lengths are loaded
+const ARG_LOAD: LoadConfig = {
+  FollowPointers: false,
+  MaxVariableRecurse: 0,
+  MaxStringLen: 64,
+  MaxArrayValues: 0,
+  MaxStructFields: 0,
+};
+
+// reflect.Kind values Delve reports
+const KIND_BOOL = 1;
+const KIND_COMPLEX64 = 15;
+const KIND_ARRAY = 17;
+const KIND_CHAN = 18;
+const KIND_MAP = 21;
+const KIND_SLICE = 23;
+const KIND_STRING = 24;
+
+interface ArgumentState {
+  name: string;
+  type: string;
+  counts: Map<string, number>;
+  measure?: "value" | "len";
+  min: number;
+  max: number;
+  sum: number;
+  measured: number;
+}
+
+// A short, stable rendering of one argument value, and the number it measures
+function describeValue(v: DelveVariable): { text: string; measure?: "value" | "len"; n?: number } {
+  if (v.unreadable) {
+    return { text: "<unreadable>" };
+  }
+  if (v.kind === KIND_STRING) {
+    return { text: JSON.stringify(v.value) + (v.len > v.value.length ? "…" : ""), measure: "len", n: v.len };
+  }
+  if ([KIND_ARRAY, KIND_CHAN, KIND_MAP, KIND_SLICE].includes(v.kind)) {
+    return { text: `len=${v.len}`, measure: "len", n: v.len };
+  }
+  if (v.kind > KIND_BOOL && v.kind < KIND_COMPLEX64 && Number.isFinite(Number(v.value))) {
+    return { text: v.value, measure: "value", n: Number(v.value) };
+  }
+  return { text: v.value || v.type };
+}
+
+function recordArgument(states: Map<string, ArgumentState>, v: DelveVariable) {
+  let state = states.get(v.name);
+  if (!state) {
+    state = { name: v.name, type: v.type, counts: new Map(), min: Infinity, max: -Infinity, sum: 0, measured: 0 };
+    states.set(v.name, state);
+  }
+  const { text, measure, n } = describeValue(v);
+  const key = state.counts.has(text) || state.counts.size < MAX_DISTINCT ? text : "other";
+  state.counts.set(key, (state.counts.get(key) ?? 0) + 1);
+  if (measure && n !== undefined) {
+    state.measure = measure;
+    state.min = Math.min(state.min, n);
+    state.max = Math.max(state.max, n);
+    state.sum += n;
+    state.measured++;
+  }
+}
+
+function summarize(state: ArgumentState, limit: number): ArgumentSummary {
+  const values = [...state.counts.entries()]
+    .map(([value, count]) => ({ value, count }))
+    .sort((a, b) => b.count - a.count)
+    .slice(0, limit);
+  return {
+    name: state.name,
+    type: state.type,
+    values,
+    distinct: state.counts.size,
+    ...(state.measured > 0
+      ? { measure: state.measure, min: state.min, max: state.max, mean: Math.round((state.sum / state.measured) * 100) / 100 }
+      : {}),
+  };
+}
+
+// Share of the function in a catalogued or local profile, with the profile's
+// cumulative value per second for the cost per call
+async function profileShare(ref: string, name: string, sampleType?: string): Promise<{ share: ProfileShare; cumPerSecond?: number }> {
+  const profile = readProfile(await resolveProfilePath(ref));
+  const sampleIndex = sampleIndexOf(profile, sampleType);
+  const { type, unit } = profile.sampleTypes[sampleIndex];
+  const total = totalOf(profile, sampleIndex) || 1;
+  // Closures appear in profiles under their display name
+  const closure = [...profile.locations.values()].flatMap((l) => l.frames).find((f) => f.symbol === name);
+  const stat = functionStats(profile, sampleIndex).find((s) => s.name === (closure?.name ?? name));
+  if (!stat) {
+    throw new Error(`${name} does not appear in profile ${ref}`);
+  }
+  const percent = (value: number) => Math.round((value / total) * 10000) / 100;
+  return {
+    share: { profileId: ref, sampleType: type, unit, flatPct: percent(stat.flat), cumPct: percent(stat.cum) },
+    cumPerSecond: profile.durationSeconds ? stat.cum / profile.durationSeconds : undefined,
+  };
+}
+
+// Trace calls of a function in a running process for a number of seconds
+export async function traceFunction(options: {
+  pid: number;
+  function: string;
+  seconds: number;
+  limit: number;
+  profileRef?: string;
+  sampleType?: string;
+  signal?: AbortSignal;
+}): Promise<FunctionTrace> {
+  // Read the profile first, so a bad reference fails before the process is stopped
+  const reference = options.profileRef ? await profileShare(options.profileRef, options.function, options.sampleType) : undefined;
+  options.signal?.throwIfAborted();
+  const client = await attachProcess(options.pid);
+  const callers = new Map<string, number>();
+  const args = new Map<string, ArgumentState>();
+  let calls = 0;
+  let exited = false;
+  const started = Date.now();
+  const end = started + options.seconds * 1000;
+  const over = () => Date.now() >= end || options.signal?.aborted === true;
+  // Continue only returns when the process stops, so halt it once the window
+  // is over or the call is cancelled; repeated in case a halt lands between
+  // two continues. Either way Delve detaches normally, removing the
+  // breakpoint, so the process keeps running.
+  const halter = setInterval(() => {
+    if (over()) {
+      void client.call("Command", { name: "halt" }).catch(() => undefined);
+    }
+  }, 250);
+  try {
+    const { Breakpoint } = await client.call<{ Breakpoint: DelveBreakpoint }>("CreateBreakpoint", {
+      Breakpoint: { functionName: options.function, continue: true, stacktrace: 2, LoadArgs: ARG_LOAD },
+    });
+    const hit = (t: DelveThread) => t.breakPoint?.id === Breakpoint.id && t.breakPointInfo;
+    while (!over() && calls < MAX_CALLS) {
+      const { State } = await client.call<{ State: DelveState }>("Command", { name: "continue" });
+      if (State.exited) {
+        exited = true;
+        break;
+      }
+      for (const thread of (State.Threads ?? []).filter(hit)) {
+        calls++;
+        const caller = thread.breakPointInfo?.stacktrace?.[1]?.function?.name;
+        if (caller) {
+          callers.set(caller, (callers.get(caller) ?? 0) + 1);
+        }
+        for (const arg of thread.breakPointInfo?.arguments ?? []) {
+          recordArgument(args, arg);
+        }
+      }
+    }
+  } finally {
+    clearInterval(halter);
+    await client.close();
+  }
+  options.signal?.throwIfAborted();
+
+  const seconds = Math.min(options.seconds, (Date.now() - started) / 1000);
+  const callsPerSecond = seconds > 0 ? Math.round((calls / seconds) * 100) / 100 : 0;
+  return {
+    pid: options.pid,
+    function: options.function,
+    seconds,
+    calls,
+    callsPerSecond,
+    truncated: calls >= MAX_CALLS,
+    exited,
+    callers: [...callers.entries()].map(([name, count]) => ({ name, count })).sort((a, b) => b.count - a.count),
+    arguments: [...args.values()].map((state) => summarize(state, options.limit)),
+    profile: reference && {
+      ...reference.share,
+      perCall: reference.cumPerSecond !== undefined && callsPerSecond > 0 ? reference.cumPerSecond / callsPerSecond : undefined,
+    },
+  };
+}
+
+// One line per argument: type, value range and the most frequent values
+export function formatArgument(a: ArgumentSummary): string {
+  const range = a.measure
+    ? `; ${a.measure === "len" ? "length" : "value"} ${a.min}–${a.max}, mean ${a.mean}`
+    : "";
+  const common = a.values.map((v) => `${v.value} ×${v.count}`).join(", ");
+  return `${a.name} (${a.type}): ${a.distinct}${a.distinct >= MAX_DISTINCT ? "+" : ""} distinct${range}; most frequent: ${common}`;
+}
+
+export function formatProfileShare(share: ProfileShare, name: string): string {
+  const perCall = share.perCall !== undefined ? `; ≈ ${formatValue(share.perCall, share.unit)} per call` : "";
+  return `📊 In ${share.profileId} (${share.sampleType}), ${name} is ${share.cumPct}% cumulative and ${share.flatPct}% flat${perCall}`;
+}
@@ -0,0 +1,232 @@
+/**
+ * In-process profile transformations: merging, filtering and scaling.
+ */
+import type { Frame, Location, Mapping, Profile, Sample } from "./pprof.js";
+import { isKernelFrame } from "./perf.js";
+
+function sameSampleTypes(a: Profile, b: Profile): boolean {
+  return a.sampleTypes.length === b.sampleTypes.length &&
+    a.sampleTypes.every((t, i) => t.type === b.sampleTypes[i].type && t.unit === b.sampleTypes[i].unit);
+}
+
+// Merge profiles of the same kind into one, like `pprof -proto a b`.
+// Identical locations and mappings are shared and samples with the same
+// stack and labels are combined, and samples that cancel out are dropped.
+// Durations add up; the earliest start wins.
+export function mergeProfiles(profiles: Profile[]): Profile {
+  if (profiles.length === 0) {
+    throw new Error("No profiles to merge");
+  }
+  const [first] = profiles;
+  const mismatched = profiles.find((p) => !sameSampleTypes(first, p));
+  if (mismatched) {
+    const describe = (p: Profile) => p.sampleTypes.map((t) => `${t.type}/${t.unit}`).join(" ");
+    throw new Error(`Cannot merge profiles with different sample types (${describe(first)} vs ${describe(mismatched)})`);
+  }
+
+  const mappings: Mapping[] = [];
+  const mappingIds = new Map<string, number>();
+  const locations = new Map<number, Location>();
+  const locationIds = new Map<string, number>();
+  const samples = new Map<string, Sample>();
+
+  for (const profile of profiles) {
+    const mappingRemap = new Map<number, number>();
+    for (const mapping of profile.mappings) {
+      const key = [mapping.start, mapping.limit, mapping.offset, mapping.file, mapping.buildId].join("|");
+      let id = mappingIds.get(key);
+      if (id === undefined) {
+        id = mappings.length + 1;
+        mappingIds.set(key, id);
+        mappings.push({ ...mapping, id });
+      }
+      mappingRemap.set(mapping.id, id);
+    }
+
+    const locationRemap = new Map<number, number>();
+    for (const location of profile.locations.values()) {
+      const mappingId = mappingRemap.get(location.mappingId) ?? 0;
+      const frames = location.frames.map((f) => `${f.name}:${f.file}:${f.line}`).join(";");
+      const key = `${mappingId}|${location.address}|${frames}`;
+      let id = locationIds.get(key);
+      if (id === undefined) {
+        id = locations.size + 1;
+        locationIds.set(key, id);
+        locations.set(id, { ...location, id, mappingId, frames: location.frames.map((f): Frame => ({ ...f })) });
+      }
+      locationRemap.set(location.id, id);
+    }
+
+    for (const sample of profile.samples) {
+      const ids = sample.locationIds.map((id) => locationRemap.get(id) ?? id);
+      const key = `${ids.join(",")}|${JSON.stringify(sample.labels)}|${JSON.stringify(sample.numLabels ?? {})}`;
+      const existing = samples.get(key);
+      if (existing) {
+        sample.values.forEach((value, i) => (existing.values[i] += value));
+      } else {
+        samples.set(key, { ...sample, values: [...sample.values], locationIds: ids });
+      }
+    }
+  }
+
+  const starts = profiles.map((p) => p.timeNanos).filter((t): t is number => t !== undefined);
+  const durations = profiles.map((p) => p.durationSeconds).filter((d): d is number => d !== undefined);
+  return {
+    ...first,
+    samples: [...samples.values()].filter((sample) => sample.values.some((v) => v !== 0)),
+    locations,
+    mappings,
+    period: Math.max(...profiles.map((p) => p.period)),
+    timeNanos: starts.length > 0 ? Math.min(...starts) : undefined,
+    durationSeconds: durations.length > 0 ? durations.reduce((sum, d) => sum + d, 0) : undefined,
+    comments: [...new Set(profiles.flatMap((p) => p.comments ?? []))],
+  };
+}
+
+// Keep only the samples a predicate accepts, dropping locations and mappings
+// no longer referenced. The predicate gets the sample's frames innermost first.
+export function filterSamples(profile: Profile, keep: (sample: Sample, frames: Frame[]) => boolean): Profile {
+  const samples = profile.samples.filter((sample) =>
+    keep(sample, sample.locationIds.flatMap((id) => profile.locations.get(id)?.frames ?? [])),
+  );
+  const usedLocations = new Set(samples.flatMap((s) => s.locationIds));
+  const locations = new Map([...profile.locations].filter(([id]) => usedLocations.has(id)));
+  const usedMappings = new Set([...locations.values()].map((l) => l.mappingId));
+  return {
+    ...profile,
+    samples,
+    locations,
+    mappings: profile.mappings.filter((m) => usedMappings.has(m.id)),
+  };
+}
+
+// Multiply every sample value by a factor, e.g. to normalize captures of
+// different lengths or to negate a baseline before merging into a diff
+export function scaleProfile(profile: Profile, factor: number): Profile {
+  return {
+    ...profile,
+    samples: profile.samples
+      .map((sample) => ({ ...sample, values: sample.values.map((v) => Math.round(v * factor)) }))
+      .filter((sample) => sample.values.some((v) => v !== 0)),
+  };
+}
+
+// pprof-style regular expression filters on function names
+export interface FrameFilters {
+  // Keep only samples with a frame matching
+  focus?: string;
+  // Drop samples with a frame matching
+  ignore?: string;
+  // Keep only frames matching, removing the others from every stack
+  show?: string;
+  // Remove frames matching from every stack
+  hide?: string;
+  // Fold generic instantiations into one frame per function, e.g.
+  // sort.Sort[go.shape.int] and sort.Sort[go.shape.string] into sort.Sort[...]
+  mergeGenerics?: boolean;
+  // Remove kernel frames of mixed-mode perf profiles, charging kernel time
+  // to the Go frame that entered the kernel
+  hideKernel?: boolean;
+}
+
+const FILTER_NAMES = ["focus", "ignore", "show", "hide"] as const;
+
+export function hasFrameFilters(filters: FrameFilters): boolean {
+  return FILTER_NAMES.some((name) => filters[name]) || Boolean(filters.mergeGenerics) || Boolean(filters.hideKernel);
+}
+
+// Function name with the type arguments of generic instantiations elided, as
+// the Go runtime itself prints them since Go 1.21: main.Map[go.shape.int,go.shape.string]
+// and pkg.(*List[go.shape.int]).Push become main.Map[...] and pkg.(*List[...]).Push.
+// Type arguments nest (map[string]int, func() []T), so brackets are matched.
+export function mergeGenericName(name: string): string {
+  if (!name.includes("[")) {
+    return name;
+  }
+  let result = "";
+  for (let i = 0; i < name.length; i++) {
+    if (name[i] === "[" && i > 0 && /[\w)]/.test(name[i - 1])) {
+      let depth = 1;
+      let j = i + 1;
+      for (; j < name.length && depth > 0; j++) {
+        if (name[j] === "[") depth++;
+        else if (name[j] === "]") depth--;
+      }
+      if (depth === 0) {
+        result += "[...]";
+        i = j - 1;
+        continue;
+      }
+    }
+    result += name[i];
+  }
+  return result;
+}
+
+// Rename every frame of a generic instantiation to its merged name, so
+// instantiations add up in top functions, flamegraphs and diffs
+export function mergeGenerics(profile: Profile): Profile {
+  const locations = new Map<number, Location>();
+  for (const [id, location] of profile.locations) {
+    const merged = location.frames.some((f) => mergeGenericName(f.name) !== f.name);
+    locations.set(id, merged ? { ...location, frames: location.frames.map((f) => ({ ...f, name: mergeGenericName(f.name) })) } : location);
+  }
+  return { ...profile, locations };
+}
+
+function compileFilter(name: string, pattern: string): RegExp {
+  try {
+    return new RegExp(pattern);
+  } catch (error) {
+    throw new Error(`Invalid ${name} regex '${pattern}': ${(error as Error).message}`);
+  }
+}
+
+// Apply focus, ignore, show and hide like pprof's options of the same names.
+// Focus and ignore select whole samples; show and hide drop frames from the
+// stacks that remain, and locations left without frames are dropped too.
+// Generic instantiations are merged first, so the regexes see merged names;
+// kernel frames are hidden along with those matching hide.
+export function applyFrameFilters(profile: Profile, filters: FrameFilters): Profile {
+  if (!hasFrameFilters(filters)) {
+    return profile;
+  }
+  if (filters.mergeGenerics) {
+    profile = mergeGenerics(profile);
+  }
+  const focus = filters.focus ? compileFilter("focus", filters.focus) : undefined;
+  const ignore = filters.ignore ? compileFilter("ignore", filters.ignore) : undefined;
+  const show = filters.show ? compileFilter("show", filters.show) : undefined;
+  const hide = filters.hide ? compileFilter("hide", filters.hide) : undefined;
+
+  let filtered = focus || ignore
+    ? filterSamples(profile, (_, frames) =>
+      (!focus || frames.some((f) => focus.test(f.name))) && !(ignore && frames.some((f) => ignore.test(f.name))))
+    : profile;
+
+  if (show || hide || filters.hideKernel) {
+    const locations = new Map<number, Location>();
+    for (const [id, location] of filtered.locations) {
+      const frames = location.frames.filter((f) =>
+        (!show || show.test(f.name)) && !(hide && hide.test(f.name)) && !(filters.hideKernel && isKernelFrame(f.name)));
+      if (frames.length > 0) {
+        locations.set(id, { ...location, frames });
+      }
+    }
+    filtered = {
+      ...filtered,
+      locations,
+      samples: filtered.samples.map((sample) => ({ ...sample, locationIds: sample.locationIds.filter((id) => locations.has(id)) })),
+    };
+  }
+  return filtered;
+}
+
+// Short description of the filters in effect, e.g. "focus=pipeline, hide=^runtime\."
+export function describeFrameFilters(filters: FrameFilters): string {
+  return [
+    ...(filters.mergeGenerics ? ["generics merged"] : []),
+    ...(filters.hideKernel ? ["kernel frames hidden"] : []),
+    ...FILTER_NAMES.filter((name) => filters[name]).map((name) => `${name}=${filters[name]}`),
+  ].join(", ");
+}
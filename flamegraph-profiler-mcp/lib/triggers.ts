@@ -0,0 +1,283 @@
+/**
+ * Adaptive capture triggers: watch a target's CPU or memory use and, once it
+ * stays above a threshold for a while, capture profiles while the incident is
+ * still happening instead of after it.
+ */
+import { execFile } from "node:child_process";
+import { randomBytes } from "node:crypto";
+import { existsSync } from "node:fs";
+import fs from "node:fs/promises";
+import { promisify } from "node:util";
+import { recordCapture } from "./captures.js";
+import { keepProfile } from "./catalog.js";
+import { containerStats } from "./docker.js";
+import { topFunctionsOf } from "./flamegraph.js";
+import { withCaptureSlot } from "./limits.js";
+import { formatValue, readProfile, sampleIndexOf, toBaseUnit, totalOf } from "./pprof.js";
+import { countingRequests, downloadProfile, pprofAddress } from "./target.js";
+
+const execFileAsync = promisify(execFile);
+
+export type TriggerMetric = "cpu" | "rss";
+
+export const TRIGGER_PROFILE_TYPES = ["cpu", "heap", "goroutine"] as const;
+export type TriggerProfileType = (typeof TRIGGER_PROFILE_TYPES)[number];
+
+export interface TriggerFiring {
+  at: string;
+  // Metric value when the trigger fired: percent of one core or bytes
+  value: number;
+  // Catalog IDs of the profiles captured, by type
+  profiles: Partial<Record<TriggerProfileType, string>>;
+  // Capture failures, by type
+  errors: Partial<Record<TriggerProfileType, string>>;
+}
+
+export interface Trigger {
+  id: string;
+  // Live pprof address profiles are captured from
+  target: string;
+  // Where the metric is read: a local process or a Docker container
+  pid?: number;
+  container?: string;
+  metric: TriggerMetric;
+  // Percent of one core for cpu, bytes for rss
+  threshold: number;
+  // Seconds the metric must stay above the threshold before a capture
+  forSeconds: number;
+  profileTypes: TriggerProfileType[];
+  // CPU profile window in seconds
+  cpuSeconds: number;
+  // Seconds after a capture during which the trigger does not fire again
+  cooldownSeconds: number;
+  createdAt: string;
+  // Latest reading, and since when it has been above the threshold
+  value?: number;
+  breachingSince?: string;
+  // Latest stats failure, cleared by the next successful reading
+  error?: string;
+  fired: number;
+  last?: TriggerFiring;
+}
+
+interface TriggerState extends Trigger {
+  timer?: NodeJS.Timeout;
+  capturing: boolean;
+  // Previous CPU time reading of a local process, for the usage in between
+  previousCpu?: { at: number; seconds: number };
+}
+
+// Time between stats readings
+const POLL_MS = 1000;
+
+// Triggers active at once; each one reads stats every second
+const MAX_TRIGGERS = 16;
+
+const ENDPOINTS: Record<TriggerProfileType, string> = { cpu: "profile", heap: "heap", goroutine: "goroutine" };
+
+const triggers = new Map<string, TriggerState>();
+
+// Clock ticks per second of /proc/<pid>/stat times; 100 on every mainstream Linux
+const CLOCK_TICKS = 100;
+
+// CPU time used so far (seconds) and resident memory (bytes) of a local process
+async function processUsage(pid: number): Promise<{ cpuSeconds?: number; cpuPct?: number; rssBytes: number }> {
+  if (existsSync("/proc")) {
+    let stat: string;
+    let status: string;
+    try {
+      [stat, status] = await Promise.all([
+        fs.readFile(`/proc/${pid}/stat`, "utf8"),
+        fs.readFile(`/proc/${pid}/status`, "utf8"),
+      ]);
+    } catch {
+      throw new Error(`No process ${pid}`);
+    }
+    // Fields after the parenthesized command name, which may contain spaces
+    const fields = stat.slice(stat.lastIndexOf(")") + 2).split(" ");
+    const ticks = Number(fields[11]) + Number(fields[12]);
+    const rss = status.match(/^VmRSS:\s+(\d+) kB/m);
+    return { cpuSeconds: ticks / CLOCK_TICKS, rssBytes: rss ? Number(rss[1]) * 1024 : 0 };
+  }
+  // Without /proc (macOS), ps reports a recent CPU percentage directly
+  try {
+    const { stdout } = await execFileAsync("ps", ["-o", "%cpu=,rss=", "-p", String(pid)]);
+    const [cpu, rss] = stdout.trim().split(/\s+/).map(Number);
+    return { cpuPct: cpu, rssBytes: rss * 1024 };
+  } catch {
+    throw new Error(`No process ${pid}`);
+  }
+}
+
+// Read the trigger's metric; undefined until a CPU rate can be computed
+async function readMetric(state: TriggerState): Promise<number | undefined> {
+  if (state.container) {
+    const stats = await containerStats(state.container);
+    return state.metric === "cpu" ? stats.cpuPct : stats.rssBytes;
+  }
+  const usage = await processUsage(state.pid!);
+  if (state.metric === "rss") {
+    return usage.rssBytes;
+  }
+  if (usage.cpuSeconds === undefined) {
+    return usage.cpuPct;
+  }
+  const now = Date.now();
+  const previous = state.previousCpu;
+  state.previousCpu = { at: now, seconds: usage.cpuSeconds };
+  return previous && now > previous.at
+    ? Math.round(((usage.cpuSeconds - previous.seconds) / ((now - previous.at) / 1000)) * 1000) / 10
+    : undefined;
+}
+
+function publicView(state: TriggerState): Trigger {
+  const { timer: _timer, capturing: _capturing, previousCpu: _previousCpu, ...trigger } = state;
+  return trigger;
+}
+
+// Capture the trigger's profiles from its target, the CPU profile and the
+// others at once so they cover the same moment
+async function capture(state: TriggerState, value: number): Promise<TriggerFiring> {
+  const firing: TriggerFiring = { at: new Date().toISOString(), value, profiles: {}, errors: {} };
+  const reason = `${state.metric} ${formatMetric(state.metric, value)} for ${state.forSeconds}s`;
+  const captureAll = () => Promise.all(state.profileTypes.map(async (profileType) => {
+    let file: string | undefined;
+    try {
+      const seconds = profileType === "cpu" ? state.cpuSeconds : 0;
+      let requestLabels: Record<string, string>;
+      [file, requestLabels] = await countingRequests(state.target, seconds, () => downloadProfile(state.target, ENDPOINTS[profileType], seconds));
+      const profile = readProfile(file);
+      const sampleIndex = sampleIndexOf(profile);
+      const captured = await recordCapture({
+        target: state.target,
+        profileType,
+        duration: seconds,
+        total: toBaseUnit(totalOf(profile, sampleIndex), profile.sampleTypes[sampleIndex].unit),
+        unit: profileType === "cpu" ? "seconds" : profileType === "heap" ? "bytes" : "count",
+        topFunctions: topFunctionsOf(profile, sampleIndex),
+        issues: 0,
+      }).catch(() => undefined);
+      const entry = await keepProfile(file, `${state.target}_${profileType}`, {
+        target: state.target,
+        profileType,
+        captureId: captured?.id,
+        // Lets list_profiles find the incident's profiles
+        labels: { trigger: state.id, reason, ...requestLabels },
+      });
+      firing.profiles[profileType] = entry.id;
+    } catch (error) {
+      firing.errors[profileType] = error instanceof Error ? error.message : String(error);
+    } finally {
+      if (file) await fs.unlink(file).catch(() => undefined);
+    }
+  }));
+  try {
+    // One slot for all the profiles, which are meant to run at once
+    await withCaptureSlot(pprofAddress(state.target), captureAll);
+  } catch (error) {
+    for (const profileType of state.profileTypes) {
+      firing.errors[profileType] = error instanceof Error ? error.message : String(error);
+    }
+  }
+  return firing;
+}
+
+async function poll(state: TriggerState, onFire: (trigger: Trigger, firing: TriggerFiring) => void): Promise<void> {
+  let value: number | undefined;
+  try {
+    value = await readMetric(state);
+    state.error = undefined;
+  } catch (error) {
+    state.error = error instanceof Error ? error.message : String(error);
+  }
+  if (!triggers.has(state.id)) return;
+
+  if (value !== undefined) {
+    state.value = value;
+    if (value < state.threshold) {
+      state.breachingSince = undefined;
+    } else {
+      state.breachingSince ??= new Date().toISOString();
+      const sustained = Date.now() - Date.parse(state.breachingSince) >= state.forSeconds * 1000;
+      const cooling = state.last !== undefined && Date.now() - Date.parse(state.last.at) < state.cooldownSeconds * 1000;
+      if (sustained && !cooling && !state.capturing) {
+        state.capturing = true;
+        // Captures run alongside polling, so a long CPU profile does not stall the readings
+        void capture(state, value).then((firing) => {
+          state.capturing = false;
+          state.fired++;
+          state.last = firing;
+          state.breachingSince = undefined;
+          if (triggers.has(state.id)) onFire(publicView(state), firing);
+        });
+      }
+    }
+  }
+  if (triggers.has(state.id)) {
+    state.timer = setTimeout(() => void poll(state, onFire), POLL_MS);
+    state.timer.unref();
+  }
+}
+
+// Start watching a target's CPU or memory use. Resolves after the first
+// reading, so a wrong pid or container fails right away.
+export async function addTrigger(
+  options: Omit<Trigger, "id" | "createdAt" | "fired" | "value" | "breachingSince" | "error" | "last">,
+  onFire: (trigger: Trigger, firing: TriggerFiring) => void,
+): Promise<Trigger> {
+  if ((options.pid === undefined) === (options.container === undefined)) {
+    throw new Error("Pass either pid or container, the process or container whose stats to watch");
+  }
+  if (triggers.size >= MAX_TRIGGERS) {
+    throw new Error(`${MAX_TRIGGERS} triggers are already active; remove one with remove_trigger`);
+  }
+  const state: TriggerState = {
+    id: `t_${randomBytes(3).toString("hex")}`,
+    ...options,
+    createdAt: new Date().toISOString(),
+    fired: 0,
+    capturing: false,
+  };
+  state.value = await readMetric(state);
+  triggers.set(state.id, state);
+  state.timer = setTimeout(() => void poll(state, onFire), POLL_MS);
+  state.timer.unref();
+  return publicView(state);
+}
+
+export function removeTrigger(id: string): Trigger {
+  const state = triggers.get(id);
+  if (!state) {
+    throw new Error(`No trigger ${id}; see list_triggers`);
+  }
+  triggers.delete(id);
+  clearTimeout(state.timer);
+  return publicView(state);
+}
+
+export function listTriggers(): Trigger[] {
+  return [...triggers.values()].map(publicView);
+}
+
+export function formatMetric(metric: TriggerMetric, value: number): string {
+  return metric === "cpu" ? `${Math.round(value)}% of a core` : formatValue(value, "bytes");
+}
+
+export function describeTrigger(t: Trigger): string {
+  const source = t.container ? `container ${t.container}` : `process ${t.pid}`;
+  const current = t.error
+    ? `⚠️ ${t.error}`
+    : t.value !== undefined ? `now ${formatMetric(t.metric, t.value)}${t.breachingSince ? ` (above since ${t.breachingSince})` : ""}` : "waiting for a reading";
+  return `${t.id}: ${t.metric} of ${source} ≥ ${formatMetric(t.metric, t.threshold)} for ${t.forSeconds}s → ${t.profileTypes.join(", ")} from ${t.target}; ${current}; fired ${t.fired}×`;
+}
+
+export function formatFiring(t: Trigger, firing: TriggerFiring): string {
+  const source = t.container ? `container ${t.container}` : `process ${t.pid}`;
+  const lines = [
+    `🚨 ${t.id}: ${t.metric} of ${source} at ${formatMetric(t.metric, firing.value)} for ${t.forSeconds}s (threshold ${formatMetric(t.metric, t.threshold)})`,
+    ...t.profileTypes.map((type) => firing.profiles[type]
+      ? `📁 ${type} profile saved as ${firing.profiles[type]}`
+      : `❌ ${type} capture failed: ${firing.errors[type]}`),
+  ];
+  return lines.join("\n");
+}
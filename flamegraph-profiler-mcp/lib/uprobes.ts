@@ -0,0 +1,258 @@
+/**
+ * Exact per-call latency of one function in a running Go binary, measured
+ * with eBPF uprobes through bpftrace (Linux, root or CAP_BPF and
+ * CAP_PERFMON). Every call is timed, which sampled CPU profiles cannot do:
+ * they see where time goes, not how long each call takes, and they miss
+ * time spent off-CPU inside the call.
+ *
+ * uretprobes corrupt Go stacks when they grow, so returns are probed at each
+ * RET instruction of the function instead, found with `go tool objdump`.
+ * Calls are keyed by goroutine (the g pointer in R14) and nesting depth, so
+ * goroutines moving between threads and recursion are timed correctly.
+ */
+import { execFile, spawn } from "node:child_process";
+import fs from "node:fs/promises";
+import { promisify } from "node:util";
+
+const execFileAsync = promisify(execFile);
+
+// Time allowed for bpftrace to compile the script and attach its probes
+const ATTACH_TIMEOUT_MS = 60_000;
+
+// Integer argument registers of Go's internal ABI on amd64, in order
+const ARG_REGISTERS = ["ax", "bx", "cx", "di", "si", "r8", "r9", "r10", "r11"];
+
+export interface HistogramBucket {
+  // Inclusive bounds; min is undefined for the negative bucket
+  min?: number;
+  max: number;
+  count: number;
+}
+
+export interface LatencyProbe {
+  pid: number;
+  binary: string;
+  function: string;
+  seconds: number;
+  calls: number;
+  callsPerSecond: number;
+  // Nanoseconds
+  minNs?: number;
+  maxNs?: number;
+  meanNs?: number;
+  // Estimated from the power-of-two histogram, by interpolating within buckets
+  p50Ns?: number;
+  p90Ns?: number;
+  p99Ns?: number;
+  histogram: HistogramBucket[];
+  // Histogram of one integer argument, when asked for
+  argument?: { index: number; register: string; histogram: HistogramBucket[] };
+  // Returns probed; a function that ends in a tail call has none on that path
+  returnSites: number;
+}
+
+interface Disassembly {
+  // Offset to probe calls at, past the stack-growth check
+  entry: number;
+  returns: number[];
+}
+
+// Entry and return offsets of a function, from the Go disassembler. The
+// prologue's stack check jumps to morestack, which re-runs the function from
+// its start, so calls are counted after it rather than at the symbol.
+async function disassemble(binary: string, name: string): Promise<Disassembly> {
+  const pattern = `^${name.replace(/[.*+?^${}()|[\]\\]/g, "\\$&")}$`;
+  let stdout: string;
+  try {
+    ({ stdout } = await execFileAsync("go", ["tool", "objdump", "-s", pattern, binary], { maxBuffer: 64 * 1024 * 1024 }));
+  } catch (error) {
+    const stderr = (error as { stderr?: string }).stderr?.trim();
+    throw new Error(`Could not disassemble ${binary}: ${stderr || (error instanceof Error ? error.message : String(error))}`);
+  }
+  const instructions: Array<{ address: number; op: string }> = [];
+  for (const line of stdout.split("\n")) {
+    const match = line.match(/^\s+\S+:\d+\s+0x([0-9a-f]+)\s+[0-9a-f]+\s+(\S+)/);
+    if (match) {
+      instructions.push({ address: parseInt(match[1], 16), op: match[2] });
+    }
+  }
+  if (instructions.length === 0) {
+    throw new Error(`${name} not found in ${binary}; is it inlined everywhere, or is the binary stripped of its symbol table?`);
+  }
+  const start = instructions[0].address;
+  const check = instructions.slice(0, 4).findIndex((i) => i.op === "JBE" || i.op === "JLS");
+  return {
+    entry: check >= 0 && instructions[check + 1] ? instructions[check + 1].address - start : 0,
+    returns: instructions.filter((i) => i.op === "RET").map((i) => i.address - start),
+  };
+}
+
+// bpftrace program timing every call for a number of seconds
+function probeScript(binary: string, name: string, code: Disassembly, seconds: number, argument?: number): string {
+  const at = (offset: number) => `uprobe:${binary}:"${name}"${offset > 0 ? `+${offset}` : ""}`;
+  const g = `reg("r14")`;
+  return `${at(code.entry)} {
+  @depth[${g}]++;
+  @start[${g}, @depth[${g}]] = nsecs;${argument !== undefined ? `\n  @argument = hist((int64)reg("${ARG_REGISTERS[argument]}"));` : ""}
+}
+${code.returns.map(at).join(",\n")} /@depth[${g}]/ {
+  $ns = nsecs - @start[${g}, @depth[${g}]];
+  delete(@start[${g}, @depth[${g}]]);
+  @depth[${g}]--;
+  @latency = hist($ns);
+  @calls = count();
+  @total = sum($ns);
+  @min = min($ns);
+  @max = max($ns);
+}
+interval:s:${seconds} { exit(); }
+END { clear(@start); clear(@depth); }
+`;
+}
+
+interface BpftraceOutput {
+  type: string;
+  data?: Record<string, unknown>;
+}
+
+function bucketsOf(value: unknown): HistogramBucket[] {
+  return (Array.isArray(value) ? value : []).map((b: { min?: number; max: number; count: number }) => ({
+    // The negative bucket has only max; the zero bucket is [0, 0]
+    min: b.min ?? (b.max === -1 ? undefined : 0),
+    max: b.max,
+    count: b.count,
+  }));
+}
+
+// Run a bpftrace program and collect the maps it prints as JSON at exit.
+// Cancelling interrupts bpftrace, which removes its probes.
+export function runBpftrace(pid: number, script: string, seconds: number, signal?: AbortSignal): Promise<Map<string, unknown>> {
+  return new Promise((resolve, reject) => {
+    const child = spawn("bpftrace", ["-f", "json", "-p", String(pid), "-e", script], {
+      stdio: ["ignore", "pipe", "pipe"],
+      signal,
+      killSignal: "SIGINT",
+    });
+    const maps = new Map<string, unknown>();
+    let stdout = "";
+    let stderr = "";
+    const timer = setTimeout(() => child.kill("SIGINT"), ATTACH_TIMEOUT_MS + seconds * 1000);
+    child.stdout.on("data", (chunk: Buffer) => (stdout += chunk.toString()));
+    child.stderr.on("data", (chunk: Buffer) => (stderr += chunk.toString()));
+    child.on("error", (error: NodeJS.ErrnoException) => {
+      clearTimeout(timer);
+      if (signal?.aborted) {
+        reject(signal.reason);
+        return;
+      }
+      reject(error.code === "ENOENT" ? new Error("bpftrace not found on PATH; install it from your distribution's packages") : error);
+    });
+    child.on("close", (code) => {
+      clearTimeout(timer);
+      for (const line of stdout.split("\n")) {
+        try {
+          const output = JSON.parse(line) as BpftraceOutput;
+          for (const [key, value] of Object.entries(output.data ?? {})) {
+            maps.set(key, value);
+          }
+        } catch {
+          // Not JSON: attach messages from older versions
+        }
+      }
+      if (code !== 0 && maps.size === 0) {
+        const message = stderr.trim().split("\n").filter((l) => !/^\s*$/.test(l)).slice(-3).join("; ");
+        reject(new Error(/permission|not permitted|EPERM/i.test(message)
+          ? `bpftrace needs root or CAP_BPF and CAP_PERFMON: ${message}`
+          : message || `bpftrace exited with code ${code}`));
+        return;
+      }
+      resolve(maps);
+    });
+  });
+}
+
+// Value below which a share of the calls fall, interpolated linearly within
+// the power-of-two bucket holding it
+function percentile(histogram: HistogramBucket[], p: number): number | undefined {
+  const total = histogram.reduce((sum, b) => sum + b.count, 0);
+  if (total === 0) {
+    return undefined;
+  }
+  let seen = 0;
+  for (const bucket of histogram) {
+    if (seen + bucket.count >= total * p) {
+      const min = bucket.min ?? bucket.max;
+      const within = bucket.count > 0 ? (total * p - seen) / bucket.count : 0;
+      return Math.round(min + (bucket.max - min) * within);
+    }
+    seen += bucket.count;
+  }
+  return histogram[histogram.length - 1].max;
+}
+
+// Time every call of a function in a running Go process for a number of seconds
+export async function probeLatency(options: { pid: number; function: string; seconds: number; argument?: number; signal?: AbortSignal }): Promise<LatencyProbe> {
+  if (process.platform !== "linux") {
+    throw new Error("uprobes need Linux");
+  }
+  if (process.arch !== "x64") {
+    throw new Error(`uprobe latency probes support amd64 Go binaries only, not ${process.arch}`);
+  }
+  let binary: string;
+  try {
+    binary = await fs.realpath(`/proc/${options.pid}/exe`);
+  } catch {
+    throw new Error(`No process ${options.pid}, or its executable is not readable (run as the same user or root)`);
+  }
+  const code = await disassemble(binary, options.function);
+  options.signal?.throwIfAborted();
+  if (code.returns.length === 0) {
+    throw new Error(`${options.function} has no RET instruction (it only returns by tail call or never returns), so calls cannot be timed`);
+  }
+
+  const started = Date.now();
+  const maps = await runBpftrace(options.pid, probeScript(binary, options.function, code, options.seconds, options.argument), options.seconds, options.signal);
+  const seconds = Math.min(options.seconds, (Date.now() - started) / 1000);
+  const calls = Number(maps.get("@calls") ?? 0);
+  const histogram = bucketsOf(maps.get("@latency"));
+  const ns = (key: string) => (calls > 0 && maps.has(key) ? Number(maps.get(key)) : undefined);
+  const total = ns("@total");
+  return {
+    pid: options.pid,
+    binary,
+    function: options.function,
+    seconds,
+    calls,
+    callsPerSecond: seconds > 0 ? Math.round((calls / seconds) * 100) / 100 : 0,
+    minNs: ns("@min"),
+    maxNs: ns("@max"),
+    meanNs: total !== undefined ? Math.round(total / calls) : undefined,
+    p50Ns: percentile(histogram, 0.5),
+    p90Ns: percentile(histogram, 0.9),
+    p99Ns: percentile(histogram, 0.99),
+    histogram,
+    argument: options.argument !== undefined
+      ? { index: options.argument, register: ARG_REGISTERS[options.argument], histogram: bucketsOf(maps.get("@argument")) }
+      : undefined,
+    returnSites: code.returns.length,
+  };
+}
+
+export function formatNanos(ns: number): string {
+  if (ns < 1_000) return `${ns}ns`;
+  if (ns < 1_000_000) return `${Math.round(ns / 10) / 100}µs`;
+  if (ns < 1_000_000_000) return `${Math.round(ns / 10_000) / 100}ms`;
+  return `${Math.round(ns / 10_000_000) / 100}s`;
+}
+
+// Text histogram, one row per non-empty bucket with a bar scaled to the largest
+export function formatHistogram(histogram: HistogramBucket[], label: (n: number) => string): string {
+  const rows = histogram.filter((b) => b.count > 0);
+  const most = Math.max(1, ...rows.map((b) => b.count));
+  return rows
+    .map((b) => {
+      const range = b.min === undefined ? `< 0` : `${label(b.min)}–${label(b.max)}`;
+      return `  ${range.padEnd(20)} ${"█".repeat(Math.max(1, Math.round((b.count / most) * 30)))} ${b.count}`;
+    })
+    .join("\n");
+}
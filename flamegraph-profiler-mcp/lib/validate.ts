@@ -0,0 +1,122 @@
+/**
+ * Checking config files before they are deployed: the server config,
+ * .perfbudgets.yaml, targets.yaml and suppressions.json, against their
+ * schemas (see configschema.ts) and then against what the server itself
+ * checks at startup, like color schemes and exporter settings. Every problem
+ * is reported with its line, so a CI job can point at it.
+ */
+import fs from "node:fs/promises";
+import path from "node:path";
+import { BUDGETS_FILE } from "./budgets.js";
+import { CONFIG_FILE, exporterConfigOf } from "./config.js";
+import {
+  BUDGETS_SCHEMA,
+  lineOf,
+  parseConfigText,
+  SERVER_CONFIG_SCHEMA,
+  SUPPRESSIONS_SCHEMA,
+  TARGETS_SCHEMA,
+  validateDocument,
+  type Schema,
+  type ValidationIssue,
+} from "./configschema.js";
+import { checkExporterConfig } from "./exporters.js";
+import { checkLayout, type FlamegraphLayout } from "./render.js";
+import { checkSourceLinkConfig } from "./sourcelinks.js";
+
+export const CONFIG_KINDS = ["server", "budgets", "targets", "suppressions"] as const;
+export type ConfigKind = (typeof CONFIG_KINDS)[number];
+
+const SCHEMAS: Record<ConfigKind, Schema> = {
+  server: SERVER_CONFIG_SCHEMA,
+  budgets: BUDGETS_SCHEMA,
+  targets: TARGETS_SCHEMA,
+  suppressions: SUPPRESSIONS_SCHEMA,
+};
+
+const FILE_NAMES: Record<string, ConfigKind> = {
+  [CONFIG_FILE]: "server",
+  [BUDGETS_FILE]: "budgets",
+  "targets.yaml": "targets",
+  "suppressions.json": "suppressions",
+};
+
+export interface ConfigValidation {
+  file: string;
+  kind: ConfigKind;
+  valid: boolean;
+  issues: ValidationIssue[];
+}
+
+// Kind of a config file from its name, e.g. .perfbudgets.yaml
+export function configKindOf(file: string): ConfigKind | undefined {
+  return FILE_NAMES[path.basename(file)];
+}
+
+// Issues from the checks the server runs at startup beyond the schema, on
+// the parts of a server config the schema found no problem in
+function serverConfigIssues(doc: Record<string, any>, schemaIssues: ValidationIssue[]): Array<{ path: string; message: string }> {
+  const issues: Array<{ path: string; message: string }> = [];
+  const attempt = (at: string, value: unknown, run: () => void) => {
+    if (value === undefined || value === null || schemaIssues.some((issue) => issue.path === at || issue.path.startsWith(`${at}.`) || issue.path.startsWith(`${at}[`))) {
+      return;
+    }
+    try {
+      run();
+    } catch (error) {
+      // Exporter errors name exporters[0] for the one checked
+      issues.push({ path: at, message: (error instanceof Error ? error.message : String(error)).replace(/^exporters\[0\](?: \([^)]*\))?: /, "") });
+    }
+  };
+  const { colorScheme, orientation } = doc.render ?? {};
+  attempt("render.colorScheme", colorScheme, () => checkLayout({ color: colorScheme }));
+  attempt("render.orientation", orientation, () => checkLayout({ orientation }));
+  const editor = doc.sources?.editor;
+  attempt("sources.editor", editor, () => checkSourceLinkConfig({ editor, repos: [] }));
+  (Array.isArray(doc.exporters) ? doc.exporters : []).forEach((entry: Record<string, unknown>, i: number) => {
+    attempt(`exporters[${i}]`, entry, () => checkExporterConfig([exporterConfigOf(entry)]));
+  });
+  return issues;
+}
+
+// Validate one config text; the kind comes from the file name unless given
+export function validateConfigText(text: string, file: string, kind = configKindOf(file)): ConfigValidation {
+  if (!kind) {
+    throw new Error(`Cannot tell what kind of config ${path.basename(file)} is; name it ${Object.keys(FILE_NAMES).join(", ")} or pass a kind (${CONFIG_KINDS.join(", ")})`);
+  }
+  const positions = new Map<string, number>();
+  let doc: unknown;
+  try {
+    doc = parseConfigText(text, file, positions);
+  } catch (error) {
+    // Syntax errors read "<file>:<line>: <message>"
+    const message = error instanceof Error ? error.message : String(error);
+    const match = message.match(/^.*?:(\d+): (.*)$/s);
+    const issue = match ? { path: "", line: parseInt(match[1], 10), message: match[2] } : { path: "", message };
+    return { file, kind, valid: false, issues: [issue] };
+  }
+  let issues = validateDocument(doc, SCHEMAS[kind], positions);
+  if (kind === "server" && doc && typeof doc === "object" && !Array.isArray(doc)) {
+    issues = [...issues, ...serverConfigIssues(doc, issues).map((issue) => ({ ...issue, line: lineOf(issue.path, positions) }))]
+      .sort((a, b) => (a.line ?? 0) - (b.line ?? 0));
+  }
+  return { file, kind, valid: issues.length === 0, issues };
+}
+
+export async function validateConfigFile(file: string, kind?: ConfigKind): Promise<ConfigValidation> {
+  return validateConfigText(await fs.readFile(file, "utf-8"), file, kind);
+}
+
+// Config files to check when none are named: the server config and
+// suppressions in the data directory, and the budgets and targets in a
+// repository, each when it exists
+export async function defaultConfigFiles(serverConfigFile: string, dataDir: string, repo = process.cwd()): Promise<string[]> {
+  const candidates = [
+    serverConfigFile,
+    path.join(dataDir, "suppressions.json"),
+    path.join(repo, BUDGETS_FILE),
+    path.join(repo, "targets.yaml"),
+  ];
+  const exists = await Promise.all(candidates.map((file) => fs.access(file).then(() => true, () => false)));
+  return [...new Set(candidates.filter((_, i) => exists[i]))];
+}
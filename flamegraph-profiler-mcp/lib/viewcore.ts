@@ -0,0 +1,382 @@
+/**
+ * Heap analysis of a Go core dump from its object graph, as dumped by
+ * viewcore (golang.org/x/debug/cmd/viewcore): live objects by type, retained
+ * sizes from the dominator tree, and paths from a root to the objects that
+ * retain the most. An object's retained size is what the collector would free
+ * if it were gone: itself and everything reachable only through it.
+ */
+import { execFile } from "node:child_process";
+import { existsSync } from "node:fs";
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { promisify } from "node:util";
+
+const execFileAsync = promisify(execFile);
+
+export type HeapNodeKind = "global" | "frame" | "object";
+
+export interface HeapGraph {
+  kinds: HeapNodeKind[];
+  // Global name, frame function or object address
+  names: string[];
+  // Global or object type; frames have none
+  types: string[];
+  sizes: number[];
+  // Edges, from and to node indexes, with the field or variable they go through
+  from: number[];
+  to: number[];
+  fields: string[];
+}
+
+export interface HeapTypeStats {
+  type: string;
+  objects: number;
+  bytes: number;
+  // Retained by the type's objects, not counting objects of the type that
+  // only other objects of the type keep alive
+  retained: number;
+}
+
+export interface HeapPathStep {
+  kind: HeapNodeKind;
+  // Global name, frame function, or object address
+  name: string;
+  type?: string;
+  // Field or variable the next step is reached through
+  via?: string;
+}
+
+export interface HeapObjectInfo {
+  address: string;
+  type: string;
+  size: number;
+  retained: number;
+  // Shortest path from a global or goroutine frame to the object
+  path: HeapPathStep[];
+}
+
+export interface HeapRootStats {
+  kind: "global" | "frame";
+  name: string;
+  type?: string;
+  // Bytes reachable only from this root
+  retained: number;
+}
+
+export interface CoreHeapReport {
+  core: string;
+  binary: string;
+  objects: number;
+  bytes: number;
+  globals: number;
+  frames: number;
+  // Objects no root reaches; viewcore only lists live ones, so normally none
+  unreachable: number;
+  types: HeapTypeStats[];
+  roots: HeapRootStats[];
+  biggest: HeapObjectInfo[];
+  // The object asked for by address
+  object?: HeapObjectInfo;
+}
+
+// Node statements; global labels hold a real newline between name and type
+const NODE = /^(\w+) \[label="([^"]*)"([^\]]*)\]$/gm;
+const EDGE = /^(\w+) -> (\w+)(?: \[(.*)\])?$/gm;
+const LABEL = /label="([^"]*)"/;
+
+function viewcoreError(error: unknown): Error {
+  if ((error as NodeJS.ErrnoException).code === "ENOENT") {
+    return new Error("viewcore not found on PATH; install it with `go install golang.org/x/debug/cmd/viewcore@latest`");
+  }
+  const stderr = (error as { stderr?: string }).stderr?.trim();
+  return new Error(stderr || (error instanceof Error ? error.message : String(error)));
+}
+
+// The core's object graph in DOT, from `viewcore objgraph`
+export async function dumpObjectGraph(binary: string, core: string): Promise<string> {
+  const file = path.join(os.tmpdir(), `objgraph_${Date.now()}.dot`);
+  try {
+    await execFileAsync("viewcore", [core, "--exe", binary, "objgraph", file], { maxBuffer: 64 * 1024 * 1024 }).catch((error) => {
+      throw viewcoreError(error);
+    });
+    return await fs.readFile(file, "utf-8");
+  } finally {
+    await fs.unlink(file).catch(() => undefined);
+  }
+}
+
+// Parse viewcore's object graph: globals (r…) and goroutine frames (f…) are
+// the roots, and objects (o<address>) are labeled with their type and size.
+export function parseObjectGraph(dot: string): HeapGraph {
+  const graph: HeapGraph = { kinds: [], names: [], types: [], sizes: [], from: [], to: [], fields: [] };
+  const ids = new Map<string, number>();
+  for (const [, id, label] of dot.matchAll(NODE)) {
+    if (ids.has(id)) continue;
+    ids.set(id, graph.kinds.length);
+    if (id.startsWith("o")) {
+      const parts = label.split("\\n");
+      const size = Number(parts[parts.length - 1]);
+      graph.kinds.push("object");
+      graph.names.push(`0x${id.slice(1)}`);
+      graph.types.push((Number.isFinite(size) ? parts.slice(0, -1) : parts).join(" ") || "unknown");
+      graph.sizes.push(Number.isFinite(size) ? size : 0);
+    } else {
+      const [name, type] = label.split("\n");
+      graph.kinds.push(id.startsWith("r") ? "global" : "frame");
+      graph.names.push(name);
+      graph.types.push(type ?? "");
+      graph.sizes.push(0);
+    }
+  }
+  for (const [, from, to, attributes] of dot.matchAll(EDGE)) {
+    const a = ids.get(from);
+    const b = ids.get(to);
+    if (a === undefined || b === undefined) continue;
+    graph.from.push(a);
+    graph.to.push(b);
+    graph.fields.push(attributes?.match(LABEL)?.[1] ?? "");
+  }
+  if (!graph.kinds.includes("object")) {
+    throw new Error("The object graph has no heap objects; is this a Go core with its matching binary?");
+  }
+  return graph;
+}
+
+// Edges by the node they leave, in compressed rows: the edges leaving node n
+// are edges[start[n]..start[n+1])
+function adjacency(count: number, from: number[]): { start: Int32Array; edges: Int32Array } {
+  const start = new Int32Array(count + 1);
+  for (const n of from) start[n + 1]++;
+  for (let i = 0; i < count; i++) start[i + 1] += start[i];
+  const next = start.slice(0, count);
+  const edges = new Int32Array(from.length);
+  from.forEach((n, e) => (edges[next[n]++] = e));
+  return { start, edges };
+}
+
+// Immediate dominators with the iterative algorithm of Cooper, Harvey and
+// Kennedy; node 0 is a synthetic root pointing at every global and frame.
+// Returns postorder numbers too, in which a dominator always comes after
+// the nodes it dominates.
+function dominators(count: number, from: number[], to: number[]): { idom: Int32Array; post: Int32Array; order: Int32Array; reached: number } {
+  const out = adjacency(count, from);
+  const into = adjacency(count, to);
+  const post = new Int32Array(count).fill(-1);
+  const order = new Int32Array(count);
+  const visited = new Uint8Array(count);
+  const stack = [0];
+  const cursor = new Int32Array(count);
+  let reached = 0;
+  visited[0] = 1;
+  cursor[0] = out.start[0];
+  while (stack.length > 0) {
+    const n = stack[stack.length - 1];
+    if (cursor[n] < out.start[n + 1]) {
+      const m = to[out.edges[cursor[n]++]];
+      if (!visited[m]) {
+        visited[m] = 1;
+        cursor[m] = out.start[m];
+        stack.push(m);
+      }
+      continue;
+    }
+    stack.pop();
+    post[n] = reached;
+    order[reached++] = n;
+  }
+
+  const idom = new Int32Array(count).fill(-1);
+  idom[0] = 0;
+  const intersect = (a: number, b: number) => {
+    while (a !== b) {
+      while (post[a] < post[b]) a = idom[a];
+      while (post[b] < post[a]) b = idom[b];
+    }
+    return a;
+  };
+  for (let changed = true; changed;) {
+    changed = false;
+    for (let i = reached - 2; i >= 0; i--) {
+      const n = order[i];
+      let dom = -1;
+      for (let k = into.start[n]; k < into.start[n + 1]; k++) {
+        const p = from[into.edges[k]];
+        if (idom[p] < 0) continue;
+        dom = dom < 0 ? p : intersect(p, dom);
+      }
+      if (dom !== idom[n]) {
+        idom[n] = dom;
+        changed = true;
+      }
+    }
+  }
+  return { idom, post, order, reached };
+}
+
+export function analyzeHeapGraph(
+  graph: HeapGraph,
+  options: { core: string; binary: string; limit: number; paths: number; address?: string },
+): CoreHeapReport {
+  // Node 0 is the synthetic root; graph nodes are shifted by one
+  const count = graph.kinds.length + 1;
+  const from = graph.from.map((n) => n + 1);
+  const to = graph.to.map((n) => n + 1);
+  graph.kinds.forEach((kind, n) => {
+    if (kind !== "object") {
+      from.push(0);
+      to.push(n + 1);
+    }
+  });
+  const kind = (n: number) => graph.kinds[n - 1];
+  const { idom, order, reached } = dominators(count, from, to);
+
+  // Shortest paths from the roots, breadth first
+  const out = adjacency(count, from);
+  const parentEdge = new Int32Array(count).fill(-1);
+  const seen = new Uint8Array(count);
+  seen[0] = 1;
+  for (let queue = [0], head = 0; head < queue.length; head++) {
+    const n = queue[head];
+    for (let k = out.start[n]; k < out.start[n + 1]; k++) {
+      const e = out.edges[k];
+      if (!seen[to[e]]) {
+        seen[to[e]] = 1;
+        parentEdge[to[e]] = e;
+        queue.push(to[e]);
+      }
+    }
+  }
+
+  // Retained sizes, summed up the dominator tree in postorder
+  const retained = new Float64Array(count);
+  for (let i = 0; i < reached; i++) {
+    const n = order[i];
+    if (n === 0) continue;
+    retained[n] += graph.sizes[n - 1];
+    retained[idom[n]] += retained[n];
+  }
+
+  // Per type, count an object's retained size unless an object of the same
+  // type dominates it, walking the dominator tree with the path's types.
+  // Entry and exit numbers tell later whether one object dominates another.
+  const tree = Array.from(order.subarray(0, reached)).filter((n) => n !== 0);
+  const children = adjacency(count, tree.map((n) => idom[n]));
+  const enter = new Int32Array(count);
+  const exit = new Int32Array(count);
+  const types = new Map<string, HeapTypeStats>();
+  const statsOf = (type: string) => {
+    let stats = types.get(type);
+    if (!stats) {
+      stats = { type, objects: 0, bytes: 0, retained: 0 };
+      types.set(type, stats);
+    }
+    return stats;
+  };
+  const onPath = new Map<string, number>();
+  const stack: Array<{ n: number; k: number }> = [{ n: 0, k: children.start[0] }];
+  let clock = 0;
+  while (stack.length > 0) {
+    const top = stack[stack.length - 1];
+    if (top.k < children.start[top.n + 1]) {
+      const n = tree[children.edges[top.k++]];
+      enter[n] = clock++;
+      if (kind(n) === "object") {
+        const type = graph.types[n - 1];
+        if (!onPath.get(type)) {
+          statsOf(type).retained += retained[n];
+        }
+        onPath.set(type, (onPath.get(type) ?? 0) + 1);
+      }
+      stack.push({ n, k: children.start[n] });
+      continue;
+    }
+    stack.pop();
+    exit[top.n] = clock++;
+    if (top.n !== 0 && kind(top.n) === "object") {
+      const type = graph.types[top.n - 1];
+      onPath.set(type, onPath.get(type)! - 1);
+    }
+  }
+  const dominates = (d: number, n: number) => enter[d] <= enter[n] && exit[n] <= exit[d];
+
+  const pathTo = (n: number): HeapPathStep[] => {
+    const steps: HeapPathStep[] = [];
+    let via: string | undefined;
+    for (let m = n; m !== 0;) {
+      steps.unshift({ kind: kind(m), name: graph.names[m - 1], type: graph.types[m - 1] || undefined, via });
+      const e = parentEdge[m];
+      if (e < 0) break;
+      // Edges past the graph's own lead from the synthetic root
+      via = e < graph.fields.length ? graph.fields[e] || undefined : undefined;
+      m = from[e];
+    }
+    return steps;
+  };
+  const info = (n: number): HeapObjectInfo => ({
+    address: graph.names[n - 1],
+    type: graph.types[n - 1],
+    size: graph.sizes[n - 1],
+    retained: retained[n],
+    path: pathTo(n),
+  });
+
+  const objects: number[] = [];
+  const roots: HeapRootStats[] = [];
+  let bytes = 0;
+  for (let n = 1; n < count; n++) {
+    if (kind(n) === "object") {
+      const stats = statsOf(graph.types[n - 1]);
+      stats.objects++;
+      stats.bytes += graph.sizes[n - 1];
+      objects.push(n);
+      bytes += graph.sizes[n - 1];
+    } else if (retained[n] > 0) {
+      roots.push({ kind: kind(n) as HeapRootStats["kind"], name: graph.names[n - 1], type: graph.types[n - 1] || undefined, retained: retained[n] });
+    }
+  }
+  // Biggest retainers, skipping objects that a listed one dominates
+  const biggest: number[] = [];
+  for (const n of objects.filter((n) => seen[n]).sort((a, b) => retained[b] - retained[a])) {
+    if (biggest.length >= options.paths) break;
+    if (!biggest.some((d) => dominates(d, n))) {
+      biggest.push(n);
+    }
+  }
+
+  let object: HeapObjectInfo | undefined;
+  if (options.address) {
+    const address = `0x${options.address.toLowerCase().replace(/^0x/, "")}`;
+    const n = graph.names.findIndex((name, i) => graph.kinds[i] === "object" && name === address) + 1;
+    if (n === 0) {
+      throw new Error(`No heap object starts at ${address}; pass the address of an object's first byte`);
+    }
+    object = info(n);
+  }
+
+  return {
+    core: options.core,
+    binary: options.binary,
+    objects: objects.length,
+    bytes,
+    globals: graph.kinds.filter((k) => k === "global").length,
+    frames: graph.kinds.filter((k) => k === "frame").length,
+    unreachable: objects.filter((n) => !seen[n]).length,
+    types: [...types.values()].sort((a, b) => b.bytes - a.bytes).slice(0, options.limit),
+    roots: roots.sort((a, b) => b.retained - a.retained).slice(0, options.limit),
+    biggest: biggest.map(info),
+    object,
+  };
+}
+
+export async function analyzeCoreHeap(options: { binary: string; core: string; limit: number; paths: number; address?: string }): Promise<CoreHeapReport> {
+  const binary = path.resolve(options.binary);
+  const core = path.resolve(options.core);
+  for (const file of [binary, core]) {
+    if (!existsSync(file)) {
+      throw new Error(`${file} does not exist`);
+    }
+  }
+  const graph = parseObjectGraph(await dumpObjectGraph(binary, core));
+  return analyzeHeapGraph(graph, { ...options, binary, core });
+}
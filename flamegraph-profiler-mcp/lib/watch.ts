@@ -0,0 +1,217 @@
+/**
+ * Watch mode: rebuild and re-profile a Go app whenever its module changes, and
+ * summarize each run against the previous one for a tight edit/measure loop.
+ */
+import { randomBytes } from "node:crypto";
+import { existsSync, watch as watchFiles, type FSWatcher } from "node:fs";
+import fs from "node:fs/promises";
+import os from "node:os";
+import path from "node:path";
+import { keepProfile } from "./catalog.js";
+import { diffProfiles, type FunctionDelta } from "./diff.js";
+import { buildGoAppAsync, PROFILE_FLAGS, runGoAppAsync, type ProfileType } from "./goapp.js";
+import { formatValue, readProfile, sampleIndexOf, toBaseUnit, totalOf } from "./pprof.js";
+
+export interface WatchRun {
+  run: number;
+  at: string;
+  // Files whose changes triggered the run, relative to the module; empty for the first run
+  changed: string[];
+  profileId?: string;
+  // Total of the default sample type in its base unit
+  total?: number;
+  unit?: string;
+  // Change of the total against the previous successful run, in percent
+  totalChangePct?: number;
+  regressions: FunctionDelta[];
+  improvements: FunctionDelta[];
+  // Build or run failure
+  error?: string;
+}
+
+export interface Watch {
+  id: string;
+  appPath: string;
+  moduleDir: string;
+  profileType: ProfileType;
+  duration: number;
+  startedAt: string;
+  runs: number;
+  last?: WatchRun;
+}
+
+interface WatchState extends Watch {
+  watcher: FSWatcher;
+  binary: string;
+  previousProfile?: string;
+  changed: Set<string>;
+  timer?: NodeJS.Timeout;
+  running: boolean;
+  // A change arrived while a run was in progress
+  pending: boolean;
+}
+
+// Wait for edits to settle before rebuilding, so a save of several files
+// triggers one run
+const DEBOUNCE_MS = 500;
+
+// Watches running at once; each one builds and runs the app on every change
+const MAX_WATCHES = 4;
+
+const watches = new Map<string, WatchState>();
+
+// Directory of the nearest go.mod above a file, else the file's own directory
+function moduleDirOf(file: string): string {
+  for (let dir = path.dirname(file); ; dir = path.dirname(dir)) {
+    if (existsSync(path.join(dir, "go.mod"))) return dir;
+    if (path.dirname(dir) === dir) return path.dirname(file);
+  }
+}
+
+function isSourceChange(file: string): boolean {
+  return /(^|\/)go\.(mod|sum)$/.test(file) || (file.endsWith(".go") && !file.endsWith("_test.go"));
+}
+
+function publicView(state: WatchState): Watch {
+  const { id, appPath, moduleDir, profileType, duration, startedAt, runs, last } = state;
+  return { id, appPath, moduleDir, profileType, duration, startedAt, runs, last };
+}
+
+async function profileOnce(state: WatchState, changed: string[]): Promise<WatchRun> {
+  const run: WatchRun = { run: state.runs + 1, at: new Date().toISOString(), changed, regressions: [], improvements: [] };
+  const profileFile = path.join(os.tmpdir(), `watch_${state.id}_${Date.now()}.pb.gz`);
+  try {
+    await buildGoAppAsync(state.appPath, state.binary);
+    await runGoAppAsync(state.binary, `${PROFILE_FLAGS[state.profileType]}=${profileFile}`, state.duration);
+
+    const profile = readProfile(profileFile);
+    const sampleIndex = sampleIndexOf(profile);
+    run.total = toBaseUnit(totalOf(profile, sampleIndex), profile.sampleTypes[sampleIndex].unit);
+    run.unit = state.profileType === "heap" ? "bytes" : "seconds";
+    const entry = await keepProfile(profileFile, `${path.basename(state.appPath, ".go")}_${state.profileType}`, {
+      target: state.appPath,
+      profileType: state.profileType,
+    });
+    run.profileId = entry.id;
+
+    if (state.previousProfile) {
+      const previous = readProfile(state.previousProfile);
+      const diff = diffProfiles(previous, profile, undefined, 3);
+      const previousTotal = toBaseUnit(diff.baselineTotal, diff.unit);
+      run.totalChangePct = previousTotal === 0 ? undefined : Math.round(((run.total - previousTotal) / previousTotal) * 1000) / 10;
+      run.regressions = diff.regressions;
+      run.improvements = diff.improvements;
+    }
+    state.previousProfile = entry.path;
+  } catch (error) {
+    run.error = error instanceof Error ? error.message : String(error);
+  } finally {
+    await fs.unlink(profileFile).catch(() => undefined);
+  }
+  return run;
+}
+
+// Run the scenario, then again for changes that arrived meanwhile
+async function runCycle(state: WatchState, onRun: (watch: Watch, run: WatchRun) => void): Promise<void> {
+  if (state.running) {
+    state.pending = true;
+    return;
+  }
+  state.running = true;
+  try {
+    do {
+      state.pending = false;
+      const changed = [...state.changed].sort();
+      state.changed.clear();
+      const run = await profileOnce(state, changed);
+      if (!watches.has(state.id)) return;
+      state.runs = run.run;
+      state.last = run;
+      onRun(publicView(state), run);
+    } while (state.pending);
+  } finally {
+    state.running = false;
+  }
+}
+
+// Start watching the module of a Go app. Resolves after the first run, which
+// becomes the baseline for the next one; later runs are reported to onRun.
+export async function startWatch(
+  options: { appPath: string; profileType: ProfileType; duration: number },
+  onRun: (watch: Watch, run: WatchRun) => void,
+): Promise<Watch> {
+  const appPath = path.resolve(options.appPath);
+  if (!existsSync(appPath)) {
+    throw new Error(`${appPath} does not exist`);
+  }
+  const existing = [...watches.values()].find((w) => w.appPath === appPath && w.profileType === options.profileType);
+  if (existing) {
+    throw new Error(`${appPath} is already watched for ${options.profileType} profiles (${existing.id}); stop it with stop_watch first`);
+  }
+  if (watches.size >= MAX_WATCHES) {
+    throw new Error(`${MAX_WATCHES} watches are already running; stop one with stop_watch`);
+  }
+
+  const id = `w_${randomBytes(3).toString("hex")}`;
+  const moduleDir = moduleDirOf(appPath);
+  const state: WatchState = {
+    id,
+    appPath,
+    moduleDir,
+    profileType: options.profileType,
+    duration: options.duration,
+    startedAt: new Date().toISOString(),
+    runs: 0,
+    binary: path.join(os.tmpdir(), `watch_${id}`),
+    changed: new Set(),
+    running: false,
+    pending: false,
+    watcher: watchFiles(moduleDir, { recursive: true }, (_event, filename) => {
+      const file = filename?.toString().split(path.sep).join("/");
+      if (!file || !isSourceChange(file) || file.split("/").some((part) => part === "vendor" || part.startsWith("."))) {
+        return;
+      }
+      state.changed.add(file);
+      clearTimeout(state.timer);
+      state.timer = setTimeout(() => void runCycle(state, onRun), DEBOUNCE_MS);
+    }),
+  };
+  watches.set(id, state);
+
+  await runCycle(state, () => {});
+  return publicView(state);
+}
+
+export function stopWatch(id: string): Watch {
+  const state = watches.get(id);
+  if (!state) {
+    throw new Error(`No watch ${id}; see list_watches`);
+  }
+  watches.delete(id);
+  state.watcher.close();
+  clearTimeout(state.timer);
+  void fs.unlink(state.binary).catch(() => undefined);
+  return publicView(state);
+}
+
+export function listWatches(): Watch[] {
+  return [...watches.values()].map(publicView);
+}
+
+export function formatWatchRun(watch: Watch, run: WatchRun): string {
+  const name = path.relative(watch.moduleDir, watch.appPath);
+  const cause = run.changed.length > 0
+    ? ` after changes to ${run.changed.slice(0, 3).join(", ")}${run.changed.length > 3 ? ` and ${run.changed.length - 3} more` : ""}`
+    : "";
+  if (run.error) {
+    return `👀 ${watch.id} run ${run.run} of ${name}${cause} failed:\n${run.error}`;
+  }
+  const change = run.totalChangePct !== undefined ? ` (${run.totalChangePct > 0 ? "+" : ""}${run.totalChangePct}% vs previous run)` : "";
+  const delta = (d: FunctionDelta) => `${d.name}: ${d.baselineFlatPct}% → ${d.comparisonFlatPct}% (${d.flatDeltaPct > 0 ? "+" : ""}${d.flatDeltaPct} pts)`;
+  const lines = [
+    `👀 ${watch.id} run ${run.run} of ${name}${cause}: ${formatValue(run.total ?? 0, run.unit ?? "seconds")} ${watch.profileType === "heap" ? "in use" : "total"}${change}, saved as ${run.profileId}`,
+    ...run.regressions.map((d) => `📈 ${delta(d)}`),
+    ...run.improvements.map((d) => `📉 ${delta(d)}`),
+  ];
+  return lines.join("\n");
+}
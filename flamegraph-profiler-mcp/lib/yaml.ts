@@ -0,0 +1,183 @@
+/**
+ * Parser for the YAML subset used by repository config files (.perfbudgets.yaml,
+ * targets.yaml): block mappings and sequences, plain and quoted scalars,
+ * comments, and single-line flow sequences. Anchors, tags, multi-document
+ * streams, block scalars and flow mappings are not supported.
+ */
+
+// Path of a key or item below a parent path, e.g. budgets[0].max
+export function pathOf(parent: string, key: string | number): string {
+  if (typeof key === "number") return `${parent}[${key}]`;
+  if (!/^[\w-]+$/.test(key)) return `${parent}[${JSON.stringify(key)}]`;
+  return parent === "" ? key : `${parent}.${key}`;
+}
+
+interface Line {
+  indent: number;
+  text: string;
+  // 1-based line number for error messages
+  number: number;
+}
+
+// "key:" or "key: value"; the colon must be followed by a space or the end of the line
+const KEY = /^("(?:[^"\\]|\\.)*"|'(?:[^']|'')*'|[^\s"'#\-[{][^:]*?|-[^\s:][^:]*?)\s*:(?:\s+(.*))?$/;
+
+function isSequenceItem(text: string): boolean {
+  return text === "-" || text.startsWith("- ");
+}
+
+// Drop a trailing comment, respecting quotes
+function stripComment(raw: string): string {
+  let quote: string | undefined;
+  for (let i = 0; i < raw.length; i++) {
+    const c = raw[i];
+    if (quote) {
+      if (c === "\\" && quote === '"') i++;
+      else if (c === quote) quote = undefined;
+    } else if (c === '"' || c === "'") {
+      quote = c;
+    } else if (c === "#" && (i === 0 || /\s/.test(raw[i - 1]))) {
+      return raw.slice(0, i);
+    }
+  }
+  return raw;
+}
+
+// Split a flow sequence body on commas outside quotes
+function splitFlow(body: string): string[] {
+  const items: string[] = [];
+  let quote: string | undefined;
+  let start = 0;
+  for (let i = 0; i < body.length; i++) {
+    const c = body[i];
+    if (quote) {
+      if (c === "\\" && quote === '"') i++;
+      else if (c === quote) quote = undefined;
+    } else if (c === '"' || c === "'") {
+      quote = c;
+    } else if (c === ",") {
+      items.push(body.slice(start, i));
+      start = i + 1;
+    }
+  }
+  items.push(body.slice(start));
+  return items.map((item) => item.trim()).filter((item, i, all) => item !== "" || i < all.length - 1);
+}
+
+// Parse a document. With positions, the line of every key and sequence item
+// is recorded by its path, for errors that point at the offending line.
+export function parseYaml(text: string, source = "YAML", positions?: Map<string, number>): unknown {
+  const fail = (line: number, message: string) => new Error(`${source}:${line}: ${message}`);
+
+  const lines: Line[] = [];
+  text.split(/\r?\n/).forEach((raw, i) => {
+    const content = stripComment(raw).trimEnd();
+    if (content.trim() === "" || content === "---") return;
+    const indent = content.length - content.trimStart().length;
+    if (content.slice(0, indent).includes("\t")) {
+      throw fail(i + 1, "tabs are not allowed for indentation");
+    }
+    lines.push({ indent, text: content.trimStart(), number: i + 1 });
+  });
+
+  const unquote = (value: string, line: number): string => {
+    if (value.startsWith('"')) {
+      try {
+        return JSON.parse(value) as string;
+      } catch {
+        throw fail(line, `invalid double-quoted string ${value}`);
+      }
+    }
+    if (value.startsWith("'")) {
+      if (!/^'(?:[^']|'')*'$/.test(value)) throw fail(line, `invalid single-quoted string ${value}`);
+      return value.slice(1, -1).replace(/''/g, "'");
+    }
+    return value;
+  };
+
+  const scalar = (value: string, line: number): unknown => {
+    const v = value.trim();
+    if (v.startsWith('"') || v.startsWith("'")) return unquote(v, line);
+    if (v.startsWith("[")) {
+      if (!v.endsWith("]")) throw fail(line, "flow sequences must fit on one line");
+      return splitFlow(v.slice(1, -1)).map((item) => scalar(item, line));
+    }
+    if (v === "{}") return {};
+    if (v.startsWith("{")) throw fail(line, "flow mappings are not supported; use an indented block");
+    if (v.startsWith("|") || v.startsWith(">")) throw fail(line, "block scalars are not supported; use a quoted string");
+    if (v.startsWith("&") || v.startsWith("*") || v.startsWith("!")) throw fail(line, "anchors, aliases and tags are not supported");
+    if (/^(true|True|TRUE)$/.test(v)) return true;
+    if (/^(false|False|FALSE)$/.test(v)) return false;
+    if (/^(null|Null|NULL|~)$/.test(v)) return null;
+    if (/^[-+]?(\d+(\.\d*)?|\.\d+)([eE][-+]?\d+)?$/.test(v)) return Number(v);
+    return v;
+  };
+
+  let pos = 0;
+
+  const node = (path: string): unknown => {
+    const line = lines[pos];
+    if (isSequenceItem(line.text)) return sequence(line.indent, path);
+    if (KEY.test(line.text)) return mapping(line.indent, path);
+    pos++;
+    return scalar(line.text, line.number);
+  };
+
+  const sequence = (indent: number, path: string): unknown[] => {
+    const items: unknown[] = [];
+    while (pos < lines.length && lines[pos].indent === indent && isSequenceItem(lines[pos].text)) {
+      const line = lines[pos];
+      const rest = line.text.slice(1).trimStart();
+      const item = pathOf(path, items.length);
+      positions?.set(item, line.number);
+      if (rest === "") {
+        pos++;
+        items.push(pos < lines.length && lines[pos].indent > indent ? node(item) : null);
+      } else {
+        // Treat the item's content as a line of its own, so "- key: value"
+        // starts a mapping continued by the lines indented to match it
+        lines[pos] = { indent: indent + line.text.length - rest.length, text: rest, number: line.number };
+        items.push(node(item));
+      }
+    }
+    if (pos < lines.length && lines[pos].indent > indent) {
+      throw fail(lines[pos].number, "unexpected indentation");
+    }
+    return items;
+  };
+
+  const mapping = (indent: number, path: string): Record<string, unknown> => {
+    const map: Record<string, unknown> = {};
+    while (pos < lines.length && lines[pos].indent === indent && !isSequenceItem(lines[pos].text)) {
+      const line = lines[pos];
+      const match = line.text.match(KEY);
+      if (!match) throw fail(line.number, `expected "key: value", got ${JSON.stringify(line.text)}`);
+      const key = unquote(match[1], line.number);
+      if (Object.hasOwn(map, key)) throw fail(line.number, `duplicate key ${JSON.stringify(key)}`);
+      positions?.set(pathOf(path, key), line.number);
+      pos++;
+      const next = lines[pos];
+      if (match[2] !== undefined && match[2] !== "") {
+        map[key] = scalar(match[2], line.number);
+      } else if (next && (next.indent > indent || (next.indent === indent && isSequenceItem(next.text)))) {
+        map[key] = node(pathOf(path, key));
+      } else {
+        map[key] = null;
+      }
+    }
+    if (pos < lines.length && lines[pos].indent > indent) {
+      throw fail(lines[pos].number, "unexpected indentation");
+    }
+    return map;
+  };
+
+  if (lines.length === 0) {
+    return null;
+  }
+  positions?.set("", lines[0].number);
+  const value = node("");
+  if (pos < lines.length) {
+    throw fail(lines[pos].number, "unexpected content after the document");
+  }
+  return value;
+}
@@ -0,0 +1,111 @@
+/**
+ * Reading and writing zip archives, for profile exports of other products and
+ * for bundles. Only what those need: stored and deflated files, no Zip64,
+ * encryption or multi-disk archives.
+ */
+import { crc32, deflateRawSync, inflateRawSync } from "node:zlib";
+
+export interface ZipFile {
+  name: string;
+  content: Buffer;
+}
+
+// Files of a zip archive, stored or deflated. Zip64 archives, which only
+// archives over 4GB need, are not supported.
+export function readZip(data: Buffer): ZipFile[] {
+  let end = -1;
+  for (let i = data.length - 22; i >= Math.max(0, data.length - 22 - 0xffff); i--) {
+    if (data.readUInt32LE(i) === 0x06054b50) {
+      end = i;
+      break;
+    }
+  }
+  if (end < 0) {
+    throw new Error("Not a zip archive: no end of central directory");
+  }
+  const count = data.readUInt16LE(end + 10);
+  let offset = data.readUInt32LE(end + 16);
+  const files: ZipFile[] = [];
+  for (let i = 0; i < count; i++) {
+    if (data.readUInt32LE(offset) !== 0x02014b50) {
+      throw new Error("Corrupt zip archive: bad central directory entry");
+    }
+    const method = data.readUInt16LE(offset + 10);
+    const compressedSize = data.readUInt32LE(offset + 20);
+    const nameLength = data.readUInt16LE(offset + 28);
+    const extraLength = data.readUInt16LE(offset + 30);
+    const commentLength = data.readUInt16LE(offset + 32);
+    const localOffset = data.readUInt32LE(offset + 42);
+    const name = data.toString("utf-8", offset + 46, offset + 46 + nameLength);
+    offset += 46 + nameLength + extraLength + commentLength;
+    if (name.endsWith("/")) {
+      continue;
+    }
+    const start = localOffset + 30 + data.readUInt16LE(localOffset + 26) + data.readUInt16LE(localOffset + 28);
+    const raw = data.subarray(start, start + compressedSize);
+    if (method !== 0 && method !== 8) {
+      throw new Error(`${name} in the zip archive uses unsupported compression method ${method}`);
+    }
+    files.push({ name, content: method === 8 ? inflateRawSync(raw) : Buffer.from(raw) });
+  }
+  return files;
+}
+
+// DOS date and time of a Date, as zip headers record modification times
+function dosTime(date: Date): { time: number; date: number } {
+  return {
+    time: (date.getHours() << 11) | (date.getMinutes() << 5) | Math.floor(date.getSeconds() / 2),
+    date: (Math.max(date.getFullYear() - 1980, 0) << 9) | ((date.getMonth() + 1) << 5) | date.getDate(),
+  };
+}
+
+// A zip archive of files, deflated, with UTF-8 names
+export function writeZip(files: ZipFile[], modified = new Date()): Buffer {
+  const { time, date } = dosTime(modified);
+  const locals: Buffer[] = [];
+  const centrals: Buffer[] = [];
+  let offset = 0;
+  for (const file of files) {
+    const name = Buffer.from(file.name, "utf-8");
+    const data = deflateRawSync(file.content);
+    const crc = crc32(file.content);
+
+    const local = Buffer.alloc(30);
+    local.writeUInt32LE(0x04034b50, 0);
+    local.writeUInt16LE(20, 4);
+    local.writeUInt16LE(0x0800, 6);
+    local.writeUInt16LE(8, 8);
+    local.writeUInt16LE(time, 10);
+    local.writeUInt16LE(date, 12);
+    local.writeUInt32LE(crc, 14);
+    local.writeUInt32LE(data.length, 18);
+    local.writeUInt32LE(file.content.length, 22);
+    local.writeUInt16LE(name.length, 26);
+    locals.push(local, name, data);
+
+    const central = Buffer.alloc(46);
+    central.writeUInt32LE(0x02014b50, 0);
+    central.writeUInt16LE(20, 4);
+    central.writeUInt16LE(20, 6);
+    central.writeUInt16LE(0x0800, 8);
+    central.writeUInt16LE(8, 10);
+    central.writeUInt16LE(time, 12);
+    central.writeUInt16LE(date, 14);
+    central.writeUInt32LE(crc, 16);
+    central.writeUInt32LE(data.length, 20);
+    central.writeUInt32LE(file.content.length, 24);
+    central.writeUInt16LE(name.length, 28);
+    central.writeUInt32LE(offset, 42);
+    centrals.push(central, name);
+    offset += local.length + name.length + data.length;
+  }
+
+  const directory = Buffer.concat(centrals);
+  const end = Buffer.alloc(22);
+  end.writeUInt32LE(0x06054b50, 0);
+  end.writeUInt16LE(files.length, 8);
+  end.writeUInt16LE(files.length, 10);
+  end.writeUInt32LE(directory.length, 12);
+  end.writeUInt32LE(offset, 16);
+  return Buffer.concat([...locals, directory, end]);
+}
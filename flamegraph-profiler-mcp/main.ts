@@ -4,11 +4,33 @@
 
 import { createMcpExpressApp } from "@modelcontextprotocol/sdk/server/express.js";
 import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import { SSEServerTransport } from "@modelcontextprotocol/sdk/server/sse.js";
 import { StdioServerTransport } from "@modelcontextprotocol/sdk/server/stdio.js";
 import { StreamableHTTPServerTransport } from "@modelcontextprotocol/sdk/server/streamableHttp.js";
+import { isInitializeRequest } from "@modelcontextprotocol/sdk/types.js";
 import cors from "cors";
-import type { Request, Response } from "express";
+import express, { type NextFunction, type Request, type Response } from "express";
 import rateLimit from "express-rate-limit";
+import { randomUUID } from "node:crypto";
+import fs from "node:fs";
+import http from "node:http";
+import https from "node:https";
+import path from "node:path";
+import type { TLSSocket } from "node:tls";
+import { authenticate, loadAuthConfig, type AuthClient, type Capability } from "./lib/auth.js";
+import { getBadge, renderBadge, setServedAt } from "./lib/badges.js";
+import { CONFIG_FILE, loadServerConfig, serverConfig } from "./lib/config.js";
+import { formatIssue } from "./lib/configschema.js";
+import { dashboardData, dashboardToken, isAuthorized, renderDashboard } from "./lib/dashboard.js";
+import { formatDemo, runDemo } from "./lib/demo.js";
+import { startContinuousProfiling } from "./lib/continuous.js";
+import { startDigestSchedule } from "./lib/digest.js";
+import { checkExporterConfig, startFindingExports } from "./lib/exporters.js";
+import { IngestError, ingestProfile, ingestRequestOf } from "./lib/ingest.js";
+import { checkLayout } from "./lib/render.js";
+import { checkSourceLinkConfig } from "./lib/sourcelinks.js";
+import { dataDir } from "./lib/store.js";
+import { CONFIG_KINDS, defaultConfigFiles, validateConfigFile, type ConfigKind } from "./lib/validate.js";
 import { createServer } from "./server.js";
 
 // Rate limiter: 100 requests per minute per IP
@@ -24,12 +46,122 @@ const limiter = rateLimit({
   },
 });
 
+// Sessions left idle this long are closed, so a shared server does not
+// accumulate the sessions of clients that went away without ending them
+const SESSION_IDLE_MS = 30 * 60 * 1000;
+
+interface Session {
+  server: McpServer;
+  transport: StreamableHTTPServerTransport | SSEServerTransport;
+  lastSeen: number;
+  // Authenticated client that started the session
+  client?: string;
+}
+
+// Address to serve HTTP on, from --listen or PROFILER_LISTEN as host:port,
+// :port or port; the host defaults to 127.0.0.1 and the port to PORT or 3003
+function listenAddress(): { host: string; port: number } {
+  const argv = process.argv;
+  const flag = argv.findIndex((arg) => arg === "--listen" || arg.startsWith("--listen="));
+  const value = flag < 0 ? process.env.PROFILER_LISTEN : argv[flag].includes("=") ? argv[flag].slice("--listen=".length) : argv[flag + 1];
+  const fallback = { host: "127.0.0.1", port: parseInt(process.env.PORT ?? "3003", 10) };
+  if (!value) {
+    return fallback;
+  }
+  const match = value.match(/^(?:(?:\[([^\]]+)\]|([^:[\]]*)):)?(\d+)$/);
+  if (!match) {
+    throw new Error(`Invalid listen address ${value}; use host:port, [ipv6]:port, :port or port`);
+  }
+  return { host: match[1] ?? (match[2] || fallback.host), port: parseInt(match[3], 10) };
+}
+
+// Value of a command-line flag given as --name value or --name=value
+function flagValue(name: string): string | undefined {
+  const argv = process.argv;
+  const flag = argv.findIndex((arg) => arg === name || arg.startsWith(`${name}=`));
+  if (flag < 0) {
+    return undefined;
+  }
+  const value = argv[flag].includes("=") ? argv[flag].slice(name.length + 1) : argv[flag + 1];
+  if (!value) {
+    throw new Error(`${name} needs a value`);
+  }
+  return value;
+}
+
+// Server config file from --config or PROFILER_CONFIG, or else config.yaml
+// in the data directory, which may be missing
+function configFile(): { file: string; required: boolean } {
+  const file = flagValue("--config") ?? process.env.PROFILER_CONFIG;
+  return { file: file || path.join(dataDir(), CONFIG_FILE), required: Boolean(file) };
+}
+
+// Load the server config from --config or PROFILER_CONFIG, or else from
+// config.yaml in the data directory when there is one
+function loadConfig(): void {
+  const { file, required } = configFile();
+  const config = loadServerConfig(file, required);
+  try {
+    checkLayout(config.render);
+  } catch (error) {
+    throw new Error(`${config.source}: render: ${error instanceof Error ? error.message : error}`);
+  }
+  try {
+    checkSourceLinkConfig(config.sources);
+  } catch (error) {
+    throw new Error(`${config.source}: sources: ${error instanceof Error ? error.message : error}`);
+  }
+  try {
+    checkExporterConfig(config.exporters);
+  } catch (error) {
+    throw new Error(`${config.source}: ${error instanceof Error ? error.message : error}`);
+  }
+  // Over stdio, standard output carries the protocol
+  if (process.argv.includes("--stdio") && config.exporters.some((e) => e.type === "jsonl" && (e.settings.file ?? "-") === "-")) {
+    throw new Error(`${config.source}: a jsonl exporter needs a file with --stdio, where standard output carries MCP`);
+  }
+  if (config.source) {
+    console.error(`Loaded config from ${config.source}`);
+  }
+}
+
+// HTTPS options from PROFILER_TLS_CERT and PROFILER_TLS_KEY; with
+// PROFILER_TLS_CLIENT_CA, clients may also identify themselves with a
+// certificate it signed. Clients without one can still send a bearer token.
+function tlsOptions(): https.ServerOptions | undefined {
+  const { PROFILER_TLS_CERT: cert, PROFILER_TLS_KEY: key, PROFILER_TLS_CLIENT_CA: ca } = process.env;
+  if (!cert || !key) {
+    if (cert || key || ca) {
+      throw new Error("HTTPS needs both PROFILER_TLS_CERT and PROFILER_TLS_KEY");
+    }
+    return undefined;
+  }
+  return {
+    cert: fs.readFileSync(cert),
+    key: fs.readFileSync(key),
+    ...(ca ? { ca: fs.readFileSync(ca), requestCert: true, rejectUnauthorized: false } : {}),
+  };
+}
+
+// Common name of a client certificate the client CA verified
+function certSubjectOf(req: Request): string | undefined {
+  const socket = req.socket as TLSSocket;
+  if (!socket.encrypted || !socket.authorized) {
+    return undefined;
+  }
+  const cn = socket.getPeerCertificate().subject?.CN;
+  return Array.isArray(cn) ? cn[0] : cn;
+}
+
 export async function startStreamableHTTPServer(
-  createServer: () => McpServer,
+  createServer: (capabilities?: readonly Capability[]) => McpServer,
 ): Promise<void> {
-  const port = parseInt(process.env.PORT ?? "3003", 10);
+  const { host, port } = listenAddress();
+  const tls = tlsOptions();
+  const auth = loadAuthConfig();
+  const allowedHosts = process.env.PROFILER_ALLOWED_HOSTS?.split(",").map((h) => h.trim()).filter(Boolean);
 
-  const app = createMcpExpressApp({ host: "127.0.0.1" });
+  const app = createMcpExpressApp({ host, allowedHosts: allowedHosts?.length ? allowedHosts : undefined });
   app.use(cors({
     origin: [
       "http://localhost:3003",
@@ -37,45 +169,266 @@ export async function startStreamableHTTPServer(
       /^http:\/\/localhost:\d+$/,
       /^http:\/\/127\.0\.0\.1:\d+$/,
     ],
+    exposedHeaders: ["Mcp-Session-Id"],
   }));
-  app.use("/mcp", limiter);
+  app.use(["/mcp", "/sse", "/messages"], limiter);
 
-  app.all("/mcp", async (req: Request, res: Response) => {
-    const server = createServer();
-    const transport = new StreamableHTTPServerTransport({
-      sessionIdGenerator: undefined,
-    });
+  const clientOf = (req: Request): AuthClient | undefined => {
+    const bearer = req.headers.authorization?.match(/^Bearer\s+(.+)$/i)?.[1];
+    return auth && authenticate(auth, { bearer, certSubject: certSubjectOf(req) });
+  };
 
-    res.on("close", () => {
-      transport.close().catch(() => {});
-      server.close().catch(() => {});
-    });
+  // With clients configured, every MCP request must come from one of them
+  app.use(["/mcp", "/sse", "/messages"], (req: Request, res: Response, next: NextFunction) => {
+    if (!auth) {
+      next();
+      return;
+    }
+    const client = clientOf(req);
+    if (!client) {
+      res.status(401).set("WWW-Authenticate", 'Bearer realm="flamegraph-profiler"').json({
+        jsonrpc: "2.0",
+        error: { code: -32001, message: "Unauthorized: send a configured bearer token or client certificate" },
+        id: null,
+      });
+      return;
+    }
+    res.locals.client = client;
+    next();
+  });
+
+  // One MCP server per client session, so server-to-client messages such as
+  // watch_target's log notifications reach the client that started them
+  const sessions = new Map<string, Session>();
+  const endSession = (id: string) => {
+    const session = sessions.get(id);
+    if (session) {
+      sessions.delete(id);
+      session.transport.close().catch(() => {});
+      session.server.close().catch(() => {});
+    }
+  };
+  const sweep = setInterval(() => {
+    for (const [id, session] of sessions) {
+      if (Date.now() - session.lastSeen > SESSION_IDLE_MS) {
+        endSession(id);
+      }
+    }
+  }, 60 * 1000);
+  sweep.unref();
 
+  // Sessions only serve the client that started them
+  const ownsSession = (res: Response, session: Session): boolean => {
+    const client = res.locals.client as AuthClient | undefined;
+    if (session.client !== client?.name) {
+      res.status(403).json({
+        jsonrpc: "2.0",
+        error: { code: -32001, message: "Session belongs to another client" },
+        id: null,
+      });
+      return false;
+    }
+    return true;
+  };
+
+  const internalError = (res: Response, error: unknown) => {
+    console.error("MCP error:", error);
+    if (!res.headersSent) {
+      res.status(500).json({
+        jsonrpc: "2.0",
+        error: { code: -32603, message: "Internal server error" },
+        id: null,
+      });
+    }
+  };
+
+  // Streamable HTTP: an initialize request starts a session, later requests
+  // carry its Mcp-Session-Id, GET opens its SSE stream and DELETE ends it
+  app.all("/mcp", async (req: Request, res: Response) => {
     try {
-      await server.connect(transport);
-      await transport.handleRequest(req, res, req.body);
-    } catch (error) {
-      console.error("MCP error:", error);
-      if (!res.headersSent) {
-        res.status(500).json({
+      const id = req.headers["mcp-session-id"];
+      const session = typeof id === "string" ? sessions.get(id) : undefined;
+      if (session) {
+        if (!ownsSession(res, session)) {
+          return;
+        }
+        session.lastSeen = Date.now();
+        if (!(session.transport instanceof StreamableHTTPServerTransport)) {
+          res.status(400).json({
+            jsonrpc: "2.0",
+            error: { code: -32000, message: "Session uses the SSE transport; post to /messages" },
+            id: null,
+          });
+          return;
+        }
+        await session.transport.handleRequest(req, res, req.body);
+        return;
+      }
+      if (req.method !== "POST" || !isInitializeRequest(req.body)) {
+        res.status(id ? 404 : 400).json({
           jsonrpc: "2.0",
-          error: { code: -32603, message: "Internal server error" },
+          error: { code: -32000, message: id ? "Session not found; initialize a new one" : "No session; send an initialize request first" },
           id: null,
         });
+        return;
       }
+      const client = res.locals.client as AuthClient | undefined;
+      const server = createServer(client?.capabilities);
+      const transport: StreamableHTTPServerTransport = new StreamableHTTPServerTransport({
+        sessionIdGenerator: () => randomUUID(),
+        onsessioninitialized: (sessionId) => {
+          sessions.set(sessionId, { server, transport, lastSeen: Date.now(), client: client?.name });
+        },
+      });
+      transport.onclose = () => {
+        if (transport.sessionId) {
+          sessions.delete(transport.sessionId);
+        }
+      };
+      await server.connect(transport);
+      await transport.handleRequest(req, res, req.body);
+    } catch (error) {
+      internalError(res, error);
+    }
+  });
+
+  // HTTP+SSE transport of earlier protocol versions, for clients without
+  // streamable HTTP: GET /sse opens the stream, messages are posted back
+  app.get("/sse", async (_req: Request, res: Response) => {
+    try {
+      const client = res.locals.client as AuthClient | undefined;
+      const server = createServer(client?.capabilities);
+      const transport = new SSEServerTransport("/messages", res);
+      sessions.set(transport.sessionId, { server, transport, lastSeen: Date.now(), client: client?.name });
+      res.on("close", () => endSession(transport.sessionId));
+      await server.connect(transport);
+    } catch (error) {
+      internalError(res, error);
+    }
+  });
+  app.post("/messages", async (req: Request, res: Response) => {
+    const session = typeof req.query.sessionId === "string" ? sessions.get(req.query.sessionId) : undefined;
+    if (!session || !(session.transport instanceof SSEServerTransport)) {
+      res.status(404).send("Session not found; open a new one at /sse");
+      return;
+    }
+    if (!ownsSession(res, session)) {
+      return;
+    }
+    session.lastSeen = Date.now();
+    try {
+      await session.transport.handlePostMessage(req, res, req.body);
+    } catch (error) {
+      internalError(res, error);
     }
   });
 
-  const httpServer = app.listen(port, (err) => {
-    if (err) {
-      console.error("Failed to start server:", err);
-      process.exit(1);
+  // Profiles pushed by applications the server cannot pull from; always
+  // authenticated, so it is only served when clients are configured
+  app.use("/ingest", limiter);
+  const ingestClient = (req: Request, res: Response, next: NextFunction) => {
+    if (!auth) {
+      res.status(404).json({ error: "Ingestion needs authentication; set PROFILER_AUTH_TOKEN or PROFILER_AUTH_FILE" });
+      return;
+    }
+    const client = clientOf(req);
+    if (!client) {
+      res.status(401).set("WWW-Authenticate", 'Bearer realm="flamegraph-profiler"').json({ error: "Unauthorized: send a configured bearer token or client certificate" });
+      return;
+    }
+    if (!client.capabilities.includes("ingest")) {
+      res.status(403).json({ error: `Client ${client.name} lacks the ingest capability` });
+      return;
+    }
+    res.locals.client = client;
+    next();
+  };
+  // Authenticated before the body is read
+  app.post("/ingest", ingestClient, express.raw({ type: () => true, limit: serverConfig().limits.maxProfileBytes }), async (req: Request, res: Response) => {
+    const client = res.locals.client as AuthClient;
+    try {
+      const entry = await ingestProfile(Buffer.isBuffer(req.body) ? req.body : Buffer.alloc(0), ingestRequestOf(req.query, client.name));
+      res.status(201).json({ id: entry.id, at: entry.at, target: entry.target, profileType: entry.profileType, commit: entry.commit, labels: entry.labels });
+    } catch (error) {
+      if (error instanceof IngestError) {
+        res.status(error.status).json({ error: error.message });
+        return;
+      }
+      console.error("Ingest error:", error);
+      res.status(500).json({ error: "Failed to store the profile" });
+    }
+  });
+
+  // Read-only dashboard for people without an MCP client, enabled by setting a token
+  const token = dashboardToken();
+  if (token) {
+    app.use(["/dashboard", "/dashboard.json"], limiter);
+    app.get(["/dashboard", "/dashboard.json"], async (req: Request, res: Response) => {
+      const bearer = req.headers.authorization?.replace(/^Bearer\s+/i, "");
+      const query = typeof req.query.token === "string" ? req.query.token : undefined;
+      if (!isAuthorized(bearer ?? query, token)) {
+        res.status(401).send("Unauthorized: pass the dashboard token as ?token= or a Bearer token");
+        return;
+      }
+      try {
+        const data = await dashboardData();
+        res.setHeader("Cache-Control", "no-store");
+        if (req.path.endsWith(".json")) {
+          res.json(data);
+        } else {
+          res.type("html").send(renderDashboard(data));
+        }
+      } catch (error) {
+        console.error("Dashboard error:", error);
+        res.status(500).send("Failed to load dashboard data");
+      }
+    });
+  }
+
+  // Badges made by diff_badge, public like any README image; only names a
+  // client chose to publish are served
+  app.use("/badges", limiter);
+  app.get("/badges/:file", async (req: Request, res: Response) => {
+    const name = req.params.file.replace(/\.svg$/, "");
+    try {
+      const entry = await getBadge(name);
+      if (!entry) {
+        res.status(404).type("text/plain").send(`No badge named ${name}`);
+        return;
+      }
+      // Image proxies such as GitHub's camo revalidate instead of caching stale results
+      res.setHeader("Cache-Control", "no-cache, max-age=0");
+      res.type("image/svg+xml").send(renderBadge(entry));
+    } catch (error) {
+      console.error("Badge error:", error);
+      res.status(500).send("Failed to load the badge");
+    }
+  });
+
+  const httpServer = tls ? https.createServer(tls, app) : http.createServer(app);
+  httpServer.on("error", (err) => {
+    console.error("Failed to start server:", err);
+    process.exit(1);
+  });
+  httpServer.listen(port, host, () => {
+    const base = `${tls ? "https" : "http"}://${host.includes(":") ? `[${host}]` : host}:${port}`;
+    setServedAt(base);
+    console.log(`Flamegraph Profiler MCP App server listening on ${base}/mcp (SSE clients: ${base}/sse)`);
+    if (auth) {
+      console.log(`Authentication required; clients: ${auth.clients.map((c) => `${c.name} (${c.capabilities.join(", ")})`).join(", ")}`);
+    } else if (!["127.0.0.1", "localhost", "::1"].includes(host)) {
+      console.warn("Warning: listening beyond localhost without authentication; set PROFILER_AUTH_TOKEN or PROFILER_AUTH_FILE");
+    }
+    if (token) {
+      console.log(`Dashboard available at ${base}/dashboard?token=...`);
     }
-    console.log(`Flamegraph Profiler MCP App server listening on http://localhost:${port}/mcp`);
   });
 
   const shutdown = () => {
     console.log("\nShutting down...");
+    for (const id of [...sessions.keys()]) {
+      endSession(id);
+    }
     httpServer.close(() => process.exit(0));
   };
 
@@ -89,7 +442,59 @@ export async function startStdioServer(
   await createServer().connect(new StdioServerTransport());
 }
 
+// Check config files and print every problem as file:line: path: message,
+// for CI; exits non-zero when any file is invalid. The files are the
+// arguments, or else the server config, suppressions, budgets and targets
+// that exist.
+async function validateConfigCommand(): Promise<void> {
+  const kind = flagValue("--kind");
+  if (kind !== undefined && !(CONFIG_KINDS as readonly string[]).includes(kind)) {
+    throw new Error(`Unknown config kind ${kind} (available: ${CONFIG_KINDS.join(", ")})`);
+  }
+  const argv = process.argv.slice(process.argv.indexOf("validate-config") + 1);
+  const files = argv.filter((arg, i) => !arg.startsWith("--") && !["--kind", "--config"].includes(argv[i - 1]));
+  const checked = files.length > 0 ? files : await defaultConfigFiles(configFile().file, dataDir());
+  if (checked.length === 0) {
+    console.log("No config files found to check");
+    return;
+  }
+  let failed = 0;
+  for (const file of checked) {
+    const result = await validateConfigFile(file, kind as ConfigKind | undefined);
+    if (result.valid) {
+      console.log(`✅ ${file} (${result.kind})`);
+    } else {
+      failed++;
+      console.log(`❌ ${file} (${result.kind}): ${result.issues.length} problem(s)`);
+      for (const issue of result.issues) {
+        console.log(`  ${formatIssue(file, issue)}`);
+      }
+    }
+  }
+  if (failed > 0) {
+    process.exitCode = 1;
+  }
+}
+
+// Run the narrated tour on the sample app and print it, without serving
+async function runDemoCommand(): Promise<void> {
+  const report = await runDemo({ cpuSeconds: 5, progress: (step, total, message) => console.error(`[${step + 1}/${total}] ${message}`) });
+  console.log(formatDemo(report));
+}
+
 async function main() {
+  if (process.argv.includes("validate-config")) {
+    await validateConfigCommand();
+    return;
+  }
+  loadConfig();
+  if (process.argv.includes("--demo")) {
+    await runDemoCommand();
+    return;
+  }
+  startDigestSchedule();
+  startFindingExports();
+  startContinuousProfiling();
   if (process.argv.includes("--stdio")) {
     await startStdioServer(createServer);
   } else {
@@ -0,0 +1,287 @@
+// Package agent periodically profiles the process it is embedded in and
+// pushes the profiles to a flamegraph-profiler-mcp server's /ingest
+// endpoint, so the server sees applications it cannot reach to pull from.
+//
+//	a, err := agent.New(agent.Config{
+//		Server:         ingest.Client{URL: "https://profiler.internal:3003", Token: os.Getenv("PROFILER_TOKEN")},
+//		Target:         "checkout",
+//		Labels:         map[string]string{"env": "prod"},
+//		SampleFraction: 0.1,
+//	})
+//	if err == nil {
+//		go a.Run(ctx)
+//	}
+//
+// Each round profiles with probability SampleFraction, so a fleet of
+// replicas pushes a steady trickle instead of every replica every interval.
+// Profiles are scrubbed before they leave the process (see Scrub), and
+// pushes the server cannot take right now back off exponentially. When the
+// process counts its requests with the requests package, each profile is
+// labeled with the requests it covers, in total and by route, so the server
+// can compare costs per request.
+package agent
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liamchampton/mcp-apps/flamegraph-profiler-mcp/pkg/ingest"
+	"github.com/liamchampton/mcp-apps/flamegraph-profiler-mcp/pkg/requests"
+)
+
+// Profile types the agent can capture.
+const (
+	CPU  = "cpu"
+	Heap = "heap"
+)
+
+// RequestsLabel carries the requests a pushed profile covers, when the
+// process counts them with the requests package: those served during a CPU
+// profile's window, or since the process started for a heap profile.
+const RequestsLabel = "requests"
+
+// RouteRequestsPrefix starts the labels carrying the requests a pushed
+// profile covers on each route counted with requests.Route or requests.Do,
+// e.g. "requests:GET /users". Beyond ingest.MaxLabels, quieter routes go
+// unlabeled.
+const RouteRequestsPrefix = RequestsLabel + ":"
+
+// Config configures an Agent. Only Server.URL and Target are required.
+type Config struct {
+	// Server is the profiler server to push to.
+	Server ingest.Client
+	// Target names the service or process, e.g. "checkout".
+	Target string
+	// Labels are attached to every pushed profile, e.g. env=prod.
+	Labels map[string]string
+	// Commit is the hex hash of the running code; the vcs.revision the
+	// binary was built with when empty.
+	Commit string
+	// Types are the profiles captured each round; CPU and Heap by default.
+	Types []string
+	// Interval is the time between rounds; one minute by default.
+	Interval time.Duration
+	// CPUDuration is the CPU profile window; ten seconds by default, and
+	// never longer than Interval.
+	CPUDuration time.Duration
+	// SampleFraction is the fraction of rounds that profile, in (0, 1];
+	// every round when zero.
+	SampleFraction float64
+	// MaxBackoff caps the wait after failed pushes; ten minutes by default.
+	MaxBackoff time.Duration
+	// Scrub says what is removed from profiles before they are pushed.
+	Scrub Scrub
+	// Logf reports failed rounds; log.Printf by default.
+	Logf func(format string, args ...any)
+}
+
+// Agent profiles and pushes on a schedule. Create one with New.
+type Agent struct {
+	cfg Config
+}
+
+// New checks cfg, fills in its defaults and returns an agent ready to Run.
+// The user's home directory is always trimmed from paths.
+func New(cfg Config) (*Agent, error) {
+	if cfg.Server.URL == "" {
+		return nil, errors.New("agent: Server.URL is required")
+	}
+	if cfg.Target == "" {
+		return nil, errors.New("agent: Target is required")
+	}
+	if len(cfg.Types) == 0 {
+		cfg.Types = []string{CPU, Heap}
+	}
+	for _, t := range cfg.Types {
+		if t != CPU && t != Heap {
+			return nil, fmt.Errorf("agent: unknown profile type %q", t)
+		}
+	}
+	if cfg.SampleFraction == 0 {
+		cfg.SampleFraction = 1
+	}
+	if cfg.SampleFraction < 0 || cfg.SampleFraction > 1 {
+		return nil, fmt.Errorf("agent: SampleFraction %v is not in (0, 1]", cfg.SampleFraction)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.CPUDuration <= 0 {
+		cfg.CPUDuration = 10 * time.Second
+	}
+	cfg.CPUDuration = min(cfg.CPUDuration, cfg.Interval)
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 10 * time.Minute
+	}
+	if cfg.Commit == "" {
+		cfg.Commit = buildRevision()
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		cfg.Scrub.TrimPathPrefixes = append(slices.Clone(cfg.Scrub.TrimPathPrefixes), home)
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = log.Printf
+	}
+	return &Agent{cfg: cfg}, nil
+}
+
+// Run profiles and pushes every Interval, give or take a tenth so replicas
+// started together drift apart, until ctx is done; it then returns ctx.Err().
+// After a push fails for a reason that may pass, such as the server being
+// down or rate limiting the agent, the wait doubles for each failed round
+// in a row, up to MaxBackoff.
+func (a *Agent) Run(ctx context.Context) error {
+	failures := 0
+	for {
+		wait := jitter(a.cfg.Interval)
+		if failures > 0 {
+			wait = jitter(min(a.cfg.Interval<<min(failures, 16), a.cfg.MaxBackoff))
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		if rand.Float64() >= a.cfg.SampleFraction {
+			continue
+		}
+		err := a.PushOnce(ctx)
+		switch {
+		case err == nil:
+			failures = 0
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case temporary(err):
+			failures++
+			a.cfg.Logf("agent: %v; backing off", err)
+		default:
+			failures = 0
+			a.cfg.Logf("agent: %v", err)
+		}
+	}
+}
+
+// PushOnce captures and pushes each configured profile type now, ignoring
+// SampleFraction, and returns the errors of those that failed.
+func (a *Agent) PushOnce(ctx context.Context) error {
+	var errs []error
+	for _, t := range a.cfg.Types {
+		if err := a.push(ctx, t); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("%s profile: %w", t, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (a *Agent) push(ctx context.Context, profileType string) error {
+	var (
+		data     []byte
+		duration time.Duration
+		served   uint64
+		routes   map[string]uint64
+		err      error
+	)
+	switch profileType {
+	case CPU:
+		duration = a.cfg.CPUDuration
+		before, beforeRoutes := requests.Total(), requests.Routes()
+		data, err = ingest.CPUProfile(ctx, duration)
+		served, routes = requests.Total()-before, requests.Routes()
+		for route, n := range beforeRoutes {
+			routes[route] -= n
+		}
+	case Heap:
+		data, err = ingest.HeapProfile()
+		served, routes = requests.Total(), requests.Routes()
+	}
+	if err != nil {
+		return err
+	}
+	labels := a.cfg.Labels
+	if served > 0 {
+		labels = maps.Clone(labels)
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[RequestsLabel] = strconv.FormatUint(served, 10)
+		// The busiest routes, as many as the server takes labels for
+		busiest := slices.SortedFunc(maps.Keys(routes), func(a, b string) int {
+			return cmp.Or(cmp.Compare(routes[b], routes[a]), strings.Compare(a, b))
+		})
+		for _, route := range busiest {
+			if len(labels) >= ingest.MaxLabels {
+				break
+			}
+			// Commas separate labels on the way to the server
+			if routes[route] > 0 && !strings.Contains(route, ",") {
+				labels[RouteRequestsPrefix+route] = strconv.FormatUint(routes[route], 10)
+			}
+		}
+	}
+	if data, err = a.cfg.Scrub.apply(data); err != nil {
+		return err
+	}
+	_, err = a.cfg.Server.Push(ctx, ingest.Profile{
+		Target:   a.cfg.Target,
+		Type:     profileType,
+		Duration: duration,
+		Commit:   a.cfg.Commit,
+		Labels:   labels,
+		Data:     data,
+	})
+	return err
+}
+
+// temporary reports whether every error in err may pass: the server was
+// unreachable, unavailable or rate limited the agent
+func temporary(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if !temporary(e) {
+				return false
+			}
+		}
+		return true
+	}
+	var status *ingest.StatusError
+	if errors.As(err, &status) {
+		return status.Temporary()
+	}
+	var network *url.Error
+	return errors.As(err, &network)
+}
+
+func jitter(d time.Duration) time.Duration {
+	return d - d/10 + rand.N(d/5+1)
+}
+
+// vcs.revision of the main module, or "" when not built from a checkout
+func buildRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,251 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Scrub says what is removed from profiles before they leave the process.
+// Sample labels and comments are dropped unless kept, as they often carry
+// user or tenant identifiers.
+type Scrub struct {
+	// KeepLabels lists the pprof label keys kept on samples.
+	KeepLabels []string
+	// TrimPathPrefixes are cut from source file and binary paths, e.g. the
+	// build machine's home directory; source lookups on the server match
+	// paths by their end, so trimmed paths still resolve.
+	TrimPathPrefixes []string
+	// Redact, when set, replaces every function name and path after
+	// trimming, e.g. to hash the names of internal packages.
+	Redact func(s string) string
+}
+
+// profile.proto field numbers
+const (
+	profileSample      = 2
+	profileMapping     = 3
+	profileFunction    = 5
+	profileStringTable = 6
+	profileComment     = 13
+
+	sampleLabel = 3
+	labelKey    = 1
+
+	mappingFilename = 5
+
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+)
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// field is one encoded protobuf field: its number, wire type and value,
+// the varint or the bytes of a length-delimited field
+type field struct {
+	num    int
+	wire   int
+	varint uint64
+	bytes  []byte
+	raw    []byte
+}
+
+func parseFields(b []byte) ([]field, error) {
+	var fields []field
+	for len(b) > 0 {
+		start := b
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("bad field key")
+		}
+		b = b[n:]
+		f := field{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			if f.varint, n = binary.Uvarint(b); n <= 0 {
+				return nil, errors.New("bad varint")
+			}
+			b = b[n:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, errors.New("bad length")
+			}
+			f.bytes = b[n : n+int(size)]
+			b = b[n+int(size):]
+		case 1:
+			if len(b) < 8 {
+				return nil, errors.New("truncated fixed64")
+			}
+			b = b[8:]
+		case 5:
+			if len(b) < 4 {
+				return nil, errors.New("truncated fixed32")
+			}
+			b = b[4:]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", f.wire)
+		}
+		f.raw = start[:len(start)-len(b)]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func appendVarintField(out []byte, num int, v uint64) []byte {
+	out = binary.AppendUvarint(out, uint64(num)<<3|wireVarint)
+	return binary.AppendUvarint(out, v)
+}
+
+func appendBytesField(out []byte, num int, b []byte) []byte {
+	out = binary.AppendUvarint(out, uint64(num)<<3|wireBytes)
+	out = binary.AppendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+// apply rewrites a pprof file, gzipped or not, and returns it gzipped.
+func (s Scrub) apply(data []byte) ([]byte, error) {
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+	fields, err := parseFields(data)
+	if err != nil {
+		return nil, fmt.Errorf("scrub: %w", err)
+	}
+	var table []string
+	for _, f := range fields {
+		if f.num == profileStringTable && f.wire == wireBytes {
+			table = append(table, string(f.bytes))
+		}
+	}
+	str := func(i uint64) string {
+		if i < uint64(len(table)) {
+			return table[i]
+		}
+		return ""
+	}
+	// Rewritten strings are appended to the table, so strings other
+	// messages share are left as they were
+	added := map[string]uint64{}
+	rewrite := func(i uint64, path bool) uint64 {
+		old := str(i)
+		v := old
+		if path {
+			for _, prefix := range s.TrimPathPrefixes {
+				if prefix != "" && strings.HasPrefix(v, prefix) {
+					v = strings.TrimLeft(strings.TrimPrefix(v, prefix), "/")
+					break
+				}
+			}
+		}
+		if s.Redact != nil && v != "" {
+			v = s.Redact(v)
+		}
+		if v == old {
+			return i
+		}
+		if j, ok := added[v]; ok {
+			return j
+		}
+		j := uint64(len(table))
+		table = append(table, v)
+		added[v] = j
+		return j
+	}
+
+	var out []byte
+	for _, f := range fields {
+		switch {
+		case f.num == profileStringTable || f.num == profileComment:
+			// The table is written last; comments are dropped
+		case f.num == profileSample && f.wire == wireBytes:
+			sample, err := parseFields(f.bytes)
+			if err != nil {
+				return nil, fmt.Errorf("scrub: sample: %w", err)
+			}
+			var b []byte
+			for _, sf := range sample {
+				if sf.num == sampleLabel && !s.keepLabel(sf.bytes, str) {
+					continue
+				}
+				b = append(b, sf.raw...)
+			}
+			out = appendBytesField(out, f.num, b)
+		case f.num == profileMapping && f.wire == wireBytes:
+			b, err := rewriteFields(f.bytes, func(num int) (bool, bool) { return num == mappingFilename, true }, rewrite)
+			if err != nil {
+				return nil, fmt.Errorf("scrub: mapping: %w", err)
+			}
+			out = appendBytesField(out, f.num, b)
+		case f.num == profileFunction && f.wire == wireBytes:
+			b, err := rewriteFields(f.bytes, func(num int) (bool, bool) {
+				return num == functionName || num == functionSystemName || num == functionFilename, num == functionFilename
+			}, rewrite)
+			if err != nil {
+				return nil, fmt.Errorf("scrub: function: %w", err)
+			}
+			out = appendBytesField(out, f.num, b)
+		default:
+			out = append(out, f.raw...)
+		}
+	}
+	for _, v := range table {
+		out = appendBytesField(out, profileStringTable, []byte(v))
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(out); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// rewriteFields re-encodes a message with the string-index fields picked by
+// isString replaced through rewrite, which is told whether each is a path
+func rewriteFields(b []byte, isString func(num int) (str, path bool), rewrite func(i uint64, path bool) uint64) ([]byte, error) {
+	fields, err := parseFields(b)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for _, f := range fields {
+		if str, path := isString(f.num); str && f.wire == wireVarint {
+			out = appendVarintField(out, f.num, rewrite(f.varint, path))
+			continue
+		}
+		out = append(out, f.raw...)
+	}
+	return out, nil
+}
+
+func (s Scrub) keepLabel(label []byte, str func(uint64) string) bool {
+	fields, err := parseFields(label)
+	if err != nil {
+		return false
+	}
+	for _, f := range fields {
+		if f.num == labelKey && f.wire == wireVarint {
+			return slices.Contains(s.KeepLabels, str(f.varint))
+		}
+	}
+	return false
+}
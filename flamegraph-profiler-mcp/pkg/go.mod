@@ -0,0 +1,3 @@
+module github.com/liamchampton/mcp-apps/flamegraph-profiler-mcp/pkg
+
+go 1.25.2
@@ -0,0 +1,182 @@
+// Package ingest pushes pprof profiles to the /ingest endpoint of a
+// flamegraph-profiler-mcp server, for applications the server cannot reach
+// to pull profiles from, such as processes behind NAT.
+//
+//	c := &ingest.Client{URL: "https://profiler.internal:3003", Token: os.Getenv("PROFILER_TOKEN")}
+//	data, err := ingest.CPUProfile(ctx, 30*time.Second)
+//	if err == nil {
+//		_, err = c.Push(ctx, ingest.Profile{Target: "checkout", Type: "cpu", Duration: 30 * time.Second, Data: data})
+//	}
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxLabels is the most labels the server takes on one profile.
+const MaxLabels = 20
+
+// Profile is one pprof file to push.
+type Profile struct {
+	// Target names the service or process, e.g. "checkout"; required.
+	Target string
+	// Type is the profile type, e.g. "cpu" or "heap"; the server detects it when empty.
+	Type string
+	// Duration is the capture window, for time profiles.
+	Duration time.Duration
+	// Commit is the hex hash of the code that was profiled, when known.
+	Commit string
+	// Labels are attached to the profile in the server's catalog, e.g.
+	// env=prod; at most MaxLabels, without commas.
+	Labels map[string]string
+	// Data is the pprof file, gzipped or not.
+	Data []byte
+}
+
+// Result is the server's record of a pushed profile.
+type Result struct {
+	ID          string            `json:"id"`
+	At          time.Time         `json:"at"`
+	Target      string            `json:"target"`
+	ProfileType string            `json:"profileType"`
+	Commit      string            `json:"commit,omitempty"`
+	Labels      map[string]string `json:"labels"`
+}
+
+// StatusError is a push the server rejected.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("ingest: server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether pushing again later may succeed: the server was
+// unavailable or rate limited the client, rather than rejecting the profile.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Client pushes profiles to one server.
+type Client struct {
+	// URL is the server's base URL, e.g. "https://profiler.internal:3003".
+	URL string
+	// Token is a bearer token of a client with the ingest capability.
+	Token string
+	// HTTPClient sends the requests; http.DefaultClient when nil. Set one
+	// with a client certificate to authenticate over mutual TLS instead.
+	HTTPClient *http.Client
+}
+
+// Push uploads a profile and returns the server's record of it.
+func (c *Client) Push(ctx context.Context, p Profile) (*Result, error) {
+	if p.Target == "" {
+		return nil, errors.New("ingest: profile has no target")
+	}
+	if len(p.Data) == 0 {
+		return nil, errors.New("ingest: profile has no data")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(c.URL, "/") + "/ingest")
+	if err != nil {
+		return nil, fmt.Errorf("ingest: %w", err)
+	}
+	q := url.Values{"target": {p.Target}}
+	if p.Type != "" {
+		q.Set("type", p.Type)
+	}
+	if p.Duration > 0 {
+		q.Set("seconds", strconv.FormatFloat(p.Duration.Seconds(), 'f', -1, 64))
+	}
+	if p.Commit != "" {
+		q.Set("commit", p.Commit)
+	}
+	if len(p.Labels) > 0 {
+		pairs := make([]string, 0, len(p.Labels))
+		for k, v := range p.Labels {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		q.Set("labels", strings.Join(pairs, ","))
+	}
+	endpoint.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(p.Data))
+	if err != nil {
+		return nil, fmt.Errorf("ingest: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ingest: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("ingest: reading response: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		var e struct {
+			Error string `json:"error"`
+		}
+		msg := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			msg = e.Error
+		}
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	var r Result
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("ingest: decoding response: %w", err)
+	}
+	return &r, nil
+}
+
+// CPUProfile profiles the process's CPU use for d, or until ctx is done, and
+// returns the pprof file. It fails if CPU profiling is already running.
+func CPUProfile(ctx context.Context, d time.Duration) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return nil, fmt.Errorf("ingest: %w", err)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	pprof.StopCPUProfile()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// HeapProfile returns the process's heap profile as of the last garbage collection.
+func HeapProfile() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 0); err != nil {
+		return nil, fmt.Errorf("ingest: %w", err)
+	}
+	return buf.Bytes(), nil
+}
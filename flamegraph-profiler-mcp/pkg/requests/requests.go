@@ -0,0 +1,114 @@
+// Package requests counts the requests the process it is embedded in has
+// served and reports the count at Endpoint, so the profiler can compare
+// profiles captured under different load as costs per request rather than
+// raw totals: a CPU profile is charged the requests served during its
+// window, and a heap profile's allocations those served since the process
+// started.
+//
+//	http.Handle("/", requests.Middleware(mux))
+//	http.Handle(requests.Endpoint, requests.Handler())
+//
+// Work that does not arrive over net/http, such as jobs taken off a queue,
+// counts itself with Add. The agent package labels pushed profiles with the
+// count too.
+//
+// Route and Do count requests by route as well, and run them under a pprof
+// label holding the route, so the profiler can split costs per request by
+// route:
+//
+//	http.Handle("GET /users", requests.Route("GET /users", usersHandler))
+package requests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Endpoint is where the profiler looks for the count on a target.
+const Endpoint = "/debug/requests"
+
+// RouteLabel is the pprof label Route and Do put a request's route in.
+const RouteLabel = "route"
+
+var (
+	total  atomic.Uint64
+	routes sync.Map // route → *atomic.Uint64
+)
+
+// Add records n requests served.
+func Add(n uint64) {
+	total.Add(n)
+}
+
+// Total returns the requests recorded since the process started.
+func Total() uint64 {
+	return total.Load()
+}
+
+// AddRoute records n requests served on route, which count toward Total too.
+func AddRoute(route string, n uint64) {
+	counter, _ := routes.LoadOrStore(route, new(atomic.Uint64))
+	counter.(*atomic.Uint64).Add(n)
+	total.Add(n)
+}
+
+// Routes returns the requests recorded by route since the process started.
+func Routes() map[string]uint64 {
+	counts := make(map[string]uint64)
+	routes.Range(func(route, counter any) bool {
+		counts[route.(string)] = counter.(*atomic.Uint64).Load()
+		return true
+	})
+	return counts
+}
+
+// Do runs f as a request on route, with RouteLabel set to route on the
+// profiles of f and the goroutines it starts, and counts it once f returns.
+func Do(ctx context.Context, route string, f func(context.Context)) {
+	defer AddRoute(route, 1)
+	pprof.Do(ctx, pprof.Labels(RouteLabel, route), f)
+}
+
+// Route serves every request through next as a request on route, as Do does.
+// It counts toward Total itself, so routes go alongside Middleware, not
+// under it.
+func Route(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Do(r.Context(), route, func(ctx context.Context) {
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
+
+// Middleware counts every request next serves, once it has been served.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer total.Add(1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Handler serves Total as a decimal number in plain text, or with a routes
+// query parameter, Total and Routes as JSON:
+//
+//	{"total":1200,"routes":{"GET /users":1000,"POST /orders":200}}
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if r.URL.Query().Has("routes") {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(struct {
+				Total  uint64            `json:"total"`
+				Routes map[string]uint64 `json:"routes"`
+			}{Total(), Routes()})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(strconv.AppendUint(nil, Total(), 10))
+	})
+}
@@ -0,0 +1,298 @@
+// Package wallclock profiles where the goroutines of the process it is
+// embedded in spend wall-clock time, running or not, in the style of fgprof:
+// every goroutine's stack is sampled at a fixed rate, so a request handler
+// waiting on a database, a channel or a lock is charged for the wait as well
+// as for its CPU time. CPU profiles only see the latter, which leaves
+// services dominated by I/O wait looking idle.
+//
+//	http.Handle("/debug/fgprof", wallclock.Handler())
+//
+// The handler serves fgprof's endpoint and pprof format, so the profiler
+// captures from it and from github.com/felixge/fgprof alike. Each sample
+// stops the world to read every goroutine's stack, which costs more the more
+// goroutines there are; keep the rate low for processes with tens of
+// thousands of them. Stacks deeper than 32 frames are cut at their root.
+package wallclock
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHz is the sampling rate of Handler when the request sets none.
+const DefaultHz = 99
+
+// packagePrefix starts the names of this package's functions, which mark
+// the sampler's own goroutine, left out of the profile
+var packagePrefix = strings.TrimSuffix(runtime.FuncForPC(reflect.ValueOf(appendVarintField).Pointer()).Name(), "appendVarintField")
+
+// profile.proto field numbers
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID      = 1
+	locationAddress = 3
+	locationLine    = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID       = 1
+	functionName     = 2
+	functionFilename = 4
+)
+
+// Profile samples the stacks of all goroutines hz times a second for d, or
+// until ctx is done, and returns the gzipped pprof file. Its sample types
+// are fgprof's: samples/count, and time/nanoseconds, each sample weighing
+// one sampling interval.
+func Profile(ctx context.Context, d time.Duration, hz int) ([]byte, error) {
+	if hz <= 0 || hz > 1000 {
+		return nil, fmt.Errorf("wallclock: rate %d Hz is not in [1, 1000]", hz)
+	}
+	start := time.Now()
+	var s sampler
+	tick := time.NewTicker(time.Second / time.Duration(hz))
+	defer tick.Stop()
+	done := time.NewTimer(d)
+	defer done.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-done.C:
+			return s.encode(start, time.Since(start), hz)
+		case <-tick.C:
+			s.sample()
+		}
+	}
+}
+
+// Handler serves a wall-clock profile of the process, like fgprof's
+// handler: ?seconds= sets the window (30 by default) and ?hz= the rate.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if format := query.Get("format"); format != "" && format != "pprof" {
+			http.Error(w, "wallclock: only format=pprof is supported", http.StatusBadRequest)
+			return
+		}
+		seconds := 30.0
+		if v := query.Get("seconds"); v != "" {
+			s, err := strconv.ParseFloat(v, 64)
+			if err != nil || s <= 0 {
+				http.Error(w, "wallclock: invalid seconds "+strconv.Quote(v), http.StatusBadRequest)
+				return
+			}
+			seconds = s
+		}
+		hz := DefaultHz
+		if v := query.Get("hz"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "wallclock: invalid hz "+strconv.Quote(v), http.StatusBadRequest)
+				return
+			}
+			hz = n
+		}
+		data, err := Profile(r.Context(), time.Duration(seconds*float64(time.Second)), hz)
+		if err != nil {
+			if r.Context().Err() == nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="wallclock.pb.gz"`)
+		w.Write(data)
+	})
+}
+
+// sampler counts the goroutine stacks seen, in the order first seen
+type sampler struct {
+	records []runtime.StackRecord
+	counts  map[string]int64
+	stacks  [][]uintptr
+	keys    []string
+}
+
+func (s *sampler) sample() {
+	n, ok := runtime.GoroutineProfile(s.records)
+	for !ok {
+		// Leave room for goroutines started since
+		s.records = make([]runtime.StackRecord, n+n/10+10)
+		n, ok = runtime.GoroutineProfile(s.records)
+	}
+	if s.counts == nil {
+		s.counts = map[string]int64{}
+	}
+	for _, r := range s.records[:n] {
+		stack := r.Stack()
+		var key []byte
+		for _, pc := range stack {
+			key = binary.AppendUvarint(key, uint64(pc))
+		}
+		if _, seen := s.counts[string(key)]; !seen {
+			s.stacks = append(s.stacks, slices.Clone(stack))
+			s.keys = append(s.keys, string(key))
+		}
+		s.counts[string(key)]++
+	}
+}
+
+func (s *sampler) encode(start time.Time, d time.Duration, hz int) ([]byte, error) {
+	e := encoder{strings: map[string]uint64{"": 0}, table: []string{""}, functions: map[[2]string]uint64{}, locations: map[uintptr]location{}}
+	period := int64(time.Second) / int64(hz)
+
+	var out []byte
+	out = appendBytesField(out, profileSampleType, e.valueType("samples", "count"))
+	out = appendBytesField(out, profileSampleType, e.valueType("time", "nanoseconds"))
+	for i, stack := range s.stacks {
+		ids := make([]uint64, 0, len(stack))
+		own := false
+		for _, pc := range stack {
+			l := e.location(pc)
+			ids = append(ids, l.id)
+			own = own || l.own
+		}
+		if own {
+			continue
+		}
+		count := s.counts[s.keys[i]]
+		var b []byte
+		b = appendPackedField(b, sampleLocationID, ids)
+		b = appendPackedField(b, sampleValue, []uint64{uint64(count), uint64(count * period)})
+		out = appendBytesField(out, profileSample, b)
+	}
+	out = append(out, e.out...)
+	out = appendVarintField(out, profileTimeNanos, uint64(start.UnixNano()))
+	out = appendVarintField(out, profileDurationNanos, uint64(d))
+	out = appendBytesField(out, profilePeriodType, e.valueType("wall", "nanoseconds"))
+	out = appendVarintField(out, profilePeriod, uint64(period))
+	for _, v := range e.table {
+		out = appendBytesField(out, profileStringTable, []byte(v))
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(out); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type location struct {
+	id uint64
+	// own is set for locations in this package
+	own bool
+}
+
+// encoder builds the string table, functions and locations of a profile,
+// the latter two encoded into out as they are first used
+type encoder struct {
+	strings   map[string]uint64
+	table     []string
+	functions map[[2]string]uint64
+	locations map[uintptr]location
+	out       []byte
+}
+
+func (e *encoder) str(s string) uint64 {
+	i, ok := e.strings[s]
+	if !ok {
+		i = uint64(len(e.table))
+		e.strings[s] = i
+		e.table = append(e.table, s)
+	}
+	return i
+}
+
+func (e *encoder) valueType(typ, unit string) []byte {
+	b := appendVarintField(nil, valueTypeType, e.str(typ))
+	return appendVarintField(b, valueTypeUnit, e.str(unit))
+}
+
+func (e *encoder) function(name, file string) uint64 {
+	key := [2]string{name, file}
+	id, ok := e.functions[key]
+	if !ok {
+		id = uint64(len(e.functions) + 1)
+		e.functions[key] = id
+		b := appendVarintField(nil, functionID, id)
+		b = appendVarintField(b, functionName, e.str(name))
+		b = appendVarintField(b, functionFilename, e.str(file))
+		e.out = appendBytesField(e.out, profileFunction, b)
+	}
+	return id
+}
+
+// location of a return address, with a line for each function inlined at
+// it, innermost first
+func (e *encoder) location(pc uintptr) location {
+	if l, ok := e.locations[pc]; ok {
+		return l
+	}
+	l := location{id: uint64(len(e.locations) + 1)}
+	b := appendVarintField(nil, locationID, l.id)
+	b = appendVarintField(b, locationAddress, uint64(pc))
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		f, more := frames.Next()
+		l.own = l.own || strings.HasPrefix(f.Function, packagePrefix)
+		line := appendVarintField(nil, lineFunctionID, e.function(f.Function, f.File))
+		line = appendVarintField(line, lineLine, uint64(f.Line))
+		b = appendBytesField(b, locationLine, line)
+		if !more {
+			break
+		}
+	}
+	e.out = appendBytesField(e.out, profileLocation, b)
+	e.locations[pc] = l
+	return l
+}
+
+func appendVarintField(out []byte, num int, v uint64) []byte {
+	out = binary.AppendUvarint(out, uint64(num)<<3)
+	return binary.AppendUvarint(out, v)
+}
+
+func appendBytesField(out []byte, num int, b []byte) []byte {
+	out = binary.AppendUvarint(out, uint64(num)<<3|2)
+	out = binary.AppendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+func appendPackedField(out []byte, num int, vs []uint64) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = binary.AppendUvarint(b, v)
+	}
+	return appendBytesField(out, num, b)
+}
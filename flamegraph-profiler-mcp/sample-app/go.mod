@@ -1,3 +1,7 @@
 module sample-app
 
 go 1.25.2
+
+require github.com/liamchampton/mcp-apps/flamegraph-profiler-mcp/pkg v0.0.0
+
+replace github.com/liamchampton/mcp-apps/flamegraph-profiler-mcp/pkg => ../pkg
@@ -4,6 +4,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/json"
@@ -13,26 +14,114 @@ import (
 	"io"
 	"math"
 	"math/rand"
+	"net/http"
+	_ "net/http/pprof"
 	"os"
 	"regexp"
 	"runtime"
 	"runtime/pprof"
+	"runtime/trace"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/liamchampton/mcp-apps/flamegraph-profiler-mcp/pkg/agent"
+	"github.com/liamchampton/mcp-apps/flamegraph-profiler-mcp/pkg/ingest"
+	"github.com/liamchampton/mcp-apps/flamegraph-profiler-mcp/pkg/requests"
+	"github.com/liamchampton/mcp-apps/flamegraph-profiler-mcp/pkg/wallclock"
 )
 
 var (
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 	memprofile = flag.String("memprofile", "", "write memory profile to file")
 	duration   = flag.Int("duration", 5, "duration to run in seconds")
+	httpAddr   = flag.String("http", "", "serve net/http/pprof and the /debug/fgprof wall-clock profile on this address (e.g. localhost:6060)")
+
+	blockprofile = flag.String("blockprofile", "", "write block profile to file")
+	blockrate    = flag.Int("blockrate", 1, "block profile rate in nanoseconds (1 records every blocking event)")
+
+	mutexprofile  = flag.String("mutexprofile", "", "write mutex profile to file")
+	mutexfraction = flag.Int("mutexfraction", 1, "report 1/n of mutex contention events (1 records every event)")
+
+	tracefile = flag.String("trace", "", "write execution trace to file")
+
+	scenarioFlag = flag.String("scenario", "inefficient", "workload to run: inefficient, or optimized with the sort, fibonacci and string hotspots fixed")
+	leakFlag     = flag.Bool("leak", false, "leak goroutines and 16kB of heap on every loop iteration, for trying out leak detection; memory grows for as long as the app runs")
+
+	pushURL      = flag.String("push-url", "", "push CPU and heap profiles to this profiler server's /ingest (e.g. http://localhost:3003)")
+	pushToken    = flag.String("push-token", os.Getenv("PROFILER_TOKEN"), "bearer token of a client with the ingest capability (default: $PROFILER_TOKEN)")
+	pushTarget   = flag.String("push-target", "sample-app", "target name pushed profiles are filed under")
+	pushLabels   = flag.String("push-labels", "env=demo", "comma-separated key=value labels attached to pushed profiles")
+	pushInterval = flag.Duration("push-interval", 15*time.Second, "time between pushes; the CPU profile covers half of it")
+
+	chaosFlag   = flag.String("chaos", "", "anomalies to inject, as comma-separated kind@start+length, e.g. cpu@10s+5s,latency@30s+3s; kinds are cpu and latency")
+	chaosRandom = flag.Int("chaos-random", 0, "also inject this many anomalies of random kinds at random times during the run")
+	chaosSeed   = flag.Int64("chaos-seed", 1, "seed of -chaos-random, so a run's anomalies can be repeated")
+	chaosDelay  = flag.Duration("chaos-delay", 200*time.Millisecond, "latency added to each loop iteration during a latency spike")
+	chaosCPU    = flag.Int("chaos-cpu", runtime.NumCPU(), "goroutines spinning during a CPU burst")
+	chaosLog    = flag.String("chaos-log", "", "write the ground-truth log of injected anomalies to this file as JSON lines (default: stdout)")
 )
 
+// optimized switches the loop to the fixed versions of its worst hotspots;
+// set by -scenario and /debug/scenario
+var optimized atomic.Bool
+
 func main() {
 	flag.Parse()
 
+	if err := setScenario(*scenarioFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Start execution tracing if requested
+	if *tracefile != "" {
+		f, err := os.Create(*tracefile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not create trace: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		if err := trace.Start(f); err != nil {
+			fmt.Fprintf(os.Stderr, "could not start trace: %v\n", err)
+			os.Exit(1)
+		}
+		defer trace.Stop()
+	}
+
+	if *blockprofile != "" {
+		runtime.SetBlockProfileRate(*blockrate)
+	}
+	if *mutexprofile != "" {
+		runtime.SetMutexProfileFraction(*mutexfraction)
+	}
+
+	// Expose live profiles if requested
+	if *httpAddr != "" {
+		http.HandleFunc("/debug/profile-rates", profileRates)
+		http.HandleFunc("/debug/scenario", scenarioHandler)
+		http.Handle("/debug/fgprof", wallclock.Handler())
+		http.Handle(requests.Endpoint, requests.Handler())
+		go func() {
+			if err := http.ListenAndServe(*httpAddr, nil); err != nil {
+				fmt.Fprintf(os.Stderr, "could not serve pprof: %v\n", err)
+			}
+		}()
+	}
+
+	// Push profiles to a profiler server if requested
+	if *pushURL != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if err := startPushAgent(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "could not start push agent: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Start CPU profiling if requested
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
@@ -48,10 +137,25 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	// Schedule injected anomalies if requested
+	if *chaosFlag != "" || *chaosRandom > 0 {
+		if err := startChaos(time.Duration(*duration) * time.Second); err != nil {
+			fmt.Fprintf(os.Stderr, "could not inject anomalies: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	fmt.Printf("Running inefficient operations for %d seconds...\n", *duration)
 	runInefficiently(*duration)
 	fmt.Println("Done!")
 
+	if *blockprofile != "" {
+		writeProfile("block", *blockprofile)
+	}
+	if *mutexprofile != "" {
+		writeProfile("mutex", *mutexprofile)
+	}
+
 	// Write memory profile if requested
 	if *memprofile != "" {
 		f, err := os.Create(*memprofile)
@@ -68,22 +172,301 @@ func main() {
 	}
 }
 
+// writeProfile writes a named runtime/pprof profile to a file
+func writeProfile(name, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not create %s profile: %v\n", name, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write %s profile: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// startPushAgent pushes a CPU and heap profile every -push-interval until
+// ctx is done, labeled with -push-labels, so a server can follow the app's
+// trends without reaching it
+func startPushAgent(ctx context.Context) error {
+	if *cpuprofile != "" {
+		return fmt.Errorf("-push-url cannot be combined with -cpuprofile, as only one CPU profile can run at a time")
+	}
+	labels := map[string]string{}
+	for _, pair := range strings.Split(*pushLabels, ",") {
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("invalid label %q in -push-labels, expected key=value", pair)
+		}
+		labels[k] = v
+	}
+	a, err := agent.New(agent.Config{
+		Server:      ingest.Client{URL: *pushURL, Token: *pushToken},
+		Target:      *pushTarget,
+		Labels:      labels,
+		Interval:    *pushInterval,
+		CPUDuration: *pushInterval / 2,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Pushing profiles of %s to %s every %s\n", *pushTarget, *pushURL, *pushInterval)
+	go a.Run(ctx)
+	return nil
+}
+
+// profileRates lets a profiler turn on sampled profiles at runtime,
+// e.g. /debug/profile-rates?block=1 before capturing /debug/pprof/block
+// or /debug/profile-rates?mutex=1 before capturing /debug/pprof/mutex.
+func profileRates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	rates := map[string]func(int){
+		"block": runtime.SetBlockProfileRate,
+		"mutex": func(n int) { runtime.SetMutexProfileFraction(n) },
+	}
+	for name, set := range rates {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		rate, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid "+name+" rate: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		set(rate)
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// setScenario picks the workload by name
+func setScenario(name string) error {
+	switch name {
+	case "inefficient":
+		optimized.Store(false)
+	case "optimized":
+		optimized.Store(true)
+	default:
+		return fmt.Errorf("unknown scenario %q, expected inefficient or optimized", name)
+	}
+	return nil
+}
+
+// scenarioHandler switches the workload of a running app, e.g.
+// /debug/scenario?name=optimized, so profiles before and after a fix can be
+// compared without a restart. Without a name it reports the current one.
+func scenarioHandler(w http.ResponseWriter, r *http.Request) {
+	if name := r.URL.Query().Get("name"); name != "" {
+		if err := setScenario(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if optimized.Load() {
+		fmt.Fprintln(w, "optimized")
+	} else {
+		fmt.Fprintln(w, "inefficient")
+	}
+}
+
+// chaosEvent is an anomaly injected at a fixed offset into the run
+type chaosEvent struct {
+	Kind   string
+	Start  time.Duration
+	Length time.Duration
+}
+
+// chaosRecord is a line of the ground-truth log: one when an anomaly starts
+// and one, with the same ID, when it ends
+type chaosRecord struct {
+	ID         int       `json:"id"`
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Phase      string    `json:"phase"`
+	Offset     string    `json:"offset"`
+	Length     string    `json:"length,omitempty"`
+	Delay      string    `json:"delay,omitempty"`
+	Goroutines int       `json:"goroutines,omitempty"`
+}
+
+// chaosLatency is the latency injectLatency adds to each loop iteration,
+// the sum of the delays of the latency spikes in progress
+var chaosLatency atomic.Int64
+
+// parseChaos reads -chaos, e.g. "cpu@10s+5s,latency@30s+3s". Anomalies must
+// start within the run and are cut off at its end.
+func parseChaos(spec string, run time.Duration) ([]chaosEvent, error) {
+	var events []chaosEvent
+	for _, item := range strings.Split(spec, ",") {
+		if item == "" {
+			continue
+		}
+		kind, window, ok := strings.Cut(item, "@")
+		start, length, ok2 := strings.Cut(window, "+")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("invalid anomaly %q in -chaos, expected kind@start+length", item)
+		}
+		if kind != "cpu" && kind != "latency" {
+			return nil, fmt.Errorf("unknown anomaly kind %q in -chaos, expected cpu or latency", kind)
+		}
+		s, err := time.ParseDuration(start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start of %q in -chaos: %v", item, err)
+		}
+		l, err := time.ParseDuration(length)
+		if err != nil || l <= 0 {
+			return nil, fmt.Errorf("invalid length of %q in -chaos, expected a positive duration", item)
+		}
+		if s < 0 || s >= run {
+			return nil, fmt.Errorf("anomaly %q in -chaos starts outside the %s run", item, run)
+		}
+		events = append(events, chaosEvent{Kind: kind, Start: s, Length: min(l, run-s)})
+	}
+	return events, nil
+}
+
+// randomChaos picks n anomalies of random kinds, each starting in the first
+// 80% of the run and lasting a tenth to a fifth of it
+func randomChaos(n int, seed int64, run time.Duration) []chaosEvent {
+	r := rand.New(rand.NewSource(seed))
+	kinds := []string{"cpu", "latency"}
+	events := make([]chaosEvent, n)
+	for i := range events {
+		start := time.Duration(r.Int63n(int64(run) * 8 / 10)).Truncate(time.Millisecond)
+		length := (run/10 + time.Duration(r.Int63n(int64(run)/10+1))).Truncate(time.Millisecond)
+		events[i] = chaosEvent{Kind: kinds[r.Intn(len(kinds))], Start: start, Length: min(length, run-start)}
+	}
+	return events
+}
+
+// startChaos schedules the anomalies of -chaos and -chaos-random, logging
+// each one's start and end as it happens
+func startChaos(run time.Duration) error {
+	events, err := parseChaos(*chaosFlag, run)
+	if err != nil {
+		return err
+	}
+	events = append(events, randomChaos(*chaosRandom, *chaosSeed, run)...)
+	if *chaosCPU < 1 {
+		return fmt.Errorf("-chaos-cpu must be at least 1")
+	}
+
+	out := io.Writer(os.Stdout)
+	if *chaosLog != "" {
+		f, err := os.Create(*chaosLog)
+		if err != nil {
+			return err
+		}
+		// Left open until the process exits, as anomalies end with the run
+		out = f
+	}
+	var mu sync.Mutex
+	enc := json.NewEncoder(out)
+	began := time.Now()
+	logRecord := func(record chaosRecord) {
+		mu.Lock()
+		defer mu.Unlock()
+		record.Time = time.Now().UTC()
+		record.Offset = time.Since(began).Round(time.Millisecond).String()
+		enc.Encode(record)
+	}
+
+	for i, e := range events {
+		id := i + 1
+		time.AfterFunc(e.Start, func() {
+			start := chaosRecord{ID: id, Kind: e.Kind, Phase: "start", Length: e.Length.String()}
+			switch e.Kind {
+			case "cpu":
+				stop := make(chan struct{})
+				for i := 0; i < *chaosCPU; i++ {
+					go chaosBurn(stop)
+				}
+				start.Goroutines = *chaosCPU
+				logRecord(start)
+				time.AfterFunc(e.Length, func() {
+					close(stop)
+					logRecord(chaosRecord{ID: id, Kind: e.Kind, Phase: "end"})
+				})
+			case "latency":
+				chaosLatency.Add(int64(*chaosDelay))
+				start.Delay = chaosDelay.String()
+				logRecord(start)
+				time.AfterFunc(e.Length, func() {
+					chaosLatency.Add(-int64(*chaosDelay))
+					logRecord(chaosRecord{ID: id, Kind: e.Kind, Phase: "end"})
+				})
+			}
+		})
+	}
+	return nil
+}
+
+// chaosBurn spins on arithmetic until stop is closed, a CPU burst that shows
+// in profiles as its own hotspot
+func chaosBurn(stop chan struct{}) {
+	x := 1.0
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		for i := 0; i < 10000; i++ {
+			x = math.Sqrt(x*x + float64(i))
+		}
+	}
+}
+
+// injectLatency sleeps for the latency of the spikes in progress, if any
+func injectLatency() {
+	if d := chaosLatency.Load(); d > 0 {
+		time.Sleep(time.Duration(d))
+	}
+}
+
 // runInefficiently runs various inefficient operations
 func runInefficiently(seconds int) {
 	endTime := time.Now().Add(time.Duration(seconds) * time.Second)
+	ctx := context.Background()
 
 	for time.Now().Before(endTime) {
-		// Run multiple inefficient operations across different categories
-		inefficientSort()
-		heavyComputation()
-		memoryWaster()
-		stringConcatWaste()
-		dataProcessingPipeline()
-		cryptoOperations()
-		jsonSerializationMess()
-		regexAbuse()
-		concurrencyOverhead()
-		recursiveDataStructures()
+		// Run multiple inefficient operations across different categories.
+		// Each pass serves one request on each of three routes, counted and
+		// labeled by route so costs split per request by route.
+		requests.Do(ctx, "GET /search", func(context.Context) {
+			if optimized.Load() {
+				efficientSort()
+				efficientStrings()
+			} else {
+				inefficientSort()
+				stringConcatWaste()
+			}
+			regexAbuse()
+		})
+		requests.Do(ctx, "POST /records", func(context.Context) {
+			memoryWaster()
+			dataProcessingPipeline()
+			jsonSerializationMess()
+		})
+		requests.Do(ctx, "GET /stats", func(context.Context) {
+			if optimized.Load() {
+				efficientComputation()
+			} else {
+				heavyComputation()
+			}
+			cryptoOperations()
+			concurrencyOverhead()
+			recursiveDataStructures()
+		})
+		if *leakFlag {
+			leakyWorkers()
+			rememberRequest()
+		}
+		injectLatency()
 	}
 }
 
@@ -111,6 +494,46 @@ func bubbleSort(arr []int) {
 	}
 }
 
+// efficientSort is inefficientSort with the standard library sort
+func efficientSort() {
+	data := make([]int, 500)
+	for i := range data {
+		data[i] = rand.Intn(10000)
+	}
+	sort.Ints(data)
+}
+
+// efficientComputation is heavyComputation with an iterative fibonacci
+func efficientComputation() {
+	for i := 0; i < 5; i++ {
+		_ = fibonacciIterative(25 + rand.Intn(5))
+	}
+
+	sum := 0.0
+	for i := 0; i < 1000; i++ {
+		sum += math.Pow(float64(i), 2.5)
+		sum += math.Sin(float64(i)) * math.Cos(float64(i))
+	}
+}
+
+// fibonacciIterative calculates fibonacci numbers in O(n)
+func fibonacciIterative(n int) int {
+	a, b := 0, 1
+	for i := 0; i < n; i++ {
+		a, b = b, a+b
+	}
+	return a
+}
+
+// efficientStrings is stringConcatWaste with a strings.Builder
+func efficientStrings() {
+	var b strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&b, "item-%d,", i)
+	}
+	_ = b.String()
+}
+
 // heavyComputation performs CPU-intensive calculations inefficiently
 func heavyComputation() {
 	// Calculate fibonacci recursively (exponential time complexity)
@@ -653,6 +1076,8 @@ func mutexContention() {
 			for j := 0; j < 100; j++ {
 				mu.Lock()
 				counter++
+				// Formatting while holding the lock makes the critical section needlessly long
+				_ = fmt.Sprintf("counter-%d", counter)
 				mu.Unlock()
 			}
 		}()
@@ -660,6 +1085,28 @@ func mutexContention() {
 	wg.Wait()
 }
 
+// leakyWorkers starts workers that wait for a result nobody sends.
+// Each call leaks goroutines parked on a channel receive forever.
+func leakyWorkers() {
+	for i := 0; i < 5; i++ {
+		done := make(chan struct{})
+		go waitForResult(done)
+	}
+}
+
+func waitForResult(done chan struct{}) {
+	<-done
+}
+
+// requestLog keeps a copy of every request "for debugging" and is never
+// trimmed, so with -leak in-use heap grows by 16kB per iteration for as
+// long as the app runs
+var requestLog [][]byte
+
+func rememberRequest() {
+	requestLog = append(requestLog, bytes.Repeat([]byte("x"), 16*1024))
+}
+
 // ============================================================================
 // RECURSIVE DATA STRUCTURES - Deep recursion
 // ============================================================================
@@ -1,114 +1,291 @@
 import { registerAppResource, registerAppTool, RESOURCE_MIME_TYPE } from "@modelcontextprotocol/ext-apps/server";
-import { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import { McpServer, type RegisteredTool } from "@modelcontextprotocol/sdk/server/mcp.js";
 import type { CallToolResult, ReadResourceResult } from "@modelcontextprotocol/sdk/types.js";
 import fs from "node:fs/promises";
 import path from "node:path";
 import { z } from "zod";
-import { execSync } from "node:child_process";
+import { detectAntiPatterns, type AntiPattern } from "./lib/antipatterns.js";
+import { CAPABILITIES, requiredCapability, type Capability } from "./lib/auth.js";
+import {
+  baselineKind,
+  describeSelection,
+  headCommit,
+  profileCommit,
+  repoOfProfile,
+  selectBaseline,
+  tagCommit,
+  type SelectedBaseline,
+} from "./lib/baselines.js";
+import { recordCapture, type Capture } from "./lib/captures.js";
+import type { Orientation } from "./lib/charts.js";
+import { catalogProfile, keepProfile, resolveProfilePath } from "./lib/catalog.js";
+import type { ColorScheme } from "./lib/colors.js";
+import { checkCaptureSeconds, checkTarget } from "./lib/config.js";
+import { estimateCost, formatCostEstimate, type CostEstimate } from "./lib/cost.js";
+import {
+  contentionSites,
+  formatContention,
+  isContentionProfile,
+  withoutProfilerSamples,
+  type ContentionReport,
+} from "./lib/contention.js";
+import { diffProfiles, type DiffResult } from "./lib/diff.js";
+import { annotateWithContainer, execDownloadProfile, inspectContainer, REVISION_LABEL } from "./lib/docker.js";
+import { buildGoAppAsync, PROFILE_FLAGS, runGoAppAsync, type ProfileType } from "./lib/goapp.js";
+import { checkEnergyModel, estimateEnergy, formatEnergyEstimate, type EnergyEstimate } from "./lib/energy.js";
+import {
+  buildFlameTree,
+  describeFlameTree,
+  dominantCallPath,
+  getMaxDepth,
+  invertFlameTree,
+  percentOf,
+  topFunctionsOf,
+  type ProfileFrame,
+  type TopFunction,
+} from "./lib/flamegraph.js";
+import {
+  findingFromAntiPattern,
+  findingFromRegression,
+  formatFinding,
+  recordFindings,
+  REGRESSION_THRESHOLD_PTS,
+  type Finding,
+} from "./lib/findings.js";
+import { HEAP_MODES, heapSites, isHeapProfile, type HeapModeReport } from "./lib/heap.js";
+import { HEAP_DELTA_MODES, heapDelta, type HeapSiteDelta } from "./lib/heapdelta.js";
+import { LANGS, t } from "./lib/i18n.js";
+import { captureHeapSeries, type HeapSnapshot } from "./lib/leaks.js";
+import { withCaptureLimits } from "./lib/limits.js";
+import {
+  formatOwnerTotals,
+  hotspotsByOwner,
+  loadOwnership,
+  ownersOf,
+  ownershipForProfile,
+  type OwnershipReport,
+} from "./lib/owners.js";
+import { captureOffCpuProfile, OFFCPU_MODES, type OffCpuMode } from "./lib/offcpu.js";
+import { capturePerfProfile, kernelShare } from "./lib/perf.js";
+import { fileOf, formatValue, readProfile, sampleIndexOf, toBaseUnit, totalOf, writeProfile } from "./lib/pprof.js";
+import { duringWindow, noProgress, progressReporter, type ProgressReporter } from "./lib/progress.js";
+import { flamegraphLink, flamegraphUri, withRenderDefaults, type FlamegraphLayout } from "./lib/render.js";
+import { formatRate, NORMALIZATIONS, rateBasis } from "./lib/rates.js";
+import { versioned } from "./lib/schema.js";
+import { storedProfilePath } from "./lib/store.js";
+import { applySuppressions, listSuppressions } from "./lib/suppressions.js";
+import { symbolizeNativeFile } from "./lib/symbolize.js";
+import { countingRequests, downloadProfile, setProfileRates, WALLCLOCK_ENDPOINT } from "./lib/target.js";
+import { topReport } from "./lib/top.js";
+import { applyFrameFilters, hasFrameFilters, type FrameFilters } from "./lib/transform.js";
+import { registerAllocTools } from "./tools/allocs.js";
+import { registerBadgeResources, registerBadgeTools } from "./tools/badges.js";
+import { registerBaselineTools } from "./tools/baselines.js";
+import { registerBudgetTools } from "./tools/budgets.js";
+import { registerBuildTools } from "./tools/build.js";
+import { registerBundleTools } from "./tools/bundles.js";
+import { registerCapacityTools } from "./tools/capacity.js";
+import { registerCallGraphTools } from "./tools/callgraph.js";
+import { registerCatalogTools } from "./tools/catalog.js";
+import { registerConfigTools } from "./tools/config.js";
+import { registerContinuousTools } from "./tools/continuous.js";
+import { registerCoreTools } from "./tools/core.js";
+import { registerDigestTools } from "./tools/digest.js";
+import { registerDiscoverTools } from "./tools/discover.js";
+import { colorSchemeField, diffColorSchemeField, filterLine, filterNote, frameFilterFields, layoutFields } from "./tools/filters.js";
+import { registerFindingTools } from "./tools/findings.js";
+import { registerGcTools } from "./tools/gc.js";
+import { registerGoroutineTools } from "./tools/goroutines.js";
+import { registerHistogramTools } from "./tools/histograms.js";
+import { registerK8sTools } from "./tools/k8s.js";
+import { registerLeakTools } from "./tools/leaks.js";
+import { registerOtlpTools } from "./tools/otlp.js";
+import { registerOwnerTools } from "./tools/owners.js";
+import { registerPprofWebTools } from "./tools/pprofweb.js";
+import { registerPrCommentTools } from "./tools/prcomment.js";
+import { registerWorkflowPrompts } from "./tools/prompts.js";
+import { registerPyroscopeTools } from "./tools/pyroscope.js";
+import { registerRegressionTools } from "./tools/regressions.js";
+import { registerSampleAppTools } from "./tools/sampleapp.js";
+import { registerFlamegraphResources } from "./tools/resources.js";
+import { registerRouteCostTools } from "./tools/routecost.js";
+import { registerSessionTools } from "./tools/sessions.js";
+import { registerSloTools } from "./tools/slo.js";
+import { registerSourceTools } from "./tools/source.js";
+import { registerSupervisorTools } from "./tools/supervisor.js";
+import { registerSuppressionTools } from "./tools/suppressions.js";
+import { registerTestTools } from "./tools/tests.js";
+import { registerTraceTools } from "./tools/trace.js";
+import { registerTracepointTools } from "./tools/tracepoints.js";
+import { registerTriggerTools } from "./tools/triggers.js";
+import { registerUprobeTools } from "./tools/uprobes.js";
+import { registerWatchTools } from "./tools/watch.js";
 
 const DIST_DIR = import.meta.filename.endsWith(".ts")
   ? path.join(import.meta.dirname, "dist")
   : import.meta.dirname;
 
 // Profile data types
-interface ProfileFrame {
-  name: string;
-  value: number;
-  children?: ProfileFrame[];
-}
-
 interface ProfileData {
   name: string;
   duration: number;
   sampleCount: number;
-  topFunctions: Array<{ name: string; percentage: number; samples: number }>;
+  topFunctions: TopFunction[];
   flamegraphData: ProfileFrame;
   rawProfile?: string;
+  // CPU seconds for cpu profiles, bytes for heap profiles, delay seconds for block and mutex profiles
+  total?: number;
+  costEstimate?: CostEstimate;
+  energyEstimate?: EnergyEstimate;
+  diff?: Omit<DiffResult, "flamegraph">;
+  heap?: { mode: string; reports: HeapModeReport[] };
+  contention?: { kind: ContentionKind; report: ContentionReport };
+  antiPatterns?: AntiPattern[];
+  findings?: Finding[];
+  // Anti-patterns or diff entries hidden by suppressions
+  suppressed?: number;
+  ownership?: OwnershipReport;
+  // Flamegraph coloring picked by the caller; the UI defaults to classic, or diff for differential flamegraphs
+  colorScheme?: ColorScheme;
+  orientation?: Orientation;
+  // flamegraphData is inverted: rooted at the functions samples end in
+  inverted?: boolean;
+  // Color-blind-safe colors; the tool's text also gives the flamegraph as text
+  accessibility?: boolean;
+  // Catalog ID of the stored profile, for list_profiles and tools taking a profile
+  profileId?: string;
 }
 
+// What each profile type's flamegraph is weighted by
+const PROFILE_MEASURES: Record<ProfileType, string> = {
+  cpu: "CPU Time",
+  heap: "In-Use Memory",
+  block: "Blocking Time",
+  mutex: "Lock Contention",
+};
+
 // Profile a Go application using pprof
 async function profileGoApp(
   appPath: string,
   duration: number,
-  profileType: "cpu" | "heap"
+  profileType: ProfileType,
+  filters: FrameFilters = {},
+  progress: ProgressReporter = noProgress,
+  signal?: AbortSignal,
 ): Promise<ProfileData> {
   const resolvedPath = path.resolve(appPath);
   const profileFile = `/tmp/profile_${Date.now()}.pb.gz`;
+  const appName = path.basename(resolvedPath, ".go");
+  const binary = `/tmp/${appName}`;
 
   try {
-    // Build the Go app with profiling
-    const appDir = path.dirname(resolvedPath);
-    const appName = path.basename(resolvedPath, ".go");
-
     // Compile the Go application
-    execSync(`go build -o /tmp/${appName} ${resolvedPath}`, {
-      cwd: appDir,
-      stdio: "pipe",
-    });
+    progress(0, undefined, `building ${path.basename(resolvedPath)}`);
+    await buildGoAppAsync(resolvedPath, binary, signal);
 
-    // Run with CPU profiling
+    // Run the app and collect the requested profile
     const startTime = Date.now();
-
-    if (profileType === "cpu") {
-      // Run the app and collect CPU profile
-      execSync(
-        `/tmp/${appName} -cpuprofile=${profileFile} -duration=${duration}`,
-        { stdio: "pipe", timeout: (duration + 10) * 1000 }
-      );
-    } else {
-      // Run for heap profile
-      execSync(
-        `/tmp/${appName} -memprofile=${profileFile} -duration=${duration}`,
-        { stdio: "pipe", timeout: (duration + 10) * 1000 }
-      );
-    }
+    await duringWindow(progress, `capturing ${profileType} profile`, duration,
+      runGoAppAsync(binary, `${PROFILE_FLAGS[profileType]}=${profileFile}`, duration, signal), 1);
 
     const actualDuration = (Date.now() - startTime) / 1000;
 
-    // Try to get stack traces using pprof -traces format
     let flamegraphData: ProfileFrame;
-    let topFunctions: Array<{ name: string; percentage: number; samples: number }>;
+    let topFunctions: TopFunction[];
     let totalSamples: number;
+    let total: number | undefined;
+    let antiPatterns: AntiPattern[] = [];
+    let contention: ProfileData["contention"];
+    let suppressed = 0;
+    let owned: OwnershipReport | undefined;
+    let profileId: string | undefined;
+    // Depth and top functions of the whole capture, whatever the filters
+    let captureDepth: number | undefined;
+    let captureTopFunctions: TopFunction[] | undefined;
 
     try {
-      // Use -traces to get full stack traces
-      const tracesOutput = execSync(
-        `go tool pprof -traces ${profileFile} 2>/dev/null`,
-        { encoding: "utf-8", maxBuffer: 50 * 1024 * 1024 }
-      );
-      
-      flamegraphData = parseTracesOutput(tracesOutput);
+      // Name cgo and shared-library frames the runtime left as addresses
+      await symbolizeNativeFile(profileFile);
+      const captured = readProfile(profileFile);
+      const profile = applyFrameFilters(captured, filters);
+      // CPU trees are weighted by sample count; heap trees by in-use bytes
+      const sampleIndex = sampleIndexOf(profile, profileType === "cpu" ? "samples" : undefined);
+
+      flamegraphData = buildFlameTree(profile, sampleIndex);
       totalSamples = flamegraphData.value || 1;
-      
-      // Get top functions from pprof -top
-      const topOutput = execSync(
-        `go tool pprof -top -nodecount=20 ${profileFile} 2>/dev/null`,
-        { encoding: "utf-8" }
-      );
-      topFunctions = parseTopOutput(topOutput, totalSamples);
+      topFunctions = topFunctionsOf(profile, sampleIndex);
+      if (profile !== captured) {
+        captureDepth = getMaxDepth(buildFlameTree(captured, sampleIndex));
+        captureTopFunctions = topFunctionsOf(captured, sampleIndex);
+      }
+
+      const totalIndex = sampleIndexOf(captured);
+      total = toBaseUnit(totalOf(captured, totalIndex), captured.sampleTypes[totalIndex].unit);
+      const suppressions = await listSuppressions();
+      ({ kept: antiPatterns, suppressed } = applySuppressions(
+        detectAntiPatterns(profile, sampleIndex),
+        suppressions,
+        (pattern) => pattern.function,
+        (name) => fileOf(profile, name),
+      ));
+      if (profileType === "block" || profileType === "mutex") {
+        contention = { kind: profileType, report: contentionSites(profile) };
+      }
+
+      const ownership = await loadOwnership(resolvedPath);
+      if (ownership.rules.length > 0) {
+        const ownersOfFunction = (name: string) => ownersOf(ownership, name, fileOf(profile, name));
+        topFunctions = topFunctions.map((f) => ({ ...f, owners: ownersOfFunction(f.name) }));
+        antiPatterns = antiPatterns.map((p) => ({ ...p, owners: ownersOfFunction(p.function) }));
+        owned = hotspotsByOwner(profile, sampleIndex, ownership);
+      }
     } catch {
-      // If pprof parsing fails, use enriched demo data
+      // If pprof parsing fails, use enriched demo data. Anything read from
+      // the capture before the failure is dropped, so nothing is recorded
+      // against the demo data.
       const demo = generateDemoProfile(appPath, actualDuration, profileType);
       flamegraphData = demo.flamegraphData;
       totalSamples = demo.sampleCount;
       topFunctions = demo.topFunctions;
+      total = undefined;
+      antiPatterns = [];
+      contention = undefined;
+      suppressed = 0;
+      owned = undefined;
+      captureDepth = undefined;
+      captureTopFunctions = undefined;
     }
 
     // If flamegraph has less than 3 levels, use demo data for richer visualization
-    const maxDepth = getMaxDepth(flamegraphData);
+    const maxDepth = captureDepth ?? getMaxDepth(flamegraphData);
     if (maxDepth < 4) {
       const demo = generateDemoProfile(appPath, actualDuration, profileType);
       flamegraphData = demo.flamegraphData;
       topFunctions = demo.topFunctions;
       totalSamples = demo.sampleCount;
-    }
-
-    // Cleanup
-    try {
-      await fs.unlink(profileFile);
-      await fs.unlink(`/tmp/${appName}`);
-    } catch {
-      // Ignore cleanup errors
+      total = undefined;
+      antiPatterns = [];
+      contention = undefined;
+      owned = undefined;
+    } else if (total !== undefined) {
+      const commit = await headCommit(resolvedPath);
+      const capture = await recordCapture({
+        target: resolvedPath,
+        commit,
+        profileType,
+        duration: actualDuration,
+        total,
+        unit: profileType === "heap" ? "bytes" : "seconds",
+        topFunctions: captureTopFunctions ?? topFunctions,
+        issues: antiPatterns.length,
+      }).catch(() => undefined);
+      const entry = await keepProfile(profileFile, `${appName}_${profileType}`, {
+        target: resolvedPath,
+        profileType,
+        commit,
+        captureId: capture?.id,
+      }).catch(() => undefined);
+      profileId = entry?.id;
     }
 
     return {
@@ -117,112 +294,445 @@ async function profileGoApp(
       sampleCount: totalSamples,
       topFunctions,
       flamegraphData,
+      total,
+      antiPatterns,
+      contention,
+      suppressed,
+      ownership: owned,
+      profileId,
       rawProfile: `# ${profileType} profile for ${appName}\n# Duration: ${actualDuration.toFixed(2)}s\n# Samples: ${totalSamples}`,
     };
   } catch (error) {
+    // A cancelled call has no one to show demo data to
+    signal?.throwIfAborted();
     // If profiling fails entirely, generate demo data
     return generateDemoProfile(appPath, duration, profileType);
+  } finally {
+    await fs.unlink(profileFile).catch(() => undefined);
+    await fs.unlink(binary).catch(() => undefined);
   }
 }
 
-// Get maximum depth of the flamegraph tree
-function getMaxDepth(frame: ProfileFrame, currentDepth = 0): number {
-  if (!frame.children || frame.children.length === 0) {
-    return currentDepth;
+const CONTENTION_KINDS = ["block", "mutex"] as const;
+type ContentionKind = (typeof CONTENTION_KINDS)[number];
+
+const CONTENTION_TEXT: Record<ContentionKind, {
+  title: string;
+  measures: string;
+  rateDescription: string;
+  enable: string;
+  tip: string;
+}> = {
+  block: {
+    title: "Block",
+    measures: "where goroutines wait on channels, mutexes, select and WaitGroups",
+    rateDescription: "Block profile rate in nanoseconds",
+    enable: "runtime.SetBlockProfileRate",
+    tip: "Wide frames are where goroutines wait longest. Long waits on channels point to slow producers or consumers; on mutexes, to long critical sections.",
+  },
+  mutex: {
+    title: "Mutex",
+    measures: "which lock sites make other goroutines wait, by total contention delay",
+    rateDescription: "Mutex profile fraction (report 1/n of events)",
+    enable: "runtime.SetMutexProfileFraction",
+    tip: "Mutex profiles charge the delay to the goroutine holding the lock, at its Unlock. Shrink those critical sections, shard the lock, or switch to atomics.",
+  },
+};
+
+// A tool's flamegraph drawn as asked, or as the server config draws them by
+// default: colors, orientation, and inverted by leaf function
+function withLayout(profileData: ProfileData, asked: FlamegraphLayout, diff = false): ProfileData {
+  const layout = withRenderDefaults(asked, diff);
+  return {
+    ...profileData,
+    flamegraphData: layout.inverted ? invertFlameTree(profileData.flamegraphData) : profileData.flamegraphData,
+    colorScheme: layout.color,
+    orientation: layout.orientation,
+    inverted: layout.inverted,
+    accessibility: layout.accessibility,
+  };
+}
+
+// A tool's text with, when accessibility is on, its flamegraph as text ahead
+// of the closing tip, so screen reader users get what the UI draws
+function withTextEquivalent(text: string, laidOut: ProfileData): string {
+  if (!laidOut.accessibility) {
+    return text;
   }
-  return Math.max(...frame.children.map(child => getMaxDepth(child, currentDepth + 1)));
+  const tip = text.lastIndexOf("💡 Tip:");
+  const at = tip === -1 ? text.length : tip;
+  return `${text.slice(0, at).trimEnd()}
+
+♿ Flamegraph as text (share of the total, hottest first${laidOut.inverted ? ", rooted at the functions samples end in" : ""}):
+${describeFlameTree(laidOut.flamegraphData).join("\n")}
+
+${text.slice(at)}`.trimEnd();
 }
 
-// Parse pprof -traces output into flamegraph format
-function parseTracesOutput(tracesOutput: string): ProfileFrame {
-  const root: ProfileFrame = { name: "root", value: 0, children: [] };
-  const lines = tracesOutput.split("\n");
-  
-  let currentStack: string[] = [];
-  let currentSamples = 1;
-  
-  for (const line of lines) {
-    const trimmed = line.trim();
-    
-    // New stack trace starts with sample count or "---"
-    if (trimmed.startsWith("---") || trimmed === "") {
-      if (currentStack.length > 0) {
-        addStackToTree(root, currentStack.reverse(), currentSamples);
-        currentStack = [];
-        currentSamples = 1;
+// Capture a block or mutex profile from a live target and render its contention
+async function captureContentionProfile(
+  kind: ContentionKind,
+  target: string,
+  seconds: number,
+  rate: number | undefined,
+  limit: number,
+  filters: FrameFilters = {},
+  layout: FlamegraphLayout = {},
+  progress: ProgressReporter = noProgress,
+  signal?: AbortSignal,
+): Promise<CallToolResult> {
+  const text = CONTENTION_TEXT[kind];
+  let profileFile: string | undefined;
+  let requestLabels: Record<string, string> = {};
+  try {
+    checkTarget(target);
+    checkCaptureSeconds(seconds);
+    if (rate !== undefined) {
+      await setProfileRates(target, { [kind]: rate });
+    }
+    try {
+      [profileFile, requestLabels] = await countingRequests(target, seconds, () =>
+        duringWindow(progress, `capturing ${kind} profile`, seconds, downloadProfile(target, kind, seconds, signal)));
+    } finally {
+      // Contention profiling has overhead; switch it back off if we turned it on
+      if (rate !== undefined) {
+        await setProfileRates(target, { [kind]: 0 }).catch(() => undefined);
       }
-      continue;
     }
-    
-    // Parse sample count if present (e.g., "      1   10ms")
-    const sampleMatch = trimmed.match(/^\s*(\d+)\s+[\d.]+[^\s]*\s*$/);
-    if (sampleMatch) {
-      currentSamples = parseInt(sampleMatch[1], 10);
-      continue;
+
+    const profile = withoutProfilerSamples(readProfile(profileFile));
+    if (!isContentionProfile(profile)) {
+      const types = profile.sampleTypes.map((t) => t.type).join(", ");
+      throw new Error(`Not a ${kind} profile (sample types: ${types})`);
     }
-    
-    // Stack frame line - extract function name
-    const funcMatch = trimmed.match(/^#\d+\s+[\dx]+\s+(.+?)\s+.+$/);
-    if (funcMatch) {
-      currentStack.push(funcMatch[1]);
-    } else if (trimmed && !trimmed.startsWith("#")) {
-      // Alternative format: just function name
-      const simpleName = trimmed.split(/\s+/)[0];
-      if (simpleName && !simpleName.match(/^[\d.]+[^\s]*$/)) {
-        currentStack.push(simpleName);
-      }
+    const captured = contentionSites(profile, limit);
+    const sampleIndex = sampleIndexOf(profile, "delay");
+    const capture = await recordCapture({
+      target,
+      profileType: kind,
+      duration: seconds,
+      total: toBaseUnit(captured.totalDelay, captured.unit),
+      unit: "seconds",
+      topFunctions: topFunctionsOf(profile, sampleIndex),
+      issues: 0,
+    }).catch(() => undefined);
+
+    const view = applyFrameFilters(profile, filters);
+    const report = view === profile ? captured : contentionSites(view, limit);
+    const flamegraphData = buildFlameTree(view, sampleIndex);
+    const topFunctions = topFunctionsOf(view, sampleIndex);
+    const entry = await keepProfile(profileFile, `${target}_${kind}`, { target, profileType: kind, captureId: capture?.id, labels: requestLabels });
+
+    const textSummary = `${text.title} Profile for ${target} (${seconds}s window)${filterNote(filters)}:
+
+${formatContention(report)}
+${report.totalContentions === 0 ? `\n⚠️ No contention events were recorded. Is ${kind} profiling enabled in the target (${text.enable})? Pass \`rate\` to enable it for the capture.\n` : ""}
+📁 Saved as ${entry.id}
+💡 Tip: ${text.tip}`;
+
+    const profileData: ProfileData = {
+      name: `${target} (${kind})`,
+      duration: seconds,
+      sampleCount: flamegraphData.value,
+      topFunctions,
+      flamegraphData,
+      total: toBaseUnit(captured.totalDelay, captured.unit),
+      contention: { kind, report },
+      profileId: entry.id,
+    };
+
+    const laidOut = withLayout(profileData, layout);
+    return {
+      content: [{ type: "text", text: withTextEquivalent(textSummary, laidOut) }],
+      structuredContent: laidOut as unknown as Record<string, unknown>,
+    };
+  } catch (error) {
+    const message = error instanceof Error ? error.message : "Unknown error";
+    return {
+      content: [{ type: "text", text: `Error capturing ${kind} profile: ${message}` }],
+      isError: true,
+    };
+  } finally {
+    if (profileFile) {
+      await fs.unlink(profileFile).catch(() => undefined);
     }
   }
-  
-  // Handle last stack
-  if (currentStack.length > 0) {
-    addStackToTree(root, currentStack.reverse(), currentSamples);
+}
+
+const DOCKER_PROFILE_TYPES = ["cpu", "wallclock", "heap", "goroutine", "block", "mutex"] as const;
+type DockerProfileType = (typeof DOCKER_PROFILE_TYPES)[number];
+
+// pprof endpoint and capture unit for each profile type taken from a container
+const DOCKER_PROFILES: Record<DockerProfileType, { endpoint: string; unit: Capture["unit"]; windowed: boolean }> = {
+  cpu: { endpoint: "profile", unit: "seconds", windowed: true },
+  wallclock: { endpoint: WALLCLOCK_ENDPOINT, unit: "seconds", windowed: true },
+  heap: { endpoint: "heap", unit: "bytes", windowed: false },
+  goroutine: { endpoint: "goroutine", unit: "count", windowed: false },
+  block: { endpoint: "block", unit: "seconds", windowed: true },
+  mutex: { endpoint: "mutex", unit: "seconds", windowed: true },
+};
+
+// Capture a profile from a Go process in a Docker container, through its
+// published pprof port or by fetching it from inside the container
+async function captureDockerProfile(
+  container: string,
+  port: number,
+  profileType: DockerProfileType,
+  seconds: number,
+  mode: "auto" | "port" | "exec",
+  filters: FrameFilters = {},
+  layout: FlamegraphLayout = {},
+  progress: ProgressReporter = noProgress,
+  signal?: AbortSignal,
+): Promise<CallToolResult> {
+  let profileFile: string | undefined;
+  try {
+    checkCaptureSeconds(seconds);
+    const info = await inspectContainer(container);
+    const published = info.ports[port];
+    if (mode === "port" && !published) {
+      throw new Error(`Port ${port} of ${info.name} is not published; publish it (e.g. -p ${port}:${port}) or use mode 'exec'`);
+    }
+    const { endpoint, unit, windowed } = DOCKER_PROFILES[profileType];
+    const window = windowed ? seconds : 0;
+    const via = published && mode !== "exec" ? `published port ${published}` : `docker exec (port ${port})`;
+    profileFile = await duringWindow(progress, `capturing ${profileType} profile`, window > 0 ? window : undefined, published && mode !== "exec"
+      ? downloadProfile(published, endpoint, window, signal)
+      : execDownloadProfile(info.name, port, endpoint, window, signal));
+
+    // Tag the profile with the image's source commit for baseline selection
+    const revision = info.labels[REVISION_LABEL]?.match(/^[0-9a-f]{7,40}$/)?.[0];
+    const captured = annotateWithContainer(readProfile(profileFile), info);
+    const tagged = revision ? tagCommit(captured, revision) : captured;
+    const stored = await storedProfilePath(`${info.name}_${profileType}`);
+    writeProfile(stored, tagged);
+
+    const profile = profileType === "block" || profileType === "mutex" ? withoutProfilerSamples(tagged) : tagged;
+    const sampleIndex = sampleIndexOf(profile, profileType === "cpu" ? "samples" : undefined);
+    const totalIndex = sampleIndexOf(profile);
+    const total = toBaseUnit(totalOf(profile, totalIndex), profile.sampleTypes[totalIndex].unit);
+    const capture = await recordCapture({
+      target: `docker:${info.name}`,
+      commit: revision,
+      profileType,
+      duration: window,
+      total,
+      unit,
+      topFunctions: topFunctionsOf(profile, sampleIndex),
+      issues: 0,
+    }).catch(() => undefined);
+
+    const view = applyFrameFilters(profile, filters);
+    const flamegraphData = buildFlameTree(view, sampleIndex);
+    const topFunctions = topFunctionsOf(view, sampleIndex);
+    const report = topReport(view, totalIndex, 5);
+    const entry = await catalogProfile(stored, { target: `docker:${info.name}`, profileType, commit: revision, captureId: capture?.id });
+
+    const rows = report.functions.map((f, i) => `${i + 1}. ${f.name}: ${formatValue(f.flat, report.unit)} (${f.flatPct}%)`);
+    const textSummary = `🐳 ${profileType.toUpperCase()} profile for container ${info.name} (${info.image}) via ${via}${window > 0 ? `, ${window}s window` : ""}${filterNote(filters)}:
+
+${report.summary}
+
+🔥 Top Functions:
+${rows.length > 0 ? rows.join("\n") : "None"}
+
+📁 Saved as ${entry.id} (${stored})${revision ? `, tagged with commit ${revision.slice(0, 12)}` : ""}
+💡 Tip: Pass the profile ID to top_functions, list_source or diff_flamegraph for a closer look.`;
+
+    const profileData: ProfileData = {
+      name: `${info.name} (${profileType})`,
+      duration: window,
+      sampleCount: flamegraphData.value,
+      topFunctions,
+      flamegraphData,
+      total,
+      contention: profileType === "block" || profileType === "mutex"
+        ? { kind: profileType, report: contentionSites(view) }
+        : undefined,
+      profileId: entry.id,
+    };
+
+    const laidOut = withLayout(profileData, layout);
+    return {
+      content: [{ type: "text", text: withTextEquivalent(textSummary, laidOut) }],
+      structuredContent: laidOut as unknown as Record<string, unknown>,
+    };
+  } catch (error) {
+    const message = error instanceof Error ? error.message : "Unknown error";
+    return {
+      content: [{ type: "text", text: `Error profiling container: ${message}` }],
+      isError: true,
+    };
+  } finally {
+    if (profileFile) {
+      await fs.unlink(profileFile).catch(() => undefined);
+    }
   }
-  
-  return root;
 }
 
-// Add a stack trace to the flamegraph tree
-function addStackToTree(root: ProfileFrame, stack: string[], samples: number) {
-  root.value += samples;
-  let current = root;
-  
-  for (const frame of stack) {
-    let child = current.children?.find(c => c.name === frame);
-    if (!child) {
-      child = { name: frame, value: 0, children: [] };
-      current.children = current.children || [];
-      current.children.push(child);
+// Sample a running process's Go and kernel stacks together with perf
+async function capturePerfProcessProfile(
+  pid: number,
+  seconds: number,
+  frequency: number,
+  filters: FrameFilters = {},
+  layout: FlamegraphLayout = {},
+  progress: ProgressReporter = noProgress,
+  signal?: AbortSignal,
+): Promise<CallToolResult> {
+  try {
+    checkCaptureSeconds(seconds);
+    const captured = await duringWindow(progress, "sampling with perf", seconds, capturePerfProfile({ pid, seconds, frequency, signal }));
+    if (captured.samples.length === 0) {
+      throw new Error(`No samples from pid ${pid} in ${seconds}s; is it using CPU?`);
     }
-    child.value += samples;
-    current = child;
+    const target = `pid:${pid}`;
+    const stored = await storedProfilePath(`pid${pid}_perf`);
+    writeProfile(stored, captured);
+
+    const sampleIndex = sampleIndexOf(captured, "samples");
+    const totalIndex = sampleIndexOf(captured);
+    const total = toBaseUnit(totalOf(captured, totalIndex), captured.sampleTypes[totalIndex].unit);
+    const inKernel = kernelShare(captured, totalIndex);
+    const capture = await recordCapture({
+      target,
+      profileType: "cpu",
+      duration: seconds,
+      total,
+      unit: "seconds",
+      topFunctions: topFunctionsOf(captured, sampleIndex),
+      issues: 0,
+    }).catch(() => undefined);
+
+    const view = applyFrameFilters(captured, filters);
+    const flamegraphData = buildFlameTree(view, sampleIndex);
+    const topFunctions = topFunctionsOf(view, sampleIndex);
+    const report = topReport(view, totalIndex, 5);
+    const entry = await catalogProfile(stored, { target, profileType: "cpu", captureId: capture?.id });
+
+    const rows = report.functions.map((f, i) => `${i + 1}. ${f.name}: ${formatValue(f.flat, report.unit)} (${f.flatPct}%)`);
+    const textSummary = `🐧 Mixed-mode CPU profile of pid ${pid} via perf, ${seconds}s at ${frequency}Hz${filterNote(filters)}:
+
+${report.summary}
+🧵 ${inKernel}% of samples were in the kernel${filters.hideKernel ? ", charged to the Go functions that entered it" : ""}
+
+🔥 Top Functions:
+${rows.length > 0 ? rows.join("\n") : "None"}
+
+📁 Saved as ${entry.id} (${stored})
+💡 Tip: Kernel frames end in _[k]. Pass hideKernel to charge kernel time to the calling Go function, or focus on a syscall (e.g. focus '^__x64_sys_write') to see which Go code pays for it.`;
+
+    const profileData: ProfileData = {
+      name: `pid ${pid} (cpu + kernel)`,
+      duration: seconds,
+      sampleCount: flamegraphData.value,
+      topFunctions,
+      flamegraphData,
+      total,
+      profileId: entry.id,
+    };
+
+    const laidOut = withLayout(profileData, layout);
+    return {
+      content: [{ type: "text", text: withTextEquivalent(textSummary, laidOut) }],
+      structuredContent: laidOut as unknown as Record<string, unknown>,
+    };
+  } catch (error) {
+    const message = error instanceof Error ? error.message : "Unknown error";
+    return {
+      content: [{ type: "text", text: `Error profiling process with perf: ${message}` }],
+      isError: true,
+    };
   }
 }
 
-// Parse pprof -top output
-function parseTopOutput(topOutput: string, totalSamples: number): Array<{ name: string; percentage: number; samples: number }> {
-  const results: Array<{ name: string; percentage: number; samples: number }> = [];
-  const lines = topOutput.split("\n");
-  
-  for (const line of lines) {
-    // Match lines like: "  10.50s  21.00% 21.00%   10.50s 21.00%  main.bubbleSort"
-    const match = line.match(/^\s*([\d.]+\w*)\s+([\d.]+)%\s+([\d.]+)%\s+([\d.]+\w*)\s+([\d.]+)%\s+(.+)$/);
-    if (match) {
-      const funcName = match[6].trim();
-      const percentage = parseFloat(match[2]);
-      const samples = Math.round((percentage / 100) * totalSamples);
-      results.push({ name: funcName, percentage, samples });
+// Measure where a running process's goroutines or threads wait, with eBPF
+async function captureOffCpuProcessProfile(
+  pid: number,
+  seconds: number,
+  mode: OffCpuMode,
+  minMicros: number,
+  includeIdle: boolean,
+  filters: FrameFilters = {},
+  layout: FlamegraphLayout = {},
+  progress: ProgressReporter = noProgress,
+  signal?: AbortSignal,
+): Promise<CallToolResult> {
+  try {
+    checkCaptureSeconds(seconds);
+    const { profile: captured, idleNs } = await duringWindow(
+      progress,
+      "measuring off-CPU time with bpftrace",
+      seconds,
+      captureOffCpuProfile({ pid, seconds, mode, minMicros, includeIdle, signal }),
+    );
+    if (captured.samples.length === 0) {
+      throw new Error(`No ${mode === "goroutine" ? "goroutine" : "thread"} waits of at least ${minMicros}µs in pid ${pid} within ${seconds}s${idleNs > 0 ? " besides the runtime's idle ones (pass includeIdle to see them)" : ""}`);
     }
+    const target = `pid:${pid}`;
+    const stored = await storedProfilePath(`pid${pid}_offcpu`);
+    writeProfile(stored, captured);
+
+    const sampleIndex = sampleIndexOf(captured, "offcpu");
+    const total = toBaseUnit(totalOf(captured, sampleIndex), "nanoseconds");
+    const waits = totalOf(captured, sampleIndexOf(captured, "waits"));
+    const capture = await recordCapture({
+      target,
+      profileType: "offcpu",
+      duration: seconds,
+      total,
+      unit: "seconds",
+      topFunctions: topFunctionsOf(captured, sampleIndex),
+      issues: 0,
+    }).catch(() => undefined);
+
+    const view = applyFrameFilters(captured, filters);
+    const flamegraphData = buildFlameTree(view, sampleIndex);
+    const topFunctions = topFunctionsOf(view, sampleIndex);
+    const report = topReport(view, sampleIndex, 5);
+    const entry = await catalogProfile(stored, { target, profileType: "offcpu", captureId: capture?.id });
+
+    const rows = report.functions.filter((f) => f.flat > 0).map((f, i) => `${i + 1}. ${f.name}: ${formatValue(f.flat, report.unit)} (${f.flatPct}%)`);
+    const textSummary = `💤 Off-CPU profile of pid ${pid} by ${mode}, ${seconds}s, waits of at least ${minMicros}µs${filterNote(filters)}:
+
+${formatValue(totalOf(captured, sampleIndex), "nanoseconds")} blocked across ${waits} wait(s)${idleNs > 0 ? `; ${formatValue(idleNs, "nanoseconds")} of the runtime idling left out` : ""}
+${report.summary}
+
+🔥 Top Blocking Functions:
+${rows.length > 0 ? rows.join("\n") : "None"}
+
+📁 Saved as ${entry.id} (${stored})
+💡 Tip: Off-CPU time adds up across ${mode === "goroutine" ? "goroutines" : "threads"}, so it can exceed the capture window. ${mode === "goroutine" ? "The leaf frames say how each goroutine waited (e.g. sync.(*Mutex).lockSlow, runtime.chanrecv); focus on one of them to see which code pays for it." : "Kernel frames end in _[k]; pass hideKernel to charge blocked time to the user code that made the call."}`;
+
+    const profileData: ProfileData = {
+      name: `pid ${pid} (off-CPU, ${mode})`,
+      duration: seconds,
+      sampleCount: flamegraphData.value,
+      topFunctions,
+      flamegraphData,
+      total,
+      profileId: entry.id,
+    };
+
+    const laidOut = withLayout(profileData, layout);
+    return {
+      content: [{ type: "text", text: withTextEquivalent(textSummary, laidOut) }],
+      structuredContent: laidOut as unknown as Record<string, unknown>,
+    };
+  } catch (error) {
+    const message = error instanceof Error ? error.message : "Unknown error";
+    return {
+      content: [{ type: "text", text: `Error profiling off-CPU time: ${message}` }],
+      isError: true,
+    };
   }
-  
-  return results.slice(0, 10);
 }
 
 // Generate demo profile data for visualization
 function generateDemoProfile(
   appPath: string,
   duration: number,
-  profileType: "cpu" | "heap"
+  profileType: ProfileType
 ): ProfileData {
   const appName = path.basename(appPath, ".go");
 
@@ -425,11 +935,34 @@ function generateDemoProfile(
   };
 }
 
-export function createServer(): McpServer {
-  const server = new McpServer({
-    name: "Flamegraph Profiler MCP App Server",
-    version: "1.0.0",
-  });
+// A server offering the tools that need one of the given capabilities; all
+// of them by default, as for stdio and unauthenticated HTTP clients
+export function createServer(capabilities: readonly Capability[] = CAPABILITIES): McpServer {
+  const server = new McpServer(
+    {
+      name: "Flamegraph Profiler MCP App Server",
+      version: "1.0.0",
+    },
+    // Logging carries watch_target's per-change summaries
+    { capabilities: { logging: {} } },
+  );
+
+  // Leave out the tools the client may not use, wherever they are registered
+  if (capabilities.length < CAPABILITIES.length) {
+    const registerTool = server.registerTool.bind(server);
+    server.registerTool = ((name: string, ...rest: unknown[]) => {
+      const tool = (registerTool as (...args: unknown[]) => RegisteredTool)(name, ...rest);
+      if (!capabilities.includes(requiredCapability(name))) {
+        tool.remove();
+      }
+      return tool;
+    }) as typeof server.registerTool;
+  }
+
+  // Tools that capture first wait for a slot under the configured capture limits
+  const registerLimited = server.registerTool.bind(server);
+  server.registerTool = ((name: string, config: unknown, handler: Parameters<typeof withCaptureLimits>[1]) =>
+    (registerLimited as (...args: unknown[]) => RegisteredTool)(name, config, withCaptureLimits(name, handler))) as typeof server.registerTool;
 
   const resourceUri = "ui://profile-app/mcp-app.html";
 
@@ -442,27 +975,90 @@ export function createServer(): McpServer {
       inputSchema: z.object({
         appPath: z.string().describe("Path to the Go source file to profile (e.g., './sample-app/main.go')"),
         duration: z.number().optional().default(5).describe("Profiling duration in seconds (default: 5)"),
-        profileType: z.enum(["cpu", "heap"]).optional().default("cpu").describe("Type of profile: 'cpu' for CPU profiling, 'heap' for memory profiling"),
+        profileType: z.enum(["cpu", "heap", "block", "mutex"]).optional().default("cpu").describe("Type of profile: 'cpu' for CPU profiling, 'heap' for memory profiling, 'block' for time spent blocked on channels and locks, 'mutex' for lock contention"),
+        costModel: z.object({
+          centsPerVcpuHour: z.number().describe("Price of one vCPU-hour in cents"),
+          centsPerGbHour: z.number().optional().describe("Price of one GB-hour of memory in cents (needed for heap profiles)"),
+          replicas: z.number().optional().default(1).describe("Number of replicas running this workload"),
+        }).optional().describe("Optional pricing used to estimate the monthly dollar cost of the workload and its top functions"),
+        energyModel: z.object({
+          region: z.string().optional().describe("Deployment region used to look up grid carbon intensity (e.g., 'eu-west-1'); unknown regions are rejected"),
+          gramsCo2ePerKwh: z.number().optional().describe("Grid carbon intensity in gCO2e/kWh, overriding the region lookup"),
+          wattsPerVcpu: z.number().optional().describe("Power draw of one busy vCPU in watts (default: 2.1)"),
+          pue: z.number().optional().describe("Data centre power usage effectiveness (default: 1.135)"),
+          replicas: z.number().optional().default(1).describe("Number of replicas running this workload"),
+        }).optional().describe("Optional energy model used to estimate watt-hours and CO2e for CPU profiles"),
+        lang: z.enum(LANGS).optional().default("en").describe("Language of the findings listed in the report text (default: en); the rest of the report and the structured fields stay in English"),
+        ...frameFilterFields,
+        ...colorSchemeField,
+        ...layoutFields,
       }),
       _meta: { ui: { resourceUri } },
     },
-    async ({ appPath, duration = 5, profileType = "cpu" }): Promise<CallToolResult> => {
+    async ({ appPath, duration = 5, profileType = "cpu", costModel, energyModel, lang = "en", colorScheme, orientation, inverted, accessibility, ...filters }, extra): Promise<CallToolResult> => {
       try {
-        const profileData = await profileGoApp(appPath, duration, profileType);
+        checkCaptureSeconds(duration);
+        if (energyModel) {
+          checkEnergyModel(energyModel);
+        }
+        const layout = { color: colorScheme, orientation, inverted, accessibility };
+        const profileData = await profileGoApp(appPath, duration, profileType, filters, progressReporter(extra), extra.signal);
+
+        // Demo data has no total, and estimates from it would be made up.
+        // Filtered views are left out too, as their shares are of the
+        // filtered total while the total is the whole capture's.
+        const total = hasFrameFilters(filters) ? undefined : profileData.total;
+        if (costModel && total !== undefined && (profileType === "cpu" || profileType === "heap")) {
+          const estimate = estimateCost(
+            {
+              profileType,
+              duration: profileData.duration,
+              total,
+              topFunctions: profileData.topFunctions,
+            },
+            { replicas: 1, ...costModel },
+          );
+          if (estimate) {
+            profileData.costEstimate = estimate;
+          }
+        }
+
+        // Filters shift every share, so filtered views do not record findings
+        profileData.findings = hasFrameFilters(filters) ? [] : await recordFindings(
+          (profileData.antiPatterns ?? []).map((p) => findingFromAntiPattern(p, path.resolve(appPath))),
+        );
 
-        const textSummary = `Profile Results for ${profileData.name}:
+        if (energyModel && total !== undefined && profileType === "cpu") {
+          const estimate = estimateEnergy(
+            {
+              duration: profileData.duration,
+              cpuSeconds: total,
+              topFunctions: profileData.topFunctions,
+            },
+            { replicas: 1, ...energyModel },
+          );
+          if (estimate) {
+            profileData.energyEstimate = estimate;
+          }
+        }
+
+        const textSummary = `Profile Results for ${profileData.name}${filterNote(filters)}:
 ⏱️ Duration: ${profileData.duration.toFixed(2)}s
 📊 Samples: ${profileData.sampleCount}
 🔧 Profile Type: ${profileType.toUpperCase()}
 
-🔥 Top Functions by CPU Time:
-${profileData.topFunctions.slice(0, 5).map((f, i) => `${i + 1}. ${f.name}: ${f.percentage}% (${f.samples} samples)`).join("\n")}
+🔥 Top Functions by ${PROFILE_MEASURES[profileType]}:
+${profileData.topFunctions.slice(0, 5).map((f, i) => `${i + 1}. ${f.name}: ${f.percentage}% (${f.samples} samples)${f.owners?.length ? ` [${f.owners.join(" ")}]` : ""}`).join("\n")}
 
-💡 Tip: Look for functions with high percentages - these are optimization targets.`;
+${profileData.ownership ? `${formatOwnerTotals(profileData.ownership)}\n\n` : ""}${profileData.contention ? `${formatContention(profileData.contention.report)}\n\n` : ""}${profileData.findings && profileData.findings.length > 0 ? `${t(lang, "report.findings")}\n${profileData.findings.map((f) => formatFinding(f, lang)).join("\n")}\n\n` : ""}${profileData.suppressed ? `🔕 ${profileData.suppressed} anti-pattern(s) hidden by suppressions (see list_suppressions)\n\n` : ""}${profileData.costEstimate ? `${formatCostEstimate(profileData.costEstimate)}\n\n` : ""}${profileData.energyEstimate ? `${formatEnergyEstimate(profileData.energyEstimate)}\n\n` : ""}${profileData.profileId ? `📁 Saved as ${profileData.profileId}\n🖼️ Flamegraph: ${flamegraphUri(profileData.profileId, { ...filters, ...layout })}\n` : ""}💡 Tip: Look for functions with high percentages - these are optimization targets.`;
 
+        const laidOut = withLayout(profileData, layout);
         return {
-          content: [{ type: "text", text: textSummary }],
-          structuredContent: profileData as unknown as Record<string, unknown>,
+          content: [
+            { type: "text", text: withTextEquivalent(textSummary, laidOut) },
+            ...(profileData.profileId ? [flamegraphLink(profileData.profileId, { ...filters, ...layout })] : []),
+          ],
+          structuredContent: laidOut as unknown as Record<string, unknown>,
         };
       } catch (error) {
         const message = error instanceof Error ? error.message : "Unknown error";
@@ -474,6 +1070,472 @@ ${profileData.topFunctions.slice(0, 5).map((f, i) => `${i + 1}. ${f.name}: ${f.p
     },
   );
 
+  registerAppTool(
+    server,
+    "diff_flamegraph",
+    {
+      title: "Differential Flamegraph",
+      description: "Compare a baseline and a comparison pprof file. Renders a red/blue differential flamegraph (red = grew, blue = shrank) and lists the functions with the largest regressions and improvements. Without a baseline path, the baseline saved in the project's Git repository at the nearest ancestor of the commit the comparison was captured at (its git.sha tag, else HEAD) is used (see save_baseline).",
+      inputSchema: z.object({
+        baselinePath: z.string().optional().describe("Path or catalog ID of the baseline profile (the 'before' profile). Omit to use the repository baseline for the current commit"),
+        comparisonPath: z.string().describe("Path or catalog ID of the comparison profile (the 'after' profile)"),
+        repoPath: z.string().optional().describe("Git repository holding baselines when baselinePath is omitted (default: the repository of the comparison profile's source files)"),
+        baselineName: z.string().optional().describe("Repository baseline to use when baselinePath is omitted (default: the comparison profile's kind, e.g. 'cpu' or 'heap')"),
+        commit: z.string().optional().describe("Commit the comparison was captured at, used to pick the baseline when baselinePath is omitted (default: the profile's git.sha tag, else HEAD)"),
+        sampleType: z.string().optional().describe("Sample type to compare, e.g. 'cpu', 'samples', 'inuse_space', 'alloc_space' (default: the profile's default type)"),
+        limit: z.number().optional().default(10).describe("Number of regressions and improvements to return (default: 10)"),
+        normalize: z.enum(NORMALIZATIONS).optional().default("share").describe("How to compare: 'share' of each profile's total (default), or rates per 'second' of capture or per 'request' served, which also show growth spread evenly across functions and compare captures of different lengths or under different load"),
+        baselineRequests: z.number().int().min(1).optional().describe("Requests the baseline covers, for normalize 'request' (default: its 'requests' catalog label)"),
+        comparisonRequests: z.number().int().min(1).optional().describe("Requests the comparison covers, for normalize 'request' (default: its 'requests' catalog label)"),
+        lang: z.enum(LANGS).optional().default("en").describe("Language of the findings listed in the report text (default: en); the rest of the report and the structured fields stay in English"),
+        ...frameFilterFields,
+        ...diffColorSchemeField,
+        ...layoutFields,
+      }),
+      _meta: { ui: { resourceUri } },
+    },
+    async ({ baselinePath, comparisonPath, repoPath, baselineName, commit, sampleType, limit = 10, normalize = "share", baselineRequests, comparisonRequests, lang = "en", colorScheme, orientation, inverted, accessibility, ...filters }): Promise<CallToolResult> => {
+      try {
+        const comparisonFile = await resolveProfilePath(comparisonPath);
+        const captured = readProfile(comparisonFile);
+        const comparison = applyFrameFilters(captured, filters);
+        let selected: SelectedBaseline | undefined;
+        const capturedAt = commit ?? profileCommit(captured);
+        if (!baselinePath) {
+          const repo = repoPath ?? (await repoOfProfile(captured));
+          if (!repo) {
+            throw new Error("No baselinePath given and the comparison profile's sources are not in a Git repository; pass repoPath");
+          }
+          const name = baselineName ?? baselineKind(captured);
+          selected = await selectBaseline(repo, name, capturedAt);
+          if (!selected) {
+            throw new Error(`No '${name}' baseline found for ${capturedAt ?? "HEAD"} or its ancestors in ${repo}; save one with save_baseline`);
+          }
+          baselinePath = selected.path;
+        }
+        const baselineFile = await resolveProfilePath(baselinePath);
+        const baseline = applyFrameFilters(readProfile(baselineFile), filters);
+        const rates = normalize === "share" ? undefined : await rateBasis(
+          normalize,
+          comparison.sampleTypes[sampleIndexOf(comparison, sampleType)].type,
+          { ref: baselinePath, profile: baseline, requests: baselineRequests },
+          { ref: comparisonPath, profile: comparison, requests: comparisonRequests },
+        );
+        const diff = diffProfiles(baseline, comparison, sampleType, limit, rates);
+        const suppressions = await listSuppressions();
+        const fileOfEither = (name: string) => fileOf(comparison, name) ?? fileOf(baseline, name);
+        const regressions = applySuppressions(diff.regressions, suppressions, (d) => d.name, fileOfEither);
+        const improvements = applySuppressions(diff.improvements, suppressions, (d) => d.name, fileOfEither);
+        diff.regressions = regressions.kept;
+        diff.improvements = improvements.kept;
+        const suppressed = regressions.suppressed + improvements.suppressed;
+        const ownership = await ownershipForProfile(captured);
+        const findings = await recordFindings(
+          diff.regressions
+            .filter((d) => !hasFrameFilters(filters) && d.flatDeltaPct >= REGRESSION_THRESHOLD_PTS)
+            .map((d) => ({
+              ...findingFromRegression(
+                d,
+                dominantCallPath(comparison, sampleIndexOf(comparison, diff.sampleType), d.name),
+                `${baselineFile} → ${comparisonFile}`,
+              ),
+              owners: ownership && ownersOf(ownership, d.name, fileOfEither(d.name)),
+            })),
+        );
+
+        const signed = (value: number, text: string) => `${value > 0 ? "+" : ""}${text}`;
+        const rate = (value: number) => formatRate(value, diff.unit, rates!.per);
+        const formatDelta = (d: DiffResult["regressions"][number], i: number) => rates
+          ? `${i + 1}. ${d.name}: ${rate(d.baselineFlatRate!)} → ${rate(d.comparisonFlatRate!)} (${signed(d.flatRateDelta!, rate(d.flatRateDelta!))} flat, ${signed(d.cumRateDelta!, rate(d.cumRateDelta!))} cum; share ${d.baselineFlatPct}% → ${d.comparisonFlatPct}%)`
+          : `${i + 1}. ${d.name}: ${d.baselineFlatPct}% → ${d.comparisonFlatPct}% (${d.flatDeltaPct > 0 ? "+" : ""}${d.flatDeltaPct} pts flat, ${d.cumDeltaPct > 0 ? "+" : ""}${d.cumDeltaPct} pts cum)`;
+        const covered = (value: number) => (rates!.per === "second" ? `${Math.round(value * 10) / 10}s` : `${value} requests`);
+
+        const baselineLabel = selected ? `${selected.name}@${selected.commit.slice(0, 12)}` : path.basename(baselinePath);
+        const textSummary = `Differential Profile: ${baselineLabel} → ${path.basename(comparisonPath)}${filterNote(filters)}
+🔧 Sample Type: ${diff.sampleType} (${diff.unit})${selected ? `\n📌 Baseline: ${selected.path} (${describeSelection(selected, capturedAt?.slice(0, 12) ?? "HEAD")})` : ""}${diff.rates ? `\n⚖️ Per ${diff.rates.per}: ${rate(diff.rates.baselineRate)} (${covered(diff.rates.baseline)}) → ${rate(diff.rates.comparisonRate)} (${covered(diff.rates.comparison)}), ${signed(diff.rates.changePct, `${diff.rates.changePct}%`)}` : ""}
+
+📈 Largest Regressions:
+${diff.regressions.length > 0 ? diff.regressions.map(formatDelta).join("\n") : "None"}
+
+📉 Largest Improvements:
+${diff.improvements.length > 0 ? diff.improvements.map(formatDelta).join("\n") : "None"}
+${findings.length > 0 ? `\n${t(lang, "report.recordedFindings")}\n${findings.map((f) => formatFinding(f, lang)).join("\n")}\n` : ""}${suppressed > 0 ? `\n🔕 ${suppressed} function(s) hidden by suppressions (see list_suppressions)\n` : ""}
+💡 Tip: ${rates
+          ? `Functions are ranked by how much their ${diff.sampleType} per ${rates.per} changed, so growth spread over every function shows too.`
+          : "Percentages are shares of each profile's total, so captures of different lengths compare fairly; normalize per 'second' or 'request' to see growth spread over every function."}`;
+
+        const { flamegraph, ...summary } = diff;
+        const profileData: ProfileData = {
+          name: `${baselineLabel} → ${path.basename(comparisonPath)}`,
+          duration: comparison.durationSeconds ?? 0,
+          sampleCount: flamegraph.value,
+          topFunctions: diff.regressions.map((d) => ({
+            name: d.name,
+            percentage: d.comparisonFlatPct,
+            samples: 0,
+          })),
+          flamegraphData: flamegraph,
+          diff: summary,
+          findings,
+          suppressed,
+        };
+
+        const laidOut = withLayout(profileData, { color: colorScheme, orientation, inverted, accessibility }, true);
+        return {
+          content: [{ type: "text", text: withTextEquivalent(textSummary, laidOut) }],
+          structuredContent: versioned("diff", laidOut) as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error comparing profiles: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  registerAppTool(
+    server,
+    "analyze_heap",
+    {
+      title: "Analyze Heap Profile",
+      description: "Analyze a Go heap profile by inuse_space, inuse_objects, alloc_space, or alloc_objects. Renders a flamegraph for the chosen mode and reports the biggest allocation sites (function and line) for every mode, with average object sizes.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the heap pprof file (e.g., written by the sample app's -memprofile flag) or its catalog ID"),
+        mode: z.enum(HEAP_MODES).optional().default("inuse_space").describe("Sample type for the flamegraph: what is live now (inuse_*) or everything allocated since start (alloc_*), by bytes (*_space) or count (*_objects)"),
+        limit: z.number().optional().default(5).describe("Number of allocation sites to report per mode (default: 5)"),
+        ...frameFilterFields,
+        ...colorSchemeField,
+        ...layoutFields,
+      }),
+      _meta: { ui: { resourceUri } },
+    },
+    async ({ profilePath, mode = "inuse_space", limit = 5, colorScheme, orientation, inverted, accessibility, ...filters }): Promise<CallToolResult> => {
+      try {
+        const profile = applyFrameFilters(readProfile(await resolveProfilePath(profilePath)), filters);
+        if (!isHeapProfile(profile)) {
+          const types = profile.sampleTypes.map((t) => t.type).join(", ");
+          throw new Error(`Not a heap profile (sample types: ${types})`);
+        }
+
+        // Put the selected mode first, then the others
+        const modes = [mode, ...HEAP_MODES.filter((m) => m !== mode)];
+        const reports = modes.map((m) => heapSites(profile, m, limit));
+        const sampleIndex = sampleIndexOf(profile, mode);
+
+        const formatReport = (report: HeapModeReport) => `📦 ${report.mode} (total ${formatValue(report.total, report.unit)}):
+${report.sites.length > 0
+  ? report.sites.map((site, i) => `${i + 1}. ${site.function} (${path.basename(site.file)}:${site.line}): ${formatValue(site.value, report.unit)} (${site.percentage}%)${site.avgObjectSize !== undefined ? `, ~${formatValue(site.avgObjectSize, "bytes")}/object` : ""}`).join("\n")
+  : "No allocations recorded"}`;
+
+        const textSummary = `Heap Analysis for ${path.basename(profilePath)}${filterNote(filters)}:
+
+${reports.map(formatReport).join("\n\n")}
+
+💡 Tip: inuse_* shows what is retained at capture time (leaks, caches); alloc_* shows churn since start (GC pressure). Large avg object sizes point to big buffers, small ones to many tiny allocations.`;
+
+        const flamegraphData = buildFlameTree(profile, sampleIndex);
+        const profileData: ProfileData = {
+          name: `${path.basename(profilePath)} (${mode})`,
+          duration: profile.durationSeconds ?? 0,
+          sampleCount: flamegraphData.value,
+          topFunctions: topFunctionsOf(profile, sampleIndex),
+          flamegraphData,
+          heap: { mode, reports },
+        };
+
+        const laidOut = withLayout(profileData, { color: colorScheme, orientation, inverted, accessibility });
+        return {
+          content: [{ type: "text", text: withTextEquivalent(textSummary, laidOut) }],
+          structuredContent: laidOut as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error analyzing heap profile: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  registerAppTool(
+    server,
+    "heap_delta",
+    {
+      title: "Heap Delta",
+      description: "Compare two heap snapshots of one Go process, given as profiles or captured from a live target serving net/http/pprof (snapshot A, a wait, snapshot B, each after a GC). Reports the allocation sites whose in-use bytes and objects grew and shrank most, what each allocated in between, and the sites that churn: allocate a lot but keep little, which no single heap profile shows. Renders a differential flamegraph of the in-use change (red = grew, blue = shrank).",
+      inputSchema: z.object({
+        baselinePath: z.string().optional().describe("Path or catalog ID of the earlier heap profile (snapshot A)"),
+        comparisonPath: z.string().optional().describe("Path or catalog ID of the later heap profile (snapshot B)"),
+        target: z.string().optional().describe("Address of a pprof server to capture both snapshots from instead (e.g., 'localhost:6060')"),
+        interval: z.number().min(1).max(600).optional().default(30).describe("Seconds between the two snapshots when capturing (default: 30)"),
+        mode: z.enum(HEAP_DELTA_MODES).optional().default("inuse_space").describe("What the flamegraph and ranking measure: in-use bytes (inuse_space) or objects (inuse_objects)"),
+        limit: z.number().int().min(1).max(100).optional().default(10).describe("Number of sites to report per list (default: 10)"),
+        ...frameFilterFields,
+        ...diffColorSchemeField,
+        ...layoutFields,
+      }),
+      _meta: { ui: { resourceUri } },
+    },
+    async ({ baselinePath, comparisonPath, target, interval = 30, mode = "inuse_space", limit = 10, colorScheme, orientation, inverted, accessibility, ...filters }, extra): Promise<CallToolResult> => {
+      let snapshots: HeapSnapshot[] = [];
+      try {
+        if (target ? baselinePath || comparisonPath : !baselinePath || !comparisonPath) {
+          throw new Error("Pass either baselinePath and comparisonPath, or a target to capture both snapshots from");
+        }
+        let names: [string, string];
+        if (target) {
+          checkTarget(target);
+          checkCaptureSeconds(interval);
+          snapshots = await captureHeapSeries(target, 2, interval, progressReporter(extra), extra.signal);
+          const name = target.replace(/^https?:\/\//, "").replace(/[^\w.-]+/g, "_");
+          const [a, b] = await Promise.all(snapshots.map((snapshot, i) =>
+            keepProfile(snapshot.file, `${name}_heap_${i === 0 ? "a" : "b"}`, { target, profileType: "heap", labels: { series: "heap_delta" } })));
+          [baselinePath, comparisonPath] = [a.id, b.id];
+          names = [a.id, b.id];
+        } else {
+          names = [path.basename(baselinePath!), path.basename(comparisonPath!)];
+        }
+        const baseline = applyFrameFilters(readProfile(await resolveProfilePath(baselinePath!)), filters);
+        const comparison = applyFrameFilters(readProfile(await resolveProfilePath(comparisonPath!)), filters);
+        const report = heapDelta(baseline, comparison, mode, limit);
+
+        const bytes = (value: number) => formatValue(value, "bytes");
+        const signedBytes = (value: number) => `${value >= 0 ? "+" : "-"}${bytes(Math.abs(value))}`;
+        const signed = (value: number) => `${value >= 0 ? "+" : ""}${value}`;
+        const where = (site: HeapSiteDelta) => `${site.function} (${path.basename(site.file)}:${site.line})`;
+        const allocated = (site: HeapSiteDelta) => (site.allocatedBytes !== undefined ? `, ${bytes(site.allocatedBytes)} allocated in between` : "");
+        const formatSite = (site: HeapSiteDelta, i: number) => [
+          `${i + 1}. ${where(site)}: ${bytes(site.baselineBytes)} → ${bytes(site.comparisonBytes)} (${signedBytes(site.bytesDelta)}, ${signed(site.objectsDelta)} objects)${allocated(site)}`,
+          ...(site.stack.length > 1 ? [`   ↳ ${site.stack.join(" ← ")}`] : []),
+        ].join("\n");
+        const list = (title: string, sites: HeapSiteDelta[], count: number) =>
+          `${title}${count > sites.length ? ` (top ${sites.length} of ${count})` : ""}:\n${sites.length > 0 ? sites.map(formatSite).join("\n") : "None"}`;
+        const { baseline: before, comparison: after } = report;
+        const span = snapshots.length === 2 ? ` over ${Math.round((snapshots[1].at - snapshots[0].at) / 1000)}s` : "";
+        const textSummary = `🧮 Heap Delta: ${names[0]} → ${names[1]}${span}${filterNote(filters)}
+
+📈 In-use heap: ${bytes(before.inuseBytes)} → ${bytes(after.inuseBytes)} (${signedBytes(report.bytesDelta)}), ${before.inuseObjects} → ${after.inuseObjects} objects (${signed(report.objectsDelta)})
+${report.allocatedBytes !== undefined
+  ? `♻️ Allocated in between: ${bytes(report.allocatedBytes)} in ${report.allocatedObjects} objects`
+  : "♻️ Allocated in between: unknown; the later snapshot counts fewer allocations, so the two are not from one run of the process"}
+
+${list("⬆️ Grew most", report.grew, report.grewCount)}
+
+${list("⬇️ Shrank most", report.shrank, report.shrankCount)}
+${report.churn.length > 0 ? `
+🌀 Churn, allocating much but keeping little:
+${report.churn.map((site, i) => `${i + 1}. ${where(site)}: ${bytes(site.allocatedBytes!)} in ${site.allocatedObjects} objects allocated, in-use ${signedBytes(site.bytesDelta)}`).join("\n")}
+` : ""}
+💡 Tip: ${target
+          ? `Both snapshots are saved as ${baselinePath} and ${comparisonPath}; detect_leak takes more snapshots to tell steady growth from noise.`
+          : "Snapshots taken after a GC (debug/pprof/heap?gc=1, as target captures are) compare what is still reachable; otherwise in-use bytes include garbage the last cycle left."}`;
+
+        const toSite = (site: HeapSiteDelta) => {
+          const value = mode === "inuse_space" ? site.bytesDelta : site.objectsDelta;
+          return { function: site.function, file: site.file, line: site.line, value, percentage: percentOf(value, mode === "inuse_space" ? after.inuseBytes : after.inuseObjects) };
+        };
+        const profileData: ProfileData = {
+          name: `${names[0]} → ${names[1]} (${mode})`,
+          duration: snapshots.length === 2 ? (snapshots[1].at - snapshots[0].at) / 1000 : 0,
+          sampleCount: report.flamegraph.value,
+          topFunctions: report.grew.map((site) => ({ name: site.function, percentage: toSite(site).percentage, samples: 0 })),
+          flamegraphData: report.flamegraph,
+          heap: {
+            mode,
+            reports: [{ mode, unit: mode === "inuse_space" ? "bytes" : "count", total: mode === "inuse_space" ? report.bytesDelta : report.objectsDelta, sites: report.grew.map(toSite) }],
+          },
+        };
+        const laidOut = withLayout(profileData, { color: colorScheme, orientation, inverted, accessibility }, true);
+        const { flamegraph, ...summary } = report;
+        return {
+          content: [{ type: "text", text: withTextEquivalent(textSummary, laidOut) }],
+          structuredContent: { ...laidOut, heapDelta: summary, baselinePath, comparisonPath } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error comparing heap snapshots: ${message}` }],
+          isError: true,
+        };
+      } finally {
+        await Promise.all(snapshots.map((s) => fs.unlink(s.file).catch(() => undefined)));
+      }
+    },
+  );
+
+  for (const kind of CONTENTION_KINDS) {
+    const { title, measures, rateDescription } = CONTENTION_TEXT[kind];
+    registerAppTool(
+      server,
+      `capture_${kind}_profile`,
+      {
+        title: `Capture ${title} Profile`,
+        description: `Capture a ${kind} profile from a live Go process serving net/http/pprof, showing ${measures}. Optionally turns ${kind} profiling on for the capture window. Renders a flamegraph weighted by delay and lists the sites with the most delay.`,
+        inputSchema: z.object({
+          target: z.string().describe("Address of the pprof server (e.g., 'localhost:6060' or 'http://host:6060')"),
+          seconds: z.number().min(1).max(300).optional().default(10).describe("Capture window in seconds (default: 10)"),
+          rate: z.number().int().min(1).optional().describe(`${rateDescription} to enable for the capture via the target's /debug/profile-rates endpoint (1 records every event). Omit if the target already enables ${kind} profiling`),
+          limit: z.number().optional().default(10).describe("Number of contention sites to report (default: 10)"),
+          ...frameFilterFields,
+          ...colorSchemeField,
+          ...layoutFields,
+        }),
+        _meta: { ui: { resourceUri } },
+      },
+      async ({ target, seconds = 10, rate, limit = 10, colorScheme, orientation, inverted, accessibility, ...filters }, extra): Promise<CallToolResult> =>
+        captureContentionProfile(kind, target, seconds, rate, limit, filters, { color: colorScheme, orientation, inverted, accessibility }, progressReporter(extra), extra.signal),
+    );
+  }
+
+  registerAppTool(
+    server,
+    "profile_docker_container",
+    {
+      title: "Profile Docker Container",
+      description: "Profile a Go process running in a Docker container and render its flamegraph. Uses the container's published pprof port when there is one, otherwise fetches the profile from inside the container with docker exec (needs sh and curl or wget in the image). For services that mostly wait on I/O, profileType 'wallclock' samples every goroutine's stack whether it runs or not, fgprof-style, so waits show up next to CPU time. The profile is saved, tagged with the container, image and the image's org.opencontainers.image.revision commit.",
+      inputSchema: z.object({
+        container: z.string().describe("Container name or ID"),
+        port: z.number().int().min(1).max(65535).optional().default(6060).describe("Container port serving /debug/pprof (default: 6060)"),
+        profileType: z.enum(DOCKER_PROFILE_TYPES).optional().default("cpu").describe("Profile to capture: cpu, wallclock (time of every goroutine, running or waiting, from a /debug/fgprof handler), heap, goroutine, or block/mutex (the process must enable them)"),
+        seconds: z.number().min(1).max(300).optional().default(10).describe("Capture window for cpu, wallclock, block and mutex profiles (default: 10)"),
+        mode: z.enum(["auto", "port", "exec"]).optional().default("auto").describe("'port' uses the published port, 'exec' fetches from inside the container, 'auto' prefers the published port (default)"),
+        ...frameFilterFields,
+        ...colorSchemeField,
+        ...layoutFields,
+      }),
+      _meta: { ui: { resourceUri } },
+    },
+    async ({ container, port = 6060, profileType = "cpu", seconds = 10, mode = "auto", colorScheme, orientation, inverted, accessibility, ...filters }, extra): Promise<CallToolResult> =>
+      captureDockerProfile(container, port, profileType, seconds, mode, filters, { color: colorScheme, orientation, inverted, accessibility }, progressReporter(extra), extra.signal),
+  );
+
+  registerAppTool(
+    server,
+    "profile_process_perf",
+    {
+      title: "Profile Process with Kernel Stacks",
+      description: "Linux only, needs perf on PATH and root, CAP_PERFMON or kernel.perf_event_paranoid <= 1 (kernel symbol names also need kernel.kptr_restrict = 0). Sample a running Go process's CPU with perf and render a mixed-mode flamegraph: kernel stacks (frames ending in _[k]) beneath the Go stacks that entered the kernel, perf-style, so time in syscalls, page faults and the scheduler is attributed end to end. Go's own CPU profiles stop at the syscall. hideKernel folds kernel time into the calling Go frame. The profile is saved to the catalog.",
+      inputSchema: z.object({
+        pid: z.number().int().min(1).describe("Process ID of the running Go program"),
+        seconds: z.number().int().min(1).max(300).optional().default(10).describe("Seconds to sample (default: 10)"),
+        frequency: z.number().int().min(1).max(10000).optional().default(99).describe("Samples per second (default: 99, off the timer tick to avoid lockstep)"),
+        ...frameFilterFields,
+        ...colorSchemeField,
+        ...layoutFields,
+      }),
+      _meta: { ui: { resourceUri } },
+    },
+    async ({ pid, seconds = 10, frequency = 99, colorScheme, orientation, inverted, accessibility, ...filters }, extra): Promise<CallToolResult> =>
+      capturePerfProcessProfile(pid, seconds, frequency, filters, { color: colorScheme, orientation, inverted, accessibility }, progressReporter(extra), extra.signal),
+  );
+
+  registerAppTool(
+    server,
+    "profile_process_offcpu",
+    {
+      title: "Off-CPU Profile",
+      description: "Linux only, needs bpftrace on PATH and root or CAP_BPF and CAP_PERFMON. Measure where a running process waits instead of running, and render it as a flamegraph weighted by blocked time: the time CPU profiles cannot see. Mode 'goroutine' (amd64 Go binaries) charges each goroutine's waits on channels, mutexes, WaitGroups, sleeps and the network to the stack it parked in, through uprobes on the Go scheduler; mode 'thread' charges each thread's time switched out (blocking syscalls, page faults, futexes) to its kernel and user stacks, for programs in any language. The profile is saved to the catalog with 'offcpu' and 'waits' sample types.",
+      inputSchema: z.object({
+        pid: z.number().int().min(1).describe("Process ID of the running program"),
+        seconds: z.number().int().min(1).max(300).optional().default(10).describe("Seconds to measure (default: 10)"),
+        mode: z.enum(OFFCPU_MODES).optional().default("goroutine").describe("'goroutine' for a Go program's goroutine waits (default), 'thread' for OS threads switched out by the kernel"),
+        minMicros: z.number().min(0).optional().default(10).describe("Leave out waits shorter than this many microseconds, which keeps the probes cheap on busy processes (default: 10)"),
+        includeIdle: z.boolean().optional().default(false).describe("Keep the waits of the Go runtime's idle GC workers, sysmon and scheduler threads with nothing to run (default: false)"),
+        ...frameFilterFields,
+        ...colorSchemeField,
+        ...layoutFields,
+      }),
+      _meta: { ui: { resourceUri } },
+    },
+    async ({ pid, seconds = 10, mode = "goroutine", minMicros = 10, includeIdle = false, colorScheme, orientation, inverted, accessibility, ...filters }, extra): Promise<CallToolResult> =>
+      captureOffCpuProcessProfile(pid, seconds, mode, minMicros, includeIdle, filters, { color: colorScheme, orientation, inverted, accessibility }, progressReporter(extra), extra.signal),
+  );
+
+  server.registerTool(
+    "top_functions",
+    {
+      title: "Top Functions",
+      description: "Equivalent of `pprof -top` for a pprof file: returns flat/cum values and percentages for the top N functions as structured JSON, plus a short natural-language summary of where the time or memory goes.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file to analyze, or its catalog ID (see list_profiles)"),
+        limit: z.number().optional().default(10).describe("Number of functions to return (default: 10)"),
+        sampleType: z.string().optional().describe("Sample type to rank by, e.g. 'cpu', 'inuse_space', 'alloc_objects' (default: the profile's default type)"),
+        ...frameFilterFields,
+      }),
+    },
+    async ({ profilePath, limit = 10, sampleType, ...filters }): Promise<CallToolResult> => {
+      try {
+        const profile = applyFrameFilters(readProfile(await resolveProfilePath(profilePath)), filters);
+        const report = topReport(profile, sampleIndexOf(profile, sampleType), limit);
+
+        const rows = report.functions.map((f) =>
+          `${formatValue(f.flat, report.unit).padStart(10)} ${`${f.flatPct}%`.padStart(7)} ${`${f.sumPct}%`.padStart(7)} ${formatValue(f.cum, report.unit).padStart(10)} ${`${f.cumPct}%`.padStart(7)}  ${f.name}`,
+        );
+        const text = `${filterLine(filters)}${report.summary}
+
+      flat   flat%    sum%        cum    cum%
+${rows.join("\n")}`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: versioned("hotspots", report) as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error reading profile: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  registerFindingTools(server);
+  registerGoroutineTools(server);
+  registerLeakTools(server);
+  registerSuppressionTools(server);
+  registerOwnerTools(server);
+  registerTraceTools(server);
+  registerGcTools(server);
+  registerDigestTools(server);
+  registerSourceTools(server);
+  registerBaselineTools(server);
+  registerBadgeTools(server);
+  registerPrCommentTools(server);
+  registerK8sTools(server);
+  registerContinuousTools(server);
+  registerDiscoverTools(server);
+  registerBudgetTools(server);
+  registerCatalogTools(server);
+  registerSessionTools(server);
+  registerBundleTools(server);
+  registerPprofWebTools(server);
+  registerConfigTools(server);
+  registerRegressionTools(server);
+  registerWatchTools(server);
+  registerTestTools(server);
+  registerTriggerTools(server);
+  registerSampleAppTools(server);
+  registerBuildTools(server);
+  registerSupervisorTools(server);
+  registerCoreTools(server);
+  registerTracepointTools(server);
+  registerUprobeTools(server);
+  registerCallGraphTools(server);
+  registerAllocTools(server);
+  registerSloTools(server);
+  registerRouteCostTools(server);
+  registerCapacityTools(server);
+  registerHistogramTools(server);
+  registerPyroscopeTools(server);
+  registerOtlpTools(server);
+  registerWorkflowPrompts(server);
+  registerFlamegraphResources(server);
+  registerBadgeResources(server);
+
   registerAppResource(
     server,
     resourceUri,
@@ -6,7 +6,7 @@ import { useApp, useHostStyles } from "@modelcontextprotocol/ext-apps/react";
 import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
 import { StrictMode, useEffect, useState } from "react";
 import { createRoot } from "react-dom/client";
-import { Flamegraph } from "./components/Flamegraph";
+import { Flamegraph, type ColorScheme, type Orientation } from "./components/Flamegraph";
 import { TopFunctions } from "./components/TopFunctions";
 import { ProfileSummary } from "./components/ProfileSummary";
 
@@ -14,9 +14,65 @@ import { ProfileSummary } from "./components/ProfileSummary";
 interface ProfileFrame {
   name: string;
   value: number;
+  delta?: number;
   children?: ProfileFrame[];
 }
 
+interface CostEstimate {
+  resource: "cpu" | "memory";
+  replicas: number;
+  usagePerReplica: number;
+  monthlyTotalDollars: number;
+  functions: Array<{ name: string; percentage: number; monthlyDollars: number }>;
+  assumptions: string[];
+}
+
+interface EnergyEstimate {
+  region: string;
+  gramsCo2ePerKwh: number;
+  cpuSeconds: number;
+  captureWattHours: number;
+  captureGramsCo2e: number;
+  replicas: number;
+  monthlyKwh: number;
+  monthlyKgCo2e: number;
+  functions: Array<{ name: string; percentage: number; monthlyKgCo2e: number }>;
+  assumptions: string[];
+}
+
+interface FunctionDelta {
+  name: string;
+  baselineFlatPct: number;
+  comparisonFlatPct: number;
+  flatDeltaPct: number;
+  baselineCumPct: number;
+  comparisonCumPct: number;
+  cumDeltaPct: number;
+}
+
+interface DiffSummary {
+  sampleType: string;
+  unit: string;
+  baselineTotal: number;
+  comparisonTotal: number;
+  regressions: FunctionDelta[];
+  improvements: FunctionDelta[];
+}
+
+interface HeapModeReport {
+  mode: string;
+  unit: string;
+  total: number;
+  sites: Array<{ function: string; file: string; line: number; value: number; percentage: number; avgObjectSize?: number }>;
+}
+
+interface ContentionReport {
+  unit: string;
+  totalDelay: number;
+  totalContentions: number;
+  sites: Array<{ function: string; file: string; line: number; primitive: string; contentions: number; delay: number; percentage: number }>;
+}
+
 interface ProfileData {
   name: string;
   duration: number;
@@ -24,6 +80,17 @@ interface ProfileData {
   topFunctions: Array<{ name: string; percentage: number; samples: number }>;
   flamegraphData: ProfileFrame;
   rawProfile?: string;
+  total?: number;
+  costEstimate?: CostEstimate;
+  energyEstimate?: EnergyEstimate;
+  diff?: DiffSummary;
+  heap?: { mode: string; reports: HeapModeReport[] };
+  contention?: { kind: string; report: ContentionReport };
+  colorScheme?: ColorScheme;
+  orientation?: Orientation;
+  inverted?: boolean;
+  // Color-blind-safe colors, with the flamegraph also listed as text
+  accessibility?: boolean;
 }
 
 const styles: Record<string, React.CSSProperties> = {
@@ -197,6 +264,7 @@ function FlameAppInner({ toolResult, hostContext }: FlameAppInnerProps) {
         </h1>
         <p style={styles.subtitle}>
           Profile: {profileData.duration.toFixed(2)}s • {profileData.sampleCount} samples
+          {profileData.inverted && " • inverted: leaf functions with their callers"}
         </p>
       </header>
 
@@ -231,7 +299,7 @@ function FlameAppInner({ toolResult, hostContext }: FlameAppInnerProps) {
       </div>
 
       {activeTab === "flamegraph" && (
-        <Flamegraph data={profileData.flamegraphData} />
+        <Flamegraph data={profileData.flamegraphData} colorScheme={profileData.colorScheme} orientation={profileData.orientation} inverted={profileData.inverted} accessibility={profileData.accessibility} />
       )}
       {activeTab === "top-functions" && (
         <TopFunctions functions={profileData.topFunctions} />
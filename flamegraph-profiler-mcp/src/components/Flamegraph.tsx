@@ -3,11 +3,26 @@ import { useState, useCallback, useMemo } from "react";
 interface ProfileFrame {
   name: string;
   value: number;
+  delta?: number;
   children?: ProfileFrame[];
 }
 
+export type ColorScheme = "classic" | "package" | "stdlib" | "hot" | "diff";
+
+export type Orientation = "flame" | "icicle";
+
 interface FlamegraphProps {
   data: ProfileFrame;
+  // Defaults to diff for differential flamegraphs, else classic
+  colorScheme?: ColorScheme;
+  // flame puts the root at the bottom (default), icicle at the top
+  orientation?: Orientation;
+  // Rooted at leaf functions; kernel frames are then roots and cannot be hidden
+  // here (the hideKernel filter does it before inverting)
+  inverted?: boolean;
+  // Color-blind-safe colors, frames reachable by keyboard, and the graph
+  // also listed as text
+  accessibility?: boolean;
 }
 
 // Generate consistent colors based on function name
@@ -33,6 +48,320 @@ function getColorForName(name: string): string {
   return `hsl(${hue}, ${saturation}%, ${lightness}%)`;
 }
 
+// Differential colors: red for frames that grew, blue for frames that shrank
+function getDiffColor(frame: ProfileFrame): string {
+  const delta = frame.delta ?? 0;
+  const ratio = Math.min(Math.abs(delta) / (Math.max(frame.value, Math.abs(delta)) || 1), 1);
+  if (ratio < 0.01) {
+    return "hsl(0, 0%, 75%)"; // Grey for unchanged
+  }
+  const hue = delta > 0 ? 0 : 220;
+  const lightness = 80 - ratio * 35; // Stronger change = deeper color
+  return `hsl(${hue}, 75%, ${lightness}%)`;
+}
+
+function hashOf(text: string): number {
+  let hash = 0;
+  for (let i = 0; i < text.length; i++) {
+    hash = text.charCodeAt(i) + ((hash << 5) - hash);
+  }
+  return Math.abs(hash);
+}
+
+// Package of a Go function name: everything before the first dot after the last slash
+function packageOf(name: string): string {
+  const slash = name.lastIndexOf("/");
+  const dot = name.indexOf(".", slash + 1);
+  return dot === -1 ? name : name.slice(0, dot);
+}
+
+// Standard library packages have no dot in their first path element
+function isStdlib(name: string): boolean {
+  const pkg = packageOf(name);
+  return pkg !== "main" && !pkg.split("/")[0].includes(".");
+}
+
+function isUnknown(name: string): boolean {
+  return /^(0x[0-9a-f]+|\?\?|unknown)$/i.test(name);
+}
+
+// C and C++ frames from cgo or shared libraries: no Go package qualifier
+// (besides GCC clone suffixes like .part.0), or C++ scoped names
+function isNative(name: string): boolean {
+  if (isUnknown(name)) return false;
+  if (name === "runtime._ExternalCode" || name.includes("::")) return true;
+  const base = name.slice(name.lastIndexOf("/") + 1).replace(/(\.(part|cold|constprop|isra|lto_priv)(\.\d+)?)+$/, "");
+  return !base.includes(".");
+}
+
+const NEUTRAL_COLOR = "hsl(0, 0%, 75%)";
+const USER_COLOR = "hsl(25, 80%, 50%)";
+const STDLIB_COLOR = "hsl(150, 45%, 45%)";
+const RUNTIME_COLOR = "hsl(200, 60%, 55%)";
+const NATIVE_COLOR = "hsl(320, 55%, 58%)";
+const KERNEL_COLOR = "hsl(275, 45%, 58%)";
+
+// Kernel frames of mixed-mode perf profiles carry flamegraph.pl's _[k] suffix
+function isKernel(name: string): boolean {
+  return name.endsWith("_[k]");
+}
+
+function getSystemColor(name: string): string | undefined {
+  if (isKernel(name)) return KERNEL_COLOR;
+  return isNative(name) ? NATIVE_COLOR : undefined;
+}
+
+function getPackageColor(pkg: string): string {
+  const hash = hashOf(pkg);
+  return `hsl(${(hash * 137) % 360}, ${55 + (hash % 20)}%, ${45 + ((hash >> 8) % 12)}%)`;
+}
+
+function getCodeColor(name: string): string {
+  if (isUnknown(name)) return NEUTRAL_COLOR;
+  const system = getSystemColor(name);
+  if (system) return system;
+  if (name.startsWith("runtime.") || name.startsWith("runtime/internal/")) return RUNTIME_COLOR;
+  return isStdlib(name) ? STDLIB_COLOR : USER_COLOR;
+}
+
+// Pale yellow for no self time up to deep red for the hottest frame
+function getHotColor(share: number): string {
+  return `hsl(${Math.round(55 * (1 - share))}, ${Math.round(70 + share * 15)}%, ${Math.round(80 - share * 35)}%)`;
+}
+
+function selfOf(frame: ProfileFrame): number {
+  return Math.max(0, frame.value - (frame.children ?? []).reduce((sum, c) => sum + c.value, 0));
+}
+
+interface LegendEntry {
+  label: string;
+  color: string;
+}
+
+// Okabe-Ito, distinguishable with every common color vision deficiency
+const SAFE_COLORS = ["#e69f00", "#56b4e9", "#009e73", "#f0e442", "#0072b2", "#d55e00", "#cc79a7"];
+const SAFE_NEUTRAL = "#bbbbbb";
+const SAFE_CODE_COLORS = {
+  user: "#e69f00",
+  stdlib: "#009e73",
+  runtime: "#56b4e9",
+  native: "#cc79a7",
+  kernel: "#0072b2",
+};
+
+// Viridis, pale to dark, for self time
+const VIRIDIS = ["#fde725", "#5ec962", "#21918c", "#3b528b", "#440154"];
+
+function rgbOf(hex: string): number[] {
+  return [1, 3, 5].map((i) => parseInt(hex.slice(i, i + 2), 16));
+}
+
+function getViridis(share: number): string {
+  const at = Math.min(1, Math.max(0, share)) * (VIRIDIS.length - 1);
+  const i = Math.min(Math.floor(at), VIRIDIS.length - 2);
+  const [from, to] = [rgbOf(VIRIDIS[i]), rgbOf(VIRIDIS[i + 1])];
+  return `rgb(${from.map((c, k) => Math.round(c + (to[k] - c) * (at - i))).join(", ")})`;
+}
+
+// Orange for frames that grew, blue for frames that shrank
+function getSafeDiffColor(frame: ProfileFrame): string {
+  const delta = frame.delta ?? 0;
+  const ratio = Math.min(Math.abs(delta) / (Math.max(frame.value, Math.abs(delta)) || 1), 1);
+  if (ratio < 0.01) {
+    return SAFE_NEUTRAL;
+  }
+  return `hsl(${delta > 0 ? 30 : 202}, 100%, ${80 - ratio * 38}%)`;
+}
+
+function getSafeCodeColor(name: string): string {
+  if (isUnknown(name)) return SAFE_NEUTRAL;
+  if (isKernel(name)) return SAFE_CODE_COLORS.kernel;
+  if (isNative(name)) return SAFE_CODE_COLORS.native;
+  if (name.startsWith("runtime.") || name.startsWith("runtime/internal/")) return SAFE_CODE_COLORS.runtime;
+  return isStdlib(name) ? SAFE_CODE_COLORS.stdlib : SAFE_CODE_COLORS.user;
+}
+
+// RGB of a #rrggbb, rgb() or hsl() color
+function parseColor(color: string): number[] {
+  if (color.startsWith("#")) return rgbOf(color);
+  const parts = (color.match(/[\d.]+/g) ?? []).map(Number);
+  if (color.startsWith("rgb")) return parts.slice(0, 3);
+  const [h, sat, light] = [parts[0], parts[1] / 100, parts[2] / 100];
+  const a = sat * Math.min(light, 1 - light);
+  const f = (n: number) => {
+    const k = (n + h / 30) % 12;
+    return 255 * (light - a * Math.max(-1, Math.min(k - 3, 9 - k, 1)));
+  };
+  return [f(0), f(8), f(4)];
+}
+
+// Label color for a fill: dark text on light fills, white on dark ones
+function getLabelColor(fill: string): string {
+  const [r, g, b] = parseColor(fill).map((c) => {
+    const v = c / 255;
+    return v <= 0.03928 ? v / 12.92 : ((v + 0.055) / 1.055) ** 2.4;
+  });
+  const luminance = 0.2126 * r + 0.7152 * g + 0.0722 * b;
+  return (luminance + 0.05) / 0.066 >= 1.05 / (luminance + 0.05) ? "#222" : "#fff";
+}
+
+// Color-blind-safe fill per frame and legend for a color scheme. Classic keeps
+// its warm hues, which only tell frames apart, with system frames made safe.
+function getSafeColorer(scheme: ColorScheme, root: ProfileFrame, frames: FlatFrame[]): { color: (frame: ProfileFrame) => string; legend: LegendEntry[] } {
+  switch (scheme) {
+    case "package": {
+      const self = new Map<string, number>();
+      for (const { frame } of frames) {
+        if (frame === root || isKernel(frame.name) || isNative(frame.name)) continue;
+        const pkg = packageOf(frame.name);
+        self.set(pkg, (self.get(pkg) ?? 0) + selfOf(frame));
+      }
+      const top = [...self.entries()].sort((a, b) => b[1] - a[1]).slice(0, SAFE_COLORS.length);
+      const colors = new Map(top.map(([pkg], i) => [pkg, SAFE_COLORS[i]]));
+      return {
+        color: (frame) => {
+          if (frame === root || isUnknown(frame.name)) return SAFE_NEUTRAL;
+          if (isKernel(frame.name)) return SAFE_CODE_COLORS.kernel;
+          if (isNative(frame.name)) return SAFE_CODE_COLORS.native;
+          return colors.get(packageOf(frame.name)) ?? SAFE_NEUTRAL;
+        },
+        legend: [...top.map(([pkg], i) => ({ label: pkg, color: SAFE_COLORS[i] })), { label: "Other Packages", color: SAFE_NEUTRAL }],
+      };
+    }
+    case "stdlib":
+      return {
+        color: (frame) => (frame === root ? SAFE_NEUTRAL : getSafeCodeColor(frame.name)),
+        legend: [
+          { label: "Your Code", color: SAFE_CODE_COLORS.user },
+          { label: "Standard Library", color: SAFE_CODE_COLORS.stdlib },
+          { label: "Runtime", color: SAFE_CODE_COLORS.runtime },
+          { label: "Native Code", color: SAFE_CODE_COLORS.native },
+          { label: "Kernel", color: SAFE_CODE_COLORS.kernel },
+          { label: "Unsymbolized", color: SAFE_NEUTRAL },
+        ],
+      };
+    case "hot": {
+      const max = Math.max(...frames.map(({ frame }) => selfOf(frame))) || 1;
+      return {
+        color: (frame) => getViridis(selfOf(frame) / max),
+        legend: [
+          { label: "No Self Time", color: getViridis(0) },
+          { label: "Warm", color: getViridis(0.5) },
+          { label: "Hottest Self Time", color: getViridis(1) },
+        ],
+      };
+    }
+    case "diff":
+      return {
+        color: getSafeDiffColor,
+        legend: [
+          { label: "▲ Regressed", color: "hsl(30, 100%, 50%)" },
+          { label: "▼ Improved", color: "hsl(202, 100%, 50%)" },
+          { label: "Unchanged", color: SAFE_NEUTRAL },
+        ],
+      };
+    default:
+      return {
+        color: (frame) => {
+          if (frame !== root && isKernel(frame.name)) return SAFE_CODE_COLORS.kernel;
+          if (frame !== root && isNative(frame.name)) return SAFE_CODE_COLORS.native;
+          return getColorForName(frame.name);
+        },
+        legend: [
+          { label: "Native Code", color: SAFE_CODE_COLORS.native },
+          { label: "Kernel", color: SAFE_CODE_COLORS.kernel },
+        ],
+      };
+  }
+}
+
+// ▲ or ▼ ahead of a changed frame's name, so diffs do not rely on color alone
+function getMarker(frame: ProfileFrame): string {
+  if (!frame.delta) return "";
+  return frame.delta > 0 ? "▲ " : "▼ ";
+}
+
+// The graph as nested lists, hottest callees first, down to 1% of the total
+function FrameList({ frame, total }: { frame: ProfileFrame; total: number }) {
+  const children = (frame.children ?? [])
+    .filter((c) => c.value !== 0 && Math.abs(c.value) >= Math.abs(total) * 0.01)
+    .sort((a, b) => b.value - a.value);
+  if (children.length === 0) return null;
+  return (
+    <ul>
+      {children.map((child, i) => (
+        <li key={`${child.name}-${i}`}>
+          {child.name}: {((child.value / (total || 1)) * 100).toFixed(2)}%
+          {child.delta ? `, ${child.delta > 0 ? "grew" : "shrank"} ${Math.abs((child.delta / (total || 1)) * 100).toFixed(2)} pts` : ""}
+          <FrameList frame={child} total={total} />
+        </li>
+      ))}
+    </ul>
+  );
+}
+
+// Fill per frame and legend for a color scheme
+function getColorer(scheme: ColorScheme, root: ProfileFrame, frames: FlatFrame[]): { color: (frame: ProfileFrame) => string; legend: LegendEntry[] } {
+  switch (scheme) {
+    case "package": {
+      const self = new Map<string, number>();
+      for (const { frame } of frames) {
+        if (frame === root || getSystemColor(frame.name)) continue;
+        const pkg = packageOf(frame.name);
+        self.set(pkg, (self.get(pkg) ?? 0) + selfOf(frame));
+      }
+      const top = [...self.entries()].sort((a, b) => b[1] - a[1]).slice(0, 6);
+      return {
+        color: (frame) => (frame === root || isUnknown(frame.name) ? NEUTRAL_COLOR : getSystemColor(frame.name) ?? getPackageColor(packageOf(frame.name))),
+        legend: top.map(([pkg]) => ({ label: pkg, color: getPackageColor(pkg) })),
+      };
+    }
+    case "stdlib":
+      return {
+        color: (frame) => (frame === root ? NEUTRAL_COLOR : getCodeColor(frame.name)),
+        legend: [
+          { label: "Your Code", color: USER_COLOR },
+          { label: "Standard Library", color: STDLIB_COLOR },
+          { label: "Runtime", color: RUNTIME_COLOR },
+          { label: "Native Code", color: NATIVE_COLOR },
+          { label: "Kernel", color: KERNEL_COLOR },
+          { label: "Unsymbolized", color: NEUTRAL_COLOR },
+        ],
+      };
+    case "hot": {
+      const max = Math.max(...frames.map(({ frame }) => selfOf(frame))) || 1;
+      return {
+        color: (frame) => getHotColor(selfOf(frame) / max),
+        legend: [
+          { label: "No Self Time", color: getHotColor(0) },
+          { label: "Warm", color: getHotColor(0.5) },
+          { label: "Hottest Self Time", color: getHotColor(1) },
+        ],
+      };
+    }
+    case "diff":
+      return {
+        color: getDiffColor,
+        legend: [
+          { label: "Regressed", color: "hsl(0, 75%, 55%)" },
+          { label: "Improved", color: "hsl(220, 75%, 55%)" },
+          { label: "Unchanged", color: NEUTRAL_COLOR },
+        ],
+      };
+    default:
+      return {
+        color: (frame) => (frame !== root ? getSystemColor(frame.name) : undefined) ?? getColorForName(frame.name),
+        legend: [
+          { label: "Application Code", color: USER_COLOR },
+          { label: "Runtime", color: RUNTIME_COLOR },
+          { label: "System Calls", color: "hsl(280, 50%, 55%)" },
+          { label: "Native Code", color: NATIVE_COLOR },
+          { label: "Kernel", color: KERNEL_COLOR },
+        ],
+      };
+  }
+}
+
 // Flatten the tree to rows for rendering
 interface FlatFrame {
   frame: ProfileFrame;
@@ -41,6 +370,17 @@ interface FlatFrame {
   width: number; // 0-1 range
 }
 
+// Kernel frames sit beneath the user frame that entered the kernel, so
+// dropping them leaves their time as that frame's self time
+function withoutKernel(frame: ProfileFrame): ProfileFrame {
+  if (!frame.children) return frame;
+  return { ...frame, children: frame.children.filter((c) => !isKernel(c.name)).map(withoutKernel) };
+}
+
+function hasKernel(frame: ProfileFrame): boolean {
+  return isKernel(frame.name) || (frame.children ?? []).some(hasKernel);
+}
+
 function flattenFrames(root: ProfileFrame): FlatFrame[] {
   const result: FlatFrame[] = [];
 
@@ -99,6 +439,19 @@ const styles: Record<string, React.CSSProperties> = {
     alignItems: "center",
     gap: "4px",
   },
+  toggle: {
+    display: "flex",
+    alignItems: "center",
+    gap: "4px",
+    marginLeft: "auto",
+    cursor: "pointer",
+  },
+  outline: {
+    padding: "8px 12px",
+    fontSize: "12px",
+    fontFamily: "monospace",
+    borderTop: "1px solid var(--color-border-primary, #e5e5e5)",
+  },
   legendColor: {
     width: "12px",
     height: "12px",
@@ -106,11 +459,19 @@ const styles: Record<string, React.CSSProperties> = {
   },
 };
 
-export function Flamegraph({ data }: FlamegraphProps) {
+export function Flamegraph({ data, colorScheme, orientation = "flame", inverted = false, accessibility = false }: FlamegraphProps) {
   const [hoveredFrame, setHoveredFrame] = useState<FlatFrame | null>(null);
   const [tooltipPos, setTooltipPos] = useState({ x: 0, y: 0 });
+  const [showKernel, setShowKernel] = useState(true);
 
-  const flatFrames = useMemo(() => flattenFrames(data), [data]);
+  const mixedMode = useMemo(() => !inverted && hasKernel(data), [data, inverted]);
+  const shown = useMemo(() => (mixedMode && !showKernel ? withoutKernel(data) : data), [data, mixedMode, showKernel]);
+  const flatFrames = useMemo(() => flattenFrames(shown), [shown]);
+  const scheme = colorScheme ?? (data.delta !== undefined ? "diff" : "classic");
+  const colorer = useMemo(
+    () => (accessibility ? getSafeColorer : getColorer)(scheme, shown, flatFrames),
+    [accessibility, scheme, shown, flatFrames]
+  );
   const maxDepth = useMemo(
     () => Math.max(...flatFrames.map((f) => f.depth)) + 1,
     [flatFrames]
@@ -138,28 +499,41 @@ export function Flamegraph({ data }: FlamegraphProps) {
         height={svgHeight}
         viewBox={`0 0 ${svgWidth} ${svgHeight}`}
         preserveAspectRatio="xMinYMin meet"
+        role={accessibility ? "group" : "img"}
+        aria-label={`Flamegraph${inverted ? ", inverted" : ""}, ${scheme} colors${accessibility ? "; listed as text below" : ""}`}
       >
         {flatFrames.map((flatFrame, i) => {
           const { frame, depth, x, width } = flatFrame;
           const rectX = x * (svgWidth - 2 * padding) + padding;
-          const rectY = (maxDepth - 1 - depth) * (frameHeight + padding) + padding;
+          const row = orientation === "icicle" ? depth : maxDepth - 1 - depth;
+          const rectY = row * (frameHeight + padding) + padding;
           const rectWidth = Math.max(width * (svgWidth - 2 * padding) - 1, 1);
-          const color = getColorForName(frame.name);
+          const color = colorer.color(frame);
           const isHovered = hoveredFrame === flatFrame;
 
           // Truncate name to fit
           const maxChars = Math.floor(rectWidth / 5);
-          const displayName = frame.name.length > maxChars
-            ? frame.name.substring(0, maxChars - 2) + "…"
-            : frame.name;
+          const name = accessibility ? `${getMarker(frame)}${frame.name}` : frame.name;
+          const displayName = name.length > maxChars
+            ? name.substring(0, maxChars - 2) + "…"
+            : name;
+          const share = ((frame.value / (data.value || 1)) * 100).toFixed(2);
 
           return (
             <g
               key={`${frame.name}-${depth}-${i}`}
               onMouseMove={(e) => handleMouseMove(e, flatFrame)}
               onMouseLeave={handleMouseLeave}
+              onFocus={(e) => {
+                const box = e.currentTarget.getBoundingClientRect();
+                setHoveredFrame(flatFrame);
+                setTooltipPos({ x: box.left + 10, y: box.bottom + 4 });
+              }}
+              onBlur={handleMouseLeave}
+              tabIndex={accessibility && rectWidth > 30 ? 0 : undefined}
               style={{ cursor: "pointer" }}
             >
+              {accessibility && <title>{`${frame.name}: ${share}% of total`}</title>}
               <rect
                 x={rectX}
                 y={rectY}
@@ -175,8 +549,8 @@ export function Flamegraph({ data }: FlamegraphProps) {
                   x={rectX + 3}
                   y={rectY + frameHeight / 2 + 3}
                   fontSize="9"
-                  fill="#fff"
-                  style={{ pointerEvents: "none", textShadow: "0 1px 1px rgba(0,0,0,0.5)" }}
+                  fill={accessibility ? getLabelColor(color) : "#fff"}
+                  style={{ pointerEvents: "none", textShadow: accessibility ? "none" : "0 1px 1px rgba(0,0,0,0.5)" }}
                 >
                   {displayName}
                 </text>
@@ -193,23 +567,37 @@ export function Flamegraph({ data }: FlamegraphProps) {
           Samples: {hoveredFrame.frame.value}
           <br />
           {((hoveredFrame.frame.value / data.value) * 100).toFixed(2)}% of total
+          {hoveredFrame.frame.delta !== undefined && (
+            <>
+              <br />
+              Change: {hoveredFrame.frame.delta > 0 ? "+" : ""}
+              {((hoveredFrame.frame.delta / data.value) * 100).toFixed(2)}% of total
+            </>
+          )}
         </div>
       )}
 
       <div style={styles.legend}>
-        <div style={styles.legendItem}>
-          <div style={{ ...styles.legendColor, background: "hsl(25, 80%, 50%)" }} />
-          <span>Application Code</span>
-        </div>
-        <div style={styles.legendItem}>
-          <div style={{ ...styles.legendColor, background: "hsl(200, 60%, 55%)" }} />
-          <span>Runtime</span>
-        </div>
-        <div style={styles.legendItem}>
-          <div style={{ ...styles.legendColor, background: "hsl(280, 50%, 55%)" }} />
-          <span>System Calls</span>
-        </div>
+        {colorer.legend.map((entry) => (
+          <div key={entry.label} style={styles.legendItem}>
+            <div style={{ ...styles.legendColor, background: entry.color }} />
+            <span>{entry.label}</span>
+          </div>
+        ))}
+        {mixedMode && (
+          <label style={styles.toggle}>
+            <input type="checkbox" checked={showKernel} onChange={(e) => setShowKernel(e.target.checked)} />
+            Show kernel frames
+          </label>
+        )}
       </div>
+
+      {accessibility && (
+        <details style={styles.outline} open>
+          <summary>Flamegraph as text (share of the total, hottest first)</summary>
+          <FrameList frame={shown} total={shown.value} />
+        </details>
+      )}
     </div>
   );
 }
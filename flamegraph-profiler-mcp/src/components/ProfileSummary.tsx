@@ -1,9 +1,65 @@
 interface ProfileFrame {
   name: string;
   value: number;
+  delta?: number;
   children?: ProfileFrame[];
 }
 
+interface CostEstimate {
+  resource: "cpu" | "memory";
+  replicas: number;
+  usagePerReplica: number;
+  monthlyTotalDollars: number;
+  functions: Array<{ name: string; percentage: number; monthlyDollars: number }>;
+  assumptions: string[];
+}
+
+interface EnergyEstimate {
+  region: string;
+  gramsCo2ePerKwh: number;
+  cpuSeconds: number;
+  captureWattHours: number;
+  captureGramsCo2e: number;
+  replicas: number;
+  monthlyKwh: number;
+  monthlyKgCo2e: number;
+  functions: Array<{ name: string; percentage: number; monthlyKgCo2e: number }>;
+  assumptions: string[];
+}
+
+interface FunctionDelta {
+  name: string;
+  baselineFlatPct: number;
+  comparisonFlatPct: number;
+  flatDeltaPct: number;
+  baselineCumPct: number;
+  comparisonCumPct: number;
+  cumDeltaPct: number;
+}
+
+interface DiffSummary {
+  sampleType: string;
+  unit: string;
+  baselineTotal: number;
+  comparisonTotal: number;
+  regressions: FunctionDelta[];
+  improvements: FunctionDelta[];
+}
+
+interface HeapModeReport {
+  mode: string;
+  unit: string;
+  total: number;
+  sites: Array<{ function: string; file: string; line: number; value: number; percentage: number; avgObjectSize?: number }>;
+}
+
+interface ContentionReport {
+  unit: string;
+  totalDelay: number;
+  totalContentions: number;
+  sites: Array<{ function: string; file: string; line: number; primitive: string; contentions: number; delay: number; percentage: number }>;
+}
+
 interface ProfileData {
   name: string;
   duration: number;
@@ -11,6 +67,12 @@ interface ProfileData {
   topFunctions: Array<{ name: string; percentage: number; samples: number }>;
   flamegraphData: ProfileFrame;
   rawProfile?: string;
+  total?: number;
+  costEstimate?: CostEstimate;
+  energyEstimate?: EnergyEstimate;
+  diff?: DiffSummary;
+  heap?: { mode: string; reports: HeapModeReport[] };
+  contention?: { kind: string; report: ContentionReport };
 }
 
 interface ProfileSummaryProps {
@@ -172,6 +234,111 @@ export function ProfileSummary({ profile }: ProfileSummaryProps) {
         </ul>
       </div>
 
+      {profile.diff && (
+        <div style={styles.card}>
+          <h3 style={styles.cardTitle}>🔀 Differential Comparison ({profile.diff.sampleType})</h3>
+          {[
+            { title: "📈 Largest Regressions", items: profile.diff.regressions },
+            { title: "📉 Largest Improvements", items: profile.diff.improvements },
+          ].map(({ title, items }) => (
+            <div key={title}>
+              <strong style={styles.insightItem}>{title}</strong>
+              <ul style={styles.insightsList}>
+                {items.length === 0 && <li style={styles.insightItem}>None</li>}
+                {items.map((d) => (
+                  <li key={d.name} style={styles.insightItem}>
+                    {d.name}: {d.baselineFlatPct}% → {d.comparisonFlatPct}% ({d.flatDeltaPct > 0 ? "+" : ""}{d.flatDeltaPct} pts)
+                  </li>
+                ))}
+              </ul>
+            </div>
+          ))}
+        </div>
+      )}
+
+      {profile.heap && (
+        <div style={styles.card}>
+          <h3 style={styles.cardTitle}>📦 Allocation Sites</h3>
+          {profile.heap.reports.map((report) => (
+            <div key={report.mode}>
+              <strong style={styles.insightItem}>
+                {report.mode}{report.mode === profile.heap?.mode ? " (shown in flamegraph)" : ""}
+              </strong>
+              <ul style={styles.insightsList}>
+                {report.sites.length === 0 && <li style={styles.insightItem}>No allocations recorded</li>}
+                {report.sites.map((site) => (
+                  <li key={`${site.function}:${site.line}`} style={styles.insightItem}>
+                    {site.function} ({site.file.split("/").pop()}:{site.line}): {site.percentage}%
+                  </li>
+                ))}
+              </ul>
+            </div>
+          ))}
+        </div>
+      )}
+
+      {profile.contention && (
+        <div style={styles.card}>
+          <h3 style={styles.cardTitle}>⏳ Contention Sites ({profile.contention.kind})</h3>
+          <ul style={styles.insightsList}>
+            {profile.contention.report.sites.length === 0 && <li style={styles.insightItem}>No contention recorded</li>}
+            {profile.contention.report.sites.map((site) => (
+              <li key={`${site.function}:${site.line}:${site.primitive}`} style={styles.insightItem}>
+                {site.function} ({site.file.split("/").pop()}:{site.line}) on {site.primitive}: {site.percentage}% ({site.contentions} events)
+              </li>
+            ))}
+          </ul>
+        </div>
+      )}
+
+      {profile.costEstimate && (
+        <div style={styles.card}>
+          <h3 style={styles.cardTitle}>💰 Estimated Monthly Cost</h3>
+          <div style={styles.statsGrid}>
+            <div style={styles.stat}>
+              <div style={styles.statValue}>${profile.costEstimate.monthlyTotalDollars.toLocaleString()}</div>
+              <div style={styles.statLabel}>Total ({profile.costEstimate.replicas} replicas)</div>
+            </div>
+            {profile.costEstimate.functions.slice(0, 3).map((f) => (
+              <div key={f.name} style={styles.stat}>
+                <div style={styles.statValue}>${f.monthlyDollars.toLocaleString()}</div>
+                <div style={styles.statLabel}>{f.name}</div>
+              </div>
+            ))}
+          </div>
+          <ul style={{ ...styles.insightsList, marginTop: "12px" }}>
+            {profile.costEstimate.assumptions.map((assumption, i) => (
+              <li key={i} style={styles.insightItem}>{assumption}</li>
+            ))}
+          </ul>
+        </div>
+      )}
+
+      {profile.energyEstimate && (
+        <div style={styles.card}>
+          <h3 style={styles.cardTitle}>🌱 Estimated Energy & Emissions</h3>
+          <div style={styles.statsGrid}>
+            <div style={styles.stat}>
+              <div style={styles.statValue}>{profile.energyEstimate.captureWattHours} Wh</div>
+              <div style={styles.statLabel}>This Capture</div>
+            </div>
+            <div style={styles.stat}>
+              <div style={styles.statValue}>{profile.energyEstimate.monthlyKwh} kWh</div>
+              <div style={styles.statLabel}>Per Month ({profile.energyEstimate.replicas} replicas)</div>
+            </div>
+            <div style={styles.stat}>
+              <div style={styles.statValue}>{profile.energyEstimate.monthlyKgCo2e} kg</div>
+              <div style={styles.statLabel}>CO2e Per Month ({profile.energyEstimate.region})</div>
+            </div>
+          </div>
+          <ul style={{ ...styles.insightsList, marginTop: "12px" }}>
+            {profile.energyEstimate.assumptions.map((assumption, i) => (
+              <li key={i} style={styles.insightItem}>{assumption}</li>
+            ))}
+          </ul>
+        </div>
+      )}
+
       {profile.rawProfile && (
         <div style={styles.card}>
           <h3 style={styles.cardTitle}>📄 Raw Profile Data</h3>
@@ -0,0 +1,83 @@
+/**
+ * Allocation hotspots of heap profiles.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import path from "node:path";
+import { z } from "zod";
+import { allocHotspots, LARGE_OBJECT_BYTES, SMALL_OBJECT_BYTES, type AllocHotspot } from "../lib/allocs.js";
+import { resolveProfilePath } from "../lib/catalog.js";
+import { isHeapProfile } from "../lib/heap.js";
+import { formatValue, readProfile } from "../lib/pprof.js";
+import { applyFrameFilters } from "../lib/transform.js";
+import { filterNote, frameFilterFields } from "./filters.js";
+
+const KIND_LABELS = { large: "large", small: "small-object churn", medium: "medium" } as const;
+
+function formatHotspot(hotspot: AllocHotspot, i: number): string {
+  const size = hotspot.avgObjectSize !== undefined ? `, ~${formatValue(hotspot.avgObjectSize, "bytes")}/object` : "";
+  return [
+    `${i + 1}. ${hotspot.function} (${path.basename(hotspot.file)}:${hotspot.line}): ${formatValue(hotspot.bytes, "bytes")} (${hotspot.bytesPct}%), ${hotspot.objects} objects (${hotspot.objectsPct}%)${size} [${KIND_LABELS[hotspot.kind]}]`,
+    ...(hotspot.source ? [`   \`${hotspot.source}\``] : []),
+    ...hotspot.causes.map((cause) => `   ↳ ${cause}`),
+  ].join("\n");
+}
+
+export function registerAllocTools(server: McpServer) {
+  server.registerTool(
+    "alloc_hotspots",
+    {
+      title: "Allocation Hotspots",
+      description: `Rank the allocation sites (function and line) of a heap profile by bytes and by object count, tell large allocations (over ${LARGE_OBJECT_BYTES / 1024}kB per object) from small-object churn (up to ${SMALL_OBJECT_BYTES} bytes per object), and note likely reasons each site allocates on the heap: the compiler's escape analysis (go build -gcflags=-m) for local packages, and patterns in the allocating line such as append without preallocation, string concatenation, fmt formatting, map growth and interface boxing.`,
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the heap pprof file, or its catalog ID"),
+        family: z.enum(["alloc", "inuse"]).optional().default("alloc").describe("'alloc' for everything allocated since start, which drives GC pressure (default), or 'inuse' for what was live at capture time"),
+        limit: z.number().int().min(1).max(100).optional().default(10).describe("Sites to list in each ranking (default: 10)"),
+        sourceRoot: z.string().optional().describe("Directory containing the sources if the profile's paths are not valid here (default: PROFILER_SOURCE_ROOT)"),
+        escapeAnalysis: z.boolean().optional().default(true).describe("Run the compiler's escape analysis on local packages with allocation sites (default: true)"),
+        ...frameFilterFields,
+      }),
+    },
+    async ({ profilePath, family = "alloc", limit = 10, sourceRoot, escapeAnalysis = true, ...filters }): Promise<CallToolResult> => {
+      try {
+        const profile = applyFrameFilters(readProfile(await resolveProfilePath(profilePath)), filters);
+        if (!isHeapProfile(profile)) {
+          const types = profile.sampleTypes.map((t) => t.type).join(", ");
+          throw new Error(`Not a heap profile (sample types: ${types})`);
+        }
+        const report = await allocHotspots(profile, {
+          family,
+          limit,
+          sourceRoot: sourceRoot ?? process.env.PROFILER_SOURCE_ROOT,
+          escapeAnalysis,
+        });
+        if (report.totalObjects === 0) {
+          throw new Error(`No ${family} allocations recorded`);
+        }
+
+        const text = `🧮 Allocation hotspots in ${path.basename(profilePath)} (${family}: ${formatValue(report.totalBytes, "bytes")} in ${report.totalObjects} objects)${filterNote(filters)}
+Large allocations: ${report.largeBytesPct}% of bytes · Small-object churn: ${report.smallBytesPct}% of bytes, ${report.smallObjectsPct}% of objects
+
+📦 By bytes:
+${report.bySpace.map(formatHotspot).join("\n")}
+
+🔢 By objects:
+${report.byObjects.map(formatHotspot).join("\n")}
+${report.escapeAnalysisFailed.length > 0 ? `\n⚠️ Escape analysis failed in ${report.escapeAnalysisFailed.join(", ")}; causes there come from the source lines only.\n` : ""}
+💡 Tip: ${report.smallObjectsPct >= 50
+  ? "Most objects are small: churn costs GC time per object, so fewer allocations (preallocation, reuse, fewer interface conversions) matter more than smaller ones."
+  : "Large allocations dominate: reuse buffers or stream instead of materializing whole payloads."} Run with family 'inuse' to see what is retained instead.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: report as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error finding allocation hotspots: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
@@ -0,0 +1,108 @@
+/**
+ * Performance badges summing up a diff, for READMEs and pull request comments.
+ */
+import { ResourceTemplate, type McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult, ReadResourceResult } from "@modelcontextprotocol/sdk/types.js";
+import path from "node:path";
+import { z } from "zod";
+import { BADGE_URI_TEMPLATE, badgeOfDiff, badgeUri, badgeUrl, getBadge, listBadges, renderBadge, saveBadge } from "../lib/badges.js";
+import { resolveProfilePath } from "../lib/catalog.js";
+import { diffProfiles } from "../lib/diff.js";
+import { fileOf, readProfile } from "../lib/pprof.js";
+import { applySuppressions, listSuppressions } from "../lib/suppressions.js";
+import { applyFrameFilters } from "../lib/transform.js";
+import { filterLine, frameFilterFields } from "./filters.js";
+
+export function registerBadgeTools(server: McpServer) {
+  server.registerTool(
+    "diff_badge",
+    {
+      title: "Performance Badge",
+      description: "Sum up a comparison against a baseline profile as a shields-style SVG badge, e.g. 'perf | -3.2% vs baseline', green when the total went down or stayed within the threshold and red when it grew past it, with the top regression in its tooltip. The badge is saved by name and served as the badge://{name} resource and, when the server runs over HTTP, at /badges/{name}.svg for embedding in READMEs and pull request comments; making it again under the same name updates it everywhere.",
+      inputSchema: z.object({
+        baselinePath: z.string().describe("Path or catalog ID of the baseline profile"),
+        comparisonPath: z.string().describe("Path or catalog ID of the comparison profile"),
+        name: z.string().optional().default("perf").describe("Badge name, used in its URL (default: 'perf'); letters, digits, '.', '-' and '_'"),
+        label: z.string().optional().default("perf").describe("Text on the badge's left side (default: 'perf')"),
+        threshold: z.number().min(0).optional().default(1).describe("Growth in percent above which the badge turns red (default: 1)"),
+        sampleType: z.string().optional().describe("Sample type to compare (default: the profile's default type)"),
+        ...frameFilterFields,
+      }),
+    },
+    async ({ baselinePath, comparisonPath, name = "perf", label = "perf", threshold = 1, sampleType, ...filters }): Promise<CallToolResult> => {
+      try {
+        const baselineFile = await resolveProfilePath(baselinePath);
+        const comparisonFile = await resolveProfilePath(comparisonPath);
+        const baseline = applyFrameFilters(readProfile(baselineFile), filters);
+        const comparison = applyFrameFilters(readProfile(comparisonFile), filters);
+        const diff = diffProfiles(baseline, comparison, sampleType, 1);
+        const suppressions = await listSuppressions();
+        diff.regressions = applySuppressions(diff.regressions, suppressions, (d) => d.name,
+          (n) => fileOf(comparison, n) ?? fileOf(baseline, n)).kept;
+
+        const entry = badgeOfDiff(diff, {
+          name,
+          label,
+          threshold,
+          baseline: path.basename(baselinePath),
+          comparison: path.basename(comparisonPath),
+          baselineSeconds: baseline.durationSeconds,
+          comparisonSeconds: comparison.durationSeconds,
+        });
+        await saveBadge(entry);
+        const url = badgeUrl(entry.name);
+        const text = `${entry.color === "red" ? "🔴" : "🟢"} ${entry.label}: ${entry.message}
+${filterLine(filters)}📊 ${entry.sampleType}${entry.perSecond ? " per second of capture" : " total"}: ${path.basename(baselinePath)} → ${path.basename(comparisonPath)}${entry.topRegression ? `\n📈 Top regression: ${entry.topRegression.name} (+${entry.topRegression.flatDeltaPct} pts flat)` : ""}
+
+🏷️ Saved as ${badgeUri(entry.name)}${url ? `\nEmbed it with: ![${entry.label}](${url})` : ""}
+💡 Tip: ${url
+          ? "Run this again in CI under the same name and every page embedding the badge shows the new result."
+          : "Serve the profiler over HTTP (npm run serve) to get a URL for the badge that READMEs and pull requests can embed."}`;
+        return {
+          content: [
+            { type: "text", text },
+            { type: "resource_link", uri: badgeUri(entry.name), name: `${entry.name} badge`, mimeType: "image/svg+xml" },
+          ],
+          structuredContent: { ...entry, uri: badgeUri(entry.name), url } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error making badge: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
+
+export function registerBadgeResources(server: McpServer) {
+  server.registerResource(
+    "badge",
+    new ResourceTemplate(BADGE_URI_TEMPLATE, {
+      list: async () => ({
+        resources: (await listBadges()).map((entry) => ({
+          uri: badgeUri(entry.name),
+          name: `${entry.name} badge`,
+          description: `${entry.label}: ${entry.message} (${entry.baseline} → ${entry.comparison}, ${entry.at})`,
+          mimeType: "image/svg+xml",
+        })),
+      }),
+    }),
+    {
+      title: "Performance Badge",
+      description: "SVG badge made by diff_badge, summing up a comparison against a baseline",
+      mimeType: "image/svg+xml",
+    },
+    async (uri, variables): Promise<ReadResourceResult> => {
+      const name = decodeURIComponent(String(variables.name));
+      const entry = await getBadge(name);
+      if (!entry) {
+        throw new Error(`No badge named ${name}; make one with diff_badge`);
+      }
+      return {
+        contents: [{ uri: uri.href, mimeType: "image/svg+xml", text: renderBadge(entry) }],
+      };
+    },
+  );
+}
@@ -0,0 +1,101 @@
+/**
+ * Baseline profiles stored in the profiled project's Git repository.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import path from "node:path";
+import { z } from "zod";
+import { baselineKind, describeSelection, gitRoot, listBaselines, profileCommit, repoOfProfile, saveBaseline, selectBaseline } from "../lib/baselines.js";
+import { resolveProfilePath } from "../lib/catalog.js";
+import { readProfile } from "../lib/pprof.js";
+
+export function registerBaselineTools(server: McpServer) {
+  server.registerTool(
+    "save_baseline",
+    {
+      title: "Save Baseline",
+      description: "Store a profile as a baseline in the profiled project's Git repository (perf/baselines/<name>/<commit>.pb.gz), so baselines are versioned with the code. diff_flamegraph then picks the baseline of the nearest ancestor commit automatically. Commit the file to share it.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file to store, or its catalog ID"),
+        repoPath: z.string().optional().describe("Path inside the Git repository (default: the repository of the profile's source files)"),
+        name: z.string().optional().describe("Baseline name (default: the profile's kind, e.g. 'cpu', 'heap', 'block', 'mutex')"),
+        commit: z.string().optional().describe("Commit the profile was captured at (default: the profile's git.sha tag, else HEAD)"),
+      }),
+    },
+    async ({ profilePath, repoPath, name, commit }): Promise<CallToolResult> => {
+      try {
+        const profile = readProfile(await resolveProfilePath(profilePath));
+        const repo = repoPath ?? (await repoOfProfile(profile));
+        if (!repo) {
+          throw new Error("The profile's sources are not in a Git repository; pass repoPath");
+        }
+        const baseline = await saveBaseline(await resolveProfilePath(profilePath), repo, {
+          name: name ?? baselineKind(profile),
+          commit: commit ?? profileCommit(profile),
+        });
+        const root = await gitRoot(repo);
+        const text = `📌 Saved '${baseline.name}' baseline for ${baseline.commit.slice(0, 12)}
+📁 ${baseline.path}
+
+💡 Tip: Commit it to share it: git -C ${root} add ${path.relative(root, baseline.path)}`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: baseline as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error saving baseline: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "list_baselines",
+    {
+      title: "List Baselines",
+      description: "List the baseline profiles stored in a Git repository and show which one diff_flamegraph would use for a commit.",
+      inputSchema: z.object({
+        repoPath: z.string().describe("Path inside the Git repository"),
+        name: z.string().optional().describe("Only list baselines with this name (e.g. 'cpu')"),
+        commit: z.string().optional().default("HEAD").describe("Commit to select baselines for (default: HEAD)"),
+      }),
+    },
+    async ({ repoPath, name, commit = "HEAD" }): Promise<CallToolResult> => {
+      try {
+        const baselines = await listBaselines(repoPath, name);
+        const names = [...new Set(baselines.map((b) => b.name))].sort();
+        const selected = [];
+        for (const kind of names) {
+          const baseline = await selectBaseline(repoPath, kind, commit);
+          if (baseline) {
+            selected.push(baseline);
+          }
+        }
+
+        const lines = names.map((kind) => {
+          const chosen = selected.find((b) => b.name === kind);
+          const count = baselines.filter((b) => b.name === kind).length;
+          return `• ${kind}: ${count} baseline(s); ${chosen
+            ? `using ${chosen.commit.slice(0, 12)} (${describeSelection(chosen, commit)})`
+            : `none on the history of ${commit}`}`;
+        });
+        const text = baselines.length === 0
+          ? `No baselines found${name ? ` named '${name}'` : ""}. Save one with save_baseline.`
+          : `📌 Baselines (${baselines.length}):\n${lines.join("\n")}`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { baselines, selected } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error listing baselines: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
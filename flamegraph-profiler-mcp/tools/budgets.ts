@@ -0,0 +1,112 @@
+/**
+ * Checking captures against the performance budgets declared in a repository,
+ * or given inline as one-line rules.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import path from "node:path";
+import { z } from "zod";
+import { gitRoot, repoOfProfile } from "../lib/baselines.js";
+import {
+  BUDGETS_FILE,
+  checkBudgetRule,
+  checkBudgets,
+  formatBudgetResult,
+  formatBudgetRuleResult,
+  loadBudgets,
+  parseBudgetRule,
+  profileScenario,
+} from "../lib/budgets.js";
+import { resolveProfilePath } from "../lib/catalog.js";
+import { ownershipForProfile } from "../lib/owners.js";
+import { readProfile } from "../lib/pprof.js";
+
+export function registerBudgetTools(server: McpServer) {
+  server.registerTool(
+    "check_budgets",
+    {
+      title: "Check Performance Budgets",
+      description: `Evaluate a profile against the budgets in the repository's ${BUDGETS_FILE} (e.g. "pkg/parser ≤ 15% CPU under scenario checkout") and report each violation with the heaviest functions and their owners. Suitable as a CI gate: the result's 'passed' field is false if any budget is exceeded.`,
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file to check, or its catalog ID"),
+        repoPath: z.string().optional().describe(`Path inside the repository holding ${BUDGETS_FILE} (default: the repository of the profile's source files)`),
+        scenario: z.string().optional().describe("Scenario the profile was captured under; budgets for other scenarios are skipped (default: the profile's scenario tag)"),
+        budgetsPath: z.string().optional().describe(`Budgets file to use instead of ${BUDGETS_FILE} at the repository root`),
+      }),
+    },
+    async ({ profilePath, repoPath, scenario, budgetsPath }): Promise<CallToolResult> => {
+      try {
+        const profile = readProfile(await resolveProfilePath(profilePath));
+        let file = budgetsPath && path.resolve(budgetsPath);
+        if (!file) {
+          const repo = repoPath ?? (await repoOfProfile(profile));
+          if (!repo) {
+            throw new Error("The profile's sources are not in a Git repository; pass repoPath or budgetsPath");
+          }
+          file = path.join(await gitRoot(repo), BUDGETS_FILE);
+        }
+        const budgets = await loadBudgets(file);
+        const ownership = await ownershipForProfile(profile, repoPath);
+        const report = checkBudgets(profile, budgets, { file, scenario: scenario ?? profileScenario(profile), ownership });
+
+        const failed = report.results.filter((r) => !r.passed);
+        const header = report.passed
+          ? `✅ All ${report.results.length} budget(s) met`
+          : `❌ ${failed.length} of ${report.results.length} budget(s) exceeded`;
+        const text = `${header}${report.scenario ? ` for scenario ${report.scenario}` : ""}
+📁 ${file}
+
+${report.results.length > 0 ? [...failed, ...report.results.filter((r) => r.passed)].map(formatBudgetResult).join("\n") : "No budgets apply"}${report.skipped > 0 ? `\n\n⏭️ Skipped ${report.skipped} budget(s) for other scenarios` : ""}
+
+💡 Tip: ${report.passed ? "Tighten budgets that have a lot of headroom so regressions are caught early." : "Use list_source on the listed functions to see where the time goes, or raise the budget in the same change if the cost is intended."}`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: report as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error checking budgets: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "check_profile_budget",
+    {
+      title: "Check Profile Budget",
+      description: "Check a profile against budget rules given inline, one per line, and return pass or fail with every violation; a CI gate that needs no budgets file. A rule caps a package, a function glob or the total, as a share or an amount: \"encoding/json <= 10% cum\", \"function main.parse* < 5% flat\", \"total allocations <= 500MB\", \"total cpu <= 30s\". After the limit, cum or flat (default cum) and a sample type or alias (allocations, memory, objects, cpu) may follow. The result's 'passed' field is false if any rule is violated.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file to check, or its catalog ID"),
+        budgets: z.array(z.string()).min(1).describe("Budget rules, e.g. [\"encoding/json <= 10% cum\", \"total allocations <= 500MB\"]"),
+      }),
+    },
+    async ({ profilePath, budgets }): Promise<CallToolResult> => {
+      try {
+        const rules = budgets.map(parseBudgetRule);
+        const profile = readProfile(await resolveProfilePath(profilePath));
+        const results = rules.map((rule) => checkBudgetRule(profile, rule));
+        const violations = results.filter((r) => !r.passed);
+        const passed = violations.length === 0;
+        const text = `${passed ? `✅ PASS: all ${results.length} budget(s) met` : `❌ FAIL: ${violations.length} of ${results.length} budget(s) violated`} by ${profilePath}
+
+${[...violations, ...results.filter((r) => r.passed)].map(formatBudgetRuleResult).join("\n")}
+
+💡 Tip: ${passed ? "Keep these rules in CI so the next regression fails the build; check_budgets reads the same kind of limits from the repository's " + BUDGETS_FILE + "." : "Use list_source or function_detail on the listed functions to see where the cost comes from, or diff_flamegraph against the last passing profile."}`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { profile: profilePath, passed, results, violations } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error checking profile budget: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
@@ -0,0 +1,63 @@
+/**
+ * Profiling any Go main package, with no profiling flags of its own.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import path from "node:path";
+import { z } from "zod";
+import { buildAndProfile, formatRunProfile } from "../lib/build.js";
+import { checkCaptureSeconds } from "../lib/config.js";
+import { LANGS, t } from "../lib/i18n.js";
+import { duringWindow, progressReporter } from "../lib/progress.js";
+import { flamegraphLink } from "../lib/render.js";
+
+export function registerBuildTools(server: McpServer) {
+  server.registerTool(
+    "build_and_profile",
+    {
+      title: "Build and Profile",
+      description: "Build any Go main package (a directory, or a single .go file), run it with its own arguments and profile it for a set duration, then analyze each profile: top functions, anti-pattern findings, capture history and a catalog entry per profile. A profiling hook is added to the build with `go build -overlay`, so the program needs no -cpuprofile style flags and its sources are not changed. The program is stopped with SIGTERM once the profiles are written, so it must run at least that long.",
+      inputSchema: z.object({
+        packagePath: z.string().describe("Main package directory (e.g., './cmd/api') or a single .go file"),
+        args: z.array(z.string()).optional().default([]).describe("Command-line arguments for the program (e.g., ['-config', 'dev.yaml'])"),
+        duration: z.number().min(1).max(600).optional().default(10).describe("Seconds to profile from program start (default: 10)"),
+        profileTypes: z.array(z.enum(["cpu", "heap", "block", "mutex"])).min(1).optional().default(["cpu", "heap"]).describe("Profiles to write during the run (default: cpu and heap)"),
+        lang: z.enum(LANGS).optional().default("en").describe("Language of the report text (default: en); structured fields stay in English"),
+      }),
+    },
+    async ({ packagePath, args = [], duration = 10, profileTypes = ["cpu", "heap"], lang = "en" }, extra): Promise<CallToolResult> => {
+      try {
+        checkCaptureSeconds(duration);
+        const run = await duringWindow(progressReporter(extra), `building and profiling ${path.basename(packagePath)}`, duration,
+          buildAndProfile({ packagePath, args, duration, profileTypes: [...new Set(profileTypes)], signal: extra.signal }));
+        const findings = run.profiles.reduce((sum, p) => sum + p.findings.length, 0);
+        const command = [path.basename(run.package, ".go"), ...run.args].join(" ");
+        const summary = t(lang, "build.summary", {
+          command,
+          seconds: run.duration.toFixed(2),
+          commit: run.commit ? t(lang, "run.atCommit", { commit: run.commit.slice(0, 12) }) : "",
+          profiles: run.profiles.length,
+          findings,
+        });
+        const text = `${summary}
+
+${run.profiles.map((p) => formatRunProfile(p, lang)).join("\n\n")}
+${run.output.length > 0 ? `\n${t(lang, "run.output")}\n${run.output.slice(-5).join("\n")}\n` : ""}
+${t(lang, "build.tip")}`;
+        return {
+          content: [
+            { type: "text", text },
+            ...run.profiles.map((p) => flamegraphLink(p.profileId)),
+          ],
+          structuredContent: run as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error building and profiling: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
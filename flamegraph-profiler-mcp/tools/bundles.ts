@@ -0,0 +1,86 @@
+/**
+ * Moving capture sets between machines as bundle archives.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { exportBundle, importBundle } from "../lib/bundles.js";
+
+const labelsSchema = z.record(z.string(), z.string());
+
+function errorResult(error: unknown, action: string): CallToolResult {
+  const message = error instanceof Error ? error.message : "Unknown error";
+  return {
+    content: [{ type: "text", text: `Error ${action}: ${message}` }],
+    isError: true,
+  };
+}
+
+export function registerBundleTools(server: McpServer) {
+  server.registerTool(
+    "export_bundle",
+    {
+      title: "Export Bundle",
+      description: "Package a capture set into one zip archive that can move to another machine or be attached to a support ticket: the catalogued profiles with their metadata and capture history, the findings detected in them, a readable report.md, and a recipe (tool and arguments) for capturing each profile again. Choose the profiles by ID, or by target, type, labels and age like list_profiles.",
+      inputSchema: z.object({
+        profiles: z.array(z.string()).optional().describe("Catalog IDs of the profiles to bundle (default: every profile matching the filters)"),
+        target: z.string().optional().describe("Only profiles whose target contains this text"),
+        profileType: z.string().optional().describe("Only profiles of this type"),
+        labels: labelsSchema.optional().describe("Only profiles carrying all of these labels, e.g. {\"incident\": \"INC-42\"}"),
+        hours: z.number().min(0).optional().default(0).describe("Only profiles from the last N hours (default: 0, all)"),
+        name: z.string().optional().describe("Name of the bundle, shown in its report and given to imported profiles as the bundle label (default: bundle_<time>)"),
+        note: z.string().optional().describe("Note for whoever opens the bundle, e.g. what is being investigated"),
+        findings: z.boolean().optional().default(true).describe("Include the findings detected in these profiles (default: true)"),
+        outputPath: z.string().optional().describe("Where to write the archive (default: bundles/<name>.zip in the data directory)"),
+      }),
+    },
+    async ({ profiles, target, profileType, labels, hours = 0, name, note, findings = true, outputPath }): Promise<CallToolResult> => {
+      try {
+        const since = hours > 0 ? new Date(Date.now() - hours * 60 * 60 * 1000) : undefined;
+        const bundle = await exportBundle({ ids: profiles, filter: { target, profileType, labels, since }, name, note, findings, outputPath });
+        const { manifest } = bundle;
+        const recipes = manifest.profiles.filter((p) => p.recipe).length;
+        const text = `📦 Bundled ${manifest.profiles.length} profile(s) and ${manifest.findings.length} finding(s) as ${manifest.name}
+📁 ${bundle.path} (${Math.ceil(bundle.bytes / 1024)} KB)
+${manifest.profiles.map(({ entry, recipe }) => `• ${entry.id} ${entry.profileType} ${entry.target} at ${entry.at}${recipe ? ` (recapture: ${recipe.tool})` : ""}`).join("\n")}
+
+💡 Tip: Load it elsewhere with import_bundle. ${recipes < manifest.profiles.length ? "Profiles without a recipe came from outside this server and can only be re-imported. " : ""}Bundles hold profiles as captured; run redact_profile first when they leave your organization.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { path: bundle.path, bytes: bundle.bytes, manifest } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "exporting bundle");
+      }
+    },
+  );
+
+  server.registerTool(
+    "import_bundle",
+    {
+      title: "Import Bundle",
+      description: "Load a bundle made by export_bundle into the catalog: each profile gets a new ID and keeps its capture time, target, type, commit and labels, plus a bundle label; findings not already known here are added.",
+      inputSchema: z.object({
+        bundlePath: z.string().describe("Path to the bundle's zip archive"),
+        labels: labelsSchema.optional().default({}).describe("Labels to add to every imported profile, e.g. {\"ticket\": \"SUP-123\"}"),
+      }),
+    },
+    async ({ bundlePath, labels = {} }): Promise<CallToolResult> => {
+      try {
+        const result = await importBundle(bundlePath, labels);
+        const { manifest } = result;
+        const text = `📥 Imported bundle ${manifest.name} (made ${manifest.createdAt})${manifest.note ? `\n📝 ${manifest.note}` : ""}
+${result.entries.map((entry) => `• ${entry.id} ${entry.profileType} ${entry.target} at ${entry.at}`).join("\n")}
+📋 ${result.findings} of ${manifest.findings.length} finding(s) added${result.findings < manifest.findings.length ? "; the others were already known here" : ""}
+
+💡 Tip: Find these profiles again with list_profiles and labels {"bundle": "${manifest.name}"}.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { name: manifest.name, ids: result.ids, entries: result.entries, findings: result.findings } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "importing bundle");
+      }
+    },
+  );
+}
@@ -0,0 +1,308 @@
+/**
+ * Caller and callee structure of a profile: pprof-style call graphs as
+ * Graphviz DOT, SVG or PNG, the sandwich view of a single function, the
+ * frame tree itself as JSON for clients that draw their own views, the
+ * flamegraph as a text outline for clients that draw none, and as an
+ * interactive page for stacks too deep to read in a static one.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { z } from "zod";
+import { profileCommit } from "../lib/baselines.js";
+import { buildCallGraph, callGraphDot, callGraphSvg, describeCallGraph, renderDotPng } from "../lib/callgraph.js";
+import { isProfileId, resolveProfilePath } from "../lib/catalog.js";
+import { serverConfig } from "../lib/config.js";
+import { buildFlameTree, describeFlameTree, flameOutline, getMaxDepth, invertFlameTree, pruneFlameTree, type ProfileFrame } from "../lib/flamegraph.js";
+import { interactiveFlamegraph } from "../lib/interactive.js";
+import { formatValue, readProfile, sampleIndexOf } from "../lib/pprof.js";
+import { checkLayout, flamegraphUri, withRenderDefaults } from "../lib/render.js";
+import { closestFunctions, functionDetail } from "../lib/sandwich.js";
+import { frameLinker } from "../lib/sourcelinks.js";
+import { dataDir } from "../lib/store.js";
+import { applyFrameFilters, describeFrameFilters } from "../lib/transform.js";
+import { colorSchemeField, filterNote, frameFilterFields, layoutFields } from "./filters.js";
+
+// Indented tree below a root, each line with its value and share of the root
+function formatTree(root: ProfileFrame, unit: string, emptyNote: string): string {
+  const lines: string[] = [];
+  const visit = (frame: ProfileFrame, indent: string) => {
+    for (const child of frame.children ?? []) {
+      lines.push(`${indent}${child.name}: ${formatValue(child.value, unit)} (${Math.round((child.value / root.value) * 1000) / 10}%)`);
+      visit(child, `${indent}  `);
+    }
+  };
+  visit(root, "  ");
+  return lines.length > 0 ? lines.join("\n") : `  ${emptyNote}`;
+}
+
+export function registerCallGraphTools(server: McpServer) {
+  server.registerTool(
+    "export_callgraph",
+    {
+      title: "Export Call Graph",
+      description: "Build a pprof-style call graph of a profile: one node per function sized by flat value and shaded by cumulative share, one edge per caller → callee weighted by the samples through it, pruned by node and edge thresholds. Recursive hotspots like fibonacci show as a single node with a loop. Returns Graphviz DOT, an SVG laid out by the server (no Graphviz needed) or a PNG rendered by Graphviz's dot.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file, or its catalog ID"),
+        format: z.enum(["dot", "svg", "png"]).optional().default("dot").describe("'dot' for Graphviz source (default), 'svg' laid out without Graphviz, 'png' rendered by Graphviz (dot must be on PATH)"),
+        outputPath: z.string().optional().describe("Also write the graph to this file"),
+        sampleType: z.string().optional().describe("Sample type to graph (default: the profile's default type)"),
+        nodeFraction: z.number().min(0).max(1).optional().default(0.005).describe("Drop functions whose cumulative share is below this fraction, like pprof -nodefraction (default: 0.005)"),
+        edgeFraction: z.number().min(0).max(1).optional().default(0.001).describe("Drop edges whose share is below this fraction, like pprof -edgefraction (default: 0.001)"),
+        nodeCount: z.number().int().min(1).max(500).optional().default(80).describe("Keep at most this many functions, by cumulative value, like pprof -nodecount (default: 80)"),
+        accessibility: z.boolean().optional().describe("Also list every function and call of the graph as text, for screen readers (default: the server config's, else false)"),
+        ...frameFilterFields,
+      }),
+    },
+    async ({ profilePath, format = "dot", outputPath, sampleType, nodeFraction = 0.005, edgeFraction = 0.001, nodeCount = 80, accessibility, ...filters }): Promise<CallToolResult> => {
+      try {
+        const profile = applyFrameFilters(readProfile(await resolveProfilePath(profilePath)), filters);
+        const graph = buildCallGraph(profile, sampleIndexOf(profile, sampleType), { nodeFraction, edgeFraction, nodeCount });
+        if (graph.nodes.length === 0) {
+          throw new Error("No functions left after pruning; lower nodeFraction or check the filters");
+        }
+        const title = path.basename(profilePath);
+        const dot = callGraphDot(graph, title);
+        const svg = format === "svg" ? callGraphSvg(graph, title) : undefined;
+        const png = format === "png" ? await renderDotPng(dot) : undefined;
+        if (outputPath) {
+          await fs.writeFile(path.resolve(outputPath), png ?? svg ?? dot);
+        }
+
+        const asText = accessibility ?? serverConfig().render.accessibility;
+        const hottest = graph.edges.filter((e) => e.from !== e.to).slice(0, 5)
+          .map((e, i) => `${i + 1}. ${e.from} → ${e.to}: ${e.pct}%`);
+        const recursive = graph.edges.filter((e) => e.from === e.to).map((e) => e.from);
+        const text = `🕸️ Call graph of ${title} (${graph.sampleType})${filterNote(filters)}: ${graph.nodes.length} function(s) and ${graph.edges.length} edge(s) shown, ${graph.droppedNodes} function(s) and ${graph.droppedEdges} edge(s) pruned
+${hottest.length > 0 ? `\n🔥 Heaviest Calls:\n${hottest.join("\n")}\n` : ""}${recursive.length > 0 ? `\n🔁 Recursive: ${recursive.join(", ")}\n` : ""}
+${asText ? `♿ Call graph as text:\n${describeCallGraph(graph).join("\n")}\n\n` : ""}${outputPath ? `📁 Wrote ${path.resolve(outputPath)}` : format === "dot" ? "📄 DOT follows; render it with `dot -Tsvg`" : `🖼️ ${format.toUpperCase()} attached`}
+💡 Tip: Dotted edges pass through pruned functions. Raise nodeFraction or lower nodeCount to simplify a busy graph.`;
+        return {
+          content: [
+            { type: "text", text },
+            ...(format === "dot" && !outputPath ? [{ type: "text" as const, text: dot }] : []),
+            ...(svg ? [{ type: "image" as const, data: Buffer.from(svg).toString("base64"), mimeType: "image/svg+xml" }] : []),
+            ...(png ? [{ type: "image" as const, data: png.toString("base64"), mimeType: "image/png" }] : []),
+          ],
+          structuredContent: { ...graph, dot } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error exporting call graph: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+  server.registerTool(
+    "function_detail",
+    {
+      title: "Function Detail",
+      description: "Sandwich view of one function: its flat (self) and cumulative values, the callers above it merged across every path that reaches it, and the callees below it that its time goes to. Answers \"who calls generateRandomString, and what does it spend its time in?\" without reading the whole flamegraph.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file, or its catalog ID"),
+        function: z.string().describe("Function name as shown in flamegraphs and top functions, e.g. 'main.generateRandomString'"),
+        sampleType: z.string().optional().describe("Sample type to break down (default: the profile's default type)"),
+        depth: z.number().int().min(1).max(20).optional().default(4).describe("Levels of callers and callees to show (default: 4)"),
+        minFraction: z.number().min(0).max(1).optional().default(0.01).describe("Leave out callers and callees below this fraction of the function's cumulative value (default: 0.01)"),
+        ...frameFilterFields,
+      }),
+    },
+    async ({ profilePath, function: name, sampleType, depth = 4, minFraction = 0.01, ...filters }): Promise<CallToolResult> => {
+      try {
+        const profile = applyFrameFilters(readProfile(await resolveProfilePath(profilePath)), filters);
+        const sampleIndex = sampleIndexOf(profile, sampleType);
+        const detail = functionDetail(profile, sampleIndex, name, { depth, minFraction });
+        if (!detail) {
+          const similar = closestFunctions(profile, sampleIndex, name.slice(name.lastIndexOf(".") + 1));
+          throw new Error(`${name} does not appear in the profile${similar.length > 0 ? `; similar: ${similar.join(", ")}` : ""}`);
+        }
+        const amount = (value: number) => formatValue(value, detail.unit);
+        const text = `🥪 ${detail.name} (${detail.sampleType})${filterNote(filters)}
+Flat: ${amount(detail.flat)} (${detail.flatPct}%) · Cumulative: ${amount(detail.cum)} (${detail.cumPct}%)
+
+⬆️ Callers (immediate caller first, share of its cumulative value):
+${formatTree(detail.callers, detail.unit, "none: it is a root of every stack")}
+
+⬇️ Callees (where its time goes):
+  (self): ${amount(detail.flat)} (${Math.round((detail.flat / detail.cum) * 1000) / 10}%)
+${formatTree(detail.callees, detail.unit, "none: all of its time is its own")}
+
+💡 Tip: Use list_source with this function to see which of its lines are expensive.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: detail as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error getting function detail: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+  server.registerTool(
+    "get_tree",
+    {
+      title: "Get Frame Tree",
+      description: "Read the frame tree behind a profile's flamegraph as JSON: each frame with its name, value (cumulative), self value and children, heaviest first, cut to a depth and a minimum share of the total. For clients that draw their own visualizations or run their own analyses instead of asking for another render format.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file, or its catalog ID"),
+        sampleType: z.string().optional().describe("Sample type to weight frames by (default: the profile's default type)"),
+        depth: z.number().int().min(1).max(200).optional().default(12).describe("Levels below the root to return (default: 12)"),
+        threshold: z.number().min(0).max(1).optional().default(0.001).describe("Leave out frames below this fraction of the total, with everything under them (default: 0.001)"),
+        inverted: layoutFields.inverted,
+        ...frameFilterFields,
+      }),
+    },
+    async ({ profilePath, sampleType, depth = 12, threshold = 0.001, inverted, ...filters }): Promise<CallToolResult> => {
+      try {
+        const profile = applyFrameFilters(readProfile(await resolveProfilePath(profilePath)), filters);
+        const sampleIndex = sampleIndexOf(profile, sampleType);
+        const { type, unit } = profile.sampleTypes[sampleIndex];
+        const built = buildFlameTree(profile, sampleIndex);
+        const full = inverted ? invertFlameTree(built) : built;
+        const tree = pruneFlameTree(full, { maxDepth: depth, minFraction: threshold });
+        const result = {
+          profile: profilePath,
+          sampleType: type,
+          unit,
+          total: full.value,
+          inverted: inverted ?? false,
+          depth: getMaxDepth(full),
+          nodes: tree.nodes,
+          pruned: tree.pruned,
+          root: tree.root,
+        };
+        const text = `🌳 Frame tree of ${path.basename(profilePath)} (${type}${inverted ? ", inverted" : ""})${filterNote(filters)}: ${tree.nodes} frame(s) within ${depth} level(s) and ${Math.round(threshold * 10000) / 100}% of ${formatValue(full.value, unit)}, ${tree.pruned} subtree(s) cut; the full tree is ${result.depth} level(s) deep
+💡 Tip: The JSON follows and is also the structured result. A frame's value minus its self value and its children's values is what was cut below it.`;
+        return {
+          content: [
+            { type: "text", text },
+            { type: "text", text: JSON.stringify(result) },
+          ],
+          structuredContent: result as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error getting frame tree: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "flame_outline",
+    {
+      title: "Flame Outline",
+      description: "Draw a profile's flamegraph as text, for terminals and chat clients that cannot show images: one line per frame, indented by depth, with a bar of Unicode block characters spanning the frame's place in the graph, so widths keep their proportions and callees sit under their callers as in the picture.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file, or its catalog ID"),
+        sampleType: z.string().optional().describe("Sample type to weight frames by (default: the profile's default type)"),
+        width: z.number().int().min(20).max(200).optional().default(60).describe("Columns of the whole graph's bar (default: 60)"),
+        maxLines: z.number().int().min(1).max(500).optional().default(40).describe("Frames to draw at most, hottest paths first (default: 40)"),
+        minFraction: z.number().min(0).max(1).optional().default(0.01).describe("Leave out frames below this fraction of the total (default: 0.01)"),
+        inverted: layoutFields.inverted,
+        ...frameFilterFields,
+      }),
+    },
+    async ({ profilePath, sampleType, width = 60, maxLines = 40, minFraction = 0.01, inverted, ...filters }): Promise<CallToolResult> => {
+      try {
+        const profile = applyFrameFilters(readProfile(await resolveProfilePath(profilePath)), filters);
+        const sampleIndex = sampleIndexOf(profile, sampleType);
+        const { type, unit } = profile.sampleTypes[sampleIndex];
+        const built = buildFlameTree(profile, sampleIndex);
+        const tree = inverted ? invertFlameTree(built) : built;
+        const lines = flameOutline(tree, {
+          width,
+          maxLines,
+          minFraction,
+          formatValue: (v) => (unit === "count" ? String(v) : formatValue(v, unit)),
+        });
+        const text = `🔥 Flamegraph of ${path.basename(profilePath)} (${type}${inverted ? ", inverted" : ""})${filterNote(filters)}:
+
+\`\`\`text
+${lines.join("\n")}
+\`\`\`
+
+💡 Tip: Narrow it with focus or hide, or widen it with width; the same outline is the flamegraph resource's format=outline.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { profile: profilePath, sampleType: type, unit, total: tree.value, lines } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error drawing flame outline: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "export_interactive_flamegraph",
+    {
+      title: "Export Interactive Flamegraph",
+      description: "Write a profile's flamegraph as a self-contained interactive HTML page drawn with d3-flame-graph, its scripts inlined so it opens offline: click a frame to zoom into it, search functions by regex to highlight them and see their share of the total, hover for values. For deep stacks like dataProcessingPipeline's, whose labels a static SVG has no room for. Catalogued profiles are also served as the flamegraph resource with format=interactive.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file, or its catalog ID"),
+        sampleType: z.string().optional().describe("Sample type to weight frames by (default: the profile's default type)"),
+        outputPath: z.string().optional().describe("Where to write the page (default: flamegraphs/<profile>.html in the data directory)"),
+        ...colorSchemeField,
+        ...layoutFields,
+        ...frameFilterFields,
+      }),
+    },
+    async ({ profilePath, sampleType, outputPath, colorScheme, orientation, inverted, accessibility, ...filters }): Promise<CallToolResult> => {
+      try {
+        const layout = withRenderDefaults({ color: colorScheme, orientation, inverted, accessibility });
+        checkLayout(layout);
+        const profile = applyFrameFilters(readProfile(await resolveProfilePath(profilePath)), filters);
+        const sampleIndex = sampleIndexOf(profile, sampleType);
+        const { type, unit } = profile.sampleTypes[sampleIndex];
+        const built = buildFlameTree(profile, sampleIndex);
+        const tree = layout.inverted ? invertFlameTree(built) : built;
+        const formatFrameValue = (v: number) => (unit === "count" ? String(v) : formatValue(v, unit));
+        const filtered = describeFrameFilters(filters);
+        const name = path.basename(profilePath).replace(/\.pb(\.gz)?$/, "");
+        const linker = frameLinker(profile, sampleIndex, serverConfig().sources, { commit: profileCommit(profile), sourceRoot: process.env.PROFILER_SOURCE_ROOT });
+        const html = interactiveFlamegraph(tree, {
+          title: `${name} · ${type}${layout.inverted ? " · inverted" : ""}${filtered ? ` · ${filtered}` : ""}`,
+          formatValue: formatFrameValue,
+          colorScheme: layout.color,
+          orientation: layout.orientation,
+          accessibility: layout.accessibility,
+          description: layout.accessibility ? describeFlameTree(tree, { formatValue: formatFrameValue }).join("\n") : undefined,
+          link: linker && ((frame) => linker(frame.name)),
+        });
+        const output = path.resolve(outputPath ?? path.join(dataDir(), "flamegraphs", `${name.replace(/[^\w.-]+/g, "-")}.html`));
+        await fs.mkdir(path.dirname(output), { recursive: true });
+        await fs.writeFile(output, html);
+        const uri = isProfileId(profilePath) ? flamegraphUri(profilePath, { ...filters, ...layout, view: sampleType, format: "interactive" }) : undefined;
+        const text = `🔥 Interactive flamegraph of ${path.basename(profilePath)} (${type}${layout.inverted ? ", inverted" : ""})${filterNote(filters)}: ${getMaxDepth(tree)} level(s) deep, ${formatFrameValue(tree.value)} in total
+📁 Wrote ${output} (${Math.round(Buffer.byteLength(html) / 1024)} kB, no network needed to open it)${uri ? `\n🔗 ${uri}` : ""}
+
+💡 Tip: Open it in a browser, search for a function such as dataProcessingPipeline and click its frame to zoom in; Reset zoom goes back to the whole profile.`;
+        return {
+          content: [
+            { type: "text", text },
+            ...(uri ? [{ type: "resource_link" as const, uri, name: `${profilePath} interactive flamegraph`, mimeType: "text/html" }] : []),
+          ],
+          structuredContent: { profile: profilePath, sampleType: type, unit, total: tree.value, path: output, ...(uri ? { uri } : {}) } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error exporting interactive flamegraph: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
@@ -0,0 +1,115 @@
+/**
+ * Capacity planning from the CPU cost of a request.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import path from "node:path";
+import { z } from "zod";
+import { capacityAssumptions, estimateCapacity, type CapacityInput } from "../lib/capacity.js";
+import { resolveProfilePath } from "../lib/catalog.js";
+import { formatValue, readProfile, sampleIndexOf, toBaseUnit, totalOf } from "../lib/pprof.js";
+import { requestsOf, routeRequestsOf } from "../lib/rates.js";
+import { routeCosts } from "../lib/routecost.js";
+import { SLO_PERCENTILES } from "../lib/slo.js";
+
+// CPU seconds per request from a CPU profile and the requests it covers: the
+// whole process's, or one route's with the CPU no route is labelled with
+// (GC, the runtime, background work) spread over every route in proportion
+async function cpuCostOf(
+  profilePath: string,
+  requests: number | undefined,
+  route: string | undefined,
+  routeLabel: string,
+): Promise<{ seconds: number; source: string }> {
+  const profile = readProfile(await resolveProfilePath(profilePath));
+  const name = path.basename(profilePath);
+  if (route) {
+    const count = requests ?? (await routeRequestsOf(profilePath))[route];
+    const report = routeCosts({ cpu: { profile, requests: count ? { [route]: count } : {} }, routeLabel });
+    const cost = report.routes.find((r) => r.route === route);
+    if (!cost) {
+      throw new Error(`No samples in ${name} carry ${routeLabel}=${route} (routes: ${report.routes.map((r) => r.route).join(", ") || "none"})`);
+    }
+    if (cost.cpuNsPerRequest === undefined) {
+      throw new Error(`No request count for ${route} in ${name}; pass requests, or capture it with capture_route_costs`);
+    }
+    const overhead = 1 / (1 - (report.unlabeledCpuPct ?? 0) / 100);
+    return {
+      seconds: (cost.cpuNsPerRequest / 1e9) * overhead,
+      source: `${route} in ${name}: ${formatValue(cost.cpuNsPerRequest, "nanoseconds")} over ${cost.cpuRequests} request(s), plus its share of the ${report.unlabeledCpuPct}% of CPU no route is labelled with`,
+    };
+  }
+  const count = requests ?? (await requestsOf(profilePath));
+  if (!count) {
+    throw new Error(`No request count for ${name}; pass requests, label it requests=<count> with tag_profile, or capture from a target that counts them with pkg/requests`);
+  }
+  const index = sampleIndexOf(profile, "cpu");
+  const total = toBaseUnit(totalOf(profile, index), profile.sampleTypes[index].unit);
+  return { seconds: total / count, source: `${name}: ${formatValue(total, "seconds")} of CPU over ${count} request(s), GC and runtime work included` };
+}
+
+export function registerCapacityTools(server: McpServer) {
+  server.registerTool(
+    "estimate_capacity",
+    {
+      title: "Estimate Capacity",
+      description: "Estimate how many requests per second one instance sustains and how many replicas a peak rate needs, from the CPU one request costs (measured from a CPU profile and the requests it covers, for the whole process or one route, or given directly), the cores each instance has, and optionally a latency SLO. Each instance is modelled as a queue with one server per core (M/M/c, Erlang C): the highest rate whose queueing keeps the SLO percentile within target and CPU under the utilization cap. The assumptions behind the numbers are listed with them.",
+      inputSchema: z.object({
+        cores: z.number().positive().describe("Cores available to each instance (GOMAXPROCS, or the container's CPU limit)"),
+        profilePath: z.string().optional().describe("CPU profile to measure the cost per request from, as a path or catalog ID"),
+        requests: z.number().positive().optional().describe("Requests the profile covers, or the route's with route (default: the profile's requests or requests:<route> catalog label)"),
+        route: z.string().optional().describe("Plan for one route's cost per request, from a route-labelled profile (see route_costs), instead of the process's average"),
+        routeLabel: z.string().optional().default("route").describe("pprof label key holding the route (default: 'route')"),
+        cpuMsPerRequest: z.number().positive().optional().describe("CPU milliseconds one request costs, instead of measuring it from a profile"),
+        targetLatencyMs: z.number().positive().optional().describe("Latency SLO target in milliseconds, e.g. 200"),
+        percentile: z.enum(SLO_PERCENTILES).optional().default("p99").describe("Percentile the latency target applies to (default: p99)"),
+        offCpuMs: z.number().min(0).optional().default(0).describe("Milliseconds a request spends off CPU, waiting on I/O or downstream calls, which count toward latency (default: 0)"),
+        maxUtilization: z.number().positive().max(1).optional().default(0.8).describe("Highest share of the cores to plan for, leaving headroom (default: 0.8)"),
+        peakRps: z.number().positive().optional().describe("Peak requests per second across all instances, to size the replica count"),
+      }),
+    },
+    async ({ cores, profilePath, requests, route, routeLabel = "route", cpuMsPerRequest, targetLatencyMs, percentile = "p99", offCpuMs = 0, maxUtilization = 0.8, peakRps }): Promise<CallToolResult> => {
+      try {
+        if ((profilePath === undefined) === (cpuMsPerRequest === undefined)) {
+          throw new Error("Pass either a CPU profile (profilePath) to measure the cost per request, or cpuMsPerRequest");
+        }
+        const cost = profilePath
+          ? await cpuCostOf(profilePath, requests, route, routeLabel)
+          : { seconds: cpuMsPerRequest! / 1000, source: "as given" };
+        const input: CapacityInput = {
+          cpuSecondsPerRequest: cost.seconds,
+          cores,
+          maxUtilization,
+          slo: targetLatencyMs !== undefined ? { targetSeconds: targetLatencyMs / 1000, percentile, offCpuSeconds: offCpuMs / 1000 } : undefined,
+          peakRps,
+        };
+        const estimate = estimateCapacity(input);
+        const assumptions = capacityAssumptions(input, cost.source);
+        const seconds = (value: number) => formatValue(value, "seconds");
+        const { latency } = estimate;
+        const bound = estimate.boundBy === "slo"
+          ? `the ${percentile} ≤ ${seconds(input.slo!.targetSeconds)} SLO`
+          : `the ${Math.round(maxUtilization * 100)}% utilization cap${latency ? `, with the SLO met (${percentile} ≈ ${seconds(latency.total)})` : ""}`;
+        const text = `📐 Capacity estimate: ${cores} core(s) per instance, ${seconds(cost.seconds)} of CPU per request${route ? ` on ${route}` : ""}
+
+🚀 Max sustainable: ${estimate.maxRps} req/s per instance at ${estimate.utilizationPct}% CPU, bound by ${bound}
+${latency ? `   ${percentile} at that rate ≈ ${seconds(latency.total)}: ${seconds(latency.cpu)} on CPU + ${seconds(latency.offCpu)} off CPU + ${seconds(latency.queueing)} waiting for a core\n` : ""}   CPU ceiling: ${estimate.cpuCeilingRps} req/s with every core busy
+${estimate.replicas !== undefined ? `📦 Peak of ${peakRps} req/s: ${estimate.replicas} replica(s), ${estimate.replicasWithSpare} to ride out losing one\n` : ""}
+📝 Assumptions:
+${assumptions.map((a) => `- ${a}`).join("\n")}
+
+💡 Tip: ${profilePath ? "The cost per request holds for the CPU model the profile was captured on; re-measure before planning for different hardware. " : ""}Check the estimate with a load test at ${Math.round(estimate.maxRps)} req/s per instance, and watch real latencies with check_slo.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { ...estimate, source: cost.source, assumptions } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error estimating capacity: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
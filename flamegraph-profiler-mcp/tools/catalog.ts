@@ -0,0 +1,361 @@
+/**
+ * The profile catalog: referring to earlier captures by ID.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { z } from "zod";
+import { deleteProfile, getProfile, listProfiles, mergeIntoCatalog, resolveProfilePath, tagProfile, type CatalogEntry } from "../lib/catalog.js";
+import { IMPORT_FORMATS, importExport } from "../lib/importers.js";
+import { readProfile, sampleIndexOf } from "../lib/pprof.js";
+import { redactIntoCatalog, redactProfile, type RedactChangeKind } from "../lib/redact.js";
+import { flamegraphLink, flamegraphUri } from "../lib/render.js";
+import { symbolizeIntoCatalog } from "../lib/symbolize.js";
+import { topReport } from "../lib/top.js";
+
+const labelsSchema = z.record(z.string(), z.string());
+
+// What redact_profile and preview_redaction strip
+const redactFields = {
+  labels: z.array(z.string()).optional().default([]).describe("Sample label keys whose values to redact, e.g. [\"user_id\", \"tenant\"], or [\"*\"] for every label (default: none)"),
+  paths: z.boolean().optional().default(true).describe("Trim absolute source and binary paths (default: true)"),
+  usernames: z.boolean().optional().default(true).describe("Replace home directories in frame names, paths, comments and label values with ~ (default: true)"),
+  buildIds: z.boolean().optional().default(true).describe("Clear the mappings' build IDs (default: true)"),
+};
+
+const CHANGE_HEADINGS: Record<RedactChangeKind, string> = {
+  frame: "🧩 Frame names",
+  file: "📁 Source paths",
+  mapping: "📦 Binary paths",
+  buildId: "🆔 Build IDs",
+  comment: "💬 Comments",
+  label: "🏷️ Label values",
+};
+
+function formatLabels(labels: Record<string, string>): string {
+  const pairs = Object.entries(labels).map(([key, value]) => `${key}=${value}`);
+  return pairs.length > 0 ? ` [${pairs.join(", ")}]` : "";
+}
+
+function formatEntry(entry: CatalogEntry): string {
+  return `• ${entry.id} ${entry.profileType} ${entry.target} at ${entry.at}${entry.commit ? ` (${entry.commit.slice(0, 12)})` : ""}${formatLabels(entry.labels)}`;
+}
+
+function entryResult(entry: CatalogEntry, message: string): CallToolResult {
+  return {
+    content: [{ type: "text", text: message }],
+    structuredContent: entry as unknown as Record<string, unknown>,
+  };
+}
+
+function errorResult(error: unknown, action: string): CallToolResult {
+  const message = error instanceof Error ? error.message : "Unknown error";
+  return {
+    content: [{ type: "text", text: `Error ${action}: ${message}` }],
+    isError: true,
+  };
+}
+
+const IMPORT_DESCRIPTIONS: Record<string, string> = {
+  archive: "archive",
+  flamebearer: "flamebearer export",
+  perf: "perf script output",
+  collapsed: "collapsed stacks",
+};
+
+export function registerCatalogTools(server: McpServer) {
+  server.registerTool(
+    "list_profiles",
+    {
+      title: "List Profiles",
+      description: "List the profiles in the catalog, newest first. Every profile captured by this server or imported with import_profile has an ID (p_…) that tools taking a profile path accept instead of the path.",
+      inputSchema: z.object({
+        target: z.string().optional().describe("Only profiles whose target contains this text (e.g. 'docker:api' or 'main.go')"),
+        profileType: z.string().optional().describe("Only profiles of this type: 'cpu', 'heap', 'block', 'mutex' or 'goroutine'"),
+        labels: labelsSchema.optional().describe("Only profiles carrying all of these labels, e.g. {\"release\": \"v1.4\"}"),
+        hours: z.number().min(0).optional().default(0).describe("Only profiles from the last N hours (default: 0, all)"),
+        limit: z.number().int().min(1).optional().default(20).describe("Number of profiles to return (default: 20)"),
+      }),
+    },
+    async ({ target, profileType, labels, hours = 0, limit = 20 }): Promise<CallToolResult> => {
+      try {
+        const since = hours > 0 ? new Date(Date.now() - hours * 60 * 60 * 1000) : undefined;
+        const all = await listProfiles({ target, profileType, labels, since });
+        const profiles = all.slice(0, limit);
+        const text = `📚 ${all.length} profile(s)${all.length > profiles.length ? `, showing the newest ${profiles.length}` : ""}:
+${profiles.length > 0 ? profiles.map(formatEntry).join("\n") : "None"}
+
+💡 Tip: Pass an ID to top_functions, list_source or diff_flamegraph, or label it with tag_profile.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { total: all.length, profiles } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "listing profiles");
+      }
+    },
+  );
+
+  server.registerTool(
+    "get_profile",
+    {
+      title: "Get Profile",
+      description: "Show a catalogued profile: where and when it was captured, its labels and stored path, and its top functions.",
+      inputSchema: z.object({
+        id: z.string().describe("Profile ID from list_profiles"),
+      }),
+    },
+    async ({ id }): Promise<CallToolResult> => {
+      try {
+        const entry = await getProfile(id);
+        const profile = readProfile(entry.path);
+        const report = topReport(profile, sampleIndexOf(profile), 5);
+        const text = `📄 ${entry.id}: ${entry.profileType} profile of ${entry.target}
+🕒 ${entry.at}${entry.commit ? `, commit ${entry.commit.slice(0, 12)}` : ""}
+🏷️ Labels:${formatLabels(entry.labels) || " none"}
+📁 ${entry.path}${entry.importedFrom ? ` (imported from ${entry.importedFrom})` : ""}${entry.pushedBy ? ` (pushed by ${entry.pushedBy})` : ""}${entry.symbolizedFrom ? ` (symbolized from ${entry.symbolizedFrom})` : ""}${entry.redactedFrom ? ` (redacted from ${entry.redactedFrom})` : ""}
+🖼️ Flamegraph: ${flamegraphUri(entry.id)}
+
+${report.summary}
+${report.functions.map((f, i) => `${i + 1}. ${f.name} (${f.flatPct}%)`).join("\n")}`;
+        return {
+          content: [{ type: "text", text }, flamegraphLink(entry.id)],
+          structuredContent: { ...entry, top: report } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "getting profile");
+      }
+    },
+  );
+
+  server.registerTool(
+    "tag_profile",
+    {
+      title: "Tag Profile",
+      description: "Set or remove labels on a catalogued profile, e.g. release=v1.4 or note=before-cache-fix, so it can be found again with list_profiles.",
+      inputSchema: z.object({
+        id: z.string().describe("Profile ID from list_profiles"),
+        labels: labelsSchema.optional().default({}).describe("Labels to set, e.g. {\"release\": \"v1.4\"}"),
+        remove: z.array(z.string()).optional().default([]).describe("Label keys to remove"),
+      }),
+    },
+    async ({ id, labels = {}, remove = [] }): Promise<CallToolResult> => {
+      try {
+        const entry = await tagProfile(id, labels, remove);
+        return entryResult(entry, `🏷️ ${entry.id} labels:${formatLabels(entry.labels) || " none"}`);
+      } catch (error) {
+        return errorResult(error, "tagging profile");
+      }
+    },
+  );
+
+  server.registerTool(
+    "delete_profile",
+    {
+      title: "Delete Profile",
+      description: "Remove a profile from the catalog and delete its stored file. The capture history used for trends is kept.",
+      inputSchema: z.object({
+        id: z.string().describe("Profile ID from list_profiles"),
+      }),
+    },
+    async ({ id }): Promise<CallToolResult> => {
+      try {
+        const entry = await deleteProfile(id);
+        return entryResult(entry, `🗑️ Deleted ${entry.id} (${entry.profileType} profile of ${entry.target})`);
+      } catch (error) {
+        return errorResult(error, "deleting profile");
+      }
+    },
+  );
+
+  server.registerTool(
+    "import_profile",
+    {
+      title: "Import Profile",
+      description: "Copy a profile captured elsewhere (CI, production, a colleague) into the catalog so it gets an ID and labels like the server's own captures. Besides pprof files, takes the exports of other continuous profilers: Pyroscope's flamebearer JSON and zip archives of pprof files as Datadog and Parca download them, which import as one entry per profile. Programs in other languages come in as Linux `perf script` output or collapsed stacks (from stackcollapse-perf.pl, py-spy, rbspy or async-profiler), so their flamegraphs render and diff like Go profiles.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file, flamebearer JSON, zip archive, perf script output or collapsed stacks"),
+        format: z.enum(IMPORT_FORMATS).optional().default("auto").describe("Format of the file: 'pprof', 'archive' (zip of pprof files), 'flamebearer' (Pyroscope JSON), 'perf' (`perf script` output), 'collapsed' (\"a;b;c 42\" lines) or 'auto' to detect it from the content (default: auto)"),
+        target: z.string().optional().describe("What was profiled, e.g. a service name (default: the file's path)"),
+        profileType: z.string().optional().describe("Profile type (default: detected from the sample types)"),
+        labels: labelsSchema.optional().describe("Labels to attach, e.g. {\"env\": \"prod\"}"),
+        frequency: z.number().positive().optional().describe("Sampling frequency in Hz of perf or collapsed stacks (e.g. 99 for perf record -F 99), to count their samples as CPU time"),
+      }),
+    },
+    async ({ profilePath, format = "auto", target, profileType, labels, frequency }): Promise<CallToolResult> => {
+      try {
+        const result = await importExport(profilePath, { format, target, profileType, labels, frequency });
+        if (result.format === "pprof") {
+          const [entry] = result.entries;
+          return entryResult(entry, `📥 Imported ${entry.importedFrom} as ${entry.id} (${entry.profileType})${formatLabels(entry.labels)}`);
+        }
+        const text = `📥 Imported ${result.entries.length} profile(s) from the ${IMPORT_DESCRIPTIONS[result.format]} ${path.resolve(profilePath)}:
+${result.entries.map(formatEntry).join("\n")}${result.skipped.length > 0 ? `\n\nSkipped files that are not pprof profiles: ${result.skipped.join(", ")}` : ""}
+
+💡 Tip: Compare an imported profile with one of your own captures using diff_flamegraph.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: result as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "importing profile");
+      }
+    },
+  );
+
+  server.registerTool(
+    "merge_profiles",
+    {
+      title: "Merge Profiles",
+      description: "Merge several pprof profiles of the same type into one, summing the samples of identical stacks and unifying mappings, like `pprof -proto a b c`. Useful for bursty workloads: capture a few short profiles and analyze them as a single flamegraph. The merged profile is catalogued with its own ID.",
+      inputSchema: z.object({
+        profiles: z.array(z.string()).min(2).describe("Profiles to merge, as catalog IDs or paths; all must have the same sample types"),
+        target: z.string().optional().describe("Target to catalog the merged profile under (default: the inputs' common target, else 'merged')"),
+        labels: labelsSchema.optional().describe("Labels to attach to the merged profile, e.g. {\"note\": \"burst\"}"),
+        outputPath: z.string().optional().describe("Also write the merged profile to this path"),
+      }),
+    },
+    async ({ profiles, target, labels, outputPath }): Promise<CallToolResult> => {
+      try {
+        const { entry, profile } = await mergeIntoCatalog(profiles, { target, labels });
+        if (outputPath) {
+          await fs.copyFile(entry.path, path.resolve(outputPath));
+        }
+        const report = topReport(profile, sampleIndexOf(profile), 5);
+        const text = `🧩 Merged ${profiles.length} profiles into ${entry.id} (${entry.profileType} profile of ${entry.target}${profile.durationSeconds ? `, ${Math.round(profile.durationSeconds * 10) / 10}s captured` : ""})${formatLabels(entry.labels)}
+📁 ${entry.path}${outputPath ? `, copied to ${path.resolve(outputPath)}` : ""}
+🖼️ Flamegraph: ${flamegraphUri(entry.id)}
+
+${report.summary}
+${report.functions.map((f, i) => `${i + 1}. ${f.name} (${f.flatPct}%)`).join("\n")}
+
+💡 Tip: Pass ${entry.id} to top_functions, list_source or diff_flamegraph like any other profile.`;
+        return {
+          content: [{ type: "text", text }, flamegraphLink(entry.id)],
+          structuredContent: { ...entry, top: report } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "merging profiles");
+      }
+    },
+  );
+
+  server.registerTool(
+    "symbolize_profile",
+    {
+      title: "Symbolize Profile",
+      description: "Resolve a profile whose frames are bare hex addresses, as captured from stripped release builds or external binaries, to function names, files and lines using the unstripped binary or its separate debug-info file (addr2line, falling back to the Go symbol table). Position-independent binaries are handled through the mapping's offset. The build IDs must match unless forced. Without a binary, native frames of cgo code and shared libraries are resolved from the files the profile mapped, where they exist on this machine (DWARF, then ELF symbol tables). The symbolized profile is catalogued with its own ID, ready to render.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Catalog ID or path of the unsymbolized profile"),
+        binaryPath: z.string().optional().describe("Unstripped binary, or debug-info file (e.g. from `objcopy --only-keep-debug`), of the build that was profiled (default: resolve native frames from the mapped files on this machine)"),
+        mapping: z.string().optional().describe("Mapping to symbolize, by file name, for profiles spanning several binaries or shared libraries (default: the one matching the binary's build ID, else the main binary)"),
+        force: z.boolean().optional().default(false).describe("Symbolize even when the build IDs differ (default: false)"),
+      }),
+    },
+    async ({ profilePath, binaryPath, mapping, force = false }): Promise<CallToolResult> => {
+      try {
+        const { entry, profile, report } = await symbolizeIntoCatalog(profilePath, binaryPath, { mapping, force });
+        const top = topReport(profile, sampleIndexOf(profile), 5);
+        const unresolved = report.locations - report.resolved;
+        const source = report.binary.split(", ").map((file) => path.basename(file)).join(", ");
+        const text = `🔣 Symbolized ${report.resolved} of ${report.locations} ${binaryPath ? "" : "native "}addresses${report.mapping ? ` in ${report.mapping}` : ""} with ${source} into ${entry.id}${formatLabels(entry.labels)}${report.resolvedFromGo > 0 ? `\n${report.resolvedFromGo} resolved from the Go symbol table, without inlined frames` : ""}${report.resolvedFromSymbols ? `\n${report.resolvedFromSymbols} resolved from ELF symbol tables, without files and lines` : ""}
+📁 ${entry.path}
+🖼️ Flamegraph: ${flamegraphUri(entry.id)}
+
+${top.summary}
+${top.functions.map((f, i) => `${i + 1}. ${f.name} (${f.flatPct}%)`).join("\n")}
+
+💡 Tip: ${unresolved > 0 ? `${unresolved} address(es) stayed unresolved: they may belong to another mapping (see the mapping option) or to code without symbols, like the vDSO.` : `Pass ${entry.id} to top_functions, list_source or diff_flamegraph like any other profile.`}`;
+        return {
+          content: [{ type: "text", text }, flamegraphLink(entry.id)],
+          structuredContent: { ...entry, report, top } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "symbolizing profile");
+      }
+    },
+  );
+
+  server.registerTool(
+    "redact_profile",
+    {
+      title: "Redact Profile",
+      description: "Make a copy of a profile that is safe to share outside the team, with a vendor, in a public issue or with an LLM: absolute source paths are trimmed to import paths or paths within the project, binary paths to file names, home directories (and the usernames in them) left in comments and labels become ~, build IDs are cleared, and the values of chosen labels are replaced by salted hashes that keep equal values equal. Function names, lines and values are kept, so the copy renders and diffs like the original. The redacted copy is catalogued with its own ID; the original is left as it was. preview_redaction shows what would change first.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Catalog ID or path of the profile to redact"),
+        ...redactFields,
+        outputPath: z.string().optional().describe("Also write the redacted profile to this path, ready to share"),
+      }),
+    },
+    async ({ profilePath, labels = [], paths = true, usernames = true, buildIds = true, outputPath }): Promise<CallToolResult> => {
+      try {
+        const { entry, report } = await redactIntoCatalog(profilePath, { labels, paths, usernames, buildIds });
+        if (outputPath) {
+          await fs.copyFile(entry.path, path.resolve(outputPath));
+        }
+        const redactedLabels = Object.entries(report.labels).map(([key, count]) => `${key} (${count})`);
+        const text = `🕶️ Redacted ${profilePath} into ${entry.id}${formatLabels(entry.labels)}
+• Source paths trimmed: ${paths ? report.files : "kept"}
+• Binary paths trimmed: ${paths ? report.mappings : "kept"}
+• Build IDs cleared: ${buildIds ? report.buildIds : "kept"}
+• Usernames removed: ${usernames ? report.usernames : "kept"}
+• Label values hashed: ${redactedLabels.length > 0 ? redactedLabels.join(", ") : labels.includes("*") ? "none, the profile has no sample labels" : labels.length > 0 ? `none found for ${labels.join(", ")}` : "none asked for"}
+📁 ${entry.path}${outputPath ? `, copied to ${path.resolve(outputPath)}` : ""}
+🖼️ Flamegraph: ${flamegraphUri(entry.id)}
+
+💡 Tip: Share ${outputPath ? path.resolve(outputPath) : entry.path} rather than the original. list_source needs the original's paths to find the code, and symbolize_profile its build IDs.`;
+        return {
+          content: [{ type: "text", text }, flamegraphLink(entry.id)],
+          structuredContent: { ...entry, report } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "redacting profile");
+      }
+    },
+  );
+
+  server.registerTool(
+    "preview_redaction",
+    {
+      title: "Preview Redaction",
+      description: "Show exactly which frame names, source and binary paths, build IDs, comments and label values redact_profile would change in a profile, with the same options, and which label keys it would leave as they are, without writing anything. Lets a security reviewer check the redaction settings against a real capture before it is exported or pushed.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Catalog ID or path of the profile to check"),
+        ...redactFields,
+        limit: z.number().int().min(1).optional().default(20).describe("Changes to list per kind (default: 20); structured output has all of them"),
+      }),
+    },
+    async ({ profilePath, labels = [], paths = true, usernames = true, buildIds = true, limit = 20 }): Promise<CallToolResult> => {
+      try {
+        const original = readProfile(await resolveProfilePath(profilePath));
+        const { changes } = redactProfile(original, { labels, paths, usernames, buildIds });
+        const sections = (Object.keys(CHANGE_HEADINGS) as RedactChangeKind[]).flatMap((kind) => {
+          const own = changes.filter((c) => c.kind === kind).sort((a, b) => b.count - a.count);
+          if (own.length === 0) return [];
+          const lines = own.slice(0, limit).map((c) =>
+            `• ${c.key !== undefined ? `${c.key}: ` : ""}${c.before} → ${c.after || "(cleared)"}${c.count > 1 ? ` (×${c.count})` : ""}`);
+          return [`${CHANGE_HEADINGS[kind]} (${own.length}):\n${lines.join("\n")}${own.length > limit ? `\n… and ${own.length - limit} more` : ""}`];
+        });
+        const labelKeys = [...new Set(original.samples.flatMap((sample) => Object.keys(sample.labels)))].sort();
+        // Keys whose values are not hashed, even if a home directory was scrubbed from them
+        const keptKeys = labels.includes("*") ? [] : labelKeys.filter((key) => !labels.includes(key));
+        const frames = new Set([...original.locations.values()].flatMap((location) => location.frames.map((frame) => frame.name)));
+        const hashed = labelKeys.length > keptKeys.length;
+        const text = `🔍 Redaction preview of ${profilePath}: ${changes.length} distinct value(s) would change; nothing was written
+
+${sections.length > 0 ? sections.join("\n\n") : "Nothing would change."}
+
+✅ Kept as they are: ${frames.size - changes.filter((c) => c.kind === "frame").length} of ${frames.size} frame names, ${keptKeys.length > 0 ? `the values of label keys ${keptKeys.join(", ")}${usernames ? " (bar home directories)" : ""}` : "no label values"}, and all line numbers and sample values
+${hashed ? "\n🔑 Hashes are salted per redaction, so redact_profile writes different ones than shown here; equal values still get equal hashes.\n" : ""}
+💡 Tip: ${keptKeys.length > 0 ? "Check the kept label keys for user, tenant or request IDs and add them to labels; then run" : "Run"} redact_profile with the same options to write the copy.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { profile: profilePath, changes, labelKeys, keptLabelKeys: keptKeys } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "previewing redaction");
+      }
+    },
+  );
+}
@@ -0,0 +1,108 @@
+/**
+ * Inspecting the server configuration loaded at startup, and checking config
+ * files before they are deployed.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import path from "node:path";
+import { z } from "zod";
+import { CONFIG_FILE, serverConfig } from "../lib/config.js";
+import { formatIssue } from "../lib/configschema.js";
+import { runningCaptures } from "../lib/limits.js";
+import { formatValue } from "../lib/pprof.js";
+import { dataDir, profileDir } from "../lib/store.js";
+import { CONFIG_KINDS, defaultConfigFiles, validateConfigFile, validateConfigText, type ConfigValidation } from "../lib/validate.js";
+
+export function registerConfigTools(server: McpServer) {
+  server.registerTool(
+    "get_config",
+    {
+      title: "Get Server Config",
+      description: "Show the configuration in effect: the live targets captures may use, where profiles are stored, the longest capture and largest profile allowed, the limits on concurrent captures and the captures running now, the default flamegraph layout, where flamegraph frames link to, and where findings are exported. Loaded at startup from --config, PROFILER_CONFIG or config.yaml in the data directory.",
+      inputSchema: z.object({}),
+    },
+    async (): Promise<CallToolResult> => {
+      const config = serverConfig();
+      const { color, orientation, inverted, accessibility } = config.render;
+      const { limits } = config;
+      const running = runningCaptures();
+      const active = {
+        ...config,
+        profileDir: profileDir(),
+        render: { colorScheme: color ?? "classic", orientation: orientation ?? "flame", inverted: inverted ?? false, accessibility: accessibility ?? false },
+        // Webhook URLs and headers often hold credentials
+        exporters: config.exporters.map(({ settings, ...exporter }) => ({ ...exporter, ...(typeof settings.file === "string" ? { file: settings.file } : {}) })),
+        runningCaptures: running,
+      };
+      const text = `⚙️ Server Config${config.source ? ` from ${config.source}` : " (defaults; no config file)"}
+
+🎯 Live targets: ${config.targets.length > 0 ? config.targets.join(", ") : "any"}
+📁 Profile directory: ${active.profileDir}
+⏱️ Longest capture: ${limits.maxCaptureSeconds}s
+📦 Largest profile: ${formatValue(limits.maxProfileBytes, "bytes")}
+🚦 Captures: ${limits.maxConcurrentCaptures} at once, ${limits.maxCapturesPerTarget} per target${limits.maxCapturesPerMinute > 0 ? `, ${limits.maxCapturesPerMinute} per target per minute` : ""}; ${limits.captureQueueSeconds > 0 ? `calls wait up to ${limits.captureQueueSeconds}s for a slot` : "calls fail at once without a free slot"}
+🏃 Running now: ${Object.keys(running).length > 0 ? Object.entries(running).map(([target, count]) => `${target}${count > 1 ? ` ×${count}` : ""}`).join(", ") : "none"}
+🎨 Flamegraphs: ${active.render.colorScheme} colors, ${active.render.orientation}${active.render.inverted ? ", inverted" : ""}${active.render.accessibility ? ", color-blind-safe with text equivalents" : ""}
+🔗 Source links: ${[
+        ...(config.sources.editor ? [`${config.sources.editor} for files on this machine`] : []),
+        ...config.sources.repos.map((repo) => `${repo.module ?? repo.path} → ${repo.url}${repo.ref ? ` at ${repo.ref}` : ""}`),
+        "GitHub for module cache dependencies",
+      ].join("; ")}
+📤 Finding exports: ${config.exporters.length > 0
+        ? config.exporters.map((e) => `${e.type}${typeof e.settings.file === "string" ? ` to ${e.settings.file}` : ""}${e.kinds ? ` (${e.kinds.join(", ")})` : ""}${e.minSeverity ? ` from ${e.minSeverity} severity` : ""}`).join("; ")
+        : "none"}
+
+💡 Tip: Edit the config file and restart the server to change these; calls can still pick their own colors and orientation.`;
+      return {
+        content: [{ type: "text", text }],
+        structuredContent: active as unknown as Record<string, unknown>,
+      };
+    },
+  );
+
+  server.registerTool(
+    "validate_config",
+    {
+      title: "Validate Config",
+      description: "Check config files against their schemas before deploying them: the server config (config.yaml), performance budgets (.perfbudgets.yaml), targets.yaml with its scenarios, and suppressions.json. Strict: unknown keys, wrong types, out-of-range values and settings the server would refuse at startup are all reported, each with its line. Pass files, or the text of one file with its kind; with neither, the server's own config and suppressions are checked, plus the budgets and targets of repoPath.",
+      inputSchema: z.object({
+        files: z.array(z.string()).optional().describe("Config files to check; the kind of each comes from its name unless kind is given"),
+        content: z.string().optional().describe("Text of a config file to check instead, e.g. a change not yet written; needs kind"),
+        kind: z.enum(CONFIG_KINDS).optional().describe("What the files or content are: server, budgets, targets or suppressions (default: from the file name)"),
+        repoPath: z.string().optional().describe("Repository to look for .perfbudgets.yaml and targets.yaml in when no files are given (default: the server's working directory)"),
+      }),
+    },
+    async ({ files, content, kind, repoPath }): Promise<CallToolResult> => {
+      try {
+        let results: ConfigValidation[];
+        if (content !== undefined) {
+          if (!kind || files) {
+            throw new Error("Pass content with its kind, and without files");
+          }
+          results = [validateConfigText(content, kind === "suppressions" ? "content.json" : "content.yaml", kind)];
+        } else {
+          const checked = files ?? (await defaultConfigFiles(serverConfig().source ?? path.join(dataDir(), CONFIG_FILE), dataDir(), repoPath));
+          results = await Promise.all(checked.map((file) => validateConfigFile(file, kind)));
+        }
+        const invalid = results.filter((r) => !r.valid);
+        const text = results.length === 0
+          ? "📋 No config files found to check"
+          : `${invalid.length === 0 ? `✅ ${results.length} config file(s) valid` : `❌ ${invalid.length} of ${results.length} config file(s) invalid`}
+
+${results.map((r) => r.valid ? `✅ ${r.file} (${r.kind})` : `❌ ${r.file} (${r.kind})\n${r.issues.map((issue) => `   ${formatIssue(r.file, issue)}`).join("\n")}`).join("\n")}
+
+💡 Tip: Run \`npm run validate-config -- <files>\` in CI to check config changes before they are deployed; it exits non-zero on any problem.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { valid: invalid.length === 0, results } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error validating config: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
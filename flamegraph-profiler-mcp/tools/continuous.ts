@@ -0,0 +1,157 @@
+/**
+ * Querying snapshots taken by continuous profiling.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { recordAnomalies, type Anomaly } from "../lib/anomalies.js";
+import { ANOMALY_LOOKBACK_HOURS, continuousConfig, CONTINUOUS_TYPES, listSnapshots, roundsPerRotation, snapshotAnomalies, targetsPerRound, whatChanged } from "../lib/continuous.js";
+import type { FunctionDelta } from "../lib/diff.js";
+import { formatValue } from "../lib/pprof.js";
+import { versioned } from "../lib/schema.js";
+
+export function registerContinuousTools(server: McpServer) {
+  server.registerTool(
+    "list_snapshots",
+    {
+      title: "List Continuous Snapshots",
+      description: "Show the continuous profiling configuration and the CPU and heap snapshots stored per target, with their time range. Continuous profiling is enabled with PROFILER_CONTINUOUS_TARGETS.",
+      inputSchema: z.object({
+        target: z.string().optional().describe("Only show this target (its configured name)"),
+        hours: z.number().min(0).optional().default(24).describe("How far back to list snapshots, in hours (default: 24; 0 for all)"),
+      }),
+    },
+    async ({ target, hours = 24 }): Promise<CallToolResult> => {
+      try {
+        const config = continuousConfig();
+        const since = hours > 0 ? new Date(Date.now() - hours * 60 * 60 * 1000) : undefined;
+        const snapshots = await listSnapshots({ target, since });
+
+        const targets = [...new Set([...(config?.targets.map((t) => t.name) ?? []), ...snapshots.map((s) => s.target)])]
+          .filter((name) => !target || name === target);
+        const lines = targets.map((name) => {
+          const address = config?.targets.find((t) => t.name === name)?.address;
+          const counts = CONTINUOUS_TYPES.map((type) => `${snapshots.filter((s) => s.target === name && s.profileType === type).length} ${type}`);
+          const own = snapshots.filter((s) => s.target === name);
+          const range = own.length > 0 ? `, ${own[0].at} → ${own[own.length - 1].at}` : "";
+          return `• ${name}${address && address !== name ? ` (${address})` : ""}: ${counts.join(", ")}${range}`;
+        });
+
+        const sampled = config && config.sampleFraction < 1;
+        const jitter = config && config.jitter > 0 ? `, each delayed up to ${Math.round(config.jitter * config.intervalMinutes * 10) / 10} min at random` : "";
+        const destinations = [config?.pyroscope ? "Pyroscope" : "", config?.otlp ? "OTLP" : ""].filter(Boolean);
+        const pushed = `${destinations.length > 0 ? `, pushing each snapshot to ${destinations.join(" and ")}` : ""}${config && config.anomalyThreshold > 0 ? `, flagging shares ${config.anomalyThreshold}σ off their average` : ""}`;
+        const status = config
+          ? `🔁 Capturing ${sampled ? `${targetsPerRound(config)} of ${config.targets.length} target(s) at random` : `${config.targets.length} target(s)`} every ${config.intervalMinutes} min (${config.cpuSeconds}s CPU${jitter}), keeping ${config.retentionHours}h${pushed}${sampled ? `\n   Every target is captured at least once every ${roundsPerRotation(config)} rounds` : ""}`
+          : "⏸️ Continuous profiling is off; set PROFILER_CONTINUOUS_TARGETS to enable it";
+        const text = `${status}
+
+📚 Snapshots${since ? ` in the last ${hours}h` : ""}:
+${lines.length > 0 ? lines.join("\n") : "None"}`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { config, snapshots } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error listing snapshots: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "what_changed",
+    {
+      title: "What Changed",
+      description: "Answer \"what changed in the last hour\" for a continuously profiled target: merges the snapshots of the last N minutes and of the N minutes before, and lists the functions whose share of CPU time or in-use memory grew or shrank the most.",
+      inputSchema: z.object({
+        target: z.string().describe("Target name as configured in PROFILER_CONTINUOUS_TARGETS"),
+        profileType: z.enum(CONTINUOUS_TYPES).optional().default("cpu").describe("Snapshots to compare: 'cpu' or 'heap' (default: cpu)"),
+        minutes: z.number().min(1).optional().default(60).describe("Window length in minutes (default: 60)"),
+        limit: z.number().optional().default(10).describe("Number of regressions and improvements to return (default: 10)"),
+      }),
+    },
+    async ({ target, profileType = "cpu", minutes = 60, limit = 10 }): Promise<CallToolResult> => {
+      try {
+        const report = await whatChanged(target, profileType, minutes, limit);
+        const { diff } = report;
+        // With fleet sampling, a window shorter than a rotation may miss a target's captures
+        const config = continuousConfig();
+        const rotationMinutes = config && config.sampleFraction < 1 ? roundsPerRotation(config) * config.intervalMinutes : 0;
+
+        const formatDelta = (d: FunctionDelta, i: number) =>
+          `${i + 1}. ${d.name}: ${d.baselineFlatPct}% → ${d.comparisonFlatPct}% (${d.flatDeltaPct > 0 ? "+" : ""}${d.flatDeltaPct} pts flat, ${d.cumDeltaPct > 0 ? "+" : ""}${d.cumDeltaPct} pts cum)`;
+
+        const text = `🕒 What changed for ${target} (${profileType}): last ${minutes} min vs the ${minutes} min before
+📊 ${report.previous.snapshots} → ${report.current.snapshots} snapshot(s); ${formatValue(diff.baselineTotal / report.previous.snapshots, diff.unit)} → ${formatValue(diff.comparisonTotal / report.current.snapshots, diff.unit)} per snapshot
+
+📈 Largest Regressions:
+${diff.regressions.length > 0 ? diff.regressions.map(formatDelta).join("\n") : "None"}
+
+📉 Largest Improvements:
+${diff.improvements.length > 0 ? diff.improvements.map(formatDelta).join("\n") : "None"}
+
+${minutes < rotationMinutes ? `\n🎲 Only a sample of targets is captured each round; windows of at least ${rotationMinutes} min cover every target once.\n` : ""}
+💡 Tip: Shares are compared as percentages of each window's total, so windows with different snapshot counts compare fairly.`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: versioned("trends", report) as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error comparing snapshots: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "detect_anomalies",
+    {
+      title: "Detect Anomalies",
+      description: "Find snapshots of a continuously profiled target in which a function's share of CPU time or in-use memory deviated abnormally from its recent average (an EWMA per function), without configured thresholds. Continuous profiling runs this after every snapshot and records anomalies as findings; use this tool to look back over a period or try another sensitivity.",
+      inputSchema: z.object({
+        target: z.string().describe("Target name as configured in PROFILER_CONTINUOUS_TARGETS"),
+        profileType: z.enum(CONTINUOUS_TYPES).optional().default("cpu").describe("Snapshots to check: 'cpu' or 'heap' (default: cpu)"),
+        hours: z.number().min(1).optional().default(ANOMALY_LOOKBACK_HOURS).describe(`How far back to read snapshots, in hours (default: ${ANOMALY_LOOKBACK_HOURS})`),
+        threshold: z.number().min(1).optional().describe("Standard deviations from the average that count as anomalous (default: PROFILER_ANOMALY_THRESHOLD, else 4)"),
+        record: z.boolean().optional().default(false).describe("Record the anomalies of the newest snapshot as findings and post new ones to PROFILER_ALERT_WEBHOOK (default: false)"),
+      }),
+    },
+    async ({ target, profileType = "cpu", hours = ANOMALY_LOOKBACK_HOURS, threshold, record = false }): Promise<CallToolResult> => {
+      try {
+        const configured = continuousConfig()?.anomalyThreshold;
+        const { report, snapshots } = await snapshotAnomalies(target, profileType, hours, threshold ?? (configured || undefined));
+        const recorded = record ? await recordAnomalies(report, snapshots) : undefined;
+        const { options } = report;
+        const formatAnomaly = (a: Anomaly) =>
+          `• ${a.at} ${a.direction === "spike" ? "📈" : "📉"} ${a.function}: ${a.share}% (expected ${a.expected}% ± ${a.stdDev}, ${a.zScore > 0 ? "+" : ""}${a.zScore}σ)`;
+
+        const text = `🔎 Anomalies for ${target} (${profileType}) over ${report.snapshots} snapshot(s) in the last ${hours}h, ${report.functions} function(s) tracked
+Threshold ${options.threshold}σ and at least ${options.minDeltaPts} pts; the first ${options.warmup} snapshots only build the average
+
+${report.anomalies.length > 0 ? report.anomalies.map(formatAnomaly).join("\n") : report.snapshots <= options.warmup ? `None yet: ${options.warmup - report.snapshots + 1} more snapshot(s) needed before shares are judged` : "None"}
+${recorded ? `\n📋 Recorded ${recorded.findings.length} finding(s) from the newest snapshot${recorded.alerted.length > 0 ? `, alerted on ${recorded.alerted.length}` : ""}\n` : ""}
+💡 Tip: Use what_changed around an anomaly's time to see the rest of the profile shift with it.`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { ...report, ...(recorded ? { findings: recorded.findings } : {}) } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error detecting anomalies: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
@@ -0,0 +1,161 @@
+/**
+ * Core dump analysis through Delve and viewcore, for crash investigations.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import path from "node:path";
+import { z } from "zod";
+import { analyzeCore } from "../lib/core.js";
+import { formatValue } from "../lib/pprof.js";
+import { flamegraphLink, flamegraphUri } from "../lib/render.js";
+import { getPostmortem } from "../lib/supervisor.js";
+import { analyzeCoreHeap, type HeapObjectInfo, type HeapPathStep } from "../lib/viewcore.js";
+
+// Steps of a path shown at each end of a long one
+const PATH_ENDS = 4;
+
+// Binary and core of a postmortem, or as given
+async function coreFiles(postmortemId?: string, binary?: string, core?: string): Promise<{ binary: string; core: string }> {
+  if (postmortemId) {
+    const postmortem = await getPostmortem(postmortemId);
+    if (!postmortem.core) {
+      throw new Error(`Postmortem ${postmortemId} has no core dump; supervise the target with coreDumps: true`);
+    }
+    return { binary: path.join(postmortem.dir, "binary"), core: postmortem.core };
+  }
+  if (!binary || !core) {
+    throw new Error("Pass postmortemId, or both binary and core");
+  }
+  return { binary, core };
+}
+
+function formatStep(step: HeapPathStep): string {
+  switch (step.kind) {
+    case "global":
+      return `${step.name} (global${step.type ? ` ${step.type}` : ""})`;
+    case "frame":
+      return `${step.name} (goroutine frame)`;
+    default:
+      return `${step.name} ${step.type}`;
+  }
+}
+
+function formatPath(steps: HeapPathStep[], indent: string): string {
+  const lines = steps.map((step, i) => (i === 0 ? formatStep(step) : `${steps[i - 1].via ? `${steps[i - 1].via} ` : ""}→ ${formatStep(step)}`));
+  const shown = lines.length > PATH_ENDS * 2
+    ? [...lines.slice(0, PATH_ENDS), `… ${lines.length - PATH_ENDS * 2} more step(s)`, ...lines.slice(-PATH_ENDS)]
+    : lines;
+  return shown.map((line) => `${indent}${line}`).join("\n");
+}
+
+function formatObject(o: HeapObjectInfo): string {
+  return `${o.address} ${o.type} (${formatValue(o.size, "bytes")}), retains ${formatValue(o.retained, "bytes")}`;
+}
+
+export function registerCoreTools(server: McpServer) {
+  server.registerTool(
+    "analyze_core",
+    {
+      title: "Analyze Core Dump",
+      description: "Open a Go core dump with Delve (dlv must be on PATH) and show the final moment of the process: every goroutine's stack grouped by state and stack, the goroutine that was running when it died, and live heap objects by size class. The stacks are saved as a goroutine profile, so they render as a flamegraph. Pass a postmortem ID from supervise_target, or the binary and core paths.",
+      inputSchema: z.object({
+        postmortemId: z.string().optional().describe("Postmortem with a core dump (see list_postmortems); replaces binary and core"),
+        binary: z.string().optional().describe("Path to the executable that produced the core"),
+        core: z.string().optional().describe("Path to the core file"),
+        depth: z.number().int().min(1).max(500).optional().default(50).describe("Frames read per goroutine (default: 50)"),
+        limit: z.number().int().min(1).max(100).optional().default(15).describe("Number of goroutine groups and size classes to list (default: 15)"),
+      }),
+    },
+    async ({ postmortemId, binary, core, depth = 50, limit = 15 }): Promise<CallToolResult> => {
+      try {
+        const report = await analyzeCore({ ...(await coreFiles(postmortemId, binary, core)), depth });
+        const { goroutines, heap } = report;
+
+        const groups = goroutines.groups.slice(0, limit).map((g) =>
+          `  [${g.key}] ${g.count} × ${g.state} — ${g.stack[0]?.split(" ")[0] ?? "?"}`);
+        const heapText = heap
+          ? `📦 Live heap objects: ${heap.totalObjects} (${formatValue(heap.smallBytes, "bytes")} in small objects, ${heap.largeObjects} large objects)
+${heap.classes.slice(0, limit).map((c) => `  ${formatValue(c.size, "bytes")} class: ${c.objects} objects, ${formatValue(c.bytes, "bytes")}`).join("\n")}`
+          : `📦 Heap object counts unavailable: ${report.heapError}`;
+
+        const text = `💥 Core dump ${report.core} (${path.basename(report.binary)})
+
+${report.crashing ? `🔴 Running when the process died: goroutine ${report.crashing.id}\n${report.crashing.stack.slice(0, 15).map((f) => `  ${f}`).join("\n")}\n\n` : ""}🧵 ${goroutines.diagnosis}${report.truncated ? " Only the first goroutines were read." : ""}
+${goroutines.suspicious.length > 0 ? `\nSuspicious groups:\n${goroutines.suspicious.map((s) => `  ⚠️ [${s.key}] ${s.message}`).join("\n")}\n` : ""}
+Largest groups:
+${groups.join("\n")}
+
+${heapText}
+
+📁 Goroutine stacks saved as ${report.profileId}
+🖼️ Flamegraph: ${flamegraphUri(report.profileId)}
+💡 Tip: A core is one instant, not a sample over time: wide frames are where many goroutines were parked, not where time went. Compare with the last heap profile of a postmortem to see what the heap held.`;
+
+        return {
+          content: [
+            { type: "text", text },
+            flamegraphLink(report.profileId),
+          ],
+          structuredContent: report as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error analyzing core dump: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+  server.registerTool(
+    "analyze_core_heap",
+    {
+      title: "Analyze Core Dump Heap",
+      description: "Walk every live object in a Go core dump with viewcore (golang.org/x/debug/cmd/viewcore must be on PATH) and show what held the memory when the process died: an object histogram by type, retained sizes from the dominator tree (what freeing an object would free with it), the globals and goroutine frames retaining the most, and the path from a root to each of the biggest retainers. Pass a postmortem ID from supervise_target, or the binary and core paths; address shows the path to one more object.",
+      inputSchema: z.object({
+        postmortemId: z.string().optional().describe("Postmortem with a core dump (see list_postmortems); replaces binary and core"),
+        binary: z.string().optional().describe("Path to the executable that produced the core"),
+        core: z.string().optional().describe("Path to the core file"),
+        limit: z.number().int().min(1).max(100).optional().default(15).describe("Number of types and roots to list (default: 15)"),
+        paths: z.number().int().min(0).max(50).optional().default(5).describe("Number of biggest retainers to show paths for (default: 5)"),
+        address: z.string().optional().describe("Hex address of a heap object to show the path to, e.g. from an earlier result"),
+      }),
+    },
+    async ({ postmortemId, binary, core, limit = 15, paths = 5, address }): Promise<CallToolResult> => {
+      try {
+        const report = await analyzeCoreHeap({ ...(await coreFiles(postmortemId, binary, core)), limit, paths, address });
+        const bytes = (value: number) => formatValue(value, "bytes");
+
+        const types = report.types.map((t) =>
+          `  ${bytes(t.bytes).padStart(9)}  retains ${bytes(t.retained).padStart(9)}  ${String(t.objects).padStart(8)} × ${t.type}`);
+        const roots = report.roots.map((r) =>
+          `  ${bytes(r.retained).padStart(9)}  ${r.kind === "global" ? `${r.name} (global${r.type ? ` ${r.type}` : ""})` : `${r.name} (goroutine frame)`}`);
+        const biggest = report.biggest.map((o, i) => `  ${i + 1}. ${formatObject(o)}\n${formatPath(o.path, "       ")}`);
+
+        const text = `🧠 Heap of core dump ${report.core} (${path.basename(report.binary)}): ${report.objects} live objects, ${bytes(report.bytes)}, reachable from ${report.globals} globals and ${report.frames} goroutine frames${report.unreachable > 0 ? `; ${report.unreachable} objects reachable from no root` : ""}
+
+📊 Objects by type (bytes, retained, count):
+${types.join("\n")}
+
+🌳 Biggest retainers:
+${biggest.join("\n") || "  (none)"}
+
+🌱 Roots retaining the most:
+${roots.join("\n") || "  (none)"}
+${report.object ? `\n🔗 ${formatObject(report.object)}\n${formatPath(report.object.path, "   ")}\n` : ""}
+💡 Tip: A type's retained size counts what its objects keep alive, not just their own bytes, so a small type that holds a large graph ranks high. Pass an address from the paths to follow another object.`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: report as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error analyzing core heap: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
@@ -0,0 +1,53 @@
+/**
+ * On-demand weekly digest of profiling trends.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { buildDigest, digestCharts, formatDigest, postDigest } from "../lib/digest.js";
+import { LANGS } from "../lib/i18n.js";
+import { versioned } from "../lib/schema.js";
+
+export function registerDigestTools(server: McpServer) {
+  server.registerTool(
+    "post_digest",
+    {
+      title: "Post Profiling Digest",
+      description: "Summarize recent profiling trends (new hotspots, resolved regressions, recurring findings, storage usage) and post them to the Slack webhook in PROFILER_SLACK_WEBHOOK. The server also posts this weekly when the webhook is configured.",
+      inputSchema: z.object({
+        days: z.number().optional().default(7).describe("Length of the period to summarize in days (default: 7)"),
+        dryRun: z.boolean().optional().default(false).describe("Return the digest without posting it"),
+        lang: z.enum(LANGS).optional().default("en").describe("Language of the digest text (default: en); structured fields stay in English"),
+      }),
+    },
+    async ({ days = 7, dryRun = false, lang = "en" }): Promise<CallToolResult> => {
+      try {
+        const digest = await buildDigest(days);
+        const webhookUrl = process.env.PROFILER_SLACK_WEBHOOK;
+        if (!dryRun) {
+          if (!webhookUrl) {
+            throw new Error("PROFILER_SLACK_WEBHOOK is not set; use dryRun to preview the digest");
+          }
+          await postDigest(digest, webhookUrl, lang);
+        }
+        return {
+          content: [
+            { type: "text", text: `${dryRun ? "📝 Digest preview (not posted)" : "📨 Digest posted to Slack"}:\n\n${formatDigest(digest, lang)}` },
+            ...digestCharts(digest).map((chart) => ({
+              type: "image" as const,
+              data: Buffer.from(chart).toString("base64"),
+              mimeType: "image/svg+xml",
+            })),
+          ],
+          structuredContent: versioned("digest", digest) as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error building digest: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
@@ -0,0 +1,65 @@
+/**
+ * Onboarding repositories: discovering services to profile.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { existsSync } from "node:fs";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { z } from "zod";
+import { discoverServices, targetsTemplate } from "../lib/discover.js";
+
+export function registerDiscoverTools(server: McpServer) {
+  server.registerTool(
+    "discover_services",
+    {
+      title: "Discover Services",
+      description: "Scan a (mono)repository for Go main packages and Dockerfiles and generate a targets.yaml template with a target and CPU/heap scenarios per service, so large repos can be onboarded without hand-writing targets. Notes which services already serve net/http/pprof.",
+      inputSchema: z.object({
+        root: z.string().describe("Repository root (or subdirectory) to scan"),
+        write: z.boolean().optional().default(false).describe("Write the template to targets.yaml in the root (default: false, only return it)"),
+        overwrite: z.boolean().optional().default(false).describe("Replace an existing targets.yaml when writing (default: false)"),
+      }),
+    },
+    async ({ root, write = false, overwrite = false }): Promise<CallToolResult> => {
+      try {
+        const result = await discoverServices(root);
+        const template = targetsTemplate(result);
+        let written: string | undefined;
+        if (write) {
+          written = path.join(result.root, "targets.yaml");
+          if (existsSync(written) && !overwrite) {
+            throw new Error(`${written} already exists; pass overwrite to replace it`);
+          }
+          await fs.writeFile(written, template);
+        }
+
+        const lines = result.services.map((s) => {
+          const parts = [
+            s.packageDir && `package ${s.packageDir}`,
+            s.dockerfile && `Dockerfile ${s.dockerfile}`,
+            s.servesPprof ? "serves pprof" : s.packageDir && "no pprof import",
+          ].filter(Boolean);
+          return `• ${s.name}: ${parts.join(", ")}`;
+        });
+        const withoutPprof = result.services.filter((s) => s.packageDir && !s.servesPprof).length;
+        const text = `🔍 Found ${result.services.length} service(s) in ${result.root}${result.skipped > 0 ? ` (skipped ${result.skipped} vendor/testdata director${result.skipped === 1 ? "y" : "ies"})` : ""}:
+${lines.length > 0 ? lines.join("\n") : "None"}
+
+${written ? `📝 Wrote ${written}` : "📝 targets.yaml template:"}
+${written ? "" : `\n${template}`}${withoutPprof > 0 ? `\n💡 Tip: ${withoutPprof} service(s) don't import net/http/pprof yet; add \`import _ "net/http/pprof"\` and serve it to profile them live.` : ""}`;
+
+        return {
+          content: [{ type: "text", text: text.trimEnd() }],
+          structuredContent: { ...result, template, written } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error discovering services: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
@@ -0,0 +1,45 @@
+/**
+ * Input fields shared by the tools that render or analyze a profile.
+ */
+import { z } from "zod";
+import { ORIENTATIONS } from "../lib/charts.js";
+import { COLOR_SCHEMES, PROFILE_COLOR_SCHEMES } from "../lib/colors.js";
+import { describeFrameFilters, hasFrameFilters, type FrameFilters } from "../lib/transform.js";
+
+// pprof-style frame filters, and generic merging; spread into a tool's input schema
+export const frameFilterFields = {
+  focus: z.string().optional().describe("Only keep samples with a function matching this regex, like pprof -focus (e.g. 'dataProcessingPipeline')"),
+  ignore: z.string().optional().describe("Drop samples with a function matching this regex, like pprof -ignore"),
+  show: z.string().optional().describe("Only keep functions matching this regex in stacks, like pprof -show"),
+  hide: z.string().optional().describe("Remove functions matching this regex from stacks, like pprof -hide (e.g. '^runtime\\\\.')"),
+  mergeGenerics: z.boolean().optional().describe("Merge generic instantiations into one frame per function, e.g. sort.Sort[go.shape.int] and sort.Sort[go.shape.string] into sort.Sort[...], so hotspots are not split by type and diffs compare across type sets"),
+  hideKernel: z.boolean().optional().describe("Hide the kernel frames (named with a _[k] suffix) of mixed-mode perf profiles, charging kernel time to the Go function that entered the kernel"),
+};
+
+// Flamegraph color scheme of tools rendering one profile; spread into a tool's input schema
+export const colorSchemeField = {
+  colorScheme: z.enum(PROFILE_COLOR_SCHEMES).optional().describe("Flamegraph coloring: 'classic' (warm, by function name, default), 'package' (one color per Go package), 'stdlib' (your code vs standard library vs runtime) or 'hot' (by self time)"),
+};
+
+// Color scheme of differential flamegraphs, which can also be colored by delta
+export const diffColorSchemeField = {
+  colorScheme: z.enum(COLOR_SCHEMES).optional().describe("Flamegraph coloring: 'diff' (red grew, blue shrank, default), 'classic', 'package', 'stdlib' or 'hot' (by self time in the comparison)"),
+};
+
+// How tools rendering a flamegraph lay it out; spread into a tool's input schema
+export const layoutFields = {
+  orientation: z.enum(ORIENTATIONS).optional().describe("'flame' draws the root at the bottom (default), 'icicle' draws it at the top with callees hanging below"),
+  inverted: z.boolean().optional().describe("Merge stacks by the function they end in: roots are leaf functions weighted by self time, with the callers that reach them above, to answer 'which callers reach md5.New?'"),
+  accessibility: z.boolean().optional().describe("Color-blind-safe flamegraph colors (Okabe-Ito and viridis, with ▲/▼ marking grown and shrunk frames in diffs), and the flamegraph also given as indented text for screen readers (default: the server config's, else false)"),
+};
+
+// Note on a tool's headline when filters are in effect, e.g. " (filtered: hide=^runtime\.)"
+export function filterNote(filters: FrameFilters): string {
+  const description = describeFrameFilters(filters);
+  return description ? ` (filtered: ${description})` : "";
+}
+
+// Leading line of a tool's output when filters are in effect
+export function filterLine(filters: FrameFilters): string {
+  return hasFrameFilters(filters) ? `🔍 Filtered: ${describeFrameFilters(filters)}\n` : "";
+}
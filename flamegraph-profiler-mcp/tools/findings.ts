@@ -0,0 +1,209 @@
+/**
+ * Review workflow tools for findings: list, comment, assign, acknowledge, resolve,
+ * and file tracker tickets.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import path from "node:path";
+import { z } from "zod";
+import {
+  formatFinding,
+  getFinding,
+  listFindings,
+  localizeFinding,
+  updateFinding,
+  type Finding,
+} from "../lib/findings.js";
+import { LANGS, t, type Lang } from "../lib/i18n.js";
+import { versioned } from "../lib/schema.js";
+import { fileTicket } from "../lib/tickets.js";
+
+const findingId = z.string().describe("Finding ID (e.g., 'f_1a2b3c4d')");
+const authorField = z.string().optional().describe("Who is making the change (default: 'anonymous')");
+const langField = z.enum(LANGS).optional().default("en").describe("Language of the text (default: en); structured fields stay in English");
+
+function findingResult(finding: Finding, message: string, lang: Lang = "en"): CallToolResult {
+  return {
+    content: [{ type: "text", text: `${message}\n${formatFinding(finding, lang)}` }],
+    structuredContent: versioned("finding", finding) as unknown as Record<string, unknown>,
+  };
+}
+
+function errorResult(error: unknown, action: string): CallToolResult {
+  const message = error instanceof Error ? error.message : "Unknown error";
+  return {
+    content: [{ type: "text", text: `Error ${action}: ${message}` }],
+    isError: true,
+  };
+}
+
+export function registerFindingTools(server: McpServer) {
+  server.registerTool(
+    "list_findings",
+    {
+      title: "List Findings",
+      description: "List persisted performance findings (anti-patterns, regressions and continuous profiling anomalies) with their review status, optionally filtered.",
+      inputSchema: z.object({
+        status: z.enum(["open", "acknowledged", "resolved"]).optional().describe("Only findings with this status"),
+        kind: z.enum(["anti-pattern", "regression", "anomaly"]).optional().describe("Only findings of this kind"),
+        assignee: z.string().optional().describe("Only findings assigned to this person or team"),
+        owner: z.string().optional().describe("Only findings owned by this team per CODEOWNERS or the ownership mapping (e.g., 'team-payments')"),
+        function: z.string().optional().describe("Only findings whose function name contains this text"),
+        lang: langField,
+      }),
+    },
+    async ({ lang = "en", ...filter }): Promise<CallToolResult> => {
+      try {
+        const findings = await listFindings(filter);
+        const text = findings.length > 0
+          ? `${t(lang, "findings.count", { count: findings.length })}\n${findings.map((f) => formatFinding(f, lang)).join("\n")}`
+          : t(lang, "findings.none");
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: versioned("findings", { findings }) as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "listing findings");
+      }
+    },
+  );
+
+  server.registerTool(
+    "get_finding",
+    {
+      title: "Get Finding",
+      description: "Get a finding's full details, including its comment thread.",
+      inputSchema: z.object({ id: findingId, lang: langField }),
+    },
+    async ({ id, lang = "en" }): Promise<CallToolResult> => {
+      try {
+        const finding = await getFinding(id);
+        const comments = finding.comments.map((c) => `  ${c.at} ${c.author}: ${c.text}`).join("\n");
+        const history = (finding.occurrences ?? [])
+          .slice(-5)
+          .map((o) => `  ${o.at} ${t(lang, "finding.occurrence", { percentage: o.percentage, source: o.source })}`)
+          .join("\n");
+        const details = [
+          localizeFinding(finding, lang).detail,
+          finding.callPath?.length ? t(lang, "finding.callPath", { path: finding.callPath.join(" → ") }) : "",
+          t(lang, "finding.history", { count: finding.occurrenceCount ?? 1, first: finding.createdAt, last: finding.lastSeenAt ?? finding.createdAt }),
+          finding.ticket ? t(lang, "finding.ticket", { id: finding.ticket.id, url: finding.ticket.url }) : "",
+          history ? `${t(lang, "finding.occurrences")}\n${history}` : "",
+          comments ? `${t(lang, "finding.comments")}\n${comments}` : "",
+        ].filter(Boolean).join("\n");
+        return findingResult(finding, details, lang);
+      } catch (error) {
+        return errorResult(error, "reading finding");
+      }
+    },
+  );
+
+  server.registerTool(
+    "comment_on_finding",
+    {
+      title: "Comment on Finding",
+      description: "Add a comment to a finding's discussion thread.",
+      inputSchema: z.object({ id: findingId, text: z.string().describe("Comment text"), author: authorField }),
+    },
+    async ({ id, text, author = "anonymous" }): Promise<CallToolResult> => {
+      try {
+        const finding = await updateFinding(id, (f) => {
+          f.comments.push({ author, text, at: new Date().toISOString() });
+        });
+        return findingResult(finding, "💬 Comment added.");
+      } catch (error) {
+        return errorResult(error, "updating finding");
+      }
+    },
+  );
+
+  server.registerTool(
+    "assign_finding",
+    {
+      title: "Assign Finding",
+      description: "Assign a finding to a person or team.",
+      inputSchema: z.object({ id: findingId, assignee: z.string().describe("Person or team to assign to"), author: authorField }),
+    },
+    async ({ id, assignee, author = "anonymous" }): Promise<CallToolResult> => {
+      try {
+        const finding = await updateFinding(id, (f) => {
+          f.assignee = assignee;
+          f.comments.push({ author, text: `Assigned to ${assignee}`, at: new Date().toISOString() });
+        });
+        return findingResult(finding, `👤 Assigned to ${assignee}.`);
+      } catch (error) {
+        return errorResult(error, "updating finding");
+      }
+    },
+  );
+
+  server.registerTool(
+    "acknowledge_finding",
+    {
+      title: "Acknowledge Finding",
+      description: "Mark a finding as acknowledged: the team has seen it and accepts it as real performance debt.",
+      inputSchema: z.object({ id: findingId, note: z.string().optional().describe("Optional note explaining the decision"), author: authorField }),
+    },
+    async ({ id, note, author = "anonymous" }): Promise<CallToolResult> => {
+      try {
+        const finding = await updateFinding(id, (f) => {
+          f.status = "acknowledged";
+          f.comments.push({ author, text: note ? `Acknowledged: ${note}` : "Acknowledged", at: new Date().toISOString() });
+        });
+        return findingResult(finding, "👀 Finding acknowledged.");
+      } catch (error) {
+        return errorResult(error, "updating finding");
+      }
+    },
+  );
+
+  server.registerTool(
+    "resolve_finding",
+    {
+      title: "Resolve Finding",
+      description: "Mark a finding as resolved, e.g. after a fix has been verified with a new profile.",
+      inputSchema: z.object({ id: findingId, resolution: z.string().optional().describe("How it was resolved"), author: authorField }),
+    },
+    async ({ id, resolution, author = "anonymous" }): Promise<CallToolResult> => {
+      try {
+        const finding = await updateFinding(id, (f) => {
+          f.status = "resolved";
+          f.comments.push({ author, text: resolution ? `Resolved: ${resolution}` : "Resolved", at: new Date().toISOString() });
+        });
+        return findingResult(finding, "✅ Finding resolved.");
+      } catch (error) {
+        return errorResult(error, "updating finding");
+      }
+    },
+  );
+
+  server.registerTool(
+    "file_ticket",
+    {
+      title: "File Ticket",
+      description: "File a Jira, Linear, or webhook ticket for a finding, with the finding and any profile or trace files attached. The provider is configured with PROFILER_TICKET_PROVIDER and its settings; the ticket link is recorded on the finding.",
+      inputSchema: z.object({
+        id: findingId,
+        artifacts: z.array(z.string()).optional().describe("Files to attach, e.g. the pprof or trace the finding came from"),
+        force: z.boolean().optional().default(false).describe("File a new ticket even if one was already filed for this finding"),
+        author: authorField,
+      }),
+    },
+    async ({ id, artifacts = [], force = false, author = "anonymous" }): Promise<CallToolResult> => {
+      try {
+        const existing = await getFinding(id);
+        if (existing.ticket && !force) {
+          throw new Error(`Ticket ${existing.ticket.id} was already filed (${existing.ticket.url}); pass force to file another`);
+        }
+        const ticket = await fileTicket(existing, artifacts.map((file) => path.resolve(file)));
+        const finding = await updateFinding(id, (f) => {
+          f.ticket = ticket;
+          f.comments.push({ author, text: `Filed ${ticket.provider} ticket ${ticket.id}: ${ticket.url}`, at: new Date().toISOString() });
+        });
+        return findingResult(finding, `🎫 Filed ${ticket.id}: ${ticket.url}`);
+      } catch (error) {
+        return errorResult(error, "filing ticket");
+      }
+    },
+  );
+}
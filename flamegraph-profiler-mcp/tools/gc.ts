@@ -0,0 +1,69 @@
+/**
+ * Garbage collector analysis of an execution trace or gctrace output.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { existsSync, readFileSync } from "node:fs";
+import path from "node:path";
+import { z } from "zod";
+import { analyzeGcTrace, analyzeTraceGc, type GcReport } from "../lib/gc.js";
+import { formatValue } from "../lib/pprof.js";
+import { dumpTrace } from "../lib/trace.js";
+import { formatNanos } from "../lib/uprobes.js";
+
+function formatGcReport(report: GcReport, source: string): string {
+  const { cpu, assists, heap, pauses } = report;
+  const bytes = (value: number) => formatValue(value, "bytes");
+  const share = (fraction: number) => `${Math.round(fraction * 1000) / 10}%`;
+  const kind = report.source === "trace" ? "execution trace" : "gctrace";
+  const assistCount = assists.count !== undefined ? `, ${assists.count} assist(s) by ${assists.goroutines} goroutine(s)` : "";
+
+  return `♻️ GC report for ${source} (${kind}, ${formatNanos(report.duration)}, GOMAXPROCS ${report.gomaxprocs}):
+
+🔁 Cycles: ${report.cycles} (${report.perSecond}/s)${report.forced > 0 ? `, ${report.forced} forced` : ""}
+⏸️ Stop-the-world: ${formatNanos(pauses.total)} total, p50 ${formatNanos(pauses.p50)}, p90 ${formatNanos(pauses.p90)}, p99 ${formatNanos(pauses.p99)}, max ${formatNanos(pauses.max)} (${pauses.count} pauses)
+🧮 GC CPU: ${share(cpu.fraction)} of the CPU available${report.source === "gctrace" ? " since the process started" : ""} (pauses ${formatNanos(cpu.pause)}, assists ${formatNanos(cpu.assist)}, background marking ${formatNanos(cpu.background)}${cpu.idle > 0 ? `; idle marking ${formatNanos(cpu.idle)} not counted` : ""})
+🤝 Mark assists: ${share(assists.share)} of GC CPU${assistCount}
+📦 Heap: live ${bytes(heap.liveFirst)} → ${bytes(heap.liveLast)} (max ${bytes(heap.liveMax)}), last goal ${bytes(heap.goalLast)}, peak ${bytes(heap.peak)}; over goal in ${heap.overGoal} of ${report.cycles} cycles
+
+🩺 What it means:
+${report.notes.map((n) => `- ${n}`).join("\n")}
+
+💡 Tip: GC cost follows allocation; alloc_hotspots on a heap profile of the same run shows which code to change.`;
+}
+
+export function registerGcTools(server: McpServer) {
+  server.registerTool(
+    "analyze_gc",
+    {
+      title: "Analyze Garbage Collection",
+      description: "Report how the Go garbage collector behaved during a run, from a runtime/trace or from the lines GODEBUG=gctrace=1 prints to stderr: stop-the-world pause percentiles, the share of CPU GC took, the live heap against the heap goal, and how much marking allocating goroutines were made to do as mark assists, with a plain-language reading of what the numbers mean. Puts allocation profiles in context.",
+      inputSchema: z.object({
+        tracePath: z.string().optional().describe("Path to a runtime/trace file, e.g. from /debug/pprof/trace or `go test -trace`"),
+        gctracePath: z.string().optional().describe("Path to a file holding a run's GODEBUG=gctrace=1 output; lines that are not gctrace lines are skipped"),
+      }),
+    },
+    async ({ tracePath, gctracePath }): Promise<CallToolResult> => {
+      try {
+        const file = tracePath ?? gctracePath;
+        if (!file || (tracePath && gctracePath)) {
+          throw new Error("Pass exactly one of tracePath or gctracePath");
+        }
+        if (!existsSync(file)) {
+          throw new Error(`${tracePath ? "Trace" : "gctrace output"} not found: ${file}`);
+        }
+        const report = tracePath ? analyzeTraceGc(dumpTrace(tracePath)) : analyzeGcTrace(readFileSync(file, "utf-8"));
+        return {
+          content: [{ type: "text", text: formatGcReport(report, path.basename(file)) }],
+          structuredContent: report as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error analyzing GC: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
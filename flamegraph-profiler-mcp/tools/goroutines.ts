@@ -0,0 +1,163 @@
+/**
+ * Goroutine profile capture from live targets, with leak heuristics, and
+ * grouping of full goroutine dumps by stack and wait reason.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { readFile } from "node:fs/promises";
+import path from "node:path";
+import { setTimeout as sleep } from "node:timers/promises";
+import { z } from "zod";
+import { recordCapture } from "../lib/captures.js";
+import { checkTarget } from "../lib/config.js";
+import { percentOf } from "../lib/flamegraph.js";
+import {
+  analyzeGoroutines,
+  captureGoroutines,
+  groupGoroutines,
+  parseGoroutineDump,
+  summarizeWaits,
+  WAIT_CATEGORIES,
+  type Goroutine,
+  type GoroutineGroup,
+} from "../lib/goroutines.js";
+import { duringWindow, progressReporter } from "../lib/progress.js";
+
+export function registerGoroutineTools(server: McpServer) {
+  server.registerTool(
+    "capture_goroutine_profile",
+    {
+      title: "Capture Goroutine Profile",
+      description: "Capture the goroutine profile from a live Go process serving net/http/pprof, group goroutines by stack, and flag likely leaks. Takes two captures `interval` seconds apart to spot groups that keep growing.",
+      inputSchema: z.object({
+        target: z.string().describe("Address of the pprof server (e.g., 'localhost:6060' or 'http://host:6060')"),
+        interval: z.number().min(0).max(300).default(5).describe("Seconds between the two captures; 0 captures once (default: 5)"),
+        minGroupSize: z.number().int().min(1).default(100).describe("Goroutines parked at the same site before a group is flagged (default: 100)"),
+        minGrowth: z.number().int().min(1).default(10).describe("Growth between captures before a group is flagged (default: 10)"),
+        limit: z.number().int().min(1).max(100).default(20).describe("Number of groups to return (default: 20)"),
+      }),
+    },
+    async ({ target, interval, minGroupSize, minGrowth, limit }, extra): Promise<CallToolResult> => {
+      try {
+        checkTarget(target);
+        let previous: Goroutine[] | undefined;
+        if (interval > 0) {
+          previous = await captureGoroutines(target, extra.signal);
+          await duringWindow(progressReporter(extra), "waiting for the second goroutine capture", interval,
+            sleep(interval * 1000, undefined, { signal: extra.signal }));
+        }
+        const current = await captureGoroutines(target, extra.signal);
+        const report = analyzeGoroutines(current, previous, { minGroupSize, minGrowth });
+        const result = { target, ...report, groups: report.groups.slice(0, limit) };
+        await recordCapture({
+          target,
+          profileType: "goroutine",
+          duration: interval,
+          total: report.total,
+          unit: "count",
+          topFunctions: report.groups.map((g) => ({
+            name: g.stack[0]?.split(" ")[0] ?? "?",
+            percentage: percentOf(g.count, report.total),
+          })),
+          issues: report.suspicious.length,
+        }).catch(() => undefined);
+
+        const groupLines = result.groups.map((g) => {
+          const trend = g.previousCount !== undefined && g.previousCount !== g.count
+            ? ` (was ${g.previousCount})`
+            : "";
+          return `  [${g.key}] ${g.count}${trend} × ${g.state} — ${g.stack[0]?.split(" ")[0] ?? "?"}`;
+        });
+        const suspiciousLines = report.suspicious.map((s) => `  ⚠️ [${s.key}] ${s.message}`);
+        const text = `🧵 Goroutine profile for ${target}
+
+${report.diagnosis}
+${suspiciousLines.length > 0 ? `\nSuspicious groups:\n${suspiciousLines.join("\n")}\n` : ""}
+Largest groups:
+${groupLines.join("\n")}`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: result as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error capturing goroutine profile: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+  server.registerTool(
+    "group_goroutines",
+    {
+      title: "Group Goroutine Dump",
+      description: "Fetch the full goroutine dump (/debug/pprof/goroutine?debug=2) of a live Go process, or read one saved from it, runtime.Stack or a crash, and group identical stacks. Each group has its wait reason, a category (running, channel, select, io, mutex, sync, sleep, syscall, runtime, other), how long its goroutines have waited, its creator and some goroutine IDs. Complements the sampled goroutine profile with wait durations and per-goroutine detail.",
+      inputSchema: z.object({
+        target: z.string().optional().describe("Address of the pprof server (e.g., 'localhost:6060' or 'http://host:6060')"),
+        dumpPath: z.string().optional().describe("Path to a saved goroutine dump in the debug=2 text format"),
+        category: z.enum(WAIT_CATEGORIES).optional().describe("Only groups in this wait category"),
+        match: z.string().optional().describe("Only groups whose state or a stack frame matches this regex, e.g. 'mypkg\\.'"),
+        minCount: z.number().int().min(1).optional().default(1).describe("Only groups of at least this many goroutines (default: 1)"),
+        stackDepth: z.number().int().min(1).max(100).optional().default(8).describe("Frames of each group's stack to show (default: 8)"),
+        limit: z.number().int().min(1).max(200).optional().default(20).describe("Number of groups to return (default: 20)"),
+      }),
+    },
+    async ({ target, dumpPath, category, match, minCount = 1, stackDepth = 8, limit = 20 }, extra): Promise<CallToolResult> => {
+      try {
+        const source = target ?? dumpPath;
+        if (!source || (target && dumpPath)) {
+          throw new Error("Pass exactly one of target or dumpPath");
+        }
+        if (target) {
+          checkTarget(target);
+        }
+        const goroutines = target ? await captureGoroutines(target, extra.signal) : parseGoroutineDump(await readFile(source, "utf-8"));
+        if (goroutines.length === 0) {
+          throw new Error(`No goroutines found in ${target ? `the dump from ${target}` : source}; expected the debug=2 text format`);
+        }
+        const all = groupGoroutines(goroutines);
+        const pattern = match ? new RegExp(match) : undefined;
+        const selected = all.filter((g) =>
+          g.count >= minCount &&
+          (!category || g.category === category) &&
+          (!pattern || pattern.test(g.state) || g.stack.some((f) => pattern.test(f))));
+        const groups = selected.slice(0, limit).map((g) => ({ ...g, stack: g.stack.slice(0, stackDepth) }));
+        const categories = summarizeWaits(all);
+
+        const waited = (g: GoroutineGroup) => g.maxWaitMinutes === 0
+          ? ""
+          : `, waiting ${g.minWaitMinutes === g.maxWaitMinutes ? g.maxWaitMinutes : `${g.minWaitMinutes || "<1"}–${g.maxWaitMinutes}`} min`;
+        const categoryLines = categories.map((c) =>
+          `  ${c.category}: ${c.goroutines} in ${c.groups} group(s) (${c.states.slice(0, 4).map((s) => `${s.state} ${s.count}`).join(", ")})${c.maxWaitMinutes > 0 ? `, longest wait ${c.maxWaitMinutes} min` : ""}`);
+        const groupLines = groups.map((g, i) => [
+          `${i + 1}. [${g.key}] ${g.count} × ${g.state} (${g.category})${waited(g)}`,
+          ...g.stack.map((f) => `     ${f}`),
+          ...(g.createdBy ? [`     created by ${g.createdBy}`] : []),
+          `     goroutines ${g.ids.join(", ")}${g.count > g.ids.length ? ", …" : ""}`,
+        ].join("\n"));
+        const filtered = category || pattern || minCount > 1 ? ` (${selected.length} match the filters)` : "";
+        const text = `🧵 Goroutine dump of ${target ?? path.basename(source)}: ${goroutines.length} goroutines in ${all.length} distinct stacks
+
+📊 By wait reason:
+${categoryLines.join("\n")}
+
+🧩 Groups, largest first${filtered}:
+${groupLines.length > 0 ? groupLines.join("\n") : "None"}
+
+💡 Tip: Waits are only printed past a minute, so groups without one have waited less. Large channel, select or mutex groups with long waits are leak candidates; capture_goroutine_profile checks whether they keep growing, with the same group keys.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { source, total: goroutines.length, distinct: all.length, categories, matched: selected.length, groups } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error grouping goroutines: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
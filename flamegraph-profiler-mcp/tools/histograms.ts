@@ -0,0 +1,82 @@
+/**
+ * Export of per-call duration distributions as HdrHistogram files.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { existsSync } from "node:fs";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { z } from "zod";
+import { formatHgrm, hgrmFileName, HGRM_UNIT_NAMES, HGRM_UNITS, traceDistributions, type Distribution } from "../lib/histograms.js";
+import { dataDir } from "../lib/store.js";
+import { dumpTrace } from "../lib/trace.js";
+import { formatNanos } from "../lib/uprobes.js";
+
+export function formatDistribution(dist: Distribution): string {
+  return `p50 ${formatNanos(dist.p50)} · p90 ${formatNanos(dist.p90)} · p99 ${formatNanos(dist.p99)} · p99.9 ${formatNanos(dist.p999)} · max ${formatNanos(dist.max)} (${dist.count} calls, mean ${formatNanos(dist.mean)})`;
+}
+
+export function registerHistogramTools(server: McpServer) {
+  server.registerTool(
+    "export_histograms",
+    {
+      title: "Export Latency Histograms",
+      description: "Export the per-call duration distribution of every trace region (trace.WithRegion, trace.StartRegion) and task (trace.NewTask) in a runtime/trace as HdrHistogram percentile distribution files (.hgrm), one per region or task type, for tail-focused analysis with HdrHistogram's plotter and compatible tools. Lists p50 to p99.9 and max per type. Profiles only hold sums per function; wrap a function's body in a region to get its per-call distribution. For one function of a running process without code changes, use probe_function_latency with histogramPath.",
+      inputSchema: z.object({
+        tracePath: z.string().describe("Path to the runtime/trace file"),
+        outputDir: z.string().optional().describe("Directory to write the .hgrm files to (default: histograms/<trace name> under the data directory)"),
+        unit: z.enum(HGRM_UNIT_NAMES).optional().default("ms").describe("Unit of the values in the files (default: ms)"),
+        match: z.string().optional().describe("Only export regions and tasks whose type matches this regex"),
+        minCount: z.number().int().min(1).optional().default(1).describe("Skip types with fewer calls (default: 1)"),
+      }),
+    },
+    async ({ tracePath, outputDir, unit = "ms", match, minCount = 1 }): Promise<CallToolResult> => {
+      try {
+        if (!existsSync(tracePath)) {
+          throw new Error(`Trace not found: ${tracePath}`);
+        }
+        let filter: RegExp | undefined;
+        try {
+          filter = match ? new RegExp(match) : undefined;
+        } catch (error) {
+          throw new Error(`Invalid match regex '${match}': ${(error as Error).message}`);
+        }
+        const distributions = traceDistributions(dumpTrace(tracePath))
+          .filter((d) => d.count >= minCount && (!filter || filter.test(d.name)));
+        if (distributions.length === 0) {
+          throw new Error(`No ${match ? "matching " : ""}regions or tasks in the trace; annotate code with trace.WithRegion or trace.NewTask`);
+        }
+        const dir = path.resolve(outputDir ?? path.join(dataDir(), "histograms", path.basename(tracePath).replace(/\.[^.]*$/, "")));
+        await fs.mkdir(dir, { recursive: true });
+        const files: string[] = [];
+        for (const dist of distributions) {
+          const file = path.join(dir, hgrmFileName(dist));
+          await fs.writeFile(file, formatHgrm(dist, HGRM_UNITS[unit]));
+          files.push(file);
+        }
+
+        const rows = distributions.map((d, i) => `${i + 1}. ${d.kind} "${d.name}": ${formatDistribution(d)}`);
+        const text = `📊 Call duration distributions in ${path.basename(tracePath)}, slowest p99 first:
+
+${rows.join("\n")}
+
+📁 Wrote ${files.length} .hgrm file(s) in ${unit} to ${dir}
+💡 Tip: Compare the files of two runs in HdrHistogram's plotter (hdrhistogram.github.io/HdrHistogram/plotFiles.html) to see whether a change moved the tail or only the median.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: {
+            outputDir: dir,
+            unit,
+            distributions: distributions.map((d, i) => ({ ...d, values: undefined, file: files[i] })),
+          },
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error exporting histograms: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
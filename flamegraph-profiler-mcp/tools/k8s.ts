@@ -0,0 +1,141 @@
+/**
+ * Profiling Go workloads running in Kubernetes.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import fs from "node:fs/promises";
+import { z } from "zod";
+import { tagCommit } from "../lib/baselines.js";
+import { recordCapture, type Capture } from "../lib/captures.js";
+import { catalogProfile } from "../lib/catalog.js";
+import { checkCaptureSeconds } from "../lib/config.js";
+import { annotateWithPod, DEFAULT_PPROF_PORT, podMetadata, portForward } from "../lib/k8s.js";
+import { formatValue, readProfile, sampleIndexOf, toBaseUnit, writeProfile } from "../lib/pprof.js";
+import { duringWindow, progressReporter } from "../lib/progress.js";
+import { storedProfilePath } from "../lib/store.js";
+import { countingRequests, downloadProfile, WALLCLOCK_ENDPOINT } from "../lib/target.js";
+import { topReport } from "../lib/top.js";
+import { applyFrameFilters } from "../lib/transform.js";
+import { filterNote, frameFilterFields } from "./filters.js";
+
+// pprof endpoint for each profile type
+const ENDPOINTS = { cpu: "profile", wallclock: WALLCLOCK_ENDPOINT, heap: "heap", goroutine: "goroutine" } as const;
+
+const UNITS: Record<keyof typeof ENDPOINTS, Capture["unit"]> = { cpu: "seconds", wallclock: "seconds", heap: "bytes", goroutine: "count" };
+
+const ICONS: Record<keyof typeof ENDPOINTS, string> = { cpu: "🔥", wallclock: "⏱️", heap: "🧠", goroutine: "🧵" };
+
+// Profile types captured over a window of seconds, rather than as a snapshot
+const WINDOWED = new Set<keyof typeof ENDPOINTS>(["cpu", "wallclock"]);
+
+export function registerK8sTools(server: McpServer) {
+  server.registerTool(
+    "profile_k8s_pod",
+    {
+      title: "Profile Kubernetes Pod",
+      description: "Profile a Go container running in Kubernetes: port-forwards to its net/http/pprof port with kubectl, captures CPU, heap and goroutine profiles, and wall-clock profiles of every goroutine, running or waiting, from a /debug/fgprof handler, and stores them annotated with pod metadata (namespace, pod, container, image, node, owner, labels) for use with top_functions, diff_flamegraph and list_source.",
+      inputSchema: z.object({
+        namespace: z.string().optional().default("default").describe("Namespace of the pod (default: 'default')"),
+        pod: z.string().describe("Pod name"),
+        container: z.string().optional().describe("Container to profile (default: the pod's default container)"),
+        port: z.number().int().min(1).max(65535).optional().describe(`Container port serving /debug/pprof (default: a container port named 'pprof' or 'debug', else ${DEFAULT_PPROF_PORT})`),
+        profileTypes: z.array(z.enum(["cpu", "wallclock", "heap", "goroutine"])).optional().default(["cpu", "heap", "goroutine"]).describe("Profiles to capture (default: cpu, heap and goroutine); 'wallclock' needs a /debug/fgprof handler in the process"),
+        seconds: z.number().min(1).max(300).optional().default(10).describe("CPU and wall-clock profile duration in seconds (default: 10)"),
+        context: z.string().optional().describe("kubeconfig context (default: the current context)"),
+        commit: z.string().regex(/^[0-9a-f]{7,40}$/, "Expected a commit hash").optional().describe("Git commit the container's image was built from. Stored profiles are tagged with it so diff_flamegraph can pick the baseline of its nearest ancestor"),
+        ...frameFilterFields,
+      }),
+    },
+    async ({ namespace = "default", pod, container, port, profileTypes = ["cpu", "heap", "goroutine"], seconds = 10, context, commit, ...filters }, extra): Promise<CallToolResult> => {
+      try {
+        checkCaptureSeconds(seconds);
+        const progress = progressReporter(extra);
+        const started = Date.now();
+        const ref = { namespace, pod, container, context };
+        const metadata = await podMetadata(ref);
+        const pprofPort = port ?? metadata.pprofPort ?? DEFAULT_PPROF_PORT;
+        const forward = await portForward({ ...ref, container: metadata.container }, pprofPort);
+        const target = `k8s:${namespace}/${pod}/${metadata.container}`;
+
+        const profiles = [];
+        try {
+          const types = [...new Set(profileTypes)];
+          for (const [i, profileType] of types.entries()) {
+            // Start each capture's progress past the last one's, however long it took
+            const window = WINDOWED.has(profileType) ? seconds : 0;
+            const [file, requestLabels] = await countingRequests(forward.address, window, () => duringWindow(
+              progress,
+              `capturing ${profileType} profile from ${pod} (${i + 1}/${types.length})`,
+              window || undefined,
+              downloadProfile(forward.address, ENDPOINTS[profileType], window, extra.signal),
+              Math.floor((Date.now() - started) / 1000) + i,
+            ));
+            try {
+              const annotated = annotateWithPod(readProfile(file), metadata);
+              const profile = commit ? tagCommit(annotated, commit) : annotated;
+              const stored = await storedProfilePath(`${namespace}_${pod}_${profileType}`);
+              writeProfile(stored, profile);
+
+              const report = topReport(profile, sampleIndexOf(profile), 5);
+              const total = toBaseUnit(report.total, report.unit);
+              const topFunctions = report.functions.map((f) => ({ name: f.name, percentage: f.flatPct }));
+              const capture = await recordCapture({
+                target,
+                commit,
+                profileType,
+                duration: WINDOWED.has(profileType) ? seconds : 0,
+                total,
+                unit: UNITS[profileType],
+                topFunctions,
+                issues: 0,
+              }).catch(() => undefined);
+              const entry = await catalogProfile(stored, { target, profileType, commit, captureId: capture?.id, labels: requestLabels });
+              const view = applyFrameFilters(profile, filters);
+              const shown = view === profile ? report : topReport(view, sampleIndexOf(view), 5);
+              profiles.push({
+                profileType,
+                id: entry.id,
+                path: stored,
+                sampleType: report.sampleType,
+                total,
+                unit: report.unit,
+                summary: shown.summary,
+                topFunctions: shown.functions.map((f) => ({ name: f.name, percentage: f.flatPct })),
+              });
+            } finally {
+              await fs.unlink(file).catch(() => undefined);
+            }
+          }
+        } finally {
+          forward.close();
+        }
+
+        const details = [
+          metadata.image && `image ${metadata.image}`,
+          metadata.node && `node ${metadata.node}`,
+          metadata.owner,
+        ].filter(Boolean).join(", ");
+        const sections = profiles.map((p) => `${ICONS[p.profileType]} ${p.profileType.toUpperCase()}: ${p.unit === "count" ? p.total : formatValue(p.total, UNITS[p.profileType])}
+${p.summary}
+${p.topFunctions.slice(0, 3).map((f, i) => `  ${i + 1}. ${f.name} (${f.percentage}%)`).join("\n")}
+📁 ${p.id} (${p.path})`);
+        const text = `☸️ Profiled ${namespace}/${pod} container ${metadata.container}${details ? ` (${details})` : ""} via port ${pprofPort}${filterNote(filters)}
+
+${sections.join("\n\n")}
+
+💡 Tip: Profiles carry the pod metadata as comments (k8s.*)${commit ? ` and are tagged with commit ${commit.slice(0, 12)}` : ""}. Pass the profile IDs to top_functions, list_source or diff_flamegraph.`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { pod: metadata, profiles } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error profiling pod: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
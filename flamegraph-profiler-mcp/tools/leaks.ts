@@ -0,0 +1,96 @@
+/**
+ * Heap leak detection over a series of heap snapshots from a live target.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { z } from "zod";
+import { recordCapture } from "../lib/captures.js";
+import { keepProfile } from "../lib/catalog.js";
+import { checkCaptureSeconds, checkTarget } from "../lib/config.js";
+import { percentOf } from "../lib/flamegraph.js";
+import { captureHeapSeries, detectLeaks, type HeapSnapshot, type SiteTrend, type Trend } from "../lib/leaks.js";
+import { formatValue } from "../lib/pprof.js";
+import { progressReporter } from "../lib/progress.js";
+
+function formatTrend(trend: Trend): string {
+  return `${trend.perMinute >= 0 ? "+" : "-"}${formatValue(Math.abs(trend.perMinute), "bytes")}/min (r² ${trend.r2})`;
+}
+
+function formatLeak(site: SiteTrend, i: number): string {
+  const first = site.bytes[0];
+  const last = site.bytes[site.bytes.length - 1];
+  return [
+    `${i + 1}. ${site.function} (${path.basename(site.file)}:${site.line}): ${formatValue(first, "bytes")} → ${formatValue(last, "bytes")}, ${formatTrend(site)}, ${site.objects[0]} → ${site.objects[site.objects.length - 1]} objects`,
+    ...(site.stack.length > 1 ? [`   ↳ ${site.stack.join(" ← ")}`] : []),
+  ].join("\n");
+}
+
+export function registerLeakTools(server: McpServer) {
+  server.registerTool(
+    "detect_leak",
+    {
+      title: "Detect Heap Leak",
+      description: "Capture a series of heap snapshots from a live Go process serving net/http/pprof, each after a GC, fit each allocation site's in-use bytes over time, and report the sites that grew at every snapshot, fastest first, with their growth per minute and how steadily they grew. A much stronger leak signal than one heap profile, where a big cache and a leak look alike. The first and last snapshots are saved to the catalog for diff_flamegraph.",
+      inputSchema: z.object({
+        target: z.string().describe("Address of the pprof server (e.g., 'localhost:6060' or 'http://host:6060')"),
+        snapshots: z.number().int().min(3).max(60).optional().default(5).describe("Heap snapshots to take (default: 5)"),
+        interval: z.number().min(1).max(600).optional().default(30).describe("Seconds between snapshots (default: 30); slow leaks need longer"),
+        minGrowth: z.number().min(0).optional().default(1024 * 1024).describe("Bytes a site must gain from the first snapshot to the last to be reported (default: 1MB, about two heap samples)"),
+        limit: z.number().int().min(1).max(100).optional().default(10).describe("Number of sites to report (default: 10)"),
+      }),
+    },
+    async ({ target, snapshots: count = 5, interval = 30, minGrowth = 1024 * 1024, limit = 10 }, extra): Promise<CallToolResult> => {
+      let snapshots: HeapSnapshot[] = [];
+      try {
+        checkTarget(target);
+        checkCaptureSeconds((count - 1) * interval);
+        snapshots = await captureHeapSeries(target, count, interval, progressReporter(extra), extra.signal);
+        const report = detectLeaks(snapshots, minGrowth, limit);
+
+        const name = target.replace(/^https?:\/\//, "").replace(/[^\w.-]+/g, "_");
+        const first = await keepProfile(snapshots[0].file, `${name}_heap_first`, { target, profileType: "heap", labels: { series: "detect_leak" } });
+        const last = await keepProfile(snapshots[snapshots.length - 1].file, `${name}_heap_last`, { target, profileType: "heap", labels: { series: "detect_leak" } });
+        const total = report.totalBytes[report.totalBytes.length - 1];
+        await recordCapture({
+          target,
+          profileType: "heap",
+          duration: (count - 1) * interval,
+          total,
+          unit: "bytes",
+          topFunctions: report.leaks.map((l) => ({ name: l.function, percentage: percentOf(l.bytes[l.bytes.length - 1], total) })),
+          issues: report.leakCount,
+        }).catch(() => undefined);
+
+        const minutes = Math.round(((snapshots[snapshots.length - 1].at - snapshots[0].at) / 60_000) * 10) / 10;
+        const sites = report.leakCount > 0
+          ? `🚰 ${report.leakCount} site(s) grew at every snapshot${report.leakCount > report.leaks.length ? `, top ${report.leaks.length}` : ""}:
+${report.leaks.map(formatLeak).join("\n")}`
+          : `✅ No allocation site grew at every snapshot by ${formatValue(minGrowth, "bytes")} or more.`;
+        const text = `🔍 Heap leak check for ${target}: ${count} snapshots over ${minutes} min
+
+📈 In-use heap: ${report.totalBytes.map((b) => formatValue(b, "bytes")).join(" → ")} (${formatTrend(report.total)})
+
+${sites}${report.growing > 0 ? `\n\n${report.growing} other site(s) grew overall but shrank between snapshots, like caches that evict; not counted as leaks.` : ""}
+
+📁 First and last snapshots saved as ${first.id} and ${last.id}
+💡 Tip: ${report.leakCount > 0
+          ? `diff_flamegraph with baselinePath ${first.id}, comparisonPath ${last.id} and sampleType inuse_space shows which callers the growth comes from.`
+          : "Slow leaks can hide in short series; try more snapshots or a longer interval."}`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { target, ...report, firstProfileId: first.id, lastProfileId: last.id } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error detecting leaks: ${message}` }],
+          isError: true,
+        };
+      } finally {
+        await Promise.all(snapshots.map((s) => fs.unlink(s.file).catch(() => undefined)));
+      }
+    },
+  );
+}
@@ -0,0 +1,46 @@
+/**
+ * Exporting catalogued profiles as OpenTelemetry profiles.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { getProfile, isProfileId, resolveProfilePath } from "../lib/catalog.js";
+import { exportToOtlp } from "../lib/otlp.js";
+
+export function registerOtlpTools(server: McpServer) {
+  server.registerTool(
+    "export_otlp",
+    {
+      title: "Export to OTLP",
+      description: "Send a captured profile to the OpenTelemetry collector in PROFILER_OTLP_ENDPOINT (or OTEL_EXPORTER_OTLP_ENDPOINT) as an OTLP profile, with resource attributes for its target: service.name, and the container, pod and namespace of Docker and Kubernetes captures. Continuous profiling exports its snapshots too with PROFILER_CONTINUOUS_OTLP=true.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Catalog ID or path of the pprof profile to export"),
+        attributes: z.record(z.string(), z.string()).optional().default({}).describe("Resource attributes to add or override, e.g. {\"service.version\": \"v1.4\", \"deployment.environment.name\": \"staging\"}"),
+        outputPath: z.string().optional().describe("Write the OTLP/HTTP JSON request to this file instead of sending it, e.g. to inspect or replay it"),
+      }),
+    },
+    async ({ profilePath, attributes = {}, outputPath }): Promise<CallToolResult> => {
+      try {
+        const entry = isProfileId(profilePath) ? await getProfile(profilePath) : undefined;
+        const file = await resolveProfilePath(profilePath);
+        const exported = await exportToOtlp(file, entry?.target ?? file, attributes, { outputPath });
+        const resource = Object.entries(exported.attributes).map(([key, value]) => `${key}=${value}`).join(", ");
+        const text = `📤 ${outputPath ? "Wrote" : "Exported"} ${entry?.id ?? file} as an OTLP profile ${outputPath ? "to" : "at"} ${exported.url}
+🏷️ Resource: ${resource}
+📊 ${exported.samples} sample(s), ${Math.ceil(exported.bytes / 1024)} KB of OTLP JSON
+
+💡 Tip: The profiles signal is still in development; collectors need the profiles feature gate (--feature-gates=service.profilesSupport) to accept it.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { ...exported, profile: entry?.id ?? file } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error exporting to OTLP: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
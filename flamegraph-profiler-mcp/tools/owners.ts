@@ -0,0 +1,60 @@
+/**
+ * Ownership queries: which teams own the hotspots in a profile.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { resolveProfilePath } from "../lib/catalog.js";
+import { formatOwnerTotals, hotspotsByOwner, OWNERS_MAPPING_FILE, ownershipForProfile } from "../lib/owners.js";
+import { formatValue, readProfile, sampleIndexOf } from "../lib/pprof.js";
+import { versioned } from "../lib/schema.js";
+import { applyFrameFilters } from "../lib/transform.js";
+import { filterLine, frameFilterFields } from "./filters.js";
+
+export function registerOwnerTools(server: McpServer) {
+  server.registerTool(
+    "hotspots_by_owner",
+    {
+      title: "Hotspots by Owner",
+      description: `Attribute a profile's cost to owning teams using the repository's CODEOWNERS or a ${OWNERS_MAPPING_FILE} mapping, e.g. "top 5 hotspots owned by team-payments". Runtime and library costs count against the team whose code called them.`,
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file to analyze, or its catalog ID"),
+        owner: z.string().optional().describe("Only hotspots owned by this team (e.g., 'team-payments' or '@acme/team-payments')"),
+        repoPath: z.string().optional().describe("Repository containing CODEOWNERS (default: found from the profile's source paths)"),
+        limit: z.number().optional().default(5).describe("Number of hotspots to return (default: 5)"),
+        sampleType: z.string().optional().describe("Sample type to rank by (default: the profile's default type)"),
+        ...frameFilterFields,
+      }),
+    },
+    async ({ profilePath, owner, repoPath, limit = 5, sampleType, ...filters }): Promise<CallToolResult> => {
+      try {
+        const captured = readProfile(await resolveProfilePath(profilePath));
+        const profile = applyFrameFilters(captured, filters);
+        const ownership = await ownershipForProfile(captured, repoPath);
+        if (!ownership || ownership.rules.length === 0) {
+          throw new Error(`No CODEOWNERS or ${OWNERS_MAPPING_FILE} found${ownership ? ` in ${ownership.root}` : ""}${repoPath ? "" : "; pass repoPath"}`);
+        }
+        const report = hotspotsByOwner(profile, sampleIndexOf(profile, sampleType), ownership, owner, limit);
+
+        const rows = report.hotspots.map((h, i) =>
+          `${i + 1}. ${h.function}: ${formatValue(h.value, report.unit)} (${h.percentage}%) ${h.owners.length > 0 ? h.owners.join(" ") : "(unowned)"}`,
+        );
+        const text = `${filterLine(filters)}${formatOwnerTotals(report)}
+
+🔥 Top ${owner ? `Hotspots Owned by ${owner}` : "Hotspots"}:
+${rows.length > 0 ? rows.join("\n") : "None"}`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: versioned("ownership", report) as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error attributing ownership: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
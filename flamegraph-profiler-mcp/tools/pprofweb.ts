@@ -0,0 +1,70 @@
+/**
+ * Handing a stored profile off to pprof's interactive web UI.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { launchPprofWeb, listPprofWeb, stopPprofWeb } from "../lib/pprofweb.js";
+
+export function registerPprofWebTools(server: McpServer) {
+  server.registerTool(
+    "launch_pprof_web",
+    {
+      title: "Launch pprof Web UI",
+      description: "Open a stored profile in pprof's own web UI (`go tool pprof -http`) on a free local port and return its URL, for interactive exploration outside the conversation: graph, flamegraph, peek, source and disassembly views, with refine-as-you-go filters. With a baseline the UI shows the difference. The UI listens on 127.0.0.1 of the machine the server runs on, and shuts down after `minutes` or with stop_pprof_web.",
+      inputSchema: z.object({
+        profile: z.string().describe("Catalog ID or path of the profile to open"),
+        baseline: z.string().optional().describe("Catalog ID or path of a profile to subtract, to explore the difference (pprof -diff_base)"),
+        sampleType: z.string().optional().describe("Sample type to show first, e.g. 'alloc_space' (pprof -sample_index); the UI can switch later"),
+        minutes: z.number().int().min(1).max(24 * 60).optional().default(60).describe("Minutes before the UI shuts down by itself (default: 60)"),
+      }),
+    },
+    async ({ profile, baseline, sampleType, minutes = 60 }): Promise<CallToolResult> => {
+      try {
+        const session = await launchPprofWeb({ profile, baseline, sampleType, minutes });
+        const others = listPprofWeb().filter((s) => s.id !== session.id);
+        const text = `🌐 pprof web UI for ${profile}${baseline ? ` (diff against ${baseline})` : ""}: ${session.url}
+
+🆔 ${session.id}, running as pid ${session.pid} until ${session.expiresAt}${others.length > 0 ? `\n🗂️ Also running: ${others.map((s) => `${s.id} (${s.profile}) ${s.url}`).join(", ")}` : ""}
+
+💡 Tip: Open the URL on the machine the server runs on, or forward the port (\`ssh -L ${new URL(session.url).port}:127.0.0.1:${new URL(session.url).port}\`); stop it with stop_pprof_web ${session.id} when you are done.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: session as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error launching pprof web UI: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "stop_pprof_web",
+    {
+      title: "Stop pprof Web UI",
+      description: "Shut down a pprof web UI started with launch_pprof_web.",
+      inputSchema: z.object({
+        id: z.string().describe("Web UI ID from launch_pprof_web"),
+      }),
+    },
+    async ({ id }): Promise<CallToolResult> => {
+      try {
+        const session = stopPprofWeb(id);
+        return {
+          content: [{ type: "text", text: `⏹️ Stopped ${session.id} (${session.profile}) at ${session.url}` }],
+          structuredContent: session as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error stopping pprof web UI: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
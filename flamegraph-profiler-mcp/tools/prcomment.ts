@@ -0,0 +1,43 @@
+/**
+ * Pull request comments from diff and check results, for CI to post as they are.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { badgeUrl, checkBadgeName } from "../lib/badges.js";
+import { formatPrComment } from "../lib/prcomment.js";
+
+export function registerPrCommentTools(server: McpServer) {
+  server.registerTool(
+    "format_pr_comment",
+    {
+      title: "Format PR Comment",
+      description: "Render the structured result of diff_flamegraph, detect_regressions, check_budgets, check_profile_budget or check_slo as a GitHub pull request comment: a pass/fail headline, a compact Markdown table of what matters most, and collapsible <details> sections for the rest, kept under GitHub's comment size limit. The comment starts with a hidden <!-- flamegraph-profiler:<kind> --> marker so CI can find and update its earlier comment instead of posting a new one.",
+      inputSchema: z.object({
+        result: z.record(z.string(), z.unknown()).describe("Structured content of a diff_flamegraph, detect_regressions, check_budgets, check_profile_budget or check_slo call"),
+        title: z.string().optional().describe("Comment heading (default: after the kind of result, e.g. 'Profile diff')"),
+        maxRows: z.number().int().min(1).max(100).optional().default(10).describe("Rows in the open table before the rest folds into a <details> section (default: 10)"),
+        badge: z.string().optional().describe("Name of a diff_badge badge to show next to the heading; needs the server running over HTTP or PROFILER_PUBLIC_URL"),
+      }),
+    },
+    async ({ result, title, maxRows = 10, badge }): Promise<CallToolResult> => {
+      try {
+        const url = badge ? badgeUrl(checkBadgeName(badge)) : undefined;
+        if (badge && !url) {
+          throw new Error("Badges have no URL unless the server runs over HTTP or PROFILER_PUBLIC_URL is set");
+        }
+        const comment = formatPrComment(result, { title, maxRows, badgeUrl: url });
+        return {
+          content: [{ type: "text", text: comment.markdown }],
+          structuredContent: { ...comment, length: comment.markdown.length } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error formatting comment: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
@@ -0,0 +1,117 @@
+/**
+ * Prompt templates for guided profiling workflows: each one lays out the
+ * tool calls for a common question in order, so a user who does not know the
+ * tools can start from the question.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { GetPromptResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+
+function userPrompt(description: string, text: string): GetPromptResult {
+  return {
+    description,
+    messages: [{ role: "user", content: { type: "text", text } }],
+  };
+}
+
+// How to get a CPU profile of a target, by what the target looks like
+function cpuCaptureStep(target: string, seconds: string): string {
+  if (/\.go$/.test(target)) {
+    return `Profile the app with \`profile-app\` (appPath: "${target}", profileType: "cpu", duration: ${seconds}).`;
+  }
+  if (/^p_[0-9a-f]+$/.test(target) || /\.(pb\.gz|pprof|prof|pb)$/.test(target)) {
+    return `Use the existing profile "${target}" (pass it as profilePath below; \`get_profile\` shows its details).`;
+  }
+  if (/^\d+$/.test(target)) {
+    return `Profile process ${target} with \`profile_process_perf\` (pid: ${target}, seconds: ${seconds}) so time in syscalls is attributed too; if perf is unavailable, ask for the process's pprof address instead.`;
+  }
+  if (/^(https?:\/\/)?[\w.-]+:\d+$/.test(target)) {
+    return `Ask me to save http://${target.replace(/^https?:\/\//, "")}/debug/pprof/profile?seconds=${seconds} to a file, and add it with \`import_profile\`.`;
+  }
+  return `If "${target}" is a Docker container, use \`profile_docker_container\` (container: "${target}", profileType: "cpu", seconds: ${seconds}); if it is a Kubernetes pod, use \`profile_k8s_pod\`.`;
+}
+
+export function registerWorkflowPrompts(server: McpServer) {
+  server.registerPrompt(
+    "diagnose-cpu-hotspots",
+    {
+      title: "Diagnose CPU Hotspots",
+      description: "Find where a Go program spends its CPU time, down to the lines, and propose the fixes worth making.",
+      argsSchema: {
+        target: z.string().describe("What to profile: a Go source file (./sample-app/main.go), a saved profile (path or catalog ID), a Docker container or pod, a pprof address, or a process ID"),
+        seconds: z.string().optional().describe("Capture window in seconds (default: 10)"),
+        focus: z.string().optional().describe("Only look at stacks through functions matching this regex, e.g. a handler name"),
+      },
+    },
+    ({ target, seconds, focus }) => {
+      const window = seconds && /^\d+$/.test(seconds) ? seconds : "10";
+      const filter = focus ? `, focus: "${focus}"` : "";
+      return userPrompt(`Diagnose CPU hotspots in ${target}`, `Diagnose the CPU hotspots of ${target}${focus ? `, looking only at stacks through ${focus}` : ""}. Work through these steps with the profiler tools, and show me what each one found before moving on:
+
+1. ${cpuCaptureStep(target, window)} Note the catalog ID of the profile.
+2. Run \`top_functions\` on it (limit: 10${filter}) and tell me how concentrated the time is: a few functions, or spread thin.
+3. For the two hottest functions that are my code rather than the runtime or standard library, run \`function_detail\` (depth: 4${filter}) to see which callers pay for them and where their own time goes.
+4. Run \`list_source\` on the hottest of them to find the exact expensive lines.
+5. If runtime.mallocgc, runtime.gcBgMarkWorker or other GC frames take more than about 10%, the cost is allocation: say so, and suggest capturing a heap profile for \`alloc_hotspots\`.
+
+Finish with at most three fixes, most valuable first. For each: the function and file:line, what to change, and how much of the profile it could save, taken from the numbers above. Say plainly if nothing stands out.`);
+    },
+  );
+
+  server.registerPrompt(
+    "find-memory-leak",
+    {
+      title: "Find a Memory Leak",
+      description: "Tell a leak from normal growth by comparing heap profiles over time and checking for goroutine leaks.",
+      argsSchema: {
+        target: z.string().optional().describe("pprof address of the running service, e.g. localhost:6060, for goroutine captures"),
+        before: z.string().optional().describe("Earlier heap profile (path or catalog ID)"),
+        after: z.string().optional().describe("Later heap profile of the same process (path or catalog ID)"),
+      },
+    },
+    ({ target, before, after }) => {
+      const steps: string[] = [];
+      if (before && after) {
+        steps.push(`Run \`diff_flamegraph\` (baselinePath: "${before}", comparisonPath: "${after}", sampleType: "inuse_space") and list what grew. Growth that is roughly the same in every function points to more load; growth concentrated in a few allocation sites points to a leak.`);
+      } else {
+        steps.push(`I need two heap profiles of the same process taken some minutes apart. ${target
+          ? `If ${target} is continuously profiled, use \`what_changed\` (profileType: "heap") instead. Otherwise ask me to save http://${target.replace(/^https?:\/\//, "")}/debug/pprof/heap to a file twice, some minutes apart, and add both with \`import_profile\`.`
+          : "Ask me for them (paths or catalog IDs; `list_profiles` shows captured ones), or for the service's pprof address."} Then run \`diff_flamegraph\` on them with sampleType "inuse_space".`);
+      }
+      steps.push(`Run \`analyze_heap\` on the later profile${after ? ` ("${after}")` : ""} with mode "inuse_space" and name the sites holding the most live memory, with their average object sizes.`);
+      steps.push(`Run \`alloc_hotspots\` on the same profile with family "inuse" to see why those sites allocate on the heap.`);
+      steps.push(target
+        ? `Run \`capture_goroutine_profile\` (target: "${target}", interval: 30). Leaked goroutines keep their stacks and everything they reference alive, and show up as groups that keep growing.`
+        : "If the service's pprof address is known, run `capture_goroutine_profile` on it: leaked goroutines keep their stacks and everything they reference alive.");
+      return userPrompt("Find a memory leak", `Help me find out whether this Go service leaks memory, and where. Work through these steps with the profiler tools, and show me what each one found before moving on:
+
+${steps.map((step, i) => `${i + 1}. ${step}`).join("\n")}
+
+Finish with a verdict: leak, or growth that matches load or cache warm-up. For a leak, name the allocation site or goroutine group that keeps growing, the file:line, and what keeps it referenced (a map that is never pruned, a goroutine blocked forever on a channel, a slice that keeps its backing array, and so on).`);
+    },
+  );
+
+  server.registerPrompt(
+    "compare-before-after",
+    {
+      title: "Compare Before and After",
+      description: "Check whether a change made a Go program faster or slower, and explain the difference function by function.",
+      argsSchema: {
+        before: z.string().describe("Profile before the change (path or catalog ID)"),
+        after: z.string().describe("Profile after the change (path or catalog ID)"),
+        sampleType: z.string().optional().describe("Sample type to compare, e.g. cpu or alloc_space (default: the profiles' default)"),
+      },
+    },
+    ({ before, after, sampleType }) => {
+      const type = sampleType ? `, sampleType: "${sampleType}"` : "";
+      return userPrompt(`Compare ${before} with ${after}`, `Compare the profile before my change (${before}) with the one after it (${after}). Work through these steps with the profiler tools, and show me what each one found before moving on:
+
+1. Run \`diff_flamegraph\` (baselinePath: "${before}", comparisonPath: "${after}"${type}) and report the overall change and the biggest regressions and improvements.
+2. Run \`top_functions\` on each profile (limit: 10${type}) so the diff can be read against absolute numbers. If the totals differ a lot, check whether the captures had different durations or load before blaming the code.
+3. For the largest regression, run \`function_detail\` on it in both profiles${type ? ` (${type.slice(2)})` : ""} to see whether it got more expensive itself or is just called more, and from where.
+4. Run \`list_source\` on the regressed function in "${after}" to point at the lines.
+
+Finish with a verdict in one sentence: faster, slower or no meaningful change, by how much, and because of what. If it is an improvement worth keeping, suggest \`save_baseline\` with the after profile; if it is a regression, name the function and file:line to look at first.`);
+    },
+  );
+}
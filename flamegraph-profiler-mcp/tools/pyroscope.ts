@@ -0,0 +1,47 @@
+/**
+ * Pushing catalogued profiles to a Grafana Pyroscope server.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import path from "node:path";
+import { z } from "zod";
+import { getProfile, isProfileId, resolveProfilePath } from "../lib/catalog.js";
+import { pushToPyroscope } from "../lib/pyroscope.js";
+
+export function registerPyroscopeTools(server: McpServer) {
+  server.registerTool(
+    "push_to_pyroscope",
+    {
+      title: "Push to Pyroscope",
+      description: "Upload a captured profile to the Grafana Pyroscope server in PROFILER_PYROSCOPE_URL, under an application name and labels, so an ad-hoc capture lands in the continuous-profiling backend next to the fleet's profiles. Labels in PROFILER_PYROSCOPE_LABELS are added to every push. Continuous profiling pushes its snapshots too with PROFILER_CONTINUOUS_PYROSCOPE=true.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Catalog ID or path of the pprof profile to push"),
+        appName: z.string().optional().describe("Application name in Pyroscope (default: the profile's target, e.g. 'api' for docker:api)"),
+        labels: z.record(z.string(), z.string()).optional().default({}).describe("Labels to push with it, e.g. {\"env\": \"staging\", \"version\": \"v1.4\"}"),
+      }),
+    },
+    async ({ profilePath, appName, labels = {} }): Promise<CallToolResult> => {
+      try {
+        const entry = isProfileId(profilePath) ? await getProfile(profilePath) : undefined;
+        const file = await resolveProfilePath(profilePath);
+        const app = appName ?? path.basename((entry?.target ?? file).replace(/^\w+:/, "")).replace(/\.pb(\.gz)?$|\.pprof$|\.prof$|\.go$/, "");
+        const push = await pushToPyroscope(file, app, labels);
+        const range = `${new Date(push.from * 1000).toISOString()} → ${new Date(push.until * 1000).toISOString()}`;
+        const text = `📤 Pushed ${entry?.id ?? file} to Pyroscope as ${push.name}
+🔭 ${push.url}, ${range} (${Math.ceil(push.bytes / 1024)} KB)
+
+💡 Tip: Select ${app} in Pyroscope or Grafana to see this capture beside the fleet's profiles. For a server outside your network, push a redact_profile copy instead.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { ...push, profile: entry?.id ?? file } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error pushing to Pyroscope: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
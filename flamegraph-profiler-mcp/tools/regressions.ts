@@ -0,0 +1,144 @@
+/**
+ * Regression detection between catalogued profiles of a target.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { listProfiles, resolveProfilePath, type CatalogEntry } from "../lib/catalog.js";
+import { dominantCallPath } from "../lib/flamegraph.js";
+import { findingFromRegression, recordFindings, REGRESSION_THRESHOLD_PTS } from "../lib/findings.js";
+import { ownershipForProfile, ownersOf } from "../lib/owners.js";
+import { fileOf, readProfile, sampleIndexOf } from "../lib/pprof.js";
+import { CONFIDENCE_LEVELS, detectRegressions, formatRegression } from "../lib/regressions.js";
+import { versioned } from "../lib/schema.js";
+import { applySuppressions, listSuppressions } from "../lib/suppressions.js";
+import { applyFrameFilters, hasFrameFilters } from "../lib/transform.js";
+import { filterLine, frameFilterFields } from "./filters.js";
+
+// Catalogued profiles of one target, newest first. A partial target name must
+// match a single target.
+async function profilesOfTarget(target: string, profileType?: string): Promise<CatalogEntry[]> {
+  const entries = await listProfiles({ target, profileType });
+  const exact = entries.filter((e) => e.target === target);
+  if (exact.length > 0) {
+    return exact;
+  }
+  const targets = [...new Set(entries.map((e) => e.target))];
+  if (targets.length > 1) {
+    throw new Error(`'${target}' matches several targets (${targets.join(", ")}); pass the full target`);
+  }
+  if (entries.length === 0) {
+    throw new Error(`No catalogued ${profileType ? `${profileType} ` : ""}profiles for '${target}'; see list_profiles`);
+  }
+  return entries;
+}
+
+export function registerRegressionTools(server: McpServer) {
+  server.registerTool(
+    "detect_regressions",
+    {
+      title: "Detect Regressions",
+      description: "Compare the latest catalogued profile of a target against a baseline (by default the capture before it) and report functions whose flat or cumulative share grew beyond a threshold, e.g. \"main.jsonSerializationMess grew from 8% to 19%\". Each regression has a confidence level from its sample counts, so noise from short captures is separated from real growth. Confident regressions are recorded as findings.",
+      inputSchema: z.object({
+        target: z.string().optional().describe("Target whose latest profile to check (see list_profiles); not needed when profile is given"),
+        profile: z.string().optional().describe("Profile to check, as a catalog ID or path (default: the target's latest profile)"),
+        profileType: z.string().optional().describe("Profile type to compare, e.g. 'cpu' or 'heap' (default: the type of the target's latest profile)"),
+        baseline: z.string().optional().describe("Baseline as a catalog ID or path (default: the target's previous profile of the same type)"),
+        baselineLabels: z.record(z.string(), z.string()).optional().describe("Use the target's newest earlier profile carrying these labels as the baseline, e.g. {\"release\": \"v1.4\"}"),
+        thresholdPts: z.number().min(0).optional().default(REGRESSION_THRESHOLD_PTS).describe(`Minimum growth in percentage points of the total (default: ${REGRESSION_THRESHOLD_PTS})`),
+        measure: z.enum(["flat", "cum", "both"]).optional().default("both").describe("Which share to check: 'flat' (self), 'cum' (including callees) or 'both' (default)"),
+        minConfidence: z.enum(CONFIDENCE_LEVELS).optional().default("medium").describe("Lowest confidence to report (default: medium)"),
+        sampleType: z.string().optional().describe("Sample type to compare (default: the profile's default)"),
+        limit: z.number().int().min(1).optional().default(10).describe("Number of regressions to return (default: 10)"),
+        ...frameFilterFields,
+      }),
+    },
+    async ({ target, profile, profileType, baseline, baselineLabels, thresholdPts = REGRESSION_THRESHOLD_PTS, measure = "both", minConfidence = "medium", sampleType, limit = 10, ...filters }): Promise<CallToolResult> => {
+      try {
+        if (!target && !profile) {
+          throw new Error("Pass a target or a profile");
+        }
+        const catalog = await listProfiles();
+        const comparisonFile = profile
+          ? await resolveProfilePath(profile)
+          : (await profilesOfTarget(target ?? "", profileType))[0].path;
+        const current = catalog.find((e) => e.path === comparisonFile);
+        // Baselines are earlier captures of the same target and type
+        const history = current
+          ? catalog.filter((e) => e.target === current.target && e.profileType === current.profileType && e.at < current.at)
+          : target ? await profilesOfTarget(target, profileType) : [];
+
+        let baselineFile: string;
+        if (baseline) {
+          baselineFile = await resolveProfilePath(baseline);
+        } else {
+          const candidates = baselineLabels
+            ? history.filter((e) => Object.entries(baselineLabels).every(([key, value]) => e.labels[key] === value))
+            : history;
+          if (candidates.length === 0) {
+            throw new Error(baselineLabels
+              ? "No earlier profile of the target carries those labels; see list_profiles"
+              : "No earlier profile to compare against; pass baseline, or capture the target again");
+          }
+          baselineFile = candidates[0].path;
+        }
+        const baselineEntry = catalog.find((e) => e.path === baselineFile);
+
+        const before = applyFrameFilters(readProfile(baselineFile), filters);
+        const captured = readProfile(comparisonFile);
+        const after = applyFrameFilters(captured, filters);
+        const report = detectRegressions(before, after, { thresholdPts, sampleType, measure });
+        const minLevel = CONFIDENCE_LEVELS.indexOf(minConfidence);
+        const fileOfEither = (name: string) => fileOf(after, name) ?? fileOf(before, name);
+        const { kept, suppressed } = applySuppressions(
+          report.regressions,
+          await listSuppressions(),
+          (r) => r.name,
+          fileOfEither,
+        );
+        const confident = kept.filter((r) => CONFIDENCE_LEVELS.indexOf(r.confidence) >= minLevel);
+        const uncertain = kept.length - confident.length;
+
+        const ownership = await ownershipForProfile(captured);
+        const regressions = confident.slice(0, limit).map((r) => ({ ...r, owners: ownership ? ownersOf(ownership, r.name, fileOfEither(r.name)) : [] }));
+        const findings = await recordFindings(
+          regressions
+            .filter((r) => !hasFrameFilters(filters) && r.measure === "flat" && r.confidence !== "low")
+            .map((r) => ({
+              ...findingFromRegression(r, dominantCallPath(after, sampleIndexOf(after, report.sampleType), r.name), `${baselineFile} → ${comparisonFile}`),
+              owners: r.owners,
+            })),
+        );
+
+        const label = (file: string, entry?: CatalogEntry) => (entry ? `${entry.id} (${entry.at})` : file);
+        const lines = regressions.map((r, i) => `${i + 1}. ${formatRegression(r)}${r.owners.length > 0 ? ` 👥 ${r.owners.join(" ")}` : ""}`);
+        const text = `${filterLine(filters)}${confident.length > 0 ? `📈 ${confident.length} regression(s)${confident.length > regressions.length ? `, showing the largest ${regressions.length}` : ""}` : "✅ No regressions"} in ${current?.target ?? comparisonFile} (${report.sampleType}, ≥ ${thresholdPts} pts)
+🆚 ${label(baselineFile, baselineEntry)} → ${label(comparisonFile, current)}
+
+${lines.length > 0 ? lines.join("\n") : "None"}
+${uncertain > 0 ? `\n🎲 ${uncertain} more function(s) grew past the threshold with lower confidence; capture longer or pass minConfidence 'low' to see them.` : ""}${suppressed > 0 ? `\n🔕 ${suppressed} regression(s) hidden by suppressions` : ""}${findings.length > 0 ? `\n🔎 Recorded ${findings.length} finding(s): ${findings.map((f) => f.id).join(", ")}` : ""}
+
+💡 Tip: Confidence compares the functions' sample counts; short captures have few samples, so growth of a few points can be noise.`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: versioned("regressions", {
+            ...report,
+            regressions,
+            baseline: baselineEntry ?? baselineFile,
+            comparison: current ?? comparisonFile,
+            uncertain,
+            suppressed,
+            findings: findings.map((f) => f.id),
+          }) as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error detecting regressions: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
@@ -0,0 +1,59 @@
+/**
+ * Rendered flamegraphs of catalogued profiles as MCP resources, so clients
+ * that display resources can show them inline instead of a file path.
+ */
+import { ResourceTemplate, type McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { ReadResourceResult } from "@modelcontextprotocol/sdk/types.js";
+import { getProfile, listProfiles } from "../lib/catalog.js";
+import { ORIENTATIONS, type Orientation } from "../lib/charts.js";
+import { PROFILE_COLOR_SCHEMES, type ColorScheme } from "../lib/colors.js";
+import { FLAMEGRAPH_FORMATS, FLAMEGRAPH_URI_TEMPLATE, flamegraphMimeType, flamegraphUri, renderFlamegraph, type FlamegraphFormat } from "../lib/render.js";
+
+// Profiles listed by resources/list; older ones are still readable by URI
+const LISTED_PROFILES = 50;
+
+function single(value: string | string[] | undefined): string | undefined {
+  const first = Array.isArray(value) ? value[0] : value;
+  return first ? decodeURIComponent(first) : undefined;
+}
+
+export function registerFlamegraphResources(server: McpServer) {
+  server.registerResource(
+    "flamegraph",
+    new ResourceTemplate(FLAMEGRAPH_URI_TEMPLATE, {
+      list: async () => ({
+        resources: (await listProfiles()).slice(0, LISTED_PROFILES).map((entry) => ({
+          uri: flamegraphUri(entry.id),
+          name: `${entry.id} ${entry.profileType} flamegraph`,
+          description: `${entry.profileType} profile of ${entry.target} at ${entry.at}`,
+          mimeType: flamegraphMimeType(),
+        })),
+      }),
+    }),
+    {
+      title: "Flamegraph",
+      description: `Flamegraph of a catalogued profile (see list_profiles). view picks the sample type, e.g. cpu, samples, inuse_space or alloc_space; format is ${FLAMEGRAPH_FORMATS.join(", ")} (default: svg; interactive is a self-contained d3-flame-graph page with zoom, search and tooltips, for deep stacks; outline draws the graph as text bars, for clients that show no images); color is ${PROFILE_COLOR_SCHEMES.join(", ")} (default: classic unless the server config sets one); orientation is ${ORIENTATIONS.join(" or ")} (default: flame unless the server config sets one); inverted=true roots the graph at the functions samples end in; accessibility=true draws it in color-blind-safe colors and embeds the tree as text for screen readers; focus, ignore, show and hide filter frames by regex like pprof's options; mergeGenerics=true merges generic instantiations; hideKernel=true hides the kernel frames of perf profiles.`,
+      mimeType: flamegraphMimeType(),
+    },
+    async (uri, variables): Promise<ReadResourceResult> => {
+      const entry = await getProfile(single(variables.profileId) ?? "");
+      const format = (single(variables.format) ?? "svg") as FlamegraphFormat;
+      const { mimeType, text } = renderFlamegraph(entry, single(variables.view), format, {
+        focus: single(variables.focus),
+        ignore: single(variables.ignore),
+        show: single(variables.show),
+        hide: single(variables.hide),
+        mergeGenerics: single(variables.mergeGenerics) === "true",
+        hideKernel: single(variables.hideKernel) === "true",
+      }, {
+        color: single(variables.color) as ColorScheme | undefined,
+        orientation: single(variables.orientation) as Orientation | undefined,
+        inverted: variables.inverted === undefined ? undefined : single(variables.inverted) === "true",
+        accessibility: variables.accessibility === undefined ? undefined : single(variables.accessibility) === "true",
+      });
+      return {
+        contents: [{ uri: uri.href, mimeType, text }],
+      };
+    },
+  );
+}
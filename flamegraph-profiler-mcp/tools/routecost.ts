@@ -0,0 +1,180 @@
+/**
+ * Costs per request by route, and how they moved between captures.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { z } from "zod";
+import { keepProfile, resolveProfilePath } from "../lib/catalog.js";
+import { checkCaptureSeconds, checkTarget } from "../lib/config.js";
+import { formatValue, readProfile } from "../lib/pprof.js";
+import { duringWindow, progressReporter } from "../lib/progress.js";
+import { routeRequestsOf } from "../lib/rates.js";
+import { diffRouteCosts, routeCosts, type RouteCost, type RouteCostChange, type RouteCostReport } from "../lib/routecost.js";
+import { countingRequests, downloadProfile, ROUTE_REQUESTS_PREFIX } from "../lib/target.js";
+
+const requestsSchema = z.record(z.string(), z.number().positive());
+
+// Report of one capture: its profiles, with each route's request count given
+// or taken from the profiles' requests:<route> catalog labels
+async function reportOf(
+  sides: { profilePath?: string; allocProfilePath?: string; requests?: Record<string, number>; allocRequests?: Record<string, number> },
+  routeLabel: string,
+): Promise<RouteCostReport> {
+  const { profilePath, allocProfilePath } = sides;
+  if (!profilePath && !allocProfilePath) {
+    throw new Error("Pass a route-labelled CPU profile (profilePath), an allocation profile (allocProfilePath) or both");
+  }
+  const load = async (ref: string, given?: Record<string, number>) => ({
+    profile: readProfile(await resolveProfilePath(ref)),
+    requests: given ?? (await routeRequestsOf(ref)),
+  });
+  return routeCosts({
+    cpu: profilePath ? await load(profilePath, sides.requests) : undefined,
+    alloc: allocProfilePath ? await load(allocProfilePath, sides.allocRequests) : undefined,
+    routeLabel,
+  });
+}
+
+function formatCost(cost: RouteCost, i: number): string {
+  const parts: string[] = [];
+  if (cost.cpuNsPerRequest !== undefined) {
+    parts.push(`🔥 ${formatValue(cost.cpuNsPerRequest, "nanoseconds")} CPU/req over ${cost.cpuRequests} req (${cost.cpuPct}% of CPU)`);
+  } else if (cost.cpuPct !== undefined) {
+    parts.push(`🔥 ${cost.cpuPct}% of CPU, requests not counted`);
+  }
+  if (cost.allocBytesPerRequest !== undefined) {
+    const objects = cost.allocObjectsPerRequest !== undefined ? `, ${cost.allocObjectsPerRequest} objects` : "";
+    parts.push(`🧠 ${formatValue(cost.allocBytesPerRequest, "bytes")}${objects}/req over ${cost.allocRequests} req (${cost.allocPct}% of allocations)`);
+  } else if (cost.allocPct !== undefined) {
+    parts.push(`🧠 ${cost.allocPct}% of allocations, requests not counted`);
+  }
+  return `${i + 1}. ${cost.route}\n   ${parts.join(" · ")}${cost.entry ? `\n   ↳ allocations charged through ${cost.entry}` : ""}`;
+}
+
+function formatChange(change: RouteCostChange, i: number): string {
+  const { baseline, comparison } = change;
+  if (!baseline || !comparison) {
+    return `${i + 1}. ${change.route}: ${baseline ? "gone from the comparison" : "new in the comparison"}`;
+  }
+  const moved = (before: number | undefined, after: number | undefined, unit: string, pct: number | undefined) =>
+    before !== undefined && after !== undefined
+      ? `${formatValue(before, unit)} → ${formatValue(after, unit)}${pct !== undefined ? ` (${pct >= 0 ? "+" : ""}${pct}%)` : ""}`
+      : undefined;
+  const cpu = moved(baseline.cpuNsPerRequest, comparison.cpuNsPerRequest, "nanoseconds", change.cpuChangePct);
+  const alloc = moved(baseline.allocBytesPerRequest, comparison.allocBytesPerRequest, "bytes", change.allocChangePct);
+  const parts = [cpu && `CPU/req ${cpu}`, alloc && `allocated/req ${alloc}`].filter(Boolean);
+  return `${i + 1}. ${change.route}: ${parts.length > 0 ? parts.join(" · ") : "no cost per request on both sides"}`;
+}
+
+// Text and structured result of a report and, given a baseline, its changes
+function routeCostResult(heading: string, report: RouteCostReport, limit: number, baseline?: RouteCostReport): CallToolResult {
+  const changes = baseline ? diffRouteCosts(baseline, report) : undefined;
+  const notes = [
+    report.unlabeledCpuPct ? `${report.unlabeledCpuPct}% of CPU carries no '${report.routeLabel}' label` : "",
+    report.unattributedAllocPct ? `${report.unattributedAllocPct}% of allocations were charged to no route` : "",
+    report.noEntry?.length ? `no entry frame for ${report.noEntry.join(", ")}, whose allocations are among those` : "",
+  ].filter(Boolean);
+  const text = `${heading}
+
+${report.routes.slice(0, limit).map(formatCost).join("\n\n")}${report.routes.length > limit ? `\n… ${report.routes.length - limit} more route(s)` : ""}
+${notes.length > 0 ? `\n📊 ${notes.join("; ")}\n` : ""}${report.uncounted.length > 0 ? `\n⚠️ No request counts for ${report.uncounted.join(", ")}; pass them as requests and allocRequests, label the profiles requests:<route>=<count> with tag_profile, or count them with pkg/requests' Route or Do\n` : ""}${changes ? `\n📈 Cost per request against the baseline, largest increases first:\n${changes.slice(0, limit).map(formatChange).join("\n")}\n` : ""}
+💡 Tip: ${changes
+    ? "Costs per request hold still as load changes, so a rise here is the code or its data getting more expensive, not more traffic. Diff the two CPU profiles with focus set to the route's entry frame to see where."
+    : "Multiply a route's cost per request by its expected requests per second to size capacity; capture again after a change and pass these profiles as the baseline to compare."}`;
+  return {
+    content: [{ type: "text", text }],
+    structuredContent: { ...report, ...(baseline ? { baseline, changes } : {}) } as unknown as Record<string, unknown>,
+  };
+}
+
+const baselineFields = {
+  baselineProfilePath: z.string().optional().describe("Route-labelled CPU profile of an earlier capture to compare costs per request with, as a path or catalog ID"),
+  baselineAllocProfilePath: z.string().optional().describe("Allocation profile of the earlier capture, as a path or catalog ID"),
+  baselineRequests: requestsSchema.optional().describe("Requests per route during the baseline CPU profile (default: its requests:<route> catalog labels)"),
+  baselineAllocRequests: requestsSchema.optional().describe("Requests per route covered by the baseline allocation profile (default: its requests:<route> catalog labels)"),
+  routeLabel: z.string().optional().default("route").describe("pprof label key holding the route in the CPU profile (default: 'route', as pkg/requests sets it)"),
+  limit: z.number().int().min(1).max(100).optional().default(20).describe("Routes to list at most (default: 20)"),
+};
+
+export function registerRouteCostTools(server: McpServer) {
+  server.registerTool(
+    "route_costs",
+    {
+      title: "Route Costs",
+      description: "Report what one request costs on each route: CPU time per request from a CPU profile whose samples carry a route label (pkg/requests' Route or Do, or pprof.Do with pprof.Labels(\"route\", ...)), and allocated bytes and objects per request from an allocation profile, divided by the requests each route served while they were captured. Go labels no allocation samples, so allocations are charged to a route through its entry frame, the function on most of that route's CPU samples and on no other route's, typically its handler. With a baseline capture, shows how each route's cost per request moved, the number capacity planning needs: it stays put as traffic grows and only moves when the code does.",
+      inputSchema: z.object({
+        profilePath: z.string().optional().describe("Route-labelled CPU profile, as a path or catalog ID"),
+        allocProfilePath: z.string().optional().describe("Allocation profile (alloc_space), ideally a delta over the CPU profile's window (/debug/pprof/allocs?seconds=N), as a path or catalog ID"),
+        requests: requestsSchema.optional().describe("Requests per route during the CPU profile, e.g. {\"GET /users\": 1200} (default: its requests:<route> catalog labels)"),
+        allocRequests: requestsSchema.optional().describe("Requests per route covered by the allocation profile: during its window for a delta, since the process started for a heap snapshot (default: its requests:<route> catalog labels)"),
+        ...baselineFields,
+      }),
+    },
+    async ({ profilePath, allocProfilePath, requests, allocRequests, baselineProfilePath, baselineAllocProfilePath, baselineRequests, baselineAllocRequests, routeLabel = "route", limit = 20 }): Promise<CallToolResult> => {
+      try {
+        const report = await reportOf({ profilePath, allocProfilePath, requests, allocRequests }, routeLabel);
+        const baseline = baselineProfilePath || baselineAllocProfilePath
+          ? await reportOf({ profilePath: baselineProfilePath, allocProfilePath: baselineAllocProfilePath, requests: baselineRequests, allocRequests: baselineAllocRequests }, routeLabel)
+          : undefined;
+        const names = [profilePath, allocProfilePath].filter((p): p is string => p !== undefined).map((p) => path.basename(p)).join(" and ");
+        return routeCostResult(`💸 Cost per request by route, from ${names}${baseline ? ", against the baseline" : ""}`, report, limit, baseline);
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error reporting route costs: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "capture_route_costs",
+    {
+      title: "Capture Route Costs",
+      description: "Capture a CPU profile and an allocation delta over the same window from a live Go process that counts its requests by route with pkg/requests (served at /debug/requests), catalog both labelled with each route's requests, and report CPU time and allocated bytes per request on each route, as route_costs does. Pass the profile IDs of an earlier capture as the baseline to see how costs per request moved.",
+      inputSchema: z.object({
+        target: z.string().describe("pprof address of the process, e.g. 'localhost:6060' or 'http://localhost:6060/debug/pprof'"),
+        seconds: z.number().min(1).max(300).optional().default(15).describe("Capture window in seconds (default: 15)"),
+        ...baselineFields,
+      }),
+    },
+    async ({ target, seconds = 15, baselineProfilePath, baselineAllocProfilePath, baselineRequests, baselineAllocRequests, routeLabel = "route", limit = 20 }, extra): Promise<CallToolResult> => {
+      const files: string[] = [];
+      try {
+        checkTarget(target);
+        checkCaptureSeconds(seconds);
+        const progress = progressReporter(extra);
+        const [captured, labels] = await countingRequests(target, seconds, () => duringWindow(
+          progress,
+          "capturing CPU and allocation profiles",
+          seconds,
+          Promise.all([downloadProfile(target, "profile", seconds, extra.signal), downloadProfile(target, "allocs", seconds, extra.signal)]),
+        ));
+        files.push(...captured);
+        if (!Object.keys(labels).some((key) => key.startsWith(ROUTE_REQUESTS_PREFIX))) {
+          throw new Error(`${target} reported no requests by route during the window; count them with pkg/requests' Route or Do and serve requests.Handler() at /debug/requests`);
+        }
+        const cpu = await keepProfile(captured[0], `${target}_cpu`, { target, profileType: "cpu", labels });
+        const allocs = await keepProfile(captured[1], `${target}_allocs`, { target, profileType: "heap", labels });
+        const report = await reportOf({ profilePath: cpu.id, allocProfilePath: allocs.id }, routeLabel);
+        const baseline = baselineProfilePath || baselineAllocProfilePath
+          ? await reportOf({ profilePath: baselineProfilePath, allocProfilePath: baselineAllocProfilePath, requests: baselineRequests, allocRequests: baselineAllocRequests }, routeLabel)
+          : undefined;
+        const result = routeCostResult(`💸 Cost per request by route on ${target} (${seconds}s window${baseline ? ", against the baseline" : ""})\n📁 Saved as ${cpu.id} (CPU) and ${allocs.id} (allocations)`, report, limit, baseline);
+        result.structuredContent = { ...result.structuredContent, profileId: cpu.id, allocProfileId: allocs.id };
+        return result;
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error capturing route costs: ${message}` }],
+          isError: true,
+        };
+      } finally {
+        await Promise.all(files.map((file) => fs.unlink(file).catch(() => undefined)));
+      }
+    },
+  );
+}
@@ -0,0 +1,95 @@
+/**
+ * Profiling the bundled sample app without running it by hand, and a
+ * narrated tour of the profiler on it.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { formatRunProfile } from "../lib/build.js";
+import { checkCaptureSeconds } from "../lib/config.js";
+import { formatDemo, runDemo } from "../lib/demo.js";
+import { LANGS, t } from "../lib/i18n.js";
+import { duringWindow, progressReporter } from "../lib/progress.js";
+import { flamegraphLink } from "../lib/render.js";
+import { formatChaos, runSampleApp, SAMPLE_APP_DIR } from "../lib/sampleapp.js";
+
+export function registerSampleAppTools(server: McpServer) {
+  server.registerTool(
+    "run_sample_app",
+    {
+      title: "Run Sample App",
+      description: `Build the bundled, intentionally inefficient sample app (${SAMPLE_APP_DIR}), run it once with the chosen profiles enabled, and analyze each profile: top functions, anti-pattern findings, capture history and a catalog entry per profile. A quick way to try the other tools on real data. chaos injects CPU bursts and latency spikes at known times and returns their ground-truth log, to test triggers and anomaly detection against.`,
+      inputSchema: z.object({
+        duration: z.number().min(1).max(300).optional().default(5).describe("Seconds to run the app (default: 5)"),
+        profileTypes: z.array(z.enum(["cpu", "heap", "block", "mutex"])).min(1).optional().default(["cpu", "heap"]).describe("Profiles to write during the run (default: cpu and heap)"),
+        chaos: z.string().optional().describe("Anomalies to inject, as comma-separated kind@start+length, e.g. 'cpu@2s+1s,latency@4s+2s'; kinds are cpu (bursts on every core) and latency (200ms added to each loop iteration)"),
+        chaosRandom: z.number().int().min(0).max(20).optional().default(0).describe("Also inject this many anomalies of random kinds at random times (default: 0)"),
+        chaosSeed: z.number().int().optional().describe("Seed of the random anomalies, to repeat a run's (default: 1)"),
+        lang: z.enum(LANGS).optional().default("en").describe("Language of the report text (default: en); structured fields stay in English"),
+      }),
+    },
+    async ({ duration = 5, profileTypes = ["cpu", "heap"], chaos, chaosRandom = 0, chaosSeed, lang = "en" }, extra): Promise<CallToolResult> => {
+      try {
+        checkCaptureSeconds(duration);
+        const run = await duringWindow(progressReporter(extra), "running the sample app", duration,
+          runSampleApp({ duration, profileTypes: [...new Set(profileTypes)], chaos: { spec: chaos, random: chaosRandom, seed: chaosSeed }, signal: extra.signal }));
+        const findings = run.profiles.reduce((sum, p) => sum + p.findings.length, 0);
+        const summary = t(lang, "sampleApp.summary", {
+          seconds: run.duration.toFixed(2),
+          commit: run.commit ? t(lang, "run.atCommit", { commit: run.commit.slice(0, 12) }) : "",
+          profiles: run.profiles.length,
+          findings,
+        });
+        const text = `${summary}
+
+${run.profiles.map((p) => formatRunProfile(p, lang)).join("\n\n")}
+${run.chaos ? `\n${t(lang, "sampleApp.chaos")}\n${formatChaos(run.chaos).join("\n") || "None"}\n` : ""}
+${t(lang, "sampleApp.tip", { source: run.source })}`;
+        return {
+          content: [
+            { type: "text", text },
+            ...run.profiles.map((p) => flamegraphLink(p.profileId)),
+          ],
+          structuredContent: run as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error running sample app: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "run_demo",
+    {
+      title: "Run Demo",
+      description: "A one-call tour for new users: start the bundled sample app serving net/http/pprof, capture and analyze its CPU, heap and goroutines, switch it to its optimized scenario, capture CPU again and diff the two. Returns a narrated report of each step with the tools that do the same for your own programs; the profiles are saved to the catalog.",
+      inputSchema: z.object({
+        cpuSeconds: z.number().min(1).max(30).optional().default(5).describe("Seconds of each of the two CPU captures (default: 5)"),
+      }),
+    },
+    async ({ cpuSeconds = 5 }, extra): Promise<CallToolResult> => {
+      try {
+        checkCaptureSeconds(cpuSeconds);
+        const report = await runDemo({ cpuSeconds, progress: progressReporter(extra), signal: extra.signal });
+        return {
+          content: [
+            { type: "text", text: formatDemo(report) },
+            flamegraphLink(report.before[0].profileId),
+            flamegraphLink(report.after.profileId),
+          ],
+          structuredContent: report as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error running demo: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
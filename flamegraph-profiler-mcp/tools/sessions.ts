@@ -0,0 +1,255 @@
+/**
+ * Drill-down sessions: a working view refined over successive calls.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { isProfileId } from "../lib/catalog.js";
+import type { FunctionDelta } from "../lib/diff.js";
+import { formatValue } from "../lib/pprof.js";
+import { flamegraphLink } from "../lib/render.js";
+import {
+  describeSession,
+  endSession,
+  getSession,
+  listSessions,
+  refineSession,
+  SESSION_VIEWS,
+  sessionHistory,
+  sessionView,
+  startSession,
+  undoSession,
+  type Session,
+  type SessionViewResult,
+} from "../lib/sessions.js";
+import { frameFilterFields } from "./filters.js";
+
+const viewFields = {
+  view: z.enum(SESSION_VIEWS).optional().describe("What to show: 'top' functions, the 'diff' against the session's baseline, or the call 'tree' as indented text (default: diff when the session has a baseline, else top)"),
+  limit: z.number().optional().default(10).describe("Number of functions to list (default: 10)"),
+};
+
+function errorResult(error: unknown, action: string): CallToolResult {
+  const message = error instanceof Error ? error.message : "Unknown error";
+  return {
+    content: [{ type: "text", text: `Error ${action}: ${message}` }],
+    isError: true,
+  };
+}
+
+function formatView(result: SessionViewResult): string {
+  if (result.view === "top") {
+    const { report } = result;
+    const rows = report.functions.map((f) =>
+      `${formatValue(f.flat, report.unit).padStart(10)} ${`${f.flatPct}%`.padStart(7)} ${`${f.sumPct}%`.padStart(7)} ${formatValue(f.cum, report.unit).padStart(10)} ${`${f.cumPct}%`.padStart(7)}  ${f.name}`,
+    );
+    return `${report.summary}
+
+      flat   flat%    sum%        cum    cum%
+${rows.join("\n")}`;
+  }
+  if (result.view === "diff") {
+    const { diff } = result;
+    const formatDelta = (d: FunctionDelta, i: number) =>
+      `${i + 1}. ${d.name}: ${d.baselineFlatPct}% → ${d.comparisonFlatPct}% (${d.flatDeltaPct > 0 ? "+" : ""}${d.flatDeltaPct} pts flat, ${d.cumDeltaPct > 0 ? "+" : ""}${d.cumDeltaPct} pts cum)`;
+    return `🔧 Sample Type: ${diff.sampleType} (${diff.unit})
+
+📈 Largest Regressions:
+${diff.regressions.length > 0 ? diff.regressions.map(formatDelta).join("\n") : "None"}
+
+📉 Largest Improvements:
+${diff.improvements.length > 0 ? diff.improvements.map(formatDelta).join("\n") : "None"}`;
+  }
+  return `🌳 Call tree (${result.sampleType}):
+${result.lines.join("\n")}`;
+}
+
+// Text and structured result of a session's view, linking the flamegraph of
+// a catalogued profile with the session's filters
+function sessionResult(session: Session, result: SessionViewResult, heading: string, tip: string): CallToolResult {
+  const text = `${heading}
+🔬 ${describeSession(session)}
+
+${formatView(result)}
+
+💡 Tip: ${tip}`;
+  return {
+    content: [
+      { type: "text", text },
+      ...(isProfileId(session.profile) && !session.baseline
+        ? [flamegraphLink(session.profile, { view: session.sampleType, ...session.filters })]
+        : []),
+    ],
+    structuredContent: { session, ...result } as unknown as Record<string, unknown>,
+  };
+}
+
+export function registerSessionTools(server: McpServer) {
+  server.registerTool(
+    "start_session",
+    {
+      title: "Start Session",
+      description: "Start a named drill-down session on a profile, like opening it in pprof's interactive shell: the profile, an optional baseline to compare with, the sample type and pprof-style frame filters become the session's working view, which refine_session then narrows step by step and show_session renders, so no call has to repeat the filters. Starting a session under an existing name replaces it.",
+      inputSchema: z.object({
+        name: z.string().describe("Name of the session, used by the other session tools, e.g. 'checkout-latency'"),
+        profilePath: z.string().describe("Path or catalog ID of the profile to analyze"),
+        baselinePath: z.string().optional().describe("Path or catalog ID of a profile to compare with"),
+        sampleType: z.string().optional().describe("Sample type to analyze, e.g. 'cpu', 'inuse_space', 'alloc_objects' (default: the profile's default type)"),
+        ...frameFilterFields,
+        ...viewFields,
+      }),
+    },
+    async ({ name, profilePath, baselinePath, sampleType, view, limit = 10, ...filters }): Promise<CallToolResult> => {
+      try {
+        const { session, result } = await startSession(name, { profile: profilePath, baseline: baselinePath, sampleType, filters }, view, limit);
+        return sessionResult(session, result, `🆕 Started session ${session.name}`, `Narrow it with refine_session, e.g. {"name": "${session.name}", "focus": "<function>"}; an empty string clears a filter again.`);
+      } catch (error) {
+        return errorResult(error, "starting session");
+      }
+    },
+  );
+
+  server.registerTool(
+    "refine_session",
+    {
+      title: "Refine Session",
+      description: "Change a drill-down session's working view and show the result. Only the options given change, the rest of the session stays as it was, like setting options in pprof's interactive shell: set focus, then hide, then a baseline to diff against, one call each. An empty string clears a filter, the baseline or the sample type, false clears a flag, and reset clears every filter first.",
+      inputSchema: z.object({
+        name: z.string().describe("Name of the session"),
+        profilePath: z.string().optional().describe("Switch the session to another profile, keeping its filters"),
+        baselinePath: z.string().optional().describe("Profile to compare with; an empty string stops comparing"),
+        sampleType: z.string().optional().describe("Sample type to analyze; an empty string returns to the profile's default"),
+        ...frameFilterFields,
+        reset: z.boolean().optional().describe("Clear every frame filter before applying the others given"),
+        ...viewFields,
+      }),
+    },
+    async ({ name, profilePath, baselinePath, view, limit = 10, ...changes }): Promise<CallToolResult> => {
+      try {
+        const { session, result } = await refineSession(name, { ...changes, profile: profilePath, baseline: baselinePath }, view, limit);
+        return sessionResult(session, result, `🔎 Refined session ${session.name}`, "Each refinement is saved; undo_session backs out of one, and session_history lists them all.");
+      } catch (error) {
+        return errorResult(error, "refining session");
+      }
+    },
+  );
+
+  server.registerTool(
+    "show_session",
+    {
+      title: "Show Session",
+      description: "Render a drill-down session's current working view, with all of its filters applied: top functions, the diff against its baseline, or the call tree.",
+      inputSchema: z.object({
+        name: z.string().describe("Name of the session"),
+        ...viewFields,
+      }),
+    },
+    async ({ name, view, limit = 10 }): Promise<CallToolResult> => {
+      try {
+        const session = await getSession(name);
+        const result = await sessionView(session, view, limit);
+        return sessionResult(session, result, `📋 Session ${session.name}`, "Change the view with refine_session, or start over on another profile with start_session.");
+      } catch (error) {
+        return errorResult(error, "showing session");
+      }
+    },
+  );
+
+  server.registerTool(
+    "undo_session",
+    {
+      title: "Undo Session Step",
+      description: "Back a drill-down session out of its last refinements, e.g. a focus that hid what mattered, returning it to the state before them without repeating the steps that came earlier. Shows the view it returns to. See session_history for the steps.",
+      inputSchema: z.object({
+        name: z.string().describe("Name of the session"),
+        steps: z.number().int().min(1).optional().default(1).describe("Number of steps to undo (default: 1)"),
+        ...viewFields,
+      }),
+    },
+    async ({ name, steps = 1, view, limit = 10 }): Promise<CallToolResult> => {
+      try {
+        const { session, result, undone } = await undoSession(name, steps, view, limit);
+        const heading = `↩️ Undid ${undone.length} step(s) of session ${session.name}:
+${undone.map((step) => `• ${step.change}`).join("\n")}`;
+        return sessionResult(session, result, heading, "Undone steps are gone from the history; refine_session applies them again if needed.");
+      } catch (error) {
+        return errorResult(error, "undoing session step");
+      }
+    },
+  );
+
+  server.registerTool(
+    "session_history",
+    {
+      title: "Session History",
+      description: "List the steps of a drill-down session, oldest first: its start and each refinement, with what it changed and the working view after it, as undo_session would step back through them.",
+      inputSchema: z.object({
+        name: z.string().describe("Name of the session"),
+      }),
+    },
+    async ({ name }): Promise<CallToolResult> => {
+      try {
+        const session = await getSession(name);
+        const history = sessionHistory(session);
+        const text = `📜 History of session ${session.name} (${history.length} step(s)):
+${history.map((step, i) => `${i}. ${step.change} (${step.at})\n   → ${describeSession(step.state)}`).join("\n")}
+
+💡 Tip: undo_session with steps: N returns to the state N steps back.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { name: session.name, history } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "reading session history");
+      }
+    },
+  );
+
+  server.registerTool(
+    "list_sessions",
+    {
+      title: "List Sessions",
+      description: "List the drill-down sessions with their working views, most recently refined first.",
+      inputSchema: z.object({}),
+    },
+    async (): Promise<CallToolResult> => {
+      try {
+        const sessions = (await listSessions()).reverse();
+        const text = sessions.length > 0
+          ? `🔬 ${sessions.length} session(s):
+${sessions.map((s) => `• ${s.name}: ${describeSession(s)} (updated ${s.updatedAt})`).join("\n")}
+
+💡 Tip: Pick one up again with show_session.`
+          : "No sessions. Start one with start_session.";
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { sessions } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "listing sessions");
+      }
+    },
+  );
+
+  server.registerTool(
+    "end_session",
+    {
+      title: "End Session",
+      description: "Delete a drill-down session. The profiles it looked at are not touched.",
+      inputSchema: z.object({
+        name: z.string().describe("Name of the session"),
+      }),
+    },
+    async ({ name }): Promise<CallToolResult> => {
+      try {
+        const session = await endSession(name);
+        return {
+          content: [{ type: "text", text: `🗑️ Ended session ${session.name} (${describeSession(session)})` }],
+          structuredContent: { session } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "ending session");
+      }
+    },
+  );
+}
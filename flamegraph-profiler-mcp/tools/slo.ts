@@ -0,0 +1,85 @@
+/**
+ * Latency SLO checks combining an execution trace and a CPU profile.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { existsSync } from "node:fs";
+import path from "node:path";
+import { z } from "zod";
+import { resolveProfilePath } from "../lib/catalog.js";
+import { readProfile } from "../lib/pprof.js";
+import { checkSlo, parseTrace, SLO_PERCENTILES, type RouteSlo } from "../lib/slo.js";
+import { dumpTrace } from "../lib/trace.js";
+import { formatNanos } from "../lib/uprobes.js";
+
+function formatRoute(route: RouteSlo, i: number): string {
+  const { latency } = route;
+  const lines = [
+    `${i + 1}. ${route.violated ? "❌" : "✅"} ${route.route}: ${route.requests} request(s), p50 ${formatNanos(latency.p50)} · p90 ${formatNanos(latency.p90)} · p99 ${formatNanos(latency.p99)} · max ${formatNanos(latency.max)}${route.slow > 0 ? `, ${route.slow} over target (${route.slowPct}%)` : ""}`,
+  ];
+  if (route.tail) {
+    const { breakdown, slices, samples } = route.tail;
+    const spent = breakdown.running + breakdown.runnable + breakdown.blocked + breakdown.syscall;
+    const share = (ns: number) => `${spent > 0 ? Math.round((ns / spent) * 1000) / 10 : 0}%`;
+    const blockedBy = breakdown.blockedBy.filter((b) => b.ns >= spent / 1000).slice(0, 3).map((b) => `${b.reason} ${share(b.ns)}`).join(", ");
+    lines.push(`   ⏱️ Slow requests: running ${share(breakdown.running)} · waiting for CPU ${share(breakdown.runnable)} · blocked ${share(breakdown.blocked)}${blockedBy ? ` (${blockedBy})` : ""} · syscalls ${share(breakdown.syscall)}`);
+    if (slices.length > 0) {
+      lines.push(`   🔥 What the tail runs (${samples} CPU samples):`);
+      lines.push(...slices.map((s) =>
+        `      ${s.function}: on ${s.tailCumPct}% of tail samples, self ${s.tailFlatPct}%${s.withinCumPct !== undefined ? ` (within target: ${s.withinCumPct}%, self ${s.withinFlatPct}%)` : ""}`));
+    }
+  }
+  if (route.cpu) {
+    lines.push(`   🧮 ${route.cpu.pct}% of profiled CPU${route.cpu.top.length > 0 ? `, top: ${route.cpu.top.map((f) => `${f.name} (${f.flatPct}%)`).join(", ")}` : ""}`);
+  }
+  return lines.join("\n");
+}
+
+export function registerSloTools(server: McpServer) {
+  server.registerTool(
+    "check_slo",
+    {
+      title: "Check Latency SLO",
+      description: "Check per-route request latency against a target from a runtime/trace in which each request is a task named by its route (trace.NewTask(ctx, \"GET /users\")). Reports each route's p50/p90/p99, which routes miss the target at the chosen percentile, and for those, what explains the slow tail: where the slow requests' goroutines spent their time (on CPU, waiting for a CPU, blocked and on what, in syscalls) and which functions the trace's CPU samples inside slow requests land in, compared with requests that met the target. The trace needs CPU samples, i.e. a CPU profile running while it was recorded (as /debug/pprof/trace does while /debug/pprof/profile runs). Optionally adds each route's share of a CPU profile whose samples carry a route label (pprof.Do). Ends in a single verdict.",
+      inputSchema: z.object({
+        tracePath: z.string().describe("Path to the runtime/trace file"),
+        targetMs: z.number().positive().describe("Latency target in milliseconds, e.g. 200"),
+        percentile: z.enum(SLO_PERCENTILES).optional().default("p99").describe("Percentile the target applies to (default: p99)"),
+        profilePath: z.string().optional().describe("CPU profile of the same window with route labels, as a path or catalog ID"),
+        routeLabel: z.string().optional().default("route").describe("pprof label key holding the route in the profile (default: 'route')"),
+        limit: z.number().int().min(1).max(20).optional().default(5).describe("Tail functions to list per violating route (default: 5)"),
+      }),
+    },
+    async ({ tracePath, targetMs, percentile = "p99", profilePath, routeLabel = "route", limit = 5 }): Promise<CallToolResult> => {
+      try {
+        if (!existsSync(tracePath)) {
+          throw new Error(`Trace not found: ${tracePath}`);
+        }
+        const trace = parseTrace(dumpTrace(tracePath));
+        if (trace.requests.length === 0) {
+          throw new Error("The trace has no completed tasks; start one per request with trace.NewTask(ctx, route) and end it when the response is written");
+        }
+        const profile = profilePath ? readProfile(await resolveProfilePath(profilePath)) : undefined;
+        const report = checkSlo(trace, { targetNs: Math.round(targetMs * 1e6), percentile, profile, routeLabel, limit });
+
+        const noSamples = report.routes.some((r) => r.tail && r.tail.samples === 0);
+        const unlabeled = report.unlabeledCpuPct !== undefined && report.unlabeledCpuPct === 100;
+        const text = `🎯 SLO check for ${path.basename(tracePath)}: ${percentile} ≤ ${formatNanos(report.targetNs)} across ${report.routes.length} route(s)
+
+${report.routes.map(formatRoute).join("\n\n")}
+${noSamples ? "\n⚠️ No CPU samples fell inside the slow requests; record the trace while a CPU profile runs to see what they execute.\n" : ""}${unlabeled ? `\n⚠️ No samples in the profile carry a '${routeLabel}' label; wrap handlers in pprof.Do(ctx, pprof.Labels("${routeLabel}", route), ...) to split CPU by route.\n` : ""}
+${report.verdict}`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: report as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error checking SLO: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
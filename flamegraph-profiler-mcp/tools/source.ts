@@ -0,0 +1,107 @@
+/**
+ * Source-line views of profiled functions.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { z } from "zod";
+import { formatListing, listSource } from "../lib/annotate.js";
+import { resolveProfilePath } from "../lib/catalog.js";
+import { HOT_LINES_VERSION, hotLines } from "../lib/hotlines.js";
+import { readProfile, sampleIndexOf } from "../lib/pprof.js";
+import { applyFrameFilters } from "../lib/transform.js";
+import { filterLine, filterNote, frameFilterFields } from "./filters.js";
+
+export function registerSourceTools(server: McpServer) {
+  server.registerTool(
+    "list_source",
+    {
+      title: "Annotated Source",
+      description: "Show the source lines of functions matching a regex with flat and cumulative sample values per line, like `pprof list`, to pinpoint the exact expensive line (e.g. the `result +=` inside generateRandomString). Sources are read from the paths in the profile, the Go module cache and GOROOT, or a source root.",
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file, or its catalog ID"),
+        function: z.string().describe("Regular expression matched against function names (e.g., 'generateRandomString' or '^main\\\\.')"),
+        sourceRoot: z.string().optional().describe("Directory containing the sources if the profile's paths are not valid here (default: PROFILER_SOURCE_ROOT)"),
+        sampleType: z.string().optional().describe("Sample type to annotate (default: the profile's default type)"),
+        context: z.number().optional().default(2).describe("Unsampled lines to show around each sampled line (default: 2)"),
+        limit: z.number().optional().default(5).describe("Maximum number of matching functions to list (default: 5)"),
+        ...frameFilterFields,
+      }),
+    },
+    async ({ profilePath, function: functionPattern, sourceRoot, sampleType, context = 2, limit = 5, ...filters }): Promise<CallToolResult> => {
+      try {
+        const pattern = new RegExp(functionPattern);
+        const profile = applyFrameFilters(readProfile(await resolveProfilePath(profilePath)), filters);
+        const listing = await listSource(profile, sampleIndexOf(profile, sampleType), pattern, {
+          sourceRoot: sourceRoot ?? process.env.PROFILER_SOURCE_ROOT,
+          context,
+          limit,
+        });
+        if (listing.functions.length === 0) {
+          throw new Error(`No sampled functions match /${functionPattern}/`);
+        }
+        return {
+          content: [{ type: "text", text: `${filterLine(filters)}${formatListing(listing)}` }],
+          structuredContent: listing as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error listing source: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+  server.registerTool(
+    "export_hot_lines",
+    {
+      title: "Export Hot Lines",
+      description: `Export per-line hotness of a profile (file → line → flat and cumulative percent) in the stable hot lines JSON format (version ${HOT_LINES_VERSION}), for editor extensions that render heat gutters. Writes the JSON to a file when outputPath is given and always returns it as structured content.`,
+      inputSchema: z.object({
+        profilePath: z.string().describe("Path to the pprof file, or its catalog ID"),
+        outputPath: z.string().optional().describe("File to write the JSON to (e.g. '.hotlines.json' in the workspace)"),
+        sourceRoot: z.string().optional().describe("Directory containing the sources if the profile's paths are not valid here (default: PROFILER_SOURCE_ROOT)"),
+        sampleType: z.string().optional().describe("Sample type to export (default: the profile's default type)"),
+        minPct: z.number().min(0).optional().default(0.1).describe("Leave out lines with a cumulative share below this percent (default: 0.1)"),
+        ...frameFilterFields,
+      }),
+    },
+    async ({ profilePath, outputPath, sourceRoot, sampleType, minPct = 0.1, ...filters }): Promise<CallToolResult> => {
+      try {
+        const profile = applyFrameFilters(readProfile(await resolveProfilePath(profilePath)), filters);
+        const exported = hotLines(profile, sampleIndexOf(profile, sampleType), {
+          profile: profilePath,
+          sourceRoot: sourceRoot ?? process.env.PROFILER_SOURCE_ROOT,
+          minPct,
+        });
+        if (outputPath) {
+          await fs.writeFile(path.resolve(outputPath), `${JSON.stringify(exported, null, 2)}\n`);
+        }
+
+        const hottest = Object.entries(exported.files)
+          .flatMap(([file, lines]) => Object.entries(lines).map(([line, v]) => ({ file, line, ...v })))
+          .sort((a, b) => b.flat - a.flat)
+          .slice(0, 5);
+        const lineCount = Object.values(exported.files).reduce((sum, lines) => sum + Object.keys(lines).length, 0);
+        const text = `🔥 ${lineCount} hot line(s) in ${Object.keys(exported.files).length} file(s) (${exported.sampleType}, ≥ ${minPct}% cumulative)${filterNote(filters)}
+${hottest.map((l, i) => `${i + 1}. ${l.file}:${l.line} — ${l.flat}% flat, ${l.cum}% cum`).join("\n")}
+${exported.unresolved.length > 0 ? `\n⚠️ ${exported.unresolved.length} file(s) not found locally are keyed by their recorded path; pass sourceRoot to map them.` : ""}
+${outputPath ? `📁 Wrote ${path.resolve(outputPath)}` : "📄 JSON in the structured content"}
+💡 Tip: Editor extensions read this format (version ${exported.version}); see "Hot Lines Format" in the README.`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: exported as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error exporting hot lines: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
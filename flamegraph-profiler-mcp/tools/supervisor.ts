@@ -0,0 +1,204 @@
+/**
+ * Supervised targets and the postmortems collected when they crash.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import path from "node:path";
+import { z } from "zod";
+import { getProfile } from "../lib/catalog.js";
+import { topFunctionsOf } from "../lib/flamegraph.js";
+import { formatValue, readProfile, sampleIndexOf } from "../lib/pprof.js";
+import {
+  describeExit,
+  formatPostmortemSummary,
+  getPostmortem,
+  listPostmortems,
+  listSupervised,
+  stopSupervised,
+  superviseTarget,
+  type Postmortem,
+  type Supervised,
+} from "../lib/supervisor.js";
+
+// MemStats fields shown in a postmortem, with their units
+const MEMSTATS_FIELDS: Array<[string, "bytes" | "count"]> = [
+  ["HeapAlloc", "bytes"],
+  ["HeapInuse", "bytes"],
+  ["HeapSys", "bytes"],
+  ["StackInuse", "bytes"],
+  ["Sys", "bytes"],
+  ["NextGC", "bytes"],
+  ["NumGC", "count"],
+];
+
+function describeSupervised(s: Supervised): string {
+  const state = s.status === "running"
+    ? `running as pid ${s.pid} since ${s.startedAt}`
+    : `${s.status} (${describeExit(s)}) at ${s.exitedAt}`;
+  const snapshot = s.heapAt ? `; last heap snapshot ${s.heapAt}` : "";
+  const command = [path.basename(s.appPath), ...s.args].join(" ");
+  return `${s.id}: ${command} — ${state}${snapshot}${s.postmortemId ? `; postmortem ${s.postmortemId}` : ""}`;
+}
+
+async function formatPostmortem(p: Postmortem): Promise<string> {
+  const sections = [`🪦 ${formatPostmortemSummary(p)}`];
+  if (p.memStats) {
+    const stats = MEMSTATS_FIELDS
+      .filter(([name]) => p.memStats![name] !== undefined)
+      .map(([name, unit]) => `${name} ${unit === "bytes" ? formatValue(p.memStats![name], "bytes") : p.memStats![name]}`);
+    sections.push(`🧠 Last MemStats (${p.memStatsAt}): ${stats.join(", ")}`);
+  }
+  if (p.heapProfileId) {
+    const top = await getProfile(p.heapProfileId)
+      .then((entry) => {
+        const profile = readProfile(entry.path);
+        return topFunctionsOf(profile, sampleIndexOf(profile, "inuse_space")).slice(0, 5);
+      })
+      .catch(() => []);
+    if (top.length > 0) {
+      sections.push(`📦 In-use memory at ${p.heapAt}:\n${top.map((f, i) => `${i + 1}. ${f.name}: ${f.percentage}%`).join("\n")}`);
+    }
+  }
+  sections.push(`📜 Last ${p.logTail.length} log line(s):\n${p.logTail.join("\n") || "(no output)"}`);
+  if (p.notes.length > 0) {
+    sections.push(`⚠️ ${p.notes.join("\n⚠️ ")}`);
+  }
+  sections.push(`📁 Bundle: ${p.dir}`);
+  return sections.join("\n\n");
+}
+
+export function registerSupervisorTools(server: McpServer) {
+  server.registerTool(
+    "supervise_target",
+    {
+      title: "Supervise Target",
+      description: "Run a Go program under the server and collect a postmortem if it exits abnormally (non-zero exit, panic, fatal error, OOM or signal): its last logs, the final MemStats snapshot and most recent heap profile polled from its pprof address, and a core dump when enabled. Crashes are announced as log notifications. A clean exit or stop_supervised leaves no postmortem.",
+      inputSchema: z.object({
+        appPath: z.string().describe("Go source file to build and run (e.g., './sample-app/main.go'), or an executable"),
+        args: z.array(z.string()).optional().default([]).describe("Command-line arguments (e.g., ['-duration', '600', '-http', 'localhost:6060'])"),
+        address: z.string().optional().describe("pprof address the program serves (e.g., 'localhost:6060'), polled for heap profiles and MemStats"),
+        heapIntervalSeconds: z.number().int().min(5).max(3600).optional().default(30).describe("Seconds between heap and MemStats snapshots (default: 30)"),
+        coreDumps: z.boolean().optional().default(false).describe("Run with GOTRACEBACK=crash and no core size limit, and collect the core dump after a crash (default: false)"),
+      }),
+    },
+    async ({ appPath, args = [], address, heapIntervalSeconds = 30, coreDumps = false }): Promise<CallToolResult> => {
+      try {
+        const target = await superviseTarget({ appPath, args, address, heapIntervalSeconds, coreDumps }, (_target, postmortem) => {
+          server.sendLoggingMessage({
+            level: "error",
+            logger: "supervise_target",
+            data: `${formatPostmortemSummary(postmortem)}\nSee get_postmortem ${postmortem.id}`,
+          }).catch(() => undefined);
+        });
+        const text = `🛡️ Supervising ${describeSupervised(target)}
+
+${address ? `Heap profile and MemStats are polled from ${address} every ${heapIntervalSeconds}s` : "No pprof address given: a crash postmortem will hold logs only"}${coreDumps ? "; core dumps are enabled" : ""}.
+💡 Tip: Stop with stop_supervised when you are done; a stopped program leaves no postmortem.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: target as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error supervising target: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "list_supervised",
+    {
+      title: "List Supervised Targets",
+      description: "List the programs started with supervise_target, running or exited, with their postmortems.",
+      inputSchema: z.object({}),
+    },
+    async (): Promise<CallToolResult> => {
+      const targets = listSupervised();
+      const text = targets.length > 0
+        ? targets.map(describeSupervised).join("\n")
+        : "No supervised targets; start one with supervise_target";
+      return {
+        content: [{ type: "text", text }],
+        structuredContent: { targets } as unknown as Record<string, unknown>,
+      };
+    },
+  );
+
+  server.registerTool(
+    "stop_supervised",
+    {
+      title: "Stop Supervised Target",
+      description: "Stop a program started with supervise_target (SIGTERM) and forget it. No postmortem is collected.",
+      inputSchema: z.object({
+        id: z.string().describe("Supervised target ID from supervise_target or list_supervised"),
+      }),
+    },
+    async ({ id }): Promise<CallToolResult> => {
+      try {
+        const target = stopSupervised(id);
+        return {
+          content: [{ type: "text", text: `⏹️ Stopped ${target.id} (${path.basename(target.appPath)})` }],
+          structuredContent: target as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error stopping supervised target: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "list_postmortems",
+    {
+      title: "List Postmortems",
+      description: "List crash postmortems collected from supervised targets, newest first.",
+      inputSchema: z.object({
+        limit: z.number().int().min(1).optional().default(20).describe("Maximum number of postmortems to list (default: 20)"),
+      }),
+    },
+    async ({ limit = 20 }): Promise<CallToolResult> => {
+      const postmortems = (await listPostmortems()).slice(0, limit);
+      const text = postmortems.length > 0
+        ? postmortems.map(formatPostmortemSummary).join("\n")
+        : "No postmortems yet; they are collected when a target started with supervise_target crashes";
+      return {
+        content: [{ type: "text", text }],
+        structuredContent: { postmortems } as unknown as Record<string, unknown>,
+      };
+    },
+  );
+
+  server.registerTool(
+    "get_postmortem",
+    {
+      title: "Get Postmortem",
+      description: "Show a crash postmortem: why the program exited, its final MemStats, the top in-use memory sites of its last heap profile, its last log lines and where the bundle is stored.",
+      inputSchema: z.object({
+        id: z.string().describe("Postmortem ID from list_postmortems"),
+      }),
+    },
+    async ({ id }): Promise<CallToolResult> => {
+      try {
+        const postmortem = await getPostmortem(id);
+        const text = `${await formatPostmortem(postmortem)}
+💡 Tip: ${postmortem.core ? `Run analyze_core with postmortemId ${postmortem.id} to read every goroutine from the core, or open it with \`dlv core ${path.join(postmortem.dir, "binary")} ${postmortem.core}\`.` : postmortem.heapProfileId ? `Run analyze_heap on ${postmortem.heapProfileId} to see which allocation sites grew before the crash.` : "Pass an address to supervise_target so the next postmortem includes memory data."}`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: postmortem as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error getting postmortem: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
@@ -0,0 +1,93 @@
+/**
+ * Tools for managing suppressions of known, accepted hotspots.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import {
+  addSuppression,
+  formatSuppression,
+  listSuppressions,
+  removeSuppression,
+  type Suppression,
+} from "../lib/suppressions.js";
+
+function suppressionResult(suppression: Suppression, message: string): CallToolResult {
+  return {
+    content: [{ type: "text", text: `${message}\n${formatSuppression(suppression)}` }],
+    structuredContent: suppression as unknown as Record<string, unknown>,
+  };
+}
+
+function errorResult(error: unknown, action: string): CallToolResult {
+  const message = error instanceof Error ? error.message : "Unknown error";
+  return {
+    content: [{ type: "text", text: `Error ${action}: ${message}` }],
+    isError: true,
+  };
+}
+
+export function registerSuppressionTools(server: McpServer) {
+  server.registerTool(
+    "list_suppressions",
+    {
+      title: "List Suppressions",
+      description: "List suppressions: accepted hotspots that are left out of findings and differential comparisons.",
+      inputSchema: z.object({
+        includeExpired: z.boolean().optional().default(false).describe("Also list suppressions past their expiry date"),
+      }),
+    },
+    async ({ includeExpired = false }): Promise<CallToolResult> => {
+      try {
+        const suppressions = await listSuppressions(includeExpired);
+        const text = suppressions.length > 0
+          ? `${suppressions.length} suppression(s):\n${suppressions.map(formatSuppression).join("\n")}`
+          : "No active suppressions.";
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { suppressions } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        return errorResult(error, "listing suppressions");
+      }
+    },
+  );
+
+  server.registerTool(
+    "add_suppression",
+    {
+      title: "Add Suppression",
+      description: "Accept a known cost (e.g. intentional crypto work) so matching functions stop appearing in findings and diffs. Patterns are globs; give a function pattern, a file pattern, or both.",
+      inputSchema: z.object({
+        function: z.string().optional().describe("Glob on the function name including package path (e.g., 'crypto/*', 'main.hashChain')"),
+        file: z.string().optional().describe("Glob on the function's source file path (e.g., '*/internal/crypto/*')"),
+        justification: z.string().describe("Why this cost is accepted"),
+        expires: z.string().optional().describe("ISO date after which the suppression lapses (e.g., '2026-12-31')"),
+        author: z.string().optional().describe("Who is adding the suppression (default: 'anonymous')"),
+      }),
+    },
+    async ({ author = "anonymous", ...suppression }): Promise<CallToolResult> => {
+      try {
+        return suppressionResult(await addSuppression({ ...suppression, author }), "🔕 Suppression added.");
+      } catch (error) {
+        return errorResult(error, "adding suppression");
+      }
+    },
+  );
+
+  server.registerTool(
+    "remove_suppression",
+    {
+      title: "Remove Suppression",
+      description: "Remove a suppression so matching functions are reported again.",
+      inputSchema: z.object({ id: z.string().describe("Suppression ID (e.g., 's_1a2b3c4d')") }),
+    },
+    async ({ id }): Promise<CallToolResult> => {
+      try {
+        return suppressionResult(await removeSuppression(id), "🔔 Suppression removed.");
+      } catch (error) {
+        return errorResult(error, "removing suppression");
+      }
+    },
+  );
+}
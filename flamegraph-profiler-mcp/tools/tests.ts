@@ -0,0 +1,104 @@
+/**
+ * Profiling Go test and benchmark runs.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { formatBenchResult, runBenchmarks } from "../lib/bench.js";
+import { formatTestVariance, measureFlakiness } from "../lib/flakiness.js";
+import { formatValue } from "../lib/pprof.js";
+import { duringWindow, progressReporter } from "../lib/progress.js";
+import { flamegraphLink, flamegraphUri } from "../lib/render.js";
+
+export function registerTestTools(server: McpServer) {
+  server.registerTool(
+    "analyze_test_flakiness",
+    {
+      title: "Analyze Test Flakiness",
+      description: "Run a Go package's tests several times, each with an execution trace, and record every test's duration per run. Tests whose durations vary are checked against the GC and scheduler activity of each run: variance that follows them points to a noisy environment (allocation pressure, CPU contention), variance that does not points to the test itself.",
+      inputSchema: z.object({
+        packagePath: z.string().describe("Directory of the Go package whose tests to run (e.g., './internal/parser')"),
+        run: z.string().optional().describe("Only run tests matching this regular expression, as with go test -run"),
+        repetitions: z.number().int().min(3).max(20).optional().default(5).describe("Number of test runs (default: 5)"),
+        cvThresholdPct: z.number().min(0).optional().default(10).describe("Variation of a test's duration, in percent of its mean, above which it is not stable (default: 10)"),
+        minCorrelation: z.number().min(0).max(1).optional().default(0.7).describe("Correlation with GC share or scheduler latency from which variance is blamed on the environment (default: 0.7)"),
+        timeout: z.number().int().min(10).optional().default(300).describe("Timeout of each run in seconds (default: 300)"),
+        limit: z.number().int().min(1).optional().default(15).describe("Number of tests to list (default: 15)"),
+      }),
+    },
+    async ({ packagePath, run, repetitions = 5, cvThresholdPct = 10, minCorrelation = 0.7, timeout = 300, limit = 15 }, extra): Promise<CallToolResult> => {
+      try {
+        const report = await measureFlakiness({ packageDir: packagePath, run, repetitions, cvThresholdPct, minCorrelation, timeout, progress: progressReporter(extra), signal: extra.signal });
+        const count = (verdict: string) => report.tests.filter((t) => t.verdict === verdict).length;
+        const unstable = report.tests.filter((t) => t.verdict !== "stable" || t.failures > 0);
+        const runs = report.repetitions
+          .map((r) => `Run ${r.run}: GC ${r.gcPct}% of the trace, scheduler latency p90 ${formatValue(r.schedulerP90, "nanoseconds")}${r.failed.length > 0 ? `, ${r.failed.length} failed` : ""}`)
+          .join("\n");
+        const lines = unstable.slice(0, limit).map((t, i) => `${i + 1}. ${formatTestVariance(t)}`);
+
+        const text = `🧪 ${report.tests.length} test(s) in ${report.package} over ${report.repetitions.length} runs: ${count("stable")} stable, ${count("noisy-environment")} varying with the environment, ${count("variable-test")} varying on their own
+
+♻️ Runtime activity per run:
+${runs}
+
+${unstable.length > 0 ? `🎲 Unstable tests (most variable first):\n${lines.join("\n")}${unstable.length > lines.length ? `\n… and ${unstable.length - lines.length} more` : ""}` : `✅ Every test's duration stayed within ±${cvThresholdPct}% of its mean`}
+
+💡 Tip: Correlation is across whole runs, so a test that allocates heavily can drive the GC activity it correlates with; profile such a test on its own before blaming the environment.`;
+
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: report as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error analyzing test flakiness: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+  server.registerTool(
+    "profile_go_test",
+    {
+      title: "Profile Go Benchmarks",
+      description: "Run a Go package's benchmarks matching a pattern with `go test -bench -benchmem` and CPU and memory profiles. Returns each benchmark's time, bytes and allocations per op, plus flamegraphs of where the benchmarks spend CPU and allocate memory. The profiles are saved in the catalog.",
+      inputSchema: z.object({
+        packagePath: z.string().describe("Directory of the Go package whose benchmarks to run (e.g., './internal/parser')"),
+        bench: z.string().optional().default(".").describe("Regular expression selecting benchmarks, as with go test -bench (default: '.', all of them)"),
+        benchtime: z.string().optional().describe("Run time or iteration count per benchmark, as with -benchtime (e.g., '2s' or '1000x'; default: 1s)"),
+        count: z.number().int().min(1).max(20).optional().default(1).describe("Runs of each benchmark, for the spread of its timings (default: 1)"),
+        profileTypes: z.array(z.enum(["cpu", "heap"])).optional().default(["cpu", "heap"]).describe("Profiles to record (default: cpu and heap)"),
+        timeout: z.number().int().min(10).optional().default(600).describe("Timeout of the run in seconds (default: 600)"),
+      }),
+    },
+    async ({ packagePath, bench = ".", benchtime, count = 1, profileTypes = ["cpu", "heap"], timeout = 600 }, extra): Promise<CallToolResult> => {
+      try {
+        const run = await duringWindow(progressReporter(extra), "running benchmarks", undefined,
+          runBenchmarks({ packageDir: packagePath, bench, benchtime, count, profileTypes: [...new Set(profileTypes)], timeout, signal: extra.signal }));
+        const profiles = run.profiles.map((p) => `${p.profileType === "cpu" ? "🔥 CPU" : "🧠 Allocations"} (${p.profileId}):
+${p.topFunctions.slice(0, 5).map((f, i) => `${i + 1}. ${f.name}: ${f.percentage}%`).join("\n")}
+🖼️ Flamegraph: ${flamegraphUri(p.profileId, { view: p.view })}`);
+
+        const text = `⏱️ ${run.results.length} benchmark(s) in ${run.package}:
+${run.results.map(formatBenchResult).join("\n")}
+${profiles.length > 0 ? `\n${profiles.join("\n\n")}\n` : ""}
+💡 Tip: The profiles cover every selected benchmark together; narrow \`bench\` to one benchmark to see its costs alone, and use count ≥ 5 before trusting small differences.`;
+
+        return {
+          content: [
+            { type: "text", text },
+            ...run.profiles.map((p) => flamegraphLink(p.profileId, { view: p.view })),
+          ],
+          structuredContent: run as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error profiling benchmarks: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
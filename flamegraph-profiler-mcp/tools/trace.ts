@@ -0,0 +1,119 @@
+/**
+ * Execution trace capture and summarization.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { z } from "zod";
+import { recordCapture } from "../lib/captures.js";
+import { checkCaptureSeconds, checkTarget } from "../lib/config.js";
+import { percentOf } from "../lib/flamegraph.js";
+import { buildGoAppAsync, runGoAppAsync } from "../lib/goapp.js";
+import { formatValue } from "../lib/pprof.js";
+import { duringWindow, progressReporter } from "../lib/progress.js";
+import { downloadProfile } from "../lib/target.js";
+import { readTrace, type LatencyStats, type TraceSummary } from "../lib/trace.js";
+
+function formatNs(value: number): string {
+  return formatValue(value, "nanoseconds");
+}
+
+function formatLatency(stats: LatencyStats): string {
+  return `p50 ${formatNs(stats.p50)}, p90 ${formatNs(stats.p90)}, p99 ${formatNs(stats.p99)}, max ${formatNs(stats.max)} (${stats.count} events)`;
+}
+
+function formatTraceSummary(summary: TraceSummary, source: string): string {
+  const { goroutines, schedulerLatency, gc } = summary;
+  const timeline = goroutines.timeline.map((p) => p.count).join(" ");
+  const busiest = summary.busiest
+    .slice(0, 5)
+    .map((g, i) => `${i + 1}. goroutine ${g.id} (${g.startFunction}): ${formatNs(g.running)} running, scheduled ${g.schedules}×`)
+    .join("\n");
+
+  return `🧭 Execution Trace for ${source} (${formatNs(summary.duration)}):
+
+🧵 Goroutines: ${goroutines.created} created, ${goroutines.ended} ended, peak ${goroutines.peak} live
+   Live over time (goroutines active during the trace): ${timeline}
+
+⏱️ Scheduler Latency (runnable → running): ${formatLatency(schedulerLatency)}
+
+♻️ GC: ${gc.cycles} cycle(s), ${formatNs(gc.markTime)} in concurrent mark
+   Stop-the-world: ${formatNs(gc.stopTheWorld.total)} total, ${formatLatency(gc.stopTheWorld)}
+
+🔥 Busiest Goroutines:
+${busiest || "None"}
+
+💡 Tip: High scheduler latency with many short-lived goroutines points to goroutine churn; long stop-the-world pauses or many GC cycles point to allocation pressure.`;
+}
+
+export function registerTraceTools(server: McpServer) {
+  server.registerTool(
+    "capture_trace",
+    {
+      title: "Capture Execution Trace",
+      description: "Record a runtime/trace from a live Go process serving net/http/pprof, or from a run of a Go app that accepts -trace (like the sample app), and summarize it: goroutine counts over time, scheduler latency percentiles, GC cycles and stop-the-world pauses, and the busiest goroutines. Explains latency that CPU profiles cannot.",
+      inputSchema: z.object({
+        target: z.string().optional().describe("Address of the pprof server to trace (e.g., 'localhost:6060')"),
+        appPath: z.string().optional().describe("Path to a Go source file to build and run with -trace (e.g., './sample-app/main.go')"),
+        seconds: z.number().min(1).max(60).optional().default(5).describe("Trace duration in seconds (default: 5)"),
+      }),
+    },
+    async ({ target, appPath, seconds = 5 }, extra): Promise<CallToolResult> => {
+      let traceFile: string | undefined;
+      let binary: string | undefined;
+      try {
+        const source = target ?? appPath;
+        if (!source || (target && appPath)) {
+          throw new Error("Pass exactly one of target or appPath");
+        }
+        checkCaptureSeconds(seconds);
+        const progress = progressReporter(extra);
+        if (target) {
+          checkTarget(target);
+          traceFile = await duringWindow(progress, "recording trace", seconds, downloadProfile(target, "trace", seconds, extra.signal));
+        } else {
+          traceFile = `/tmp/trace_${Date.now()}.out`;
+          binary = `/tmp/${path.basename(source, ".go")}`;
+          progress(0, undefined, `building ${path.basename(source)}`);
+          await buildGoAppAsync(source, binary, extra.signal);
+          await duringWindow(progress, "recording trace", seconds, runGoAppAsync(binary, `-trace=${traceFile}`, seconds, extra.signal), 1);
+        }
+
+        const summary = readTrace(traceFile);
+        const running = summary.busiest.reduce((sum, g) => sum + g.running, 0);
+        await recordCapture({
+          target: target ?? path.resolve(source),
+          profileType: "trace",
+          duration: seconds,
+          total: summary.goroutines.peak,
+          unit: "count",
+          topFunctions: summary.busiest.map((g) => ({ name: g.startFunction, percentage: percentOf(g.running, running) })),
+          issues: 0,
+          gc: {
+            cycles: summary.gc.cycles,
+            markTime: summary.gc.markTime / 1e9,
+            stopTheWorld: summary.gc.stopTheWorld.total / 1e9,
+            maxPause: summary.gc.stopTheWorld.max / 1e9,
+          },
+        }).catch(() => undefined);
+        return {
+          content: [{ type: "text", text: formatTraceSummary(summary, source) }],
+          structuredContent: summary as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error capturing trace: ${message}` }],
+          isError: true,
+        };
+      } finally {
+        for (const file of [traceFile, binary]) {
+          if (file) {
+            await fs.unlink(file).catch(() => undefined);
+          }
+        }
+      }
+    },
+  );
+}
@@ -0,0 +1,53 @@
+/**
+ * Counting calls of one function in a live process with Delve tracepoints.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { checkCaptureSeconds } from "../lib/config.js";
+import { duringWindow, progressReporter } from "../lib/progress.js";
+import { formatArgument, formatProfileShare, traceFunction } from "../lib/tracepoints.js";
+
+export function registerTracepointTools(server: McpServer) {
+  server.registerTool(
+    "trace_function",
+    {
+      title: "Trace Function",
+      description: "Attach Delve (dlv must be on PATH) to a running Go process and set a tracepoint on one function for a time window: count its calls, its direct callers and summarize its argument values, without recompiling or restarting. With a profile of the same workload, the call rate is merged with the function's share of the profile to estimate its cost per call. The process stops briefly on every call while traced and keeps running afterwards.",
+      inputSchema: z.object({
+        pid: z.number().int().min(1).describe("Process ID of the running Go program"),
+        function: z.string().describe("Fully qualified function name, e.g. 'main.fibonacci' or 'github.com/org/app/pkg.(*Parser).Parse'; closures by their compiler name, e.g. 'main.worker.func1' rather than 'main.worker (closure at main.go:73)'"),
+        seconds: z.number().min(1).max(300).optional().default(10).describe("Seconds to trace (default: 10)"),
+        profileId: z.string().optional().describe("Profile of the same workload (catalog ID or path) to merge call counts with"),
+        sampleType: z.string().optional().describe("Sample type of that profile to use, e.g. 'cpu' or 'alloc_space' (default: the profile's default)"),
+        limit: z.number().int().min(1).max(50).optional().default(5).describe("Most frequent values to list per argument and callers to list (default: 5)"),
+      }),
+    },
+    async ({ pid, function: name, seconds = 10, profileId, sampleType, limit = 5 }, extra): Promise<CallToolResult> => {
+      try {
+        checkCaptureSeconds(seconds);
+        const trace = await duringWindow(progressReporter(extra), `tracing ${name}`, seconds,
+          traceFunction({ pid, function: name, seconds, limit, profileRef: profileId, sampleType, signal: extra.signal }));
+        const callers = trace.callers.slice(0, limit)
+          .map((c) => `  ${c.name}: ${c.count} (${Math.round((c.count / trace.calls) * 1000) / 10}%)`);
+        const notes = [
+          ...(trace.exited ? ["The process exited during the window."] : []),
+          ...(trace.truncated ? [`Tracing stopped after ${trace.calls} calls.`] : []),
+        ];
+        const text = `🔬 ${trace.function} in pid ${trace.pid}: ${trace.calls} call(s) in ${trace.seconds.toFixed(1)}s (${trace.callsPerSecond}/s)${notes.length > 0 ? `\n⚠️ ${notes.join(" ")}` : ""}
+${callers.length > 0 ? `\n📞 Callers:\n${callers.join("\n")}\n` : ""}${trace.arguments.length > 0 ? `\n🧾 Arguments:\n${trace.arguments.map((a) => `  ${formatArgument(a)}`).join("\n")}\n` : ""}${trace.profile ? `\n${formatProfileShare(trace.profile, trace.function)}\n` : ""}
+💡 Tip: Tracing stops the process on every call, so a hot function runs much slower while traced: keep windows short on production processes. ${trace.profile ? "The cost per call assumes the profile saw the same call rate." : "Pass profileId to estimate the cost per call."}`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: trace as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error tracing function: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
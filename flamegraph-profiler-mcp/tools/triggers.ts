@@ -0,0 +1,115 @@
+/**
+ * Capture triggers: profiling a live target automatically when its CPU or
+ * memory use stays above a threshold.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { checkCaptureSeconds, checkTarget } from "../lib/config.js";
+import { addTrigger, describeTrigger, formatFiring, listTriggers, removeTrigger, TRIGGER_PROFILE_TYPES } from "../lib/triggers.js";
+
+export function registerTriggerTools(server: McpServer) {
+  server.registerTool(
+    "add_trigger",
+    {
+      title: "Add Capture Trigger",
+      description: "Watch the CPU or memory use of a local process or Docker container, and when it stays at or above a threshold for a number of seconds, capture profiles from the target's pprof endpoint while it is happening. Each capture is saved in the profile catalog, labelled with the trigger, and announced as a log notification. Remove with remove_trigger.",
+      inputSchema: z.object({
+        target: z.string().describe("pprof address of the process to capture from (e.g., 'localhost:6060')"),
+        pid: z.number().int().min(1).optional().describe("ID of the local process whose stats to watch"),
+        container: z.string().optional().describe("Name or ID of the Docker container whose stats to watch, instead of a pid"),
+        metric: z.enum(["cpu", "rss"]).describe("cpu: CPU use in percent of one core; rss: resident memory"),
+        threshold: z.number().min(0).describe("Threshold: percent of one core for cpu (e.g., 150 for one and a half cores), MB for rss"),
+        forSeconds: z.number().int().min(1).max(3600).optional().default(30).describe("Seconds the metric must stay at or above the threshold (default: 30)"),
+        profileTypes: z.array(z.enum(TRIGGER_PROFILE_TYPES)).min(1).optional().default(["cpu", "heap", "goroutine"]).describe("Profiles to capture (default: cpu, heap and goroutine)"),
+        cpuSeconds: z.number().min(1).max(60).optional().default(10).describe("CPU profile window in seconds (default: 10)"),
+        cooldownMinutes: z.number().min(0).optional().default(10).describe("Minutes after a capture before the trigger can fire again (default: 10)"),
+      }),
+    },
+    async ({ target, pid, container, metric, threshold, forSeconds = 30, profileTypes = ["cpu", "heap", "goroutine"], cpuSeconds = 10, cooldownMinutes = 10 }): Promise<CallToolResult> => {
+      try {
+        if (target) {
+          checkTarget(target);
+        }
+        checkCaptureSeconds(cpuSeconds);
+        const trigger = await addTrigger({
+          target,
+          pid,
+          container,
+          metric,
+          threshold: metric === "rss" ? threshold * 1024 * 1024 : threshold,
+          forSeconds,
+          profileTypes: [...new Set(profileTypes)],
+          cpuSeconds,
+          cooldownSeconds: cooldownMinutes * 60,
+        }, (t, firing) => {
+          server.sendLoggingMessage({
+            level: Object.keys(firing.profiles).length > 0 ? "warning" : "error",
+            logger: "add_trigger",
+            data: formatFiring(t, firing),
+          }).catch(() => undefined);
+        });
+        const text = `🎯 Trigger ${trigger.id} added:
+${describeTrigger(trigger)}
+
+Stats are read every second; captures arrive as log notifications and in list_triggers, and the profiles are labelled trigger=${trigger.id} in the catalog.
+💡 Tip: Set the threshold above the target's normal peak, and forSeconds long enough to skip short bursts like startup or a GC cycle.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: trigger as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error adding trigger: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "list_triggers",
+    {
+      title: "List Capture Triggers",
+      description: "List the active capture triggers with their latest reading and capture.",
+      inputSchema: z.object({}),
+    },
+    async (): Promise<CallToolResult> => {
+      const triggers = listTriggers();
+      const text = triggers.length > 0
+        ? triggers.map((t) => `${describeTrigger(t)}${t.last ? `\n${formatFiring(t, t.last)}` : ""}`).join("\n\n")
+        : "No triggers active; add one with add_trigger";
+      return {
+        content: [{ type: "text", text }],
+        structuredContent: { triggers } as unknown as Record<string, unknown>,
+      };
+    },
+  );
+
+  server.registerTool(
+    "remove_trigger",
+    {
+      title: "Remove Capture Trigger",
+      description: "Stop a capture trigger added with add_trigger. Profiles it captured stay in the catalog.",
+      inputSchema: z.object({
+        id: z.string().describe("Trigger ID from add_trigger or list_triggers"),
+      }),
+    },
+    async ({ id }): Promise<CallToolResult> => {
+      try {
+        const trigger = removeTrigger(id);
+        return {
+          content: [{ type: "text", text: `⏹️ Removed ${trigger.id} after ${trigger.fired} capture(s)` }],
+          structuredContent: trigger as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error removing trigger: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
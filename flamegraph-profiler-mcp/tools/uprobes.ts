@@ -0,0 +1,64 @@
+/**
+ * Exact per-call latency of one function in a running Go binary with eBPF uprobes.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import fs from "node:fs/promises";
+import path from "node:path";
+import { z } from "zod";
+import { checkCaptureSeconds } from "../lib/config.js";
+import { distributionOfBuckets, formatHgrm, HGRM_UNIT_NAMES, HGRM_UNITS } from "../lib/histograms.js";
+import { duringWindow, progressReporter } from "../lib/progress.js";
+import { formatHistogram, formatNanos, probeLatency } from "../lib/uprobes.js";
+
+export function registerUprobeTools(server: McpServer) {
+  server.registerTool(
+    "probe_function_latency",
+    {
+      title: "Probe Function Latency",
+      description: "Linux only, needs root (or CAP_BPF and CAP_PERFMON) and bpftrace on PATH. Time every call of one function in a running amd64 Go binary with eBPF uprobes for a window: call count and rate, min, mean, max, p50/p90/p99 and a latency histogram, including time the call spends blocked or off-CPU. Sampled CPU profiles cannot give per-call latency. Optionally histograms one integer argument, and writes the latency histogram as an HdrHistogram file (.hgrm) for tail comparisons across runs. The binary needs its symbol table, and the process is not stopped; each call costs a few microseconds of probe overhead.",
+      inputSchema: z.object({
+        pid: z.number().int().min(1).describe("Process ID of the running Go program"),
+        function: z.string().describe("Fully qualified function name, e.g. 'main.fibonacci' or 'github.com/org/app/pkg.(*Parser).Parse'; closures by their compiler name, e.g. 'main.worker.func1' rather than 'main.worker (closure at main.go:73)'"),
+        seconds: z.number().int().min(1).max(300).optional().default(10).describe("Seconds to measure (default: 10)"),
+        argument: z.number().int().min(0).max(8).optional().describe("Histogram this integer argument word, by position in Go's register ABI (0 is the first; a string or slice takes 2 or 3 words, and floats are not counted)"),
+        histogramPath: z.string().optional().describe("Write the latency distribution to this HdrHistogram percentile distribution file (.hgrm)"),
+        unit: z.enum(HGRM_UNIT_NAMES).optional().default("ms").describe("Unit of the values in the .hgrm file (default: ms)"),
+      }),
+    },
+    async ({ pid, function: name, seconds = 10, argument, histogramPath, unit = "ms" }, extra): Promise<CallToolResult> => {
+      try {
+        checkCaptureSeconds(seconds);
+        const probe = await duringWindow(progressReporter(extra), `probing ${name}`, seconds,
+          probeLatency({ pid, function: name, seconds, argument, signal: extra.signal }));
+        let hgrm: string | undefined;
+        if (histogramPath && probe.calls > 0) {
+          hgrm = path.resolve(histogramPath);
+          await fs.mkdir(path.dirname(hgrm), { recursive: true });
+          await fs.writeFile(hgrm, formatHgrm(distributionOfBuckets(probe.function, "function", probe.histogram), HGRM_UNITS[unit]));
+        }
+        const stats = probe.calls > 0
+          ? `⏱️ min ${formatNanos(probe.minNs ?? 0)} · mean ${formatNanos(probe.meanNs ?? 0)} · max ${formatNanos(probe.maxNs ?? 0)}
+📊 p50 ≈ ${formatNanos(probe.p50Ns ?? 0)} · p90 ≈ ${formatNanos(probe.p90Ns ?? 0)} · p99 ≈ ${formatNanos(probe.p99Ns ?? 0)}
+
+Latency histogram:
+${formatHistogram(probe.histogram, formatNanos)}
+${probe.argument ? `\n🧾 Argument ${probe.argument.index} (${probe.argument.register}):\n${formatHistogram(probe.argument.histogram, String)}\n` : ""}`
+          : `⚠️ No calls completed in the window. Is ${probe.function} called, or inlined into its callers?\n`;
+        const text = `🐝 ${probe.function} in pid ${probe.pid}: ${probe.calls} call(s) in ${probe.seconds.toFixed(1)}s (${probe.callsPerSecond}/s), ${probe.returnSites} return site(s) probed
+${stats}${hgrm ? `📁 Wrote the latency distribution in ${unit} to ${hgrm} (values are bucket tops, so it has power-of-two resolution)\n` : ""}
+💡 Tip: Percentiles are interpolated within power-of-two buckets, so read them as ranges. Calls still running at the end of the window, and returns by tail call, are not counted.`;
+        return {
+          content: [{ type: "text", text }],
+          structuredContent: { ...probe, histogramPath: hgrm } as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error probing function latency: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}
@@ -0,0 +1,94 @@
+/**
+ * Watch mode: re-profiling an app on every change to its module.
+ */
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js";
+import type { CallToolResult } from "@modelcontextprotocol/sdk/types.js";
+import { z } from "zod";
+import { checkCaptureSeconds } from "../lib/config.js";
+import { formatWatchRun, listWatches, startWatch, stopWatch } from "../lib/watch.js";
+
+export function registerWatchTools(server: McpServer) {
+  server.registerTool(
+    "watch_target",
+    {
+      title: "Watch Target",
+      description: "Watch a Go app's module for source changes, and on every change rebuild it, re-run the profiling scenario and send a log notification summarizing the total and the functions that grew or shrank against the previous run. Returns after the first run, which is the starting point. Stop with stop_watch.",
+      inputSchema: z.object({
+        appPath: z.string().describe("Path to the Go source file to profile (e.g., './sample-app/main.go'); its whole module is watched"),
+        profileType: z.enum(["cpu", "heap", "block", "mutex"]).optional().default("cpu").describe("Profile to capture on each run (default: cpu)"),
+        duration: z.number().min(1).max(60).optional().default(5).describe("Seconds to run the app per change (default: 5)"),
+      }),
+    },
+    async ({ appPath, profileType = "cpu", duration = 5 }): Promise<CallToolResult> => {
+      try {
+        checkCaptureSeconds(duration);
+        const watch = await startWatch({ appPath, profileType, duration }, (w, run) => {
+          server.sendLoggingMessage({
+            level: run.error ? "error" : "info",
+            logger: "watch_target",
+            data: formatWatchRun(w, run),
+          }).catch(() => undefined);
+        });
+        const text = `${watch.last ? formatWatchRun(watch, watch.last) : ""}
+
+👀 Watching ${watch.moduleDir} as ${watch.id}. Each change to a .go file, go.mod or go.sum rebuilds and re-profiles the app for ${duration}s; results arrive as log notifications and in list_watches.
+💡 Tip: Stop with stop_watch when you are done; every run is saved in the profile catalog.`;
+        return {
+          content: [{ type: "text", text: text.trimStart() }],
+          structuredContent: watch as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error watching target: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+
+  server.registerTool(
+    "list_watches",
+    {
+      title: "List Watches",
+      description: "List the running watch_target watches with the summary of their latest run.",
+      inputSchema: z.object({}),
+    },
+    async (): Promise<CallToolResult> => {
+      const watches = listWatches();
+      const text = watches.length > 0
+        ? watches.map((w) => `${w.id}: ${w.appPath} (${w.profileType}, ${w.runs} run(s) since ${w.startedAt})${w.last ? `\n${formatWatchRun(w, w.last)}` : ""}`).join("\n\n")
+        : "No watches running; start one with watch_target";
+      return {
+        content: [{ type: "text", text }],
+        structuredContent: { watches } as unknown as Record<string, unknown>,
+      };
+    },
+  );
+
+  server.registerTool(
+    "stop_watch",
+    {
+      title: "Stop Watch",
+      description: "Stop a watch started with watch_target.",
+      inputSchema: z.object({
+        id: z.string().describe("Watch ID from watch_target or list_watches"),
+      }),
+    },
+    async ({ id }): Promise<CallToolResult> => {
+      try {
+        const watch = stopWatch(id);
+        return {
+          content: [{ type: "text", text: `⏹️ Stopped ${watch.id} after ${watch.runs} run(s) of ${watch.appPath}` }],
+          structuredContent: watch as unknown as Record<string, unknown>,
+        };
+      } catch (error) {
+        const message = error instanceof Error ? error.message : "Unknown error";
+        return {
+          content: [{ type: "text", text: `Error stopping watch: ${message}` }],
+          isError: true,
+        };
+      }
+    },
+  );
+}